@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"qcc_plus/internal/client"
+	"qcc_plus/internal/config"
 	"qcc_plus/internal/proxy"
 	"qcc_plus/internal/store"
 	"qcc_plus/internal/version"
@@ -23,13 +24,6 @@ func firstNonEmpty(vals ...string) string {
 	return ""
 }
 
-func getenvDefault(k, def string) string {
-	if v := os.Getenv(k); v != "" {
-		return v
-	}
-	return def
-}
-
 func buildLocalURL(listenAddr string) string {
 	if strings.HasPrefix(listenAddr, "http://") || strings.HasPrefix(listenAddr, "https://") {
 		return listenAddr
@@ -49,10 +43,18 @@ func main() {
 		info := version.GetVersionInfo()
 		log.Printf("qcc_plus version: %s (commit=%s, build_utc=%s, build_bj=%s, go=%s)", info.Version, info.GitCommit, info.BuildDate, info.BuildDateBeijing, info.GoVersion)
 
-		upstreamRaw := firstNonEmpty(os.Getenv("UPSTREAM_BASE_URL"), os.Getenv("ANTHROPIC_BASE_URL"), "https://api.anthropic.com")
-		upstreamKey := firstNonEmpty(os.Getenv("UPSTREAM_API_KEY"), os.Getenv("ANTHROPIC_API_KEY"))
-		nodeName := getenvDefault("UPSTREAM_NAME", "default")
-		listenAddr := getenvDefault("LISTEN_ADDR", ":8000")
+		boot, err := config.Load("")
+		if err != nil {
+			log.Fatal(err)
+		}
+		if boot.Path != "" {
+			log.Printf("loaded config file: %s", boot.Path)
+		}
+		socketMode, _ := boot.SocketMode() // Load 已校验
+		upstreamRaw := boot.Upstream.BaseURL
+		upstreamKey := boot.Upstream.APIKey
+		nodeName := boot.Upstream.Name
+		listenAddr := boot.ListenAddr
 		retryMax := 3
 		if v := os.Getenv("PROXY_RETRY_MAX"); v != "" {
 			if n, err := strconv.Atoi(v); err == nil && n > 0 {
@@ -79,17 +81,23 @@ func main() {
 				log.Printf("invalid PROXY_HEALTH_CHECK_ALL_INTERVAL=%s, fallback to %v", v, healthAllInterval)
 			}
 		}
-		mysqlDSN := os.Getenv("PROXY_MYSQL_DSN")
-		adminKey := os.Getenv("ADMIN_API_KEY")
-		if adminKey == "" {
-			adminKey = "admin"
+		storeDSN := boot.MySQLDSN
+		if storeDSN == "" {
+			if strings.EqualFold(boot.SQLitePath, "off") {
+				log.Println("PROXY_MYSQL_DSN not set and PROXY_SQLITE_PATH=off: running in memory-only mode, nodes/settings/metrics/sessions are lost on restart")
+			} else {
+				log.Printf("PROXY_MYSQL_DSN not set: using embedded SQLite store at %s", boot.SQLitePath)
+				storeDSN = "sqlite:" + boot.SQLitePath
+			}
+		}
+		adminKey := boot.Admin.APIKey
+		if boot.Sources["admin.api_key"] == config.SourceDefault {
 			log.Println("WARNING: ADMIN_API_KEY not set, using default: 'admin' (change it in production)")
 		}
 
-		defaultAccountName := getenvDefault("DEFAULT_ACCOUNT_NAME", "default")
-		defaultProxyKey := os.Getenv("DEFAULT_PROXY_API_KEY")
-		if defaultProxyKey == "" {
-			defaultProxyKey = "default-proxy-key"
+		defaultAccountName := boot.Admin.DefaultAccount
+		defaultProxyKey := boot.Admin.DefaultProxyKey
+		if boot.Sources["admin.default_proxy_key"] == config.SourceDefault {
 			log.Println("WARNING: DEFAULT_PROXY_API_KEY not set, using default: 'default-proxy-key' (change it in production)")
 		}
 
@@ -98,13 +106,16 @@ func main() {
 			WithAPIKey(upstreamKey).
 			WithNodeName(nodeName).
 			WithListenAddr(listenAddr).
+			WithAdminListenAddr(boot.AdminListenAddr).
+			WithUnixSocketMode(socketMode).
 			WithRetry(retryMax).
 			WithFailLimit(failLimit).
 			WithHealthEvery(healthEvery).
 			WithHealthAllInterval(healthAllInterval).
-			WithStoreDSN(mysqlDSN).
+			WithStoreDSN(storeDSN).
 			WithAdminKey(adminKey).
 			WithDefaultAccount(defaultAccountName, defaultProxyKey).
+			WithBootstrap(boot).
 			WithTransport(nil).
 			WithEnv().
 			Build()
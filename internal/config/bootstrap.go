@@ -0,0 +1,268 @@
+// Package config 加载启动级配置（监听地址、数据库、TLS、初始凭证等），
+// 来源优先级：环境变量 > 配置文件 > 默认值。运行期可调整的参数仍由配置表管理。
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultPath 未通过 QCC_CONFIG 指定时尝试加载的配置文件，不存在时忽略。
+const DefaultPath = "qcc.yaml"
+
+// 配置项来源。
+const (
+	SourceEnv     = "env"
+	SourceFile    = "file"
+	SourceDefault = "default"
+)
+
+const maskedValue = "******"
+
+// Bootstrap 启动级配置。
+type Bootstrap struct {
+	ListenAddr      string         `yaml:"listen_addr"`
+	AdminListenAddr string         `yaml:"admin_listen_addr"` // 非空时管理面单独监听
+	UnixSocketMode  string         `yaml:"unix_socket_mode"`  // unix: 监听地址的 socket 文件权限（八进制）
+	MySQLDSN        string         `yaml:"mysql_dsn"`
+	SQLitePath      string         `yaml:"sqlite_path"` // 未配置 MySQL 时使用的 SQLite 文件，off 表示仅内存
+	TLS             TLSConfig      `yaml:"tls"`
+	Upstream        UpstreamConfig `yaml:"upstream"`
+	Admin           AdminConfig    `yaml:"admin"`
+	Recording       RecordingStore `yaml:"recording"`
+	Dial            DialConfig     `yaml:"dial"`
+	EncryptionKey   string         `yaml:"encryption_key"` // 加密落库的敏感数据（如节点客户端私钥）
+
+	// Path 实际加载的配置文件，未加载时为空。
+	Path string `yaml:"-"`
+	// Sources 各配置项（以 YAML 路径表示）的来源。
+	Sources map[string]string `yaml:"-"`
+}
+
+// TLSConfig 证书与私钥文件，均为空时使用明文 HTTP。
+type TLSConfig struct {
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+}
+
+// UpstreamConfig 内存模式下默认账号的初始上游节点。
+type UpstreamConfig struct {
+	BaseURL string `yaml:"base_url"`
+	APIKey  string `yaml:"api_key"`
+	Name    string `yaml:"name"`
+}
+
+// AdminConfig 初始管理凭证与默认账号。
+type AdminConfig struct {
+	APIKey          string `yaml:"api_key"`
+	DefaultAccount  string `yaml:"default_account"`
+	DefaultProxyKey string `yaml:"default_proxy_key"`
+}
+
+// RecordingStore 流量录制的对象存储，URL 为空时不启用录制。
+// URL 形如 file:///var/lib/qcc/recordings 或 s3://bucket/prefix；S3 兼容存储可通过 Endpoint 指定地址。
+type RecordingStore struct {
+	URL       string `yaml:"url"`
+	Endpoint  string `yaml:"endpoint"`
+	Region    string `yaml:"region"`
+	AccessKey string `yaml:"access_key"`
+	SecretKey string `yaml:"secret_key"`
+}
+
+// DialConfig 连接上游时的拨号参数，节点可单独覆盖。
+type DialConfig struct {
+	IPFamily      string `yaml:"ip_family"`      // auto、ipv4、ipv6、prefer_ipv4 或 prefer_ipv6
+	FallbackDelay string `yaml:"fallback_delay"` // 首选地址族未连通时启动另一族的等待时间，0 为默认 300ms，负值表示首选失败后才回退
+	Timeout       string `yaml:"timeout"`        // 建连超时
+}
+
+// DialOptions 解析后的拨号参数。
+type DialOptions struct {
+	IPFamily      string
+	FallbackDelay time.Duration
+	Timeout       time.Duration
+}
+
+// IP 地址族选项。
+const (
+	IPFamilyAuto       = "auto"
+	IPFamilyIPv4       = "ipv4"
+	IPFamilyIPv6       = "ipv6"
+	IPFamilyPreferIPv4 = "prefer_ipv4"
+	IPFamilyPreferIPv6 = "prefer_ipv6"
+)
+
+// ValidIPFamily 判断地址族选项是否合法。
+func ValidIPFamily(family string) bool {
+	switch family {
+	case IPFamilyAuto, IPFamilyIPv4, IPFamilyIPv6, IPFamilyPreferIPv4, IPFamilyPreferIPv6:
+		return true
+	}
+	return false
+}
+
+// Options 校验并解析拨号参数。
+func (d DialConfig) Options() (DialOptions, error) {
+	opts := DialOptions{IPFamily: d.IPFamily}
+	if opts.IPFamily == "" {
+		opts.IPFamily = IPFamilyAuto
+	}
+	if !ValidIPFamily(opts.IPFamily) {
+		return opts, fmt.Errorf("invalid dial.ip_family %q: expected auto, ipv4, ipv6, prefer_ipv4 or prefer_ipv6", d.IPFamily)
+	}
+	var err error
+	if d.FallbackDelay != "" {
+		if opts.FallbackDelay, err = time.ParseDuration(d.FallbackDelay); err != nil {
+			return opts, fmt.Errorf("invalid dial.fallback_delay %q: %v", d.FallbackDelay, err)
+		}
+	}
+	if d.Timeout != "" {
+		if opts.Timeout, err = time.ParseDuration(d.Timeout); err != nil || opts.Timeout < 0 {
+			return opts, fmt.Errorf("invalid dial.timeout %q: expected a positive duration such as 30s", d.Timeout)
+		}
+	}
+	return opts, nil
+}
+
+// field 描述一个配置项：YAML 路径、可选的环境变量（按顺序取第一个非空值）与默认值。
+type field struct {
+	path   string
+	envs   []string
+	def    string
+	secret bool
+	ptr    func(*Bootstrap) *string
+}
+
+var fields = []field{
+	{path: "listen_addr", envs: []string{"LISTEN_ADDR"}, def: ":8000", ptr: func(b *Bootstrap) *string { return &b.ListenAddr }},
+	{path: "admin_listen_addr", envs: []string{"ADMIN_LISTEN_ADDR"}, ptr: func(b *Bootstrap) *string { return &b.AdminListenAddr }},
+	{path: "unix_socket_mode", envs: []string{"UNIX_SOCKET_MODE"}, def: "0660", ptr: func(b *Bootstrap) *string { return &b.UnixSocketMode }},
+	{path: "mysql_dsn", envs: []string{"PROXY_MYSQL_DSN"}, secret: true, ptr: func(b *Bootstrap) *string { return &b.MySQLDSN }},
+	{path: "sqlite_path", envs: []string{"PROXY_SQLITE_PATH"}, def: "data/qcc_plus.db", ptr: func(b *Bootstrap) *string { return &b.SQLitePath }},
+	{path: "tls.cert_file", envs: []string{"TLS_CERT_FILE"}, ptr: func(b *Bootstrap) *string { return &b.TLS.CertFile }},
+	{path: "tls.key_file", envs: []string{"TLS_KEY_FILE"}, ptr: func(b *Bootstrap) *string { return &b.TLS.KeyFile }},
+	{path: "upstream.base_url", envs: []string{"UPSTREAM_BASE_URL", "ANTHROPIC_BASE_URL"}, def: "https://api.anthropic.com", ptr: func(b *Bootstrap) *string { return &b.Upstream.BaseURL }},
+	{path: "upstream.api_key", envs: []string{"UPSTREAM_API_KEY", "ANTHROPIC_API_KEY"}, secret: true, ptr: func(b *Bootstrap) *string { return &b.Upstream.APIKey }},
+	{path: "upstream.name", envs: []string{"UPSTREAM_NAME"}, def: "default", ptr: func(b *Bootstrap) *string { return &b.Upstream.Name }},
+	{path: "admin.api_key", envs: []string{"ADMIN_API_KEY"}, def: "admin", secret: true, ptr: func(b *Bootstrap) *string { return &b.Admin.APIKey }},
+	{path: "admin.default_account", envs: []string{"DEFAULT_ACCOUNT_NAME"}, def: "default", ptr: func(b *Bootstrap) *string { return &b.Admin.DefaultAccount }},
+	{path: "admin.default_proxy_key", envs: []string{"DEFAULT_PROXY_API_KEY"}, def: "default-proxy-key", secret: true, ptr: func(b *Bootstrap) *string { return &b.Admin.DefaultProxyKey }},
+	{path: "encryption_key", envs: []string{"QCC_ENCRYPTION_KEY"}, secret: true, ptr: func(b *Bootstrap) *string { return &b.EncryptionKey }},
+	{path: "recording.url", envs: []string{"RECORDING_URL"}, ptr: func(b *Bootstrap) *string { return &b.Recording.URL }},
+	{path: "recording.endpoint", envs: []string{"RECORDING_S3_ENDPOINT"}, ptr: func(b *Bootstrap) *string { return &b.Recording.Endpoint }},
+	{path: "recording.region", envs: []string{"RECORDING_S3_REGION", "AWS_REGION"}, def: "us-east-1", ptr: func(b *Bootstrap) *string { return &b.Recording.Region }},
+	{path: "recording.access_key", envs: []string{"RECORDING_ACCESS_KEY", "AWS_ACCESS_KEY_ID"}, secret: true, ptr: func(b *Bootstrap) *string { return &b.Recording.AccessKey }},
+	{path: "recording.secret_key", envs: []string{"RECORDING_SECRET_KEY", "AWS_SECRET_ACCESS_KEY"}, secret: true, ptr: func(b *Bootstrap) *string { return &b.Recording.SecretKey }},
+	{path: "dial.ip_family", envs: []string{"DIAL_IP_FAMILY"}, def: "auto", ptr: func(b *Bootstrap) *string { return &b.Dial.IPFamily }},
+	{path: "dial.fallback_delay", envs: []string{"DIAL_FALLBACK_DELAY"}, def: "300ms", ptr: func(b *Bootstrap) *string { return &b.Dial.FallbackDelay }},
+	{path: "dial.timeout", envs: []string{"DIAL_TIMEOUT"}, def: "30s", ptr: func(b *Bootstrap) *string { return &b.Dial.Timeout }},
+}
+
+// Load 读取配置文件并与环境变量、默认值合并。path 为空时使用 QCC_CONFIG，
+// 仍为空则尝试 DefaultPath；显式指定的文件不存在时返回错误。
+func Load(path string) (*Bootstrap, error) {
+	explicit := path != ""
+	if path == "" {
+		path = os.Getenv("QCC_CONFIG")
+		explicit = path != ""
+	}
+	if path == "" {
+		path = DefaultPath
+	}
+
+	b := &Bootstrap{}
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		if err := yaml.Unmarshal(data, b); err != nil {
+			return nil, fmt.Errorf("parse config %s: %w", path, err)
+		}
+		b.Path = path
+	case errors.Is(err, os.ErrNotExist) && !explicit:
+	default:
+		return nil, fmt.Errorf("read config %s: %w", path, err)
+	}
+
+	b.Sources = make(map[string]string, len(fields))
+	for _, f := range fields {
+		dst := f.ptr(b)
+		source := SourceFile
+		if v := firstEnv(f.envs); v != "" {
+			*dst, source = v, SourceEnv
+		} else if *dst == "" {
+			*dst, source = f.def, SourceDefault
+		}
+		b.Sources[f.path] = source
+	}
+	if (b.TLS.CertFile == "") != (b.TLS.KeyFile == "") {
+		return nil, errors.New("tls.cert_file and tls.key_file must be set together")
+	}
+	if _, err := b.SocketMode(); err != nil {
+		return nil, err
+	}
+	if _, err := b.Dial.Options(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func firstEnv(names []string) string {
+	for _, name := range names {
+		if v := os.Getenv(name); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// TLSEnabled 是否配置了证书。
+func (b *Bootstrap) TLSEnabled() bool {
+	return b.TLS.CertFile != "" && b.TLS.KeyFile != ""
+}
+
+// SocketMode 解析 unix socket 文件权限，如 0660。
+func (b *Bootstrap) SocketMode() (os.FileMode, error) {
+	mode, err := strconv.ParseUint(b.UnixSocketMode, 8, 32)
+	if err != nil || mode > 0o777 {
+		return 0, fmt.Errorf("invalid unix_socket_mode %q: expected octal permissions such as 0660", b.UnixSocketMode)
+	}
+	return os.FileMode(mode), nil
+}
+
+// Masked 返回生效配置的展示视图：各项的取值与来源，密钥脱敏，DSN 仅隐藏密码。
+func (b *Bootstrap) Masked() map[string]interface{} {
+	items := make(map[string]interface{}, len(fields))
+	for _, f := range fields {
+		value := *f.ptr(b)
+		if f.secret && value != "" {
+			value = maskedValue
+			if f.path == "mysql_dsn" {
+				value = maskDSN(*f.ptr(b))
+			}
+		}
+		items[f.path] = map[string]interface{}{"value": value, "source": b.Sources[f.path]}
+	}
+	return map[string]interface{}{
+		"config_file": b.Path,
+		"tls_enabled": b.TLSEnabled(),
+		"settings":    items,
+	}
+}
+
+// maskDSN 隐藏 DSN 中的密码，无法解析时整体隐藏。
+func maskDSN(dsn string) string {
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return maskedValue
+	}
+	if cfg.Passwd != "" {
+		cfg.Passwd = maskedValue
+	}
+	return cfg.FormatDSN()
+}
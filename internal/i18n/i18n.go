@@ -0,0 +1,122 @@
+// Package i18n 提供面向用户文本的多语言消息目录与按语言格式化时间。
+package i18n
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 支持的语言。
+const (
+	LocaleZH = "zh-CN"
+	LocaleEN = "en-US"
+
+	// DefaultLocale 未指定或无法识别语言时使用的默认语言。
+	DefaultLocale = LocaleZH
+)
+
+// catalog 语言 → 消息键 → 文本，文本可包含 fmt 占位符。
+var catalog = map[string]map[string]string{
+	LocaleZH: {
+		"time.empty":              "--",
+		"version.unknown":         "未知",
+		"version.dev":             "开发版本",
+		"version.bad_format":      "%s (格式错误)",
+		"error.unauthorized":      "请先登录",
+		"error.session_invalid":   "会话已过期，请重新登录",
+		"error.account_not_found": "账号不存在",
+	},
+	LocaleEN: {
+		"time.empty":              "--",
+		"version.unknown":         "unknown",
+		"version.dev":             "development build",
+		"version.bad_format":      "%s (invalid format)",
+		"error.unauthorized":      "please log in first",
+		"error.session_invalid":   "session expired, please log in again",
+		"error.account_not_found": "account not found",
+	},
+}
+
+// timeLayouts 各语言的完整时间格式。
+var timeLayouts = map[string]string{
+	LocaleZH: "2006年01月02日 15时04分05秒",
+	LocaleEN: "2006-01-02 15:04:05 MST",
+}
+
+// Normalize 将语言标签归一化为支持的语言，如 "en"、"en_GB" → en-US，"zh-TW" → zh-CN；不支持时返回空串。
+func Normalize(tag string) string {
+	tag = strings.ToLower(strings.TrimSpace(strings.ReplaceAll(tag, "_", "-")))
+	base, _, _ := strings.Cut(tag, "-")
+	switch base {
+	case "zh":
+		return LocaleZH
+	case "en":
+		return LocaleEN
+	}
+	return ""
+}
+
+// Supported 返回支持的语言列表。
+func Supported() []string {
+	out := make([]string, 0, len(catalog))
+	for locale := range catalog {
+		out = append(out, locale)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Negotiate 按 Accept-Language 的权重选择支持的语言，均不支持时返回默认语言。
+func Negotiate(acceptLanguage string) string {
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(part, ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			n, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = n
+		}
+		if locale := Normalize(tag); locale != "" && q > bestQ {
+			best, bestQ = locale, q
+		}
+	}
+	if best == "" {
+		return DefaultLocale
+	}
+	return best
+}
+
+// T 返回消息键在指定语言下的文本，缺失时依次回退到默认语言与键本身。
+func T(locale, key string, args ...interface{}) string {
+	msg, ok := catalog[locale][key]
+	if !ok {
+		if msg, ok = catalog[DefaultLocale][key]; !ok {
+			msg = key
+		}
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(msg, args...)
+	}
+	return msg
+}
+
+// FormatTime 按语言格式化时间并转换到指定时区，零值返回占位符。
+func FormatTime(t time.Time, loc *time.Location, locale string) string {
+	if t.IsZero() {
+		return T(locale, "time.empty")
+	}
+	layout, ok := timeLayouts[locale]
+	if !ok {
+		layout = timeLayouts[DefaultLocale]
+	}
+	if loc != nil {
+		t = t.In(loc)
+	}
+	return t.Format(layout)
+}
@@ -0,0 +1,222 @@
+// Package logfile 提供按大小或时间滚动的日志文件写入，支持历史文件压缩与过期清理，
+// 供未接入 logrotate 的部署使用。
+package logfile
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const gzSuffix = ".gz"
+
+// Options 滚动参数：单个文件超过 MaxSizeMB 或写入时长超过 Interval 时滚动，保留最近 MaxBackups 个历史文件；
+// MaxAge 大于 0 时删除更早的历史文件，Compress 为 true 时历史文件以 gzip 压缩保存。
+type Options struct {
+	MaxSizeMB  int
+	MaxBackups int
+	MaxAge     time.Duration
+	Interval   time.Duration
+	Compress   bool
+}
+
+// Writer 并发安全的滚动日志文件，历史文件依次命名为 path.1、path.2……（数字越大越旧），压缩后追加 .gz。
+type Writer struct {
+	mu       sync.Mutex
+	path     string
+	opts     Options
+	file     *os.File
+	size     int64
+	openedAt time.Time
+
+	compressing sync.WaitGroup
+}
+
+// Open 以追加方式打开日志文件，必要时创建所在目录。
+func Open(path string, opts Options) (*Writer, error) {
+	w := &Writer{path: path, opts: opts}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	w.removeExpired()
+	return w, nil
+}
+
+// Path 返回日志文件路径。
+func (w *Writer) Path() string {
+	return w.path
+}
+
+// SetOptions 更新滚动参数，下一次写入时生效。
+func (w *Writer) SetOptions(opts Options) {
+	w.mu.Lock()
+	w.opts = opts
+	w.mu.Unlock()
+}
+
+// Write 追加写入，写入后超过大小上限时先滚动。
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		if err := w.open(); err != nil {
+			return 0, err
+		}
+	}
+	if w.shouldRotate(len(p)) {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// shouldRotate 当前文件非空且写入后超过大小上限，或打开时长超过滚动间隔。
+func (w *Writer) shouldRotate(n int) bool {
+	if w.size == 0 {
+		return false
+	}
+	if limit := int64(w.opts.MaxSizeMB) << 20; limit > 0 && w.size+int64(n) > limit {
+		return true
+	}
+	return w.opts.Interval > 0 && time.Since(w.openedAt) >= w.opts.Interval
+}
+
+// Close 关闭当前文件，并等待进行中的压缩完成。
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.compressing.Wait()
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+func (w *Writer) open() error {
+	f, err := os.OpenFile(w.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	w.file, w.size = f, info.Size()
+	// 已有内容的文件以最后修改时间近似其起始时间，避免重启后按时间滚动的周期被重置。
+	w.openedAt = time.Now()
+	if w.size > 0 {
+		w.openedAt = info.ModTime()
+	}
+	return nil
+}
+
+// rotate 关闭当前文件并依次后移历史文件，超出 MaxBackups 的最旧文件被删除；
+// 开启压缩时在后台压缩刚滚动出的文件，下一次滚动前等待其完成，保证编号不冲突。
+func (w *Writer) rotate() error {
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+	w.file = nil
+	w.compressing.Wait()
+	if w.opts.MaxBackups <= 0 {
+		if err := os.Remove(w.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return w.open()
+	}
+	removeBackup(w.path, w.opts.MaxBackups)
+	for i := w.opts.MaxBackups - 1; i >= 1; i-- {
+		for _, suffix := range []string{"", gzSuffix} {
+			if err := os.Rename(backupName(w.path, i)+suffix, backupName(w.path, i+1)+suffix); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	first := backupName(w.path, 1)
+	if err := os.Rename(w.path, first); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := w.open(); err != nil {
+		return err
+	}
+	if w.opts.Compress {
+		w.compressing.Add(1)
+		go func() {
+			defer w.compressing.Done()
+			_ = compressFile(first)
+		}()
+	}
+	w.removeExpired()
+	return nil
+}
+
+// removeExpired 删除修改时间早于 MaxAge 的历史文件。
+func (w *Writer) removeExpired() {
+	if w.opts.MaxAge <= 0 {
+		return
+	}
+	cutoff := time.Now().Add(-w.opts.MaxAge)
+	matches, _ := filepath.Glob(w.path + ".*")
+	for _, name := range matches {
+		if info, err := os.Stat(name); err == nil && !info.IsDir() && info.ModTime().Before(cutoff) {
+			_ = os.Remove(name)
+		}
+	}
+}
+
+// compressFile 将文件压缩为 name.gz 并删除原文件，保留原文件的修改时间以便按时间清理。
+func compressFile(name string) error {
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	tmp := name + gzSuffix + ".tmp"
+	dst, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(dst)
+	_, err = io.Copy(gz, src)
+	if cerr := gz.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, name+gzSuffix)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	_ = os.Chtimes(name+gzSuffix, info.ModTime(), info.ModTime())
+	return os.Remove(name)
+}
+
+func removeBackup(path string, n int) {
+	_ = os.Remove(backupName(path, n))
+	_ = os.Remove(backupName(path, n) + gzSuffix)
+}
+
+func backupName(path string, n int) string {
+	return fmt.Sprintf("%s.%d", path, n)
+}
@@ -14,6 +14,8 @@ type NotificationMessage struct {
 	EventType  string
 	Title      string
 	Content    string
+	Node       string
+	Severity   string
 	OccurredAt time.Time
 }
 
@@ -22,17 +24,23 @@ type NotificationChannel interface {
 	Send(ctx context.Context, msg NotificationMessage) error
 }
 
-// buildChannel 根据渠道记录创建具体实现。
-func buildChannel(rec store.NotificationChannelRecord) (NotificationChannel, error) {
+// buildChannel 根据渠道记录创建具体实现，secret 为 settings 中保存的渠道密钥。
+func buildChannel(rec store.NotificationChannelRecord, secret string) (NotificationChannel, error) {
 	switch rec.ChannelType {
 	case ChannelWechatWork, ChannelWechatPersonal:
 		return newWechatChannel(rec)
+	case ChannelWebhook:
+		return newWebhookChannel(rec)
+	case ChannelPagerDuty:
+		return newPagerDutyChannel(rec, secret)
+	case ChannelOpsgenie:
+		return newOpsgenieChannel(rec, secret)
 	default:
 		return nil, fmt.Errorf("unsupported channel type: %s", rec.ChannelType)
 	}
 }
 
 // BuildChannel 向外暴露的构造器，便于在不同模块直接创建渠道实例。
-func BuildChannel(rec store.NotificationChannelRecord) (NotificationChannel, error) {
-	return buildChannel(rec)
+func BuildChannel(rec store.NotificationChannelRecord, secret string) (NotificationChannel, error) {
+	return buildChannel(rec, secret)
 }
@@ -0,0 +1,183 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"qcc_plus/internal/store"
+	"qcc_plus/internal/timeutil"
+)
+
+// EventDigest 摘要消息在通知历史中的事件类型。
+const EventDigest = "notification.digest"
+
+// 告警级别。
+const (
+	SeverityCritical = "critical"
+	SeverityWarning  = "warning"
+	SeverityInfo     = "info"
+)
+
+var severityRank = map[string]int{SeverityCritical: 0, SeverityWarning: 1, SeverityInfo: 2}
+
+// DigestInterval 返回摘要模式的合并周期，即时发送返回 0。
+func DigestInterval(mode string) time.Duration {
+	switch mode {
+	case store.Digest15Min:
+		return 15 * time.Minute
+	case store.DigestHourly:
+		return time.Hour
+	default:
+		return 0
+	}
+}
+
+// ValidDigestMode 判断摘要模式是否受支持（空值视为即时发送）。
+func ValidDigestMode(mode string) bool {
+	switch mode {
+	case "", store.DigestImmediate, store.Digest15Min, store.DigestHourly:
+		return true
+	default:
+		return false
+	}
+}
+
+// SeverityFor 根据事件类型推断告警级别。
+func SeverityFor(evt Event) string {
+	if evt.Severity != "" {
+		return evt.Severity
+	}
+	if evt.UpstreamIncident != "" {
+		return SeverityWarning
+	}
+	switch evt.EventType {
+	case EventNodeFailed, EventNodeHealthCheckError, EventRequestFailed, EventRequestProxyError,
+		EventSystemTunnelError, EventSystemError:
+		return SeverityCritical
+	case EventNodeStatusChanged, EventNodeSwitched, EventNodeBenchmarkRegressed, EventNodeCertExpiring, EventRequestUpstreamErr,
+		EventAccountQuotaWarning, EventAccountAuthFailed, EventNodeDisabled:
+		return SeverityWarning
+	default:
+		return SeverityInfo
+	}
+}
+
+type digestGroupKey struct {
+	node     string
+	severity string
+}
+
+// digestGroup 同一节点、同一级别的告警汇总。
+type digestGroup struct {
+	count  int
+	titles map[string]int
+	first  time.Time
+	last   time.Time
+}
+
+// digestBatch 单个渠道在当前周期内累积的告警。
+type digestBatch struct {
+	channel   store.NotificationChannelRecord
+	accountID string
+	startedAt time.Time
+	total     int
+	groups    map[digestGroupKey]*digestGroup
+}
+
+func (m *Manager) addToDigest(ch store.NotificationChannelRecord, evt Event) {
+	m.digestMu.Lock()
+	defer m.digestMu.Unlock()
+	b := m.digests[ch.ID]
+	if b == nil {
+		b = &digestBatch{channel: ch, accountID: evt.AccountID, startedAt: time.Now(), groups: make(map[digestGroupKey]*digestGroup)}
+		m.digests[ch.ID] = b
+	}
+	b.channel = ch
+	b.total++
+	key := digestGroupKey{node: evt.Node, severity: SeverityFor(evt)}
+	g := b.groups[key]
+	if g == nil {
+		g = &digestGroup{titles: make(map[string]int), first: evt.OccurredAt}
+		b.groups[key] = g
+	}
+	g.count++
+	g.titles[evt.Title]++
+	g.last = evt.OccurredAt
+}
+
+// takeDueDigests 取出已到期的批次；force 时取出全部（停止时使用）。
+func (m *Manager) takeDueDigests(now time.Time, force bool) []*digestBatch {
+	m.digestMu.Lock()
+	defer m.digestMu.Unlock()
+	var due []*digestBatch
+	for id, b := range m.digests {
+		if force || now.Sub(b.startedAt) >= DigestInterval(b.channel.DigestMode) {
+			due = append(due, b)
+			delete(m.digests, id)
+		}
+	}
+	return due
+}
+
+func (m *Manager) digestLoop() {
+	defer m.wg.Done()
+	ticker := time.NewTicker(m.cfg.DigestTick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.loopStop:
+			return
+		case now := <-ticker.C:
+			m.flushDigests(now, false)
+		}
+	}
+}
+
+func (m *Manager) flushDigests(now time.Time, force bool) {
+	for _, b := range m.takeDueDigests(now, force) {
+		ctx, cancel := context.WithTimeout(context.Background(), m.cfg.SendTimeout)
+		title, content := formatDigest(b, now)
+		m.deliver(ctx, b.channel, NotificationMessage{AccountID: b.accountID, EventType: EventDigest, Title: title, Content: content, OccurredAt: now})
+		cancel()
+	}
+}
+
+// formatDigest 生成摘要消息：按级别（高到低）、节点分组列出告警次数与标题。
+func formatDigest(b *digestBatch, now time.Time) (string, string) {
+	keys := make([]digestGroupKey, 0, len(b.groups))
+	for k := range b.groups {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if severityRank[keys[i].severity] != severityRank[keys[j].severity] {
+			return severityRank[keys[i].severity] < severityRank[keys[j].severity]
+		}
+		return keys[i].node < keys[j].node
+	})
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "**统计区间**: %s ~ %s\n", timeutil.FormatBeijingTime(b.startedAt), timeutil.FormatBeijingTime(now))
+	for _, k := range keys {
+		g := b.groups[k]
+		titles := make([]string, 0, len(g.titles))
+		for t := range g.titles {
+			titles = append(titles, t)
+		}
+		sort.Strings(titles)
+		parts := make([]string, 0, len(titles))
+		for _, t := range titles {
+			parts = append(parts, fmt.Sprintf("%s ×%d", t, g.titles[t]))
+		}
+		node := k.node
+		if node == "" {
+			node = "系统"
+		}
+		fmt.Fprintf(&sb, "\n**%s** · %s · %d 条\n> %s\n> 首次 %s，最近 %s\n", node, k.severity, g.count,
+			strings.Join(parts, "，"), timeutil.FormatBeijingTime(g.first), timeutil.FormatBeijingTime(g.last))
+	}
+	title := fmt.Sprintf("告警摘要：%d 条告警", b.total)
+	return title, sb.String()
+}
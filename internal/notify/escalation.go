@@ -0,0 +1,170 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"qcc_plus/internal/store"
+)
+
+// EscalationStore 升级策略所需的存储接口，Store 未实现时不启用升级。
+type EscalationStore interface {
+	ListEnabledEscalationPoliciesForEvent(ctx context.Context, accountID, eventType string) ([]store.EscalationPolicyRecord, error)
+	GetEscalationPolicy(ctx context.Context, id string) (*store.EscalationPolicyRecord, error)
+	GetNotificationChannel(ctx context.Context, id string) (*store.NotificationChannelRecord, error)
+	FindOpenAlert(ctx context.Context, accountID, policyID, dedupKey string) (*store.AlertRecord, error)
+	InsertAlert(ctx context.Context, rec store.AlertRecord) error
+	ListDueAlerts(ctx context.Context, now time.Time) ([]store.AlertRecord, error)
+	AdvanceAlertEscalation(ctx context.Context, id string, step int, next time.Time) error
+}
+
+// AlertHook 告警触发或升级后回调，用于推送到 WebSocket 等实时通道。
+type AlertHook func(rec store.AlertRecord)
+
+// WithEscalationTick 设置升级检查间隔。
+func WithEscalationTick(d time.Duration) Option {
+	return func(c *ManagerConfig) {
+		if d > 0 {
+			c.EscalationTick = d
+		}
+	}
+}
+
+// WithAlertHook 设置告警状态变化回调。
+func WithAlertHook(h AlertHook) Option {
+	return func(c *ManagerConfig) {
+		c.AlertHook = h
+	}
+}
+
+// nextEscalation 返回第 step 步通知后的下一次升级时间，已是最后一步返回零值。
+func nextEscalation(policy store.EscalationPolicyRecord, step int, from time.Time) time.Time {
+	if step+1 >= len(policy.Steps) {
+		return time.Time{}
+	}
+	return from.Add(time.Duration(policy.Steps[step+1].AfterMinutes) * time.Minute)
+}
+
+// escalate 为匹配的升级策略创建告警并通知第一步渠道；同一去重键已有未确认告警时不重复触发。
+func (m *Manager) escalate(ctx context.Context, es EscalationStore, evt Event) {
+	m.escalateMu.Lock()
+	defer m.escalateMu.Unlock()
+	policies, err := es.ListEnabledEscalationPoliciesForEvent(ctx, evt.AccountID, evt.EventType)
+	if err != nil {
+		m.logf("list escalation policies failed: %v", err)
+		return
+	}
+	dedup := evt.EventType
+	if evt.DedupKey != "" {
+		dedup += ":" + evt.DedupKey
+	}
+	for _, policy := range policies {
+		if _, err := es.FindOpenAlert(ctx, evt.AccountID, policy.ID, dedup); err == nil {
+			continue
+		} else if !errors.Is(err, store.ErrNotFound) {
+			m.logf("find open alert failed: %v", err)
+			continue
+		}
+		now := time.Now()
+		rec := store.AlertRecord{
+			ID:               randomID(),
+			AccountID:        evt.AccountID,
+			PolicyID:         policy.ID,
+			EventType:        evt.EventType,
+			DedupKey:         dedup,
+			Node:             evt.Node,
+			Severity:         SeverityFor(evt),
+			Title:            evt.Title,
+			Content:          evt.Content,
+			Status:           store.AlertOpen,
+			NextEscalationAt: nextEscalation(policy, 0, now),
+			CreatedAt:        evt.OccurredAt,
+			UpdatedAt:        now,
+		}
+		if err := es.InsertAlert(ctx, rec); err != nil {
+			m.logf("insert alert failed: %v", err)
+			continue
+		}
+		m.notifyStep(ctx, es, policy, rec)
+		m.emitAlert(rec)
+	}
+}
+
+// notifyStep 通过当前步骤的渠道发送告警，升级步骤在标题中标注级别。
+func (m *Manager) notifyStep(ctx context.Context, es EscalationStore, policy store.EscalationPolicyRecord, rec store.AlertRecord) {
+	if rec.Step >= len(policy.Steps) {
+		return
+	}
+	ch, err := es.GetNotificationChannel(ctx, policy.Steps[rec.Step].ChannelID)
+	if err != nil {
+		m.logf("get escalation channel %s failed: %v", policy.Steps[rec.Step].ChannelID, err)
+		return
+	}
+	if !ch.Enabled {
+		return
+	}
+	title := rec.Title
+	if rec.Step > 0 {
+		title = fmt.Sprintf("[升级 L%d] %s", rec.Step+1, rec.Title)
+	}
+	content := rec.Content + fmt.Sprintf("\n\n**升级策略**: %s（第 %d/%d 步）\n**告警 ID**: %s", policy.Name, rec.Step+1, len(policy.Steps), rec.ID)
+	m.deliver(ctx, *ch, NotificationMessage{
+		AccountID:  rec.AccountID,
+		EventType:  rec.EventType,
+		Title:      title,
+		Content:    content,
+		Node:       rec.Node,
+		Severity:   rec.Severity,
+		OccurredAt: time.Now(),
+	})
+}
+
+func (m *Manager) escalationLoop(es EscalationStore) {
+	defer m.wg.Done()
+	ticker := time.NewTicker(m.cfg.EscalationTick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.loopStop:
+			return
+		case now := <-ticker.C:
+			m.runEscalations(es, now)
+		}
+	}
+}
+
+// runEscalations 将到期且仍未确认的告警推进到下一步。
+func (m *Manager) runEscalations(es EscalationStore, now time.Time) {
+	ctx, cancel := context.WithTimeout(context.Background(), m.cfg.SendTimeout)
+	defer cancel()
+	due, err := es.ListDueAlerts(ctx, now)
+	if err != nil {
+		m.logf("list due alerts failed: %v", err)
+		return
+	}
+	for _, rec := range due {
+		policy, err := es.GetEscalationPolicy(ctx, rec.PolicyID)
+		if err != nil || rec.Step+1 >= len(policy.Steps) {
+			// 策略已删除或步骤被缩减，停止升级
+			_ = es.AdvanceAlertEscalation(ctx, rec.ID, rec.Step, time.Time{})
+			continue
+		}
+		rec.Step++
+		rec.NextEscalationAt = nextEscalation(*policy, rec.Step, now)
+		rec.UpdatedAt = now
+		if err := es.AdvanceAlertEscalation(ctx, rec.ID, rec.Step, rec.NextEscalationAt); err != nil {
+			m.logf("advance alert %s failed: %v", rec.ID, err)
+			continue
+		}
+		m.notifyStep(ctx, es, *policy, rec)
+		m.emitAlert(rec)
+	}
+}
+
+func (m *Manager) emitAlert(rec store.AlertRecord) {
+	if m.cfg.AlertHook != nil {
+		m.cfg.AlertHook(rec)
+	}
+}
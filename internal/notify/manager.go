@@ -26,6 +26,10 @@ type Manager struct {
 	stopped    chan struct{}
 	dedupMu    sync.Mutex
 	lastNotify map[string]time.Time
+	digestMu   sync.Mutex
+	digests    map[string]*digestBatch // channelID -> 当前周期累积的告警
+	loopStop   chan struct{}           // 通知摘要、升级等后台循环退出
+	escalateMu sync.Mutex              // 串行化告警查重与创建
 }
 
 // Option 自定义管理器配置。
@@ -76,14 +80,25 @@ func WithSendTimeout(d time.Duration) Option {
 	}
 }
 
+// WithDigestTick 设置摘要批次的检查间隔。
+func WithDigestTick(d time.Duration) Option {
+	return func(c *ManagerConfig) {
+		if d > 0 {
+			c.DigestTick = d
+		}
+	}
+}
+
 // NewManager 创建并启动通知管理器。
 func NewManager(store Store, opts ...Option) *Manager {
 	cfg := ManagerConfig{
-		QueueSize:   128,
-		WorkerCount: 2,
-		DedupWindow: 5 * time.Minute,
-		Logger:      log.Default(),
-		SendTimeout: 8 * time.Second,
+		QueueSize:      128,
+		WorkerCount:    2,
+		DedupWindow:    5 * time.Minute,
+		Logger:         log.Default(),
+		SendTimeout:    8 * time.Second,
+		DigestTick:     30 * time.Second,
+		EscalationTick: 30 * time.Second,
 	}
 	for _, opt := range opts {
 		opt(&cfg)
@@ -97,11 +112,19 @@ func NewManager(store Store, opts ...Option) *Manager {
 		queue:      make(chan Event, cfg.QueueSize),
 		stopped:    make(chan struct{}),
 		lastNotify: make(map[string]time.Time),
+		digests:    make(map[string]*digestBatch),
+		loopStop:   make(chan struct{}),
 	}
 	for i := 0; i < cfg.WorkerCount; i++ {
 		m.wg.Add(1)
 		go m.worker()
 	}
+	m.wg.Add(1)
+	go m.digestLoop()
+	if es, ok := store.(EscalationStore); ok {
+		m.wg.Add(1)
+		go m.escalationLoop(es)
+	}
 	return m
 }
 
@@ -120,14 +143,16 @@ func (m *Manager) Publish(evt Event) {
 	}
 }
 
-// Stop 停止后台 worker。
+// Stop 停止后台 worker，并立即发送尚未到期的摘要。
 func (m *Manager) Stop() {
 	if m == nil {
 		return
 	}
 	m.stopOnce.Do(func() {
 		close(m.queue)
+		close(m.loopStop)
 		m.wg.Wait()
+		m.flushDigests(time.Now(), true)
 		close(m.stopped)
 	})
 }
@@ -149,55 +174,86 @@ func (m *Manager) handleEvent(evt Event) {
 		m.logf("list subscriptions failed: %v", err)
 		return
 	}
-	if len(subs) == 0 {
-		return
+	// 已知的上游服务商故障不值得呼叫值班人员，只走普通渠道。
+	upstream := evt.UpstreamIncident != ""
+	if es, ok := m.store.(EscalationStore); ok && !upstream {
+		m.escalate(ctx, es, evt)
 	}
+	sent := make(map[string]bool)
 	for _, sub := range subs {
-		key := m.composeDedupKey(evt, sub)
-		if !m.shouldSend(key) {
+		if upstream && isOnCallChannel(sub.Channel.ChannelType) {
 			continue
 		}
-		ch, err := buildChannel(sub.Channel)
-		if err != nil {
-			m.logf("build channel %s failed: %v", sub.Channel.ID, err)
+		// 摘要渠道不做去重，以便统计抖动节点的真实告警次数；值班渠道始终即时发送。
+		if DigestInterval(sub.Channel.DigestMode) > 0 && !isOnCallChannel(sub.Channel.ChannelType) {
+			m.addToDigest(sub.Channel, evt)
 			continue
 		}
-		msg := NotificationMessage{
-			AccountID:  evt.AccountID,
-			EventType:  evt.EventType,
-			Title:      evt.Title,
-			Content:    evt.Content,
-			OccurredAt: evt.OccurredAt,
-		}
-		sendErr := ch.Send(ctx, msg)
-		status := historyStatusSent
-		errText := ""
-		var sentAt *time.Time
-		if sendErr != nil {
-			status = historyStatusFailed
-			errText = sendErr.Error()
-		} else {
-			now := time.Now()
-			sentAt = &now
+		sent[sub.Channel.ID] = true
+		key := m.composeDedupKey(evt, sub)
+		if !m.shouldSend(key) {
+			continue
 		}
-		if err := m.store.InsertNotificationHistory(ctx, store.NotificationHistoryRecord{
-			ID:        randomID(),
-			AccountID: evt.AccountID,
-			ChannelID: sub.Channel.ID,
-			EventType: evt.EventType,
-			Title:     evt.Title,
-			Content:   evt.Content,
-			Status:    status,
-			Error:     errText,
-			SentAt:    sentAt,
-			CreatedAt: time.Now(),
-		}); err != nil {
-			m.logf("insert notification history failed: %v", err)
+		m.deliver(ctx, sub.Channel, evt.message())
+	}
+	m.autoResolve(ctx, evt, sent)
+}
+
+// deliver 通过渠道发送消息并记录通知历史。
+func (m *Manager) deliver(ctx context.Context, chRec store.NotificationChannelRecord, msg NotificationMessage) {
+	secret := ""
+	if sr, ok := m.store.(SecretResolver); ok && NeedsSecret(chRec.ChannelType) {
+		s, err := sr.GetChannelSecret(ctx, chRec.AccountID, chRec.ID)
+		if err != nil {
+			m.logf("load secret for channel %s failed: %v", chRec.ID, err)
+			return
 		}
-		if sendErr != nil {
-			m.logf("send notification via %s failed: %v", sub.Channel.ChannelType, sendErr)
+		secret = s
+	}
+	ch, err := buildChannel(chRec, secret)
+	if err != nil {
+		m.logf("build channel %s failed: %v", chRec.ID, err)
+		return
+	}
+	if kr, ok := m.store.(SigningKeyResolver); ok {
+		if _, signed := ch.(signingChannel); signed {
+			keys, err := kr.WebhookSigningKeys(ctx, chRec.AccountID)
+			if err != nil {
+				// 与渠道密钥读取失败的处理一致放弃本次投递，不发出未签名的回调。
+				m.logf("load webhook signing keys for account %s failed: %v", chRec.AccountID, err)
+				return
+			}
+			WithSigningKeys(ch, keys)
 		}
 	}
+	sendErr := ch.Send(ctx, msg)
+	status := historyStatusSent
+	errText := ""
+	var sentAt *time.Time
+	if sendErr != nil {
+		status = historyStatusFailed
+		errText = sendErr.Error()
+	} else {
+		now := time.Now()
+		sentAt = &now
+	}
+	if err := m.store.InsertNotificationHistory(ctx, store.NotificationHistoryRecord{
+		ID:        randomID(),
+		AccountID: msg.AccountID,
+		ChannelID: chRec.ID,
+		EventType: msg.EventType,
+		Title:     msg.Title,
+		Content:   msg.Content,
+		Status:    status,
+		Error:     errText,
+		SentAt:    sentAt,
+		CreatedAt: time.Now(),
+	}); err != nil {
+		m.logf("insert notification history failed: %v", err)
+	}
+	if sendErr != nil {
+		m.logf("send notification via %s failed: %v", chRec.ChannelType, sendErr)
+	}
 }
 
 func (m *Manager) composeDedupKey(evt Event, sub store.SubscriptionWithChannel) string {
@@ -9,6 +9,7 @@ const (
 		name VARCHAR(255),
 		config JSON,
 		enabled BOOLEAN DEFAULT TRUE,
+		digest_mode VARCHAR(16) NOT NULL DEFAULT 'immediate',
 		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
 		KEY idx_notification_channels_account (account_id)
@@ -0,0 +1,95 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// SecretResolver 读取渠道密钥（保存在 is_secret 的账号级 settings 中）。
+type SecretResolver interface {
+	GetChannelSecret(ctx context.Context, accountID, channelID string) (string, error)
+}
+
+// ChannelSecretKey 返回渠道密钥在 settings 中的 key。
+func ChannelSecretKey(channelID string) string {
+	return "notification.channel_secret." + channelID
+}
+
+// NeedsSecret 判断渠道类型是否需要从 settings 读取密钥。
+func NeedsSecret(channelType string) bool {
+	return isOnCallChannel(channelType)
+}
+
+// isOnCallChannel 值班平台渠道：按去重键触发/自动恢复，不参与摘要合并。
+func isOnCallChannel(channelType string) bool {
+	return channelType == ChannelPagerDuty || channelType == ChannelOpsgenie
+}
+
+// alertRules 事件到告警规则的映射；同一规则的触发与恢复共用去重键。
+var alertRules = map[string]string{
+	EventNodeFailed:           "node_down",
+	EventNodeHealthCheckError: "node_down",
+	EventNodeRecovered:        "node_down",
+	EventNodeDisabled:         "node_disabled",
+	EventNodeEnabled:          "node_disabled",
+	EventSystemTunnelError:    "tunnel_down",
+	EventSystemTunnelStarted:  "tunnel_down",
+}
+
+// resolveEvents 表示告警条件已解除的事件。
+var resolveEvents = map[string]bool{
+	EventNodeRecovered:       true,
+	EventNodeEnabled:         true,
+	EventSystemTunnelStarted: true,
+}
+
+// AlertRule 返回事件对应的告警规则，以及该事件是否表示条件解除。
+func AlertRule(eventType string) (rule string, resolve bool) {
+	if r, ok := alertRules[eventType]; ok {
+		return r, resolveEvents[eventType]
+	}
+	return eventType, false
+}
+
+// OnCallDedupKey 由账号、节点与规则生成值班平台的去重键。
+func OnCallDedupKey(accountID, node, eventType string) string {
+	rule, _ := AlertRule(eventType)
+	if node == "" {
+		node = "system"
+	}
+	return fmt.Sprintf("qcc:%s:%s:%s", accountID, strings.ReplaceAll(node, ":", "_"), rule)
+}
+
+// triggersResolvedBy 返回被 eventType 解除的触发事件类型。
+func triggersResolvedBy(eventType string) []string {
+	rule, resolve := AlertRule(eventType)
+	if !resolve {
+		return nil
+	}
+	var out []string
+	for evt, r := range alertRules {
+		if r == rule && !resolveEvents[evt] {
+			out = append(out, evt)
+		}
+	}
+	return out
+}
+
+// autoResolve 条件解除时，向订阅了对应触发事件的值班渠道发送恢复事件，无需单独订阅恢复事件。
+func (m *Manager) autoResolve(ctx context.Context, evt Event, sent map[string]bool) {
+	for _, trigger := range triggersResolvedBy(evt.EventType) {
+		subs, err := m.store.ListEnabledSubscriptionsForEvent(ctx, evt.AccountID, trigger)
+		if err != nil {
+			m.logf("list subscriptions failed: %v", err)
+			return
+		}
+		for _, sub := range subs {
+			if !isOnCallChannel(sub.Channel.ChannelType) || sent[sub.Channel.ID] {
+				continue
+			}
+			sent[sub.Channel.ID] = true
+			m.deliver(ctx, sub.Channel, evt.message())
+		}
+	}
+}
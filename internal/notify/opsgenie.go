@@ -0,0 +1,123 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"qcc_plus/internal/store"
+)
+
+const (
+	opsgenieAPIURL   = "https://api.opsgenie.com"
+	opsgenieEUAPIURL = "https://api.eu.opsgenie.com"
+	opsgenieMaxMsg   = 130 // Opsgenie message 字段上限
+)
+
+type opsgenieConfig struct {
+	Region string `json:"region,omitempty"`  // us/eu
+	APIURL string `json:"api_url,omitempty"` // 覆盖 region 推导的地址
+}
+
+// opsgenieChannel 通过 Opsgenie Alert API 创建/关闭告警，alias 作为去重键。
+type opsgenieChannel struct {
+	baseURL string
+	apiKey  string
+	client  *http.Client
+}
+
+func newOpsgenieChannel(rec store.NotificationChannelRecord, apiKey string) (NotificationChannel, error) {
+	var cfg opsgenieConfig
+	if len(rec.Config) > 0 {
+		if err := json.Unmarshal(rec.Config, &cfg); err != nil {
+			return nil, fmt.Errorf("parse opsgenie config: %w", err)
+		}
+	}
+	if apiKey == "" {
+		return nil, errors.New("opsgenie api_key required")
+	}
+	base := cfg.APIURL
+	if base == "" {
+		base = opsgenieAPIURL
+		if strings.EqualFold(cfg.Region, "eu") {
+			base = opsgenieEUAPIURL
+		}
+	}
+	return &opsgenieChannel{
+		baseURL: strings.TrimRight(base, "/"),
+		apiKey:  apiKey,
+		client:  &http.Client{Timeout: 5 * time.Second},
+	}, nil
+}
+
+func (o *opsgenieChannel) Send(ctx context.Context, msg NotificationMessage) error {
+	alias := OnCallDedupKey(msg.AccountID, msg.Node, msg.EventType)
+	endpoint := o.baseURL + "/v2/alerts"
+	var body map[string]any
+	if _, resolve := AlertRule(msg.EventType); resolve {
+		endpoint += "/" + url.PathEscape(alias) + "/close?identifierType=alias"
+		body = map[string]any{"source": "qcc_plus", "note": chooseMessage(msg)}
+	} else {
+		body = map[string]any{
+			"message":     truncateRunes(chooseMessage(msg), opsgenieMaxMsg),
+			"alias":       alias,
+			"description": msg.Content,
+			"priority":    opsgeniePriority(msg.Severity),
+			"source":      "qcc_plus",
+			"entity":      chooseSource(msg.Node),
+			"tags":        []string{msg.EventType},
+			"details":     map[string]string{"account_id": msg.AccountID},
+		}
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "GenieKey "+o.apiKey)
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("opsgenie api status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func opsgeniePriority(severity string) string {
+	switch severity {
+	case SeverityCritical:
+		return "P1"
+	case SeverityWarning:
+		return "P3"
+	default:
+		return "P5"
+	}
+}
+
+func chooseMessage(msg NotificationMessage) string {
+	if msg.Title != "" {
+		return msg.Title
+	}
+	return msg.EventType
+}
+
+func truncateRunes(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n])
+}
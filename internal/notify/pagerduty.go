@@ -0,0 +1,109 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"qcc_plus/internal/store"
+)
+
+const pagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+
+type pagerDutyConfig struct {
+	APIURL string `json:"api_url,omitempty"` // 默认 Events API v2 地址，可指向代理
+}
+
+// pagerDutyChannel 通过 PagerDuty Events API v2 触发/恢复事件。
+type pagerDutyChannel struct {
+	cfg        pagerDutyConfig
+	routingKey string
+	client     *http.Client
+}
+
+func newPagerDutyChannel(rec store.NotificationChannelRecord, routingKey string) (NotificationChannel, error) {
+	var cfg pagerDutyConfig
+	if len(rec.Config) > 0 {
+		if err := json.Unmarshal(rec.Config, &cfg); err != nil {
+			return nil, fmt.Errorf("parse pagerduty config: %w", err)
+		}
+	}
+	if routingKey == "" {
+		return nil, errors.New("pagerduty routing_key required")
+	}
+	if cfg.APIURL == "" {
+		cfg.APIURL = pagerDutyEventsURL
+	}
+	return &pagerDutyChannel{
+		cfg:        cfg,
+		routingKey: routingKey,
+		client:     &http.Client{Timeout: 5 * time.Second},
+	}, nil
+}
+
+func (p *pagerDutyChannel) Send(ctx context.Context, msg NotificationMessage) error {
+	_, resolve := AlertRule(msg.EventType)
+	body := map[string]any{
+		"routing_key":  p.routingKey,
+		"event_action": "trigger",
+		"dedup_key":    OnCallDedupKey(msg.AccountID, msg.Node, msg.EventType),
+	}
+	if resolve {
+		body["event_action"] = "resolve"
+	} else {
+		title := msg.Title
+		if title == "" {
+			title = msg.EventType
+		}
+		body["payload"] = map[string]any{
+			"summary":   title,
+			"source":    chooseSource(msg.Node),
+			"severity":  pagerDutySeverity(msg.Severity),
+			"timestamp": msg.OccurredAt.UTC().Format(time.RFC3339),
+			"class":     msg.EventType,
+			"custom_details": map[string]string{
+				"account_id": msg.AccountID,
+				"content":    msg.Content,
+			},
+		}
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.cfg.APIURL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("pagerduty events status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func pagerDutySeverity(severity string) string {
+	switch severity {
+	case SeverityCritical, SeverityWarning, SeverityInfo:
+		return severity
+	default:
+		return "error"
+	}
+}
+
+// chooseSource 值班平台中的告警来源，系统事件没有节点时使用 qcc_plus。
+func chooseSource(node string) string {
+	if node == "" {
+		return "qcc_plus"
+	}
+	return node
+}
@@ -0,0 +1,214 @@
+package notify
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"qcc_plus/internal/store"
+)
+
+// Webhook 签名相关请求头。签名内容为 "<timestamp>.<body>"，算法为 HMAC-SHA256，
+// X-QCC-Signature 形如 "v1=<hex>"，密钥轮换宽限期内同时携带新旧两个签名，以逗号分隔。
+const (
+	HeaderWebhookTimestamp = "X-QCC-Timestamp"
+	HeaderWebhookSignature = "X-QCC-Signature"
+	HeaderWebhookID        = "X-QCC-Webhook-Id"
+
+	// DefaultReplayWindow 建议接收方允许的时间戳偏差，超出即视为重放。
+	DefaultReplayWindow = 5 * time.Minute
+	// DefaultRotationGrace 轮换密钥后旧密钥继续参与签名的默认时长。
+	DefaultRotationGrace = 24 * time.Hour
+
+	// WebhookSigningKeysSetting 账号级签名密钥在 settings 中的 key（is_secret）。
+	WebhookSigningKeysSetting = "webhook.signing_keys"
+
+	webhookSignatureVersion = "v1"
+	webhookSecretPrefix     = "whsec_"
+)
+
+// SigningKeys 账号的 Webhook 签名密钥；Previous 在 PreviousUntil 之前仍参与签名（双签名）。
+type SigningKeys struct {
+	Current       string    `json:"current"`
+	Previous      string    `json:"previous,omitempty"`
+	PreviousUntil time.Time `json:"previous_until,omitempty"`
+	RotatedAt     time.Time `json:"rotated_at"`
+}
+
+// SigningKeyResolver 读取账号的签名密钥，没有时自动生成。
+type SigningKeyResolver interface {
+	WebhookSigningKeys(ctx context.Context, accountID string) (SigningKeys, error)
+}
+
+// signingChannel 以 HTTP 回调投递的渠道，发送前使用账号密钥签名。
+type signingChannel interface {
+	setSigningKeys(keys SigningKeys)
+}
+
+// WithSigningKeys 为支持签名的渠道设置密钥，其他渠道原样返回。
+func WithSigningKeys(ch NotificationChannel, keys SigningKeys) NotificationChannel {
+	if sc, ok := ch.(signingChannel); ok && keys.Current != "" {
+		sc.setSigningKeys(keys)
+	}
+	return ch
+}
+
+// secrets 返回当前参与签名的密钥，新密钥在前。
+func (k SigningKeys) secrets(now time.Time) []string {
+	out := []string{}
+	if k.Current != "" {
+		out = append(out, k.Current)
+	}
+	if k.Previous != "" && now.Before(k.PreviousUntil) {
+		out = append(out, k.Previous)
+	}
+	return out
+}
+
+// GraceActive 旧密钥是否仍在宽限期内。
+func (k SigningKeys) GraceActive(now time.Time) bool {
+	return k.Previous != "" && now.Before(k.PreviousUntil)
+}
+
+// NewWebhookSecret 生成新的签名密钥。
+func NewWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return webhookSecretPrefix + hex.EncodeToString(b), nil
+}
+
+func webhookSignature(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SignWebhook 为请求写入时间戳、投递 ID 与签名头；没有可用密钥时不做任何修改。
+func SignWebhook(h http.Header, keys SigningKeys, body []byte, now time.Time) {
+	secrets := keys.secrets(now)
+	if len(secrets) == 0 {
+		return
+	}
+	ts := strconv.FormatInt(now.Unix(), 10)
+	sigs := make([]string, 0, len(secrets))
+	for _, s := range secrets {
+		sigs = append(sigs, webhookSignatureVersion+"="+webhookSignature(s, ts, body))
+	}
+	h.Set(HeaderWebhookTimestamp, ts)
+	h.Set(HeaderWebhookSignature, strings.Join(sigs, ","))
+	if h.Get(HeaderWebhookID) == "" {
+		h.Set(HeaderWebhookID, randomID())
+	}
+}
+
+// 签名校验错误。
+var (
+	ErrSignatureMissing  = errors.New("webhook signature missing")
+	ErrSignatureExpired  = errors.New("webhook timestamp outside replay window")
+	ErrSignatureMismatch = errors.New("webhook signature mismatch")
+)
+
+// VerifyWebhook 接收方校验参考实现：时间戳须在 window 内（<=0 时使用 DefaultReplayWindow），
+// 且任一 v1 签名与 secret 计算结果一致。完整的重放防护还需要接收方在窗口期内记录已处理的 X-QCC-Webhook-Id。
+func VerifyWebhook(secret string, h http.Header, body []byte, window time.Duration, now time.Time) error {
+	ts, header := h.Get(HeaderWebhookTimestamp), h.Get(HeaderWebhookSignature)
+	if secret == "" || ts == "" || header == "" {
+		return ErrSignatureMissing
+	}
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return ErrSignatureMissing
+	}
+	if window <= 0 {
+		window = DefaultReplayWindow
+	}
+	if d := now.Sub(time.Unix(sec, 0)); d > window || d < -window {
+		return ErrSignatureExpired
+	}
+	want := []byte(webhookSignature(secret, ts, body))
+	for _, part := range strings.Split(header, ",") {
+		version, sig, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if ok && version == webhookSignatureVersion && hmac.Equal([]byte(sig), want) {
+			return nil
+		}
+	}
+	return ErrSignatureMismatch
+}
+
+// WebhookSigningKeys 读取账号签名密钥，不存在时生成并保存，使所有账号的回调默认带签名。
+func (s *StoreAdapter) WebhookSigningKeys(ctx context.Context, accountID string) (SigningKeys, error) {
+	setting, err := s.core.GetSetting(WebhookSigningKeysSetting, "account", accountID)
+	if err == nil {
+		return decodeSigningKeys(setting.Value)
+	}
+	if !errors.Is(err, store.ErrNotFound) {
+		return SigningKeys{}, err
+	}
+	secret, err := NewWebhookSecret()
+	if err != nil {
+		return SigningKeys{}, err
+	}
+	keys := SigningKeys{Current: secret, RotatedAt: time.Now().UTC()}
+	return keys, s.saveSigningKeys(accountID, keys, "")
+}
+
+// RotateWebhookSigningKeys 生成新密钥，旧密钥在 grace 内继续签名；grace<=0 时立即停用旧密钥。
+func (s *StoreAdapter) RotateWebhookSigningKeys(ctx context.Context, accountID string, grace time.Duration, actor string) (SigningKeys, error) {
+	old, err := s.WebhookSigningKeys(ctx, accountID)
+	if err != nil {
+		return SigningKeys{}, err
+	}
+	secret, err := NewWebhookSecret()
+	if err != nil {
+		return SigningKeys{}, err
+	}
+	now := time.Now().UTC()
+	keys := SigningKeys{Current: secret, RotatedAt: now}
+	if grace > 0 {
+		keys.Previous, keys.PreviousUntil = old.Current, now.Add(grace)
+	}
+	return keys, s.saveSigningKeys(accountID, keys, actor)
+}
+
+func (s *StoreAdapter) saveSigningKeys(accountID string, keys SigningKeys, actor string) error {
+	desc := "Webhook 签名密钥（HMAC-SHA256）"
+	setting := &store.Setting{
+		Key:         WebhookSigningKeysSetting,
+		Scope:       "account",
+		AccountID:   &accountID,
+		Value:       keys,
+		DataType:    "object",
+		Category:    "notification",
+		Description: &desc,
+		IsSecret:    true,
+	}
+	if actor != "" {
+		setting.UpdatedBy = &actor
+	}
+	return s.core.UpsertSetting(setting)
+}
+
+func decodeSigningKeys(value any) (SigningKeys, error) {
+	var keys SigningKeys
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return keys, err
+	}
+	if err := json.Unmarshal(raw, &keys); err != nil {
+		return keys, fmt.Errorf("decode webhook signing keys: %w", err)
+	}
+	return keys, nil
+}
@@ -2,6 +2,7 @@ package notify
 
 import (
 	"context"
+	"time"
 
 	"qcc_plus/internal/store"
 )
@@ -28,3 +29,40 @@ func (s *StoreAdapter) ListEnabledSubscriptionsForEvent(ctx context.Context, acc
 func (s *StoreAdapter) InsertNotificationHistory(ctx context.Context, rec store.NotificationHistoryRecord) error {
 	return s.core.InsertNotificationHistory(ctx, rec)
 }
+
+func (s *StoreAdapter) ListEnabledEscalationPoliciesForEvent(ctx context.Context, accountID, eventType string) ([]store.EscalationPolicyRecord, error) {
+	return s.core.ListEnabledEscalationPoliciesForEvent(ctx, accountID, eventType)
+}
+
+func (s *StoreAdapter) GetEscalationPolicy(ctx context.Context, id string) (*store.EscalationPolicyRecord, error) {
+	return s.core.GetEscalationPolicy(ctx, id)
+}
+
+func (s *StoreAdapter) GetNotificationChannel(ctx context.Context, id string) (*store.NotificationChannelRecord, error) {
+	return s.core.GetNotificationChannel(ctx, id)
+}
+
+func (s *StoreAdapter) FindOpenAlert(ctx context.Context, accountID, policyID, dedupKey string) (*store.AlertRecord, error) {
+	return s.core.FindOpenAlert(ctx, accountID, policyID, dedupKey)
+}
+
+func (s *StoreAdapter) InsertAlert(ctx context.Context, rec store.AlertRecord) error {
+	return s.core.InsertAlert(ctx, rec)
+}
+
+func (s *StoreAdapter) ListDueAlerts(ctx context.Context, now time.Time) ([]store.AlertRecord, error) {
+	return s.core.ListDueAlerts(ctx, now)
+}
+
+func (s *StoreAdapter) AdvanceAlertEscalation(ctx context.Context, id string, step int, next time.Time) error {
+	return s.core.AdvanceAlertEscalation(ctx, id, step, next)
+}
+
+func (s *StoreAdapter) GetChannelSecret(ctx context.Context, accountID, channelID string) (string, error) {
+	setting, err := s.core.GetSetting(ChannelSecretKey(channelID), "account", accountID)
+	if err != nil {
+		return "", err
+	}
+	secret, _ := setting.Value.(string)
+	return secret, nil
+}
@@ -15,6 +15,8 @@ const (
 	EventNodeEnabled          = "node.enabled"
 	EventNodeDisabled         = "node.disabled"
 	EventNodeHealthCheckError = "node.health_check_failed"
+	EventNodeBenchmarkRegressed = "node.benchmark_regressed"
+	EventNodeCertExpiring = "node.cert_expiring"
 
 	// 请求相关
 	EventRequestFailed       = "request.failed"
@@ -39,6 +41,9 @@ const (
 	ChannelEmail          = "email"
 	ChannelDingTalk       = "dingtalk"
 	ChannelSlack          = "slack"
+	ChannelPagerDuty      = "pagerduty"
+	ChannelOpsgenie       = "opsgenie"
+	ChannelWebhook        = "webhook"
 )
 
 // Event 表示一条需要发送的通知事件。
@@ -48,7 +53,25 @@ type Event struct {
 	Title     string
 	Content   string
 	DedupKey  string
+	Node      string // 关联节点名称，摘要按节点分组
+	Severity  string // 为空时按事件类型推断
 	OccurredAt time.Time
+	// UpstreamIncident 关联的上游服务商事件（如官方状态页公告）；非空时视为服务商整体故障，
+	// 不创建升级告警、不发送值班渠道，级别降为 warning。
+	UpstreamIncident string
+}
+
+// message 将事件转换为渠道消息。
+func (e Event) message() NotificationMessage {
+	return NotificationMessage{
+		AccountID:  e.AccountID,
+		EventType:  e.EventType,
+		Title:      e.Title,
+		Content:    e.Content,
+		Node:       e.Node,
+		Severity:   SeverityFor(e),
+		OccurredAt: e.OccurredAt,
+	}
 }
 
 // ManagerConfig 控制通知管理器的运行参数。
@@ -58,6 +81,9 @@ type ManagerConfig struct {
 	DedupWindow  time.Duration
 	Logger       Logger
 	SendTimeout  time.Duration
+	DigestTick   time.Duration
+	EscalationTick time.Duration
+	AlertHook      AlertHook
 }
 
 // Logger 抽象日志接口，兼容标准 log.Logger。
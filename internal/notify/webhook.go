@@ -0,0 +1,77 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"qcc_plus/internal/store"
+)
+
+type webhookConfig struct {
+	URL string `json:"url"`
+}
+
+// webhookChannel 通用 Webhook：以 JSON POST 投递事件，使用账号密钥签名，便于自建服务校验来源。
+type webhookChannel struct {
+	cfg    webhookConfig
+	client *http.Client
+	keys   SigningKeys
+}
+
+func newWebhookChannel(rec store.NotificationChannelRecord) (NotificationChannel, error) {
+	var cfg webhookConfig
+	if len(rec.Config) > 0 {
+		if err := json.Unmarshal(rec.Config, &cfg); err != nil {
+			return nil, fmt.Errorf("parse webhook config: %w", err)
+		}
+	}
+	if cfg.URL == "" {
+		return nil, errors.New("webhook url required")
+	}
+	return &webhookChannel{cfg: cfg, client: &http.Client{Timeout: 5 * time.Second}}, nil
+}
+
+func (c *webhookChannel) setSigningKeys(keys SigningKeys) {
+	c.keys = keys
+}
+
+func (c *webhookChannel) Send(ctx context.Context, msg NotificationMessage) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	id := randomID()
+	data, err := json.Marshal(map[string]any{
+		"id":          id,
+		"account_id":  msg.AccountID,
+		"event_type":  msg.EventType,
+		"title":       msg.Title,
+		"content":     msg.Content,
+		"node":        msg.Node,
+		"severity":    msg.Severity,
+		"occurred_at": msg.OccurredAt.UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.cfg.URL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderWebhookID, id)
+	SignWebhook(req.Header, c.keys, data, time.Now())
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook status %d", resp.StatusCode)
+	}
+	return nil
+}
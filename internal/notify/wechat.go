@@ -22,6 +22,7 @@ type wechatChannel struct {
 	cfg    wechatConfig
 	client *http.Client
 	name   string
+	keys   SigningKeys
 }
 
 func newWechatChannel(rec store.NotificationChannelRecord) (NotificationChannel, error) {
@@ -43,6 +44,10 @@ func newWechatChannel(rec store.NotificationChannelRecord) (NotificationChannel,
 	}, nil
 }
 
+func (w *wechatChannel) setSigningKeys(keys SigningKeys) {
+	w.keys = keys
+}
+
 func (w *wechatChannel) Send(ctx context.Context, msg NotificationMessage) error {
 	if ctx == nil {
 		ctx = context.Background()
@@ -62,6 +67,7 @@ func (w *wechatChannel) Send(ctx context.Context, msg NotificationMessage) error
 		return err
 	}
 	req.Header.Set("Content-Type", "application/json")
+	SignWebhook(req.Header, w.keys, data, time.Now())
 	resp, err := w.client.Do(req)
 	if err != nil {
 		return err
@@ -0,0 +1,594 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"qcc_plus/internal/store"
+)
+
+const (
+	abComparisonsPrefix     = "/api/ab-comparisons/"
+	maxABPrompts            = 50
+	maxABResponseText       = 32 * 1024
+	abComparisonTimeout     = 30 * time.Minute
+	abComparisonMemoryLimit = 20 // 未启用存储时每个账号保留的任务数
+)
+
+// abPrompt 对比使用的一条提示词，Body 为完整的 Messages API 请求体。
+type abPrompt struct {
+	Name  string          `json:"name"`
+	Path  string          `json:"path"`
+	Body  json.RawMessage `json:"body"`
+	Entry string          `json:"entry,omitempty"` // 来自回放语料时的条目 ID
+}
+
+// abSide 一个节点对一条提示词的响应。
+type abSide struct {
+	Status       int    `json:"status"`
+	LatencyMs    int64  `json:"latency_ms"`
+	InputTokens  int64  `json:"input_tokens"`
+	OutputTokens int64  `json:"output_tokens"`
+	StopReason   string `json:"stop_reason,omitempty"`
+	Text         string `json:"text"`
+	Truncated    bool   `json:"truncated,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
+// abItem 一条提示词的双方结果，便于界面左右并排展示。
+type abItem struct {
+	Prompt abPrompt `json:"prompt"`
+	A      abSide   `json:"a"`
+	B      abSide   `json:"b"`
+}
+
+// abSideSummary 一侧的汇总。
+type abSideSummary struct {
+	NodeID          string `json:"node_id"`
+	NodeName        string `json:"node_name"`
+	OK              int    `json:"ok"`
+	Failed          int    `json:"failed"`
+	LatencyAvgMs    int64  `json:"latency_avg_ms"`
+	LatencyP95Ms    int64  `json:"latency_p95_ms"`
+	InputTokens     int64  `json:"input_tokens"`
+	OutputTokens    int64  `json:"output_tokens"`
+	AvgResponseSize int    `json:"avg_response_chars"`
+	Faster          int    `json:"faster"` // 双方都成功时耗时更短的条数
+}
+
+type abSummary struct {
+	A abSideSummary `json:"a"`
+	B abSideSummary `json:"b"`
+}
+
+// abComparison 一次对比任务；未启用存储时仅保存在内存中。
+type abComparison struct {
+	rec   store.ABComparisonRecord
+	items []abItem
+}
+
+// abComparisonManager 记录进行中与（无存储时）最近完成的对比任务，同一账号同时只运行一个。
+type abComparisonManager struct {
+	mu   sync.Mutex
+	jobs map[string]*abComparison
+}
+
+func (m *abComparisonManager) running(accountID string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, j := range m.jobs {
+		if j.rec.AccountID == accountID && j.rec.Status == exportPending {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *abComparisonManager) put(job *abComparison) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.jobs == nil {
+		m.jobs = make(map[string]*abComparison)
+	}
+	m.jobs[job.rec.ID] = job
+	var done []*abComparison
+	for _, j := range m.jobs {
+		if j.rec.AccountID == job.rec.AccountID && j.rec.Status != exportPending {
+			done = append(done, j)
+		}
+	}
+	if len(done) > abComparisonMemoryLimit {
+		sort.Slice(done, func(i, k int) bool { return done[i].rec.CreatedAt.Before(done[k].rec.CreatedAt) })
+		for _, j := range done[:len(done)-abComparisonMemoryLimit] {
+			delete(m.jobs, j.rec.ID)
+		}
+	}
+}
+
+func (m *abComparisonManager) get(accountID, id string) *abComparison {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	j := m.jobs[id]
+	if j == nil || j.rec.AccountID != accountID {
+		return nil
+	}
+	cp := *j
+	return &cp
+}
+
+func (m *abComparisonManager) list(accountID string) []store.ABComparisonRecord {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []store.ABComparisonRecord
+	for _, j := range m.jobs {
+		if j.rec.AccountID == accountID {
+			out = append(out, j.rec)
+		}
+	}
+	return out
+}
+
+func (m *abComparisonManager) remove(id string) {
+	m.mu.Lock()
+	delete(m.jobs, id)
+	m.mu.Unlock()
+}
+
+// abResponseText 提取 Messages API 响应中的文本块与停止原因。
+func abResponseText(b []byte) (string, string) {
+	var resp struct {
+		Content []struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		} `json:"content"`
+		StopReason string `json:"stop_reason"`
+	}
+	if err := json.Unmarshal(b, &resp); err != nil {
+		return "", ""
+	}
+	var parts []string
+	for _, c := range resp.Content {
+		if c.Type == "text" {
+			parts = append(parts, c.Text)
+		}
+	}
+	return strings.Join(parts, "\n"), resp.StopReason
+}
+
+// abSend 以非流式方式发送提示词，保存完整文本以便并排比较。
+func (p *Server) abSend(ctx context.Context, client *http.Client, node Node, prompt abPrompt) abSide {
+	var side abSide
+	var payload map[string]any
+	_ = json.Unmarshal(prompt.Body, &payload)
+	payload["stream"] = false
+	body, _ := json.Marshal(payload)
+	apiURL := strings.TrimSuffix(node.URL.String(), "/") + prompt.Path
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, apiURL, bytes.NewReader(body))
+	if err != nil {
+		side.Error = err.Error()
+		return side
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("anthropic-version", "2023-06-01")
+	applyNodeHeaders(req.Header, node.Headers)
+	req.Header.Set("x-api-key", node.APIKey)
+	req.Header.Set("Authorization", "Bearer "+node.APIKey)
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		side.LatencyMs = time.Since(start).Milliseconds()
+		side.Error = classifyUpstreamError(0, err)
+		return side
+	}
+	b, readErr := io.ReadAll(io.LimitReader(resp.Body, usageBufLimit))
+	resp.Body.Close()
+	side.LatencyMs = time.Since(start).Milliseconds()
+	side.Status = resp.StatusCode
+	side.InputTokens, side.OutputTokens = replayUsage(b)
+	switch {
+	case readErr != nil:
+		side.Error = readErr.Error()
+	case !okStatus(resp.StatusCode):
+		side.Error = classifyUpstreamError(resp.StatusCode, nil)
+		side.Text = string(b[:min(len(b), 1024)])
+	default:
+		side.Text, side.StopReason = abResponseText(b)
+	}
+	if len(side.Text) > maxABResponseText {
+		side.Text = strings.ToValidUTF8(side.Text[:maxABResponseText], "")
+		side.Truncated = true
+	}
+	return side
+}
+
+func summarizeABSide(items []abItem, pick func(abItem) (abSide, abSide)) abSideSummary {
+	var s abSideSummary
+	var samples []time.Duration
+	chars := 0
+	for _, it := range items {
+		side, other := pick(it)
+		if !okStatus(side.Status) || side.Error != "" {
+			s.Failed++
+			continue
+		}
+		s.OK++
+		s.InputTokens += side.InputTokens
+		s.OutputTokens += side.OutputTokens
+		chars += len([]rune(side.Text))
+		samples = append(samples, time.Duration(side.LatencyMs)*time.Millisecond)
+		if okStatus(other.Status) && other.Error == "" && side.LatencyMs < other.LatencyMs {
+			s.Faster++
+		}
+	}
+	if n := len(samples); n > 0 {
+		sort.Slice(samples, func(i, k int) bool { return samples[i] < samples[k] })
+		var sum time.Duration
+		for _, d := range samples {
+			sum += d
+		}
+		s.LatencyAvgMs = (sum / time.Duration(n)).Milliseconds()
+		s.LatencyP95Ms = percentile(samples, 95).Milliseconds()
+		s.AvgResponseSize = chars / n
+	}
+	return s
+}
+
+func summarizeAB(rec store.ABComparisonRecord, items []abItem) abSummary {
+	sum := abSummary{
+		A: summarizeABSide(items, func(it abItem) (abSide, abSide) { return it.A, it.B }),
+		B: summarizeABSide(items, func(it abItem) (abSide, abSide) { return it.B, it.A }),
+	}
+	sum.A.NodeID, sum.A.NodeName = rec.NodeAID, rec.NodeAName
+	sum.B.NodeID, sum.B.NodeName = rec.NodeBID, rec.NodeBName
+	return sum
+}
+
+// abComparisonPayload ab_comparison 任务的参数，节点在执行时按 ID 重新读取。
+type abComparisonPayload struct {
+	ID      string     `json:"id"`
+	NodeA   string     `json:"node_a"`
+	NodeB   string     `json:"node_b"`
+	Prompts []abPrompt `json:"prompts"`
+}
+
+// abComparisonJob 执行对比任务，按已完成的提示词条数上报进度。
+func (p *Server) abComparisonJob(ctx context.Context, job *store.Job, progress *jobReporter) (any, error) {
+	var req abComparisonPayload
+	if err := json.Unmarshal(job.Payload, &req); err != nil || req.ID == "" {
+		return nil, fmt.Errorf("invalid comparison payload: %s", job.Payload)
+	}
+	var rec *store.ABComparisonRecord
+	if cur := p.abComparisons.get(job.AccountID, req.ID); cur != nil {
+		rec = &cur.rec
+	} else if p.store != nil {
+		stored, err := p.store.GetABComparison(ctx, job.AccountID, req.ID)
+		if err != nil {
+			return nil, err
+		}
+		rec = stored
+	}
+	if rec == nil {
+		return nil, fmt.Errorf("comparison %s not found", req.ID)
+	}
+	acc := p.getAccountByID(job.AccountID)
+	var a, b Node
+	found := false
+	if acc != nil {
+		p.mu.RLock()
+		na, okA := acc.Nodes[req.NodeA]
+		nb, okB := acc.Nodes[req.NodeB]
+		if found = okA && okB; found {
+			a, b = *na, *nb
+		}
+		p.mu.RUnlock()
+	}
+	if !found {
+		p.finishABComparison(*rec, nil, "node not found")
+		return nil, errors.New("node not found")
+	}
+	items, errText := p.runABComparison(ctx, a, b, req.Prompts, progress)
+	rec = p.finishABComparison(*rec, items, errText)
+	if errText != "" {
+		return nil, errors.New(errText)
+	}
+	return map[string]interface{}{"id": rec.ID, "summary": json.RawMessage(rec.Summary)}, nil
+}
+
+// runABComparison 逐条发送提示词，同一条提示词并发发往两个节点；超时或任务取消时返回已完成的部分与原因。
+func (p *Server) runABComparison(ctx context.Context, a, b Node, prompts []abPrompt, progress *jobReporter) ([]abItem, string) {
+	runCtx, cancel := context.WithTimeout(ctx, abComparisonTimeout)
+	defer cancel()
+	client := &http.Client{Transport: p.healthRT, Timeout: benchmarkRequestTimeout}
+	items := make([]abItem, 0, len(prompts))
+	for i, prompt := range prompts {
+		if runCtx.Err() != nil {
+			break
+		}
+		it := abItem{Prompt: prompt}
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() { defer wg.Done(); it.A = p.abSend(runCtx, client, a, prompt) }()
+		go func() { defer wg.Done(); it.B = p.abSend(runCtx, client, b, prompt) }()
+		wg.Wait()
+		items = append(items, it)
+		progress.Update(int64(i+1), int64(len(prompts)))
+	}
+	switch {
+	case ctx.Err() != nil:
+		return items, "comparison cancelled"
+	case runCtx.Err() != nil:
+		return items, "comparison timed out"
+	}
+	return items, ""
+}
+
+// finishABComparison 写回对比结果与汇总；未启用存储或写入失败时保留在内存中。
+func (p *Server) finishABComparison(rec store.ABComparisonRecord, items []abItem, errText string) *store.ABComparisonRecord {
+	now := time.Now().UTC()
+	rec.FinishedAt = &now
+	rec.Status = exportReady
+	if errText != "" {
+		rec.Status, rec.Error = exportFailed, errText
+	}
+	if b, err := json.Marshal(items); err == nil {
+		rec.Results = string(b)
+	}
+	if b, err := json.Marshal(summarizeAB(rec, items)); err == nil {
+		rec.Summary = string(b)
+	}
+	if p.store != nil {
+		sctx, scancel := context.WithTimeout(context.Background(), 5*time.Second)
+		err := p.store.SaveABComparison(sctx, rec)
+		scancel()
+		if err != nil {
+			p.logger.Printf("save ab comparison %s failed: %v", rec.ID, err)
+			rec.Status, rec.Error = exportFailed, "save results failed: "+err.Error()
+		} else {
+			// 结果已持久化，内存中只保留到写入完成为止。
+			p.abComparisons.remove(rec.ID)
+			return &rec
+		}
+	}
+	p.abComparisons.put(&abComparison{rec: rec, items: items})
+	return &rec
+}
+
+func abComparisonView(rec store.ABComparisonRecord, withResults bool) map[string]interface{} {
+	v := map[string]interface{}{
+		"id":         rec.ID,
+		"account_id": rec.AccountID,
+		"label":      rec.Label,
+		"status":     rec.Status,
+		"prompts":    rec.Prompts,
+		"node_a":     map[string]string{"id": rec.NodeAID, "name": rec.NodeAName},
+		"node_b":     map[string]string{"id": rec.NodeBID, "name": rec.NodeBName},
+		"started_by": rec.StartedBy,
+		"created_at": rec.CreatedAt,
+	}
+	if rec.FinishedAt != nil {
+		v["finished_at"] = *rec.FinishedAt
+	}
+	if rec.Error != "" {
+		v["error"] = rec.Error
+	}
+	if rec.Summary != "" {
+		v["summary"] = json.RawMessage(rec.Summary)
+	}
+	if withResults && rec.Results != "" {
+		v["items"] = json.RawMessage(rec.Results)
+	}
+	return v
+}
+
+// GET    /api/ab-comparisons?account_id=   最近的对比任务（含汇总）
+// GET    /api/ab-comparisons/:id           逐条提示词的双方响应与耗时/token
+// POST   /api/ab-comparisons               {"node_a","node_b","prompts":[{"name","body":{...}}],"entries":["rp-.."],"label"}，异步运行
+// DELETE /api/ab-comparisons/:id
+func (p *Server) handleABComparisons(w http.ResponseWriter, r *http.Request) {
+	acc, ok := p.replayAccount(w, r)
+	if !ok {
+		return
+	}
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, strings.TrimSuffix(abComparisonsPrefix, "/")), "/")
+	switch {
+	case r.Method == http.MethodGet && id == "":
+		recs := p.abComparisons.list(acc.ID)
+		if p.store != nil {
+			stored, err := p.store.ListABComparisons(r.Context(), acc.ID, 50)
+			if err != nil {
+				writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+				return
+			}
+			recs = append(recs, stored...)
+		}
+		sort.Slice(recs, func(i, k int) bool { return recs[i].CreatedAt.After(recs[k].CreatedAt) })
+		items := make([]map[string]interface{}, 0, len(recs))
+		seen := make(map[string]bool, len(recs))
+		for _, rec := range recs {
+			if !seen[rec.ID] {
+				seen[rec.ID] = true
+				items = append(items, abComparisonView(rec, false))
+			}
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"account_id": acc.ID, "comparisons": items, "count": len(items)})
+	case r.Method == http.MethodGet:
+		if job := p.abComparisons.get(acc.ID, id); job != nil {
+			writeJSON(w, http.StatusOK, abComparisonView(job.rec, true))
+			return
+		}
+		if p.store != nil {
+			rec, err := p.store.GetABComparison(r.Context(), acc.ID, id)
+			if err != nil {
+				writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+				return
+			}
+			if rec != nil {
+				writeJSON(w, http.StatusOK, abComparisonView(*rec, true))
+				return
+			}
+		}
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "comparison not found"})
+	case r.Method == http.MethodPost && id == "":
+		p.startABComparison(w, r, acc)
+	case r.Method == http.MethodDelete && id != "":
+		job := p.abComparisons.get(acc.ID, id)
+		pending := job != nil && job.rec.Status == exportPending
+		if !pending && p.store != nil {
+			rec, err := p.store.GetABComparison(r.Context(), acc.ID, id)
+			if err != nil {
+				writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+				return
+			}
+			if rec != nil && rec.Status == exportPending {
+				// 任务取消或丢失后记录会停留在 pending，此时允许删除。
+				pending, err = p.hasActiveJob(r.Context(), jobTypeABComparison, acc.ID)
+				if err != nil {
+					writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+					return
+				}
+			}
+		}
+		if pending {
+			writeJSON(w, http.StatusConflict, map[string]string{"error": "comparison still running"})
+			return
+		}
+		found := job != nil
+		p.abComparisons.remove(id)
+		if p.store != nil {
+			deleted, err := p.store.DeleteABComparison(r.Context(), acc.ID, id)
+			if err != nil {
+				writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+				return
+			}
+			found = found || deleted
+		}
+		if !found {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "comparison not found"})
+			return
+		}
+		p.audit(acc.ID, auditActor(r), "ab_comparison.delete", id, nil)
+		writeJSON(w, http.StatusOK, map[string]string{"deleted": id})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (p *Server) startABComparison(w http.ResponseWriter, r *http.Request, acc *Account) {
+	var req struct {
+		NodeA   string     `json:"node_a"`
+		NodeB   string     `json:"node_b"`
+		Prompts []abPrompt `json:"prompts"`
+		Entries []string   `json:"entries"`
+		Label   string     `json:"label"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxABPrompts*maxReplayBodyBytes)).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
+		return
+	}
+	if req.NodeA == "" || req.NodeB == "" || req.NodeA == req.NodeB {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "node_a and node_b must be two different nodes"})
+		return
+	}
+	prompts := make([]abPrompt, 0, len(req.Prompts)+len(req.Entries))
+	for i, pr := range req.Prompts {
+		var payload map[string]any
+		if err := json.Unmarshal(pr.Body, &payload); err != nil || payload == nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("prompts[%d].body must be a json object", i)})
+			return
+		}
+		pr.Name = chooseNonEmpty(strings.TrimSpace(pr.Name), fmt.Sprintf("prompt-%d", i+1))
+		pr.Path = chooseNonEmpty(strings.TrimSpace(pr.Path), defaultReplayPath)
+		if !strings.HasPrefix(pr.Path, "/") {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "path must start with /"})
+			return
+		}
+		prompts = append(prompts, pr)
+	}
+
+	p.mu.RLock()
+	a, okA := acc.Nodes[req.NodeA]
+	b, okB := acc.Nodes[req.NodeB]
+	var nodeA, nodeB Node
+	if okA && okB {
+		nodeA, nodeB = *a, *b
+	}
+	for _, e := range acc.ReplayCorpus {
+		if containsString(req.Entries, e.ID) {
+			prompts = append(prompts, abPrompt{Name: e.Name, Path: e.Path, Body: json.RawMessage(e.Body), Entry: e.ID})
+		}
+	}
+	p.mu.RUnlock()
+	switch {
+	case !okA || !okB:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "node not found"})
+		return
+	case nodeA.APIKey == "" || nodeB.APIKey == "":
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "comparison requires node api keys"})
+		return
+	case len(prompts) == 0:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "prompts or entries required"})
+		return
+	case len(prompts) > maxABPrompts:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("at most %d prompts", maxABPrompts)})
+		return
+	}
+	active, err := p.hasActiveJob(r.Context(), jobTypeABComparison, acc.ID)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	if active || p.abComparisons.running(acc.ID) {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "comparison already running for this account"})
+		return
+	}
+
+	actor := auditActor(r)
+	job := &abComparison{rec: store.ABComparisonRecord{
+		ID:        "ab-" + randomToken(8),
+		AccountID: acc.ID,
+		NodeAID:   nodeA.ID,
+		NodeAName: nodeA.Name,
+		NodeBID:   nodeB.ID,
+		NodeBName: nodeB.Name,
+		Label:     strings.TrimSpace(req.Label),
+		Status:    exportPending,
+		Prompts:   len(prompts),
+		StartedBy: actor,
+		CreatedAt: time.Now().UTC(),
+	}}
+	if p.store != nil {
+		// 有存储时任务记录落库，由执行任务的实例读取，不在本实例内存中登记。
+		if err := p.store.SaveABComparison(r.Context(), job.rec); err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+	} else {
+		p.abComparisons.put(job)
+	}
+	payload := abComparisonPayload{ID: job.rec.ID, NodeA: nodeA.ID, NodeB: nodeB.ID, Prompts: prompts}
+	jobID, err := p.submitJob(r.Context(), jobTypeABComparison, acc.ID, actor, payload, 1)
+	if err != nil {
+		p.finishABComparison(job.rec, nil, "start comparison failed: "+err.Error())
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	p.audit(acc.ID, actor, "ab_comparison.start", job.rec.ID, map[string]interface{}{
+		"node_a":  nodeA.ID,
+		"node_b":  nodeB.ID,
+		"prompts": len(prompts),
+		"job_id":  jobID,
+	})
+	view := abComparisonView(job.rec, false)
+	view["job_id"] = jobID
+	writeJSON(w, http.StatusAccepted, view)
+}
@@ -0,0 +1,222 @@
+package proxy
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"qcc_plus/internal/logfile"
+)
+
+// 访问日志格式。
+const (
+	accessLogCommon   = "common"   // NCSA Common Log Format
+	accessLogCombined = "combined" // Common 格式附加 Referer 与 User-Agent
+)
+
+const accessLogStdout = "stdout"
+
+// accessLogConfig 访问日志配置：Output 为 stdout 或文件路径，写文件时按大小或时间滚动。
+type accessLogConfig struct {
+	Enabled     bool
+	Format      string
+	Output      string
+	MaxSizeMB   int
+	MaxBackups  int
+	MaxAgeDays  int
+	RotateHours int
+	Compress    bool
+}
+
+func (c accessLogConfig) fileOptions() logfile.Options {
+	return logfile.Options{
+		MaxSizeMB:  c.MaxSizeMB,
+		MaxBackups: c.MaxBackups,
+		MaxAge:     time.Duration(c.MaxAgeDays) * 24 * time.Hour,
+		Interval:   time.Duration(c.RotateHours) * time.Hour,
+		Compress:   c.Compress,
+	}
+}
+
+// accessLog 访问日志输出目标，配置的文件路径变化时重新打开。
+type accessLog struct {
+	mu   sync.Mutex
+	file *logfile.Writer
+}
+
+// accessLogConfig 从 SettingsCache 读取访问日志配置，默认关闭。
+func (p *Server) accessLogConfig() accessLogConfig {
+	cfg := accessLogConfig{Format: accessLogCombined, Output: accessLogStdout, MaxSizeMB: 100, MaxBackups: 5, MaxAgeDays: 30, RotateHours: 24, Compress: true}
+	if p.settingsCache == nil {
+		return cfg
+	}
+	cfg.Enabled = p.settingsCache.GetBool("access_log.enabled", false)
+	if f := strings.ToLower(p.settingsCache.GetString("access_log.format", cfg.Format)); f == accessLogCommon {
+		cfg.Format = f
+	}
+	if out := strings.TrimSpace(p.settingsCache.GetString("access_log.output", cfg.Output)); out != "" {
+		cfg.Output = out
+	}
+	if n := p.settingsCache.GetInt("access_log.max_size_mb", cfg.MaxSizeMB); n >= 0 {
+		cfg.MaxSizeMB = n
+	}
+	if n := p.settingsCache.GetInt("access_log.max_backups", cfg.MaxBackups); n >= 0 {
+		cfg.MaxBackups = n
+	}
+	if n := p.settingsCache.GetInt("access_log.max_age_days", cfg.MaxAgeDays); n >= 0 {
+		cfg.MaxAgeDays = n
+	}
+	if n := p.settingsCache.GetInt("access_log.rotate_hours", cfg.RotateHours); n >= 0 {
+		cfg.RotateHours = n
+	}
+	cfg.Compress = p.settingsCache.GetBool("access_log.compress", cfg.Compress)
+	return cfg
+}
+
+// write 写出一行访问日志；文件打开失败时回退到标准输出，避免丢失日志。
+func (a *accessLog) write(cfg accessLogConfig, line string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var out io.Writer = os.Stdout
+	if cfg.Output != accessLogStdout {
+		if a.file == nil || a.file.Path() != cfg.Output {
+			if a.file != nil {
+				_ = a.file.Close()
+				a.file = nil
+			}
+			if f, err := logfile.Open(cfg.Output, cfg.fileOptions()); err == nil {
+				a.file = f
+			}
+		}
+		if a.file != nil {
+			a.file.SetOptions(cfg.fileOptions())
+			out = a.file
+		}
+	}
+	_, _ = io.WriteString(out, line)
+}
+
+func (a *accessLog) close() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.file != nil {
+		_ = a.file.Close()
+		a.file = nil
+	}
+}
+
+// accessLogWriter 记录响应状态码与字节数，保留 Flush/Hijack 以支持流式响应与 WebSocket。
+type accessLogWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *accessLogWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *accessLogWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+func (w *accessLogWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *accessLogWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("hijack not supported")
+	}
+	conn, rw, err := h.Hijack()
+	if err == nil && w.status == 0 {
+		w.status = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+func (w *accessLogWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// withAccessLog 在开启 access_log.enabled 时为管理 API 与代理转发统一记录访问日志。
+func (p *Server) withAccessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfg := p.accessLogConfig()
+		if !cfg.Enabled {
+			next.ServeHTTP(w, r)
+			return
+		}
+		start := time.Now()
+		aw := &accessLogWriter{ResponseWriter: w}
+		next.ServeHTTP(aw, r)
+		if aw.status == 0 {
+			aw.status = http.StatusOK
+		}
+		p.accessLog.write(cfg, formatAccessLog(cfg.Format, r, aw.status, aw.bytes, start))
+	})
+}
+
+// formatAccessLog 按 Common/Combined Log Format 格式化一行日志（含换行）。
+func formatAccessLog(format string, r *http.Request, status int, bytes int64, at time.Time) string {
+	host := r.RemoteAddr
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	user := "-"
+	if u, _, ok := r.BasicAuth(); ok && u != "" {
+		user = clfEscape(u)
+	}
+	size := "-"
+	if bytes > 0 {
+		size = fmt.Sprintf("%d", bytes)
+	}
+	line := fmt.Sprintf("%s - %s [%s] \"%s %s %s\" %d %s",
+		clfField(host), user, at.Format("02/Jan/2006:15:04:05 -0700"),
+		clfEscape(r.Method), clfEscape(r.URL.RequestURI()), clfEscape(r.Proto), status, size)
+	if format == accessLogCombined {
+		line += fmt.Sprintf(" \"%s\" \"%s\"", clfField(clfEscape(r.Referer())), clfField(clfEscape(r.UserAgent())))
+	}
+	return line + "\n"
+}
+
+func clfField(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// clfEscape 转义引号、反斜杠与控制字符，避免伪造日志行。
+func clfEscape(s string) string {
+	var b strings.Builder
+	for _, c := range s {
+		switch {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(c)
+		case c < 0x20 || c == 0x7f:
+			fmt.Fprintf(&b, "\\x%02x", c)
+		default:
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,463 @@
+package proxy
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"qcc_plus/internal/store"
+)
+
+const (
+	accountExportTTL        = time.Hour // 导出包生成后可下载的时长
+	accountExportTimeout    = 5 * time.Minute
+	accountExportUsageDays  = 365
+	accountExportMaxAudit   = 50000
+	accountExportAuditPage  = 1000
+	accountExportUsageLimit = 5000 // QueryUsageRollups 单次返回上限
+	accountExportAttempts   = 3    // 导出任务的最大执行次数（含首次）
+	accountExportSteps      = 5    // 进度按 账号与节点、配置、用量、审计日志、打包 五步计
+)
+
+// 导出任务状态。
+const (
+	exportPending = "pending"
+	exportReady   = "ready"
+	exportFailed  = "failed"
+)
+
+// accountExportSkippedKeys 含口令哈希、邀请令牌或密钥哈希的账号配置，不原样导出；成员与服务账号以脱敏视图写入 account.json。
+var accountExportSkippedKeys = map[string]bool{
+	accountUsersSettingKey:       true,
+	accountInvitationsSettingKey: true,
+	accountPasswordSettingKey:    true,
+	serviceAccountsSettingKey:    true,
+}
+
+// accountExport 一次账号数据导出任务，由后台任务（account_export）生成归档。
+// 归档仅保存在执行任务的实例内存中，过期后丢弃。
+type accountExport struct {
+	ID          string
+	JobID       int64
+	AccountID   string
+	Status      string
+	Error       string
+	RequestedBy string
+	CreatedAt   time.Time
+	FinishedAt  time.Time
+	Counts      map[string]int
+	data        []byte
+}
+
+// accountExportManager 管理进行中与可下载的导出任务，同一账号同时只生成一个导出包。
+type accountExportManager struct {
+	mu   sync.Mutex
+	jobs map[string]*accountExport
+}
+
+// pruneLocked 移除已过期的导出，调用方需持有 m.mu。
+func (m *accountExportManager) pruneLocked(now time.Time) {
+	for id, job := range m.jobs {
+		if job.Status != exportPending && now.Sub(job.FinishedAt) > accountExportTTL {
+			delete(m.jobs, id)
+		}
+	}
+}
+
+// start 登记导出任务；账号已有进行中的导出时返回该任务且 created 为 false。
+func (m *accountExportManager) start(accountID, actor string) (job *accountExport, created bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now().UTC()
+	m.pruneLocked(now)
+	for _, j := range m.jobs {
+		if j.AccountID == accountID && j.Status == exportPending {
+			return j, false
+		}
+	}
+	if m.jobs == nil {
+		m.jobs = make(map[string]*accountExport)
+	}
+	job = &accountExport{ID: randomToken(8), AccountID: accountID, Status: exportPending, RequestedBy: actor, CreatedAt: now}
+	m.jobs[job.ID] = job
+	return job, true
+}
+
+// setJob 记录导出对应的后台任务编号。
+func (m *accountExportManager) setJob(id string, jobID int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if job := m.jobs[id]; job != nil {
+		job.JobID = jobID
+	}
+}
+
+// running 标记导出开始执行；任务由其他实例入队或进程重启后重跑时补登记。
+func (m *accountExportManager) running(id, accountID, actor string, jobID int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.jobs == nil {
+		m.jobs = make(map[string]*accountExport)
+	}
+	job := m.jobs[id]
+	if job == nil {
+		job = &accountExport{ID: id, AccountID: accountID, RequestedBy: actor, CreatedAt: time.Now().UTC()}
+		m.jobs[id] = job
+	}
+	job.JobID, job.Status, job.Error = jobID, exportPending, ""
+}
+
+func (m *accountExportManager) finish(id string, data []byte, counts map[string]int, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job := m.jobs[id]
+	if job == nil {
+		return
+	}
+	job.FinishedAt = time.Now().UTC()
+	job.Counts = counts
+	if err != nil {
+		job.Status, job.Error = exportFailed, err.Error()
+		return
+	}
+	job.Status, job.data = exportReady, data
+}
+
+// get 返回账号下的导出任务快照，不存在或已过期时返回 nil。
+func (m *accountExportManager) get(accountID, id string) *accountExport {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.pruneLocked(time.Now().UTC())
+	job := m.jobs[id]
+	if job == nil || job.AccountID != accountID {
+		return nil
+	}
+	cp := *job
+	return &cp
+}
+
+func (e *accountExport) view() map[string]interface{} {
+	v := map[string]interface{}{
+		"id":           e.ID,
+		"account_id":   e.AccountID,
+		"status":       e.Status,
+		"requested_by": e.RequestedBy,
+		"created_at":   e.CreatedAt,
+	}
+	if e.JobID != 0 {
+		v["job_id"] = e.JobID
+	}
+	if e.Status != exportPending {
+		v["finished_at"] = e.FinishedAt
+		v["counts"] = e.Counts
+	}
+	switch e.Status {
+	case exportReady:
+		v["size_bytes"] = len(e.data)
+		v["expires_at"] = e.FinishedAt.Add(accountExportTTL)
+		v["download_url"] = fmt.Sprintf("/api/accounts/%s/export/%s/download", e.AccountID, e.ID)
+	case exportFailed:
+		v["error"] = e.Error
+	}
+	return v
+}
+
+// handleAccountExport 处理账号数据导出：
+// POST /api/accounts/:id/export                      发起异步导出（后台任务 account_export），返回任务
+// GET  /api/accounts/:id/export/:export_id           查询状态
+// GET  /api/accounts/:id/export/:export_id/download  下载 zip 归档
+func (p *Server) handleAccountExport(w http.ResponseWriter, r *http.Request, acc *Account, parts []string) {
+	if !canAdministerAccount(r.Context(), acc.ID) {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+		return
+	}
+	switch {
+	case len(parts) == 0:
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		actor := auditActor(r)
+		job, created := p.exports.start(acc.ID, actor)
+		if created {
+			jobID, err := p.submitJob(r.Context(), jobTypeAccountExport, acc.ID, actor, accountExportPayload{ExportID: job.ID}, accountExportAttempts)
+			if err != nil {
+				p.exports.finish(job.ID, nil, nil, err)
+				writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+				return
+			}
+			p.exports.setJob(job.ID, jobID)
+			p.audit(acc.ID, actor, "account.export", job.ID, map[string]interface{}{"job_id": jobID})
+		}
+		writeJSON(w, http.StatusAccepted, p.exports.get(acc.ID, job.ID).view())
+	case len(parts) <= 2:
+		if r.Method != http.MethodGet || (len(parts) == 2 && parts[1] != "download") {
+			http.NotFound(w, r)
+			return
+		}
+		job := p.exports.get(acc.ID, parts[0])
+		if job == nil {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "export not found or expired"})
+			return
+		}
+		if len(parts) == 1 {
+			writeJSON(w, http.StatusOK, job.view())
+			return
+		}
+		if job.Status != exportReady {
+			writeJSON(w, http.StatusConflict, map[string]string{"error": "export is " + job.Status})
+			return
+		}
+		name := fmt.Sprintf("account-%s-export-%s.zip", acc.ID, job.FinishedAt.Format("20060102-150405"))
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(job.data)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// accountExportPayload account_export 任务的参数。
+type accountExportPayload struct {
+	ExportID string `json:"export_id"`
+}
+
+// accountExportJob 生成导出归档。失败且还有重试次数时导出保持 pending，由任务队列退避重试。
+func (p *Server) accountExportJob(ctx context.Context, job *store.Job, progress *jobReporter) (any, error) {
+	var req accountExportPayload
+	if err := json.Unmarshal(job.Payload, &req); err != nil || req.ExportID == "" {
+		return nil, fmt.Errorf("invalid export payload: %s", job.Payload)
+	}
+	acc := p.getAccountByID(job.AccountID)
+	if acc == nil {
+		return nil, fmt.Errorf("account %s not found", job.AccountID)
+	}
+	p.exports.running(req.ExportID, acc.ID, job.CreatedBy, job.ID)
+	buildCtx, cancel := context.WithTimeout(ctx, accountExportTimeout)
+	data, counts, err := p.buildAccountExport(buildCtx, acc, progress)
+	cancel()
+	if err != nil {
+		p.logger.Printf("account %s export %s failed (attempt %d/%d): %v", acc.ID, req.ExportID, job.Attempts, job.MaxAttempts, err)
+		if ctx.Err() == nil && job.Attempts < job.MaxAttempts {
+			return nil, err
+		}
+	}
+	p.exports.finish(req.ExportID, data, counts, err)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"export_id": req.ExportID, "counts": counts, "size_bytes": len(data)}, nil
+}
+
+// buildAccountExport 生成账号数据归档：账号信息、节点、账号级配置、按日用量汇总与审计日志，各为一个 JSON 文件。
+// 口令哈希、密钥等敏感内容不导出或以掩码代替。
+func (p *Server) buildAccountExport(ctx context.Context, acc *Account, progress *jobReporter) ([]byte, map[string]int, error) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	counts := map[string]int{}
+	add := func(name string, v interface{}) error {
+		f, err := zw.Create(name)
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+
+	step := func(stage string, done int64) {
+		progress.Stage(stage)
+		progress.Update(done, accountExportSteps)
+	}
+
+	step("nodes", 0)
+	nodes := p.listNodes(acc)
+	counts["nodes"] = len(nodes)
+	if err := add("account.json", p.accountExportInfo(acc)); err != nil {
+		return nil, nil, err
+	}
+	if err := add("nodes.json", nodes); err != nil {
+		return nil, nil, err
+	}
+
+	var notes []string
+	if p.store == nil {
+		notes = append(notes, "persistent store disabled: settings, usage and audit logs are not available")
+	} else {
+		step("settings", 1)
+		settings, err := p.accountExportSettings(acc.ID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("settings: %w", err)
+		}
+		counts["settings"] = len(settings)
+		if err := add("settings.json", settings); err != nil {
+			return nil, nil, err
+		}
+
+		step("usage", 2)
+		now := time.Now().UTC()
+		rows, err := p.store.QueryUsageRollups(ctx, store.UsageRollupQuery{
+			AccountID:   acc.ID,
+			Granularity: store.MetricsGranularityDaily,
+			From:        now.AddDate(0, 0, -accountExportUsageDays),
+			To:          now,
+			GroupBy:     []string{"bucket", "node_id", "model"},
+			Limit:       accountExportUsageLimit,
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("usage: %w", err)
+		}
+		usage := make([]map[string]interface{}, 0, len(rows))
+		for _, row := range rows {
+			item := map[string]interface{}{
+				"day":                  row.BucketStart.Format("2006-01-02"),
+				"requests_total":       row.RequestsTotal,
+				"requests_failed":      row.RequestsFailed,
+				"input_tokens":         row.InputTokensTotal,
+				"output_tokens":        row.OutputTokensTotal,
+				"bytes_total":          row.BytesTotal,
+				"response_time_sum_ms": row.ResponseTimeSumMs,
+			}
+			for k, v := range row.Dims {
+				item[k] = v
+			}
+			usage = append(usage, item)
+		}
+		if len(rows) >= accountExportUsageLimit {
+			notes = append(notes, fmt.Sprintf("usage_daily.json truncated to %d rows", accountExportUsageLimit))
+		}
+		counts["usage_daily"] = len(usage)
+		if err := add("usage_daily.json", usage); err != nil {
+			return nil, nil, err
+		}
+
+		step("audit_logs", 3)
+		audit, truncated, err := p.accountExportAudit(ctx, acc.ID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("audit logs: %w", err)
+		}
+		if truncated {
+			notes = append(notes, fmt.Sprintf("audit_logs.json truncated to the latest %d entries", accountExportMaxAudit))
+		}
+		counts["audit_logs"] = len(audit)
+		if err := add("audit_logs.json", audit); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	step("archive", 4)
+	if err := add("manifest.json", map[string]interface{}{
+		"account_id":   acc.ID,
+		"account_name": acc.Name,
+		"generated_at": time.Now().UTC(),
+		"counts":       counts,
+		"notes":        notes,
+	}); err != nil {
+		return nil, nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, nil, err
+	}
+	return buf.Bytes(), counts, nil
+}
+
+// accountExportInfo 账号基本信息与成员、服务账号的脱敏视图。
+func (p *Server) accountExportInfo(acc *Account) map[string]interface{} {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	users := make([]map[string]interface{}, 0, len(acc.Users))
+	for _, u := range acc.Users {
+		users = append(users, map[string]interface{}{
+			"id":         u.ID,
+			"name":       u.Name,
+			"email":      u.Email,
+			"role":       u.Role,
+			"invited_by": u.InvitedBy,
+			"created_at": u.CreatedAt,
+		})
+	}
+	services := make([]map[string]interface{}, 0, len(acc.ServiceAccounts))
+	for _, sa := range acc.ServiceAccounts {
+		services = append(services, map[string]interface{}{
+			"id":           sa.ID,
+			"name":         sa.Name,
+			"label":        sa.Label,
+			"key_hint":     sa.KeyHint,
+			"disabled":     sa.Disabled,
+			"created_at":   sa.CreatedAt,
+			"last_used_at": sa.LastUsedAt,
+		})
+	}
+	return map[string]interface{}{
+		"id":               acc.ID,
+		"name":             acc.Name,
+		"is_admin":         acc.IsAdmin,
+		"has_proxy_key":    acc.ProxyAPIKey != "",
+		"key":              acc.Key,
+		"policy":           acc.Policy,
+		"display":          acc.Display,
+		"node_template":    acc.NodeTemplate,
+		"users":            users,
+		"service_accounts": services,
+	}
+}
+
+// accountExportSettings 账号级配置，密钥类配置以掩码代替。
+func (p *Server) accountExportSettings(accountID string) ([]map[string]interface{}, error) {
+	list, err := p.store.ListSettings("account", "", accountID)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]map[string]interface{}, 0, len(list))
+	for _, s := range list {
+		if accountExportSkippedKeys[s.Key] {
+			continue
+		}
+		out = append(out, map[string]interface{}{
+			"key":        s.Key,
+			"value":      maskedSettingValue(s, false),
+			"data_type":  s.DataType,
+			"category":   s.Category,
+			"version":    s.Version,
+			"updated_at": s.UpdatedAt,
+		})
+	}
+	return out, nil
+}
+
+// accountExportAudit 按时间倒序分页读取账号的审计日志，超过上限时截断。
+func (p *Server) accountExportAudit(ctx context.Context, accountID string) ([]map[string]interface{}, bool, error) {
+	out := []map[string]interface{}{}
+	for offset := 0; offset < accountExportMaxAudit; offset += accountExportAuditPage {
+		records, err := p.store.ListAuditLogs(ctx, store.AuditLogQuery{AccountID: accountID, Limit: accountExportAuditPage, Offset: offset})
+		if err != nil {
+			return nil, false, err
+		}
+		for _, rec := range records {
+			var detail interface{}
+			if rec.Detail != "" {
+				if err := json.Unmarshal([]byte(rec.Detail), &detail); err != nil {
+					detail = rec.Detail
+				}
+			}
+			out = append(out, map[string]interface{}{
+				"id":         rec.ID,
+				"actor":      rec.Actor,
+				"action":     rec.Action,
+				"target":     rec.Target,
+				"detail":     detail,
+				"created_at": rec.CreatedAt,
+			})
+		}
+		if len(records) < accountExportAuditPage {
+			return out, false, nil
+		}
+	}
+	return out, true, nil
+}
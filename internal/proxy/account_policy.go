@@ -0,0 +1,195 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"qcc_plus/internal/store"
+)
+
+const accountPolicySettingKey = "account.key_policy"
+
+// AccountPolicy 描述账号代理密钥的附加权限与限制，持久化为账号级配置 account.key_policy。
+type AccountPolicy struct {
+	BlockedPatterns  []string `json:"blocked_patterns,omitempty"` // 请求内容屏蔽正则
+	FilterAction     string   `json:"filter_action,omitempty"`    // 命中后的处理：reject（默认）/flag
+	LogBodies        bool     `json:"log_bodies"`                 // 请求日志保存请求体（脱敏后）
+	DisableRedaction bool     `json:"disable_redaction"`          // 关闭内置的邮箱/电话/卡号脱敏
+	RedactPatterns   []string `json:"redact_patterns,omitempty"`  // 额外的脱敏正则
+	MaxOutputTokens  int      `json:"max_output_tokens"`          // max_tokens 上限，0 表示不限制
+	MaxResponseBytes int64    `json:"max_response_bytes"`         // 响应体字节上限，0 表示不限制
+	MaxRequestBytes  int64    `json:"max_request_bytes"`          // 请求体字节上限，0 表示使用系统配置
+	CapMode          string   `json:"cap_mode,omitempty"`         // max_tokens 超限处理：clamp（默认）/reject
+	AllowedLabels    []string `json:"allowed_labels,omitempty"`   // 允许的 X-QCC-Label 取值
+	AllowedPaths     []string `json:"allowed_paths,omitempty"`    // 账号代理密钥允许调用的上游路径，* 结尾为前缀匹配，空为不限制；服务账号按自身设置
+	StreamFailure    string   `json:"stream_failure,omitempty"`   // 流式响应中途失败：error_event（默认）/continue/close
+	RecordSampleRate float64  `json:"record_sample_rate"`         // 流量录制采样率 0-1，0 表示不录制；需配置录制存储
+	RecordMaxBytes   int64    `json:"record_max_bytes"`           // 录制时请求/响应体各自保留的字节上限，0 表示默认值
+	TokenQuota       int64    `json:"token_quota"`                // 每周期 token 配额（输入+输出），0 表示不限制
+	QuotaPeriod      string   `json:"quota_period,omitempty"`     // 配额周期：month（默认）/day
+	QuotaWarnPct     []int    `json:"quota_warn_pct,omitempty"`   // 配额预警阈值（百分比），空时使用系统配置
+}
+
+// compiledPolicy 为账号策略预编译的规则，随策略一同替换。
+type compiledPolicy struct {
+	filter   *contentFilter
+	redactor *redactor
+}
+
+// compileAccountPolicy 校验并编译账号策略中的正则规则。
+func compileAccountPolicy(policy AccountPolicy) (*compiledPolicy, error) {
+	filter, err := compileContentFilter(policy)
+	if err != nil {
+		return nil, err
+	}
+	red, err := newRedactor(policy)
+	if err != nil {
+		return nil, err
+	}
+	return &compiledPolicy{filter: filter, redactor: red}, nil
+}
+
+// accountPolicy 返回账号策略副本。
+func (p *Server) accountPolicy(acc *Account) AccountPolicy {
+	if acc == nil {
+		return AccountPolicy{}
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return acc.Policy
+}
+
+// loadAccountPolicy 从配置表读取账号策略，不存在时返回零值。
+func (p *Server) loadAccountPolicy(accountID string) AccountPolicy {
+	var policy AccountPolicy
+	if p.store == nil {
+		return policy
+	}
+	setting, err := p.store.GetSetting(accountPolicySettingKey, "account", accountID)
+	if err != nil || setting == nil {
+		return policy
+	}
+	if b, err := json.Marshal(setting.Value); err == nil {
+		_ = json.Unmarshal(b, &policy)
+	}
+	return policy
+}
+
+// setAccountPolicy 更新内存中的账号策略并持久化。
+func (p *Server) setAccountPolicy(accountID string, policy AccountPolicy, updatedBy string) error {
+	rules, err := compileAccountPolicy(policy)
+	if err != nil {
+		return err
+	}
+	if p.store != nil {
+		id := accountID
+		desc := "账号代理密钥策略"
+		setting := &store.Setting{
+			Key:         accountPolicySettingKey,
+			Scope:       "account",
+			AccountID:   &id,
+			Value:       policy,
+			DataType:    "object",
+			Category:    "security",
+			Description: &desc,
+		}
+		if updatedBy != "" {
+			setting.UpdatedBy = &updatedBy
+		}
+		if err := p.store.UpsertSetting(setting); err != nil {
+			return err
+		}
+	}
+	p.mu.Lock()
+	if acc := p.accountByID[accountID]; acc != nil {
+		acc.Policy = policy
+		acc.rules = rules
+	}
+	p.mu.Unlock()
+	return nil
+}
+
+// validateAccountPolicy 校验策略取值并检查正则能否编译，stream_failure 与 quota_period 统一转为小写。
+func validateAccountPolicy(policy *AccountPolicy) error {
+	if mode := strings.ToLower(policy.CapMode); mode != "" && mode != outputCapClamp && mode != outputCapReject {
+		return errors.New("invalid cap_mode")
+	}
+	if policy.StreamFailure = strings.ToLower(policy.StreamFailure); !validStreamFailureMode(policy.StreamFailure) {
+		return errors.New("invalid stream_failure")
+	}
+	if policy.MaxOutputTokens < 0 || policy.MaxResponseBytes < 0 || policy.MaxRequestBytes < 0 {
+		return errors.New("limits must be non-negative")
+	}
+	if policy.RecordSampleRate < 0 || policy.RecordSampleRate > 1 {
+		return errors.New("record_sample_rate must be between 0 and 1")
+	}
+	if policy.RecordMaxBytes < 0 || policy.RecordMaxBytes > maxRecordBodyBytes {
+		return fmt.Errorf("record_max_bytes must be between 0 and %d", maxRecordBodyBytes)
+	}
+	if err := validateAllowedPaths(policy.AllowedPaths); err != nil {
+		return err
+	}
+	if policy.TokenQuota < 0 {
+		return errors.New("token_quota must be non-negative")
+	}
+	if policy.QuotaPeriod = strings.ToLower(policy.QuotaPeriod); policy.QuotaPeriod != "" && policy.QuotaPeriod != quotaPeriodDay && policy.QuotaPeriod != quotaPeriodMonth {
+		return errors.New("invalid quota_period")
+	}
+	for _, pct := range policy.QuotaWarnPct {
+		if !validQuotaThreshold(pct) {
+			return errors.New("quota_warn_pct must be between 1 and 99")
+		}
+	}
+	_, err := compileAccountPolicy(*policy)
+	return err
+}
+
+// GET/PUT /admin/api/accounts/policy?account_id=
+func (p *Server) handleAccountPolicy(w http.ResponseWriter, r *http.Request) {
+	caller := accountFromCtx(r)
+	if caller == nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		return
+	}
+	id := chooseNonEmpty(r.URL.Query().Get("account_id"), caller.ID)
+	if !canManageAccount(r.Context(), id) {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+		return
+	}
+	acc := p.getAccountByID(id)
+	if acc == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "account not found"})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, map[string]interface{}{"account_id": acc.ID, "policy": p.accountPolicy(acc)})
+	case http.MethodPut:
+		// 策略放宽的是账号自身的权限，仅管理员可修改。
+		if !isAdmin(r.Context()) {
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+			return
+		}
+		policy := p.accountPolicy(acc)
+		if err := json.NewDecoder(r.Body).Decode(&policy); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
+			return
+		}
+		if err := validateAccountPolicy(&policy); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		if err := p.setAccountPolicy(acc.ID, policy, caller.ID); err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		p.audit(acc.ID, auditActor(r), "account.policy.update", acc.ID, policy)
+		writeJSON(w, http.StatusOK, map[string]interface{}{"account_id": acc.ID, "policy": policy})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
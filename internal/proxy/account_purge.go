@@ -0,0 +1,111 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"qcc_plus/internal/store"
+)
+
+const (
+	accountPurgeChunk        = 1000 // 每条 DELETE 最多删除的行数，避免长事务与锁等待
+	accountPurgeChunksPerRun = 20   // 每执行这么多条分批删除后暂停一次，给在线请求让出数据库
+	accountPurgePause        = 10 * time.Second
+	accountPurgeAttempts     = 5
+)
+
+// accountPurgePayload account_purge 任务的参数。任务不归属账号（账号已删除），进度只推送给管理员。
+type accountPurgePayload struct {
+	PurgeID   int64  `json:"purge_id"`
+	AccountID string `json:"account_id"`
+}
+
+// enqueueAccountPurge 为 account_purge_jobs 中的清理记录创建后台任务。
+func (p *Server) enqueueAccountPurge(ctx context.Context, purge *store.AccountPurgeJob, actor string) (*store.Job, error) {
+	return p.enqueueJob(ctx, jobTypeAccountPurge, "", actor, accountPurgePayload{PurgeID: purge.ID, AccountID: purge.AccountID}, accountPurgeAttempts)
+}
+
+// accountPurgeJob 按表分批删除已删除账号的数据，进度（已处理的表数）记录在清理记录中，重跑时从中断的表继续。
+func (p *Server) accountPurgeJob(ctx context.Context, job *store.Job, progress *jobReporter) (any, error) {
+	if p.store == nil {
+		return nil, errors.New("store not enabled")
+	}
+	var req accountPurgePayload
+	if err := json.Unmarshal(job.Payload, &req); err != nil || req.PurgeID <= 0 {
+		return nil, fmt.Errorf("invalid purge payload: %s", job.Payload)
+	}
+	purge, err := p.store.GetAccountPurgeJob(ctx, req.PurgeID)
+	if err != nil {
+		return nil, err
+	}
+	if purge.Status == store.AccountPurgeFailed {
+		// 上一次尝试失败，任务重试时从失败的表继续。
+		if err := p.store.RetryAccountPurgeJob(ctx, purge.ID); err != nil && !errors.Is(err, store.ErrNotFound) {
+			return nil, err
+		}
+		if purge, err = p.store.GetAccountPurgeJob(ctx, req.PurgeID); err != nil {
+			return nil, err
+		}
+	}
+	report := func() {
+		progress.Stage(purge.CurrentTable)
+		progress.Update(int64(purge.TablesDone), int64(purge.TablesTotal))
+	}
+	report()
+	for chunks := 1; purge.Status != store.AccountPurgeDone; chunks++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if _, err := p.store.PurgeAccountChunk(ctx, purge, accountPurgeChunk); err != nil {
+			p.logger.Printf("account purge %d (%s) failed at %s: %v", purge.ID, purge.AccountID, purge.CurrentTable, err)
+			return nil, err
+		}
+		report()
+		if chunks%accountPurgeChunksPerRun == 0 && purge.Status != store.AccountPurgeDone {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(accountPurgePause):
+			}
+		}
+	}
+	p.logger.Printf("account purge %d (%s) completed, deleted: %s", purge.ID, purge.AccountID, formatTableCounts(purge.Deleted))
+	return map[string]interface{}{"purge_id": purge.ID, "account_id": purge.AccountID, "deleted": purge.Deleted}, nil
+}
+
+// resumeAccountPurges 为尚未完成、且没有对应后台任务的清理记录补建任务（升级前登记的记录或任务已被取消）。
+// 多个实例同时补建时可能重复入队，重复的任务发现记录已完成后直接结束。
+func (p *Server) resumeAccountPurges(ctx context.Context) error {
+	if p.store == nil || p.jobs == nil {
+		return nil
+	}
+	purges, err := p.store.ListUnfinishedAccountPurgeJobs(ctx)
+	if err != nil || len(purges) == 0 {
+		return err
+	}
+	queued := map[int64]bool{}
+	for _, status := range []string{store.JobPending, store.JobRunning} {
+		jobs, err := p.jobs.queue.ListJobs(ctx, store.JobFilter{Type: jobTypeAccountPurge, Status: status, Limit: 500})
+		if err != nil {
+			return err
+		}
+		for _, j := range jobs {
+			var req accountPurgePayload
+			if json.Unmarshal(j.Payload, &req) == nil {
+				queued[req.PurgeID] = true
+			}
+		}
+	}
+	for i := range purges {
+		if queued[purges[i].ID] {
+			continue
+		}
+		if _, err := p.enqueueAccountPurge(ctx, &purges[i], auditActorSystem); err != nil {
+			return err
+		}
+	}
+	return nil
+}
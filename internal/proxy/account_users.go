@@ -0,0 +1,304 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"qcc_plus/internal/store"
+)
+
+const accountUsersSettingKey = "account.users"
+
+// 账号成员角色。以账号名称与账号密码登录的视为 owner。
+const (
+	roleOwner  = "owner"
+	roleAdmin  = "admin"  // 可管理账号与邀请成员；账号为管理员账号时同样具备系统管理权限
+	roleMember = "member" // 可管理本账号的节点与配置
+	roleViewer = "viewer" // 只读
+)
+
+func validMemberRole(role string) bool {
+	switch role {
+	case roleAdmin, roleMember, roleViewer:
+		return true
+	}
+	return false
+}
+
+// AccountUser 账号下通过邀请加入的登录用户，口令仅保存哈希。
+type AccountUser struct {
+	ID           string       `json:"id"`
+	Name         string       `json:"name"`
+	Email        string       `json:"email,omitempty"`
+	Role         string       `json:"role"`
+	PasswordHash string       `json:"password_hash"`
+	PasswordMeta passwordMeta `json:"password_meta"`
+	InvitedBy    string       `json:"invited_by,omitempty"`
+	CreatedAt    time.Time    `json:"created_at"`
+}
+
+// changePassword 按口令策略修改成员口令并记录历史。
+func (u *AccountUser) changePassword(password string, policy passwordPolicy) error {
+	if err := policy.validate(password); err != nil {
+		return err
+	}
+	if policy.History > 0 && (checkPassword(u.PasswordHash, password) || u.PasswordMeta.reused(password, policy.History)) {
+		return errPasswordReused
+	}
+	old := u.PasswordHash
+	u.PasswordHash = hashPassword(password)
+	u.PasswordMeta.record(old, policy.History, time.Now().UTC())
+	return nil
+}
+
+// sessionUser 会话对应的账号成员，账号本身登录时为 nil。
+type sessionUser struct {
+	ID   string
+	Name string
+	Role string
+}
+
+type sessionUserContextKey struct{}
+
+func sessionUserFromCtx(ctx context.Context) *sessionUser {
+	if ctx == nil {
+		return nil
+	}
+	u, _ := ctx.Value(sessionUserContextKey{}).(*sessionUser)
+	return u
+}
+
+// sessionRole 返回当前会话的成员角色，账号本身登录或 API Key 鉴权时为 owner。
+func sessionRole(ctx context.Context) string {
+	if u := sessionUserFromCtx(ctx); u != nil {
+		return u.Role
+	}
+	return roleOwner
+}
+
+// canAdministerAccount 判断调用方能否管理账号成员：需可管理该账号且角色为 owner/admin。
+func canAdministerAccount(ctx context.Context, accountID string) bool {
+	if !canManageAccount(ctx, accountID) {
+		return false
+	}
+	if isAdmin(ctx) {
+		return true
+	}
+	role := sessionRole(ctx)
+	return role == roleOwner || role == roleAdmin
+}
+
+func (p *Server) loadAccountUsers(accountID string) []AccountUser {
+	var list []AccountUser
+	if p.store == nil {
+		return list
+	}
+	setting, err := p.store.GetSetting(accountUsersSettingKey, "account", accountID)
+	if err != nil || setting == nil {
+		return list
+	}
+	if b, err := json.Marshal(setting.Value); err == nil {
+		_ = json.Unmarshal(b, &list)
+	}
+	return list
+}
+
+func (p *Server) persistAccountUsers(accountID string, list []AccountUser, updatedBy string) error {
+	if p.store == nil {
+		return nil
+	}
+	id := accountID
+	desc := "账号成员（仅保存口令哈希）"
+	setting := &store.Setting{
+		Key:         accountUsersSettingKey,
+		Scope:       "account",
+		AccountID:   &id,
+		Value:       list,
+		DataType:    "array",
+		Category:    "security",
+		Description: &desc,
+		IsSecret:    true,
+	}
+	if updatedBy != "" {
+		setting.UpdatedBy = &updatedBy
+	}
+	return p.store.UpsertSetting(setting)
+}
+
+// loginNameTakenLocked 判断登录名是否已被账号或成员占用，调用方需持有 p.mu。
+func (p *Server) loginNameTakenLocked(name string) bool {
+	for _, acc := range p.accountByID {
+		if acc.Name == name {
+			return true
+		}
+		for _, u := range acc.Users {
+			if u.Name == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// findAccountUser 按登录名查找账号成员。
+func (p *Server) findAccountUser(name string) (*Account, AccountUser, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	for _, acc := range p.accountByID {
+		for _, u := range acc.Users {
+			if u.Name == name {
+				return acc, u, true
+			}
+		}
+	}
+	return nil, AccountUser{}, false
+}
+
+// createUserSession 为账号成员创建会话：viewer/member 不具备系统管理权限。
+func (p *Server) createUserSession(acc *Account, user AccountUser) *Session {
+	sess := p.sessionMgr.Create(acc.ID, acc.IsAdmin && user.Role == roleAdmin)
+	if sess != nil {
+		sess.UserID, sess.UserName, sess.Role = user.ID, user.Name, user.Role
+		p.sessionMgr.Save(sess)
+	}
+	return sess
+}
+
+var errUserNotFound = errors.New("user not found")
+
+func accountUserView(u AccountUser) map[string]interface{} {
+	return map[string]interface{}{
+		"id":         u.ID,
+		"name":       u.Name,
+		"email":      u.Email,
+		"role":       u.Role,
+		"invited_by": u.InvitedBy,
+		"created_at": u.CreatedAt,
+	}
+}
+
+// GET /api/accounts/:id/users、DELETE /api/accounts/:id/users/:user_id
+func (p *Server) handleAccountUsers(w http.ResponseWriter, r *http.Request, acc *Account, userID string) {
+	switch {
+	case r.Method == http.MethodGet && userID == "":
+		p.mu.RLock()
+		list := make([]map[string]interface{}, 0, len(acc.Users))
+		for _, u := range acc.Users {
+			list = append(list, accountUserView(u))
+		}
+		p.mu.RUnlock()
+		writeJSON(w, http.StatusOK, map[string]interface{}{"account_id": acc.ID, "users": list})
+	case r.Method == http.MethodDelete && userID != "":
+		if !canAdministerAccount(r.Context(), acc.ID) {
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+			return
+		}
+		p.mu.Lock()
+		list := append([]AccountUser(nil), acc.Users...)
+		idx := -1
+		for i := range list {
+			if list[i].ID == userID {
+				idx = i
+				break
+			}
+		}
+		if idx < 0 {
+			p.mu.Unlock()
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": errUserNotFound.Error()})
+			return
+		}
+		list = append(list[:idx], list[idx+1:]...)
+		acc.Users = list
+		p.mu.Unlock()
+		if err := p.persistAccountUsers(acc.ID, list, auditActor(r)); err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		p.sessionMgr.DeleteUser(userID)
+		p.emitAuthEvent(r, authEventSessionRevoke, "success", acc.ID, userID, "user_deleted")
+		p.audit(acc.ID, auditActor(r), "account.user.delete", userID, nil)
+		writeJSON(w, http.StatusOK, map[string]string{"deleted": userID})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// handleAccountAPIRoutes 分发 /api/accounts/:id/ 下的子路由。
+func (p *Server) handleAccountAPIRoutes(w http.ResponseWriter, r *http.Request) {
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/accounts/"), "/")
+	parts := strings.Split(rest, "/")
+	if len(parts) < 2 || parts[0] == "" {
+		http.NotFound(w, r)
+		return
+	}
+	if parts[1] == "metrics" && len(parts) == 2 {
+		p.handleGetAccountMetrics(w, r)
+		return
+	}
+	if parts[1] == "export" {
+		acc := p.getAccountByID(parts[0])
+		if acc == nil {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "account not found"})
+			return
+		}
+		p.handleAccountExport(w, r, acc, parts[2:])
+		return
+	}
+	if parts[1] == "webhook-secret" && len(parts) == 2 {
+		acc := p.getAccountByID(parts[0])
+		if acc == nil {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "account not found"})
+			return
+		}
+		p.handleAccountWebhookSecret(w, r, acc)
+		return
+	}
+	if parts[1] == "recording" && len(parts) == 2 {
+		acc := p.getAccountByID(parts[0])
+		if acc == nil {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "account not found"})
+			return
+		}
+		p.handleAccountRecording(w, r, acc)
+		return
+	}
+	if parts[1] == "node-hooks" && len(parts) <= 3 {
+		acc := p.getAccountByID(parts[0])
+		if acc == nil {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "account not found"})
+			return
+		}
+		hookID := ""
+		if len(parts) == 3 {
+			hookID = parts[2]
+		}
+		p.handleAccountNodeHooks(w, r, acc, hookID)
+		return
+	}
+	if len(parts) > 3 || (parts[1] != "users" && parts[1] != "invitations") {
+		http.NotFound(w, r)
+		return
+	}
+	if !canManageAccount(r.Context(), parts[0]) {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+		return
+	}
+	acc := p.getAccountByID(parts[0])
+	if acc == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "account not found"})
+		return
+	}
+	sub := ""
+	if len(parts) == 3 {
+		sub = parts[2]
+	}
+	if parts[1] == "users" {
+		p.handleAccountUsers(w, r, acc, sub)
+	} else {
+		p.handleAccountInvitations(w, r, acc, sub)
+	}
+}
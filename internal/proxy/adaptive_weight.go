@@ -0,0 +1,246 @@
+package proxy
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	defaultAdaptiveWeightInterval = time.Minute
+	adaptiveWeightMinSamples      = 20
+	// 评分低于中位数该比例时提升优先级，高于倒数比例时降低优先级。
+	adaptiveWeightBand = 0.8
+)
+
+// AdaptiveWeightScheduler 根据近期 p95 延迟与错误率周期性微调节点的运行时权重。
+// 调整结果只保存在 Node.AdaptiveWeight 中，不覆盖也不持久化用户配置的 Weight；
+// 由设置项 routing.adaptive_weight.* 控制，默认关闭，关闭后运行时权重随即清除。
+type AdaptiveWeightScheduler struct {
+	server   *Server
+	logger   *log.Logger
+	stopCh   chan struct{}
+	wg       sync.WaitGroup
+	stopOnce sync.Once
+}
+
+// NewAdaptiveWeightScheduler 创建自适应权重调度器。
+func NewAdaptiveWeightScheduler(server *Server, logger *log.Logger) *AdaptiveWeightScheduler {
+	if logger == nil {
+		logger = log.Default()
+	}
+	return &AdaptiveWeightScheduler{server: server, logger: logger, stopCh: make(chan struct{})}
+}
+
+// Start 启动调度循环；是否真正调整由每轮读取的设置决定。
+func (a *AdaptiveWeightScheduler) Start() error {
+	if a == nil || a.server == nil {
+		return nil
+	}
+	a.wg.Add(1)
+	go a.loop()
+	return nil
+}
+
+// Stop 发出停止信号并等待退出。
+func (a *AdaptiveWeightScheduler) Stop() {
+	if a == nil {
+		return
+	}
+	a.stopOnce.Do(func() {
+		close(a.stopCh)
+	})
+	a.wg.Wait()
+}
+
+func (a *AdaptiveWeightScheduler) settings() (enabled bool, interval time.Duration, minW, maxW int) {
+	interval = defaultAdaptiveWeightInterval
+	minW, maxW = 1, 10
+	cache := a.server.settingsCache
+	if cache == nil {
+		return false, interval, minW, maxW
+	}
+	enabled = cache.GetBool("routing.adaptive_weight.enabled", false)
+	if sec := cache.GetInt("routing.adaptive_weight.interval_sec", 0); sec > 0 {
+		interval = time.Duration(sec) * time.Second
+	}
+	minW = cache.GetInt("routing.adaptive_weight.min", minW)
+	maxW = cache.GetInt("routing.adaptive_weight.max", maxW)
+	if minW < 1 {
+		minW = 1
+	}
+	if maxW < minW {
+		maxW = minW
+	}
+	return enabled, interval, minW, maxW
+}
+
+func (a *AdaptiveWeightScheduler) loop() {
+	defer a.wg.Done()
+	defer func() {
+		if r := recover(); r != nil {
+			a.logger.Printf("[AdaptiveWeight] panic recovered: %v", r)
+		}
+	}()
+
+	_, interval, _, _ := a.settings()
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+	for {
+		select {
+		case <-a.stopCh:
+			return
+		case <-timer.C:
+			enabled, next, minW, maxW := a.settings()
+			switch {
+			case !enabled:
+				a.server.resetAdaptiveWeights()
+			case !a.server.maintenanceActive():
+				a.adjustAll(minW, maxW)
+			}
+			timer.Reset(next)
+		}
+	}
+}
+
+type adaptiveCandidate struct {
+	id        string
+	weight    int
+	samples   int
+	p95       time.Duration
+	errorRate float64
+	score     float64
+}
+
+// adjustAll 遍历账号，按相对评分将节点运行时权重 ±1（限制在 [minW, maxW]）。
+func (a *AdaptiveWeightScheduler) adjustAll(minW, maxW int) {
+	p := a.server
+	p.mu.RLock()
+	accs := make([]*Account, 0, len(p.accountByID))
+	for _, acc := range p.accountByID {
+		accs = append(accs, acc)
+	}
+	p.mu.RUnlock()
+
+	for _, acc := range accs {
+		p.mu.RLock()
+		var cands []adaptiveCandidate
+		for id, n := range acc.Nodes {
+			if !nodeRoutable(n) {
+				continue
+			}
+			cands = append(cands, adaptiveCandidate{id: id, weight: routingWeight(n)})
+		}
+		p.mu.RUnlock()
+
+		scored := cands[:0]
+		for _, c := range cands {
+			c.samples, c.p95, c.errorRate = p.nodeLatencyStats(c.id)
+			if c.samples < adaptiveWeightMinSamples || c.p95 <= 0 {
+				continue
+			}
+			// 错误率按 10 倍放大计入评分，避免快速但频繁出错的节点被优先。
+			c.score = float64(c.p95.Milliseconds()) * (1 + 10*c.errorRate)
+			scored = append(scored, c)
+		}
+		if len(scored) < 2 {
+			continue
+		}
+		scores := make([]float64, len(scored))
+		for i, c := range scored {
+			scores[i] = c.score
+		}
+		sort.Float64s(scores)
+		median := scores[len(scores)/2]
+		if len(scores)%2 == 0 {
+			median = (scores[len(scores)/2-1] + scores[len(scores)/2]) / 2
+		}
+		if median <= 0 {
+			continue
+		}
+
+		for _, c := range scored {
+			target := c.weight
+			switch {
+			case c.score < median*adaptiveWeightBand:
+				target--
+			case c.score > median/adaptiveWeightBand:
+				target++
+			}
+			if target < minW {
+				target = minW
+			}
+			if target > maxW {
+				target = maxW
+			}
+			if target == c.weight {
+				continue
+			}
+			if err := p.adjustNodeWeight(c.id, target); err != nil {
+				a.logger.Printf("[AdaptiveWeight] adjust node %s failed: %v", c.id, err)
+				continue
+			}
+			a.logger.Printf("[AdaptiveWeight] node %s weight %d -> %d (p95=%dms error_rate=%.2f score=%.1f median=%.1f)",
+				c.id, c.weight, target, c.p95.Milliseconds(), c.errorRate, c.score, median)
+			p.audit(acc.ID, "adaptive-weight", "node.weight.adjust", c.id, map[string]interface{}{
+				"from":       c.weight,
+				"to":         target,
+				"p95_ms":     c.p95.Milliseconds(),
+				"error_rate": c.errorRate,
+				"samples":    c.samples,
+				"score":      c.score,
+				"median":     median,
+			})
+		}
+	}
+}
+
+// adjustNodeWeight 仅调整节点的运行时权重（不写回 nodes.weight、不发送节点更新通知），
+// 并按新权重重选活跃节点；与配置权重相同时清除运行时权重。
+func (p *Server) adjustNodeWeight(id string, weight int) error {
+	p.mu.Lock()
+	n, ok := p.nodeIndex[id]
+	if !ok {
+		p.mu.Unlock()
+		return fmt.Errorf("node %s not found", id)
+	}
+	if weight == n.Weight {
+		weight = 0
+	}
+	n.AdaptiveWeight = weight
+	acc := p.nodeAccount[id]
+	p.mu.Unlock()
+
+	p.markNodeChanged(id)
+	if acc != nil {
+		_, _ = p.selectBestAndActivate(acc, "自适应权重")
+	}
+	return nil
+}
+
+// resetAdaptiveWeights 清除全部节点的运行时权重，恢复按配置权重路由（自适应关闭时调用）。
+func (p *Server) resetAdaptiveWeights() {
+	p.mu.Lock()
+	var changed []string
+	accs := make(map[string]*Account)
+	for id, n := range p.nodeIndex {
+		if n.AdaptiveWeight == 0 {
+			continue
+		}
+		n.AdaptiveWeight = 0
+		changed = append(changed, id)
+		if acc := p.nodeAccount[id]; acc != nil {
+			accs[acc.ID] = acc
+		}
+	}
+	p.mu.Unlock()
+
+	for _, id := range changed {
+		p.markNodeChanged(id)
+	}
+	for _, acc := range accs {
+		_, _ = p.selectBestAndActivate(acc, "自适应权重关闭")
+	}
+}
@@ -0,0 +1,21 @@
+package proxy
+
+import "net/http"
+
+// GET /api/admin/config
+// 返回生效的启动级配置（环境变量 > 配置文件 > 默认值）及各项来源，密钥已脱敏。
+func (p *Server) handleAdminBootstrapConfig(w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(r.Context()) {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if p.bootstrap == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "bootstrap config not recorded"})
+		return
+	}
+	writeJSON(w, http.StatusOK, p.bootstrap.Masked())
+}
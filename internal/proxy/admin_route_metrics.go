@@ -0,0 +1,250 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const maxAdminRoutes = 200 // 超出后的新路由计入 other，避免路径未归一化时指标无限增长
+
+// adminRouteBuckets 管理面请求耗时直方图的桶上界（秒），与 Prometheus 默认桶一致。
+var adminRouteBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// adminRouteCollections 路径中其后一段为资源 ID 的集合名，如 /api/nodes/:id/metrics。
+var adminRouteCollections = map[string]bool{
+	"nodes": true, "accounts": true, "incidents": true, "alerts": true, "shares": true, "share": true,
+	"users": true, "invitations": true, "scheduled": true, "settings": true, "requests": true, "export": true,
+}
+
+// adminRouteStatic 紧跟集合名但并非资源 ID 的固定路径段。
+var adminRouteStatic = map[string]bool{
+	"changes": true, "import": true, "template": true, "batch": true, "version": true, "diff": true,
+	"validate": true, "scheduled": true, "shares": true, "accept": true, "order": true,
+	"display": true, "key": true, "policy": true, "purge-jobs": true, "service-accounts": true,
+	"activate": true, "disable": true, "drain": true, "enable": true, "export": true, "download": true,
+}
+
+// adminRouteKey 按方法与归一化后的路由聚合。
+type adminRouteKey struct {
+	method string
+	route  string
+}
+
+type adminRouteStat struct {
+	count   int64
+	classes [6]int64 // 按状态码首位统计，下标 1-5 对应 1xx-5xx
+	sum     time.Duration
+	max     time.Duration
+	buckets []int64 // 与 adminRouteBuckets 对应的累计计数
+}
+
+// adminRouteMetrics 管理面 HTTP 接口自身的耗时与状态码统计，与上游节点指标相互独立。
+type adminRouteMetrics struct {
+	mu     sync.Mutex
+	routes map[adminRouteKey]*adminRouteStat
+}
+
+// normalizeAdminRoute 将路径中的资源 ID 替换为 :id，如 /api/nodes/n1/metrics -> /api/nodes/:id/metrics。
+func normalizeAdminRoute(path string) string {
+	segs := strings.Split(strings.Trim(path, "/"), "/")
+	for i := 1; i < len(segs); i++ {
+		if adminRouteCollections[segs[i-1]] && !adminRouteStatic[segs[i]] && segs[i] != "" {
+			segs[i] = ":id"
+		}
+	}
+	return "/" + strings.Join(segs, "/")
+}
+
+func (m *adminRouteMetrics) observe(method, route string, status int, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.routes == nil {
+		m.routes = make(map[adminRouteKey]*adminRouteStat)
+	}
+	key := adminRouteKey{method: method, route: route}
+	st := m.routes[key]
+	if st == nil {
+		if len(m.routes) >= maxAdminRoutes {
+			key.route = "other"
+			st = m.routes[key]
+		}
+		if st == nil {
+			st = &adminRouteStat{buckets: make([]int64, len(adminRouteBuckets))}
+			m.routes[key] = st
+		}
+	}
+	st.count++
+	if c := status / 100; c >= 1 && c <= 5 {
+		st.classes[c]++
+	}
+	st.sum += d
+	if d > st.max {
+		st.max = d
+	}
+	secs := d.Seconds()
+	for i, b := range adminRouteBuckets {
+		if secs <= b {
+			st.buckets[i]++
+		}
+	}
+}
+
+// quantile 按直方图估算分位耗时，落在最后一个桶之外时返回最大耗时。
+func (st *adminRouteStat) quantile(q float64) time.Duration {
+	if st.count == 0 {
+		return 0
+	}
+	target := int64(float64(st.count)*q + 0.5)
+	if target < 1 {
+		target = 1
+	}
+	for i, n := range st.buckets {
+		if n >= target {
+			return time.Duration(adminRouteBuckets[i] * float64(time.Second))
+		}
+	}
+	return st.max
+}
+
+type adminRouteSnapshot struct {
+	key adminRouteKey
+	st  adminRouteStat
+}
+
+func (m *adminRouteMetrics) snapshot() []adminRouteSnapshot {
+	m.mu.Lock()
+	out := make([]adminRouteSnapshot, 0, len(m.routes))
+	for k, st := range m.routes {
+		cp := *st
+		cp.buckets = append([]int64(nil), st.buckets...)
+		out = append(out, adminRouteSnapshot{key: k, st: cp})
+	}
+	m.mu.Unlock()
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].key.route != out[j].key.route {
+			return out[i].key.route < out[j].key.route
+		}
+		return out[i].key.method < out[j].key.method
+	})
+	return out
+}
+
+// view 供 /api/admin/stats 展示，按 p95 耗时降序，便于发现变慢的接口。
+func (m *adminRouteMetrics) view() []map[string]interface{} {
+	snaps := m.snapshot()
+	sort.SliceStable(snaps, func(i, j int) bool { return snaps[i].st.quantile(0.95) > snaps[j].st.quantile(0.95) })
+	list := make([]map[string]interface{}, 0, len(snaps))
+	for _, s := range snaps {
+		avg := time.Duration(0)
+		if s.st.count > 0 {
+			avg = s.st.sum / time.Duration(s.st.count)
+		}
+		list = append(list, map[string]interface{}{
+			"method":     s.key.method,
+			"route":      s.key.route,
+			"count":      s.st.count,
+			"status_2xx": s.st.classes[2],
+			"status_3xx": s.st.classes[3],
+			"status_4xx": s.st.classes[4],
+			"status_5xx": s.st.classes[5],
+			"avg_ms":     avg.Milliseconds(),
+			"p95_ms":     s.st.quantile(0.95).Milliseconds(),
+			"max_ms":     s.st.max.Milliseconds(),
+		})
+	}
+	return list
+}
+
+// writePrometheus 以 Prometheus 文本格式输出管理面路由指标。
+func (m *adminRouteMetrics) writePrometheus(w *strings.Builder) {
+	snaps := m.snapshot()
+	w.WriteString("# HELP qcc_admin_http_requests_total Admin API requests by route and status class.\n")
+	w.WriteString("# TYPE qcc_admin_http_requests_total counter\n")
+	for _, s := range snaps {
+		for c := 1; c <= 5; c++ {
+			if s.st.classes[c] == 0 {
+				continue
+			}
+			fmt.Fprintf(w, "qcc_admin_http_requests_total{method=%q,route=%q,code=\"%dxx\"} %d\n", s.key.method, s.key.route, c, s.st.classes[c])
+		}
+	}
+	w.WriteString("# HELP qcc_admin_http_request_duration_seconds Admin API request latency by route.\n")
+	w.WriteString("# TYPE qcc_admin_http_request_duration_seconds histogram\n")
+	for _, s := range snaps {
+		labels := fmt.Sprintf("method=%q,route=%q", s.key.method, s.key.route)
+		for i, b := range adminRouteBuckets {
+			fmt.Fprintf(w, "qcc_admin_http_request_duration_seconds_bucket{%s,le=\"%g\"} %d\n", labels, b, s.st.buckets[i])
+		}
+		fmt.Fprintf(w, "qcc_admin_http_request_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels, s.st.count)
+		fmt.Fprintf(w, "qcc_admin_http_request_duration_seconds_sum{%s} %g\n", labels, s.st.sum.Seconds())
+		fmt.Fprintf(w, "qcc_admin_http_request_duration_seconds_count{%s} %d\n", labels, s.st.count)
+	}
+}
+
+// adminRouteWriter 记录管理面响应的状态码。
+type adminRouteWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *adminRouteWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *adminRouteWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *adminRouteWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *adminRouteWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// serveAdminRoute 执行管理面处理器并记录耗时；WebSocket 等长连接不计入。
+func (p *Server) serveAdminRoute(h http.Handler, w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Path
+	if (!strings.HasPrefix(path, "/api/") && !strings.HasPrefix(path, "/admin/api/")) || r.Header.Get("Upgrade") != "" {
+		h.ServeHTTP(w, r)
+		return
+	}
+	start := time.Now()
+	rw := &adminRouteWriter{ResponseWriter: w}
+	h.ServeHTTP(rw, r)
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+	p.adminRoutes.observe(r.Method, normalizeAdminRoute(path), rw.status, time.Since(start))
+}
+
+// GET /api/admin/prometheus
+// 以 Prometheus 文本格式输出管理面路由指标，支持 x-admin-key 头或 admin_key 查询参数鉴权，便于抓取。
+func (p *Server) handleAdminPrometheus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if !isAdmin(r.Context()) {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+		return
+	}
+	var sb strings.Builder
+	p.adminRoutes.writePrometheus(&sb)
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte(sb.String()))
+}
@@ -0,0 +1,260 @@
+package proxy
+
+import (
+	"container/list"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// conversationHeader 客户端携带的会话 ID，同一会话尽量路由到同一节点以提高上游 KV 缓存命中率。
+	conversationHeader          = "X-QCC-Conversation"
+	maxConversationIDLen        = 128
+	defaultAffinityTTL          = 30 * time.Minute
+	defaultAffinityMaxEntries   = 10000
+	affinityAccountKeySeparator = "|"
+)
+
+type affinityEntry struct {
+	key       string
+	accountID string
+	nodeID    string
+	expiresAt time.Time
+}
+
+// affinityCache 有界的会话 → 节点映射，按 LRU 淘汰并带 TTL。
+type affinityCache struct {
+	mu        sync.Mutex
+	entries   map[string]*list.Element
+	order     *list.List // 队首为最近使用
+	hits      int64
+	misses    int64
+	evictions int64
+	expired   int64
+}
+
+func newAffinityCache() *affinityCache {
+	return &affinityCache{entries: make(map[string]*list.Element), order: list.New()}
+}
+
+func affinityKey(accountID, conversationID string) string {
+	return accountID + affinityAccountKeySeparator + conversationID
+}
+
+// get 返回会话绑定的节点；过期条目会被移除。
+func (c *affinityCache) get(accountID, conversationID string, now time.Time) (string, bool) {
+	key := affinityKey(accountID, conversationID)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		c.misses++
+		return "", false
+	}
+	e := el.Value.(*affinityEntry)
+	if now.After(e.expiresAt) {
+		c.removeLocked(el)
+		c.expired++
+		c.misses++
+		return "", false
+	}
+	c.hits++
+	c.order.MoveToFront(el)
+	return e.nodeID, true
+}
+
+// peek 只读查看会话绑定的节点，不计入命中统计、不调整 LRU 顺序，也不移除过期条目，供路由推演使用。
+func (c *affinityCache) peek(accountID, conversationID string, now time.Time) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[affinityKey(accountID, conversationID)]
+	if !ok {
+		return "", false
+	}
+	e := el.Value.(*affinityEntry)
+	if now.After(e.expiresAt) {
+		return "", false
+	}
+	return e.nodeID, true
+}
+
+// set 绑定会话到节点并刷新 TTL，超出容量时淘汰最久未使用的条目。
+func (c *affinityCache) set(accountID, conversationID, nodeID string, now time.Time, ttl time.Duration, max int) {
+	key := affinityKey(accountID, conversationID)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[key]; ok {
+		e := el.Value.(*affinityEntry)
+		e.nodeID = nodeID
+		e.expiresAt = now.Add(ttl)
+		c.order.MoveToFront(el)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&affinityEntry{key: key, accountID: accountID, nodeID: nodeID, expiresAt: now.Add(ttl)})
+	for max > 0 && c.order.Len() > max {
+		c.removeLocked(c.order.Back())
+		c.evictions++
+	}
+}
+
+// forget 解除会话绑定。
+func (c *affinityCache) forget(accountID, conversationID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[affinityKey(accountID, conversationID)]; ok {
+		c.removeLocked(el)
+	}
+}
+
+// flush 清空指定账号（为空时清空全部）的绑定，返回移除条数。
+func (c *affinityCache) flush(accountID string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	removed := 0
+	for el := c.order.Front(); el != nil; {
+		next := el.Next()
+		if accountID == "" || el.Value.(*affinityEntry).accountID == accountID {
+			c.removeLocked(el)
+			removed++
+		}
+		el = next
+	}
+	return removed
+}
+
+func (c *affinityCache) removeLocked(el *list.Element) {
+	e := el.Value.(*affinityEntry)
+	delete(c.entries, e.key)
+	c.order.Remove(el)
+}
+
+// affinityStats 缓存统计快照。
+type affinityStats struct {
+	Enabled    bool    `json:"enabled"`
+	Entries    int     `json:"entries"`
+	MaxEntries int     `json:"max_entries"`
+	TTLSec     int     `json:"ttl_sec"`
+	Hits       int64   `json:"hits"`
+	Misses     int64   `json:"misses"`
+	HitRate    float64 `json:"hit_rate"`
+	Evictions  int64   `json:"evictions"`
+	Expired    int64   `json:"expired"`
+}
+
+func (c *affinityCache) stats(accountID string) affinityStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	st := affinityStats{Hits: c.hits, Misses: c.misses, Evictions: c.evictions, Expired: c.expired}
+	if accountID == "" {
+		st.Entries = c.order.Len()
+	} else {
+		for el := c.order.Front(); el != nil; el = el.Next() {
+			if el.Value.(*affinityEntry).accountID == accountID {
+				st.Entries++
+			}
+		}
+	}
+	if total := st.Hits + st.Misses; total > 0 {
+		st.HitRate = float64(st.Hits) / float64(total)
+	}
+	return st
+}
+
+// affinitySettings 返回会话亲和是否开启、TTL 与容量上限。
+func (p *Server) affinitySettings() (bool, time.Duration, int) {
+	ttl, max := defaultAffinityTTL, defaultAffinityMaxEntries
+	if p.settingsCache == nil {
+		return true, ttl, max
+	}
+	enabled := p.settingsCache.GetBool("routing.affinity.enabled", true)
+	if sec := p.settingsCache.GetInt("routing.affinity.ttl_sec", 0); sec > 0 {
+		ttl = time.Duration(sec) * time.Second
+	}
+	if n := p.settingsCache.GetInt("routing.affinity.max_entries", 0); n > 0 {
+		max = n
+	}
+	return enabled, ttl, max
+}
+
+// conversationID 读取请求携带的会话 ID，超长时忽略。
+func conversationID(r *http.Request) string {
+	id := strings.TrimSpace(r.Header.Get(conversationHeader))
+	if len(id) > maxConversationIDLen {
+		return ""
+	}
+	return id
+}
+
+// affinityNode 返回会话已绑定且仍可路由的节点。
+func (p *Server) affinityNode(acc *Account, convID string) *Node {
+	if convID == "" || p.affinity == nil {
+		return nil
+	}
+	if enabled, _, _ := p.affinitySettings(); !enabled {
+		return nil
+	}
+	nodeID, ok := p.affinity.get(acc.ID, convID, time.Now())
+	if !ok {
+		return nil
+	}
+	p.mu.RLock()
+	n := acc.Nodes[nodeID]
+	routable := n != nil && nodeRoutable(n)
+	p.mu.RUnlock()
+	if !routable {
+		p.affinity.forget(acc.ID, convID)
+		return nil
+	}
+	return n
+}
+
+// rememberAffinity 请求成功后绑定会话到实际服务的节点，失败则解除绑定。
+func (p *Server) rememberAffinity(acc *Account, convID, nodeID string, ok bool) {
+	if convID == "" || p.affinity == nil {
+		return
+	}
+	enabled, ttl, max := p.affinitySettings()
+	if !enabled {
+		return
+	}
+	if !ok {
+		p.affinity.forget(acc.ID, convID)
+		return
+	}
+	p.affinity.set(acc.ID, convID, nodeID, time.Now(), ttl, max)
+}
+
+// GET /api/routing/affinity 返回会话亲和缓存统计（非管理员仅统计本账号条目）；
+// DELETE /api/routing/affinity?account_id= 清空绑定。
+func (p *Server) handleAffinity(w http.ResponseWriter, r *http.Request) {
+	caller := accountFromCtx(r)
+	if caller == nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		return
+	}
+	accountID := r.URL.Query().Get("account_id")
+	if !isAdmin(r.Context()) {
+		if accountID != "" && accountID != caller.ID {
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+			return
+		}
+		accountID = caller.ID
+	}
+	switch r.Method {
+	case http.MethodGet:
+		st := p.affinity.stats(accountID)
+		enabled, ttl, max := p.affinitySettings()
+		st.Enabled = enabled
+		st.TTLSec = int(ttl / time.Second)
+		st.MaxEntries = max
+		writeJSON(w, http.StatusOK, st)
+	case http.MethodDelete:
+		removed := p.affinity.flush(accountID)
+		p.audit(chooseNonEmpty(accountID, caller.ID), caller.ID, "routing.affinity.flush", accountID, map[string]int{"removed": removed})
+		writeJSON(w, http.StatusOK, map[string]int{"removed": removed})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,155 @@
+package proxy
+
+import (
+	"context"
+	"time"
+
+	"qcc_plus/internal/store"
+)
+
+const (
+	defaultConsistencyInterval  = 6 * time.Hour
+	consistencyHourlyLookback   = 24 * time.Hour
+	consistencyDailyLookback    = 7 * 24 * time.Hour
+	consistencyMaxLoggedBuckets = 10
+
+	settingConsistencySelfHeal = "metrics.consistency_self_heal"
+)
+
+// consistencyReport 一次聚合一致性检查的结果。
+type consistencyReport struct {
+	schedulerRun
+	SelfHeal   bool
+	Mismatches []store.AggregateMismatch
+	Healed     map[string]int // 粒度 -> 重新聚合的桶数
+}
+
+// consistencyWindows 返回检查窗口：原始→小时比较最近 24 小时中已完成且至少被聚合过一次的小时，
+// 小时→天比较最近 7 天中已被聚合的天（当天与刚结束、仍在等待最后几个小时聚合的前一天除外）。
+func consistencyWindows(now time.Time) (hourFrom, hourTo, dayFrom, dayTo time.Time) {
+	hourTo = now.Truncate(time.Hour).Add(-time.Hour)
+	hourFrom = hourTo.Add(-consistencyHourlyLookback)
+	dayTo = startOfDay(now.Add(-2 * time.Hour))
+	dayFrom = dayTo.Add(-consistencyDailyLookback)
+	return
+}
+
+func (m *MetricsScheduler) consistencyLoop() {
+	defer m.wg.Done()
+	defer m.recoverPanic("consistency check loop")
+
+	ticker := time.NewTicker(m.consistencyInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.stopCh:
+			return
+		case <-ticker.C:
+			if !m.isPaused() {
+				m.runConsistencyCheck()
+			}
+		}
+	}
+}
+
+// consistencySelfHeal 读取 metrics.consistency_self_heal，开启后自动重新聚合不一致的桶。
+func (m *MetricsScheduler) consistencySelfHeal() bool {
+	setting, err := m.store.GetSetting(settingConsistencySelfHeal, "system", "")
+	if err != nil || setting == nil {
+		return false
+	}
+	b, _ := setting.Value.(bool)
+	return b
+}
+
+// runConsistencyCheck 比较原始与小时、小时与天两级汇总的请求数、token 数与字节数，记录不一致的桶，
+// 开启自愈时重建这些桶以及受影响的上层桶。与聚合共用运行锁。
+func (m *MetricsScheduler) runConsistencyCheck() {
+	unlock, ok := m.tryLockAggregation()
+	if !ok {
+		m.logger.Printf("[MetricsScheduler] Aggregation in progress, skipping consistency check")
+		return
+	}
+	defer unlock()
+
+	start := time.Now()
+	ctx, cancel := m.taskContext(4 * m.store.Timeouts().Aggregate)
+	defer cancel()
+	report := &consistencyReport{schedulerRun: schedulerRun{StartedAt: start}, SelfHeal: m.consistencySelfHeal()}
+	err := m.checkConsistency(ctx, start.UTC(), report)
+	report.Duration = time.Since(start)
+	switch {
+	case err != nil:
+		report.Err = err.Error()
+		m.logger.Printf("[MetricsScheduler] Consistency check failed: %v", err)
+	case len(report.Mismatches) > 0:
+		for i, mm := range report.Mismatches {
+			if i == consistencyMaxLoggedBuckets {
+				m.logger.Printf("[MetricsScheduler] ... and %d more mismatched buckets", len(report.Mismatches)-i)
+				break
+			}
+			m.logger.Printf("[MetricsScheduler] Aggregation mismatch %s %s: requests %d/%d tokens %d/%d bytes %d/%d (source/aggregated)",
+				mm.Granularity, mm.BucketStart.Format(time.RFC3339), mm.SourceRequests, mm.TargetRequests,
+				mm.SourceTokens, mm.TargetTokens, mm.SourceBytes, mm.TargetBytes)
+		}
+		if report.SelfHeal {
+			m.logger.Printf("[MetricsScheduler] Consistency check re-aggregated %d hourly, %d daily, %d monthly buckets",
+				report.Healed["hour"], report.Healed["day"], report.Healed["month"])
+		}
+	}
+	m.statusMu.Lock()
+	m.lastConsistency = report
+	m.statusMu.Unlock()
+}
+
+func (m *MetricsScheduler) checkConsistency(ctx context.Context, now time.Time, report *consistencyReport) error {
+	hourFrom, hourTo, dayFrom, dayTo := consistencyWindows(now)
+	hourly, err := m.store.CompareAggregateBuckets(ctx, store.MetricsGranularityHourly, hourFrom, hourTo)
+	if err != nil {
+		return err
+	}
+	daily, err := m.store.CompareAggregateBuckets(ctx, store.MetricsGranularityDaily, dayFrom, dayTo)
+	if err != nil {
+		return err
+	}
+	report.Mismatches = append(hourly, daily...)
+	if !report.SelfHeal || len(report.Mismatches) == 0 {
+		return nil
+	}
+
+	hours := mismatchBuckets(hourly)
+	days := mergeBuckets(mismatchBuckets(daily), parentBuckets(hours, startOfDay, startOfDay(now)))
+	months := parentBuckets(days, startOfMonth, startOfMonth(now))
+	report.Healed = map[string]int{}
+	for _, step := range []struct {
+		name    string
+		target  store.MetricsGranularity
+		buckets []time.Time
+		next    func(time.Time) time.Time
+	}{
+		{"hour", store.MetricsGranularityHourly, hours, func(t time.Time) time.Time { return t.Add(time.Hour) }},
+		{"day", store.MetricsGranularityDaily, days, func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }},
+		{"month", store.MetricsGranularityMonthly, months, func(t time.Time) time.Time { return t.AddDate(0, 1, 0) }},
+	} {
+		for _, r := range bucketRanges(step.buckets, step.next) {
+			if err := m.store.RebuildAggregateBuckets(ctx, step.target, r.From, r.To); err != nil {
+				return err
+			}
+			if step.target != store.MetricsGranularityMonthly {
+				if err := m.store.AggregateUsageRollups(ctx, step.target, r.From, r.To); err != nil {
+					return err
+				}
+			}
+		}
+		report.Healed[step.name] = len(step.buckets)
+	}
+	return nil
+}
+
+func mismatchBuckets(list []store.AggregateMismatch) []time.Time {
+	out := make([]time.Time, 0, len(list))
+	for _, mm := range list {
+		out = append(out, mm.BucketStart)
+	}
+	return out
+}
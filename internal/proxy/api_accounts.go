@@ -3,7 +3,10 @@ package proxy
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strconv"
+	"time"
 
 	"qcc_plus/internal/store"
 )
@@ -26,15 +29,24 @@ func (p *Server) handleAccounts(w http.ResponseWriter, r *http.Request) {
 			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
 			return
 		}
-		if req.Password != "" && len(req.Password) < 6 {
-			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "密码至少6位"})
-			return
+		if req.Password != "" {
+			if err := p.passwordPolicy().validate(req.Password); err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+				return
+			}
 		}
 		acc, err := p.createAccount(req.Name, req.ProxyAPIKey, req.Password, req.IsAdmin)
 		if err != nil {
 			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
 			return
 		}
+		if req.Password != "" {
+			now := time.Now().UTC()
+			p.mu.Lock()
+			acc.PasswordMeta.ChangedAt = &now
+			p.mu.Unlock()
+			_ = p.persistPasswordMeta(acc.ID, passwordMeta{ChangedAt: &now})
+		}
 		writeJSON(w, http.StatusCreated, map[string]string{"id": acc.ID})
 	case http.MethodGet:
 		writeJSON(w, http.StatusOK, map[string]interface{}{"accounts": p.listAccounts(r.Context())})
@@ -54,10 +66,15 @@ func (p *Server) handleAccounts(w http.ResponseWriter, r *http.Request) {
 			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
 			return
 		}
-		if req.Password != "" && len(req.Password) < 6 {
-			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "密码至少6位"})
-			return
+		policy := p.passwordPolicy()
+		if req.Password != "" {
+			if err := policy.validate(req.Password); err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+				return
+			}
 		}
+		rotated := false
+		var passwordChanged *passwordMeta
 		p.mu.Lock()
 		acc := p.accountByID[id]
 		if acc == nil {
@@ -65,6 +82,13 @@ func (p *Server) handleAccounts(w http.ResponseWriter, r *http.Request) {
 			writeJSON(w, http.StatusNotFound, map[string]string{"error": "not found"})
 			return
 		}
+		if req.Password != "" && req.Password != acc.Password {
+			if err := p.checkAccountPasswordChangeLocked(acc, req.Password, policy); err != nil {
+				p.mu.Unlock()
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+				return
+			}
+		}
 		if req.Name != "" {
 			acc.Name = req.Name
 		}
@@ -77,9 +101,12 @@ func (p *Server) handleAccounts(w http.ResponseWriter, r *http.Request) {
 			delete(p.accounts, acc.ProxyAPIKey)
 			acc.ProxyAPIKey = req.ProxyAPIKey
 			p.accounts[acc.ProxyAPIKey] = acc
+			acc.Key.resetUsage(time.Now().UTC())
+			rotated = true
 		}
-		if req.Password != "" {
-			acc.Password = req.Password
+		if req.Password != "" && req.Password != acc.Password {
+			meta := p.setAccountPasswordLocked(acc, req.Password, policy)
+			passwordChanged = &meta
 		}
 		if req.IsAdmin != nil {
 			if !isAdmin(r.Context()) && !*req.IsAdmin {
@@ -88,7 +115,14 @@ func (p *Server) handleAccounts(w http.ResponseWriter, r *http.Request) {
 				acc.IsAdmin = *req.IsAdmin
 			}
 		}
+		key := acc.Key.clone()
 		p.mu.Unlock()
+		if rotated {
+			_ = p.persistAccountKey(acc.ID, key, auditActor(r))
+		}
+		if passwordChanged != nil {
+			_ = p.persistPasswordMeta(acc.ID, *passwordChanged)
+		}
 		if p.store != nil {
 			_ = p.store.UpdateAccount(context.Background(), store.AccountRecord{
 				ID:          acc.ID,
@@ -126,11 +160,76 @@ func (p *Server) handleAccounts(w http.ResponseWriter, r *http.Request) {
 		}
 		delete(p.accounts, acc.ProxyAPIKey)
 		delete(p.accountByID, id)
+		acc.ServiceAccounts = nil
+		p.indexServiceAccounts(acc)
 		p.mu.Unlock()
+		p.sessionMgr.DeleteAccount(id)
+		res := map[string]interface{}{"deleted": id}
 		if p.store != nil {
-			_ = p.store.DeleteAccount(context.Background(), id)
+			// 账号数据由后台任务（account_purge）分批清理，进度见 GET /admin/api/accounts/purge-jobs。
+			job, err := p.store.DeleteAccount(context.Background(), id)
+			if err != nil {
+				p.logger.Printf("delete account %s failed: %v", id, err)
+			} else {
+				res["purge_job"] = job
+				if queued, err := p.enqueueAccountPurge(context.Background(), job, auditActor(r)); err != nil {
+					p.logger.Printf("enqueue purge for account %s failed: %v", id, err)
+				} else {
+					res["job_id"] = queued.ID
+				}
+			}
+		}
+		writeJSON(w, http.StatusOK, res)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// GET /admin/api/accounts/purge-jobs?limit=50  已删除账号的数据清理任务及进度
+// POST /admin/api/accounts/purge-jobs?id=123   重试失败的任务（重新入队 account_purge 任务）
+func (p *Server) handleAccountPurgeJobs(w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(r.Context()) {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+		return
+	}
+	if p.store == nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "store not enabled"})
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		jobs, err := p.store.ListAccountPurgeJobs(r.Context(), limit)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"jobs": jobs})
+	case http.MethodPost:
+		id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+		if err != nil || id <= 0 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "id required"})
+			return
+		}
+		if err := p.store.RetryAccountPurgeJob(r.Context(), id); err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				writeJSON(w, http.StatusNotFound, map[string]string{"error": "failed job not found"})
+				return
+			}
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		purge, err := p.store.GetAccountPurgeJob(r.Context(), id)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		job, err := p.enqueueAccountPurge(r.Context(), purge, auditActor(r))
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
 		}
-		writeJSON(w, http.StatusOK, map[string]string{"deleted": id})
+		writeJSON(w, http.StatusOK, map[string]interface{}{"id": id, "status": store.AccountPurgePending, "job_id": job.ID})
 	default:
 		w.WriteHeader(http.StatusMethodNotAllowed)
 	}
@@ -140,6 +239,7 @@ func (p *Server) listAccounts(ctx context.Context) []map[string]interface{} {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
 	out := make([]map[string]interface{}, 0, len(p.accountByID))
+	now := time.Now().UTC()
 	for _, acc := range p.accountByID {
 		if !isAdmin(ctx) && ctx != nil {
 			if caller, ok := ctx.Value(accountContextKey{}).(*Account); ok && caller.ID != acc.ID {
@@ -151,6 +251,8 @@ func (p *Server) listAccounts(ctx context.Context) []map[string]interface{} {
 			"name":          acc.Name,
 			"proxy_api_key": acc.ProxyAPIKey,
 			"is_admin":      acc.IsAdmin,
+			"key_status":    acc.Key.status(now),
+			"key_last_used": acc.Key.LastUsedAt,
 		})
 	}
 	return out
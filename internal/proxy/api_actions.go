@@ -115,6 +115,7 @@ func (p *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
 	password := strings.TrimSpace(r.FormValue("password"))
 
 	if username == "" || password == "" {
+		p.emitAuthEvent(r, authEventLogin, "failure", "", username, "missing_credentials")
 		writeJSON(w, http.StatusOK, map[string]string{"error": "账号名称和密码不能为空"})
 		return
 	}
@@ -129,12 +130,36 @@ func (p *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
 	}
 	p.mu.RUnlock()
 
-	if account == nil || account.Password != password {
-		writeJSON(w, http.StatusOK, map[string]string{"error": "账号名称或密码错误"})
-		return
+	var sess *Session
+	if account == nil {
+		// 账号名称未命中时按成员登录名查找。
+		acc, user, ok := p.findAccountUser(username)
+		if !ok || !checkPassword(user.PasswordHash, password) {
+			accountID := ""
+			if ok {
+				accountID = acc.ID
+			}
+			p.emitAuthEvent(r, authEventLogin, "failure", accountID, username, "invalid_credentials")
+			writeJSON(w, http.StatusOK, map[string]string{"error": "账号名称或密码错误"})
+			return
+		}
+		sess = p.createUserSession(acc, user)
+		if sess != nil && user.PasswordMeta.expired(p.passwordPolicy(), time.Now()) {
+			sess.mustChangePassword.Store(true)
+			p.sessionMgr.Save(sess)
+		}
+	} else {
+		if account.Password != password {
+			p.emitAuthEvent(r, authEventLogin, "failure", account.ID, username, "invalid_credentials")
+			writeJSON(w, http.StatusOK, map[string]string{"error": "账号名称或密码错误"})
+			return
+		}
+		sess = p.sessionMgr.Create(account.ID, account.IsAdmin)
+		if sess != nil && p.accountPasswordExpired(account) {
+			sess.mustChangePassword.Store(true)
+			p.sessionMgr.Save(sess)
+		}
 	}
-
-	sess := p.sessionMgr.Create(account.ID, account.IsAdmin)
 	if sess == nil {
 		http.Error(w, "session creation failed", http.StatusInternalServerError)
 		return
@@ -149,6 +174,11 @@ func (p *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
 		SameSite: http.SameSiteLaxMode,
 	})
 
+	p.emitAuthEvent(r, authEventLogin, "success", sess.AccountID, username, "")
+	if sess.mustChangePassword.Load() {
+		p.emitAuthEvent(r, authEventPasswordExpired, "success", sess.AccountID, username, "")
+		w.Header().Set(passwordExpiredHeader, "true")
+	}
 	http.Redirect(w, r, "/admin/dashboard", http.StatusFound)
 }
 
@@ -156,6 +186,9 @@ func (p *Server) handleLogout(w http.ResponseWriter, r *http.Request) {
 	cookie, err := r.Cookie("session_token")
 	if err == nil {
 		if p.sessionMgr != nil {
+			if sess := p.sessionMgr.Get(cookie.Value); sess != nil {
+				p.emitAuthEvent(r, authEventSessionRevoke, "success", sess.AccountID, chooseNonEmpty(sess.UserName, sess.AccountID), "logout")
+			}
 			p.sessionMgr.Delete(cookie.Value)
 		}
 		http.SetCookie(w, &http.Cookie{
@@ -0,0 +1,307 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"qcc_plus/internal/store"
+	"qcc_plus/internal/timeutil"
+)
+
+var errAlertAcknowledged = errors.New("alert already acknowledged")
+
+const (
+	alertsAPIPrefix      = "/api/alerts/"
+	escalationsAPIPrefix = "/api/notification/escalations/"
+	maxEscalationSteps   = 10
+)
+
+// escalationRequest 创建/编辑升级策略的请求体，字段为空表示不修改。
+type escalationRequest struct {
+	Name       *string                 `json:"name"`
+	EventTypes *[]string               `json:"event_types"`
+	Steps      *[]store.EscalationStep `json:"steps"`
+	Enabled    *bool                   `json:"enabled"`
+}
+
+// apply 将请求字段合并到策略记录，步骤渠道必须属于策略所在账号。
+func (req escalationRequest) apply(p *Server, r *http.Request, rec *store.EscalationPolicyRecord) error {
+	if req.Name != nil {
+		rec.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.Enabled != nil {
+		rec.Enabled = *req.Enabled
+	}
+	if req.EventTypes != nil {
+		rec.EventTypes = *req.EventTypes
+	}
+	if len(rec.EventTypes) == 0 {
+		return errors.New("event_types required")
+	}
+	for _, evt := range rec.EventTypes {
+		if !isValidEventType(evt) {
+			return fmt.Errorf("invalid event_type: %s", evt)
+		}
+	}
+	if req.Steps != nil {
+		rec.Steps = *req.Steps
+	}
+	if len(rec.Steps) == 0 || len(rec.Steps) > maxEscalationSteps {
+		return fmt.Errorf("steps required (max %d)", maxEscalationSteps)
+	}
+	for i, step := range rec.Steps {
+		if i > 0 && step.AfterMinutes <= 0 {
+			return fmt.Errorf("steps[%d].after_minutes must be positive", i)
+		}
+		ch, err := p.store.GetNotificationChannel(r.Context(), step.ChannelID)
+		if err != nil || ch.AccountID != rec.AccountID {
+			return fmt.Errorf("steps[%d]: channel not found", i)
+		}
+	}
+	if rec.Name == "" {
+		rec.Name = "escalation"
+	}
+	return nil
+}
+
+func escalationView(rec store.EscalationPolicyRecord) map[string]interface{} {
+	steps := rec.Steps
+	if steps == nil {
+		steps = []store.EscalationStep{}
+	}
+	return map[string]interface{}{
+		"id":          rec.ID,
+		"name":        rec.Name,
+		"event_types": rec.EventTypes,
+		"steps":       steps,
+		"enabled":     rec.Enabled,
+		"created_at":  timeutil.FormatBeijingTime(rec.CreatedAt),
+		"updated_at":  timeutil.FormatBeijingTime(rec.UpdatedAt),
+	}
+}
+
+func alertView(rec store.AlertRecord) map[string]interface{} {
+	var ackAt, nextAt *string
+	if !rec.AcknowledgedAt.IsZero() {
+		s := timeutil.FormatBeijingTime(rec.AcknowledgedAt)
+		ackAt = &s
+	}
+	if !rec.NextEscalationAt.IsZero() {
+		s := timeutil.FormatBeijingTime(rec.NextEscalationAt)
+		nextAt = &s
+	}
+	return map[string]interface{}{
+		"id":                 rec.ID,
+		"policy_id":          rec.PolicyID,
+		"event_type":         rec.EventType,
+		"node":               rec.Node,
+		"severity":           rec.Severity,
+		"title":              rec.Title,
+		"content":            rec.Content,
+		"step":               rec.Step + 1,
+		"status":             rec.Status,
+		"acknowledged":       rec.Status == store.AlertAcknowledged,
+		"acknowledged_by":    rec.AcknowledgedBy,
+		"acknowledged_at":    ackAt,
+		"next_escalation_at": nextAt,
+		"created_at":         timeutil.FormatBeijingTime(rec.CreatedAt),
+		"updated_at":         timeutil.FormatBeijingTime(rec.UpdatedAt),
+	}
+}
+
+// broadcastAlert 将告警状态推送给账号的 WebSocket 连接。
+func (p *Server) broadcastAlert(rec store.AlertRecord) {
+	if p.wsHub != nil {
+		p.wsHub.Broadcast(rec.AccountID, "alert", alertView(rec))
+	}
+}
+
+// acknowledgeAlert 确认告警、记录审计并推送最新状态，告警已确认时返回 errAlertAcknowledged。
+func (p *Server) acknowledgeAlert(ctx context.Context, accountID, id, actor string) (*store.AlertRecord, error) {
+	if err := p.store.AcknowledgeAlert(ctx, id, actor, time.Now()); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, errAlertAcknowledged
+		}
+		return nil, err
+	}
+	rec, err := p.store.GetAlert(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	p.audit(accountID, actor, "alert.ack", id, nil)
+	p.broadcastAlert(*rec)
+	return rec, nil
+}
+
+// GET /api/alerts?account_id=&status=&limit=
+func (p *Server) handleAlerts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	acc, ok := p.incidentAccount(w, r)
+	if !ok {
+		return
+	}
+	q := r.URL.Query()
+	query := store.AlertQuery{AccountID: acc.ID, Status: q.Get("status"), Limit: 100}
+	if query.Status != "" && query.Status != store.AlertOpen && query.Status != store.AlertAcknowledged {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid status"})
+		return
+	}
+	if n, err := strconv.Atoi(q.Get("limit")); err == nil && n > 0 && n <= 500 {
+		query.Limit = n
+	}
+	list, err := p.store.ListAlerts(r.Context(), query)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	items := make([]map[string]interface{}, 0, len(list))
+	for _, rec := range list {
+		items = append(items, alertView(rec))
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"alerts": items})
+}
+
+// GET /api/alerts/:id，POST /api/alerts/:id/ack
+func (p *Server) handleAlertByID(w http.ResponseWriter, r *http.Request) {
+	acc, ok := p.incidentAccount(w, r)
+	if !ok {
+		return
+	}
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, alertsAPIPrefix), "/")
+	id, action, _ := strings.Cut(rest, "/")
+	rec, err := p.store.GetAlert(r.Context(), id)
+	if err != nil || rec.AccountID != acc.ID {
+		if err == nil || errors.Is(err, store.ErrNotFound) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "alert not found"})
+			return
+		}
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	switch {
+	case action == "ack" && r.Method == http.MethodPost:
+		rec, err = p.acknowledgeAlert(r.Context(), acc.ID, id, auditActor(r))
+		if err != nil {
+			if errors.Is(err, errAlertAcknowledged) {
+				writeJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+				return
+			}
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, alertView(*rec))
+	case action != "":
+		http.NotFound(w, r)
+	case r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, alertView(*rec))
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// GET/POST /api/notification/escalations?account_id=
+func (p *Server) handleEscalations(w http.ResponseWriter, r *http.Request) {
+	acc, ok := p.incidentAccount(w, r)
+	if !ok {
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		list, err := p.store.ListEscalationPolicies(r.Context(), acc.ID)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		items := make([]map[string]interface{}, 0, len(list))
+		for _, rec := range list {
+			items = append(items, escalationView(rec))
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"escalations": items})
+	case http.MethodPost:
+		var req escalationRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
+			return
+		}
+		now := time.Now()
+		rec := store.EscalationPolicyRecord{
+			ID:        fmt.Sprintf("esc-%d", now.UnixNano()),
+			AccountID: acc.ID,
+			Enabled:   true,
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+		if err := req.apply(p, r, &rec); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		if err := p.store.CreateEscalationPolicy(r.Context(), rec); err != nil {
+			p.logger.Printf("create escalation policy failed: %v", err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "create escalation failed"})
+			return
+		}
+		p.audit(acc.ID, auditActor(r), "escalation.create", rec.ID, nil)
+		writeJSON(w, http.StatusCreated, escalationView(rec))
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// GET/PUT/DELETE /api/notification/escalations/:id
+func (p *Server) handleEscalationByID(w http.ResponseWriter, r *http.Request) {
+	acc, ok := p.incidentAccount(w, r)
+	if !ok {
+		return
+	}
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, escalationsAPIPrefix), "/")
+	rec, err := p.store.GetEscalationPolicy(r.Context(), id)
+	if err != nil || rec.AccountID != acc.ID {
+		if err == nil || errors.Is(err, store.ErrNotFound) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "escalation not found"})
+			return
+		}
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, escalationView(*rec))
+	case http.MethodPut:
+		var req escalationRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
+			return
+		}
+		if err := req.apply(p, r, rec); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		rec.UpdatedAt = time.Now()
+		if err := p.store.UpdateEscalationPolicy(r.Context(), *rec); err != nil {
+			p.logger.Printf("update escalation policy failed: %v", err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "update failed"})
+			return
+		}
+		p.audit(acc.ID, auditActor(r), "escalation.update", id, nil)
+		writeJSON(w, http.StatusOK, escalationView(*rec))
+	case http.MethodDelete:
+		if err := p.store.DeleteEscalationPolicy(r.Context(), id); err != nil {
+			p.logger.Printf("delete escalation policy failed: %v", err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "delete failed"})
+			return
+		}
+		p.audit(acc.ID, auditActor(r), "escalation.delete", id, nil)
+		writeJSON(w, http.StatusOK, map[string]string{"deleted": id})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
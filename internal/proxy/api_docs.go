@@ -0,0 +1,329 @@
+package proxy
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"qcc_plus/internal/version"
+)
+
+// apiRouter 管理 API 路由表：注册到 ServeMux 的同时记录路由模式，OpenAPI 文档只输出已注册的路由。
+type apiRouter struct {
+	*http.ServeMux
+	patterns []string
+}
+
+func newAPIRouter() *apiRouter {
+	return &apiRouter{ServeMux: http.NewServeMux()}
+}
+
+func (a *apiRouter) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+	a.patterns = append(a.patterns, pattern)
+	a.ServeMux.HandleFunc(pattern, handler)
+}
+
+// 接口访问级别。
+const (
+	accessPublic       = "public"        // 无需登录（凭令牌或签名访问）
+	accessSession      = "session"       // 登录即可：读接口 viewer 起，写接口 member 起
+	accessAccountAdmin = "account_admin" // 账号 owner/admin
+	accessSystemAdmin  = "system_admin"  // 系统管理员
+)
+
+// docRoleSystem 系统管理员在文档中的角色名。
+const docRoleSystem = "system"
+
+// apiRouteDoc 一条路由模式下的接口说明，Methods 以空格分隔，Path 中的路径参数写作 {name}。
+type apiRouteDoc struct {
+	Pattern string
+	Path    string
+	Methods string
+	Tag     string
+	Access  string
+	Summary string
+}
+
+var apiRouteDocs = []apiRouteDoc{
+	{"/login", "/login", "POST", "auth", accessPublic, "登录并写入会话 Cookie"},
+	{"/logout", "/logout", "GET POST", "auth", accessPublic, "退出登录"},
+	{passwordChangePath, passwordChangePath, "POST", "auth", accessSession, "修改当前登录口令"},
+	{invitationsAPIPrefix, invitationsAPIPrefix + "{token}", "GET", "auth", accessPublic, "查看邀请"},
+	{invitationsAPIPrefix, invitationsAPIPrefix + "{token}/accept", "POST", "auth", accessPublic, "接受邀请并创建成员"},
+
+	{"/admin/api/accounts", "/admin/api/accounts", "GET POST PUT DELETE", "accounts", accessSystemAdmin, "账号管理"},
+	{"/admin/api/accounts/policy", "/admin/api/accounts/policy", "GET PUT", "accounts", accessSystemAdmin, "账号策略"},
+	{"/admin/api/accounts/display", "/admin/api/accounts/display", "GET PUT", "accounts", accessSession, "账号展示设置"},
+	{"/admin/api/accounts/key", "/admin/api/accounts/key", "GET PUT", "accounts", accessSystemAdmin, "账号代理密钥"},
+	{"/admin/api/accounts/service-accounts", "/admin/api/accounts/service-accounts", "GET POST PUT DELETE", "accounts", accessAccountAdmin, "服务账号"},
+	{"/admin/api/accounts/purge-jobs", "/admin/api/accounts/purge-jobs", "GET POST", "accounts", accessSystemAdmin, "已删除账号的数据清理任务"},
+	{impersonatePath, impersonatePath, "GET POST DELETE", "accounts", accessSystemAdmin, "管理员代入账号"},
+	{"/api/accounts/", "/api/accounts/{id}/metrics", "GET", "accounts", accessSession, "账号指标"},
+	{"/api/accounts/", "/api/accounts/{id}/export", "POST", "accounts", accessAccountAdmin, "发起账号数据导出"},
+	{"/api/accounts/", "/api/accounts/{id}/export/{export_id}", "GET", "accounts", accessAccountAdmin, "导出任务状态"},
+	{"/api/accounts/", "/api/accounts/{id}/export/{export_id}/download", "GET", "accounts", accessAccountAdmin, "下载导出归档"},
+	{"/api/accounts/", "/api/accounts/{id}/webhook-secret", "GET POST", "accounts", accessAccountAdmin, "账号 Webhook 签名密钥"},
+	{"/api/accounts/", "/api/accounts/{id}/recording", "GET", "accounts", accessSession, "流量录制统计"},
+	{"/api/accounts/", "/api/accounts/{id}/node-hooks", "GET POST", "accounts", accessSession, "节点事件钩子"},
+	{"/api/accounts/", "/api/accounts/{id}/node-hooks/{hook_id}", "PUT DELETE", "accounts", accessSession, "修改或删除节点事件钩子"},
+	{"/api/accounts/", "/api/accounts/{id}/users", "GET", "accounts", accessAccountAdmin, "账号成员"},
+	{"/api/accounts/", "/api/accounts/{id}/users/{user_id}", "PUT DELETE", "accounts", accessAccountAdmin, "修改或移除成员"},
+	{"/api/accounts/", "/api/accounts/{id}/invitations", "GET POST", "accounts", accessAccountAdmin, "成员邀请"},
+	{"/api/accounts/", "/api/accounts/{id}/invitations/{invitation_id}", "DELETE", "accounts", accessAccountAdmin, "撤销邀请"},
+
+	{"/admin/api/nodes", "/admin/api/nodes", "GET POST PUT DELETE", "nodes", accessSession, "节点列表与管理"},
+	{"/admin/api/config", "/admin/api/config", "GET PUT", "nodes", accessSession, "账号代理配置"},
+	{"/admin/api/nodes/activate", "/admin/api/nodes/activate", "POST", "nodes", accessSession, "切换活跃节点"},
+	{"/admin/api/nodes/disable", "/admin/api/nodes/disable", "POST", "nodes", accessSession, "停用节点"},
+	{"/admin/api/nodes/enable", "/admin/api/nodes/enable", "POST", "nodes", accessSession, "启用节点"},
+	{"/admin/api/nodes/drain", "/admin/api/nodes/drain", "GET POST", "nodes", accessSession, "节点排空"},
+	{"/api/nodes", "/api/nodes", "POST", "nodes", accessSession, "创建节点"},
+	{"/api/nodes/import", "/api/nodes/import", "POST", "nodes", accessSession, "批量导入节点"},
+	{"/api/nodes/template", "/api/nodes/template", "GET PUT DELETE", "nodes", accessSession, "节点模板"},
+	{"/api/nodes/changes", "/api/nodes/changes", "GET", "nodes", accessSystemAdmin, "节点状态变更（长轮询）"},
+	{"/api/nodes/order", "/api/nodes/order", "PUT", "nodes", accessSession, "调整节点顺序"},
+	{"/api/nodes/", "/api/nodes/{id}/metrics", "GET", "nodes", accessSession, "节点指标"},
+	{"/api/nodes/", "/api/nodes/{id}/health-history", "GET", "nodes", accessSession, "健康检查历史（也可凭 share_token 访问）"},
+	{"/api/nodes/", "/api/nodes/{id}/status", "GET", "nodes", accessSession, "节点状态"},
+	{"/api/nodes/", "/api/nodes/{id}/benchmark", "GET POST", "benchmarks", accessSession, "节点压测"},
+	{"/api/nodes/", "/api/nodes/{id}/benchmark/schedule", "GET PUT DELETE", "benchmarks", accessSession, "定时压测"},
+	{"/api/nodes/", "/api/nodes/{id}/benchmark/trend", "GET", "benchmarks", accessSession, "压测趋势"},
+	{"/api/nodes/", "/api/nodes/{id}/client-cert", "GET PUT DELETE", "nodes", accessSession, "节点客户端证书"},
+	{"/api/nodes/", "/api/nodes/{id}/ca-bundle", "GET PUT DELETE", "nodes", accessSession, "节点自定义 CA"},
+	{"/api/nodes/", "/api/nodes/{id}/tls-test", "POST", "nodes", accessSession, "TLS 试连"},
+	{"/api/nodes/", "/api/nodes/{id}/dns", "GET PUT DELETE", "nodes", accessSession, "节点解析与拨号设置"},
+
+	{"/admin/api/tunnel", "/admin/api/tunnel", "GET PUT", "tunnel", accessSystemAdmin, "隧道配置"},
+	{"/admin/api/tunnel/start", "/admin/api/tunnel/start", "POST", "tunnel", accessSystemAdmin, "启动隧道"},
+	{"/admin/api/tunnel/stop", "/admin/api/tunnel/stop", "POST", "tunnel", accessSystemAdmin, "停止隧道"},
+	{"/admin/api/tunnel/zones", "/admin/api/tunnel/zones", "GET", "tunnel", accessSystemAdmin, "可用 Zone 列表"},
+
+	{"/api/notification/channels", "/api/notification/channels", "GET POST", "notification", accessSession, "通知渠道"},
+	{"/api/notification/channels/", "/api/notification/channels/{id}", "PUT DELETE", "notification", accessSession, "修改或删除通知渠道"},
+	{"/api/notification/subscriptions", "/api/notification/subscriptions", "GET POST", "notification", accessSession, "通知订阅"},
+	{"/api/notification/subscriptions/", "/api/notification/subscriptions/{id}", "PUT DELETE", "notification", accessSession, "修改或删除通知订阅"},
+	{"/api/notification/event-types", "/api/notification/event-types", "GET", "notification", accessSession, "事件类型"},
+	{"/api/notification/test", "/api/notification/test", "POST", "notification", accessSession, "发送测试通知"},
+	{"/api/notification/escalations", "/api/notification/escalations", "GET POST", "notification", accessSession, "告警升级策略"},
+	{escalationsAPIPrefix, escalationsAPIPrefix + "{id}", "GET PUT DELETE", "notification", accessSession, "单个升级策略"},
+	{upstreamWebhookPrefix, upstreamWebhookPrefix + "{provider}", "POST", "notification", accessPublic, "接收上游状态页 Webhook（需 token）"},
+	{nodeHooksAPIPrefix, nodeHooksAPIPrefix + "{hook_id}", "POST", "notification", accessPublic, "触发节点事件钩子（需签名）"},
+	{upstreamStatusAPIPrefix, upstreamStatusAPIPrefix, "GET DELETE", "notification", accessSystemAdmin, "上游服务商状态"},
+
+	{"/api/monitor/dashboard", "/api/monitor/dashboard", "GET", "monitor", accessSession, "监控面板数据"},
+	{"/api/monitor/schema/node-metrics", "/api/monitor/schema/node-metrics", "GET", "monitor", accessSession, "节点状态载荷的 JSON Schema"},
+	{"/api/monitor/shares", "/api/monitor/shares", "GET POST", "shares", accessSession, "监控分享链接"},
+	{"/api/monitor/shares/", "/api/monitor/shares/{id}", "DELETE", "shares", accessSession, "撤销分享链接"},
+	{"/api/monitor/share/", "/api/monitor/share/{token}", "GET", "shares", accessPublic, "凭分享令牌查看监控"},
+	{"/api/shares", "/api/shares", "GET POST", "shares", accessSession, "分享链接"},
+	{sharesAPIPrefix, sharesAPIPrefix + "{id}", "GET PATCH DELETE", "shares", accessSession, "单个分享链接"},
+	{sharesAPIPrefix, sharesAPIPrefix + "{id}/regenerate", "POST", "shares", accessSession, "重新生成分享令牌"},
+	{"/api/status-page", "/api/status-page", "GET PUT", "shares", accessSession, "公开状态页配置"},
+	{"/api/incidents", "/api/incidents", "GET POST", "incidents", accessSession, "事件列表"},
+	{incidentsAPIPrefix, incidentsAPIPrefix + "{id}", "GET PATCH DELETE", "incidents", accessSession, "单个事件"},
+	{incidentsAPIPrefix, incidentsAPIPrefix + "{id}/updates", "POST", "incidents", accessSession, "追加事件进展"},
+	{"/api/alerts", "/api/alerts", "GET", "incidents", accessSession, "告警列表"},
+	{alertsAPIPrefix, alertsAPIPrefix + "{id}", "GET", "incidents", accessSession, "告警详情"},
+	{alertsAPIPrefix, alertsAPIPrefix + "{id}/ack", "POST", "incidents", accessSession, "确认告警"},
+
+	{"/api/settings", "/api/settings", "GET", "settings", accessSystemAdmin, "系统配置列表"},
+	{"/api/settings/version", "/api/settings/version", "GET", "settings", accessSystemAdmin, "配置版本"},
+	{"/api/settings/changes", "/api/settings/changes", "GET", "settings", accessSystemAdmin, "配置变更日志（增量同步）"},
+	{"/api/settings/scheduled", "/api/settings/scheduled", "GET POST", "settings", accessSystemAdmin, "定时配置变更"},
+	{scheduledSettingsPrefix, scheduledSettingsPrefix + "{id}", "DELETE", "settings", accessSystemAdmin, "取消定时变更"},
+	{"/api/settings/validate", "/api/settings/validate", "POST", "settings", accessSystemAdmin, "校验配置"},
+	{"/api/settings/diff", "/api/settings/diff", "GET POST", "settings", accessSystemAdmin, "配置差异"},
+	{"/api/settings/batch", "/api/settings/batch", "PUT", "settings", accessSystemAdmin, "批量更新配置"},
+	{"/api/settings/", "/api/settings/{key}", "GET PUT DELETE", "settings", accessSession, "单项配置（系统级需管理员）"},
+	{"/api/ui/preferences", "/api/ui/preferences", "GET PUT", "settings", accessSession, "界面偏好"},
+
+	{"/api/metrics/aggregate", "/api/metrics/aggregate", "POST", "metrics", accessSystemAdmin, "立即聚合指标"},
+	{"/api/metrics/cleanup", "/api/metrics/cleanup", "POST", "metrics", accessSystemAdmin, "立即清理指标"},
+	{"/api/metrics/compression", "/api/metrics/compression", "GET", "metrics", accessSession, "压缩统计"},
+	{"/api/metrics/streams", "/api/metrics/streams", "GET", "metrics", accessSession, "流式请求统计"},
+	{"/api/metrics/content-filter", "/api/metrics/content-filter", "GET", "metrics", accessSession, "内容过滤统计"},
+	{"/api/metrics/errors", "/api/metrics/errors", "GET", "metrics", accessSession, "错误分类"},
+	{"/api/metrics/hedging", "/api/metrics/hedging", "GET", "metrics", accessSession, "对冲效果报表"},
+	{"/api/usage/labels", "/api/usage/labels", "GET", "metrics", accessSession, "按标签统计用量"},
+	{"/api/usage/rollups", "/api/usage/rollups", "GET", "metrics", accessSession, "用量汇总"},
+	{"/api/audit-logs", "/api/audit-logs", "GET", "logs", accessSession, "审计日志"},
+	{"/api/request-logs", "/api/request-logs", "GET", "logs", accessSession, "请求日志"},
+	{"/api/requests/slowest", "/api/requests/slowest", "GET", "logs", accessSession, "最慢请求"},
+	{"/api/routing/explain", "/api/routing/explain", "POST", "routing", accessSession, "路由决策解释"},
+	{"/api/routing/affinity", "/api/routing/affinity", "GET DELETE", "routing", accessSession, "会话亲和表"},
+
+	{"/api/replay/corpus", "/api/replay/corpus", "GET POST", "benchmarks", accessSession, "回放语料"},
+	{replayCorpusPrefix, replayCorpusPrefix + "{id}", "GET DELETE", "benchmarks", accessSession, "单条回放语料"},
+	{"/api/replay/runs", "/api/replay/runs", "GET POST", "benchmarks", accessSession, "回放任务"},
+	{replayRunsPrefix, replayRunsPrefix + "{id}", "GET", "benchmarks", accessSession, "回放结果"},
+	{"/api/ab-comparisons", "/api/ab-comparisons", "GET POST", "benchmarks", accessSession, "A/B 对比"},
+	{abComparisonsPrefix, abComparisonsPrefix + "{id}", "GET DELETE", "benchmarks", accessSession, "单个 A/B 对比"},
+
+	{"/api/admin/storage", "/api/admin/storage", "GET PUT", "admin", accessSystemAdmin, "存储占用与上限"},
+	{"/api/admin/retention", "/api/admin/retention", "GET PUT DELETE", "admin", accessSystemAdmin, "数据保留策略"},
+	{"/api/admin/scheduler", "/api/admin/scheduler", "GET", "admin", accessSystemAdmin, "后台任务状态"},
+	{"/api/admin/chaos", "/api/admin/chaos", "GET PUT DELETE", "admin", accessSystemAdmin, "故障注入"},
+	{"/api/admin/stats", "/api/admin/stats", "GET", "admin", accessSystemAdmin, "系统统计"},
+	{"/api/admin/modules", "/api/admin/modules", "GET", "admin", accessSystemAdmin, "API 模块状态"},
+	{jobsAPIPath, jobsAPIPath, "GET", "jobs", accessSession, "后台任务列表"},
+	{jobsAPIPath + "/", jobsAPIPath + "/{id}", "GET", "jobs", accessSession, "后台任务状态"},
+	{jobsAPIPath + "/", jobsAPIPath + "/{id}/cancel", "POST", "jobs", accessSession, "取消后台任务"},
+	{jobsAPIPath + "/", jobsAPIPath + "/{id}/retry", "POST", "jobs", accessSession, "重试后台任务"},
+	{"/api/admin/prometheus", "/api/admin/prometheus", "GET", "admin", accessSystemAdmin, "Prometheus 指标（x-admin-key）"},
+	{"/api/admin/config", "/api/admin/config", "GET", "admin", accessSystemAdmin, "启动配置"},
+	{"/api/admin/auth-events", "/api/admin/auth-events", "GET", "admin", accessSystemAdmin, "认证事件统计"},
+	{"/api/declarative", "/api/declarative", "PUT", "admin", accessSystemAdmin, "声明式配置"},
+	{"/api/version", "/api/version", "GET", "admin", accessSystemAdmin, "版本与更新信息"},
+	{apiDocsPath, apiDocsPath, "GET", "admin", accessSession, "按角色过滤的 OpenAPI 文档"},
+}
+
+const apiDocsPath = "/api/docs/openapi.json"
+
+// docRoleRank 角色权限从低到高。
+var docRoleRank = map[string]int{roleViewer: 1, roleMember: 2, roleAdmin: 3, roleOwner: 4}
+
+// minRole 返回调用该接口所需的最低角色，公开接口为空字符串。
+func (d apiRouteDoc) minRole(method string) string {
+	switch d.Access {
+	case accessPublic:
+		return ""
+	case accessSystemAdmin:
+		return docRoleSystem
+	case accessAccountAdmin:
+		return roleAdmin
+	}
+	if method == http.MethodGet || method == http.MethodHead {
+		return roleViewer
+	}
+	return roleMember
+}
+
+// visibleTo 判断角色能否调用接口；role 为空表示输出全部接口。
+func visibleTo(minRole, role string) bool {
+	switch {
+	case role == "", minRole == "":
+		return true
+	case minRole == docRoleSystem:
+		return false
+	}
+	return docRoleRank[role] >= docRoleRank[minRole]
+}
+
+// buildOpenAPISpec 由路由表生成 OpenAPI 文档，只包含 registered 中已注册的路由，role 非空时按角色过滤。
+func buildOpenAPISpec(docs []apiRouteDoc, registered map[string]bool, role string) map[string]interface{} {
+	paths := make(map[string]interface{})
+	tagSet := make(map[string]bool)
+	for _, d := range docs {
+		if !registered[d.Pattern] {
+			continue
+		}
+		for _, method := range strings.Fields(d.Methods) {
+			min := d.minRole(method)
+			if !visibleTo(min, role) {
+				continue
+			}
+			item, _ := paths[d.Path].(map[string]interface{})
+			if item == nil {
+				item = make(map[string]interface{})
+				paths[d.Path] = item
+			}
+			op := map[string]interface{}{
+				"summary":    d.Summary,
+				"tags":       []string{d.Tag},
+				"x-min-role": min,
+				"responses":  map[string]interface{}{"200": map[string]string{"description": "OK"}},
+			}
+			if min == "" {
+				op["security"] = []interface{}{}
+			}
+			if params := openAPIPathParams(d.Path); len(params) > 0 {
+				op["parameters"] = params
+			}
+			item[strings.ToLower(method)] = op
+			tagSet[d.Tag] = true
+		}
+	}
+	tags := make([]string, 0, len(tagSet))
+	for tag := range tagSet {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	tagList := make([]map[string]string, 0, len(tags))
+	for _, tag := range tags {
+		tagList = append(tagList, map[string]string{"name": tag})
+	}
+	scope := role
+	if scope == "" {
+		scope = "full"
+	}
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]string{
+			"title":   "qcc_plus 管理 API",
+			"version": version.Version,
+		},
+		"x-role":   scope,
+		"tags":     tagList,
+		"paths":    paths,
+		"security": []map[string][]string{{"session": {}}},
+		"components": map[string]interface{}{
+			"securitySchemes": map[string]interface{}{
+				"session": map[string]string{"type": "apiKey", "in": "cookie", "name": "session_token"},
+			},
+		},
+	}
+}
+
+func openAPIPathParams(path string) []map[string]interface{} {
+	var params []map[string]interface{}
+	for _, seg := range strings.Split(path, "/") {
+		if strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}") {
+			params = append(params, map[string]interface{}{
+				"name":     strings.Trim(seg, "{}"),
+				"in":       "path",
+				"required": true,
+				"schema":   map[string]string{"type": "string"},
+			})
+		}
+	}
+	return params
+}
+
+func (p *Server) setAPIPatterns(patterns []string) {
+	set := make(map[string]bool, len(patterns))
+	for _, pattern := range patterns {
+		set[pattern] = true
+	}
+	p.mu.Lock()
+	p.apiPatterns = set
+	p.mu.Unlock()
+}
+
+// GET /api/docs/openapi.json?role=viewer|member|admin|owner
+// 按角色过滤的 OpenAPI 文档：默认输出调用方自身角色可调用的接口，只能查看不高于自身的角色；
+// 系统管理员不带 role 时输出完整文档，带 role 时输出该角色的视图（不含系统管理接口）。
+func (p *Server) handleAPIDocs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	system := isAdmin(r.Context())
+	own := sessionRole(r.Context())
+	role := strings.TrimSpace(r.URL.Query().Get("role"))
+	switch {
+	case role == "" && system:
+		// 完整文档
+	case role == "":
+		role = own
+	case docRoleRank[role] == 0:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid role"})
+		return
+	case !system && docRoleRank[role] > docRoleRank[own]:
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+		return
+	}
+	p.mu.RLock()
+	registered := p.apiPatterns
+	p.mu.RUnlock()
+	writeJSON(w, http.StatusOK, buildOpenAPISpec(apiRouteDocs, registered, role))
+}
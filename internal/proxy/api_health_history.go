@@ -1,6 +1,7 @@
 package proxy
 
 import (
+	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
@@ -18,6 +19,22 @@ func (p *Server) handleNodeAPIRoutes(w http.ResponseWriter, r *http.Request) {
 		p.handleGetNodeMetrics(w, r)
 	case strings.HasSuffix(path, "/health-history"):
 		p.handleGetHealthHistory(w, r)
+	case strings.HasSuffix(path, "/status"):
+		p.handleNodeStatus(w, r)
+	case strings.HasSuffix(path, "/benchmark/schedule"):
+		p.handleBenchmarkSchedule(w, r)
+	case strings.HasSuffix(path, "/benchmark/trend"):
+		p.handleBenchmarkTrend(w, r)
+	case strings.HasSuffix(path, "/benchmark"):
+		p.handleNodeBenchmark(w, r)
+	case strings.HasSuffix(path, "/client-cert"):
+		p.handleNodeClientCert(w, r)
+	case strings.HasSuffix(path, "/ca-bundle"):
+		p.handleNodeCABundle(w, r)
+	case strings.HasSuffix(path, "/tls-test"):
+		p.handleNodeTLSTest(w, r)
+	case strings.HasSuffix(path, "/dns"):
+		p.handleNodeDNS(w, r)
 	default:
 		http.NotFound(w, r)
 	}
@@ -25,9 +42,9 @@ func (p *Server) handleNodeAPIRoutes(w http.ResponseWriter, r *http.Request) {
 
 // GET /api/nodes/:node_id/health-history
 // 查询参数：
-// - from: RFC3339（默认 24 小时前）
+// - from: RFC3339（默认 24 小时前，跨度最多 31 天）
 // - to: RFC3339（默认当前时间）
-// - limit: 默认 300
+// - limit: 默认 300，最多 2000
 // - offset: 默认 0
 // - share_token: 分享 token（可选，用于未登录访问）
 func (p *Server) handleGetHealthHistory(w http.ResponseWriter, r *http.Request) {
@@ -99,6 +116,13 @@ func (p *Server) handleGetHealthHistory(w http.ResponseWriter, r *http.Request)
 		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "from must be before to"})
 		return
 	}
+	if span := to.Sub(from); span > healthHistoryMaxRange {
+		writeQueryError(w, &queryLimitError{
+			msg:      fmt.Sprintf("time range %s exceeds the %s limit for health history, use a shorter range", formatRangeDays(span), formatRangeDays(healthHistoryMaxRange)),
+			maxRange: healthHistoryMaxRange,
+		})
+		return
+	}
 
 	limit := 300
 	if v := r.URL.Query().Get("limit"); v != "" {
@@ -106,8 +130,12 @@ func (p *Server) handleGetHealthHistory(w http.ResponseWriter, r *http.Request)
 			limit = n
 		}
 	}
-	if limit > 2000 {
-		limit = 2000
+	if limit > healthHistoryMaxLimit {
+		writeQueryError(w, &queryLimitError{
+			msg:     fmt.Sprintf("limit must not exceed %d, page with offset", healthHistoryMaxLimit),
+			maxRows: healthHistoryMaxLimit,
+		})
+		return
 	}
 	offset := 0
 	if v := r.URL.Query().Get("offset"); v != "" {
@@ -144,6 +172,8 @@ func (p *Server) handleGetHealthHistory(w http.ResponseWriter, r *http.Request)
 			"response_time_ms": rec.ResponseTimeMs,
 			"error_message":    rec.ErrorMessage,
 			"check_method":     rec.CheckMethod,
+			"interval_ms":      rec.IntervalMs,
+			"dns_ms":           rec.DNSMs,
 		})
 	}
 
@@ -0,0 +1,118 @@
+package proxy
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"qcc_plus/internal/store"
+)
+
+const jobsAPIPath = "/api/jobs"
+
+// GET /api/jobs?type=&status=&account_id=&limit=50
+// 列出后台任务。管理员可查看全部（含系统任务）并按账号筛选，其他会话只能看到本账号的任务。
+func (p *Server) handleJobs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if p.jobs == nil {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "job queue not enabled"})
+		return
+	}
+	q := r.URL.Query()
+	filter := store.JobFilter{Type: q.Get("type"), Status: q.Get("status"), AccountID: q.Get("account_id")}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > 500 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "limit must be between 1 and 500"})
+			return
+		}
+		filter.Limit = n
+	}
+	if !isAdmin(r.Context()) {
+		acc := accountFromCtx(r)
+		if acc == nil {
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+			return
+		}
+		filter.AccountID = acc.ID
+	}
+	jobs, err := p.jobs.queue.ListJobs(r.Context(), filter)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"jobs": jobs})
+}
+
+// GET  /api/jobs/{id}         任务状态与结果
+// POST /api/jobs/{id}/cancel  取消待执行或运行中的任务
+// POST /api/jobs/{id}/retry   重新执行失败或已取消的任务
+func (p *Server) handleJob(w http.ResponseWriter, r *http.Request) {
+	if p.jobs == nil {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "job queue not enabled"})
+		return
+	}
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, jobsAPIPath+"/"), "/"), "/")
+	id, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || id <= 0 || len(parts) > 2 {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "not found"})
+		return
+	}
+	job, err := p.jobs.queue.GetJob(r.Context(), id)
+	if err == nil && !canAccessJob(r, job) {
+		err = store.ErrNotFound
+	}
+	if err != nil {
+		writeJobError(w, err, "job not found")
+		return
+	}
+
+	action := ""
+	if len(parts) == 2 {
+		action = parts[1]
+	}
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, job)
+	case action == "cancel" && r.Method == http.MethodPost:
+		job, err = p.jobs.queue.CancelJob(r.Context(), id)
+		if err != nil {
+			writeJobError(w, err, "job already finished")
+			return
+		}
+		p.audit(job.AccountID, auditActor(r), "job.cancel", strconv.FormatInt(id, 10), map[string]interface{}{"type": job.Type})
+		writeJSON(w, http.StatusOK, job)
+	case action == "retry" && r.Method == http.MethodPost:
+		job, err = p.jobs.queue.RetryJob(r.Context(), id)
+		if err != nil {
+			writeJobError(w, err, "only failed or cancelled jobs can be retried")
+			return
+		}
+		p.audit(job.AccountID, auditActor(r), "job.retry", strconv.FormatInt(id, 10), map[string]interface{}{"type": job.Type})
+		writeJSON(w, http.StatusOK, job)
+	case action != "" && action != "cancel" && action != "retry":
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "not found"})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// canAccessJob 系统任务（无账号）仅管理员可见，账号任务需可管理该账号。
+func canAccessJob(r *http.Request, job *store.Job) bool {
+	if isAdmin(r.Context()) {
+		return true
+	}
+	return job.AccountID != "" && canManageAccount(r.Context(), job.AccountID)
+}
+
+func writeJobError(w http.ResponseWriter, err error, notFound string) {
+	if errors.Is(err, store.ErrNotFound) {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": notFound})
+		return
+	}
+	writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+}
@@ -54,7 +54,7 @@ func (p *Server) handleGetNodeMetrics(w http.ResponseWriter, r *http.Request) {
 
 	gran, from, to, limit, offset, err := parseMetricsQueryParams(r)
 	if err != nil {
-		respondJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		writeQueryError(w, err)
 		return
 	}
 
@@ -94,6 +94,7 @@ func (p *Server) handleGetNodeMetrics(w http.ResponseWriter, r *http.Request) {
 
 	respondJSON(w, http.StatusOK, map[string]interface{}{
 		"data":        data,
+		"current":     p.nodeMetricsFor(node, time.Now()),
 		"granularity": string(gran),
 		"from":        from.UTC().Format(time.RFC3339),
 		"to":          to.UTC().Format(time.RFC3339),
@@ -128,7 +129,7 @@ func (p *Server) handleGetAccountMetrics(w http.ResponseWriter, r *http.Request)
 
 	gran, from, to, limit, offset, err := parseMetricsQueryParams(r)
 	if err != nil {
-		respondJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		writeQueryError(w, err)
 		return
 	}
 
@@ -137,7 +138,7 @@ func (p *Server) handleGetAccountMetrics(w http.ResponseWriter, r *http.Request)
 		Granularity: gran,
 		From:        from,
 		To:          to,
-		Limit:       0, // 聚合账号需先取全量再分页
+		Limit:       metricsMaxScanRows + 1, // 聚合账号需先取全量再分页，超出读取上限时拒绝
 		Offset:      0,
 	}
 	records, err := p.store.QueryMetrics(r.Context(), q)
@@ -145,6 +146,10 @@ func (p *Server) handleGetAccountMetrics(w http.ResponseWriter, r *http.Request)
 		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
 		return
 	}
+	if len(records) > metricsMaxScanRows {
+		writeQueryError(w, tooManyRowsError(gran, metricsMaxScanRows))
+		return
+	}
 
 	agg := make(map[time.Time]store.MetricsRecord)
 	for _, rec := range records {
@@ -249,14 +254,26 @@ func (p *Server) handleAggregateMetrics(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	unlock, ok := p.metricsScheduler.tryLockAggregation()
+	if !ok {
+		respondJSON(w, http.StatusConflict, map[string]string{"error": "aggregation already running"})
+		return
+	}
+	defer unlock()
 	if err := p.store.AggregateMetrics(r.Context(), req.AccountID, target, from, to); err != nil {
 		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
 		return
 	}
+	if target == store.MetricsGranularityHourly || target == store.MetricsGranularityDaily {
+		if err := p.store.AggregateUsageRollups(r.Context(), target, from, to); err != nil {
+			respondJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+	}
 	respondJSON(w, http.StatusOK, map[string]string{"status": "ok"})
 }
 
-// handleCleanupMetrics 处理 POST /api/metrics/cleanup
+// handleCleanupMetrics 处理 POST /api/metrics/cleanup，按保留策略清理各类数据。
 func (p *Server) handleCleanupMetrics(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		w.WriteHeader(http.StatusMethodNotAllowed)
@@ -273,20 +290,53 @@ func (p *Server) handleCleanupMetrics(w http.ResponseWriter, r *http.Request) {
 
 	var req struct {
 		AccountID string `json:"account_id"`
+		DryRun    bool   `json:"dry_run"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
 		return
 	}
 
-	if err := p.store.CleanupMetrics(r.Context(), req.AccountID, time.Now().UTC()); err != nil {
+	plan, err := loadRetentionPlan(p.store)
+	if err != nil {
 		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
 		return
 	}
-	respondJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	unlock, ok := p.metricsScheduler.tryLockCleanup()
+	if !ok {
+		respondJSON(w, http.StatusConflict, map[string]string{"error": "cleanup already running"})
+		return
+	}
+	defer unlock()
+	deleted, err := runRetentionCleanup(r.Context(), p.store, plan, req.AccountID, req.DryRun, time.Now().UTC())
+	if err != nil {
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	p.logger.Printf("metrics cleanup (account=%s) %s: %s", chooseNonEmpty(req.AccountID, "all"), cleanupVerb(req.DryRun), formatTableCounts(deleted))
+	respondJSON(w, http.StatusOK, map[string]interface{}{"status": "ok", "dry_run": req.DryRun, "deleted": deleted})
 }
 
-// parseMetricsQueryParams 提取并校验查询参数，返回有效值与默认时间窗口。
+// handleSchedulerStatus 处理 GET /api/admin/scheduler，返回指标调度器最近一次聚合与清理的结果。
+func (p *Server) handleSchedulerStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if !isAdmin(r.Context()) {
+		respondJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+		return
+	}
+	if p.metricsScheduler == nil {
+		respondJSON(w, http.StatusOK, map[string]interface{}{"enabled": false})
+		return
+	}
+	status := p.metricsScheduler.status()
+	status["enabled"] = true
+	respondJSON(w, http.StatusOK, status)
+}
+
+// parseMetricsQueryParams 提取并校验查询参数，返回有效值与默认时间窗口；时间跨度与 limit 超出代价限制时返回 *queryLimitError。
 func parseMetricsQueryParams(r *http.Request) (store.MetricsGranularity, time.Time, time.Time, int, int, error) {
 	gran, err := parseGranularity(r.URL.Query().Get("granularity"))
 	if err != nil {
@@ -311,6 +361,9 @@ func parseMetricsQueryParams(r *http.Request) (store.MetricsGranularity, time.Ti
 	if !from.Before(to) {
 		return "", time.Time{}, time.Time{}, 0, 0, fmt.Errorf("from must be before to")
 	}
+	if err := checkMetricsRange(gran, from, to); err != nil {
+		return "", time.Time{}, time.Time{}, 0, 0, err
+	}
 
 	limit := 100
 	if v := r.URL.Query().Get("limit"); v != "" {
@@ -318,6 +371,12 @@ func parseMetricsQueryParams(r *http.Request) (store.MetricsGranularity, time.Ti
 		if err != nil || n < 0 {
 			return "", time.Time{}, time.Time{}, 0, 0, fmt.Errorf("invalid limit")
 		}
+		if n > metricsMaxLimit {
+			return "", time.Time{}, time.Time{}, 0, 0, &queryLimitError{
+				msg:     fmt.Sprintf("limit must not exceed %d, page with offset or use a coarser granularity", metricsMaxLimit),
+				maxRows: metricsMaxLimit,
+			}
+		}
 		if n > 0 {
 			limit = n
 		}
@@ -374,6 +433,22 @@ func parseTime(val string) (time.Time, error) {
 	return t.UTC(), nil
 }
 
+// parseTimeRange 解析 from/to（RFC3339），校验先后顺序。
+func parseTimeRange(fromVal, toVal string) (time.Time, time.Time, error) {
+	from, err := parseTime(fromVal)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid from")
+	}
+	to, err := parseTime(toVal)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid to")
+	}
+	if !from.IsZero() && !to.IsZero() && !from.Before(to) {
+		return time.Time{}, time.Time{}, fmt.Errorf("from must be before to")
+	}
+	return from, to, nil
+}
+
 func parseAggregateTarget(val string) (store.MetricsGranularity, error) {
 	switch strings.ToLower(strings.TrimSpace(val)) {
 	case string(store.MetricsGranularityHourly):
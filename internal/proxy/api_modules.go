@@ -0,0 +1,154 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// settingDisabledModules 为系统配置中停用的 API 模块列表。
+const settingDisabledModules = "api.disabled_modules"
+
+// apiModule 可整体停用的管理面模块，按路径匹配。
+type apiModule struct {
+	Name     string
+	Desc     string
+	Prefixes []string
+	match    func(r *http.Request) bool // 前缀无法表达的附加匹配
+}
+
+var apiModules = []apiModule{
+	{
+		Name:     "shares",
+		Desc:     "监控分享链接",
+		Prefixes: []string{"/api/shares", "/api/monitor/shares", "/api/monitor/share/"},
+		match: func(r *http.Request) bool {
+			return strings.HasPrefix(r.URL.Path, "/api/nodes/") && strings.HasSuffix(r.URL.Path, "/health-history") &&
+				r.URL.Query().Get("share_token") != ""
+		},
+	},
+	{Name: "status_page", Desc: "公开状态页与徽章", Prefixes: []string{statusPagePrefix, badgePrefix, "/api/status-page"}},
+	{Name: "ws", Desc: "监控 WebSocket 推送", Prefixes: []string{"/api/monitor/ws"}},
+	{Name: "request_logs", Desc: "请求日志查询", Prefixes: []string{"/api/request-logs", "/api/requests/"}},
+	{
+		Name:     "benchmarks",
+		Desc:     "节点压测、回放与 A/B 对比",
+		Prefixes: []string{"/api/replay/", "/api/ab-comparisons"},
+		match:    func(r *http.Request) bool { return isNodeBenchmarkPath(r.URL.Path) },
+	},
+	{Name: "declarative", Desc: "声明式配置导入导出", Prefixes: []string{"/api/declarative"}},
+	{Name: "tunnel", Desc: "Cloudflare 隧道管理", Prefixes: []string{"/admin/api/tunnel"}},
+	{Name: "invitations", Desc: "成员邀请", Prefixes: []string{invitationsAPIPrefix}},
+	{Name: "webhooks", Desc: "节点事件钩子与上游状态 Webhook", Prefixes: []string{nodeHooksAPIPrefix, upstreamWebhookPrefix}},
+	{Name: "prometheus", Desc: "Prometheus 指标导出", Prefixes: []string{"/api/admin/prometheus"}},
+	{Name: "chaos", Desc: "故障注入", Prefixes: []string{"/api/admin/chaos"}},
+	{Name: "impersonation", Desc: "管理员代入账号", Prefixes: []string{impersonatePath}},
+}
+
+func (m apiModule) matches(r *http.Request) bool {
+	if hasAnyPrefix(r.URL.Path, m.Prefixes) {
+		return true
+	}
+	return m.match != nil && m.match(r)
+}
+
+func knownAPIModule(name string) bool {
+	for _, m := range apiModules {
+		if m.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// validateDisabledModules 校验 api.disabled_modules 只包含已知模块名。
+func validateDisabledModules(value any) error {
+	list, ok := value.([]any)
+	if !ok {
+		return fmt.Errorf("must be an array")
+	}
+	for _, v := range list {
+		name, _ := v.(string)
+		if !knownAPIModule(name) {
+			return fmt.Errorf("unknown module %v", v)
+		}
+	}
+	return nil
+}
+
+// disabledModules 读取当前停用的模块集合，未配置时为空。
+func (p *Server) disabledModules() map[string]bool {
+	if p.settingsCache == nil {
+		return nil
+	}
+	v, ok := p.settingsCache.Get(settingDisabledModules)
+	if !ok {
+		return nil
+	}
+	var names []string
+	switch list := v.(type) {
+	case []any:
+		for _, item := range list {
+			if s, ok := item.(string); ok {
+				names = append(names, s)
+			}
+		}
+	case []string:
+		names = list
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	out := make(map[string]bool, len(names))
+	for _, name := range names {
+		out[strings.TrimSpace(name)] = true
+	}
+	return out
+}
+
+// disabledModuleFor 返回请求命中的已停用模块名，未停用返回空字符串。
+func (p *Server) disabledModuleFor(r *http.Request) string {
+	disabled := p.disabledModules()
+	if len(disabled) == 0 {
+		return ""
+	}
+	for _, m := range apiModules {
+		if disabled[m.Name] && m.matches(r) {
+			return m.Name
+		}
+	}
+	return ""
+}
+
+// writeModuleDisabled 已登录请求返回 503 并说明模块，匿名请求返回 404，不暴露管理面结构。
+func writeModuleDisabled(w http.ResponseWriter, r *http.Request, module string) {
+	if c, err := r.Cookie("session_token"); err != nil || c.Value == "" {
+		http.NotFound(w, r)
+		return
+	}
+	writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "module disabled", "module": module})
+}
+
+// GET /api/admin/modules
+// 列出可停用的 API 模块及当前状态，修改通过系统配置 api.disabled_modules。
+func (p *Server) handleAPIModules(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if !isAdmin(r.Context()) {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+		return
+	}
+	disabled := p.disabledModules()
+	modules := make([]map[string]interface{}, 0, len(apiModules))
+	for _, m := range apiModules {
+		modules = append(modules, map[string]interface{}{
+			"name":     m.Name,
+			"desc":     m.Desc,
+			"prefixes": m.Prefixes,
+			"enabled":  !disabled[m.Name],
+		})
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"modules": modules, "setting": settingDisabledModules})
+}
@@ -34,18 +34,17 @@ type HealthSummary struct {
 	CheckMethod string  `json:"check_method"`  // 检查方式 api/head/cli
 }
 
+// MonitorNode 监控面板节点条目：内嵌与 WS node_metrics 相同的 NodeMetrics，id/name 为兼容旧客户端保留。
 type MonitorNode struct {
-	ID        string        `json:"id"`
-	Name      string        `json:"name"`
-	URL       string        `json:"url"`
-	Status    string        `json:"status"` // 综合状态: online/degraded/offline/unknown/disabled
-	Weight    int           `json:"weight"`
-	IsActive  bool          `json:"is_active"`
-	Disabled  bool          `json:"disabled"`
-	LastError string        `json:"last_error"`
-	Traffic   ProxySummary  `json:"traffic"` // 代理流量指标
-	Health    HealthSummary `json:"health"`  // 健康检查指标
-	Trend24h  []TrendPoint  `json:"trend_24h"`
+	NodeMetrics
+	ID        string       `json:"id"`
+	Name      string       `json:"name"`
+	URL       string       `json:"url"`
+	Weight    int          `json:"weight"`
+	IsActive  bool         `json:"is_active"`
+	Disabled  bool         `json:"disabled"`
+	LastError string       `json:"last_error"`
+	Trend24h  []TrendPoint `json:"trend_24h"`
 }
 
 type TrendPoint struct {
@@ -61,6 +60,7 @@ type nodeSnapshot struct {
 	Weight    int
 	Failed    bool
 	Disabled  bool
+	State     string
 	LastError string
 	Method    string
 	Metrics   metrics
@@ -103,7 +103,8 @@ func (p *Server) handleMonitorDashboard(w http.ResponseWriter, r *http.Request)
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "build dashboard failed"})
 		return
 	}
-	writeJSON(w, http.StatusOK, resp)
+	// updated_at 每次都会变化，ETag 仅基于节点内容计算。
+	writeJSONWithETag(w, r, computeETag(resp.AccountID, resp.AccountName, resp.Nodes), resp)
 }
 
 func (p *Server) buildMonitorDashboardResponse(ctx context.Context, target *Account) *MonitorDashboardResponse {
@@ -136,6 +137,7 @@ func (p *Server) buildMonitorDashboardResponse(ctx context.Context, target *Acco
 			Weight:    n.Weight,
 			Failed:    n.Failed,
 			Disabled:  n.Disabled,
+			State:     nodeState(n),
 			LastError: n.LastError,
 			Method:    n.HealthCheckMethod,
 			Metrics:   n.Metrics,
@@ -175,19 +177,15 @@ func (p *Server) buildMonitorDashboardResponse(ctx context.Context, target *Acco
 	}
 	nodes := make([]MonitorNode, 0, len(snapshots))
 	for _, snap := range snapshots {
-		traffic := summarizeTraffic(snap.Metrics)
-		health := summarizeHealth(snap.Metrics, snap.Method, healthInterval, now)
-
-		status := "unknown"
-		if snap.Disabled {
-			status = "disabled"
-		} else if snap.Failed || health.Status == "down" {
-			status = "offline"
-		} else if health.Status == "stale" {
-			status = "degraded"
-		} else {
-			status = "online"
-		}
+		current := buildNodeMetrics(nodeMetricsInput{
+			ID:       snap.ID,
+			Name:     snap.Name,
+			State:    snap.State,
+			Failed:   snap.Failed,
+			Disabled: snap.Disabled,
+			Method:   snap.Method,
+			Metrics:  snap.Metrics,
+		}, healthInterval, now)
 
 		lastError := snap.LastError
 		if lastError == "" {
@@ -195,17 +193,15 @@ func (p *Server) buildMonitorDashboardResponse(ctx context.Context, target *Acco
 		}
 
 		nodes = append(nodes, MonitorNode{
-			ID:        snap.ID,
-			Name:      snap.Name,
-			URL:       snap.URL,
-			Status:    status,
-			Weight:    snap.Weight,
-			IsActive:  snap.ID == activeID,
-			Disabled:  snap.Disabled,
-			LastError: lastError,
-			Traffic:   traffic,
-			Health:    health,
-			Trend24h:  buildTrendPoints(trendRecords[snap.ID]),
+			NodeMetrics: current,
+			ID:          snap.ID,
+			Name:        snap.Name,
+			URL:         snap.URL,
+			Weight:      snap.Weight,
+			IsActive:    snap.ID == activeID,
+			Disabled:    snap.Disabled,
+			LastError:   lastError,
+			Trend24h:    buildTrendPoints(trendRecords[snap.ID]),
 		})
 	}
 
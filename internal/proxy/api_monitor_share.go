@@ -13,9 +13,15 @@ import (
 	"qcc_plus/internal/timeutil"
 )
 
+const (
+	maxShareLabelLen = 128
+	maxShareDuration = 365 * 24 * time.Hour
+)
+
 type CreateMonitorShareRequest struct {
 	AccountID string `json:"account_id"` // 可选，管理员可指定，普通用户只能创建自己的
-	ExpireIn  string `json:"expire_in"`  // "1h", "24h", "168h"(7天), "permanent"
+	ExpireIn  string `json:"expire_in"`  // "1h", "24h", "168h"(7天), "30d" 等，或 "permanent"
+	Label     string `json:"label"`      // 可选备注，便于区分用途
 }
 
 type CreateMonitorShareResponse struct {
@@ -24,6 +30,7 @@ type CreateMonitorShareResponse struct {
 	ShareURL  string  `json:"share_url"`
 	ExpireAt  *string `json:"expire_at"` // RFC3339，永久时为 null
 	CreatedAt string  `json:"created_at"`
+	Label     string  `json:"label"`
 }
 
 func (p *Server) handleMonitorShares(w http.ResponseWriter, r *http.Request) {
@@ -74,6 +81,11 @@ func (p *Server) handleCreateMonitorShare(w http.ResponseWriter, r *http.Request
 		shareError(w, http.StatusBadRequest, "INVALID_EXPIRE", err.Error())
 		return
 	}
+	label := strings.TrimSpace(req.Label)
+	if len(label) > maxShareLabelLen {
+		shareError(w, http.StatusBadRequest, "INVALID_LABEL", "label too long")
+		return
+	}
 
 	token, err := generateShareToken()
 	if err != nil {
@@ -88,6 +100,7 @@ func (p *Server) handleCreateMonitorShare(w http.ResponseWriter, r *http.Request
 		Token:     token,
 		CreatedBy: caller.Name,
 		CreatedAt: now,
+		Label:     label,
 	}
 	if !expireAt.IsZero() {
 		rec.ExpireAt = expireAt
@@ -110,11 +123,12 @@ func (p *Server) handleCreateMonitorShare(w http.ResponseWriter, r *http.Request
 		ShareURL:  shareURL,
 		ExpireAt:  expireStr,
 		CreatedAt: timeutil.FormatBeijingTime(rec.CreatedAt),
+		Label:     rec.Label,
 	}
 	writeJSON(w, http.StatusCreated, resp)
 }
 
-// GET /api/monitor/shares
+// GET /api/monitor/shares?status=&created_by=&from=&to=
 func (p *Server) handleListMonitorShares(w http.ResponseWriter, r *http.Request) {
 	if p.store == nil {
 		shareError(w, http.StatusInternalServerError, "STORE_DISABLED", "store not enabled")
@@ -156,9 +170,31 @@ func (p *Server) handleListMonitorShares(w http.ResponseWriter, r *http.Request)
 		}
 	}
 
+	status := strings.ToLower(r.URL.Query().Get("status"))
+	switch status {
+	case "", store.MonitorShareActive, store.MonitorShareExpired, store.MonitorShareRevoked:
+	default:
+		shareError(w, http.StatusBadRequest, "INVALID_STATUS", "invalid status")
+		return
+	}
+	from, err := parseTime(r.URL.Query().Get("from"))
+	if err != nil {
+		shareError(w, http.StatusBadRequest, "INVALID_TIME", "invalid from")
+		return
+	}
+	to, err := parseTime(r.URL.Query().Get("to"))
+	if err != nil {
+		shareError(w, http.StatusBadRequest, "INVALID_TIME", "invalid to")
+		return
+	}
+
 	params := store.QueryMonitorSharesParams{
 		AccountID:      targetID,
 		IncludeRevoked: includeRevoked,
+		Status:         status,
+		CreatedBy:      r.URL.Query().Get("created_by"),
+		CreatedFrom:    from,
+		CreatedTo:      to,
 		Limit:          limit,
 		Offset:         offset,
 	}
@@ -172,29 +208,10 @@ func (p *Server) handleListMonitorShares(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	now := time.Now().UTC()
 	resp := make([]map[string]interface{}, 0, len(records))
 	for _, rec := range records {
-		expireStr := (*string)(nil)
-		if !rec.ExpireAt.IsZero() {
-			s := timeutil.FormatBeijingTime(rec.ExpireAt)
-			expireStr = &s
-		}
-		var revokedAt *string
-		if rec.RevokedAt != nil {
-			s := timeutil.FormatBeijingTime(*rec.RevokedAt)
-			revokedAt = &s
-		}
-		resp = append(resp, map[string]interface{}{
-			"id":         rec.ID,
-			"account_id": rec.AccountID,
-			"token":      rec.Token,
-			"share_url":  buildShareURL(r, rec.Token),
-			"expire_at":  expireStr,
-			"created_at": timeutil.FormatBeijingTime(rec.CreatedAt),
-			"created_by": rec.CreatedBy,
-			"revoked":    rec.Revoked,
-			"revoked_at": revokedAt,
-		})
+		resp = append(resp, monitorShareView(r, rec, now))
 	}
 	writeJSON(w, http.StatusOK, map[string]interface{}{"shares": resp})
 }
@@ -244,6 +261,7 @@ func (p *Server) handleRevokeMonitorShare(w http.ResponseWriter, r *http.Request
 		shareError(w, http.StatusInternalServerError, "REVOKE_FAILED", err.Error())
 		return
 	}
+	p.badges.forget(rec.Token)
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -289,15 +307,43 @@ func (p *Server) handleAccessMonitorShare(w http.ResponseWriter, r *http.Request
 	writeJSON(w, http.StatusOK, resp)
 }
 
+// monitorShareView 将分享记录转换为接口输出，附带分享链接与状态。
+func monitorShareView(r *http.Request, rec store.MonitorShareRecord, now time.Time) map[string]interface{} {
+	expireStr := (*string)(nil)
+	if !rec.ExpireAt.IsZero() {
+		s := timeutil.FormatBeijingTime(rec.ExpireAt)
+		expireStr = &s
+	}
+	var revokedAt *string
+	if rec.RevokedAt != nil {
+		s := timeutil.FormatBeijingTime(*rec.RevokedAt)
+		revokedAt = &s
+	}
+	return map[string]interface{}{
+		"id":         rec.ID,
+		"account_id": rec.AccountID,
+		"token":      rec.Token,
+		"share_url":  buildShareURL(r, rec.Token),
+		"label":      rec.Label,
+		"status":     rec.Status(now),
+		"expire_at":  expireStr,
+		"created_at": timeutil.FormatBeijingTime(rec.CreatedAt),
+		"created_by": rec.CreatedBy,
+		"revoked":    rec.Revoked,
+		"revoked_at": revokedAt,
+	}
+}
+
 func parseShareExpire(val string) (time.Time, error) {
 	now := time.Now().UTC()
-	switch strings.ToLower(strings.TrimSpace(val)) {
-	case "1h":
-		return now.Add(time.Hour), nil
-	case "24h":
-		return now.Add(24 * time.Hour), nil
-	case "168h":
-		return now.Add(168 * time.Hour), nil
+	v := strings.ToLower(strings.TrimSpace(val))
+	if d, ok := parseShareDuration(v); ok {
+		if d <= 0 || d > maxShareDuration {
+			return time.Time{}, fmt.Errorf("expire_in out of range: %s", val)
+		}
+		return now.Add(d), nil
+	}
+	switch v {
 	case "permanent":
 		return time.Time{}, nil
 	case "":
@@ -307,6 +353,25 @@ func parseShareExpire(val string) (time.Time, error) {
 	}
 }
 
+// parseShareDuration 解析 "Nd" 或 Go duration 形式的有效期。
+func parseShareDuration(v string) (time.Duration, bool) {
+	if strings.HasSuffix(v, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(v, "d"))
+		if err != nil {
+			return 0, false
+		}
+		return time.Duration(days) * 24 * time.Hour, true
+	}
+	if v == "" || v == "permanent" {
+		return 0, false
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, false
+	}
+	return d, true
+}
+
 func shareError(w http.ResponseWriter, status int, code, msg string) {
 	writeJSON(w, status, map[string]string{
 		"error": msg,
@@ -1,40 +1,29 @@
 package proxy
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"sort"
 	"time"
 
+	"qcc_plus/internal/store"
 	"qcc_plus/internal/timeutil"
 )
 
+// nodeRollbackAttempts 创建失败回滚时删除节点记录的尝试次数。
+const nodeRollbackAttempts = 3
+
 func (p *Server) handleNodes(w http.ResponseWriter, r *http.Request) {
-	acc := accountFromCtx(r)
-	if acc == nil {
-		acc = p.defaultAccount
-	}
-	if isAdmin(r.Context()) {
-		if aid := r.URL.Query().Get("account_id"); aid != "" {
-			target := p.getAccountByID(aid)
-			if target == nil {
-				writeJSON(w, http.StatusNotFound, map[string]string{"error": "account not found"})
-				return
-			}
-			acc = target
-		}
-	} else if q := r.URL.Query().Get("account_id"); q != "" && acc != nil && q != acc.ID {
-		writeJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
-		return
-	}
-	if acc == nil {
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "account missing"})
+	acc, ok := p.nodesAccount(w, r)
+	if !ok {
 		return
 	}
 	switch r.Method {
 	case http.MethodGet:
-		writeJSON(w, http.StatusOK, map[string]interface{}{"nodes": p.listNodes(acc)})
+		nodes := p.listNodes(acc)
+		writeJSONWithETag(w, r, computeETag(acc.ID, nodes), map[string]interface{}{"nodes": nodes})
 	case http.MethodPut:
 		id := r.URL.Query().Get("id")
 		if id == "" {
@@ -87,28 +76,157 @@ func (p *Server) handleNodes(w http.ResponseWriter, r *http.Request) {
 		}
 		writeJSON(w, http.StatusOK, map[string]string{"deleted": id})
 	case http.MethodPost:
-		var req struct {
-			BaseURL           string `json:"base_url"`
-			APIKey            string `json:"api_key"`
-			Name              string `json:"name"`
-			Weight            int    `json:"weight"`
-			HealthCheckMethod string `json:"health_check_method"`
-		}
+		var req nodeCreateRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
 			return
 		}
-		node, err := p.addNodeWithMethod(acc, req.Name, req.BaseURL, req.APIKey, req.Weight, req.HealthCheckMethod)
+		node, outcome, conflict, err := p.createNodeWithDedup(acc, req)
 		if err != nil {
 			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
 			return
 		}
+		if conflict != nil {
+			writeJSON(w, http.StatusConflict, nodeConflict(conflict))
+			return
+		}
+		if outcome != "created" {
+			writeJSON(w, http.StatusOK, map[string]interface{}{"id": node.ID, "status": outcome})
+			return
+		}
 		writeJSON(w, http.StatusCreated, map[string]interface{}{"id": node.ID})
 	default:
 		w.WriteHeader(http.StatusMethodNotAllowed)
 	}
 }
 
+// handleCreateNode 处理 POST /api/nodes：创建节点后立即执行一次健康检查，同步写入首条健康历史与一条
+// 零请求的指标记录，返回节点完整初始状态，前端创建后即可看到健康状态与指标曲线的起点。
+// 任一步写入失败时回滚节点；回滚本身失败时响应带 partial=true 与 node_id，提示需手动删除残留的节点。
+// 与已有节点重复时按 on_duplicate 处理，未指定则返回 409。
+func (p *Server) handleCreateNode(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	acc, ok := p.nodesAccount(w, r)
+	if !ok {
+		return
+	}
+	var req nodeCreateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
+		return
+	}
+	node, outcome, conflict, err := p.createNodeWithDedup(acc, req)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	if conflict != nil {
+		writeJSON(w, http.StatusConflict, nodeConflict(conflict))
+		return
+	}
+	if outcome != "created" {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"node": p.nodeView(acc, node.ID), "status": outcome})
+		return
+	}
+	result, err := p.runHealthCheck(acc, node.ID, true)
+	msg := ""
+	switch {
+	case err != nil:
+		msg = "record initial health check failed: " + err.Error()
+	case result == nil:
+		msg = "initial health check failed"
+	default:
+		if err := p.seedNodeMetrics(acc.ID, node.ID); err != nil {
+			msg = "seed initial metrics failed: " + err.Error()
+		}
+	}
+	if msg != "" {
+		res := map[string]interface{}{"error": msg}
+		if delErr := p.rollbackCreatedNode(node.ID); delErr != nil {
+			p.logger.Printf("rollback node %s failed: %v", node.ID, delErr)
+			res["partial"] = true
+			res["node_id"] = node.ID
+			res["rollback_error"] = delErr.Error()
+		}
+		writeJSON(w, http.StatusInternalServerError, res)
+		return
+	}
+	p.audit(acc.ID, auditActor(r), "node.create", node.ID, map[string]interface{}{"name": node.Name, "healthy": result.OK})
+
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"node":         p.nodeView(acc, node.ID),
+		"status":       outcome,
+		"health_check": result.view(),
+	})
+}
+
+// seedNodeMetrics 为新节点写入一条零请求的原始指标，使指标查询从创建时刻起有数据点。
+func (p *Server) seedNodeMetrics(accountID, nodeID string) error {
+	if p.store == nil {
+		return nil
+	}
+	return p.store.InsertMetrics(context.Background(), store.MetricsRecord{
+		AccountID: accountID,
+		NodeID:    nodeID,
+		Timestamp: time.Now().UTC(),
+	})
+}
+
+// rollbackCreatedNode 删除创建失败的节点。deleteNode 先移除内存中的节点再删除存储记录，
+// 存储删除失败时单独重试，仍失败则返回错误，由调用方告知客户端存在残留记录。
+func (p *Server) rollbackCreatedNode(id string) error {
+	err := p.deleteNode(id)
+	if err == nil || p.store == nil || p.getNode(id) != nil {
+		return err
+	}
+	for attempt := 1; attempt < nodeRollbackAttempts; attempt++ {
+		time.Sleep(time.Duration(attempt) * 100 * time.Millisecond)
+		if err = p.store.DeleteNode(context.Background(), id); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// nodesAccount 解析节点接口操作的账号：管理员可通过 account_id 指定，其他账号只能操作自己。
+func (p *Server) nodesAccount(w http.ResponseWriter, r *http.Request) (*Account, bool) {
+	acc := accountFromCtx(r)
+	if acc == nil {
+		acc = p.defaultAccount
+	}
+	if isAdmin(r.Context()) {
+		if aid := r.URL.Query().Get("account_id"); aid != "" {
+			target := p.getAccountByID(aid)
+			if target == nil {
+				writeJSON(w, http.StatusNotFound, map[string]string{"error": "account not found"})
+				return nil, false
+			}
+			acc = target
+		}
+	} else if q := r.URL.Query().Get("account_id"); q != "" && acc != nil && q != acc.ID {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+		return nil, false
+	}
+	if acc == nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "account missing"})
+		return nil, false
+	}
+	return acc, true
+}
+
+// nodeView 返回单个节点的列表视图，不存在时返回 nil。
+func (p *Server) nodeView(acc *Account, id string) map[string]interface{} {
+	for _, v := range p.listNodes(acc) {
+		if v["id"] == id {
+			return v
+		}
+	}
+	return nil
+}
+
 // 列出节点，标注是否激活和是否含密钥。
 func (p *Server) listNodes(acc *Account) []map[string]interface{} {
 	if acc == nil {
@@ -122,6 +240,8 @@ func (p *Server) listNodes(acc *Account) []map[string]interface{} {
 		createdAt time.Time
 	}
 	views := make([]nodeView, 0, len(acc.Nodes))
+	providers := p.upstreamProviders()
+	now := time.Now()
 	for id, n := range acc.Nodes {
 		healthMethod := normalizeHealthCheckMethod(n.HealthCheckMethod)
 		avgPerToken := "-"
@@ -138,6 +258,24 @@ func (p *Server) listNodes(acc *Account) []map[string]interface{} {
 			}
 		}
 		lastHealthCheckAt := timeutil.FormatBeijingTime(n.Metrics.LastHealthCheckAt)
+		var upstream interface{}
+		if provider := upstreamProviderFor(providers, n.URL); provider != "" {
+			if inc := p.upstreamStatus.active(provider); inc != nil {
+				upstream = inc.view()
+			}
+		}
+		var clientCert interface{}
+		if n.ClientCert != nil {
+			clientCert = n.ClientCert.view(now)
+		}
+		var caBundle interface{}
+		if n.CABundle != nil {
+			caBundle = n.CABundle.view(now)
+		}
+		var dns interface{}
+		if n.DNS != nil {
+			dns = n.DNS.view()
+		}
 		views = append(views, nodeView{
 			weight:    n.Weight,
 			createdAt: n.CreatedAt,
@@ -146,6 +284,10 @@ func (p *Server) listNodes(acc *Account) []map[string]interface{} {
 				"name":                  n.Name,
 				"base_url":              n.URL.String(),
 				"health_check_method":   healthMethod,
+				"health_interval_sec":   int(n.HealthInterval / time.Second),
+				"health_effective_ms":   p.nodeHealthInterval(acc, n).Milliseconds(),
+				"health_fail_streak":    n.HealthFailStreak,
+				"header_names":          nodeHeaderNames(n.Headers),
 				"active":                id == acc.ActiveID,
 				"has_api_key":           n.APIKey != "",
 				"created_at":            timeutil.FormatBeijingTime(n.CreatedAt),
@@ -157,6 +299,7 @@ func (p *Server) listNodes(acc *Account) []map[string]interface{} {
 				"ping_error":            n.Metrics.LastPingErr,
 				"last_ping_ms":          n.Metrics.LastPingMS,
 				"last_ping_error":       n.Metrics.LastPingErr,
+				"last_dns_ms":           n.Metrics.LastDNSMS,
 				"last_health_check_at":  lastHealthCheckAt,
 				"input_tokens":          n.Metrics.TotalInputTokens,
 				"output_tokens":         n.Metrics.TotalOutputTokens,
@@ -165,9 +308,17 @@ func (p *Server) listNodes(acc *Account) []map[string]interface{} {
 				"first_byte_ms":         n.Metrics.FirstByteDur.Milliseconds(),
 				"avg_recv_ms_per_token": avgPerToken,
 				"weight":                n.Weight,
+				"adaptive_weight":       n.AdaptiveWeight,
 				"failed":                n.Failed,
 				"disabled":              n.Disabled,
+				"state":                 nodeState(n),
+				"state_changed_at":      timeutil.FormatBeijingTime(n.StateChangedAt),
+				"inflight":              p.nodeInflight(id),
 				"last_error":            n.LastError,
+				"upstream_incident":     upstream,
+				"client_cert":           clientCert,
+				"ca_bundle":             caBundle,
+				"dns":                   dns,
 			},
 		})
 	}
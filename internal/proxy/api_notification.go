@@ -130,20 +130,29 @@ func (p *Server) createNotificationChannel(w http.ResponseWriter, r *http.Reques
 		ChannelType string          `json:"channel_type"`
 		Config      json.RawMessage `json:"config"`
 		Enabled     *bool           `json:"enabled"`
+		DigestMode  string          `json:"digest_mode"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
 		return
 	}
+	if !notify.ValidDigestMode(req.DigestMode) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported digest_mode"})
+		return
+	}
 	if !isSupportedChannel(req.ChannelType) {
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported channel_type"})
 		return
 	}
-	cfg, err := validateChannelConfig(req.ChannelType, req.Config)
+	cfg, secret, err := validateChannelConfig(req.ChannelType, req.Config)
 	if err != nil {
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
 		return
 	}
+	if notify.NeedsSecret(req.ChannelType) && secret == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": secretFieldFor(req.ChannelType) + " required"})
+		return
+	}
 	enabled := true
 	if req.Enabled != nil {
 		enabled = *req.Enabled
@@ -158,6 +167,7 @@ func (p *Server) createNotificationChannel(w http.ResponseWriter, r *http.Reques
 		Name:        req.Name,
 		Config:      cfg,
 		Enabled:     enabled,
+		DigestMode:  chooseNonEmpty(req.DigestMode, store.DigestImmediate),
 		CreatedAt:   time.Now(),
 		UpdatedAt:   time.Now(),
 	}
@@ -166,6 +176,13 @@ func (p *Server) createNotificationChannel(w http.ResponseWriter, r *http.Reques
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "create channel failed"})
 		return
 	}
+	if secret != "" {
+		if err := p.saveChannelSecret(rec, secret, auditActor(r)); err != nil {
+			p.logger.Printf("save channel secret failed: %v", err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "save channel secret failed"})
+			return
+		}
+	}
 	writeJSON(w, http.StatusCreated, channelView(rec))
 }
 
@@ -199,11 +216,19 @@ func (p *Server) updateNotificationChannel(w http.ResponseWriter, r *http.Reques
 		ChannelType *string         `json:"channel_type"`
 		Config      json.RawMessage `json:"config"`
 		Enabled     *bool           `json:"enabled"`
+		DigestMode  *string         `json:"digest_mode"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
 		return
 	}
+	if req.DigestMode != nil {
+		if !notify.ValidDigestMode(*req.DigestMode) {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported digest_mode"})
+			return
+		}
+		rec.DigestMode = chooseNonEmpty(*req.DigestMode, store.DigestImmediate)
+	}
 	if req.ChannelType != nil {
 		if !isSupportedChannel(*req.ChannelType) {
 			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported channel_type"})
@@ -211,13 +236,22 @@ func (p *Server) updateNotificationChannel(w http.ResponseWriter, r *http.Reques
 		}
 		rec.ChannelType = *req.ChannelType
 	}
+	secret := ""
 	if len(req.Config) > 0 {
-		cfg, err := validateChannelConfig(rec.ChannelType, req.Config)
+		cfg, s, err := validateChannelConfig(rec.ChannelType, req.Config)
 		if err != nil {
 			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
 			return
 		}
 		rec.Config = cfg
+		secret = s
+	}
+	// 未提供新密钥时沿用已保存的密钥
+	if notify.NeedsSecret(rec.ChannelType) && secret == "" {
+		if existing, err := p.channelSecret(r.Context(), *rec); err != nil || existing == "" {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": secretFieldFor(rec.ChannelType) + " required"})
+			return
+		}
 	}
 	if req.Name != nil {
 		rec.Name = *req.Name
@@ -239,6 +273,13 @@ func (p *Server) updateNotificationChannel(w http.ResponseWriter, r *http.Reques
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "update failed"})
 		return
 	}
+	if secret != "" {
+		if err := p.saveChannelSecret(*rec, secret, auditActor(r)); err != nil {
+			p.logger.Printf("save channel secret failed: %v", err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "save channel secret failed"})
+			return
+		}
+	}
 	writeJSON(w, http.StatusOK, channelView(*rec))
 }
 
@@ -276,6 +317,11 @@ func (p *Server) deleteNotificationChannel(w http.ResponseWriter, r *http.Reques
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "delete failed"})
 		return
 	}
+	if notify.NeedsSecret(rec.ChannelType) {
+		if err := p.store.DeleteSetting(notify.ChannelSecretKey(id), "account", rec.AccountID); err != nil && !errors.Is(err, store.ErrNotFound) {
+			p.logger.Printf("delete channel secret failed: %v", err)
+		}
+	}
 	writeJSON(w, http.StatusOK, map[string]string{"deleted": id})
 }
 
@@ -548,13 +594,25 @@ func (p *Server) testNotification(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
 		return
 	}
-	ch, err := notify.BuildChannel(*chRec)
+	secret, err := p.channelSecret(r.Context(), *chRec)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": secretFieldFor(chRec.ChannelType) + " not configured"})
+		return
+	}
+	ch, err := notify.BuildChannel(*chRec, secret)
 	if err != nil {
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
 		return
 	}
 	ctx, cancel := context.WithTimeout(r.Context(), 8*time.Second)
 	defer cancel()
+	// 测试通知与正式投递使用相同的签名，便于接收方验证校验逻辑。
+	keys, err := notify.NewStoreAdapter(p.store).WebhookSigningKeys(ctx, chRec.AccountID)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "load webhook signing keys failed"})
+		return
+	}
+	notify.WithSigningKeys(ch, keys)
 	msg := notify.NotificationMessage{
 		AccountID:  chRec.AccountID,
 		EventType:  "test",
@@ -577,6 +635,7 @@ func channelView(rec store.NotificationChannelRecord) map[string]interface{} {
 		"name":         rec.Name,
 		"channel_type": rec.ChannelType,
 		"enabled":      rec.Enabled,
+		"digest_mode":  chooseNonEmpty(rec.DigestMode, store.DigestImmediate),
 		"created_at":   timeutil.FormatBeijingTime(rec.CreatedAt),
 		"updated_at":   timeutil.FormatBeijingTime(rec.UpdatedAt),
 	}
@@ -596,16 +655,17 @@ func subscriptionView(rec store.NotificationSubscriptionRecord) map[string]inter
 // channel与订阅校验相关辅助函数。
 func isSupportedChannel(tp string) bool {
 	switch tp {
-	case notify.ChannelWechatWork, notify.ChannelWechatPersonal:
+	case notify.ChannelWechatWork, notify.ChannelWechatPersonal, notify.ChannelPagerDuty, notify.ChannelOpsgenie, notify.ChannelWebhook:
 		return true
 	default:
 		return false
 	}
 }
 
-func validateChannelConfig(channelType string, raw json.RawMessage) (json.RawMessage, error) {
+// validateChannelConfig 校验渠道配置；值班渠道的密钥从配置中剥离后单独返回，存入 is_secret 的 settings。
+func validateChannelConfig(channelType string, raw json.RawMessage) (json.RawMessage, string, error) {
 	if len(raw) == 0 {
-		return nil, errors.New("config required")
+		return nil, "", errors.New("config required")
 	}
 	switch channelType {
 	case notify.ChannelWechatWork, notify.ChannelWechatPersonal:
@@ -613,18 +673,86 @@ func validateChannelConfig(channelType string, raw json.RawMessage) (json.RawMes
 			WebhookURL string `json:"webhook_url"`
 		}
 		if err := json.Unmarshal(raw, &cfg); err != nil {
-			return nil, fmt.Errorf("invalid config: %w", err)
+			return nil, "", fmt.Errorf("invalid config: %w", err)
 		}
 		if cfg.WebhookURL == "" {
-			return nil, errors.New("webhook_url required")
+			return nil, "", errors.New("webhook_url required")
 		}
 		if err := validateURL(cfg.WebhookURL); err != nil {
-			return nil, err
+			return nil, "", err
+		}
+		return raw, "", nil
+	case notify.ChannelWebhook:
+		var cfg struct {
+			URL string `json:"url"`
+		}
+		if err := json.Unmarshal(raw, &cfg); err != nil {
+			return nil, "", fmt.Errorf("invalid config: %w", err)
+		}
+		if err := validateURL(cfg.URL); err != nil {
+			return nil, "", err
+		}
+		return raw, "", nil
+	case notify.ChannelPagerDuty, notify.ChannelOpsgenie:
+		var cfg map[string]interface{}
+		if err := json.Unmarshal(raw, &cfg); err != nil {
+			return nil, "", fmt.Errorf("invalid config: %w", err)
+		}
+		field := secretFieldFor(channelType)
+		secret, _ := cfg[field].(string)
+		delete(cfg, field)
+		if apiURL, ok := cfg["api_url"].(string); ok && apiURL != "" {
+			if err := validateURL(apiURL); err != nil {
+				return nil, "", errors.New("api_url invalid")
+			}
 		}
-		return raw, nil
+		if region, ok := cfg["region"].(string); ok && channelType == notify.ChannelOpsgenie && region != "us" && region != "eu" {
+			return nil, "", errors.New("region must be us or eu")
+		}
+		clean, err := json.Marshal(cfg)
+		if err != nil {
+			return nil, "", err
+		}
+		return clean, strings.TrimSpace(secret), nil
 	default:
-		return nil, fmt.Errorf("unsupported channel_type: %s", channelType)
+		return nil, "", fmt.Errorf("unsupported channel_type: %s", channelType)
+	}
+}
+
+// secretFieldFor 返回值班渠道配置中的密钥字段名。
+func secretFieldFor(channelType string) string {
+	if channelType == notify.ChannelOpsgenie {
+		return "api_key"
+	}
+	return "routing_key"
+}
+
+// saveChannelSecret 将渠道密钥保存为账号级 is_secret 配置，接口读取时会被掩码。
+func (p *Server) saveChannelSecret(rec store.NotificationChannelRecord, secret, updatedBy string) error {
+	accountID := rec.AccountID
+	desc := fmt.Sprintf("通知渠道 %s 的 %s", rec.Name, secretFieldFor(rec.ChannelType))
+	setting := &store.Setting{
+		Key:         notify.ChannelSecretKey(rec.ID),
+		Scope:       "account",
+		AccountID:   &accountID,
+		Value:       secret,
+		DataType:    "string",
+		Category:    "notification",
+		Description: &desc,
+		IsSecret:    true,
+	}
+	if updatedBy != "" {
+		setting.UpdatedBy = &updatedBy
+	}
+	return p.store.UpsertSetting(setting)
+}
+
+// channelSecret 读取渠道密钥，不需要密钥的渠道返回空串。
+func (p *Server) channelSecret(ctx context.Context, rec store.NotificationChannelRecord) (string, error) {
+	if !notify.NeedsSecret(rec.ChannelType) {
+		return "", nil
 	}
+	return notify.NewStoreAdapter(p.store).GetChannelSecret(ctx, rec.AccountID, rec.ID)
 }
 
 func validateURL(raw string) error {
@@ -668,6 +796,8 @@ func eventTypeCatalog() []eventTypeInfo {
 		{notify.EventNodeEnabled, "node", "节点启用"},
 		{notify.EventNodeDisabled, "node", "节点禁用"},
 		{notify.EventNodeHealthCheckError, "node", "节点健康检查失败"},
+		{notify.EventNodeBenchmarkRegressed, "node", "节点压测性能退化"},
+		{notify.EventNodeCertExpiring, "node", "节点客户端证书即将到期"},
 		{notify.EventRequestFailed, "request", "请求失败"},
 		{notify.EventRequestUpstreamErr, "request", "上游错误"},
 		{notify.EventRequestProxyError, "request", "代理错误"},
@@ -0,0 +1,156 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"qcc_plus/internal/store"
+)
+
+const sharesAPIPrefix = "/api/shares/"
+
+// handleShareByID 处理单个分享链接：
+// GET /api/shares/:id、PATCH /api/shares/:id、DELETE /api/shares/:id[?purge=true]、POST /api/shares/:id/regenerate
+func (p *Server) handleShareByID(w http.ResponseWriter, r *http.Request) {
+	if p.store == nil {
+		shareError(w, http.StatusInternalServerError, "STORE_DISABLED", "store not enabled")
+		return
+	}
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, sharesAPIPrefix), "/")
+	id, action, _ := strings.Cut(rest, "/")
+	if id == "" {
+		http.NotFound(w, r)
+		return
+	}
+	rec, ok := p.shareForCaller(w, r, id)
+	if !ok {
+		return
+	}
+
+	switch {
+	case action == "regenerate" && r.Method == http.MethodPost:
+		p.regenerateShare(w, r, rec)
+	case action != "":
+		http.NotFound(w, r)
+	case r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, monitorShareView(r, *rec, time.Now().UTC()))
+	case r.Method == http.MethodPatch:
+		p.updateShare(w, r, rec)
+	case r.Method == http.MethodDelete:
+		p.deleteShare(w, r, rec)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// shareForCaller 读取分享记录并校验调用方归属。
+func (p *Server) shareForCaller(w http.ResponseWriter, r *http.Request, id string) (*store.MonitorShareRecord, bool) {
+	caller := accountFromCtx(r)
+	if caller == nil {
+		shareError(w, http.StatusUnauthorized, "UNAUTHORIZED", "unauthorized")
+		return nil, false
+	}
+	rec, err := p.store.GetMonitorShareByID(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			shareError(w, http.StatusNotFound, "SHARE_NOT_FOUND", "share not found")
+			return nil, false
+		}
+		shareError(w, http.StatusInternalServerError, "GET_FAILED", err.Error())
+		return nil, false
+	}
+	if !isAdmin(r.Context()) && rec.AccountID != caller.ID {
+		// 不暴露其他账号分享的存在性。
+		shareError(w, http.StatusNotFound, "SHARE_NOT_FOUND", "share not found")
+		return nil, false
+	}
+	return rec, true
+}
+
+func (p *Server) updateShare(w http.ResponseWriter, r *http.Request, rec *store.MonitorShareRecord) {
+	var req struct {
+		ExpireIn *string `json:"expire_in"`
+		Label    *string `json:"label"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		shareError(w, http.StatusBadRequest, "INVALID_REQUEST", "invalid json")
+		return
+	}
+	if rec.Revoked {
+		shareError(w, http.StatusConflict, "SHARE_REVOKED", "share revoked")
+		return
+	}
+	expireAt := rec.ExpireAt
+	if req.ExpireIn != nil {
+		t, err := parseShareExpire(*req.ExpireIn)
+		if err != nil {
+			shareError(w, http.StatusBadRequest, "INVALID_EXPIRE", err.Error())
+			return
+		}
+		expireAt = t
+	}
+	label := rec.Label
+	if req.Label != nil {
+		label = strings.TrimSpace(*req.Label)
+		if len(label) > maxShareLabelLen {
+			shareError(w, http.StatusBadRequest, "INVALID_LABEL", "label too long")
+			return
+		}
+	}
+	if err := p.store.UpdateMonitorShare(r.Context(), rec.ID, expireAt, label); err != nil {
+		shareError(w, http.StatusInternalServerError, "UPDATE_FAILED", err.Error())
+		return
+	}
+	rec.ExpireAt = expireAt
+	rec.Label = label
+	p.audit(rec.AccountID, auditActor(r), "share.update", rec.ID, map[string]string{"label": label})
+	writeJSON(w, http.StatusOK, monitorShareView(r, *rec, time.Now().UTC()))
+}
+
+func (p *Server) regenerateShare(w http.ResponseWriter, r *http.Request, rec *store.MonitorShareRecord) {
+	if rec.Revoked {
+		shareError(w, http.StatusConflict, "SHARE_REVOKED", "share revoked")
+		return
+	}
+	token, err := generateShareToken()
+	if err != nil {
+		shareError(w, http.StatusInternalServerError, "TOKEN_GEN_FAILED", "token generation failed")
+		return
+	}
+	if err := p.store.RegenerateMonitorShareToken(r.Context(), rec.ID, token); err != nil {
+		shareError(w, http.StatusInternalServerError, "REGENERATE_FAILED", err.Error())
+		return
+	}
+	p.badges.forget(rec.Token)
+	rec.Token = token
+	p.audit(rec.AccountID, auditActor(r), "share.regenerate", rec.ID, nil)
+	writeJSON(w, http.StatusOK, monitorShareView(r, *rec, time.Now().UTC()))
+}
+
+func (p *Server) deleteShare(w http.ResponseWriter, r *http.Request, rec *store.MonitorShareRecord) {
+	purge := r.URL.Query().Get("purge") == "true"
+	var err error
+	if purge {
+		err = p.store.DeleteMonitorShare(r.Context(), rec.ID)
+	} else {
+		err = p.store.RevokeMonitorShare(r.Context(), rec.ID)
+	}
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			shareError(w, http.StatusNotFound, "SHARE_NOT_FOUND", "share not found")
+			return
+		}
+		shareError(w, http.StatusInternalServerError, "REVOKE_FAILED", err.Error())
+		return
+	}
+	p.badges.forget(rec.Token)
+	action := "share.revoke"
+	if purge {
+		action = "share.delete"
+	}
+	p.audit(rec.AccountID, auditActor(r), action, rec.ID, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
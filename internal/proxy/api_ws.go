@@ -23,23 +23,44 @@ func (p *Server) handleMonitorWebSocket(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	accountID, err := p.authenticateWSRequest(r)
+	accountID, isShare, err := p.authenticateWSRequest(r)
 	if err != nil {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
+	shareToken := ""
+	if isShare {
+		shareToken = r.URL.Query().Get("token")
+	}
+	// 升级前占用名额，避免单个租户的大量看板连接耗尽 hub 资源。
+	if err := p.wsHub.reserve(accountID, shareToken, p.wsLimits()); err != nil {
+		w.Header().Set("Retry-After", "30")
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return
+	}
 
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
+		p.wsHub.release(accountID, shareToken)
 		p.logger.Printf("websocket upgrade failed: %v", err)
 		return
 	}
 
 	client := &WSClient{
-		hub:       p.wsHub,
-		conn:      conn,
-		accountID: accountID,
-		send:      make(chan []byte, 256),
+		hub:        p.wsHub,
+		conn:       conn,
+		accountID:  accountID,
+		send:       make(chan []byte, 256),
+		isShare:    isShare,
+		shareToken: shareToken,
+		server:     p,
+	}
+	if acc := p.getAccountByID(accountID); acc != nil && !isShare {
+		client.isAdmin = acc.IsAdmin
+	}
+	// 注册前写入初始快照，保证 initial_state 是客户端收到的第一条消息。
+	if data := p.initialStateMessage(client); data != nil {
+		client.send <- data
 	}
 	p.wsHub.register <- client
 
@@ -47,27 +68,27 @@ func (p *Server) handleMonitorWebSocket(w http.ResponseWriter, r *http.Request)
 	go client.readPump()
 }
 
-// authenticateWSRequest 支持 session cookie 或分享 token。
-func (p *Server) authenticateWSRequest(r *http.Request) (string, error) {
+// authenticateWSRequest 支持 session cookie 或分享 token，返回账号及是否为分享连接。
+func (p *Server) authenticateWSRequest(r *http.Request) (string, bool, error) {
 	// Session cookie
 	if sess := getSessionFromCookie(p.sessionMgr, r); sess != nil {
-		return sess.AccountID, nil
+		return sess.AccountID, false, nil
 	}
 
 	// Share token
 	shareToken := r.URL.Query().Get("token")
 	if shareToken != "" {
 		if p.store == nil {
-			return "", errors.New("share token not supported")
+			return "", false, errors.New("share token not supported")
 		}
 		share, err := p.store.GetMonitorShareByToken(r.Context(), shareToken)
 		if err != nil || share == nil {
-			return "", errors.New("invalid share token")
+			return "", false, errors.New("invalid share token")
 		}
-		return share.AccountID, nil
+		return share.AccountID, true, nil
 	}
 
-	return "", errors.New("authentication required")
+	return "", false, errors.New("authentication required")
 }
 
 // getSessionFromCookie 返回有效会话。
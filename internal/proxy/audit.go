@@ -0,0 +1,132 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"qcc_plus/internal/store"
+)
+
+const auditActorSystem = "system"
+
+// audit 异步写入审计日志；detail 会被序列化为 JSON。
+func (p *Server) audit(accountID, actor, action, target string, detail interface{}) {
+	if p == nil || p.store == nil {
+		return
+	}
+	body := ""
+	if detail != nil {
+		if b, err := json.Marshal(detail); err == nil {
+			body = string(b)
+		}
+	}
+	rec := store.AuditLogRecord{
+		AccountID: chooseNonEmpty(accountID, store.DefaultAccountID),
+		Actor:     chooseNonEmpty(actor, auditActorSystem),
+		Action:    action,
+		Target:    target,
+		Detail:    body,
+		CreatedAt: time.Now().UTC(),
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancel()
+		if err := p.store.InsertAuditLog(ctx, rec); err != nil && p.logger != nil {
+			p.logger.Printf("insert audit log %s failed: %v", action, err)
+		}
+	}()
+}
+
+// auditActor 返回当前请求的操作者标识；代入期间记为实际操作的管理员。
+func auditActor(r *http.Request) string {
+	if imp := impersonationFromCtx(r); imp != nil {
+		return imp.Impersonator
+	}
+	if u := sessionUserFromCtx(r.Context()); u != nil {
+		return u.ID
+	}
+	if acc := accountFromCtx(r); acc != nil {
+		return acc.ID
+	}
+	return auditActorSystem
+}
+
+// GET /api/audit-logs?account_id=&action=&from=&to=&limit=&offset=
+func (p *Server) handleAuditLogs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if p.store == nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "store not enabled"})
+		return
+	}
+	caller := accountFromCtx(r)
+	if caller == nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		return
+	}
+	q := r.URL.Query()
+	query := store.AuditLogQuery{
+		AccountID: q.Get("account_id"),
+		Action:    q.Get("action"),
+	}
+	if !isAdmin(r.Context()) {
+		if query.AccountID != "" && query.AccountID != caller.ID {
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+			return
+		}
+		query.AccountID = caller.ID
+	}
+	if v := q.Get("from"); v != "" {
+		t, err := parseTime(v)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid from"})
+			return
+		}
+		query.From = t
+	}
+	if v := q.Get("to"); v != "" {
+		t, err := parseTime(v)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid to"})
+			return
+		}
+		query.To = t
+	}
+	if v := q.Get("limit"); v != "" {
+		query.Limit, _ = strconv.Atoi(v)
+	}
+	if v := q.Get("offset"); v != "" {
+		query.Offset, _ = strconv.Atoi(v)
+	}
+
+	records, err := p.store.ListAuditLogs(r.Context(), query)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	f := p.displayFormat(w, r, caller)
+	items := make([]map[string]interface{}, 0, len(records))
+	for _, rec := range records {
+		var detail interface{}
+		if rec.Detail != "" {
+			if err := json.Unmarshal([]byte(rec.Detail), &detail); err != nil {
+				detail = rec.Detail
+			}
+		}
+		items = append(items, map[string]interface{}{
+			"id":         rec.ID,
+			"account_id": rec.AccountID,
+			"actor":      rec.Actor,
+			"action":     rec.Action,
+			"target":     rec.Target,
+			"detail":     detail,
+			"created_at": f.time(rec.CreatedAt),
+		})
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"logs": items, "count": len(items)})
+}
@@ -0,0 +1,322 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	authEventSchema     = "qcc.auth.v1"
+	authEventQueueSize  = 1024
+	authEventSignHeader = "X-QCC-Signature"
+)
+
+// 认证事件类型。
+const (
+	authEventLogin           = "auth.login"            // 登录成功或失败
+	authEventSessionRevoke   = "auth.session.revoke"   // 登出或成员被移除导致会话失效
+	authEventPasswordChange  = "auth.password.change"  // 修改口令
+	authEventPasswordExpired = "auth.password.expired" // 登录时口令已过期，需先修改
+)
+
+// 认证事件投递目标。
+const (
+	authEventTargetWebhook = "webhook"
+	authEventTargetSyslog  = "syslog"
+)
+
+// authEvent 投递给 SIEM 的结构化认证事件。
+type authEvent struct {
+	Schema    string    `json:"schema"`
+	Event     string    `json:"event"`
+	Outcome   string    `json:"outcome"` // success/failure
+	Time      time.Time `json:"time"`
+	AccountID string    `json:"account_id,omitempty"`
+	User      string    `json:"user,omitempty"`
+	SourceIP  string    `json:"source_ip,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+}
+
+// authEventConfig 认证事件投递配置，从 SettingsCache 读取，默认关闭。
+type authEventConfig struct {
+	Enabled       bool
+	Target        string
+	WebhookURL    string
+	WebhookSecret string
+	SyslogAddr    string
+	RatePerMinute int
+	MaxRetries    int
+}
+
+func (p *Server) authEventConfig() authEventConfig {
+	cfg := authEventConfig{Target: authEventTargetWebhook, RatePerMinute: 600, MaxRetries: 3}
+	if p.settingsCache == nil {
+		return cfg
+	}
+	cfg.Enabled = p.settingsCache.GetBool("siem.enabled", false)
+	if t := strings.ToLower(p.settingsCache.GetString("siem.target", cfg.Target)); t == authEventTargetSyslog {
+		cfg.Target = t
+	}
+	cfg.WebhookURL = strings.TrimSpace(p.settingsCache.GetString("siem.webhook_url", ""))
+	cfg.WebhookSecret = p.settingsCache.GetString("siem.webhook_secret", "")
+	cfg.SyslogAddr = strings.TrimSpace(p.settingsCache.GetString("siem.syslog_addr", ""))
+	if n := p.settingsCache.GetInt("siem.rate_limit_per_min", cfg.RatePerMinute); n >= 0 {
+		cfg.RatePerMinute = n
+	}
+	if n := p.settingsCache.GetInt("siem.max_retries", cfg.MaxRetries); n >= 0 {
+		cfg.MaxRetries = n
+	}
+	return cfg
+}
+
+// authEventSink 异步投递认证事件：按分钟限流，超出限流或队列已满的事件丢弃并计数，投递失败按指数退避重试。
+type authEventSink struct {
+	mu       sync.Mutex
+	queue    chan authEvent
+	stop     chan struct{}
+	wg       sync.WaitGroup
+	tokens   float64
+	refillAt time.Time
+
+	retryBase time.Duration
+	client    *http.Client
+
+	sent    atomic.Int64
+	dropped atomic.Int64
+	failed  atomic.Int64
+}
+
+// emitAuthEvent 记录一次认证事件，未开启投递时直接返回。
+func (p *Server) emitAuthEvent(r *http.Request, event, outcome, accountID, user, reason string) {
+	cfg := p.authEventConfig()
+	if !cfg.Enabled {
+		return
+	}
+	ev := authEvent{
+		Schema:    authEventSchema,
+		Event:     event,
+		Outcome:   outcome,
+		Time:      time.Now().UTC(),
+		AccountID: accountID,
+		User:      user,
+		Reason:    reason,
+	}
+	if r != nil {
+		ev.SourceIP = r.RemoteAddr
+		if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+			ev.SourceIP = host
+		}
+		ev.UserAgent = r.UserAgent()
+	}
+	p.authEvents.enqueue(p, ev, cfg.RatePerMinute)
+}
+
+func (s *authEventSink) enqueue(p *Server, ev authEvent, perMinute int) {
+	s.mu.Lock()
+	if s.queue == nil {
+		s.queue = make(chan authEvent, authEventQueueSize)
+		s.stop = make(chan struct{})
+		s.wg.Add(1)
+		go s.run(p, s.stop)
+	}
+	allowed := s.takeToken(perMinute, ev.Time)
+	s.mu.Unlock()
+	if !allowed {
+		s.dropped.Add(1)
+		return
+	}
+	select {
+	case s.queue <- ev:
+	default:
+		s.dropped.Add(1)
+	}
+}
+
+// takeToken 令牌桶限流，容量与每分钟补充量均为 perMinute，0 表示不限制；调用方需持有 s.mu。
+func (s *authEventSink) takeToken(perMinute int, now time.Time) bool {
+	if perMinute <= 0 {
+		return true
+	}
+	limit := float64(perMinute)
+	if s.refillAt.IsZero() {
+		s.tokens, s.refillAt = limit, now
+	}
+	s.tokens += now.Sub(s.refillAt).Minutes() * limit
+	if s.tokens > limit {
+		s.tokens = limit
+	}
+	s.refillAt = now
+	if s.tokens < 1 {
+		return false
+	}
+	s.tokens--
+	return true
+}
+
+func (s *authEventSink) run(p *Server, stop <-chan struct{}) {
+	defer s.wg.Done()
+	for {
+		select {
+		case <-stop:
+			return
+		case ev := <-s.queue:
+			s.deliver(p, ev, stop)
+		}
+	}
+}
+
+// deliver 按当前配置投递单个事件，失败后最多重试 MaxRetries 次。
+func (s *authEventSink) deliver(p *Server, ev authEvent, stop <-chan struct{}) {
+	cfg := p.authEventConfig()
+	body, err := json.Marshal(ev)
+	if err != nil {
+		s.failed.Add(1)
+		return
+	}
+	backoff := s.retryBase
+	if backoff <= 0 {
+		backoff = 500 * time.Millisecond
+	}
+	for attempt := 0; ; attempt++ {
+		if cfg.Target == authEventTargetSyslog {
+			err = sendSyslog(cfg.SyslogAddr, ev, body)
+		} else {
+			err = s.postWebhook(cfg, body)
+		}
+		if err == nil {
+			s.sent.Add(1)
+			return
+		}
+		if attempt >= cfg.MaxRetries {
+			s.failed.Add(1)
+			p.logger.Printf("auth event %s delivery failed after %d attempts: %v", ev.Event, attempt+1, err)
+			return
+		}
+		select {
+		case <-stop:
+			s.failed.Add(1)
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > 30*time.Second {
+			backoff = 30 * time.Second
+		}
+	}
+}
+
+// postWebhook 以 JSON POST 投递；配置了密钥时附带 HMAC-SHA256 签名，非 2xx 响应视为失败。
+func (s *authEventSink) postWebhook(cfg authEventConfig, body []byte) error {
+	if cfg.WebhookURL == "" {
+		return fmt.Errorf("siem.webhook_url not configured")
+	}
+	client := s.client
+	if client == nil {
+		client = &http.Client{Timeout: 5 * time.Second}
+	}
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, cfg.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if cfg.WebhookSecret != "" {
+		mac := hmac.New(sha256.New, []byte(cfg.WebhookSecret))
+		mac.Write(body)
+		req.Header.Set(authEventSignHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// sendSyslog 以 RFC 5424 格式发送到 syslog，地址形如 udp://host:514 或 tcp://host:601（缺省为 udp）。
+func sendSyslog(addr string, ev authEvent, body []byte) error {
+	if addr == "" {
+		return fmt.Errorf("siem.syslog_addr not configured")
+	}
+	network := "udp"
+	if n, rest, ok := strings.Cut(addr, "://"); ok {
+		network, addr = n, rest
+	}
+	severity := 6 // informational
+	if ev.Outcome == "failure" {
+		severity = 4 // warning
+	}
+	host, _ := os.Hostname()
+	msg := fmt.Sprintf("<%d>1 %s %s qcc_plus - %s - %s\n",
+		4*8+severity, ev.Time.Format(time.RFC3339Nano), chooseNonEmpty(host, "-"), ev.Event, body)
+	conn, err := net.DialTimeout(network, addr, 5*time.Second)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_ = conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	_, err = conn.Write([]byte(msg))
+	return err
+}
+
+func (s *authEventSink) close() {
+	s.mu.Lock()
+	stop := s.stop
+	s.stop = nil
+	s.mu.Unlock()
+	if stop != nil {
+		close(stop)
+		s.wg.Wait()
+	}
+}
+
+// GET /api/admin/auth-events
+// 返回认证事件投递配置（密钥脱敏）与投递计数，仅管理员可用。
+func (p *Server) handleAuthEventStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if !isAdmin(r.Context()) {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+		return
+	}
+	cfg := p.authEventConfig()
+	secret := ""
+	if cfg.WebhookSecret != "" {
+		secret = "******"
+	}
+	queued := 0
+	p.authEvents.mu.Lock()
+	if p.authEvents.queue != nil {
+		queued = len(p.authEvents.queue)
+	}
+	p.authEvents.mu.Unlock()
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"enabled":            cfg.Enabled,
+		"target":             cfg.Target,
+		"webhook_url":        cfg.WebhookURL,
+		"webhook_secret":     secret,
+		"syslog_addr":        cfg.SyslogAddr,
+		"rate_limit_per_min": cfg.RatePerMinute,
+		"max_retries":        cfg.MaxRetries,
+		"sent":               p.authEvents.sent.Load(),
+		"dropped":            p.authEvents.dropped.Load(),
+		"failed":             p.authEvents.failed.Load(),
+		"queued":             queued,
+	})
+}
@@ -0,0 +1,300 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"qcc_plus/internal/store"
+)
+
+const (
+	badgePrefix        = "/badge/"
+	badgeCacheTTL      = time.Minute
+	badgeMaxDays       = statusPageDays
+	maxBadgeLabelRunes = 32
+)
+
+// badgeUptimeRe 匹配 uptime-30d.svg 形式的文件名，天数为 1-90。
+var badgeUptimeRe = regexp.MustCompile(`^uptime-([0-9]{1,2})d\.svg$`)
+
+// badgeSource 一个分享链接对应账号的节点状态与可用率数据，多个徽章共用，按分享 token 缓存。
+type badgeSource struct {
+	notFound  bool
+	status    string
+	nodes     []badgeNode
+	uptime    map[string][]store.UptimeDay
+	expiresAt time.Time
+}
+
+type badgeNode struct {
+	id, name, status string
+}
+
+type badgeCache struct {
+	mu      sync.Mutex
+	entries map[string]*badgeSource
+}
+
+func (c *badgeCache) get(token string, now time.Time) *badgeSource {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e := c.entries[token]
+	if e == nil || now.After(e.expiresAt) {
+		return nil
+	}
+	return e
+}
+
+func (c *badgeCache) set(token string, e *badgeSource, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil || len(c.entries) >= statusPageCacheLimit {
+		c.entries = make(map[string]*badgeSource)
+	}
+	c.entries[token] = e
+}
+
+// forget 分享链接撤销或更换 token 后立即失效对应缓存。
+func (c *badgeCache) forget(token string) {
+	c.mu.Lock()
+	delete(c.entries, token)
+	c.mu.Unlock()
+}
+
+// loadBadgeSource 读取分享 token 对应账号的数据；token 无效、已过期或已撤销时返回 notFound 条目（同样缓存，避免穿透）。
+func (p *Server) loadBadgeSource(ctx context.Context, token string, now time.Time) (*badgeSource, error) {
+	src := &badgeSource{expiresAt: now.Add(badgeCacheTTL)}
+	rec, err := p.store.GetMonitorShareByToken(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	var acc *Account
+	if rec != nil {
+		acc = p.getAccountByID(rec.AccountID)
+	}
+	if acc == nil {
+		src.notFound = true
+		return src, nil
+	}
+	src.uptime, err = p.store.UptimeDaily(ctx, acc.ID, now.UTC().AddDate(0, 0, -badgeMaxDays))
+	if err != nil {
+		return nil, err
+	}
+	src.status = statusOperational
+	p.mu.RLock()
+	for _, n := range acc.Nodes {
+		status, visible := publicNodeStatus(nodeState(n))
+		if !visible {
+			continue
+		}
+		src.nodes = append(src.nodes, badgeNode{id: n.ID, name: n.Name, status: status})
+		src.status = worseStatus(src.status, status)
+	}
+	p.mu.RUnlock()
+	return src, nil
+}
+
+// badgeUptime 汇总节点近 days 天（含今天，UTC）的健康检查通过率，无检查数据时返回 nil。
+func badgeUptime(uptime map[string][]store.UptimeDay, nodes []badgeNode, days int, now time.Time) *float64 {
+	from := now.UTC().Truncate(24*time.Hour).AddDate(0, 0, 1-days)
+	var total, ok int64
+	for _, n := range nodes {
+		for _, d := range uptime[n.id] {
+			if d.Day.UTC().Before(from) {
+				continue
+			}
+			total += d.ChecksTotal
+			ok += d.ChecksOK
+		}
+	}
+	if total == 0 {
+		return nil
+	}
+	pct := float64(ok) / float64(total) * 100
+	return &pct
+}
+
+// badgeUptimeText 按徽章惯例展示可用率：100% 不带小数，其余保留两位并截断（不四舍五入到 100%）。
+func badgeUptimeText(pct *float64) (string, string) {
+	if pct == nil {
+		return "no data", "#9f9f9f"
+	}
+	v := *pct
+	text := strconv.FormatFloat(float64(int64(v*100))/100, 'f', 2, 64) + "%"
+	if v >= 100 {
+		text = "100%"
+	}
+	switch {
+	case v >= 99.9:
+		return text, "#4c1"
+	case v >= 99:
+		return text, "#97ca00"
+	case v >= 95:
+		return text, "#dfb317"
+	case v >= 90:
+		return text, "#fe7d37"
+	default:
+		return text, "#e05d44"
+	}
+}
+
+func badgeStatusColor(status string) string {
+	switch status {
+	case statusOperational:
+		return "#4c1"
+	case statusDegraded:
+		return "#dfb317"
+	case statusOutage:
+		return "#e05d44"
+	case statusMaintenance:
+		return "#007ec6"
+	default:
+		return "#9f9f9f"
+	}
+}
+
+// badgeTextWidth 估算 11px Verdana 下的文字宽度，足以让常见的 ASCII/中文文本不被截断。
+func badgeTextWidth(s string) int {
+	w := 0
+	for _, r := range s {
+		if r < 0x80 {
+			w += 7
+		} else {
+			w += 12
+		}
+	}
+	return w + 10
+}
+
+// renderBadgeSVG 生成与 shields.io flat 风格一致的双段徽章。
+func renderBadgeSVG(label, message, color string) []byte {
+	lw, mw := badgeTextWidth(label), badgeTextWidth(message)
+	label, message = html.EscapeString(label), html.EscapeString(message)
+	return []byte(fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" width="%[1]d" height="20" role="img" aria-label="%[4]s: %[5]s">`+
+		`<title>%[4]s: %[5]s</title>`+
+		`<linearGradient id="s" x2="0" y2="100%%"><stop offset="0" stop-color="#bbb" stop-opacity=".1"/><stop offset="1" stop-opacity=".1"/></linearGradient>`+
+		`<clipPath id="r"><rect width="%[1]d" height="20" rx="3" fill="#fff"/></clipPath>`+
+		`<g clip-path="url(#r)"><rect width="%[2]d" height="20" fill="#555"/><rect x="%[2]d" width="%[3]d" height="20" fill="%[6]s"/><rect width="%[1]d" height="20" fill="url(#s)"/></g>`+
+		`<g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" font-size="11">`+
+		`<text x="%[7]d" y="15" fill="#010101" fill-opacity=".3">%[4]s</text><text x="%[7]d" y="14">%[4]s</text>`+
+		`<text x="%[8]d" y="15" fill="#010101" fill-opacity=".3">%[5]s</text><text x="%[8]d" y="14">%[5]s</text></g></svg>`,
+		lw+mw, lw, mw, label, message, color, lw/2, lw+mw/2))
+}
+
+// badgeLabel 读取 ?label= 自定义左侧文字，超长截断。
+func badgeLabel(r *http.Request, fallback string) string {
+	label := strings.TrimSpace(r.URL.Query().Get("label"))
+	if label == "" {
+		return fallback
+	}
+	if utf8.RuneCountInString(label) > maxBadgeLabelRunes {
+		label = string([]rune(label)[:maxBadgeLabelRunes])
+	}
+	return label
+}
+
+// GET /badge/:share_token/status.svg
+// GET /badge/:share_token/uptime-30d.svg
+// GET /badge/:share_token/nodes/:node/status.svg
+// GET /badge/:share_token/nodes/:node/uptime-7d.svg
+// 基于监控分享链接的公开徽章，:node 可为节点 ID 或名称；可用率取自健康检查的每日统计，天数 1-90。
+func (p *Server) handleBadge(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, badgePrefix), "/")
+	token, nodeKey, file := "", "", ""
+	switch {
+	case len(parts) == 2:
+		token, file = parts[0], parts[1]
+	case len(parts) == 4 && parts[1] == "nodes":
+		token, nodeKey, file = parts[0], parts[2], parts[3]
+	}
+	days := 0
+	if m := badgeUptimeRe.FindStringSubmatch(file); m != nil {
+		days, _ = strconv.Atoi(m[1])
+		if days < 1 || days > badgeMaxDays {
+			file = ""
+		}
+	} else if file != "status.svg" {
+		file = ""
+	}
+	if token == "" || file == "" || p.store == nil {
+		p.writeBadge(w, r, http.StatusNotFound, renderBadgeSVG("badge", "not found", "#9f9f9f"))
+		return
+	}
+
+	now := time.Now()
+	src := p.badges.get(token, now)
+	if src == nil {
+		var err error
+		src, err = p.loadBadgeSource(r.Context(), token, now)
+		if err != nil {
+			if p.logger != nil {
+				p.logger.Printf("load badge data failed: %v", err)
+			}
+			p.writeBadge(w, r, http.StatusServiceUnavailable, renderBadgeSVG("status", "unavailable", "#9f9f9f"))
+			return
+		}
+		p.badges.set(token, src, now)
+	}
+	if src.notFound {
+		p.writeBadge(w, r, http.StatusNotFound, renderBadgeSVG("badge", "not found", "#9f9f9f"))
+		return
+	}
+
+	nodes, status := src.nodes, src.status
+	if nodeKey != "" {
+		nodes = nil
+		for _, n := range src.nodes {
+			if n.id == nodeKey || n.name == nodeKey {
+				nodes, status = []badgeNode{n}, n.status
+				break
+			}
+		}
+		if nodes == nil {
+			p.writeBadge(w, r, http.StatusNotFound, renderBadgeSVG("node", "not found", "#9f9f9f"))
+			return
+		}
+	}
+	if days > 0 {
+		text, color := badgeUptimeText(badgeUptime(src.uptime, nodes, days, now))
+		p.writeBadge(w, r, http.StatusOK, renderBadgeSVG(badgeLabel(r, fmt.Sprintf("uptime %dd", days)), text, color))
+		return
+	}
+	label := "status"
+	if nodeKey != "" {
+		label = nodes[0].name
+	}
+	p.writeBadge(w, r, http.StatusOK, renderBadgeSVG(badgeLabel(r, label), status, badgeStatusColor(status)))
+}
+
+// writeBadge 输出 SVG 徽章；与状态页相同的短缓存，便于 README 等嵌入方的图片代理按时刷新。
+func (p *Server) writeBadge(w http.ResponseWriter, r *http.Request, status int, svg []byte) {
+	etag := computeETag(status, string(svg))
+	w.Header().Set("Content-Type", "image/svg+xml; charset=utf-8")
+	if status == http.StatusOK {
+		w.Header().Set("Cache-Control", statusPageCacheCtl)
+	} else {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+	w.Header().Set("ETag", etag)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if status == http.StatusOK && etagMatches(r, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.WriteHeader(status)
+	if r.Method != http.MethodHead {
+		_, _ = w.Write(svg)
+	}
+}
@@ -0,0 +1,458 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"qcc_plus/internal/store"
+	"qcc_plus/internal/timeutil"
+)
+
+const (
+	defaultBenchmarkModel       = "claude-3-5-haiku-20241022"
+	defaultBenchmarkConcurrency = 4
+	maxBenchmarkConcurrency     = 32
+	defaultBenchmarkDuration    = 10 * time.Second
+	maxBenchmarkDuration        = 2 * time.Minute
+	defaultBenchmarkPromptChars = 256
+	maxBenchmarkPromptChars     = 200000
+	defaultBenchmarkMaxTokens   = 16
+	maxBenchmarkMaxTokens       = 4096
+	benchmarkRequestTimeout     = 60 * time.Second
+)
+
+// errBenchmarkRunning 同一节点已有压测在运行。
+var errBenchmarkRunning = errors.New("benchmark already running for this node")
+
+// benchmarkParams 压测参数。
+type benchmarkParams struct {
+	Concurrency int    `json:"concurrency"`
+	DurationSec int    `json:"duration_sec"`
+	PromptChars int    `json:"prompt_chars"`
+	MaxTokens   int    `json:"max_tokens"`
+	Model       string `json:"model"`
+}
+
+// normalize 填充默认值并校验上限。
+func (bp *benchmarkParams) normalize() error {
+	if bp.Concurrency == 0 {
+		bp.Concurrency = defaultBenchmarkConcurrency
+	}
+	if bp.DurationSec == 0 {
+		bp.DurationSec = int(defaultBenchmarkDuration / time.Second)
+	}
+	if bp.PromptChars == 0 {
+		bp.PromptChars = defaultBenchmarkPromptChars
+	}
+	if bp.MaxTokens == 0 {
+		bp.MaxTokens = defaultBenchmarkMaxTokens
+	}
+	bp.Model = strings.TrimSpace(bp.Model)
+	if bp.Model == "" {
+		bp.Model = defaultBenchmarkModel
+	}
+	switch {
+	case bp.Concurrency < 1 || bp.Concurrency > maxBenchmarkConcurrency:
+		return fmt.Errorf("concurrency must be between 1 and %d", maxBenchmarkConcurrency)
+	case bp.DurationSec < 1 || time.Duration(bp.DurationSec)*time.Second > maxBenchmarkDuration:
+		return fmt.Errorf("duration_sec must be between 1 and %d", int(maxBenchmarkDuration/time.Second))
+	case bp.PromptChars < 1 || bp.PromptChars > maxBenchmarkPromptChars:
+		return fmt.Errorf("prompt_chars must be between 1 and %d", maxBenchmarkPromptChars)
+	case bp.MaxTokens < 1 || bp.MaxTokens > maxBenchmarkMaxTokens:
+		return fmt.Errorf("max_tokens must be between 1 and %d", maxBenchmarkMaxTokens)
+	}
+	return nil
+}
+
+// benchmarkPrompt 生成指定长度的合成提示词。
+func benchmarkPrompt(chars int) string {
+	const seed = "The quick brown fox jumps over the lazy dog. "
+	var b strings.Builder
+	b.Grow(chars + len(seed))
+	for b.Len() < chars {
+		b.WriteString(seed)
+	}
+	return b.String()[:chars]
+}
+
+// percentile 返回已排序样本的最近秩百分位。
+func percentile(sorted []time.Duration, pct int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	idx := (len(sorted)*pct+99)/100 - 1
+	if idx < 0 {
+		idx = 0
+	}
+	return sorted[idx]
+}
+
+// runBenchmark 以固定并发向节点发送合成请求，直到时长耗尽或 ctx 取消；progress 按已运行秒数上报进度，可为 nil。
+func (p *Server) runBenchmark(ctx context.Context, node Node, params benchmarkParams, progress *jobReporter) store.BenchmarkRecord {
+	body, _ := json.Marshal(map[string]interface{}{
+		"model":      params.Model,
+		"max_tokens": params.MaxTokens,
+		"messages": []map[string]string{
+			{"role": "user", "content": benchmarkPrompt(params.PromptChars)},
+		},
+	})
+	apiURL := strings.TrimSuffix(node.URL.String(), "/") + "/v1/messages"
+	client := &http.Client{Transport: p.healthRT, Timeout: benchmarkRequestTimeout}
+
+	var (
+		mu       sync.Mutex
+		samples  []time.Duration
+		errCount = make(map[string]int64)
+		total    int64
+		wg       sync.WaitGroup
+	)
+	start := time.Now()
+	deadline := start.Add(time.Duration(params.DurationSec) * time.Second)
+	for i := 0; i < params.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for time.Now().Before(deadline) && ctx.Err() == nil {
+				req, _ := http.NewRequestWithContext(ctx, http.MethodPost, apiURL, bytes.NewReader(body))
+				req.Header.Set("Content-Type", "application/json")
+				req.Header.Set("anthropic-version", "2023-06-01")
+				applyNodeHeaders(req.Header, node.Headers)
+				req.Header.Set("x-api-key", node.APIKey)
+				req.Header.Set("Authorization", "Bearer "+node.APIKey)
+
+				t0 := time.Now()
+				resp, err := client.Do(req)
+				status := 0
+				if err == nil {
+					_, _ = io.Copy(io.Discard, resp.Body)
+					resp.Body.Close()
+					status = resp.StatusCode
+				}
+				elapsed := time.Since(t0)
+				if ctx.Err() != nil {
+					return
+				}
+				atomic.AddInt64(&total, 1)
+				progress.Update(int64(time.Since(start)/time.Second), int64(params.DurationSec))
+				mu.Lock()
+				if err == nil && status >= 200 && status < 300 {
+					samples = append(samples, elapsed)
+				} else {
+					errCount[classifyUpstreamError(status, err)]++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+	rec := store.BenchmarkRecord{
+		AccountID:     node.AccountID,
+		NodeID:        node.ID,
+		NodeName:      node.Name,
+		Model:         params.Model,
+		Concurrency:   params.Concurrency,
+		DurationMs:    elapsed.Milliseconds(),
+		PromptChars:   params.PromptChars,
+		MaxTokens:     params.MaxTokens,
+		RequestsTotal: total,
+		RequestsOK:    int64(len(samples)),
+		StartedAt:     start,
+	}
+	rec.RequestsFail = rec.RequestsTotal - rec.RequestsOK
+	if rec.RequestsTotal > 0 {
+		rec.ErrorRate = float64(rec.RequestsFail) / float64(rec.RequestsTotal)
+	}
+	if elapsed > 0 {
+		rec.RPS = float64(rec.RequestsTotal) / elapsed.Seconds()
+	}
+	if n := len(samples); n > 0 {
+		var sum time.Duration
+		for _, d := range samples {
+			sum += d
+		}
+		rec.LatencyMinMs = samples[0].Milliseconds()
+		rec.LatencyMaxMs = samples[n-1].Milliseconds()
+		rec.LatencyAvgMs = (sum / time.Duration(n)).Milliseconds()
+		rec.LatencyP50Ms = percentile(samples, 50).Milliseconds()
+		rec.LatencyP90Ms = percentile(samples, 90).Milliseconds()
+		rec.LatencyP95Ms = percentile(samples, 95).Milliseconds()
+		rec.LatencyP99Ms = percentile(samples, 99).Milliseconds()
+	}
+	if len(errCount) > 0 {
+		if b, err := json.Marshal(errCount); err == nil {
+			rec.Errors = string(b)
+		}
+	}
+	return rec
+}
+
+func benchmarkView(rec store.BenchmarkRecord) map[string]interface{} {
+	var errs map[string]int64
+	if rec.Errors != "" {
+		_ = json.Unmarshal([]byte(rec.Errors), &errs)
+	}
+	return map[string]interface{}{
+		"id":             rec.ID,
+		"account_id":     rec.AccountID,
+		"node_id":        rec.NodeID,
+		"node_name":      rec.NodeName,
+		"model":          rec.Model,
+		"concurrency":    rec.Concurrency,
+		"duration_ms":    rec.DurationMs,
+		"prompt_chars":   rec.PromptChars,
+		"max_tokens":     rec.MaxTokens,
+		"requests_total": rec.RequestsTotal,
+		"requests_ok":    rec.RequestsOK,
+		"requests_fail":  rec.RequestsFail,
+		"error_rate":     rec.ErrorRate,
+		"rps":            rec.RPS,
+		"latency_ms": map[string]int64{
+			"min": rec.LatencyMinMs,
+			"avg": rec.LatencyAvgMs,
+			"p50": rec.LatencyP50Ms,
+			"p90": rec.LatencyP90Ms,
+			"p95": rec.LatencyP95Ms,
+			"p99": rec.LatencyP99Ms,
+			"max": rec.LatencyMaxMs,
+		},
+		"errors":     errs,
+		"started_by": rec.StartedBy,
+		"started_at": timeutil.FormatBeijingTime(rec.StartedAt),
+	}
+}
+
+// benchmarkPathSuffixes 为 /api/nodes/:node_id 下的压测相关子路径。
+var benchmarkPathSuffixes = []string{"/benchmark", "/benchmark/schedule", "/benchmark/trend"}
+
+func isNodeBenchmarkPath(path string) bool {
+	for _, suffix := range benchmarkPathSuffixes {
+		if _, ok := extractNodeIDFromBenchmarkPath(path, suffix); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func extractNodeIDFromBenchmarkPath(path, suffix string) (string, bool) {
+	if !strings.HasPrefix(path, "/api/nodes/") || !strings.HasSuffix(path, suffix) {
+		return "", false
+	}
+	trimmed := strings.TrimPrefix(path, "/api/nodes/")
+	trimmed = strings.TrimSuffix(trimmed, suffix)
+	trimmed = strings.TrimSuffix(trimmed, "/")
+	if trimmed == "" || strings.Contains(trimmed, "/") {
+		return "", false
+	}
+	return trimmed, true
+}
+
+// POST /api/nodes/:node_id/benchmark 运行压测并保存结果：启用存储时作为后台任务（node_benchmark）入队，
+// 返回 202 与 job_id，结果见任务详情与历史记录；未启用存储时同步运行并直接返回结果。
+// GET 返回该节点的历史压测结果（from/to/limit）。
+func (p *Server) handleNodeBenchmark(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	caller := accountFromCtx(r)
+	if caller == nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		return
+	}
+	snapshot, ok := p.benchmarkNodeForCaller(w, r, caller, "/benchmark")
+	if !ok {
+		return
+	}
+	nodeID := snapshot.ID
+
+	if r.Method == http.MethodGet {
+		p.listNodeBenchmarks(w, r, nodeID)
+		return
+	}
+
+	var params benchmarkParams
+	if r.Body != nil && r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid body"})
+			return
+		}
+	}
+	if err := params.normalize(); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	if snapshot.APIKey == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "benchmark requires node api key"})
+		return
+	}
+	if _, running := p.benchmarks.Load(nodeID); running {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": errBenchmarkRunning.Error()})
+		return
+	}
+	if p.jobs != nil {
+		job, err := p.enqueueJob(r.Context(), jobTypeNodeBenchmark, snapshot.AccountID, caller.ID, nodeBenchmarkPayload{NodeID: nodeID, Params: params}, 1)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusAccepted, map[string]interface{}{"job_id": job.ID, "node_id": nodeID, "status": job.Status})
+		return
+	}
+
+	rec, err := p.benchmarkNode(r.Context(), snapshot, params, caller.ID, nil)
+	if err != nil {
+		switch {
+		case r.Context().Err() != nil:
+		case errors.Is(err, errBenchmarkRunning):
+			writeJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+		default:
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		}
+		return
+	}
+	writeJSON(w, http.StatusOK, benchmarkView(rec))
+}
+
+// nodeBenchmarkPayload node_benchmark 任务的参数。
+type nodeBenchmarkPayload struct {
+	NodeID string          `json:"node_id"`
+	Params benchmarkParams `json:"params"`
+}
+
+// nodeBenchmarkJob 执行手动发起的压测，结果写入压测历史，任务结果为同一视图。
+func (p *Server) nodeBenchmarkJob(ctx context.Context, job *store.Job, progress *jobReporter) (any, error) {
+	var req nodeBenchmarkPayload
+	if err := json.Unmarshal(job.Payload, &req); err != nil || req.NodeID == "" {
+		return nil, fmt.Errorf("invalid benchmark payload: %s", job.Payload)
+	}
+	if err := req.Params.normalize(); err != nil {
+		return nil, err
+	}
+	p.mu.RLock()
+	var node Node
+	n := p.nodeIndex[req.NodeID]
+	if n != nil {
+		node = *n
+	}
+	p.mu.RUnlock()
+	if n == nil {
+		return nil, fmt.Errorf("node %s not found", req.NodeID)
+	}
+	if node.APIKey == "" {
+		return nil, errors.New("benchmark requires node api key")
+	}
+	rec, err := p.benchmarkNode(ctx, node, req.Params, job.CreatedBy, progress)
+	if err != nil {
+		return nil, err
+	}
+	return benchmarkView(rec), nil
+}
+
+// benchmarkNode 对节点运行一次压测并保存结果与审计日志，同一节点同时只运行一个压测。
+func (p *Server) benchmarkNode(ctx context.Context, node Node, params benchmarkParams, actor string, progress *jobReporter) (store.BenchmarkRecord, error) {
+	if _, running := p.benchmarks.LoadOrStore(node.ID, struct{}{}); running {
+		return store.BenchmarkRecord{}, errBenchmarkRunning
+	}
+	defer p.benchmarks.Delete(node.ID)
+
+	rec := p.runBenchmark(ctx, node, params, progress)
+	rec.StartedBy = actor
+	if err := ctx.Err(); err != nil {
+		return rec, err
+	}
+	if p.store != nil {
+		sctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		id, err := p.store.InsertBenchmark(sctx, rec)
+		cancel()
+		if err != nil {
+			return rec, err
+		}
+		rec.ID = id
+	}
+	p.audit(node.AccountID, actor, "node.benchmark", node.ID, map[string]interface{}{
+		"concurrency":  params.Concurrency,
+		"duration_sec": params.DurationSec,
+		"prompt_chars": params.PromptChars,
+		"requests":     rec.RequestsTotal,
+		"error_rate":   rec.ErrorRate,
+		"p95_ms":       rec.LatencyP95Ms,
+	})
+	return rec, nil
+}
+
+// benchmarkNodeForCaller 解析路径中的节点并校验权限，失败时已写出响应。
+func (p *Server) benchmarkNodeForCaller(w http.ResponseWriter, r *http.Request, caller *Account, suffix string) (Node, bool) {
+	var snapshot Node
+	nodeID, ok := extractNodeIDFromBenchmarkPath(r.URL.Path, suffix)
+	if !ok {
+		http.NotFound(w, r)
+		return snapshot, false
+	}
+	p.mu.RLock()
+	n := p.nodeIndex[nodeID]
+	if n != nil {
+		snapshot = *n
+	}
+	p.mu.RUnlock()
+	if n == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "node not found"})
+		return snapshot, false
+	}
+	if !isAdmin(r.Context()) && snapshot.AccountID != caller.ID {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+		return snapshot, false
+	}
+	return snapshot, true
+}
+
+func (p *Server) listNodeBenchmarks(w http.ResponseWriter, r *http.Request, nodeID string) {
+	if p.store == nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "store not enabled"})
+		return
+	}
+	q := r.URL.Query()
+	query := store.BenchmarkQuery{NodeID: nodeID}
+	if v := q.Get("from"); v != "" {
+		t, err := parseTime(v)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid from"})
+			return
+		}
+		query.From = t
+	}
+	if v := q.Get("to"); v != "" {
+		t, err := parseTime(v)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid to"})
+			return
+		}
+		query.To = t
+	}
+	if v := q.Get("limit"); v != "" {
+		query.Limit, _ = strconv.Atoi(v)
+	}
+	records, err := p.store.ListBenchmarks(r.Context(), query)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	items := make([]map[string]interface{}, 0, len(records))
+	for _, rec := range records {
+		items = append(items, benchmarkView(rec))
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"benchmarks": items, "count": len(items)})
+}
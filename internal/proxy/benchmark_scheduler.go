@@ -0,0 +1,421 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"qcc_plus/internal/notify"
+	"qcc_plus/internal/store"
+	"qcc_plus/internal/timeutil"
+)
+
+const (
+	benchmarkSchedulerTick          = time.Minute
+	defaultBenchmarkIntervalMinutes = 24 * 60
+	minBenchmarkIntervalMinutes     = 60
+	defaultBenchmarkRegressionPct   = 30
+	benchmarkActorScheduler         = "benchmark-scheduler"
+)
+
+// BenchmarkScheduler 按节点配置定期执行压测，并检测 p95 的周环比退化。
+// 全局开关为 benchmark.scheduler.enabled，退化阈值为 benchmark.regression_threshold_pct。
+type BenchmarkScheduler struct {
+	server   *Server
+	logger   *log.Logger
+	stopCh   chan struct{}
+	wg       sync.WaitGroup
+	stopOnce sync.Once
+	ctx      context.Context
+	cancel   context.CancelFunc
+}
+
+// NewBenchmarkScheduler 创建定时压测调度器。
+func NewBenchmarkScheduler(server *Server, logger *log.Logger) *BenchmarkScheduler {
+	if logger == nil {
+		logger = log.Default()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &BenchmarkScheduler{server: server, logger: logger, stopCh: make(chan struct{}), ctx: ctx, cancel: cancel}
+}
+
+// Start 启动调度循环。
+func (b *BenchmarkScheduler) Start() error {
+	if b == nil || b.server == nil || b.server.store == nil {
+		return nil
+	}
+	b.wg.Add(1)
+	go b.loop()
+	return nil
+}
+
+// Stop 中止正在运行的压测并等待退出。
+func (b *BenchmarkScheduler) Stop() {
+	if b == nil {
+		return
+	}
+	b.stopOnce.Do(func() {
+		close(b.stopCh)
+		b.cancel()
+	})
+	b.wg.Wait()
+}
+
+func (b *BenchmarkScheduler) enabled() bool {
+	if cache := b.server.settingsCache; cache != nil {
+		return cache.GetBool("benchmark.scheduler.enabled", true)
+	}
+	return true
+}
+
+func (b *BenchmarkScheduler) regressionThreshold() float64 {
+	pct := defaultBenchmarkRegressionPct
+	if cache := b.server.settingsCache; cache != nil {
+		pct = cache.GetInt("benchmark.regression_threshold_pct", pct)
+	}
+	if pct <= 0 {
+		pct = defaultBenchmarkRegressionPct
+	}
+	return float64(pct) / 100
+}
+
+func (b *BenchmarkScheduler) loop() {
+	defer b.wg.Done()
+	defer func() {
+		if r := recover(); r != nil {
+			b.logger.Printf("[BenchmarkScheduler] panic recovered: %v", r)
+		}
+	}()
+
+	ticker := time.NewTicker(benchmarkSchedulerTick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-b.stopCh:
+			return
+		case <-ticker.C:
+			if b.enabled() && !b.server.maintenanceActive() {
+				b.runDue()
+			}
+		}
+	}
+}
+
+// runDue 依次执行到期的定时压测，避免多个压测同时占用上游。
+func (b *BenchmarkScheduler) runDue() {
+	p := b.server
+	now := time.Now()
+	schedules, err := p.store.ListDueBenchmarkSchedules(b.ctx, now)
+	if err != nil {
+		b.logger.Printf("[BenchmarkScheduler] list schedules failed: %v", err)
+		return
+	}
+	for _, sc := range schedules {
+		if b.ctx.Err() != nil {
+			return
+		}
+		b.runOne(sc)
+	}
+}
+
+func (b *BenchmarkScheduler) runOne(sc store.BenchmarkSchedule) {
+	p := b.server
+	p.mu.RLock()
+	var node Node
+	n := p.nodeIndex[sc.NodeID]
+	if n != nil {
+		node = *n
+	}
+	p.mu.RUnlock()
+	if n == nil {
+		// 节点已删除，清理残留配置。
+		_ = p.store.DeleteBenchmarkSchedule(b.ctx, sc.NodeID)
+		return
+	}
+
+	start := time.Now()
+	sc.LastRunAt = start
+	sc.NextRunAt = start.Add(time.Duration(sc.IntervalMinutes) * time.Minute)
+	if err := p.store.UpsertBenchmarkSchedule(b.ctx, sc); err != nil {
+		b.logger.Printf("[BenchmarkScheduler] update schedule %s failed: %v", sc.NodeID, err)
+		return
+	}
+	if !nodeRoutable(&node) || node.APIKey == "" {
+		return
+	}
+	if _, running := p.benchmarks.LoadOrStore(sc.NodeID, struct{}{}); running {
+		return
+	}
+	defer p.benchmarks.Delete(sc.NodeID)
+
+	params := benchmarkParams{
+		Concurrency: sc.Concurrency,
+		DurationSec: sc.DurationSec,
+		PromptChars: sc.PromptChars,
+		MaxTokens:   sc.MaxTokens,
+		Model:       sc.Model,
+	}
+	if err := params.normalize(); err != nil {
+		b.logger.Printf("[BenchmarkScheduler] invalid schedule for node %s: %v", sc.NodeID, err)
+		return
+	}
+	rec := p.runBenchmark(b.ctx, node, params, nil)
+	if b.ctx.Err() != nil {
+		return
+	}
+	rec.StartedBy = benchmarkActorScheduler
+	if _, err := p.store.InsertBenchmark(b.ctx, rec); err != nil {
+		b.logger.Printf("[BenchmarkScheduler] save benchmark for node %s failed: %v", sc.NodeID, err)
+		return
+	}
+	b.checkRegression(node, start)
+}
+
+// checkRegression 比较最近 7 天与前 7 天的平均 p95，超出阈值时告警。
+func (b *BenchmarkScheduler) checkRegression(node Node, now time.Time) {
+	p := b.server
+	cmp, err := p.benchmarkWeekOverWeek(b.ctx, node.ID, now)
+	if err != nil {
+		b.logger.Printf("[BenchmarkScheduler] week-over-week for node %s failed: %v", node.ID, err)
+		return
+	}
+	if !cmp.regressed(b.regressionThreshold()) {
+		return
+	}
+	detail := map[string]interface{}{
+		"current_p95_ms":  cmp.CurrentP95Ms,
+		"previous_p95_ms": cmp.PreviousP95Ms,
+		"change_pct":      cmp.ChangePct,
+	}
+	p.audit(node.AccountID, benchmarkActorScheduler, "node.benchmark.regression", node.ID, detail)
+	if p.notifyMgr != nil {
+		p.notifyMgr.Publish(notify.Event{
+			AccountID: node.AccountID,
+			EventType: notify.EventNodeBenchmarkRegressed,
+			Title:     "节点压测性能退化",
+			Content: fmt.Sprintf("**节点名称**: %s\n**本周 p95**: %.0fms\n**上周 p95**: %.0fms\n**变化**: +%.1f%%\n**时间**: %s",
+				node.Name, cmp.CurrentP95Ms, cmp.PreviousP95Ms, cmp.ChangePct, timeutil.FormatBeijingTime(now)),
+			DedupKey:   node.ID,
+			Node:       node.Name,
+			OccurredAt: now,
+		})
+	}
+}
+
+// benchmarkComparison 节点压测 p95 的周环比。
+type benchmarkComparison struct {
+	CurrentP95Ms  float64 `json:"current_p95_ms"`
+	CurrentRuns   int64   `json:"current_runs"`
+	PreviousP95Ms float64 `json:"previous_p95_ms"`
+	PreviousRuns  int64   `json:"previous_runs"`
+	ChangePct     float64 `json:"change_pct"`
+}
+
+func (c benchmarkComparison) regressed(threshold float64) bool {
+	if c.CurrentRuns == 0 || c.PreviousRuns == 0 || c.PreviousP95Ms <= 0 {
+		return false
+	}
+	return c.CurrentP95Ms > c.PreviousP95Ms*(1+threshold)
+}
+
+func (p *Server) benchmarkWeekOverWeek(ctx context.Context, nodeID string, now time.Time) (benchmarkComparison, error) {
+	var cmp benchmarkComparison
+	week := 7 * 24 * time.Hour
+	cur, curN, err := p.store.BenchmarkP95Average(ctx, nodeID, now.Add(-week), now.Add(time.Second))
+	if err != nil {
+		return cmp, err
+	}
+	prev, prevN, err := p.store.BenchmarkP95Average(ctx, nodeID, now.Add(-2*week), now.Add(-week))
+	if err != nil {
+		return cmp, err
+	}
+	cmp = benchmarkComparison{CurrentP95Ms: cur, CurrentRuns: curN, PreviousP95Ms: prev, PreviousRuns: prevN}
+	if prev > 0 {
+		cmp.ChangePct = (cur - prev) / prev * 100
+	}
+	return cmp, nil
+}
+
+// benchmarkScheduleRequest 定时压测配置的请求体。
+type benchmarkScheduleRequest struct {
+	Enabled         *bool `json:"enabled"`
+	IntervalMinutes *int  `json:"interval_minutes"`
+	benchmarkParams
+}
+
+func benchmarkScheduleView(sc store.BenchmarkSchedule) map[string]interface{} {
+	out := map[string]interface{}{
+		"node_id":          sc.NodeID,
+		"account_id":       sc.AccountID,
+		"enabled":          sc.Enabled,
+		"interval_minutes": sc.IntervalMinutes,
+		"concurrency":      sc.Concurrency,
+		"duration_sec":     sc.DurationSec,
+		"prompt_chars":     sc.PromptChars,
+		"max_tokens":       sc.MaxTokens,
+		"model":            sc.Model,
+		"last_run_at":      nil,
+		"next_run_at":      nil,
+	}
+	if !sc.LastRunAt.IsZero() {
+		out["last_run_at"] = timeutil.FormatBeijingTime(sc.LastRunAt)
+	}
+	if !sc.NextRunAt.IsZero() {
+		out["next_run_at"] = timeutil.FormatBeijingTime(sc.NextRunAt)
+	}
+	return out
+}
+
+// GET/PUT /api/nodes/:node_id/benchmark/schedule 查看或更新节点定时压测配置。
+func (p *Server) handleBenchmarkSchedule(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPut {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if p.store == nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "store not enabled"})
+		return
+	}
+	caller := accountFromCtx(r)
+	if caller == nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		return
+	}
+	node, ok := p.benchmarkNodeForCaller(w, r, caller, "/benchmark/schedule")
+	if !ok {
+		return
+	}
+	current, err := p.store.GetBenchmarkSchedule(r.Context(), node.ID)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	sc := store.BenchmarkSchedule{
+		NodeID:          node.ID,
+		AccountID:       node.AccountID,
+		IntervalMinutes: defaultBenchmarkIntervalMinutes,
+		Concurrency:     defaultBenchmarkConcurrency,
+		DurationSec:     int(defaultBenchmarkDuration / time.Second),
+		PromptChars:     defaultBenchmarkPromptChars,
+		MaxTokens:       defaultBenchmarkMaxTokens,
+		Model:           defaultBenchmarkModel,
+	}
+	if current != nil {
+		sc = *current
+	}
+	if r.Method == http.MethodGet {
+		writeJSON(w, http.StatusOK, benchmarkScheduleView(sc))
+		return
+	}
+
+	var req benchmarkScheduleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid body"})
+		return
+	}
+	if req.Enabled != nil {
+		sc.Enabled = *req.Enabled
+	}
+	if req.IntervalMinutes != nil {
+		if *req.IntervalMinutes < minBenchmarkIntervalMinutes {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("interval_minutes must be at least %d", minBenchmarkIntervalMinutes)})
+			return
+		}
+		sc.IntervalMinutes = *req.IntervalMinutes
+	}
+	params := benchmarkParams{
+		Concurrency: chooseNonZero(req.Concurrency, sc.Concurrency),
+		DurationSec: chooseNonZero(req.DurationSec, sc.DurationSec),
+		PromptChars: chooseNonZero(req.PromptChars, sc.PromptChars),
+		MaxTokens:   chooseNonZero(req.MaxTokens, sc.MaxTokens),
+		Model:       chooseNonEmpty(req.Model, sc.Model),
+	}
+	if err := params.normalize(); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	sc.Concurrency = params.Concurrency
+	sc.DurationSec = params.DurationSec
+	sc.PromptChars = params.PromptChars
+	sc.MaxTokens = params.MaxTokens
+	sc.Model = params.Model
+	if sc.Enabled && (sc.NextRunAt.IsZero() || req.IntervalMinutes != nil) {
+		sc.NextRunAt = time.Now().Add(time.Duration(sc.IntervalMinutes) * time.Minute)
+	}
+	if err := p.store.UpsertBenchmarkSchedule(r.Context(), sc); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	p.audit(node.AccountID, caller.ID, "node.benchmark.schedule", node.ID, benchmarkScheduleView(sc))
+	writeJSON(w, http.StatusOK, benchmarkScheduleView(sc))
+}
+
+// GET /api/nodes/:node_id/benchmark/trend?days=30 返回按天的压测趋势与 p95 周环比。
+func (p *Server) handleBenchmarkTrend(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if p.store == nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "store not enabled"})
+		return
+	}
+	caller := accountFromCtx(r)
+	if caller == nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		return
+	}
+	node, ok := p.benchmarkNodeForCaller(w, r, caller, "/benchmark/trend")
+	if !ok {
+		return
+	}
+	days := 30
+	if v := r.URL.Query().Get("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 365 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "days must be between 1 and 365"})
+			return
+		}
+		days = n
+	}
+	now := time.Now()
+	points, err := p.store.BenchmarkTrend(r.Context(), node.ID, now.AddDate(0, 0, -days), now.Add(time.Second))
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	cmp, err := p.benchmarkWeekOverWeek(r.Context(), node.ID, now)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	threshold := defaultBenchmarkRegressionPct
+	if p.settingsCache != nil {
+		threshold = p.settingsCache.GetInt("benchmark.regression_threshold_pct", threshold)
+	}
+	items := make([]map[string]interface{}, 0, len(points))
+	for _, pt := range points {
+		items = append(items, map[string]interface{}{
+			"day":            pt.Day.Format("2006-01-02"),
+			"runs":           pt.Runs,
+			"avg_p50_ms":     pt.AvgP50Ms,
+			"avg_p95_ms":     pt.AvgP95Ms,
+			"avg_p99_ms":     pt.AvgP99Ms,
+			"avg_error_rate": pt.AvgErrorRate,
+			"avg_rps":        pt.AvgRPS,
+		})
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"node_id":              node.ID,
+		"days":                 days,
+		"points":               items,
+		"week_over_week":       cmp,
+		"regression_threshold": threshold,
+		"regressed":            cmp.regressed(float64(threshold) / 100),
+	})
+}
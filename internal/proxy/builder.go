@@ -10,6 +10,7 @@ import (
 	"strings"
 	"time"
 
+	"qcc_plus/internal/config"
 	"qcc_plus/internal/notify"
 	"qcc_plus/internal/store"
 )
@@ -20,6 +21,8 @@ type Builder struct {
 	upstreamKey        string
 	upstreamName       string
 	listenAddr         string
+	adminListenAddr    string
+	unixSocketMode     os.FileMode
 	transport          http.RoundTripper
 	logger             *log.Logger
 	retries            int
@@ -31,6 +34,7 @@ type Builder struct {
 	defaultAccountName string
 	defaultProxyKey    string
 	cliRunner          CliRunner
+	bootstrap          *config.Bootstrap
 }
 
 // NewBuilder 构建带默认监听地址和日志的 Builder。
@@ -47,6 +51,15 @@ func chooseNonEmpty(vals ...string) string {
 	return ""
 }
 
+func chooseNonZero(vals ...int) int {
+	for _, v := range vals {
+		if v != 0 {
+			return v
+		}
+	}
+	return 0
+}
+
 // WithUpstream 设置默认上游地址（必填）。
 func (b *Builder) WithUpstream(upstream string) *Builder {
 	b.upstreamRaw = upstream
@@ -73,6 +86,24 @@ func (b *Builder) WithListenAddr(addr string) *Builder {
 	return b
 }
 
+// WithAdminListenAddr 设置管理面（管理 API、监控、状态页与前端）的独立监听地址，空表示与代理共用端口。
+func (b *Builder) WithAdminListenAddr(addr string) *Builder {
+	b.adminListenAddr = addr
+	return b
+}
+
+// WithUnixSocketMode 设置 unix socket 监听文件的权限，0 表示默认 0660。
+func (b *Builder) WithUnixSocketMode(mode os.FileMode) *Builder {
+	b.unixSocketMode = mode
+	return b
+}
+
+// WithBootstrap 记录启动级配置，用于 TLS 监听与 /api/admin/config 展示；监听地址等仍需通过对应的 With 方法设置。
+func (b *Builder) WithBootstrap(cfg *config.Bootstrap) *Builder {
+	b.bootstrap = cfg
+	return b
+}
+
 // WithTransport 注入自定义 RoundTripper；默认为 http.DefaultTransport。
 func (b *Builder) WithTransport(t http.RoundTripper) *Builder {
 	b.transport = t
@@ -149,7 +180,7 @@ func (b *Builder) WithDefaultAccount(name, proxyKey string) *Builder {
 	return b
 }
 
-// WithStoreDSN 传入 MySQL DSN 以启用持久化。
+// WithStoreDSN 传入 MySQL DSN 或 sqlite:<path> 以启用持久化。
 func (b *Builder) WithStoreDSN(dsn string) *Builder {
 	b.storeDSN = dsn
 	return b
@@ -178,9 +209,19 @@ func (b *Builder) Build() (*Server, error) {
 	if err != nil {
 		return nil, err
 	}
+	dial := defaultDialPolicy()
+	if b.bootstrap != nil {
+		opts, err := b.bootstrap.Dial.Options()
+		if err != nil {
+			return nil, err
+		}
+		dial = newDialPolicy(opts)
+	}
 	transport := b.transport
 	if transport == nil {
-		transport = http.DefaultTransport
+		t := http.DefaultTransport.(*http.Transport).Clone()
+		t.DialContext = dial.dialContext()
+		transport = t
 	}
 	logger := b.logger
 	if logger == nil {
@@ -203,6 +244,14 @@ func (b *Builder) Build() (*Server, error) {
 			logger.Printf("invalid METRICS_CLEANUP_INTERVAL=%s, fallback to %v", v, defaultCleanupInterval)
 		}
 	}
+	consistencyInterval := defaultConsistencyInterval
+	if v := os.Getenv("METRICS_CONSISTENCY_INTERVAL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d >= 0 {
+			consistencyInterval = d
+		} else {
+			logger.Printf("invalid METRICS_CONSISTENCY_INTERVAL=%s, fallback to %v", v, defaultConsistencyInterval)
+		}
+	}
 	schedulerEnabled := true
 	if v := os.Getenv("METRICS_SCHEDULER_ENABLED"); v != "" {
 		schedulerEnabled = !(v == "0" || strings.EqualFold(v, "false") || strings.EqualFold(v, "off"))
@@ -220,8 +269,16 @@ func (b *Builder) Build() (*Server, error) {
 			healthAllInterval = defaultHealthAllInterval
 		}
 	}
-	healthRT := transport
-	transport = &retryTransport{base: transport, attempts: b.retries, logger: logger}
+	nodeTLS := newNodeTLSTransport(transport, dial)
+	healthRT := http.RoundTripper(nodeTLS)
+	chaos := newChaosState()
+	transport = &retryTransport{base: &chaosTransport{base: nodeTLS, state: chaos}, attempts: b.retries, logger: logger}
+	var secrets *secretBox
+	if b.bootstrap != nil {
+		if secrets, err = newSecretBox(b.bootstrap.EncryptionKey); err != nil {
+			return nil, err
+		}
+	}
 
 	var st *store.Store
 	if b.storeDSN != "" {
@@ -236,6 +293,7 @@ func (b *Builder) Build() (*Server, error) {
 		metricsScheduler = NewMetricsScheduler(st, logger)
 		metricsScheduler.aggregateInterval = aggregateInterval
 		metricsScheduler.cleanupInterval = cleanupInterval
+		metricsScheduler.consistencyInterval = consistencyInterval
 	}
 
 	adminKey := b.adminKey
@@ -261,35 +319,84 @@ func (b *Builder) Build() (*Server, error) {
 	srv := &Server{
 		accounts:         make(map[string]*Account),
 		accountByID:      make(map[string]*Account),
+		serviceKeys:      make(map[string]*Account),
 		nodeIndex:        make(map[string]*Node),
 		nodeAccount:      make(map[string]*Account),
+		nodeChanges:      newNodeChangeLog(),
 		listenAddr:       b.listenAddr,
+		adminListenAddr:  b.adminListenAddr,
+		unixSocketMode:   b.unixSocketMode,
+		bootstrap:        b.bootstrap,
 		transport:        transport,
 		healthRT:         healthRT,
+		chaos:            chaos,
+		nodeTLS:          nodeTLS,
+		secrets:          secrets,
 		cliRunner:        runner,
 		logger:           logger,
 		store:            st,
 		adminKey:         adminKey,
 		defaultAccName:   defaultAccountName,
 		sessionMgr:       NewSessionManager(defaultSessionTTL),
+		idempotency:      NewIdempotencyStore(defaultIdempotencyTTL),
+		dimLimiter:       newDimensionLimiter(),
+		affinity:         newAffinityCache(),
+		statusPages:      newStatusPageCache(),
 		metricsScheduler: metricsScheduler,
 		wsHub:            hub,
 	}
 
+	if st != nil {
+		srv.sessionMgr.persist = st
+		srv.sessionMgr.logger = logger
+	}
+	if metricsScheduler != nil {
+		metricsScheduler.paused = srv.maintenanceActive
+		metricsScheduler.publishProgress = srv.broadcastJobProgress
+	}
+	if b.bootstrap != nil {
+		sink, err := newRecordingSink(b.bootstrap.Recording, healthRT)
+		if err != nil {
+			return nil, err
+		}
+		srv.recorder = NewTrafficRecorder(srv, sink, logger)
+	}
+	srv.certWatch = NewClientCertWatcher(srv, logger)
+
 	if st != nil {
 		srv.settingsCache = NewSettingsCache(st)
+		srv.settingsSched = newSettingsScheduler(st, srv.settingsCache, hub, logger)
+		srv.adaptiveWeight = NewAdaptiveWeightScheduler(srv, logger)
+		srv.metricsFlusher = NewMetricsFlusher(srv, logger)
+		srv.benchmarkSched = NewBenchmarkScheduler(srv, logger)
+		// 任务 worker 随调度器启停，关闭调度器的实例只负责入队与查询。
+		workers := 0
+		if schedulerEnabled {
+			workers = jobWorkersFromEnv(logger)
+		}
+		srv.jobs = newJobRunner(st, logger, workers)
+		srv.jobs.paused = srv.maintenanceActive
+		srv.jobs.publish = srv.broadcastJobProgress
+		for typ, h := range srv.builtinJobHandlers() {
+			srv.jobs.register(typ, h)
+		}
 	}
 
+	srv.throughputTicker = NewThroughputBroadcaster(srv, logger)
+	srv.updates = NewUpdateNotifier(srv, logger)
+	srv.upstreamWatch = NewUpstreamStatusWatcher(srv, logger)
+
 	if healthAllInterval > 0 {
 		srv.healthScheduler = NewHealthScheduler(srv, healthAllInterval, logger)
 	}
 
 	if st != nil {
-		srv.notifyMgr = notify.NewManager(notify.NewStoreAdapter(st), notify.WithLogger(logger))
+		srv.notifyMgr = notify.NewManager(notify.NewStoreAdapter(st), notify.WithLogger(logger), notify.WithAlertHook(srv.broadcastAlert))
 	}
 
 	if rt, ok := transport.(*retryTransport); ok {
 		rt.notifyMgr = srv.notifyMgr
+		rt.annotate = srv.withUpstreamIncident
 	}
 
 	defaultCfg := store.Config{Retries: b.retries, FailLimit: b.failLimit, HealthEvery: b.healthEvery}
@@ -318,8 +425,17 @@ func (b *Builder) Build() (*Server, error) {
 				case int64:
 					srv.updateRetryMax(int(n))
 				}
+			default:
+				if dbPoolSettingKeys[key] {
+					srv.applyDBPoolSettings()
+				}
+				if dbTimeoutSettingKeys[key] {
+					srv.applyDBTimeoutSettings()
+				}
 			}
 		})
+		srv.applyDBPoolSettings()
+		srv.applyDBTimeoutSettings()
 	}
 
 	if st != nil {
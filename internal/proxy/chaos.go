@@ -0,0 +1,325 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultChaosDuration = 10 * time.Minute
+	maxChaosDuration     = time.Hour
+	maxChaosLatency      = time.Minute
+	chaosHeader          = "X-QCC-Chaos"
+)
+
+// chaosRule 单个节点的故障注入配置，概率取值 0-1，每次上游尝试（含重试）独立抽样。
+type chaosRule struct {
+	NodeID         string  `json:"node_id"`
+	ErrorRate      float64 `json:"error_rate"`       // 直接返回 ErrorStatus 的概率
+	ErrorStatus    int     `json:"error_status"`     // 5xx，默认 503
+	LatencyRate    float64 `json:"latency_rate"`     // 追加延迟的概率
+	LatencyMs      int     `json:"latency_ms"`       // 追加的延迟
+	DropRate       float64 `json:"drop_rate"`        // 响应体中途断开的概率
+	DropAfterBytes int     `json:"drop_after_bytes"` // 断开前透传的字节数
+	HealthChecks   bool    `json:"health_checks"`    // 健康检查按 ErrorRate 同样失败，模拟持续故障
+}
+
+func (r chaosRule) validate() error {
+	for name, v := range map[string]float64{"error_rate": r.ErrorRate, "latency_rate": r.LatencyRate, "drop_rate": r.DropRate} {
+		if v < 0 || v > 1 {
+			return fmt.Errorf("%s must be between 0 and 1", name)
+		}
+	}
+	if r.ErrorStatus != 0 && (r.ErrorStatus < 500 || r.ErrorStatus > 599) {
+		return fmt.Errorf("error_status must be 5xx")
+	}
+	if r.LatencyMs < 0 || time.Duration(r.LatencyMs)*time.Millisecond > maxChaosLatency {
+		return fmt.Errorf("latency_ms must be between 0 and %d", maxChaosLatency.Milliseconds())
+	}
+	if r.DropAfterBytes < 0 {
+		return fmt.Errorf("drop_after_bytes must be >= 0")
+	}
+	return nil
+}
+
+type chaosCounters struct {
+	errors, delays, drops, healthFails atomic.Int64
+}
+
+// chaosState 混沌测试模式：仅管理员可开启，只保存在内存中并在到期后自动失效，进程重启即关闭，
+// 避免演练配置遗留到生产流量上。
+type chaosState struct {
+	mu        sync.RWMutex
+	rules     map[string]chaosRule
+	expiresAt time.Time
+	startedAt time.Time
+	startedBy string
+	counters  map[string]*chaosCounters
+	rng       *rand.Rand
+	rngMu     sync.Mutex
+}
+
+func newChaosState() *chaosState {
+	return &chaosState{rng: rand.New(rand.NewSource(time.Now().UnixNano()))}
+}
+
+// rule 返回节点当前生效的规则。
+func (c *chaosState) rule(nodeID string, now time.Time) (chaosRule, *chaosCounters, bool) {
+	if c == nil {
+		return chaosRule{}, nil, false
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.rules == nil || !now.Before(c.expiresAt) {
+		return chaosRule{}, nil, false
+	}
+	r, ok := c.rules[nodeID]
+	return r, c.counters[nodeID], ok
+}
+
+// hit 按概率抽样。
+func (c *chaosState) hit(rate float64) bool {
+	if rate <= 0 {
+		return false
+	}
+	c.rngMu.Lock()
+	v := c.rng.Float64()
+	c.rngMu.Unlock()
+	return v < rate
+}
+
+func (c *chaosState) start(rules []chaosRule, d time.Duration, actor string, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.rules = make(map[string]chaosRule, len(rules))
+	c.counters = make(map[string]*chaosCounters, len(rules))
+	for _, r := range rules {
+		c.rules[r.NodeID] = r
+		c.counters[r.NodeID] = &chaosCounters{}
+	}
+	c.startedAt, c.expiresAt, c.startedBy = now, now.Add(d), actor
+}
+
+// stop 关闭混沌模式，返回此前是否处于生效状态。
+func (c *chaosState) stop(now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	active := c.rules != nil && now.Before(c.expiresAt)
+	c.rules = nil
+	c.expiresAt = time.Time{}
+	return active
+}
+
+// healthFailure 开启 health_checks 的节点按 error_rate 让健康检查失败。
+func (c *chaosState) healthFailure(nodeID string) (bool, string) {
+	r, counters, ok := c.rule(nodeID, time.Now())
+	if !ok || !r.HealthChecks || !c.hit(r.ErrorRate) {
+		return false, ""
+	}
+	counters.healthFails.Add(1)
+	return true, "chaos: injected health check failure"
+}
+
+func (c *chaosState) view(p *Server, now time.Time) map[string]interface{} {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	active := c.rules != nil && now.Before(c.expiresAt)
+	out := map[string]interface{}{"active": active}
+	if !active {
+		return out
+	}
+	rules := make([]map[string]interface{}, 0, len(c.rules))
+	for id, r := range c.rules {
+		name := ""
+		if n := p.getNode(id); n != nil {
+			name = n.Name
+		}
+		cnt := c.counters[id]
+		rules = append(rules, map[string]interface{}{
+			"rule":      r,
+			"node_name": name,
+			"injected": map[string]int64{
+				"errors":       cnt.errors.Load(),
+				"delays":       cnt.delays.Load(),
+				"drops":        cnt.drops.Load(),
+				"health_fails": cnt.healthFails.Load(),
+			},
+		})
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		return rules[i]["rule"].(chaosRule).NodeID < rules[j]["rule"].(chaosRule).NodeID
+	})
+	out["rules"] = rules
+	out["started_at"] = c.startedAt
+	out["started_by"] = c.startedBy
+	out["expires_at"] = c.expiresAt
+	out["remaining_sec"] = int(c.expiresAt.Sub(now).Seconds())
+	return out
+}
+
+// chaosTransport 位于重试层之下，按请求上下文中的节点注入延迟、5xx 与流中断，
+// 使注入的故障经过与真实故障相同的重试、熔断、切换与告警路径。
+type chaosTransport struct {
+	base  http.RoundTripper
+	state *chaosState
+}
+
+func (t *chaosTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	n := nodeFromCtx(req)
+	// 上下文节点即请求的实际目标（对冲请求为备用节点）；地址不一致时说明请求已被改写，不注入。
+	if n == nil || n.URL == nil || req.URL.Host != n.URL.Host {
+		return t.base.RoundTrip(req)
+	}
+	rule, counters, ok := t.state.rule(n.ID, time.Now())
+	if !ok {
+		return t.base.RoundTrip(req)
+	}
+	if rule.LatencyMs > 0 && t.state.hit(rule.LatencyRate) {
+		counters.delays.Add(1)
+		timer := time.NewTimer(time.Duration(rule.LatencyMs) * time.Millisecond)
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		}
+	}
+	if t.state.hit(rule.ErrorRate) {
+		counters.errors.Add(1)
+		status := rule.ErrorStatus
+		if status == 0 {
+			status = http.StatusServiceUnavailable
+		}
+		body, _ := json.Marshal(map[string]any{
+			"type":  "error",
+			"error": map[string]any{"type": "chaos_injected", "message": "chaos mode injected failure on node " + n.Name},
+		})
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return &http.Response{
+			StatusCode:    status,
+			Status:        strconv.Itoa(status) + " " + http.StatusText(status),
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        http.Header{"Content-Type": []string{"application/json"}, chaosHeader: []string{"error"}},
+			Body:          io.NopCloser(bytes.NewReader(body)),
+			ContentLength: int64(len(body)),
+			Request:       req,
+		}, nil
+	}
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusOK || !t.state.hit(rule.DropRate) {
+		return resp, err
+	}
+	counters.drops.Add(1)
+	resp.Header.Set(chaosHeader, "drop")
+	resp.Body = &chaosDropReader{rc: resp.Body, remaining: int64(rule.DropAfterBytes)}
+	resp.ContentLength = -1
+	resp.Header.Del("Content-Length")
+	return resp, nil
+}
+
+// chaosDropReader 透传指定字节数后以 ErrUnexpectedEOF 模拟上游连接中断。
+type chaosDropReader struct {
+	rc        io.ReadCloser
+	remaining int64
+}
+
+func (d *chaosDropReader) Read(b []byte) (int, error) {
+	if d.remaining <= 0 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	if int64(len(b)) > d.remaining {
+		b = b[:d.remaining]
+	}
+	n, err := d.rc.Read(b)
+	d.remaining -= int64(n)
+	if err == io.EOF {
+		// 上游提前结束时同样按中断处理，保证注入一定生效。
+		return n, io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func (d *chaosDropReader) Close() error {
+	return d.rc.Close()
+}
+
+// GET    /api/admin/chaos 查看混沌模式状态与注入计数
+// PUT    /api/admin/chaos 开启（覆盖）规则，{"rules":[{"node_id":"..","error_rate":0.5}],"duration_sec":600}
+// DELETE /api/admin/chaos 立即关闭
+func (p *Server) handleAdminChaos(w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(r.Context()) {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+		return
+	}
+	now := time.Now()
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, p.chaos.view(p, now))
+	case http.MethodPut:
+		var req struct {
+			Rules       []chaosRule `json:"rules"`
+			DurationSec int         `json:"duration_sec"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
+			return
+		}
+		if len(req.Rules) == 0 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "rules required"})
+			return
+		}
+		d := defaultChaosDuration
+		if req.DurationSec != 0 {
+			d = time.Duration(req.DurationSec) * time.Second
+		}
+		if d <= 0 || d > maxChaosDuration {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("duration_sec must be between 1 and %d", int(maxChaosDuration.Seconds()))})
+			return
+		}
+		seen := make(map[string]bool, len(req.Rules))
+		for _, rule := range req.Rules {
+			if p.getNode(rule.NodeID) == nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "node not found: " + rule.NodeID})
+				return
+			}
+			if seen[rule.NodeID] {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "duplicate rule for node " + rule.NodeID})
+				return
+			}
+			seen[rule.NodeID] = true
+			if err := rule.validate(); err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+				return
+			}
+		}
+		actor := auditActor(r)
+		p.chaos.start(req.Rules, d, actor, now)
+		p.logger.Printf("chaos mode enabled by %s for %d node(s), expires in %v", actor, len(req.Rules), d)
+		for _, rule := range req.Rules {
+			p.audit(p.getNode(rule.NodeID).AccountID, actor, "chaos.enable", rule.NodeID, map[string]interface{}{"rule": rule, "duration_sec": int(d.Seconds())})
+		}
+		writeJSON(w, http.StatusOK, p.chaos.view(p, now))
+	case http.MethodDelete:
+		if p.chaos.stop(now) {
+			actor := auditActor(r)
+			p.logger.Printf("chaos mode disabled by %s", actor)
+			p.audit("", actor, "chaos.disable", "", nil)
+		}
+		writeJSON(w, http.StatusOK, p.chaos.view(p, now))
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
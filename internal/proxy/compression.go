@@ -0,0 +1,254 @@
+package proxy
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/andybalholm/brotli"
+)
+
+// 小于该大小的响应压缩收益有限，直接输出。
+const minCompressBytes = 512
+
+var encoderPools = map[string]*sync.Pool{
+	encodingGzip: {New: func() any {
+		gz, _ := gzip.NewWriterLevel(io.Discard, gzip.DefaultCompression)
+		return gz
+	}},
+	encodingBrotli: {New: func() any {
+		return brotli.NewWriterLevel(io.Discard, brotli.DefaultCompression)
+	}},
+}
+
+// compressionStats 记录 API 压缩与上游压缩透传的字节统计。
+type compressionStats struct {
+	compressedResponses  atomic.Int64
+	rawBytes             atomic.Int64
+	compressedBytes      atomic.Int64
+	passthroughResponses atomic.Int64
+}
+
+func (s *compressionStats) snapshot() map[string]int64 {
+	raw := s.rawBytes.Load()
+	compressed := s.compressedBytes.Load()
+	return map[string]int64{
+		"compressed_responses":  s.compressedResponses.Load(),
+		"raw_bytes":             raw,
+		"compressed_bytes":      compressed,
+		"saved_bytes":           raw - compressed,
+		"passthrough_responses": s.passthroughResponses.Load(),
+	}
+}
+
+const (
+	encodingBrotli = "br"
+	encodingGzip   = "gzip"
+)
+
+// negotiateEncoding 按 Accept-Encoding 的 q 值在 br 与 gzip 之间选择压缩编码，都不接受时返回空串。
+// 显式条目优先于 "*" 通配；仅 q=0 表示拒绝；权重相同时优先 br（同等质量下压缩率更高）。
+func negotiateEncoding(r *http.Request) string {
+	brQ, gzipQ, wildcardQ := -1.0, -1.0, -1.0
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.TrimSpace(name)
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			key, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if !ok || !strings.EqualFold(strings.TrimSpace(key), "q") {
+				continue
+			}
+			v, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil {
+				v = 0
+			}
+			q = v
+		}
+		switch {
+		case strings.EqualFold(name, encodingBrotli):
+			brQ = q
+		case strings.EqualFold(name, encodingGzip):
+			gzipQ = q
+		case name == "*":
+			wildcardQ = q
+		}
+	}
+	if brQ < 0 {
+		brQ = wildcardQ
+	}
+	if gzipQ < 0 {
+		gzipQ = wildcardQ
+	}
+	switch {
+	case brQ > 0 && brQ >= gzipQ:
+		return encodingBrotli
+	case gzipQ > 0:
+		return encodingGzip
+	default:
+		return ""
+	}
+}
+
+// compressEncoder gzip.Writer 与 brotli.Writer 的公共接口，便于复用同一套缓冲与统计逻辑。
+type compressEncoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(io.Writer)
+}
+
+// countingWriter 统计实际写出的压缩字节数。
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(b []byte) (int, error) {
+	n, err := c.w.Write(b)
+	c.n += int64(n)
+	return n, err
+}
+
+// compressResponseWriter 缓冲首段输出，按内容类型与大小决定是否以协商出的编码压缩。
+type compressResponseWriter struct {
+	http.ResponseWriter
+	encoding string
+	stats    *compressionStats
+	status   int
+	buf      []byte
+	decided  bool
+	enc      compressEncoder
+	counter  *countingWriter
+	rawBytes int64
+}
+
+func (g *compressResponseWriter) WriteHeader(code int) {
+	if g.status == 0 {
+		g.status = code
+	}
+}
+
+func (g *compressResponseWriter) Write(b []byte) (int, error) {
+	if g.status == 0 {
+		g.status = http.StatusOK
+	}
+	if !g.decided {
+		g.buf = append(g.buf, b...)
+		if len(g.buf) < minCompressBytes {
+			return len(b), nil
+		}
+		if err := g.decide(); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+	if g.enc != nil {
+		g.rawBytes += int64(len(b))
+		return g.enc.Write(b)
+	}
+	return g.ResponseWriter.Write(b)
+}
+
+// decide 在获得足够内容后选择压缩或原样输出，并写出缓冲内容。
+func (g *compressResponseWriter) decide() error {
+	g.decided = true
+	h := g.ResponseWriter.Header()
+	ct := strings.ToLower(h.Get("Content-Type"))
+	compressible := len(g.buf) >= minCompressBytes &&
+		h.Get("Content-Encoding") == "" &&
+		g.status != http.StatusNoContent && g.status != http.StatusNotModified &&
+		(strings.Contains(ct, "json") || strings.HasPrefix(ct, "text/"))
+	if !compressible {
+		g.ResponseWriter.WriteHeader(g.status)
+		if len(g.buf) == 0 {
+			return nil
+		}
+		_, err := g.ResponseWriter.Write(g.buf)
+		g.buf = nil
+		return err
+	}
+
+	h.Del("Content-Length")
+	h.Set("Content-Encoding", g.encoding)
+	h.Add("Vary", "Accept-Encoding")
+	g.ResponseWriter.WriteHeader(g.status)
+	g.counter = &countingWriter{w: g.ResponseWriter}
+	g.enc = encoderPools[g.encoding].Get().(compressEncoder)
+	g.enc.Reset(g.counter)
+	g.rawBytes = int64(len(g.buf))
+	_, err := g.enc.Write(g.buf)
+	g.buf = nil
+	return err
+}
+
+// Flush 支持流式输出：先确定是否压缩，再逐层刷新。
+func (g *compressResponseWriter) Flush() {
+	if g.status == 0 {
+		g.status = http.StatusOK
+	}
+	if !g.decided {
+		_ = g.decide()
+	}
+	if g.enc != nil {
+		_ = g.enc.Flush()
+	}
+	if f, ok := g.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap 供 http.ResponseController 访问底层连接（如设置写超时）；Flush 仍经由本层以先刷新压缩缓冲。
+func (g *compressResponseWriter) Unwrap() http.ResponseWriter {
+	return g.ResponseWriter
+}
+
+func (g *compressResponseWriter) finish() {
+	if g.status == 0 && !g.decided {
+		return
+	}
+	if !g.decided {
+		_ = g.decide()
+	}
+	if g.enc == nil {
+		return
+	}
+	_ = g.enc.Close()
+	encoderPools[g.encoding].Put(g.enc)
+	g.enc = nil
+	if g.stats != nil {
+		g.stats.compressedResponses.Add(1)
+		g.stats.rawBytes.Add(g.rawBytes)
+		g.stats.compressedBytes.Add(g.counter.n)
+	}
+}
+
+// withCompression 按 Accept-Encoding 对 JSON/文本 API 响应进行 br 或 gzip 压缩。
+func (p *Server) withCompression(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding := negotiateEncoding(r)
+		if encoding == "" || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+		gw := &compressResponseWriter{ResponseWriter: w, encoding: encoding, stats: &p.compression}
+		defer gw.finish()
+		next.ServeHTTP(gw, r)
+	})
+}
+
+// handleCompressionStats GET /api/metrics/compression 返回压缩节省的字节统计。
+func (p *Server) handleCompressionStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if !isAdmin(r.Context()) {
+		respondJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+		return
+	}
+	respondJSON(w, http.StatusOK, p.compression.snapshot())
+}
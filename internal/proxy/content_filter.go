@@ -0,0 +1,182 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync/atomic"
+)
+
+// 内容过滤命中后的处理方式。
+const (
+	contentFilterReject = "reject" // 拒绝请求（默认）
+	contentFilterFlag   = "flag"   // 放行但记录审计事件
+)
+
+// contentFilter 为账号预编译的屏蔽规则。
+type contentFilter struct {
+	patterns []*regexp.Regexp
+	action   string
+}
+
+// contentFilterCounters 记录单个账号的过滤命中次数。
+type contentFilterCounters struct {
+	hits    atomic.Int64
+	blocked atomic.Int64
+	flagged atomic.Int64
+}
+
+// compileContentFilter 编译账号策略中的屏蔽正则，未配置时返回 nil。
+func compileContentFilter(policy AccountPolicy) (*contentFilter, error) {
+	if len(policy.BlockedPatterns) == 0 {
+		return nil, nil
+	}
+	action := strings.ToLower(strings.TrimSpace(policy.FilterAction))
+	switch action {
+	case "":
+		action = contentFilterReject
+	case contentFilterReject, contentFilterFlag:
+	default:
+		return nil, fmt.Errorf("invalid filter_action %q", policy.FilterAction)
+	}
+	f := &contentFilter{action: action}
+	for _, expr := range policy.BlockedPatterns {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid blocked pattern %q: %v", expr, err)
+		}
+		f.patterns = append(f.patterns, re)
+	}
+	return f, nil
+}
+
+// match 返回首个命中的规则序号，未命中返回 -1。
+func (f *contentFilter) match(text string) int {
+	for i, re := range f.patterns {
+		if re.MatchString(text) {
+			return i
+		}
+	}
+	return -1
+}
+
+// peekBody 读取请求体并复位，便于后续继续转发。
+func peekBody(r *http.Request) ([]byte, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, nil
+	}
+	body, err := io.ReadAll(r.Body)
+	_ = r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	return body, err
+}
+
+// extractPromptText 提取请求体中的 system/prompt/messages 文本内容。
+func extractPromptText(body []byte) string {
+	var payload map[string]any
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return ""
+	}
+	var sb strings.Builder
+	var collect func(v any)
+	collect = func(v any) {
+		switch t := v.(type) {
+		case string:
+			sb.WriteString(t)
+			sb.WriteByte('\n')
+		case []any:
+			for _, item := range t {
+				collect(item)
+			}
+		case map[string]any:
+			if text, ok := t["text"]; ok {
+				collect(text)
+			}
+			if content, ok := t["content"]; ok {
+				collect(content)
+			}
+		}
+	}
+	collect(payload["system"])
+	collect(payload["prompt"])
+	collect(payload["messages"])
+	return sb.String()
+}
+
+func (p *Server) contentFilterCountersFor(accountID string) *contentFilterCounters {
+	v, _ := p.contentFilterStats.LoadOrStore(accountID, &contentFilterCounters{})
+	return v.(*contentFilterCounters)
+}
+
+// applyContentFilter 对代理请求执行预检；请求被拒绝时已写出响应并返回 true。
+func (p *Server) applyContentFilter(w http.ResponseWriter, r *http.Request, acc *Account) bool {
+	p.mu.RLock()
+	var filter *contentFilter
+	if acc.rules != nil {
+		filter = acc.rules.filter
+	}
+	p.mu.RUnlock()
+	if filter == nil || r.Method != http.MethodPost {
+		return false
+	}
+	body, err := peekBody(r)
+	if err != nil {
+		return false
+	}
+	idx := filter.match(extractPromptText(body))
+	if idx < 0 {
+		return false
+	}
+
+	counters := p.contentFilterCountersFor(acc.ID)
+	counters.hits.Add(1)
+	detail := map[string]interface{}{
+		"pattern_index": idx,
+		"pattern":       filter.patterns[idx].String(),
+		"method":        r.Method,
+		"path":          r.URL.Path,
+	}
+	if filter.action == contentFilterFlag {
+		counters.flagged.Add(1)
+		p.audit(acc.ID, acc.ID, "content_filter.flag", r.URL.Path, detail)
+		return false
+	}
+	counters.blocked.Add(1)
+	p.audit(acc.ID, acc.ID, "content_filter.block", r.URL.Path, detail)
+	writeProxyError(w, http.StatusBadRequest, "content_filtered", "request blocked by content filter",
+		map[string]any{"pattern_index": idx})
+	return true
+}
+
+// handleContentFilterStats GET /api/metrics/content-filter 返回各账号的过滤命中统计。
+func (p *Server) handleContentFilterStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	caller := accountFromCtx(r)
+	if caller == nil {
+		respondJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		return
+	}
+	admin := isAdmin(r.Context())
+	out := make(map[string]map[string]int64)
+	p.contentFilterStats.Range(func(k, v any) bool {
+		id := k.(string)
+		if !admin && id != caller.ID {
+			return true
+		}
+		c := v.(*contentFilterCounters)
+		out[id] = map[string]int64{
+			"hits":    c.hits.Load(),
+			"blocked": c.blocked.Load(),
+			"flagged": c.flagged.Load(),
+		}
+		return true
+	})
+	respondJSON(w, http.StatusOK, map[string]interface{}{"accounts": out})
+}
@@ -0,0 +1,136 @@
+package proxy
+
+import (
+	"database/sql"
+	"net/http"
+	"runtime"
+	"time"
+
+	"qcc_plus/internal/store"
+)
+
+// dbPoolSettingKeys 连接池相关配置，任一变更都会重新应用整组参数。
+var dbPoolSettingKeys = map[string]bool{
+	"db.max_open_conns":        true,
+	"db.max_idle_conns":        true,
+	"db.conn_max_lifetime_sec": true,
+}
+
+// dbTimeoutSettingKeys 存储层各类操作的超时配置（毫秒）。
+var dbTimeoutSettingKeys = map[string]bool{
+	"db.timeout.read_ms":      true,
+	"db.timeout.write_ms":     true,
+	"db.timeout.aggregate_ms": true,
+	"db.timeout.cleanup_ms":   true,
+}
+
+// dbTimeouts 从 SettingsCache 读取存储层超时，未配置或非正数的项由存储层回落到默认值。
+func (p *Server) dbTimeouts() store.Timeouts {
+	def := store.DefaultTimeouts()
+	if p.settingsCache == nil {
+		return def
+	}
+	ms := func(key string, d time.Duration) time.Duration {
+		return time.Duration(p.settingsCache.GetInt(key, int(d/time.Millisecond))) * time.Millisecond
+	}
+	return store.Timeouts{
+		Read:      ms("db.timeout.read_ms", def.Read),
+		Write:     ms("db.timeout.write_ms", def.Write),
+		Aggregate: ms("db.timeout.aggregate_ms", def.Aggregate),
+		Cleanup:   ms("db.timeout.cleanup_ms", def.Cleanup),
+	}
+}
+
+// applyDBTimeoutSettings 将超时配置应用到存储层，立即对新发起的操作生效。
+func (p *Server) applyDBTimeoutSettings() {
+	if p.store == nil {
+		return
+	}
+	p.store.SetTimeouts(p.dbTimeouts())
+	t := p.store.Timeouts()
+	p.logger.Printf("db timeouts configured: read=%v write=%v aggregate=%v cleanup=%v", t.Read, t.Write, t.Aggregate, t.Cleanup)
+}
+
+// dbPoolConfig 从 SettingsCache 读取连接池参数，缺失或为负数时使用默认值。
+func (p *Server) dbPoolConfig() store.PoolConfig {
+	cfg := store.DefaultPoolConfig()
+	if p.settingsCache == nil {
+		return cfg
+	}
+	if n := p.settingsCache.GetInt("db.max_open_conns", cfg.MaxOpenConns); n >= 0 {
+		cfg.MaxOpenConns = n
+	}
+	if n := p.settingsCache.GetInt("db.max_idle_conns", cfg.MaxIdleConns); n >= 0 {
+		cfg.MaxIdleConns = n
+	}
+	if n := p.settingsCache.GetInt("db.conn_max_lifetime_sec", int(cfg.ConnMaxLifetime/time.Second)); n >= 0 {
+		cfg.ConnMaxLifetime = time.Duration(n) * time.Second
+	}
+	return cfg
+}
+
+// applyDBPoolSettings 将当前配置应用到数据库连接池，无需重启。
+func (p *Server) applyDBPoolSettings() {
+	if p.store == nil {
+		return
+	}
+	cfg := p.dbPoolConfig()
+	p.store.ApplyPoolConfig(cfg)
+	p.logger.Printf("db pool configured: max_open=%d max_idle=%d max_lifetime=%v", cfg.MaxOpenConns, cfg.MaxIdleConns, cfg.ConnMaxLifetime)
+}
+
+func dbPoolView(stats sql.DBStats, cfg store.PoolConfig) map[string]interface{} {
+	return map[string]interface{}{
+		"max_open_connections":  stats.MaxOpenConnections,
+		"open_connections":      stats.OpenConnections,
+		"in_use":                stats.InUse,
+		"idle":                  stats.Idle,
+		"wait_count":            stats.WaitCount,
+		"wait_duration_ms":      stats.WaitDuration.Milliseconds(),
+		"max_idle_closed":       stats.MaxIdleClosed,
+		"max_idle_time_closed":  stats.MaxIdleTimeClosed,
+		"max_lifetime_closed":   stats.MaxLifetimeClosed,
+		"max_idle_conns":        cfg.MaxIdleConns,
+		"conn_max_lifetime_sec": int64(cfg.ConnMaxLifetime / time.Second),
+	}
+}
+
+func dbTimeoutsView(t store.Timeouts) map[string]interface{} {
+	return map[string]interface{}{
+		"read_ms":      t.Read.Milliseconds(),
+		"write_ms":     t.Write.Milliseconds(),
+		"aggregate_ms": t.Aggregate.Milliseconds(),
+		"cleanup_ms":   t.Cleanup.Milliseconds(),
+	}
+}
+
+// handleAdminStats 处理 GET /api/admin/stats，返回数据库连接池、存储层超时、预编译语句缓存、健康检查调度、按需探活、WebSocket 连接、管理面接口耗时与运行时统计。
+func (p *Server) handleAdminStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if !isAdmin(r.Context()) {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+		return
+	}
+	res := map[string]interface{}{
+		"goroutines":    runtime.NumGoroutine(),
+		"db_pool":       nil,
+		"db_timeouts":   nil,
+		"db_stmt_cache": nil,
+		"health_checks": p.healthStats.view(p.healthPoolConfig()),
+		"health_probes": p.healthProbes.view(p.healthCacheTTL()),
+		"websocket":     nil,
+		"admin_routes":  p.adminRoutes.view(),
+	}
+	if p.wsHub != nil {
+		res["websocket"] = p.wsHub.statsView(p.wsLimits())
+	}
+	if p.store != nil {
+		res["db_pool"] = dbPoolView(p.store.PoolStats(), p.dbPoolConfig())
+		res["db_timeouts"] = dbTimeoutsView(p.store.Timeouts())
+		res["db_stmt_cache"] = p.store.StmtCacheStats()
+	}
+	writeJSON(w, http.StatusOK, res)
+}
@@ -0,0 +1,431 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"qcc_plus/internal/store"
+)
+
+const maxDeclarativeBytes = 4 << 20
+
+// declarativeDocument 期望状态文档。未出现的段（null）保持不变；nodes 出现时按名称对齐，
+// prune 为 true（默认）时删除文档中未列出的节点。settings 为系统级配置，仅处理列出的键。
+type declarativeDocument struct {
+	Nodes    *[]declarativeNode `json:"nodes"`
+	Routing  *AccountPolicy     `json:"routing"`
+	Settings map[string]any     `json:"settings"`
+	Prune    *bool              `json:"prune"`
+}
+
+// declarativeNode 以名称标识的节点期望状态；api_key、headers、health_interval_sec 为 null 时保留现值。
+type declarativeNode struct {
+	Name              string            `json:"name"`
+	BaseURL           string            `json:"base_url"`
+	APIKey            *string           `json:"api_key"`
+	Weight            int               `json:"weight"`
+	HealthCheckMethod string            `json:"health_check_method"`
+	HealthIntervalSec *int              `json:"health_interval_sec"`
+	Headers           map[string]string `json:"headers"`
+	Disabled          bool              `json:"disabled"`
+}
+
+// declarativeChange 计划中的一项变更，密钥类字段只给出字段名不给出取值。
+type declarativeChange struct {
+	Kind   string   `json:"kind"`   // node/routing/setting
+	Action string   `json:"action"` // create/update/delete
+	Name   string   `json:"name,omitempty"`
+	ID     string   `json:"id,omitempty"`
+	Fields []string `json:"fields,omitempty"`
+	From   any      `json:"from,omitempty"`
+	To     any      `json:"to,omitempty"`
+	Error  string   `json:"error,omitempty"`
+
+	node    *declarativeNode
+	setting *store.Setting
+}
+
+// declarativePlan 将文档与当前状态比较得到的变更列表，按 settings、routing、节点创建/更新、节点删除的顺序执行。
+type declarativePlan struct {
+	changes []*declarativeChange
+	policy  *AccountPolicy
+}
+
+// PUT /api/declarative?account_id=&dry_run=true
+// 接收完整的期望状态文档并将账号的节点、路由策略与系统配置调整为一致；dry_run=true 时只返回计划。
+func (p *Server) handleDeclarative(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	// 文档可改写路由策略与系统配置，与对应接口一样仅限管理员。
+	if !isAdmin(r.Context()) {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+		return
+	}
+	acc, ok := p.nodesAccount(w, r)
+	if !ok {
+		return
+	}
+	var doc declarativeDocument
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxDeclarativeBytes))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&doc); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid document: " + err.Error()})
+		return
+	}
+	plan, violations := p.planDeclarative(acc, doc)
+	if len(violations) > 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{"error": "invalid document", "violations": violations})
+		return
+	}
+
+	dryRun := r.URL.Query().Get("dry_run") == "true"
+	failed := 0
+	if !dryRun {
+		failed = p.applyDeclarative(acc, plan, auditActor(r))
+		p.audit(acc.ID, auditActor(r), "declarative.apply", acc.ID, plan.summary())
+	}
+	status := http.StatusOK
+	if failed > 0 {
+		status = http.StatusInternalServerError
+	}
+	writeJSON(w, status, map[string]interface{}{
+		"account_id": acc.ID,
+		"dry_run":    dryRun,
+		"applied":    !dryRun && failed == 0,
+		"failed":     failed,
+		"summary":    plan.summary(),
+		"changes":    plan.changes,
+	})
+}
+
+func (pl *declarativePlan) summary() map[string]int {
+	res := map[string]int{"create": 0, "update": 0, "delete": 0}
+	for _, c := range pl.changes {
+		res[c.Action]++
+	}
+	return res
+}
+
+// declarativeNodeState 现有节点中参与比较的字段。
+type declarativeNodeState struct {
+	id       string
+	baseURL  string
+	apiKey   string
+	weight   int
+	method   string
+	interval int
+	headers  map[string]string
+	disabled bool
+}
+
+// planDeclarative 校验文档并计算变更，存在任何校验错误时不返回计划。
+func (p *Server) planDeclarative(acc *Account, doc declarativeDocument) (*declarativePlan, []settingViolation) {
+	plan := &declarativePlan{}
+	var violations []settingViolation
+	bad := func(key, format string, args ...any) {
+		violations = append(violations, settingViolation{Key: key, Error: fmt.Sprintf(format, args...)})
+	}
+
+	if doc.Settings != nil {
+		plan.changes = append(plan.changes, p.planDeclarativeSettings(doc.Settings, bad)...)
+	}
+
+	if doc.Routing != nil {
+		desired := *doc.Routing
+		if err := validateAccountPolicy(&desired); err != nil {
+			bad("routing", "%v", err)
+		} else if fields := changedJSONFields(p.accountPolicy(acc), desired); len(fields) > 0 {
+			plan.policy = &desired
+			plan.changes = append(plan.changes, &declarativeChange{Kind: "routing", Action: "update", ID: acc.ID, Fields: fields})
+		}
+	}
+
+	if doc.Nodes != nil {
+		plan.changes = append(plan.changes, p.planDeclarativeNodes(acc, *doc.Nodes, doc.Prune == nil || *doc.Prune, bad)...)
+	}
+	return plan, violations
+}
+
+func (p *Server) planDeclarativeSettings(desired map[string]any, bad func(key, format string, args ...any)) []*declarativeChange {
+	if p.store == nil {
+		bad("settings", "settings store not enabled")
+		return nil
+	}
+	current, err := p.store.ListSettings("system", "", "")
+	if err != nil {
+		bad("settings", "%v", err)
+		return nil
+	}
+	existing := make(map[string]store.Setting, len(current))
+	for _, s := range current {
+		existing[s.Key] = s
+	}
+	keys := make([]string, 0, len(desired))
+	for k := range desired {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var proposed []store.Setting
+	var changes []*declarativeChange
+	for _, key := range keys {
+		old, ok := existing[key]
+		if !ok {
+			bad(key, "unknown setting")
+			continue
+		}
+		if settingValuesEqual(old.Value, desired[key]) {
+			continue
+		}
+		s := old
+		s.Value = desired[key]
+		proposed = append(proposed, s)
+		changes = append(changes, &declarativeChange{
+			Kind:    "setting",
+			Action:  "update",
+			Name:    key,
+			From:    maskedSettingValue(old, false),
+			To:      maskedSettingValue(s, false),
+			setting: &s,
+		})
+	}
+	for _, v := range validateProposedSettings(proposed, current) {
+		bad(v.Key, "%s", v.Error)
+	}
+	return changes
+}
+
+func (p *Server) planDeclarativeNodes(acc *Account, desired []declarativeNode, prune bool, bad func(key, format string, args ...any)) []*declarativeChange {
+	p.mu.RLock()
+	current := make(map[string]declarativeNodeState, len(acc.Nodes))
+	dupNames := map[string]bool{}
+	for id, n := range acc.Nodes {
+		if _, ok := current[n.Name]; ok {
+			dupNames[n.Name] = true
+		}
+		current[n.Name] = declarativeNodeState{
+			id:       id,
+			baseURL:  n.URL.String(),
+			apiKey:   n.APIKey,
+			weight:   n.Weight,
+			method:   n.HealthCheckMethod,
+			interval: int(n.HealthInterval / time.Second),
+			headers:  n.Headers,
+			disabled: n.Disabled,
+		}
+	}
+	p.mu.RUnlock()
+
+	var changes []*declarativeChange
+	seen := map[string]bool{}
+	for i := range desired {
+		dn := &desired[i]
+		dn.Name = strings.TrimSpace(dn.Name)
+		key := fmt.Sprintf("nodes[%d]", i)
+		switch {
+		case dn.Name == "":
+			bad(key, "name required")
+			continue
+		case seen[dn.Name]:
+			bad(key, "duplicate node name %q", dn.Name)
+			continue
+		case dupNames[dn.Name]:
+			bad(key, "node name %q matches several existing nodes", dn.Name)
+			continue
+		}
+		seen[dn.Name] = true
+		if u, err := url.Parse(strings.TrimSpace(dn.BaseURL)); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			bad(key, "invalid base_url")
+			continue
+		}
+		if dn.Weight < 0 || (dn.HealthIntervalSec != nil && *dn.HealthIntervalSec < 0) {
+			bad(key, "weight and health_interval_sec must be non-negative")
+			continue
+		}
+		if dn.Weight == 0 {
+			dn.Weight = 1
+		}
+		if dn.HealthCheckMethod != "" {
+			dn.HealthCheckMethod = normalizeHealthCheckMethod(dn.HealthCheckMethod)
+		}
+
+		cur, ok := current[dn.Name]
+		if !ok {
+			changes = append(changes, &declarativeChange{Kind: "node", Action: "create", Name: dn.Name, node: dn})
+			continue
+		}
+		var fields []string
+		if normalizeNodeURL(cur.baseURL) != normalizeNodeURL(dn.BaseURL) {
+			fields = append(fields, "base_url")
+		}
+		if dn.APIKey != nil && *dn.APIKey != cur.apiKey {
+			fields = append(fields, "api_key")
+		}
+		if dn.Weight != cur.weight {
+			fields = append(fields, "weight")
+		}
+		if dn.HealthCheckMethod != "" && dn.HealthCheckMethod != cur.method {
+			fields = append(fields, "health_check_method")
+		}
+		if dn.HealthIntervalSec != nil && *dn.HealthIntervalSec != cur.interval {
+			fields = append(fields, "health_interval_sec")
+		}
+		if dn.Headers != nil && !settingValuesEqual(dn.Headers, cur.headers) {
+			fields = append(fields, "headers")
+		}
+		if dn.Disabled != cur.disabled {
+			fields = append(fields, "disabled")
+		}
+		if len(fields) > 0 {
+			changes = append(changes, &declarativeChange{Kind: "node", Action: "update", Name: dn.Name, ID: cur.id, Fields: fields, node: dn})
+		}
+	}
+	if prune {
+		names := make([]string, 0, len(current))
+		for name := range current {
+			if !seen[name] {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			changes = append(changes, &declarativeChange{Kind: "node", Action: "delete", Name: name, ID: current[name].id})
+		}
+	}
+	return changes
+}
+
+// changedJSONFields 以 JSON 字段名列出 a、b 之间取值不同的字段。
+func changedJSONFields(a, b any) []string {
+	toMap := func(v any) map[string]any {
+		m := map[string]any{}
+		raw, _ := json.Marshal(v)
+		_ = json.Unmarshal(raw, &m)
+		return m
+	}
+	am, bm := toMap(a), toMap(b)
+	var fields []string
+	for k, v := range bm {
+		if !settingValuesEqual(am[k], v) {
+			fields = append(fields, k)
+		}
+	}
+	for k := range am {
+		if _, ok := bm[k]; !ok {
+			fields = append(fields, k)
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// applyDeclarative 依次执行计划中的变更，单项失败记录在该变更的 error 中并继续，返回失败项数。
+func (p *Server) applyDeclarative(acc *Account, plan *declarativePlan, actor string) int {
+	failed := 0
+	record := func(c *declarativeChange, err error) {
+		if err != nil {
+			c.Error = err.Error()
+			failed++
+		}
+	}
+	settingsChanged := false
+	for _, c := range plan.changes {
+		switch {
+		case c.Kind == "setting":
+			if actor != "" {
+				c.setting.UpdatedBy = &actor
+			}
+			err := p.store.UpsertSetting(c.setting)
+			settingsChanged = settingsChanged || err == nil
+			record(c, err)
+		case c.Kind == "routing":
+			record(c, p.setAccountPolicy(acc.ID, *plan.policy, actor))
+		case c.Kind == "node" && c.Action == "create":
+			record(c, p.createDeclarativeNode(acc, c))
+		case c.Kind == "node" && c.Action == "update":
+			record(c, p.updateDeclarativeNode(c))
+		}
+	}
+	// 删除放在最后，避免先删后建期间账号短暂没有可用节点。
+	for _, c := range plan.changes {
+		if c.Kind == "node" && c.Action == "delete" {
+			record(c, p.deleteNode(c.ID))
+		}
+	}
+	if settingsChanged && p.settingsCache != nil {
+		p.settingsCache.Refresh()
+	}
+	return failed
+}
+
+func (p *Server) createDeclarativeNode(acc *Account, c *declarativeChange) error {
+	dn := c.node
+	apiKey := ""
+	if dn.APIKey != nil {
+		apiKey = *dn.APIKey
+	}
+	interval := 0
+	if dn.HealthIntervalSec != nil {
+		interval = *dn.HealthIntervalSec
+	}
+	n, err := p.addNodeWithOptions(acc, dn.Name, strings.TrimSpace(dn.BaseURL), apiKey, dn.Weight, dn.HealthCheckMethod, dn.Headers, time.Duration(interval)*time.Second)
+	if err != nil {
+		return err
+	}
+	c.ID = n.ID
+	if dn.Disabled {
+		return p.disableNode(n.ID)
+	}
+	return nil
+}
+
+func (p *Server) updateDeclarativeNode(c *declarativeChange) error {
+	dn := c.node
+	var method *string
+	if dn.HealthCheckMethod != "" {
+		method = &dn.HealthCheckMethod
+	}
+	if err := p.updateNode(c.ID, dn.Name, strings.TrimSpace(dn.BaseURL), dn.APIKey, dn.Weight, method); err != nil {
+		return err
+	}
+	if dn.Headers != nil || dn.HealthIntervalSec != nil {
+		p.mu.Lock()
+		n := p.nodeIndex[c.ID]
+		if n == nil {
+			p.mu.Unlock()
+			return fmt.Errorf("node %s not found", c.ID)
+		}
+		if dn.Headers != nil {
+			n.Headers = dn.Headers
+		}
+		if dn.HealthIntervalSec != nil {
+			n.HealthInterval = time.Duration(*dn.HealthIntervalSec) * time.Second
+		}
+		rec := toRecord(n)
+		p.mu.Unlock()
+		p.markNodeChanged(c.ID)
+		if p.store != nil {
+			if err := p.store.UpsertNode(context.Background(), rec); err != nil {
+				return err
+			}
+		}
+	}
+	p.mu.RLock()
+	disabled := p.nodeIndex[c.ID] != nil && p.nodeIndex[c.ID].Disabled
+	p.mu.RUnlock()
+	switch {
+	case dn.Disabled && !disabled:
+		return p.disableNode(c.ID)
+	case !dn.Disabled && disabled:
+		return p.enableNode(c.ID)
+	}
+	return nil
+}
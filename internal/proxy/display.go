@@ -0,0 +1,188 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"qcc_plus/internal/i18n"
+	"qcc_plus/internal/store"
+	"qcc_plus/internal/timeutil"
+)
+
+const accountDisplaySettingKey = "account.display"
+
+// AccountDisplay 账号的展示时区与语言，持久化为账号级配置 account.display。
+// 报表与导出中的时间按此格式化；字段为空时时区使用北京时间，语言按请求的 Accept-Language 协商。
+type AccountDisplay struct {
+	Timezone string `json:"timezone,omitempty"` // IANA 时区名，如 Asia/Shanghai、UTC
+	Locale   string `json:"locale,omitempty"`   // zh-CN/en-US
+}
+
+// normalize 校验时区与语言，返回规范化后的副本与时区。
+func (d AccountDisplay) normalize() (AccountDisplay, *time.Location, error) {
+	d.Timezone = strings.TrimSpace(d.Timezone)
+	loc := timeutil.BeijingLocation
+	if d.Timezone != "" {
+		l, err := time.LoadLocation(d.Timezone)
+		if err != nil || strings.EqualFold(d.Timezone, "local") {
+			return d, nil, fmt.Errorf("invalid timezone: %s", d.Timezone)
+		}
+		loc = l
+	}
+	if d.Locale != "" {
+		locale := i18n.Normalize(d.Locale)
+		if locale == "" {
+			return d, nil, fmt.Errorf("unsupported locale: %s (options: %s)", d.Locale, strings.Join(i18n.Supported(), "/"))
+		}
+		d.Locale = locale
+	}
+	return d, loc, nil
+}
+
+// displayFormat 按时区与语言格式化报表中的时间。
+type displayFormat struct {
+	loc    *time.Location
+	locale string
+}
+
+func (f displayFormat) time(t time.Time) string {
+	return i18n.FormatTime(t, f.loc, f.locale)
+}
+
+// displayFormat 返回请求所用的时间格式：账号配置优先，语言其次按 Accept-Language 协商。
+// 同时设置 Content-Language 响应头。
+func (p *Server) displayFormat(w http.ResponseWriter, r *http.Request, acc *Account) displayFormat {
+	f := displayFormat{loc: timeutil.BeijingLocation}
+	if acc != nil {
+		p.mu.RLock()
+		if acc.displayLoc != nil {
+			f.loc = acc.displayLoc
+		}
+		f.locale = acc.Display.Locale
+		p.mu.RUnlock()
+	}
+	if f.locale == "" {
+		f.locale = i18n.Negotiate(r.Header.Get("Accept-Language"))
+	}
+	w.Header().Set("Content-Language", f.locale)
+	return f
+}
+
+// writeLocalizedError 返回错误响应：error 保持稳定的英文取值供程序判断，message 为按 Accept-Language 本地化的提示。
+func writeLocalizedError(w http.ResponseWriter, r *http.Request, status int, code, key string) {
+	locale := i18n.Negotiate(r.Header.Get("Accept-Language"))
+	w.Header().Set("Content-Language", locale)
+	writeJSON(w, status, map[string]string{"error": code, "message": i18n.T(locale, key)})
+}
+
+// accountDisplay 返回账号展示配置副本。
+func (p *Server) accountDisplay(acc *Account) AccountDisplay {
+	if acc == nil {
+		return AccountDisplay{}
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return acc.Display
+}
+
+// loadAccountDisplay 从配置表读取账号展示配置，不存在或无效时返回零值。
+func (p *Server) loadAccountDisplay(accountID string) (AccountDisplay, *time.Location) {
+	var display AccountDisplay
+	if p.store == nil {
+		return display, nil
+	}
+	setting, err := p.store.GetSetting(accountDisplaySettingKey, "account", accountID)
+	if err != nil || setting == nil {
+		return display, nil
+	}
+	if b, err := json.Marshal(setting.Value); err == nil {
+		_ = json.Unmarshal(b, &display)
+	}
+	display, loc, err := display.normalize()
+	if err != nil {
+		p.logger.Printf("account %s display settings ignored: %v", accountID, err)
+		return AccountDisplay{}, nil
+	}
+	return display, loc
+}
+
+// setAccountDisplay 更新内存中的账号展示配置并持久化。
+func (p *Server) setAccountDisplay(accountID string, display AccountDisplay, loc *time.Location, updatedBy string) error {
+	if p.store != nil {
+		id := accountID
+		desc := "账号展示时区与语言"
+		setting := &store.Setting{
+			Key:         accountDisplaySettingKey,
+			Scope:       "account",
+			AccountID:   &id,
+			Value:       display,
+			DataType:    "object",
+			Category:    "monitor",
+			Description: &desc,
+		}
+		if updatedBy != "" {
+			setting.UpdatedBy = &updatedBy
+		}
+		if err := p.store.UpsertSetting(setting); err != nil {
+			return err
+		}
+	}
+	p.mu.Lock()
+	if acc := p.accountByID[accountID]; acc != nil {
+		acc.Display = display
+		acc.displayLoc = loc
+	}
+	p.mu.Unlock()
+	return nil
+}
+
+// GET/PUT /admin/api/accounts/display?account_id=
+// PUT 整体替换，提交空对象恢复默认。
+func (p *Server) handleAccountDisplay(w http.ResponseWriter, r *http.Request) {
+	caller := accountFromCtx(r)
+	if caller == nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		return
+	}
+	id := chooseNonEmpty(r.URL.Query().Get("account_id"), caller.ID)
+	if !canManageAccount(r.Context(), id) {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+		return
+	}
+	acc := p.getAccountByID(id)
+	if acc == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "account not found"})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"account_id": acc.ID,
+			"display":    p.accountDisplay(acc),
+			"locales":    i18n.Supported(),
+		})
+	case http.MethodPut:
+		var display AccountDisplay
+		if err := json.NewDecoder(r.Body).Decode(&display); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
+			return
+		}
+		display, loc, err := display.normalize()
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		if err := p.setAccountDisplay(acc.ID, display, loc, caller.ID); err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		p.audit(acc.ID, auditActor(r), "account.display.update", acc.ID, display)
+		writeJSON(w, http.StatusOK, map[string]interface{}{"account_id": acc.ID, "display": display})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,71 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// endpointAllowed 判断路径是否在允许列表中：条目以 * 结尾时按前缀匹配，否则精确匹配；列表为空表示不限制。
+// 匹配前先规范化路径，避免通过 ../ 或重复斜杠绕过。
+func endpointAllowed(allowed []string, reqPath string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	clean := path.Clean("/" + reqPath)
+	for _, entry := range allowed {
+		if prefix, ok := strings.CutSuffix(entry, "*"); ok {
+			if strings.HasPrefix(clean, prefix) {
+				return true
+			}
+		} else if clean == path.Clean(entry) {
+			return true
+		}
+	}
+	return false
+}
+
+// validateAllowedPaths 校验允许路径列表的格式。
+func validateAllowedPaths(allowed []string) error {
+	for _, entry := range allowed {
+		if !strings.HasPrefix(entry, "/") {
+			return fmt.Errorf("allowed path %q must start with /", entry)
+		}
+		if i := strings.Index(entry, "*"); i >= 0 && i != len(entry)-1 {
+			return fmt.Errorf("allowed path %q may only use * as a trailing wildcard", entry)
+		}
+	}
+	return nil
+}
+
+// allowedPathsFor 返回请求所用密钥的允许路径：服务账号按其自身设置，不继承账号策略；
+// 账号代理密钥（及回落到默认账号的请求）按账号策略。
+func (p *Server) allowedPathsFor(acc *Account, service *ServiceAccount) []string {
+	if service != nil {
+		return service.AllowedPaths
+	}
+	return p.accountPolicy(acc).AllowedPaths
+}
+
+// applyEndpointAllowlist 拒绝代理密钥无权调用的上游路径并记录审计事件；请求被拒绝时已写出响应并返回 true。
+func (p *Server) applyEndpointAllowlist(w http.ResponseWriter, r *http.Request, acc *Account, service *ServiceAccount) bool {
+	allowed := p.allowedPathsFor(acc, service)
+	if endpointAllowed(allowed, r.URL.Path) {
+		return false
+	}
+	p.logger.Printf("reject %s %s: endpoint not allowed (account=%s)", r.Method, r.URL.Path, acc.ID)
+	details := map[string]interface{}{
+		"method":  r.Method,
+		"path":    r.URL.Path,
+		"key_id":  keyFingerprint(extractAPIKey(r)),
+		"allowed": allowed,
+	}
+	if service != nil {
+		details["service_account"] = service.ID
+	}
+	p.audit(acc.ID, acc.ID, "proxy.endpoint_denied", r.URL.Path, details)
+	writeProxyError(w, http.StatusForbidden, "endpoint_not_allowed",
+		fmt.Sprintf("this key is not allowed to call %s", r.URL.Path), nil)
+	return true
+}
@@ -0,0 +1,219 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+
+	"qcc_plus/internal/store"
+	"qcc_plus/internal/timeutil"
+)
+
+// 上游失败的固定分类。
+const (
+	ErrorClassTimeout     = "timeout"            // 连接或响应超时（含 408/504）
+	ErrorClassConnRefused = "connection_refused" // 连接被拒绝/重置
+	ErrorClassDNS         = "dns"                // 域名解析失败
+	ErrorClassTLS         = "tls"                // 证书或握手错误
+	ErrorClassAuth        = "auth"               // 401/403
+	ErrorClassThrottled   = "throttled"          // 429
+	ErrorClassClientError = "client_error"       // 其他 4xx
+	ErrorClassServerError = "server_error"       // 5xx
+	ErrorClassStream      = "malformed_stream"   // SSE 中断、缺少结束事件或含 error 事件
+	ErrorClassFirstByte   = "first_byte_timeout" // 流式响应头已返回，但首字节超时
+	ErrorClassCanceled    = "canceled"           // 客户端取消
+	ErrorClassNetwork     = "network"            // 其他网络错误
+	ErrorClassOther       = "other"
+)
+
+// errorClasses 为分类的固定展示顺序。
+var errorClasses = []string{
+	ErrorClassTimeout, ErrorClassConnRefused, ErrorClassDNS, ErrorClassTLS,
+	ErrorClassAuth, ErrorClassThrottled, ErrorClassClientError, ErrorClassServerError,
+	ErrorClassStream, ErrorClassFirstByte, ErrorClassCanceled, ErrorClassNetwork, ErrorClassOther,
+}
+
+// classifyTransportError 对传输层错误分类。
+func classifyTransportError(err error) string {
+	if err == nil {
+		return ""
+	}
+	if errors.Is(err, context.Canceled) {
+		return ErrorClassCanceled
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ErrorClassTimeout
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return ErrorClassDNS
+	}
+	var (
+		recordErr   tls.RecordHeaderError
+		verifyErr   *tls.CertificateVerificationError
+		unknownCA   x509.UnknownAuthorityError
+		hostnameErr x509.HostnameError
+		invalidErr  x509.CertificateInvalidError
+	)
+	if errors.As(err, &recordErr) || errors.As(err, &verifyErr) || errors.As(err, &unknownCA) ||
+		errors.As(err, &hostnameErr) || errors.As(err, &invalidErr) || strings.Contains(err.Error(), "tls:") {
+		return ErrorClassTLS
+	}
+	if errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) {
+		return ErrorClassConnRefused
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		if netErr.Timeout() {
+			return ErrorClassTimeout
+		}
+		return ErrorClassNetwork
+	}
+	return ErrorClassOther
+}
+
+// classifyUpstreamError 根据状态码或传输错误给出分类，成功请求返回空串。
+func classifyUpstreamError(status int, err error) string {
+	if err != nil {
+		return classifyTransportError(err)
+	}
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return ErrorClassAuth
+	case status == http.StatusTooManyRequests:
+		return ErrorClassThrottled
+	case status == http.StatusRequestTimeout || status == http.StatusGatewayTimeout:
+		return ErrorClassTimeout
+	case status >= 500:
+		return ErrorClassServerError
+	case status >= 400:
+		return ErrorClassClientError
+	case status >= 200 && status < 400:
+		return ""
+	default:
+		return ErrorClassOther
+	}
+}
+
+// classifyRequest 综合代理回调记录的上游状态给出一次请求的失败分类。
+func classifyRequest(status int, u *usage) string {
+	if u == nil {
+		return classifyUpstreamError(status, nil)
+	}
+	if u.firstByteStall {
+		return ErrorClassFirstByte
+	}
+	if u.transportErr != nil {
+		return classifyTransportError(u.transportErr)
+	}
+	if u.upstreamStatus != 0 {
+		status = u.upstreamStatus
+	}
+	if class := classifyUpstreamError(status, nil); class != "" {
+		return class
+	}
+	if u.streamBroken {
+		return ErrorClassStream
+	}
+	return ""
+}
+
+// GET /api/metrics/errors?account_id=&node_id=&from=&to=
+// 按分类汇总失败请求（基于原始指标，默认最近 1 小时）。
+func (p *Server) handleErrorTaxonomy(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if p.store == nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "store not enabled"})
+		return
+	}
+	caller := accountFromCtx(r)
+	if caller == nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		return
+	}
+	q := r.URL.Query()
+	accountID := q.Get("account_id")
+	if !isAdmin(r.Context()) {
+		if accountID != "" && accountID != caller.ID {
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+			return
+		}
+		accountID = caller.ID
+	}
+	accountID = chooseNonEmpty(accountID, caller.ID)
+	from, to, err := parseTimeRange(q.Get("from"), q.Get("to"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	if to.IsZero() {
+		to = time.Now()
+	}
+	if from.IsZero() {
+		from = to.Add(-time.Hour)
+	}
+	rows, err := p.store.ErrorsByClass(r.Context(), accountID, q.Get("node_id"), from, to)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, buildErrorTaxonomy(accountID, from, to, rows))
+}
+
+func buildErrorTaxonomy(accountID string, from, to time.Time, rows []store.ErrorClassCount) map[string]interface{} {
+	totals := make(map[string]int64, len(errorClasses))
+	byNode := make(map[string]map[string]int64)
+	var total int64
+	for _, row := range rows {
+		class := row.ErrorClass
+		if !containsString(errorClasses, class) {
+			class = ErrorClassOther
+		}
+		totals[class] += row.Count
+		total += row.Count
+		if byNode[row.NodeID] == nil {
+			byNode[row.NodeID] = make(map[string]int64)
+		}
+		byNode[row.NodeID][class] += row.Count
+	}
+	classes := make([]map[string]interface{}, 0, len(errorClasses))
+	top := ""
+	for _, class := range errorClasses {
+		count := totals[class]
+		share := 0.0
+		if total > 0 {
+			share = float64(count) / float64(total)
+		}
+		if count > 0 && (top == "" || count > totals[top]) {
+			top = class
+		}
+		classes = append(classes, map[string]interface{}{"class": class, "count": count, "share": share})
+	}
+	return map[string]interface{}{
+		"account_id":   accountID,
+		"from":         timeutil.FormatBeijingTime(from),
+		"to":           timeutil.FormatBeijingTime(to),
+		"total_failed": total,
+		"top_class":    top,
+		"classes":      classes,
+		"by_node":      byNode,
+	}
+}
+
+func containsString(list []string, v string) bool {
+	for _, s := range list {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
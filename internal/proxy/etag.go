@@ -0,0 +1,46 @@
+package proxy
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// computeETag 基于任意可序列化内容生成弱 ETag。
+func computeETag(parts ...interface{}) string {
+	h := sha1.New()
+	enc := json.NewEncoder(h)
+	for _, part := range parts {
+		_ = enc.Encode(part)
+	}
+	return `W/"` + hex.EncodeToString(h.Sum(nil)[:12]) + `"`
+}
+
+// etagMatches 判断 If-None-Match 是否命中当前 ETag（弱比较）。
+func etagMatches(r *http.Request, etag string) bool {
+	header := r.Header.Get("If-None-Match")
+	if header == "" || etag == "" {
+		return false
+	}
+	want := strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == want {
+			return true
+		}
+	}
+	return false
+}
+
+// writeJSONWithETag 写入带 ETag 的 JSON；若客户端缓存仍有效则返回 304。
+func writeJSONWithETag(w http.ResponseWriter, r *http.Request, etag string, v interface{}) {
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+	if etagMatches(r, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	writeJSON(w, http.StatusOK, v)
+}
@@ -0,0 +1,88 @@
+package proxy
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+const (
+	defaultFirstByteTimeoutMs = 30000
+	firstBytePeekSize         = 4096
+)
+
+// errFirstByteTimeout 上游已返回响应头，但在首字节超时内没有任何内容。
+var errFirstByteTimeout = errors.New("upstream stream stalled before first byte")
+
+// firstByteTimeout 返回流式响应的首字节超时，0 表示不检测。
+func (p *Server) firstByteTimeout() time.Duration {
+	ms := defaultFirstByteTimeoutMs
+	if p.settingsCache != nil {
+		ms = p.settingsCache.GetInt("proxy.first_byte_timeout_ms", defaultFirstByteTimeoutMs)
+	}
+	if ms <= 0 {
+		return 0
+	}
+	return time.Duration(ms) * time.Millisecond
+}
+
+func (p *Server) firstByteRecheck() bool {
+	return p.settingsCache == nil || p.settingsCache.GetBool("proxy.first_byte_recheck", true)
+}
+
+// prefetchedBody 先返回已预读的首块内容，再继续读取上游响应。
+type prefetchedBody struct {
+	io.Reader
+	io.Closer
+}
+
+type errorReader struct{ err error }
+
+func (r errorReader) Read([]byte) (int, error) { return 0, r.err }
+
+// awaitFirstByte 在转发响应头之前等待首块内容：超时则关闭上游连接并返回 errFirstByteTimeout，
+// 此时客户端尚未收到响应头，可改为返回结构化错误；否则返回包含预读内容的响应体。
+func awaitFirstByte(body io.ReadCloser, timeout time.Duration) (io.ReadCloser, error) {
+	type result struct {
+		n   int
+		err error
+	}
+	buf := make([]byte, firstBytePeekSize)
+	ch := make(chan result, 1)
+	go func() {
+		n, err := body.Read(buf)
+		ch <- result{n, err}
+	}()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case res := <-ch:
+		var rest io.Reader = body
+		if res.err != nil {
+			rest = errorReader{res.err}
+		}
+		return &prefetchedBody{Reader: io.MultiReader(bytes.NewReader(buf[:res.n]), rest), Closer: body}, nil
+	case <-timer.C:
+		// 关闭响应体使阻塞的读取返回，避免 goroutine 泄漏。
+		_ = body.Close()
+		return nil, errFirstByteTimeout
+	}
+}
+
+// handleFirstByteTimeout 返回首字节超时的结构化错误，并按配置触发节点健康复检。
+func (p *Server) handleFirstByteTimeout(w http.ResponseWriter, r *http.Request, node *Node, timeout time.Duration) {
+	p.logger.Printf("first byte timeout %s %s via %s after %v", r.Method, r.URL.String(), node.Name, timeout)
+	if acc := accountFromCtx(r); acc != nil && p.firstByteRecheck() {
+		go func() {
+			if _, _, err := p.probeNodeHealth(acc, node.ID, true); err != nil {
+				p.logger.Printf("first byte recheck failed for node %s: %v", node.Name, err)
+			}
+		}()
+	}
+	writeProxyError(w, http.StatusGatewayTimeout, ErrorClassFirstByte,
+		fmt.Sprintf("upstream sent response headers but no content within %dms", timeout.Milliseconds()),
+		map[string]any{"node": node.Name, "timeout_ms": timeout.Milliseconds()})
+}
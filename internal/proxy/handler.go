@@ -11,10 +11,52 @@ import (
 	"strings"
 	"time"
 
+	"qcc_plus/internal/i18n"
+	"qcc_plus/internal/store"
+	"qcc_plus/internal/timeutil"
 	"qcc_plus/internal/version"
 	"qcc_plus/web"
 )
 
+// adminAPIPrefixes 为需要交给 apiMux 处理的新增管理 API 前缀。
+var adminAPIPrefixes = []string{
+	"/api/audit-logs",
+	"/api/request-logs",
+	"/api/routing",
+	"/api/metrics/content-filter",
+	"/api/metrics/errors",
+	"/api/metrics/hedging",
+	"/api/metrics/streams",
+	"/api/usage",
+	"/api/shares",
+	"/api/status-page",
+	"/api/incidents",
+	"/api/alerts",
+	"/api/requests",
+	"/api/admin",
+	"/api/ui",
+	"/api/version",
+	"/api/docs/",
+	"/api/accounts/",
+	"/api/invitations/",
+	"/api/auth/",
+	"/api/declarative",
+	upstreamStatusAPIPrefix,
+	nodeHooksAPIPrefix,
+	"/api/replay/",
+	"/api/ab-comparisons",
+	jobsAPIPath,
+}
+
+func hasAnyPrefix(path string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
 func spaFileExists(fsys fs.FS, name string) bool {
 	name = strings.TrimPrefix(name, "/")
 	if name == "" {
@@ -55,22 +97,37 @@ func spaHandler(fsys fs.FS) http.HandlerFunc {
 	}
 }
 
-func (p *Server) handler() http.Handler {
+// 监听器角色：未单独配置管理端口时使用 listenerAll 同时提供管理面与代理转发。
+const (
+	listenerAll = iota
+	listenerProxy
+	listenerAdmin
+)
+
+// handler 按监听器角色构建处理器：listenerProxy 仅转发代理请求（以及 /version），listenerAdmin 仅提供管理面。
+func (p *Server) handler(role int) http.Handler {
 	spaFS, err := fs.Sub(web.DistFS, "dist")
 	if err != nil {
 		panic(fmt.Sprintf("web assets missing: %v", err))
 	}
 	spa := spaHandler(spaFS)
 
-	apiMux := http.NewServeMux()
+	apiMux := newAPIRouter()
 	apiMux.HandleFunc("/login", p.handleLogin)
 	apiMux.HandleFunc("/logout", p.handleLogout)
 	apiMux.HandleFunc("/admin/api/accounts", p.requireSession(p.handleAccounts))
-	apiMux.HandleFunc("/admin/api/nodes", p.requireSession(p.handleNodes))
+	apiMux.HandleFunc("/admin/api/accounts/policy", p.requireSession(p.handleAccountPolicy))
+	apiMux.HandleFunc("/admin/api/accounts/display", p.requireSession(p.handleAccountDisplay))
+	apiMux.HandleFunc("/admin/api/accounts/key", p.requireSession(p.handleAccountKey))
+	apiMux.HandleFunc("/admin/api/accounts/service-accounts", p.requireSession(p.handleServiceAccounts))
+	apiMux.HandleFunc("/admin/api/accounts/purge-jobs", p.requireSession(p.handleAccountPurgeJobs))
+	apiMux.HandleFunc(impersonatePath, p.requireSession(p.handleImpersonate))
+	apiMux.HandleFunc("/admin/api/nodes", p.requireSession(p.withIdempotency(p.handleNodes)))
 	apiMux.HandleFunc("/admin/api/config", p.requireSession(p.handleConfig))
 	apiMux.HandleFunc("/admin/api/nodes/activate", p.requireSession(p.handleActivate))
 	apiMux.HandleFunc("/admin/api/nodes/disable", p.requireSession(p.handleDisable))
 	apiMux.HandleFunc("/admin/api/nodes/enable", p.requireSession(p.handleEnable))
+	apiMux.HandleFunc("/admin/api/nodes/drain", p.requireSession(p.handleDrain))
 	apiMux.HandleFunc("/admin/api/tunnel", p.requireSession(p.handleTunnelConfig))
 	apiMux.HandleFunc("/admin/api/tunnel/start", p.requireSession(p.handleTunnelStart))
 	apiMux.HandleFunc("/admin/api/tunnel/stop", p.requireSession(p.handleTunnelStop))
@@ -81,96 +138,180 @@ func (p *Server) handler() http.Handler {
 	apiMux.HandleFunc("/api/notification/subscriptions/", p.requireSession(p.handleNotificationSubscriptionByID))
 	apiMux.HandleFunc("/api/notification/event-types", p.requireSession(p.listEventTypes))
 	apiMux.HandleFunc("/api/notification/test", p.requireSession(p.testNotification))
+	apiMux.HandleFunc("/api/notification/escalations", p.requireSession(p.handleEscalations))
+	apiMux.HandleFunc(escalationsAPIPrefix, p.requireSession(p.handleEscalationByID))
+	apiMux.HandleFunc("/api/nodes", p.requireSession(p.withIdempotency(p.handleCreateNode)))
+	apiMux.HandleFunc("/api/nodes/import", p.requireSession(p.withIdempotency(p.handleImportNodes)))
+	apiMux.HandleFunc("/api/nodes/template", p.requireSession(p.handleNodeTemplate))
+	apiMux.HandleFunc("/api/nodes/changes", p.requireSession(p.handleNodeChanges))
+	apiMux.HandleFunc("/api/nodes/order", p.requireSession(p.handleNodeOrder))
 	apiMux.HandleFunc("/api/nodes/", p.requireSession(p.handleNodeAPIRoutes))
-	apiMux.HandleFunc("/api/accounts/", p.requireSession(p.handleGetAccountMetrics))
+	apiMux.HandleFunc("/api/accounts/", p.requireSession(p.handleAccountAPIRoutes))
+	apiMux.HandleFunc(invitationsAPIPrefix, p.handleInvitationLink)
+	apiMux.HandleFunc(upstreamWebhookPrefix, p.handleUpstreamWebhook)
+	apiMux.HandleFunc(nodeHooksAPIPrefix, p.handleNodeHook)
+	apiMux.HandleFunc(upstreamStatusAPIPrefix, p.requireSession(p.handleUpstreamStatus))
+	apiMux.HandleFunc(passwordChangePath, p.requireSession(p.handleChangePassword))
 	apiMux.HandleFunc("/api/metrics/aggregate", p.requireSession(p.handleAggregateMetrics))
 	apiMux.HandleFunc("/api/metrics/cleanup", p.requireSession(p.handleCleanupMetrics))
+	apiMux.HandleFunc("/api/replay/corpus", p.requireSession(p.handleReplayCorpus))
+	apiMux.HandleFunc(replayCorpusPrefix, p.requireSession(p.handleReplayCorpus))
+	apiMux.HandleFunc("/api/replay/runs", p.requireSession(p.handleReplayRuns))
+	apiMux.HandleFunc(replayRunsPrefix, p.requireSession(p.handleReplayRuns))
+	apiMux.HandleFunc("/api/ab-comparisons", p.requireSession(p.handleABComparisons))
+	apiMux.HandleFunc(abComparisonsPrefix, p.requireSession(p.handleABComparisons))
 	apiMux.HandleFunc("/api/monitor/dashboard", p.requireSession(p.handleMonitorDashboard))
-	apiMux.HandleFunc("/api/monitor/shares", p.requireSession(p.handleMonitorShares))
+	apiMux.HandleFunc("/api/monitor/schema/node-metrics", p.requireSession(p.handleNodeMetricsSchema))
+	apiMux.HandleFunc("/api/monitor/shares", p.requireSession(p.withIdempotency(p.handleMonitorShares)))
 	apiMux.HandleFunc("/api/monitor/shares/", p.requireSession(p.handleRevokeMonitorShare))
 	apiMux.HandleFunc("/api/monitor/share/", p.handleAccessMonitorShare)
-	settingsHandler := &SettingsHandler{store: p.store, cache: p.settingsCache}
+	apiMux.HandleFunc("/api/shares", p.requireSession(p.withIdempotency(p.handleMonitorShares)))
+	apiMux.HandleFunc(sharesAPIPrefix, p.requireSession(p.handleShareByID))
+	apiMux.HandleFunc("/api/status-page", p.requireSession(p.handleStatusPageConfig))
+	apiMux.HandleFunc("/api/incidents", p.requireSession(p.handleIncidents))
+	apiMux.HandleFunc(incidentsAPIPrefix, p.requireSession(p.handleIncidentByID))
+	apiMux.HandleFunc("/api/alerts", p.requireSession(p.handleAlerts))
+	apiMux.HandleFunc(alertsAPIPrefix, p.requireSession(p.handleAlertByID))
+	settingsHandler := &SettingsHandler{store: p.store, cache: p.settingsCache, scheduler: p.settingsSched}
 	apiMux.HandleFunc("/api/settings/version", p.requireSession(settingsHandler.GetVersion))
+	apiMux.HandleFunc("/api/settings/changes", p.requireSession(settingsHandler.ListChanges))
 	apiMux.HandleFunc("/api/settings", p.requireSession(settingsHandler.ListSettings))
-	apiMux.HandleFunc("/api/settings/batch", p.requireSession(settingsHandler.BatchUpdate))
+	apiMux.HandleFunc("/api/settings/scheduled", p.requireSession(settingsHandler.ScheduledChanges))
+	apiMux.HandleFunc(scheduledSettingsPrefix, p.requireSession(settingsHandler.ScheduledChanges))
+	apiMux.HandleFunc("/api/settings/validate", p.requireSession(settingsHandler.ValidateSettings))
+	apiMux.HandleFunc("/api/settings/diff", p.requireSession(settingsHandler.DiffSettings))
+	apiMux.HandleFunc("/api/settings/batch", p.requireSession(p.withIdempotency(settingsHandler.BatchUpdate)))
 	apiMux.HandleFunc("/api/settings/", p.requireSession(settingsHandler.HandleSetting))
 
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	apiMux.HandleFunc("/api/metrics/compression", p.requireSession(p.handleCompressionStats))
+	apiMux.HandleFunc("/api/metrics/streams", p.requireSession(p.handleStreamStats))
+	apiMux.HandleFunc("/api/audit-logs", p.requireSession(p.handleAuditLogs))
+	apiMux.HandleFunc("/api/request-logs", p.requireSession(p.handleRequestLogs))
+	apiMux.HandleFunc("/api/requests/slowest", p.requireSession(p.handleSlowestRequests))
+	apiMux.HandleFunc("/api/routing/explain", p.requireSession(p.handleRoutingExplain))
+	apiMux.HandleFunc("/api/routing/affinity", p.requireSession(p.handleAffinity))
+	apiMux.HandleFunc("/api/metrics/content-filter", p.requireSession(p.handleContentFilterStats))
+	apiMux.HandleFunc("/api/metrics/errors", p.requireSession(p.handleErrorTaxonomy))
+	apiMux.HandleFunc("/api/metrics/hedging", p.requireSession(p.handleHedgingReport))
+	apiMux.HandleFunc("/api/usage/labels", p.requireSession(p.handleLabelUsage))
+	apiMux.HandleFunc("/api/usage/rollups", p.requireSession(p.handleUsageRollups))
+	apiMux.HandleFunc("/api/admin/storage", p.requireSession(p.handleAdminStorage))
+	apiMux.HandleFunc("/api/admin/retention", p.requireSession(p.handleAdminRetention))
+	apiMux.HandleFunc("/api/admin/scheduler", p.requireSession(p.handleSchedulerStatus))
+	apiMux.HandleFunc("/api/admin/chaos", p.requireSession(p.handleAdminChaos))
+	apiMux.HandleFunc("/api/admin/stats", p.requireSession(p.handleAdminStats))
+	apiMux.HandleFunc("/api/admin/modules", p.requireSession(p.handleAPIModules))
+	apiMux.HandleFunc(jobsAPIPath, p.requireSession(p.handleJobs))
+	apiMux.HandleFunc(jobsAPIPath+"/", p.requireSession(p.handleJob))
+	apiMux.HandleFunc("/api/admin/prometheus", p.requireAuth(p.handleAdminPrometheus))
+	apiMux.HandleFunc("/api/declarative", p.requireSession(p.handleDeclarative))
+	apiMux.HandleFunc("/api/admin/config", p.requireSession(p.handleAdminBootstrapConfig))
+	apiMux.HandleFunc("/api/admin/auth-events", p.requireSession(p.handleAuthEventStats))
+	apiMux.HandleFunc("/api/ui/preferences", p.requireSession(p.handleUIPreferences))
+	apiMux.HandleFunc("/api/version", p.requireSession(p.handleAPIVersion))
+	apiMux.HandleFunc(apiDocsPath, p.requireSession(p.handleAPIDocs))
+	p.setAPIPatterns(apiMux.patterns)
+	// 管理 API 统一按 Accept-Encoding 压缩；代理转发路径不经过该包装，避免二次编码。
+	api := p.withCompression(apiMux)
+
+	// route 返回管理面（管理 API、WebSocket、状态页、SPA）的处理器，不属于管理面的路径返回 nil，交由代理转发。
+	route := func(r *http.Request) http.Handler {
 		path := r.URL.Path
 
 		if path == "/version" {
-			p.handleVersion(w, r)
-			return
+			return http.HandlerFunc(p.handleVersion)
+		}
+
+		if strings.HasPrefix(path, statusPagePrefix) {
+			return http.HandlerFunc(p.handlePublicStatusPage)
+		}
+
+		if strings.HasPrefix(path, badgePrefix) {
+			return http.HandlerFunc(p.handleBadge)
 		}
 
 		if path == "/api/monitor/ws" {
-			p.handleMonitorWebSocket(w, r)
-			return
+			return http.HandlerFunc(p.handleMonitorWebSocket)
 		}
 
 		if path == "/changelog" {
 			accept := r.Header.Get("Accept")
 			if r.Header.Get("Sec-Fetch-Dest") == "document" || strings.Contains(accept, "text/html") {
-				spa(w, r)
-				return
+				return spa
 			}
-			p.handleChangelog(w, r)
-			return
+			return http.HandlerFunc(p.handleChangelog)
 		}
 
 		if strings.HasPrefix(path, "/api/notification/") {
-			apiMux.ServeHTTP(w, r)
-			return
+			return api
 		}
 
 		// Allow shared health history access without session when share_token is present.
 		if strings.HasPrefix(path, "/api/nodes/") && strings.HasSuffix(path, "/health-history") {
 			if r.URL.Query().Get("share_token") != "" {
-				p.handleNodeAPIRoutes(w, r)
-				return
+				return p.withCompression(http.HandlerFunc(p.handleNodeAPIRoutes))
 			}
-			apiMux.ServeHTTP(w, r)
-			return
+			return api
 		}
 
-		if (strings.HasPrefix(path, "/api/nodes/") && strings.HasSuffix(path, "/metrics")) ||
+		if path == "/api/nodes" || path == "/api/nodes/changes" || path == "/api/nodes/import" || path == "/api/nodes/template" || path == "/api/nodes/order" ||
+			(strings.HasPrefix(path, "/api/nodes/") && (strings.HasSuffix(path, "/metrics") || strings.HasSuffix(path, "/status") || strings.HasSuffix(path, "/client-cert") || strings.HasSuffix(path, "/ca-bundle") || strings.HasSuffix(path, "/tls-test") || strings.HasSuffix(path, "/dns"))) ||
+			isNodeBenchmarkPath(path) ||
 			(strings.HasPrefix(path, "/api/accounts/") && strings.HasSuffix(path, "/metrics")) ||
-			path == "/api/metrics/aggregate" || path == "/api/metrics/cleanup" {
-			apiMux.ServeHTTP(w, r)
-			return
+			path == "/api/metrics/aggregate" || path == "/api/metrics/cleanup" || path == "/api/metrics/compression" {
+			return api
 		}
 
 		if strings.HasPrefix(path, "/api/monitor/") {
-			apiMux.ServeHTTP(w, r)
-			return
+			return api
 		}
 
-		if strings.HasPrefix(path, "/api/settings") {
-			apiMux.ServeHTTP(w, r)
-			return
+		if strings.HasPrefix(path, "/api/settings") || hasAnyPrefix(path, adminAPIPrefixes) {
+			return api
 		}
 
 		// API and auth endpoints
 		if strings.HasPrefix(path, "/admin/api/") ||
 			(path == "/login" && r.Method == http.MethodPost) ||
 			path == "/logout" {
-			apiMux.ServeHTTP(w, r)
-			return
+			return api
 		}
 
 		// SPA routes (admin UI and assets)
 		if path == "/" || path == "/login" || path == "/admin" || path == "/index.html" ||
 			strings.HasPrefix(path, "/admin/") || strings.HasPrefix(path, "/assets/") ||
 			strings.HasPrefix(path, "/monitor/") || strings.HasPrefix(path, "/settings") ||
+			strings.HasPrefix(path, "/invite/") ||
 			path == "/vite.svg" || path == "/favicon.ico" ||
 			strings.HasPrefix(path, "/qcc-icon-") {
-			spa(w, r)
-			return
+			return spa
 		}
 
-		// Proxy endpoints (unchanged)
+		return nil
+	}
+
+	// Proxy endpoints (unchanged)
+	forward := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received := time.Now()
+		if p.rejectForMaintenance(w) {
+			return
+		}
 		proxyKey := extractAPIKey(r)
 		account := p.getAccountByProxyKey(proxyKey)
+		if account != nil && p.checkProxyKey(w, r, account) {
+			return
+		}
+		keyed := account != nil
+		var service *ServiceAccount
+		if account == nil {
+			if acc, sa, disabled := p.serviceAccountByKey(proxyKey); acc != nil {
+				if disabled {
+					writeProxyError(w, http.StatusUnauthorized, "key_disabled", "this service account has been disabled", map[string]any{"reason": keyDisabledManual})
+					return
+				}
+				account, service = acc, &sa
+			}
+		}
 		if account == nil {
 			account = p.defaultAccount
 		}
@@ -179,23 +320,129 @@ func (p *Server) handler() http.Handler {
 			return
 		}
 
-		node, err := p.getActiveNodeForAccount(account)
-		if err != nil {
-			http.Error(w, "no active upstream node", http.StatusServiceUnavailable)
+		if p.applyEndpointAllowlist(w, r, account, service) {
+			return
+		}
+		var label string
+		if service != nil {
+			// 服务账号的用量固定归因到其标签，不接受请求头覆盖。
+			label = service.Label
+		} else {
+			l, err := p.resolveLabel(account, r)
+			if err != nil {
+				writeProxyError(w, http.StatusBadRequest, "invalid_label", err.Error(), nil)
+				return
+			}
+			label = l
+		}
+		if p.applyRequestLimits(w, r, account) {
 			return
 		}
+		if p.applyContentFilter(w, r, account) {
+			return
+		}
+		if p.applyOutputCaps(w, r, account) {
+			return
+		}
+		if p.applyTokenQuota(w, account) {
+			return
+		}
+
+		loggedBody := p.captureRequestBody(account, r)
+		recording := p.sampleTraffic(account, r)
+		model := extractModel(r)
+		dims := p.limitDims(account.ID, requestDims{label: label, model: model, keyID: keyFingerprint(proxyKey)})
+
+		var node *Node
+		override := strings.TrimSpace(r.Header.Get(nodeOverrideHeader))
+		convID := conversationID(r)
+		if override != "" {
+			n, status, err := p.resolveNodeOverride(account, p.nodeOverrideAllowed(account, service, keyed), override)
+			if err != nil {
+				http.Error(w, err.Error(), status)
+				return
+			}
+			node = n
+		} else {
+			if n := p.affinityNode(account, convID); n != nil {
+				node = n
+			} else {
+				n, err := p.getActiveNodeForAccount(account)
+				if err != nil {
+					http.Error(w, "no active upstream node", http.StatusServiceUnavailable)
+					return
+				}
+				node = p.applyWarmup(account, n)
+			}
+		}
 
 		usage := &usage{}
+		p.prepareSalvage(r, account, usage)
 		proxy := p.newReverseProxy(node, usage)
+		if override == "" {
+			if hedge := p.newHedgeTransport(account, node, r, usage); hedge != nil {
+				p.hedges.observe(time.Now())
+				proxy.Transport = hedge
+			}
+		}
 		p.logger.Printf("%s %s via %s (account=%s)", r.Method, r.URL.String(), node.Name, account.ID)
 
 		start := time.Now()
-		mw := &metricsWriter{ResponseWriter: w, status: http.StatusOK}
+		out, capped := p.wrapResponseCap(w, account)
+		if recording != nil {
+			out = recording.wrap(out)
+		}
+		mw := &metricsWriter{ResponseWriter: out, status: http.StatusOK}
 		ctx := context.WithValue(r.Context(), accountContextKey{}, account)
 		ctx = context.WithValue(ctx, nodeContextKey{}, node)
+		// ReverseProxy 在客户端断开等情况下以 http.ErrAbortHandler panic，计数必须在 defer 中释放，
+		// 否则节点的在途请求数与账号的活跃请求数永远不归零。
+		endRequest := p.beginNodeRequest(node.ID)
+		defer endRequest()
+		live := p.throughputFor(account.ID)
+		live.active.Add(1)
+		defer live.active.Add(-1)
 		proxy.ServeHTTP(mw, r.WithContext(ctx))
+		live.requests.Add(1)
+		live.tokens.Add(usage.input + usage.output)
 
-		p.recordMetrics(node.ID, start, mw, usage)
+		if usage.hedgeNode != nil {
+			// 对冲胜出时以实际服务的备用节点计量。
+			node = usage.hedgeNode
+		}
+		dims.errorClass = classifyRequest(mw.status, usage)
+		p.recordMetrics(node.ID, start, mw, usage, dims)
+		p.addQuotaUsage(account, usage.input+usage.output)
+		if override == "" {
+			p.rememberAffinity(account, convID, node.ID, mw.status == http.StatusOK)
+		}
+		if capped != nil && capped.exceeded {
+			p.logger.Printf("response truncated at %d bytes (account=%s node=%s)", capped.limit, account.ID, node.Name)
+		}
+		queueMs, ttftMs, streamMs := requestTimings(received, start, mw)
+		logRec := store.RequestLogRecord{
+			AccountID:    account.ID,
+			NodeID:       node.ID,
+			NodeName:     node.Name,
+			Method:       r.Method,
+			Path:         r.URL.Path,
+			Status:       mw.status,
+			DurationMs:   time.Since(start).Milliseconds(),
+			InputTokens:  usage.input,
+			OutputTokens: usage.output,
+			NodeOverride: override,
+			RequestBody:  loggedBody,
+			Label:        label,
+			ErrorClass:   dims.errorClass,
+			Model:        model,
+			QueueMs:      queueMs,
+			TTFTMs:       ttftMs,
+			StreamMs:     streamMs,
+			CreatedAt:    start.UTC(),
+		}
+		p.publishRequestLog(logRec)
+		p.logRequest(logRec)
+		p.recordTraffic(recording, logRec)
 		if mw.status != http.StatusOK {
 			errMsg := mw.Header().Get("X-Retry-Error")
 			if errMsg == "" {
@@ -204,9 +451,38 @@ func (p *Server) handler() http.Handler {
 			p.handleFailure(node.ID, errMsg)
 		}
 	})
+
+	return p.withAccessLog(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if role != listenerProxy {
+			if module := p.disabledModuleFor(r); module != "" {
+				writeModuleDisabled(w, r, module)
+				return
+			}
+		}
+		h := route(r)
+		switch {
+		case h != nil && role != listenerProxy:
+			p.serveAdminRoute(h, w, r)
+		case role == listenerAdmin:
+			http.NotFound(w, r)
+		case h != nil && r.URL.Path != "/version":
+			// 代理端口不暴露管理面，避免管理路径被当作上游请求转发。
+			http.NotFound(w, r)
+		case h != nil:
+			h.ServeHTTP(w, r)
+		default:
+			forward(w, r)
+		}
+	}))
 }
 
 // requireSession 会话中间件，未登录则跳转登录页（页面请求）或返回 401（API 请求）。
+// viewerWritablePaths 只读成员也可以调用的写接口：修改自己的口令（口令过期时这是唯一可用的接口）与退出登录。
+var viewerWritablePaths = map[string]bool{
+	passwordChangePath: true,
+	"/logout":          true,
+}
+
 func (p *Server) requireSession(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if p.sessionMgr == nil {
@@ -216,17 +492,12 @@ func (p *Server) requireSession(next http.HandlerFunc) http.HandlerFunc {
 
 		// 判断是否为 API 请求
 		isAPIRequest := strings.HasPrefix(r.URL.Path, "/admin/api/") ||
-			strings.HasPrefix(r.URL.Path, "/api/notification/") ||
-			strings.HasPrefix(r.URL.Path, "/api/nodes/") ||
-			strings.HasPrefix(r.URL.Path, "/api/accounts/") ||
-			strings.HasPrefix(r.URL.Path, "/api/metrics/") ||
-			strings.HasPrefix(r.URL.Path, "/api/monitor/") ||
-			strings.HasPrefix(r.URL.Path, "/api/settings")
+			strings.HasPrefix(r.URL.Path, "/api/")
 
 		cookie, err := r.Cookie("session_token")
 		if err != nil || cookie.Value == "" {
 			if isAPIRequest {
-				writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+				writeLocalizedError(w, r, http.StatusUnauthorized, "unauthorized", "error.unauthorized")
 			} else {
 				http.Redirect(w, r, "/login", http.StatusFound)
 			}
@@ -235,7 +506,7 @@ func (p *Server) requireSession(next http.HandlerFunc) http.HandlerFunc {
 		sess := p.sessionMgr.Get(cookie.Value)
 		if sess == nil {
 			if isAPIRequest {
-				writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "session invalid"})
+				writeLocalizedError(w, r, http.StatusUnauthorized, "session invalid", "error.session_invalid")
 			} else {
 				http.Redirect(w, r, "/login", http.StatusFound)
 			}
@@ -250,7 +521,7 @@ func (p *Server) requireSession(next http.HandlerFunc) http.HandlerFunc {
 		if acc == nil {
 			p.sessionMgr.Delete(cookie.Value)
 			if isAPIRequest {
-				writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "account not found"})
+				writeLocalizedError(w, r, http.StatusUnauthorized, "account not found", "error.account_not_found")
 			} else {
 				http.Redirect(w, r, "/login", http.StatusFound)
 			}
@@ -260,7 +531,23 @@ func (p *Server) requireSession(next http.HandlerFunc) http.HandlerFunc {
 		if sess.IsAdmin {
 			ctx = context.WithValue(ctx, isAdminContextKey{}, true)
 		}
-		next(w, r.WithContext(ctx))
+		if sess.mustChangePassword.Load() && isAPIRequest && r.URL.Path != passwordChangePath {
+			w.Header().Set(passwordExpiredHeader, "true")
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": "password_expired"})
+			return
+		}
+		if sess.UserID != "" {
+			if sess.Role == roleViewer && isAPIRequest && r.Method != http.MethodGet && r.Method != http.MethodHead && !viewerWritablePaths[r.URL.Path] {
+				writeJSON(w, http.StatusForbidden, map[string]string{"error": "read-only role"})
+				return
+			}
+			ctx = context.WithValue(ctx, sessionUserContextKey{}, &sessionUser{ID: sess.UserID, Name: sess.UserName, Role: sess.Role})
+		}
+		r, ok := p.applyImpersonation(w, r.WithContext(ctx), sess)
+		if !ok {
+			return
+		}
+		next(w, r)
 	}
 }
 
@@ -297,6 +584,9 @@ func (p *Server) requireAuth(next http.HandlerFunc) http.HandlerFunc {
 
 		proxyKey := extractAPIKey(r)
 		account := p.getAccountByProxyKey(proxyKey)
+		if account != nil && p.checkProxyKey(w, r, account) {
+			return
+		}
 		if account == nil {
 			account = p.defaultAccount
 		}
@@ -318,7 +608,9 @@ func (p *Server) handleVersion(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
-	writeJSON(w, http.StatusOK, version.GetVersionInfo())
+	locale := i18n.Negotiate(r.Header.Get("Accept-Language"))
+	w.Header().Set("Content-Language", locale)
+	writeJSON(w, http.StatusOK, version.GetLocalizedVersionInfo(locale, timeutil.BeijingLocation))
 }
 
 func (p *Server) handleChangelog(w http.ResponseWriter, r *http.Request) {
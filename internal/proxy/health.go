@@ -46,6 +46,10 @@ func (p *Server) handleFailure(nodeID string, errMsg string) {
 	failed := node.Metrics.FailStreak >= int64(failLimit)
 	failStreak := node.Metrics.FailStreak
 	nodeName := node.Name
+	nodeURL := node.URL
+	fromState, stateChanged := setFaultState(node, stateForFailStreak(failStreak, failLimit), time.Now())
+	toState := nodeState(node)
+	wasActive := acc != nil && acc.ActiveID == nodeID
 	if failed {
 		node.Failed = true
 		if acc != nil {
@@ -54,17 +58,27 @@ func (p *Server) handleFailure(nodeID string, errMsg string) {
 	}
 	p.mu.Unlock()
 
+	if stateChanged {
+		p.onNodeStateChange(nodeID, fromState, toState)
+		// 活跃节点降级后按降权后的权重重新选择。
+		if !failed && wasActive {
+			p.selectBestAndActivate(acc, "节点降级")
+		}
+	}
+
 	if failed {
+		p.markNodeChanged(nodeID)
 		p.logger.Printf("node %s marked failed: %s", nodeName, errMsg)
 		if p.notifyMgr != nil && acc != nil {
-			p.notifyMgr.Publish(notify.Event{
+			p.notifyMgr.Publish(p.withUpstreamIncident(notify.Event{
 				AccountID:  acc.ID,
 				EventType:  notify.EventNodeFailed,
 				Title:      "节点故障告警",
 				Content:    fmt.Sprintf("**节点名称**: %s\n**错误信息**: %s\n**失败次数**: %d\n**时间**: %s", nodeName, errMsg, failStreak, timeutil.FormatBeijingTime(time.Now())),
 				DedupKey:   node.ID,
+				Node:       nodeName,
 				OccurredAt: time.Now(),
-			})
+			}, nodeURL))
 		}
 		// 向该账号所有 WebSocket 连接推送离线事件。
 		if p.wsHub != nil && acc != nil {
@@ -80,15 +94,24 @@ func (p *Server) handleFailure(nodeID string, errMsg string) {
 	}
 }
 
-// 定时探活失败节点。
+// 定时探活失败节点；按轮次起点计时，错峰窗口占用的时间计入间隔内。
 func (p *Server) healthLoop() {
+	var elapsed time.Duration
 	for {
 		interval := p.healthInterval()
 		if interval <= 0 {
 			return
 		}
-		time.Sleep(interval)
-		p.checkFailedNodes()
+		if elapsed < interval {
+			time.Sleep(interval - elapsed)
+		}
+		start := time.Now()
+		if p.maintenanceActive() {
+			elapsed = 0
+			continue
+		}
+		p.checkFailedNodes(interval)
+		elapsed = time.Since(start)
 	}
 }
 
@@ -106,27 +129,64 @@ func (p *Server) healthInterval() time.Duration {
 		if min == 0 || acc.Config.HealthEvery < min {
 			min = acc.Config.HealthEvery
 		}
+		// 节点级间隔更短时按节点间隔调度
+		for id := range acc.FailedSet {
+			if n := acc.Nodes[id]; n != nil && n.HealthInterval > 0 && n.HealthInterval < min {
+				min = n.HealthInterval
+			}
+		}
 	}
 	return min
 }
 
-func (p *Server) checkFailedNodes() {
+// checkFailedNodes 探活失败节点；tick 为本轮调度间隔，用于容忍节点级间隔与调度周期的对齐误差。
+func (p *Server) checkFailedNodes(tick time.Duration) {
+	now := time.Now()
+	var targets []healthTarget
 	p.mu.RLock()
-	accs := make([]*Account, 0, len(p.accountByID))
 	for _, acc := range p.accountByID {
-		accs = append(accs, acc)
-	}
-	p.mu.RUnlock()
-	for _, acc := range accs {
 		for id := range acc.FailedSet {
-			p.checkNodeHealth(acc, id)
+			// 未到节点生效间隔（节点级间隔或失败退避）时跳过本轮
+			if n := acc.Nodes[id]; n != nil && !p.healthDue(acc, n, now, tick/2) {
+				continue
+			}
+			targets = append(targets, healthTarget{acc, id})
 		}
 	}
+	p.mu.RUnlock()
+	p.runHealthRound("failed", targets, tick, nil)
 }
 
 func (p *Server) checkNodeHealth(acc *Account, id string) {
+	p.runHealthCheck(acc, id, false)
+}
+
+// healthCheckResult 单次健康检查结果。
+type healthCheckResult struct {
+	OK        bool
+	Method    string
+	Latency   time.Duration
+	DNS       time.Duration // 包含在 Latency 内的域名解析耗时
+	Err       string
+	CheckedAt time.Time
+}
+
+func (r *healthCheckResult) view() map[string]interface{} {
+	return map[string]interface{}{
+		"success":          r.OK,
+		"check_method":     r.Method,
+		"response_time_ms": r.Latency.Milliseconds(),
+		"dns_ms":           r.DNS.Milliseconds(),
+		"error_message":    r.Err,
+		"check_time":       timeutil.FormatBeijingTime(r.CheckedAt),
+	}
+}
+
+// runHealthCheck 执行一次健康检查并更新节点状态；syncHistory 为 true 时同步写入健康历史，
+// 返回写入错误，节点不存在时返回 nil 结果。
+func (p *Server) runHealthCheck(acc *Account, id string, syncHistory bool) (*healthCheckResult, error) {
 	if acc == nil {
-		return
+		return nil, nil
 	}
 
 	now := time.Now()
@@ -136,9 +196,10 @@ func (p *Server) checkNodeHealth(acc *Account, id string) {
 	node := acc.Nodes[id]
 	if node == nil {
 		p.mu.RUnlock()
-		return
+		return nil, nil
 	}
 	nodeCopy := *node
+	baseInterval := p.nodeHealthBase(acc, node)
 	p.mu.RUnlock()
 	if nodeCopy.AccountID == "" && acc != nil {
 		nodeCopy.AccountID = acc.ID
@@ -160,6 +221,9 @@ func (p *Server) checkNodeHealth(acc *Account, id string) {
 
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
+	// 单独统计解析耗时，区分 DNS 抖动与上游延迟。
+	var timer dnsTimer
+	ctx = timer.trace(ctx)
 
 	var (
 		ok      bool
@@ -178,8 +242,19 @@ func (p *Server) checkNodeHealth(acc *Account, id string) {
 	default:
 		ok, pingErr, latency = p.healthCheckViaAPI(ctx, nodeCopy)
 	}
+	if ok {
+		if fail, reason := p.chaos.healthFailure(nodeCopy.ID); fail {
+			ok, pingErr = false, reason
+		}
+	}
+	dnsTook := timer.elapsed()
 	checkedAt := time.Now().UTC()
-	p.recordHealthEvent(nodeCopy.AccountID, nodeCopy.ID, method, ok, latency, pingErr, checkedAt)
+	failStreak := 0
+	if !ok {
+		failStreak = nodeCopy.HealthFailStreak + 1
+	}
+	interval := healthBackoff(baseInterval, failStreak, p.healthBackoffMax())
+	historyErr := p.recordHealthEvent(nodeCopy.AccountID, nodeCopy.ID, method, ok, latency, dnsTook, pingErr, interval, checkedAt, syncHistory)
 
 	var (
 		rec           store.NodeRecord
@@ -192,6 +267,10 @@ func (p *Server) checkNodeHealth(acc *Account, id string) {
 		nodeDisabled    bool
 		hasNode         bool
 		wasFailed       bool
+		wasActive       bool
+		stateChanged    bool
+		fromState       string
+		toState         string
 	)
 
 	p.mu.Lock()
@@ -199,10 +278,26 @@ func (p *Server) checkNodeHealth(acc *Account, id string) {
 	if n != nil {
 		acc := p.nodeAccount[id]
 		wasFailed = n.Failed
+		if ok {
+			fromState, stateChanged = setFaultState(n, NodeStateHealthy, now)
+		} else if nodeState(n) == NodeStateHealthy {
+			// 健康检查失败但尚未产生请求失败时先标记为降级。
+			fromState, stateChanged = setFaultState(n, NodeStateDegraded, now)
+		}
+		toState = nodeState(n)
+		wasActive = acc != nil && acc.ActiveID == id
+		if ok {
+			n.HealthFailStreak = 0
+		} else {
+			n.HealthFailStreak++
+		}
 		n.Metrics.LastHealthCheckAt = now
 		if latency > 0 {
 			n.Metrics.LastPingMS = latency.Milliseconds()
 		}
+		if dnsTook > 0 {
+			n.Metrics.LastDNSMS = dnsTook.Milliseconds()
+		}
 		if ok {
 			n.Failed = false
 			n.LastError = ""
@@ -234,7 +329,18 @@ func (p *Server) checkNodeHealth(acc *Account, id string) {
 	if shouldPersist {
 		_ = p.store.UpsertNode(context.Background(), rec)
 	}
+	if stateChanged {
+		p.onNodeStateChange(id, fromState, toState)
+		switch {
+		case ok && !wasFailed:
+			// 降级节点恢复健康后可能重新获得优先级。
+			p.maybePromoteRecovered(n)
+		case !ok && wasActive:
+			p.selectBestAndActivate(acc, "节点降级")
+		}
+	}
 	if ok && wasFailed {
+		p.markNodeChanged(id)
 		// 恢复后重新在健康节点中选择最优的一个。
 		if p.notifyMgr != nil && acc != nil && n != nil {
 			p.notifyMgr.Publish(notify.Event{
@@ -243,6 +349,7 @@ func (p *Server) checkNodeHealth(acc *Account, id string) {
 				Title:      "节点已恢复",
 				Content:    fmt.Sprintf("**节点名称**: %s\n**恢复时间**: %s", n.Name, timeutil.FormatBeijingTime(time.Now())),
 				DedupKey:   n.ID,
+				Node:       n.Name,
 				OccurredAt: time.Now(),
 			})
 		}
@@ -262,34 +369,17 @@ func (p *Server) checkNodeHealth(acc *Account, id string) {
 		if healthInterval <= 0 {
 			healthInterval = p.healthEvery
 		}
-		health := summarizeHealth(metricsSnapshot, method, healthInterval, time.Now())
-		traffic := summarizeTraffic(metricsSnapshot)
-
-		status := "unknown"
-		if nodeDisabled {
-			status = "disabled"
-		} else if nodeFailed || health.Status == "down" {
-			status = "offline"
-		} else if health.Status == "stale" {
-			status = "degraded"
-		} else {
-			status = "online"
-		}
-
-		timestamp := timeutil.FormatBeijingTime(time.Now())
-		if health.LastCheckAt != nil {
-			timestamp = *health.LastCheckAt
-		}
-
-		p.wsHub.Broadcast(acc.ID, "node_metrics", map[string]interface{}{
-			"node_id":   nodeID,
-			"node_name": nodeName,
-			"status":    status,
-			"traffic":   traffic,
-			"health":    health,
-			"timestamp": timestamp,
-		})
-	}
+		p.wsHub.Broadcast(acc.ID, "node_metrics", buildNodeMetrics(nodeMetricsInput{
+			ID:       nodeID,
+			Name:     nodeName,
+			State:    toState,
+			Failed:   nodeFailed,
+			Disabled: nodeDisabled,
+			Method:   method,
+			Metrics:  metricsSnapshot,
+		}, healthInterval, time.Now()))
+	}
+	return &healthCheckResult{OK: ok, Method: method, Latency: latency, DNS: dnsTook, Err: pingErr, CheckedAt: checkedAt}, historyErr
 }
 
 func (p *Server) maybePromoteRecovered(n *Node) {
@@ -351,6 +441,7 @@ func (p *Server) healthCheckViaAPI(ctx context.Context, node Node) (bool, string
 	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, apiURL, bytes.NewReader(bodyBytes))
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("anthropic-version", "2023-06-01")
+	applyNodeHeaders(req.Header, node.Headers)
 	req.Header.Set("x-api-key", node.APIKey)
 	req.Header.Set("Authorization", "Bearer "+node.APIKey)
 
@@ -373,6 +464,7 @@ func (p *Server) healthCheckViaAPI(ctx context.Context, node Node) (bool, string
 func (p *Server) healthCheckViaHEAD(ctx context.Context, node Node) (bool, string, time.Duration) {
 	client := &http.Client{Transport: p.healthRT, Timeout: 5 * time.Second}
 	req, _ := http.NewRequestWithContext(ctx, http.MethodHead, node.URL.String(), nil)
+	applyNodeHeaders(req.Header, node.Headers)
 	start := time.Now()
 	resp, err := client.Do(req)
 	latency := time.Since(start)
@@ -417,9 +509,10 @@ func (p *Server) healthCheckViaCLI(ctx context.Context, node Node) (bool, string
 	return true, "", latency
 }
 
-func (p *Server) recordHealthEvent(accountID, nodeID, method string, success bool, latency time.Duration, errMsg string, checkTime time.Time) {
+// recordHealthEvent 写入健康历史并推送 WebSocket；sync 为 false 时异步写入且不返回错误。
+func (p *Server) recordHealthEvent(accountID, nodeID, method string, success bool, latency, dns time.Duration, errMsg string, interval time.Duration, checkTime time.Time, sync bool) error {
 	if p == nil {
-		return
+		return nil
 	}
 	if checkTime.IsZero() {
 		checkTime = time.Now().UTC()
@@ -441,12 +534,21 @@ func (p *Server) recordHealthEvent(accountID, nodeID, method string, success boo
 			ResponseTimeMs: respMs,
 			ErrorMessage:   errMsg,
 			CheckMethod:    method,
+			IntervalMs:     interval.Milliseconds(),
+			DNSMs:          dns.Milliseconds(),
 		}
-		go func() {
+		insert := func() error {
 			ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 			defer cancel()
-			_ = p.store.InsertHealthCheck(ctx, &rec)
-		}()
+			return p.store.InsertHealthCheck(ctx, &rec)
+		}
+		if sync {
+			if err := insert(); err != nil {
+				return err
+			}
+		} else {
+			go func() { _ = insert() }()
+		}
 	}
 
 	if p.wsHub != nil {
@@ -457,9 +559,12 @@ func (p *Server) recordHealthEvent(accountID, nodeID, method string, success boo
 			"response_time_ms": respMs,
 			"error_message":    errMsg,
 			"check_method":     method,
+			"interval_ms":      interval.Milliseconds(),
+			"dns_ms":           dns.Milliseconds(),
 		}
 		p.wsHub.Broadcast(accountID, "health_check", payload)
 	}
+	return nil
 }
 
 type CliRunner func(ctx context.Context, image string, env map[string]string, prompt string) (string, error)
@@ -489,3 +594,54 @@ func defaultCLIRunner(ctx context.Context, image string, env map[string]string,
 
 	return stdout.String(), nil
 }
+
+const defaultHealthBackoffMaxSec = 600
+
+// healthBackoffMax 返回失败退避的间隔上限，0 表示不退避。
+func (p *Server) healthBackoffMax() time.Duration {
+	sec := defaultHealthBackoffMaxSec
+	if p.settingsCache != nil {
+		sec = p.settingsCache.GetInt("health.backoff_max_sec", defaultHealthBackoffMaxSec)
+	}
+	if sec < 0 {
+		sec = 0
+	}
+	return time.Duration(sec) * time.Second
+}
+
+// healthBackoff 返回连续失败 streak 次后的检查间隔：base*2^(streak-1)，不超过 max；
+// max 不大于 base 时不退避。
+func healthBackoff(base time.Duration, streak int, max time.Duration) time.Duration {
+	if base <= 0 || streak <= 1 || max <= base {
+		return base
+	}
+	d := base
+	for i := 1; i < streak; i++ {
+		d *= 2
+		if d >= max {
+			return max
+		}
+	}
+	return d
+}
+
+// nodeHealthBase 返回节点的基础检查间隔：节点级间隔优先，其次账号配置。调用方需持有 p.mu。
+func (p *Server) nodeHealthBase(acc *Account, n *Node) time.Duration {
+	if n.HealthInterval > 0 {
+		return n.HealthInterval
+	}
+	if acc != nil && acc.Config.HealthEvery > 0 {
+		return acc.Config.HealthEvery
+	}
+	return p.healthEvery
+}
+
+// nodeHealthInterval 返回节点当前生效的检查间隔（含失败退避）。调用方需持有 p.mu。
+func (p *Server) nodeHealthInterval(acc *Account, n *Node) time.Duration {
+	return healthBackoff(p.nodeHealthBase(acc, n), n.HealthFailStreak, p.healthBackoffMax())
+}
+
+// healthDue 判断节点距上次检查是否已达到生效间隔，slack 用于容忍调度周期的对齐误差。调用方需持有 p.mu。
+func (p *Server) healthDue(acc *Account, n *Node, now time.Time, slack time.Duration) bool {
+	return now.Sub(n.Metrics.LastHealthCheckAt)+slack >= p.nodeHealthInterval(acc, n)
+}
@@ -0,0 +1,218 @@
+package proxy
+
+import (
+	"hash/fnv"
+	"math/rand"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"qcc_plus/internal/timeutil"
+)
+
+const (
+	defaultHealthConcurrency = 16
+	defaultHealthSpreadPct   = 50
+	defaultHealthJitterMs    = 1000
+)
+
+// healthTarget 待探活的节点。
+type healthTarget struct {
+	acc *Account
+	id  string
+}
+
+// healthPoolConfig 健康检查调度参数：并发上限、错峰窗口占间隔的百分比与单节点随机抖动上限。
+type healthPoolConfig struct {
+	Concurrency int
+	SpreadPct   int
+	Jitter      time.Duration
+}
+
+// healthRound 最近一轮健康检查的调度情况。
+type healthRound struct {
+	Source      string
+	StartedAt   time.Time
+	Duration    time.Duration
+	Nodes       int
+	Concurrency int
+	Window      time.Duration
+}
+
+// healthPoolStats 健康检查调度统计，供管理接口展示。
+type healthPoolStats struct {
+	rounds       atomic.Int64
+	scheduled    atomic.Int64
+	completed    atomic.Int64
+	inflight     atomic.Int64
+	peakInflight atomic.Int64
+	waitTotal    atomic.Int64 // 等待空闲 worker 的累计时长（纳秒）
+	waitMax      atomic.Int64
+
+	mu        sync.Mutex
+	lastRound map[string]healthRound // 按来源（failed/full）记录
+}
+
+func (s *healthPoolStats) observeWait(d time.Duration) {
+	s.waitTotal.Add(int64(d))
+	for {
+		cur := s.waitMax.Load()
+		if int64(d) <= cur || s.waitMax.CompareAndSwap(cur, int64(d)) {
+			return
+		}
+	}
+}
+
+func (s *healthPoolStats) begin() {
+	n := s.inflight.Add(1)
+	for {
+		cur := s.peakInflight.Load()
+		if n <= cur || s.peakInflight.CompareAndSwap(cur, n) {
+			return
+		}
+	}
+}
+
+func (s *healthPoolStats) finishRound(r healthRound) {
+	s.rounds.Add(1)
+	s.mu.Lock()
+	if s.lastRound == nil {
+		s.lastRound = make(map[string]healthRound)
+	}
+	s.lastRound[r.Source] = r
+	s.mu.Unlock()
+}
+
+func (s *healthPoolStats) view(cfg healthPoolConfig) map[string]interface{} {
+	rounds := map[string]interface{}{}
+	s.mu.Lock()
+	for src, r := range s.lastRound {
+		rounds[src] = map[string]interface{}{
+			"started_at":  timeutil.FormatBeijingTime(r.StartedAt),
+			"duration_ms": r.Duration.Milliseconds(),
+			"nodes":       r.Nodes,
+			"concurrency": r.Concurrency,
+			"window_ms":   r.Window.Milliseconds(),
+		}
+	}
+	s.mu.Unlock()
+	return map[string]interface{}{
+		"max_concurrency": cfg.Concurrency,
+		"spread_pct":      cfg.SpreadPct,
+		"jitter_ms":       cfg.Jitter.Milliseconds(),
+		"rounds":          s.rounds.Load(),
+		"scheduled":       s.scheduled.Load(),
+		"completed":       s.completed.Load(),
+		"inflight":        s.inflight.Load(),
+		"peak_inflight":   s.peakInflight.Load(),
+		"wait_total_ms":   time.Duration(s.waitTotal.Load()).Milliseconds(),
+		"wait_max_ms":     time.Duration(s.waitMax.Load()).Milliseconds(),
+		"last_rounds":     rounds,
+	}
+}
+
+// healthPoolConfig 从 SettingsCache 读取调度参数，缺失或越界时使用默认值。
+func (p *Server) healthPoolConfig() healthPoolConfig {
+	cfg := healthPoolConfig{
+		Concurrency: defaultHealthConcurrency,
+		SpreadPct:   defaultHealthSpreadPct,
+		Jitter:      defaultHealthJitterMs * time.Millisecond,
+	}
+	if p.settingsCache == nil {
+		return cfg
+	}
+	if n := p.settingsCache.GetInt("health.max_concurrency", cfg.Concurrency); n > 0 {
+		cfg.Concurrency = n
+	}
+	if n := p.settingsCache.GetInt("health.spread_pct", cfg.SpreadPct); n >= 0 && n <= 100 {
+		cfg.SpreadPct = n
+	}
+	if n := p.settingsCache.GetInt("health.jitter_ms", defaultHealthJitterMs); n >= 0 {
+		cfg.Jitter = time.Duration(n) * time.Millisecond
+	}
+	return cfg
+}
+
+// healthOffset 返回节点在本轮中的启动偏移：按节点 ID 哈希均匀分布在窗口内，
+// 再叠加随机抖动，避免同一时刻集中发起探活；抖动不超过窗口。
+func healthOffset(id string, window, jitter time.Duration) time.Duration {
+	if window <= 0 {
+		return 0
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(id))
+	offset := time.Duration(float64(window) * float64(h.Sum32()) / float64(1<<32))
+	if jitter > window {
+		jitter = window
+	}
+	if jitter > 0 {
+		offset += time.Duration(rand.Int63n(int64(jitter)))
+	}
+	return offset % window
+}
+
+// runHealthRound 在 interval 的错峰窗口内执行一轮健康检查，并发数受 health.max_concurrency 限制；
+// 返回前等待本轮已发起的检查全部完成，stop 关闭时不再发起新的检查。
+func (p *Server) runHealthRound(source string, targets []healthTarget, interval time.Duration, stop <-chan struct{}) {
+	cfg := p.healthPoolConfig()
+	window := interval * time.Duration(cfg.SpreadPct) / 100
+	start := time.Now()
+
+	type slot struct {
+		target healthTarget
+		offset time.Duration
+	}
+	slots := make([]slot, len(targets))
+	for i, t := range targets {
+		slots[i] = slot{t, healthOffset(t.id, window, cfg.Jitter)}
+	}
+	sort.Slice(slots, func(i, j int) bool { return slots[i].offset < slots[j].offset })
+
+	sem := make(chan struct{}, cfg.Concurrency)
+	var wg sync.WaitGroup
+	stats := &p.healthStats
+dispatch:
+	for _, s := range slots {
+		if d := time.Until(start.Add(s.offset)); d > 0 {
+			timer := time.NewTimer(d)
+			select {
+			case <-stop:
+				timer.Stop()
+				break dispatch
+			case <-timer.C:
+			}
+		}
+		waitStart := time.Now()
+		select {
+		case <-stop:
+			break dispatch
+		case sem <- struct{}{}:
+		}
+		stats.observeWait(time.Since(waitStart))
+		stats.scheduled.Add(1)
+		stats.begin()
+		wg.Add(1)
+		go func(t healthTarget) {
+			defer func() {
+				if r := recover(); r != nil {
+					p.logger.Printf("health check panic recovered for node %s: %v", t.id, r)
+				}
+				<-sem
+				stats.inflight.Add(-1)
+				stats.completed.Add(1)
+				wg.Done()
+			}()
+			p.checkNodeHealth(t.acc, t.id)
+		}(s.target)
+	}
+	wg.Wait()
+	stats.finishRound(healthRound{
+		Source:      source,
+		StartedAt:   start,
+		Duration:    time.Since(start),
+		Nodes:       len(targets),
+		Concurrency: cfg.Concurrency,
+		Window:      window,
+	})
+}
@@ -0,0 +1,152 @@
+package proxy
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const defaultHealthCacheTTLMs = 5000
+
+// 按需健康检查结果来源。
+const (
+	probeSourceProbe  = "probe"  // 本请求发起的探活
+	probeSourceShared = "shared" // 等待其他请求进行中的探活
+	probeSourceCache  = "cache"  // 复用 TTL 内的最近结果
+)
+
+// healthProbeGroup 按需健康检查的合并与短时缓存：同一节点的并发请求共享一次探活，结果在 TTL 内复用。
+type healthProbeGroup struct {
+	mu    sync.Mutex
+	calls map[string]*healthProbeCall
+	cache map[string]*healthCheckResult
+
+	probes    atomic.Int64
+	shared    atomic.Int64
+	cacheHits atomic.Int64
+}
+
+type healthProbeCall struct {
+	done   chan struct{}
+	result *healthCheckResult
+	err    error
+}
+
+// do 返回节点的检查结果：refresh 为 false 且缓存未过期时直接返回缓存；
+// 已有进行中的探活时等待其结果，否则执行 fn 并缓存成功结果。
+func (g *healthProbeGroup) do(id string, ttl time.Duration, refresh bool, fn func() (*healthCheckResult, error)) (*healthCheckResult, string, error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*healthProbeCall)
+		g.cache = make(map[string]*healthCheckResult)
+	}
+	if res := g.cache[id]; !refresh && res != nil && ttl > 0 && time.Since(res.CheckedAt) < ttl {
+		g.mu.Unlock()
+		g.cacheHits.Add(1)
+		return res, probeSourceCache, nil
+	}
+	if call := g.calls[id]; call != nil {
+		g.mu.Unlock()
+		g.shared.Add(1)
+		<-call.done
+		return call.result, probeSourceShared, call.err
+	}
+	call := &healthProbeCall{done: make(chan struct{})}
+	g.calls[id] = call
+	g.mu.Unlock()
+	g.probes.Add(1)
+
+	defer func() {
+		g.mu.Lock()
+		delete(g.calls, id)
+		if call.err == nil && call.result != nil {
+			g.cache[id] = call.result
+		}
+		g.mu.Unlock()
+		close(call.done)
+	}()
+	call.result, call.err = fn()
+	return call.result, probeSourceProbe, call.err
+}
+
+// forget 丢弃节点的缓存结果，节点变更或删除后调用。
+func (g *healthProbeGroup) forget(id string) {
+	g.mu.Lock()
+	delete(g.cache, id)
+	g.mu.Unlock()
+}
+
+func (g *healthProbeGroup) view(ttl time.Duration) map[string]interface{} {
+	g.mu.Lock()
+	inflight, cached := len(g.calls), len(g.cache)
+	g.mu.Unlock()
+	return map[string]interface{}{
+		"cache_ttl_ms": ttl.Milliseconds(),
+		"probes":       g.probes.Load(),
+		"shared":       g.shared.Load(),
+		"cache_hits":   g.cacheHits.Load(),
+		"inflight":     inflight,
+		"cached":       cached,
+	}
+}
+
+// healthCacheTTL 返回按需检查结果的缓存时长，0 表示只合并并发请求、不缓存。
+func (p *Server) healthCacheTTL() time.Duration {
+	ms := defaultHealthCacheTTLMs
+	if p.settingsCache != nil {
+		ms = p.settingsCache.GetInt("health.cache_ttl_ms", defaultHealthCacheTTLMs)
+	}
+	if ms < 0 {
+		ms = 0
+	}
+	return time.Duration(ms) * time.Millisecond
+}
+
+// probeNodeHealth 按需检查节点健康，同一节点的并发请求共享一次探活。
+func (p *Server) probeNodeHealth(acc *Account, id string, refresh bool) (*healthCheckResult, string, error) {
+	return p.healthProbes.do(id, p.healthCacheTTL(), refresh, func() (*healthCheckResult, error) {
+		return p.runHealthCheck(acc, id, false)
+	})
+}
+
+// GET /api/nodes/:node_id/status?refresh=1
+// 返回节点状态与按需健康检查结果；refresh=1 跳过缓存，但仍与进行中的探活合并。
+func (p *Server) handleNodeStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	acc, ok := p.nodesAccount(w, r)
+	if !ok {
+		return
+	}
+	id := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/nodes/"), "/status")
+	if id == "" || strings.Contains(id, "/") {
+		http.NotFound(w, r)
+		return
+	}
+	p.mu.RLock()
+	owner := p.nodeAccount[id]
+	p.mu.RUnlock()
+	if owner == nil || (owner.ID != acc.ID && !isAdmin(r.Context())) {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "node not found"})
+		return
+	}
+	refresh := r.URL.Query().Get("refresh")
+	result, source, err := p.probeNodeHealth(owner, id, refresh == "1" || refresh == "true")
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	if result == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "node not found"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"node":         p.nodeView(owner, id),
+		"health_check": result.view(),
+		"source":       source,
+	})
+}
@@ -87,7 +87,9 @@ func (h *HealthScheduler) checkLoop() {
 		case <-h.stopCh:
 			return
 		case <-ticker.C:
-			h.checkAllNodes()
+			if !h.server.maintenanceActive() {
+				h.checkAllNodes()
+			}
 		}
 	}
 }
@@ -110,22 +112,25 @@ func (h *HealthScheduler) checkAllNodes() {
 	}
 	p.mu.RUnlock()
 
-	total := 0
+	now := time.Now()
+	var targets []healthTarget
+	skipped := 0
 	for _, acc := range accs {
 		p.mu.RLock()
-		ids := make([]string, 0, len(acc.Nodes))
-		for id := range acc.Nodes {
-			ids = append(ids, id)
+		for id, n := range acc.Nodes {
+			// 处于失败退避中的节点不随全量检查提前探活
+			if n.HealthFailStreak > 0 && !p.healthDue(acc, n, now, 0) {
+				skipped++
+				continue
+			}
+			targets = append(targets, healthTarget{acc, id})
 		}
 		p.mu.RUnlock()
-
-		for _, id := range ids {
-			total++
-			p.checkNodeHealth(acc, id)
-		}
 	}
+	// 按间隔错峰并限制并发，避免大量节点同一时刻探活触发上游限流。
+	p.runHealthRound("full", targets, h.interval, h.stopCh)
 
-	h.logger.Printf("[HealthScheduler] full health check finished in %v (nodes=%d)", time.Since(start), total)
+	h.logger.Printf("[HealthScheduler] full health check finished in %v (nodes=%d, backoff_skipped=%d)", time.Since(start), len(targets), skipped)
 }
 
 // recoverPanic 防止调度器因 panic 退出。
@@ -0,0 +1,279 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultHedgeThreshold = 2 * time.Second
+	defaultHedgeBudgetPct = 10
+	hedgeBudgetWindow     = time.Minute
+	// hedgeNodeHeader 由对冲传输层标记胜出节点，ModifyResponse 读取后删除。
+	hedgeNodeHeader = "X-QCC-Hedge-Node"
+)
+
+// hedgeBudget 限制对冲请求占总请求的比例，避免上游整体变慢时流量翻倍。
+type hedgeBudget struct {
+	mu          sync.Mutex
+	windowStart time.Time
+	requests    int64
+	hedges      int64
+}
+
+// observe 记录一次请求。
+func (b *hedgeBudget) observe(now time.Time) {
+	b.mu.Lock()
+	b.rollLocked(now)
+	b.requests++
+	b.mu.Unlock()
+}
+
+// take 在预算内占用一次对冲名额。
+func (b *hedgeBudget) take(now time.Time, pct int) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.rollLocked(now)
+	allowed := b.requests * int64(pct) / 100
+	if allowed < 1 {
+		allowed = 1
+	}
+	if b.hedges >= allowed {
+		return false
+	}
+	b.hedges++
+	return true
+}
+
+func (b *hedgeBudget) rollLocked(now time.Time) {
+	if now.Sub(b.windowStart) >= hedgeBudgetWindow {
+		b.windowStart = now
+		b.requests = 0
+		b.hedges = 0
+	}
+}
+
+// hedgeSettings 返回对冲是否开启、首字节阈值与预算比例。
+func (p *Server) hedgeSettings() (bool, time.Duration, int) {
+	if p.settingsCache == nil {
+		return false, defaultHedgeThreshold, defaultHedgeBudgetPct
+	}
+	enabled := p.settingsCache.GetBool("routing.hedge.enabled", false)
+	threshold := defaultHedgeThreshold
+	if ms := p.settingsCache.GetInt("routing.hedge.threshold_ms", 0); ms > 0 {
+		threshold = time.Duration(ms) * time.Millisecond
+	}
+	pct := p.settingsCache.GetInt("routing.hedge.budget_pct", defaultHedgeBudgetPct)
+	if pct < 0 {
+		pct = 0
+	}
+	return enabled, threshold, pct
+}
+
+// hedgeTransport 在主节点超过阈值仍未返回响应头时向备用节点发起同样的请求，
+// 采用先返回的响应并取消另一方。
+type hedgeTransport struct {
+	server    *Server
+	base      http.RoundTripper
+	secondary *Node
+	threshold time.Duration
+	budgetPct int
+	inPath    string      // 客户端原始路径，用于拼接备用节点地址
+	inHeader  http.Header // 客户端原始请求头，备用节点无密钥时恢复客户端认证
+	tracker   *usage
+}
+
+type hedgeResult struct {
+	resp      *http.Response
+	err       error
+	secondary bool
+	cancel    context.CancelFunc
+}
+
+// newHedgeTransport 为请求构建对冲传输层；未开启或无可用备用节点时返回 nil。
+func (p *Server) newHedgeTransport(acc *Account, primary *Node, r *http.Request, u *usage) *hedgeTransport {
+	enabled, threshold, pct := p.hedgeSettings()
+	if !enabled || pct == 0 || acc == nil || primary == nil {
+		return nil
+	}
+	p.mu.RLock()
+	secondary := bestRoutableNodeExcept(acc.Nodes, primary.ID)
+	var snapshot Node
+	if secondary != nil {
+		snapshot = *secondary
+	}
+	p.mu.RUnlock()
+	if secondary == nil {
+		return nil
+	}
+	return &hedgeTransport{
+		server:    p,
+		base:      p.transport,
+		secondary: &snapshot,
+		threshold: threshold,
+		budgetPct: pct,
+		inPath:    r.URL.Path,
+		inHeader:  r.Header.Clone(),
+		tracker:   u,
+	}
+}
+
+// secondaryRequest 将已指向主节点的请求改写到备用节点，上下文中的节点同时替换为备用节点，
+// 使按节点选择的 TLS 传输、故障注入与告警归属于实际目标。
+func (h *hedgeTransport) secondaryRequest(req *http.Request, body []byte, ctx context.Context) *http.Request {
+	out := req.Clone(context.WithValue(ctx, nodeContextKey{}, h.secondary))
+	target := h.secondary.URL
+	out.URL.Scheme = target.Scheme
+	out.URL.Host = target.Host
+	out.URL.Path = strings.TrimSuffix(target.Path, "/") + "/" + strings.TrimPrefix(h.inPath, "/")
+	out.URL.RawPath = ""
+	out.Host = target.Host
+	applyNodeHeaders(out.Header, h.secondary.Headers)
+	if h.secondary.APIKey != "" {
+		out.Header.Set("x-api-key", h.secondary.APIKey)
+		out.Header.Set("Authorization", "Bearer "+h.secondary.APIKey)
+	} else {
+		// 不能把主节点的密钥发给备用节点。
+		out.Header.Del("x-api-key")
+		out.Header.Del("Authorization")
+		for _, k := range []string{"x-api-key", "Authorization"} {
+			if v := h.inHeader.Values(k); len(v) > 0 {
+				out.Header[http.CanonicalHeaderKey(k)] = append([]string(nil), v...)
+			}
+		}
+	}
+	if body != nil {
+		out.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	return out
+}
+
+func (h *hedgeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		b, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		body = b
+	}
+	results := make(chan hedgeResult, 2)
+	launch := func(r *http.Request, secondary bool, cancel context.CancelFunc) {
+		go func() {
+			resp, err := h.base.RoundTrip(r)
+			if resp != nil {
+				resp.Header.Del(hedgeNodeHeader)
+			}
+			results <- hedgeResult{resp: resp, err: err, secondary: secondary, cancel: cancel}
+		}()
+	}
+
+	ctx1, cancel1 := context.WithCancel(req.Context())
+	primary := req.Clone(ctx1)
+	if body != nil {
+		primary.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	launch(primary, false, cancel1)
+
+	timer := time.NewTimer(h.threshold)
+	defer timer.Stop()
+	cancels := []context.CancelFunc{cancel1} // 下标 0 为主节点，1 为备用节点
+	pending := 1
+	hedged := false
+	var fallback *hedgeResult // 非 200 或出错的结果，在另一方也失败时返回
+	for {
+		select {
+		case res := <-results:
+			pending--
+			ok := res.err == nil && res.resp.StatusCode == http.StatusOK
+			if !ok && pending > 0 {
+				if fallback != nil && fallback.resp != nil {
+					fallback.resp.Body.Close()
+					fallback.cancel()
+				}
+				fallback = &res
+				continue
+			}
+			if !ok && fallback != nil && fallback.err == nil && res.err != nil {
+				// 优先返回带状态码的响应。
+				res.cancel()
+				res = *fallback
+			} else if fallback != nil {
+				if fallback.resp != nil {
+					fallback.resp.Body.Close()
+				}
+				fallback.cancel()
+			}
+			if pending > 0 {
+				// 立即取消仍在进行的落败请求。
+				for i, cancel := range cancels {
+					if (i == 1) != res.secondary {
+						cancel()
+					}
+				}
+				go drainHedgeLosers(results, pending)
+			}
+			if hedged {
+				h.tracker.hedged = true
+				h.tracker.hedgeWon = res.secondary && res.err == nil
+			}
+			if res.err != nil {
+				res.cancel()
+				return nil, res.err
+			}
+			if res.secondary {
+				res.resp.Header.Set(hedgeNodeHeader, h.secondary.Name)
+				h.tracker.hedgeNode = h.secondary
+			}
+			res.resp.Body = &cancelOnClose{ReadCloser: res.resp.Body, cancel: res.cancel}
+			return res.resp, nil
+		case <-timer.C:
+			if hedged || !h.server.hedges.take(time.Now(), h.budgetPct) {
+				continue
+			}
+			hedged = true
+			pending++
+			ctx2, cancel2 := context.WithCancel(req.Context())
+			cancels = append(cancels, cancel2)
+			launch(h.secondaryRequest(req, body, ctx2), true, cancel2)
+		case <-req.Context().Done():
+			for _, cancel := range cancels {
+				cancel()
+			}
+			if fallback != nil && fallback.resp != nil {
+				fallback.resp.Body.Close()
+			}
+			go drainHedgeLosers(results, pending)
+			return nil, req.Context().Err()
+		}
+	}
+}
+
+// drainHedgeLosers 关闭落败请求的响应并释放其上下文。
+func drainHedgeLosers(results <-chan hedgeResult, n int) {
+	for i := 0; i < n; i++ {
+		loser := <-results
+		loser.cancel()
+		if loser.resp != nil {
+			loser.resp.Body.Close()
+		}
+	}
+}
+
+// cancelOnClose 在响应体关闭后释放请求上下文。
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
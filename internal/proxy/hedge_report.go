@@ -0,0 +1,133 @@
+package proxy
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"qcc_plus/internal/store"
+	"qcc_plus/internal/timeutil"
+)
+
+// 对冲阈值调整建议。
+const (
+	hedgeHintRaiseThreshold = "raise_threshold" // 对冲很少胜出，多数请求主节点本可完成，额外成本偏高
+	hedgeHintLowerThreshold = "lower_threshold" // 对冲经常胜出，更早发起可进一步降低尾延迟
+	// 样本过少时不给建议。
+	hedgeHintMinSamples = 20
+)
+
+// GET /api/metrics/hedging?account_id=&node_id=&from=&to=
+// 对冲效果报表：触发率、备用节点胜出率与额外 token 成本（基于原始指标，默认最近 24 小时），用于调整对冲阈值。
+func (p *Server) handleHedgingReport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if p.store == nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "store not enabled"})
+		return
+	}
+	caller := accountFromCtx(r)
+	if caller == nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		return
+	}
+	q := r.URL.Query()
+	accountID := q.Get("account_id")
+	if !isAdmin(r.Context()) {
+		if accountID != "" && accountID != caller.ID {
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+			return
+		}
+		accountID = caller.ID
+	}
+	accountID = chooseNonEmpty(accountID, caller.ID)
+	from, to, err := parseTimeRange(q.Get("from"), q.Get("to"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	if to.IsZero() {
+		to = time.Now()
+	}
+	if from.IsZero() {
+		from = to.Add(-24 * time.Hour)
+	}
+	rows, err := p.store.HedgingByNode(r.Context(), accountID, q.Get("node_id"), from, to)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	names := make(map[string]string, len(rows))
+	p.mu.RLock()
+	for _, row := range rows {
+		if n := p.nodeIndex[row.NodeID]; n != nil {
+			names[row.NodeID] = n.Name
+		}
+	}
+	p.mu.RUnlock()
+	enabled, threshold, pct := p.hedgeSettings()
+	report := buildHedgingReport(accountID, from, to, rows, names)
+	report["settings"] = map[string]interface{}{
+		"enabled":      enabled,
+		"threshold_ms": threshold.Milliseconds(),
+		"budget_pct":   pct,
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+func buildHedgingReport(accountID string, from, to time.Time, rows []store.HedgeNodeStats, names map[string]string) map[string]interface{} {
+	var total store.HedgeNodeStats
+	byNode := make([]map[string]interface{}, 0, len(rows))
+	sort.Slice(rows, func(i, j int) bool { return rows[i].HedgedTotal > rows[j].HedgedTotal })
+	for _, row := range rows {
+		total.RequestsTotal += row.RequestsTotal
+		total.HedgedTotal += row.HedgedTotal
+		total.HedgeWinsTotal += row.HedgeWinsTotal
+		total.HedgeWastedTokens += row.HedgeWastedTokens
+		total.InputTokensTotal += row.InputTokensTotal
+		total.OutputTokensTotal += row.OutputTokensTotal
+		if row.HedgedTotal == 0 {
+			continue
+		}
+		byNode = append(byNode, map[string]interface{}{
+			"node_id":       row.NodeID,
+			"node_name":     names[row.NodeID],
+			"requests":      row.RequestsTotal,
+			"hedged":        row.HedgedTotal,
+			"hedge_wins":    row.HedgeWinsTotal,
+			"wasted_tokens": row.HedgeWastedTokens,
+		})
+	}
+	ratio := func(a, b int64) float64 {
+		if b <= 0 {
+			return 0
+		}
+		return float64(a) / float64(b)
+	}
+	winRate := ratio(total.HedgeWinsTotal, total.HedgedTotal)
+	hint := ""
+	if total.HedgedTotal >= hedgeHintMinSamples {
+		switch {
+		case winRate < 0.2:
+			hint = hedgeHintRaiseThreshold
+		case winRate > 0.6:
+			hint = hedgeHintLowerThreshold
+		}
+	}
+	return map[string]interface{}{
+		"account_id":     accountID,
+		"from":           timeutil.FormatBeijingTime(from),
+		"to":             timeutil.FormatBeijingTime(to),
+		"requests":       total.RequestsTotal,
+		"hedged":         total.HedgedTotal,
+		"hedge_rate":     ratio(total.HedgedTotal, total.RequestsTotal),
+		"hedge_wins":     total.HedgeWinsTotal,
+		"win_rate":       winRate,
+		"wasted_tokens":  total.HedgeWastedTokens,
+		"token_overhead": ratio(total.HedgeWastedTokens, total.InputTokensTotal+total.OutputTokensTotal),
+		"hint":           hint,
+		"by_node":        byNode,
+	}
+}
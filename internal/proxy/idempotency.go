@@ -0,0 +1,262 @@
+package proxy
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	idempotencyHeader     = "Idempotency-Key"
+	defaultIdempotencyTTL = 24 * time.Hour
+	maxIdempotencyKeyLen  = 128
+
+	// 幂等键数量上限：单个账号与全局超出时淘汰最早登记的键。
+	maxIdempotencyKeysPerAccount = 1000
+	maxIdempotencyKeys           = 20000
+	// maxIdempotencySnapshotBytes 响应体超过该大小时不保存快照，重复请求返回 409 而不是回放。
+	maxIdempotencySnapshotBytes = 256 << 10
+	// maxIdempotencyBodyBytes 请求体需整体读入以计算指纹，与声明式配置导入使用同一上限，超出返回 413。
+	maxIdempotencyBodyBytes = maxDeclarativeBytes
+)
+
+// idempotencyEntry 保存一次变更请求的响应快照。
+type idempotencyEntry struct {
+	key         string
+	owner       string
+	fingerprint string
+	done        bool
+	tooLarge    bool // 响应体超过 maxIdempotencySnapshotBytes，未保存快照
+	status      int
+	header      http.Header
+	body        []byte
+	expiresAt   time.Time
+
+	all, own *list.Element // 在全局与账号登记顺序中的位置
+}
+
+// IdempotencyStore 使用内存保存 Idempotency-Key 与响应快照，过期自动清理；
+// 按账号与全局限制键的数量，超出时淘汰最早登记的键。
+type IdempotencyStore struct {
+	mu      sync.Mutex
+	entries map[string]*idempotencyEntry
+	order   *list.List            // 全局登记顺序，队首最早
+	owners  map[string]*list.List // 账号 -> 该账号的登记顺序
+	ttl     time.Duration
+
+	maxPerOwner int
+	maxTotal    int
+	evictions   int64
+}
+
+// NewIdempotencyStore 创建幂等键存储，ttl<=0 时使用默认 24h。
+func NewIdempotencyStore(ttl time.Duration) *IdempotencyStore {
+	if ttl <= 0 {
+		ttl = defaultIdempotencyTTL
+	}
+	return &IdempotencyStore{
+		entries:     make(map[string]*idempotencyEntry),
+		order:       list.New(),
+		owners:      make(map[string]*list.List),
+		ttl:         ttl,
+		maxPerOwner: maxIdempotencyKeysPerAccount,
+		maxTotal:    maxIdempotencyKeys,
+	}
+}
+
+// begin 占用幂等键；返回已完成的快照，或冲突时的状态码与原因。
+func (s *IdempotencyStore) begin(owner, key, fingerprint string) (*idempotencyEntry, int, string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	s.purgeLocked(now)
+	if e, ok := s.entries[key]; ok {
+		if e.fingerprint != fingerprint {
+			return nil, http.StatusUnprocessableEntity, "idempotency key reused with different request"
+		}
+		if !e.done {
+			return nil, http.StatusConflict, "request with this idempotency key is in progress"
+		}
+		if e.tooLarge {
+			return nil, http.StatusConflict, "request with this idempotency key was already processed; response too large to replay"
+		}
+		return e, 0, ""
+	}
+	e := &idempotencyEntry{key: key, owner: owner, fingerprint: fingerprint, expiresAt: now.Add(s.ttl)}
+	own := s.owners[owner]
+	if own == nil {
+		own = list.New()
+		s.owners[owner] = own
+	}
+	e.all = s.order.PushBack(e)
+	e.own = own.PushBack(e)
+	s.entries[key] = e
+	for s.maxPerOwner > 0 && own.Len() > s.maxPerOwner {
+		s.removeLocked(own.Front().Value.(*idempotencyEntry))
+		s.evictions++
+	}
+	for s.maxTotal > 0 && s.order.Len() > s.maxTotal {
+		s.removeLocked(s.order.Front().Value.(*idempotencyEntry))
+		s.evictions++
+	}
+	return nil, 0, ""
+}
+
+// finish 保存成功响应；失败响应（5xx）释放幂等键以便重试。tooLarge 时只记录已完成，不保存快照。
+func (s *IdempotencyStore) finish(key string, status int, header http.Header, body []byte, tooLarge bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[key]
+	if !ok {
+		return
+	}
+	if status >= http.StatusInternalServerError {
+		s.removeLocked(e)
+		return
+	}
+	e.done = true
+	e.status = status
+	if tooLarge {
+		e.tooLarge = true
+		return
+	}
+	e.header = header
+	e.body = body
+}
+
+// release 释放尚未完成的幂等键，用于处理过程异常中断（如 panic）的请求。
+func (s *IdempotencyStore) release(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.entries[key]; ok && !e.done {
+		s.removeLocked(e)
+	}
+}
+
+// purgeLocked 清理过期的键：各键 TTL 相同，登记顺序即过期顺序。
+func (s *IdempotencyStore) purgeLocked(now time.Time) {
+	for el := s.order.Front(); el != nil; el = s.order.Front() {
+		e := el.Value.(*idempotencyEntry)
+		if !now.After(e.expiresAt) {
+			return
+		}
+		s.removeLocked(e)
+	}
+}
+
+func (s *IdempotencyStore) removeLocked(e *idempotencyEntry) {
+	delete(s.entries, e.key)
+	s.order.Remove(e.all)
+	if own := s.owners[e.owner]; own != nil {
+		own.Remove(e.own)
+		if own.Len() == 0 {
+			delete(s.owners, e.owner)
+		}
+	}
+}
+
+// idempotencyRecorder 同时写出响应并记录快照，快照超过 maxIdempotencySnapshotBytes 后不再缓冲。
+type idempotencyRecorder struct {
+	http.ResponseWriter
+	status   int
+	buf      bytes.Buffer
+	tooLarge bool
+}
+
+func (r *idempotencyRecorder) WriteHeader(code int) {
+	r.status = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *idempotencyRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	if !r.tooLarge {
+		if r.buf.Len()+len(b) > maxIdempotencySnapshotBytes {
+			r.tooLarge = true
+			r.buf = bytes.Buffer{}
+		} else {
+			r.buf.Write(b)
+		}
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// withIdempotency 为 POST 变更接口提供 Idempotency-Key 支持，重复请求直接回放首个响应。
+func (p *Server) withIdempotency(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(idempotencyHeader)
+		if p.idempotency == nil || key == "" || r.Method != http.MethodPost {
+			next(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLen {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "idempotency key too long"})
+			return
+		}
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxIdempotencyBodyBytes))
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				writeJSON(w, http.StatusRequestEntityTooLarge, map[string]string{"error": fmt.Sprintf("body too large (max %d bytes)", maxIdempotencyBodyBytes)})
+				return
+			}
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "read body failed"})
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		owner := ""
+		if acc := accountFromCtx(r); acc != nil {
+			owner = acc.ID
+		}
+		sum := sha256.Sum256(body)
+		fingerprint := hex.EncodeToString(sum[:])
+		storeKey := owner + "|" + r.Method + "|" + r.URL.Path + "|" + key
+
+		snapshot, status, conflict := p.idempotency.begin(owner, storeKey, fingerprint)
+		if conflict != "" {
+			writeJSON(w, status, map[string]string{"error": conflict})
+			return
+		}
+		if snapshot != nil {
+			for k, vals := range snapshot.header {
+				for _, v := range vals {
+					w.Header().Add(k, v)
+				}
+			}
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(snapshot.status)
+			_, _ = w.Write(snapshot.body)
+			return
+		}
+
+		rec := &idempotencyRecorder{ResponseWriter: w}
+		completed := false
+		defer func() {
+			// 处理过程中 panic（包括 http.ErrAbortHandler）时释放幂等键，否则重试会一直得到 409；panic 继续向上传播。
+			if !completed {
+				p.idempotency.release(storeKey)
+			}
+		}()
+		next(rec, r)
+		completed = true
+		status = rec.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		header := make(http.Header)
+		if ct := w.Header().Get("Content-Type"); ct != "" {
+			header.Set("Content-Type", ct)
+		}
+		p.idempotency.finish(storeKey, status, header, rec.buf.Bytes(), rec.tooLarge)
+	}
+}
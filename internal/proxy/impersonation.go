@@ -0,0 +1,189 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"qcc_plus/internal/timeutil"
+)
+
+const (
+	impersonatePath           = "/admin/api/impersonate"
+	impersonatingHeader       = "X-QCC-Impersonating"
+	impersonationModeHeader   = "X-QCC-Impersonation-Mode"
+	defaultImpersonateMinutes = 30
+	maxImpersonateMinutes     = 240
+)
+
+// impersonation 记录管理员临时代入的租户视图。
+type impersonation struct {
+	AccountID    string
+	AccountName  string
+	Impersonator string
+	ReadOnly     bool
+	Reason       string
+	StartedAt    time.Time
+	ExpiresAt    time.Time
+}
+
+type impersonationContextKey struct{}
+
+// impersonationFromCtx 返回当前请求的代入信息（未代入时为 nil）。
+func impersonationFromCtx(r *http.Request) *impersonation {
+	if r == nil {
+		return nil
+	}
+	if v, ok := r.Context().Value(impersonationContextKey{}).(*impersonation); ok {
+		return v
+	}
+	return nil
+}
+
+func impersonationView(imp *impersonation) map[string]interface{} {
+	if imp == nil {
+		return map[string]interface{}{"active": false}
+	}
+	mode := "read-only"
+	if !imp.ReadOnly {
+		mode = "read-write"
+	}
+	return map[string]interface{}{
+		"active":       true,
+		"account_id":   imp.AccountID,
+		"account_name": imp.AccountName,
+		"impersonator": imp.Impersonator,
+		"mode":         mode,
+		"reason":       imp.Reason,
+		"started_at":   timeutil.FormatBeijingTime(imp.StartedAt),
+		"expires_at":   timeutil.FormatBeijingTime(imp.ExpiresAt),
+	}
+}
+
+// applyImpersonation 在会话校验后切换到被代入账号；返回 false 表示请求已被拦截。
+func (p *Server) applyImpersonation(w http.ResponseWriter, r *http.Request, sess *Session) (*http.Request, bool) {
+	imp := sess.impersonation()
+	if imp == nil || r.URL.Path == impersonatePath || r.URL.Path == "/logout" {
+		return r, true
+	}
+	if time.Now().After(imp.ExpiresAt) {
+		if sess.endImpersonation() != nil {
+			p.audit(imp.AccountID, imp.Impersonator, "account.impersonate.expire", imp.AccountID, nil)
+		}
+		return r, true
+	}
+	target := p.getAccountByID(imp.AccountID)
+	if target == nil {
+		sess.endImpersonation()
+		return r, true
+	}
+	w.Header().Set(impersonatingHeader, imp.AccountID)
+	if imp.ReadOnly {
+		w.Header().Set(impersonationModeHeader, "read-only")
+	} else {
+		w.Header().Set(impersonationModeHeader, "read-write")
+	}
+	mutating := r.Method != http.MethodGet && r.Method != http.MethodHead && r.Method != http.MethodOptions
+	if mutating && imp.ReadOnly {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "impersonation is read-only"})
+		return nil, false
+	}
+	if mutating {
+		p.audit(imp.AccountID, imp.Impersonator, "account.impersonate.request", r.URL.Path, map[string]string{"method": r.Method})
+	}
+	// 代入期间按租户身份处理，不携带管理员权限。
+	ctx := context.WithValue(r.Context(), accountContextKey{}, target)
+	ctx = context.WithValue(ctx, isAdminContextKey{}, false)
+	ctx = context.WithValue(ctx, impersonationContextKey{}, imp)
+	return r.WithContext(ctx), true
+}
+
+// GET/POST/DELETE /admin/api/impersonate
+func (p *Server) handleImpersonate(w http.ResponseWriter, r *http.Request) {
+	sess := p.sessionMgr.Get(sessionTokenFromRequest(r))
+	if sess == nil || !sess.IsAdmin {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, impersonationView(sess.impersonation()))
+	case http.MethodPost:
+		p.startImpersonation(w, r, sess)
+	case http.MethodDelete:
+		imp := sess.endImpersonation()
+		if imp != nil {
+			p.audit(imp.AccountID, imp.Impersonator, "account.impersonate.stop", imp.AccountID, map[string]string{
+				"duration": time.Since(imp.StartedAt).Round(time.Second).String(),
+			})
+		}
+		writeJSON(w, http.StatusOK, impersonationView(nil))
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (p *Server) startImpersonation(w http.ResponseWriter, r *http.Request, sess *Session) {
+	var req struct {
+		AccountID string `json:"account_id"`
+		Write     bool   `json:"write"`
+		Minutes   int    `json:"minutes"`
+		Reason    string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid body"})
+		return
+	}
+	if req.Reason == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "reason required"})
+		return
+	}
+	target := p.getAccountByID(req.AccountID)
+	if target == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "account not found"})
+		return
+	}
+	if target.IsAdmin {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "cannot impersonate admin account"})
+		return
+	}
+	minutes := req.Minutes
+	if minutes <= 0 {
+		minutes = defaultImpersonateMinutes
+	}
+	if minutes > maxImpersonateMinutes {
+		minutes = maxImpersonateMinutes
+	}
+	now := time.Now()
+	imp := &impersonation{
+		AccountID:    target.ID,
+		AccountName:  target.Name,
+		Impersonator: sess.AccountID,
+		ReadOnly:     !req.Write,
+		Reason:       req.Reason,
+		StartedAt:    now,
+		ExpiresAt:    now.Add(time.Duration(minutes) * time.Minute),
+	}
+	if imp.ExpiresAt.After(sess.ExpiresAt) {
+		imp.ExpiresAt = sess.ExpiresAt
+	}
+	sess.startImpersonation(imp)
+	// 同时写入管理员与租户两侧的审计日志，便于租户追溯。
+	detail := map[string]interface{}{
+		"read_only": imp.ReadOnly,
+		"minutes":   minutes,
+		"reason":    imp.Reason,
+	}
+	p.audit(sess.AccountID, sess.AccountID, "account.impersonate.start", target.ID, detail)
+	p.audit(target.ID, sess.AccountID, "account.impersonate.start", target.ID, detail)
+	writeJSON(w, http.StatusOK, impersonationView(imp))
+}
+
+func sessionTokenFromRequest(r *http.Request) string {
+	cookie, err := r.Cookie("session_token")
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
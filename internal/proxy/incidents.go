@@ -0,0 +1,335 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"qcc_plus/internal/store"
+	"qcc_plus/internal/timeutil"
+)
+
+const (
+	incidentsAPIPrefix   = "/api/incidents/"
+	maxIncidentTitleLen  = 255
+	maxIncidentBodyLen   = 64 * 1024
+	statusPageResolvedIn = 7 * 24 * time.Hour // 状态页展示近 7 天已解决的事件
+)
+
+var incidentStatuses = []string{store.IncidentInvestigating, store.IncidentIdentified, store.IncidentMonitoring, store.IncidentResolved}
+
+var incidentImpacts = []string{"", "minor", "major", "critical"}
+
+// incidentRequest 创建/编辑事件的请求体，字段为空表示不修改。
+type incidentRequest struct {
+	Title         *string   `json:"title"`
+	Status        *string   `json:"status"`
+	Impact        *string   `json:"impact"`
+	AffectedNodes *[]string `json:"affected_nodes"`
+	Postmortem    *string   `json:"postmortem"`
+	StartedAt     *string   `json:"started_at"`
+	Body          string    `json:"body"` // 创建时的首条进展
+}
+
+// apply 将请求字段合并到事件记录，返回校验错误。
+func (req incidentRequest) apply(p *Server, acc *Account, rec *store.IncidentRecord) error {
+	if req.Title != nil {
+		rec.Title = strings.TrimSpace(*req.Title)
+	}
+	if rec.Title == "" || len(rec.Title) > maxIncidentTitleLen {
+		return errors.New("title required (max 255 chars)")
+	}
+	if req.Status != nil {
+		rec.Status = *req.Status
+	}
+	if !containsString(incidentStatuses, rec.Status) {
+		return errors.New("invalid status")
+	}
+	if req.Impact != nil {
+		rec.Impact = *req.Impact
+	}
+	if !containsString(incidentImpacts, rec.Impact) {
+		return errors.New("invalid impact")
+	}
+	if req.AffectedNodes != nil {
+		p.mu.RLock()
+		for _, id := range *req.AffectedNodes {
+			if acc.Nodes[id] == nil {
+				p.mu.RUnlock()
+				return errors.New("unknown node: " + id)
+			}
+		}
+		p.mu.RUnlock()
+		rec.AffectedNodes = *req.AffectedNodes
+	}
+	if req.Postmortem != nil {
+		rec.Postmortem = *req.Postmortem
+	}
+	if len(rec.Postmortem) > maxIncidentBodyLen || len(req.Body) > maxIncidentBodyLen {
+		return errors.New("markdown body too long")
+	}
+	if req.StartedAt != nil {
+		t, err := parseTime(*req.StartedAt)
+		if err != nil {
+			return errors.New("invalid started_at")
+		}
+		rec.StartedAt = t
+	}
+	if rec.Status == store.IncidentResolved && rec.ResolvedAt.IsZero() {
+		rec.ResolvedAt = time.Now().UTC()
+	} else if rec.Status != store.IncidentResolved {
+		rec.ResolvedAt = time.Time{}
+	}
+	return nil
+}
+
+func incidentView(rec store.IncidentRecord) map[string]interface{} {
+	updates := make([]map[string]interface{}, 0, len(rec.Updates))
+	for _, u := range rec.Updates {
+		updates = append(updates, map[string]interface{}{
+			"id":         u.ID,
+			"status":     u.Status,
+			"body":       u.Body,
+			"created_by": u.CreatedBy,
+			"created_at": timeutil.FormatBeijingTime(u.CreatedAt),
+		})
+	}
+	var resolvedAt *string
+	if !rec.ResolvedAt.IsZero() {
+		s := timeutil.FormatBeijingTime(rec.ResolvedAt)
+		resolvedAt = &s
+	}
+	nodes := rec.AffectedNodes
+	if nodes == nil {
+		nodes = []string{}
+	}
+	return map[string]interface{}{
+		"id":             rec.ID,
+		"account_id":     rec.AccountID,
+		"title":          rec.Title,
+		"status":         rec.Status,
+		"impact":         rec.Impact,
+		"affected_nodes": nodes,
+		"postmortem":     rec.Postmortem,
+		"started_at":     timeutil.FormatBeijingTime(rec.StartedAt),
+		"resolved_at":    resolvedAt,
+		"created_by":     rec.CreatedBy,
+		"updated_at":     timeutil.FormatBeijingTime(rec.UpdatedAt),
+		"updates":        updates,
+	}
+}
+
+// incidentAccount 解析目标账号：默认当前账号，管理员可通过 account_id 指定。
+func (p *Server) incidentAccount(w http.ResponseWriter, r *http.Request) (*Account, bool) {
+	if p.store == nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "store not enabled"})
+		return nil, false
+	}
+	caller := accountFromCtx(r)
+	if caller == nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		return nil, false
+	}
+	accountID := chooseNonEmpty(r.URL.Query().Get("account_id"), caller.ID)
+	if !canManageAccount(r.Context(), accountID) {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+		return nil, false
+	}
+	acc := p.getAccountByID(accountID)
+	if acc == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "account not found"})
+		return nil, false
+	}
+	return acc, true
+}
+
+// GET/POST /api/incidents?account_id=&active=true&limit=&offset=
+func (p *Server) handleIncidents(w http.ResponseWriter, r *http.Request) {
+	acc, ok := p.incidentAccount(w, r)
+	if !ok {
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		q := r.URL.Query()
+		query := store.IncidentQuery{AccountID: acc.ID, ActiveOnly: q.Get("active") == "true", Limit: 50}
+		if n, err := strconv.Atoi(q.Get("limit")); err == nil && n > 0 && n <= 500 {
+			query.Limit = n
+		}
+		if n, err := strconv.Atoi(q.Get("offset")); err == nil && n >= 0 {
+			query.Offset = n
+		}
+		list, err := p.store.ListIncidents(r.Context(), query)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		items := make([]map[string]interface{}, 0, len(list))
+		for _, rec := range list {
+			items = append(items, incidentView(rec))
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"incidents": items})
+	case http.MethodPost:
+		var req incidentRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid body"})
+			return
+		}
+		rec := store.IncidentRecord{AccountID: acc.ID, Status: store.IncidentInvestigating, CreatedBy: auditActor(r)}
+		if err := req.apply(p, acc, &rec); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		id, err := p.store.CreateIncident(r.Context(), rec)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		if strings.TrimSpace(req.Body) != "" {
+			if _, err := p.store.AddIncidentUpdate(r.Context(), acc.ID, store.IncidentUpdateRecord{
+				IncidentID: id, Status: rec.Status, Body: req.Body, CreatedBy: rec.CreatedBy,
+			}); err != nil {
+				writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+				return
+			}
+		}
+		p.incidentChanged(r, acc.ID, "incident.create", id)
+		p.writeIncident(w, r, acc.ID, id, http.StatusCreated)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// GET/PATCH/DELETE /api/incidents/:id，POST /api/incidents/:id/updates
+func (p *Server) handleIncidentByID(w http.ResponseWriter, r *http.Request) {
+	acc, ok := p.incidentAccount(w, r)
+	if !ok {
+		return
+	}
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, incidentsAPIPrefix), "/")
+	idStr, action, _ := strings.Cut(rest, "/")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil || id <= 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid incident id"})
+		return
+	}
+	rec, err := p.store.GetIncident(r.Context(), acc.ID, id)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "incident not found"})
+			return
+		}
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	switch {
+	case action == "updates" && r.Method == http.MethodPost:
+		var req struct {
+			Status string `json:"status"`
+			Body   string `json:"body"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid body"})
+			return
+		}
+		req.Status = chooseNonEmpty(req.Status, rec.Status)
+		if !containsString(incidentStatuses, req.Status) {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid status"})
+			return
+		}
+		if strings.TrimSpace(req.Body) == "" || len(req.Body) > maxIncidentBodyLen {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "body required (max 64KB)"})
+			return
+		}
+		if _, err := p.store.AddIncidentUpdate(r.Context(), acc.ID, store.IncidentUpdateRecord{
+			IncidentID: id, Status: req.Status, Body: req.Body, CreatedBy: auditActor(r),
+		}); err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		p.incidentChanged(r, acc.ID, "incident.update", id)
+		p.writeIncident(w, r, acc.ID, id, http.StatusCreated)
+	case action != "":
+		http.NotFound(w, r)
+	case r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, incidentView(*rec))
+	case r.Method == http.MethodPatch:
+		var req incidentRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid body"})
+			return
+		}
+		if err := req.apply(p, acc, rec); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		if err := p.store.UpdateIncident(r.Context(), *rec); err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		p.incidentChanged(r, acc.ID, "incident.edit", id)
+		p.writeIncident(w, r, acc.ID, id, http.StatusOK)
+	case r.Method == http.MethodDelete:
+		if err := p.store.DeleteIncident(r.Context(), acc.ID, id); err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		p.incidentChanged(r, acc.ID, "incident.delete", id)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (p *Server) writeIncident(w http.ResponseWriter, r *http.Request, accountID string, id int64, status int) {
+	rec, err := p.store.GetIncident(r.Context(), accountID, id)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, status, incidentView(*rec))
+}
+
+// incidentChanged 记录审计并让状态页缓存失效。
+func (p *Server) incidentChanged(r *http.Request, accountID, action string, id int64) {
+	if p.statusPages != nil {
+		p.statusPages.flush()
+	}
+	p.audit(accountID, auditActor(r), action, strconv.FormatInt(id, 10), nil)
+}
+
+// statusIncidentsFromRecords 将人工事件转换为状态页条目，受影响节点以名称展示。
+func statusIncidentsFromRecords(records []store.IncidentRecord, nodeNames map[string]string) []statusIncident {
+	out := make([]statusIncident, 0, len(records))
+	for _, rec := range records {
+		item := statusIncident{
+			Title:      rec.Title,
+			Status:     rec.Status,
+			Impact:     rec.Impact,
+			Nodes:      make([]string, 0, len(rec.AffectedNodes)),
+			StartedAt:  timeutil.FormatBeijingTime(rec.StartedAt),
+			Postmortem: rec.Postmortem,
+		}
+		if !rec.ResolvedAt.IsZero() {
+			item.ResolvedAt = timeutil.FormatBeijingTime(rec.ResolvedAt)
+		}
+		for _, id := range rec.AffectedNodes {
+			if name, ok := nodeNames[id]; ok {
+				item.Nodes = append(item.Nodes, name)
+			}
+		}
+		for _, u := range rec.Updates {
+			item.Updates = append(item.Updates, statusIncidentUpdate{
+				Status:    u.Status,
+				Body:      u.Body,
+				CreatedAt: timeutil.FormatBeijingTime(u.CreatedAt),
+			})
+		}
+		out = append(out, item)
+	}
+	return out
+}
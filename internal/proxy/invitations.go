@@ -0,0 +1,330 @@
+package proxy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"qcc_plus/internal/store"
+)
+
+const (
+	accountInvitationsSettingKey = "account.invitations"
+	invitationsAPIPrefix         = "/api/invitations/"
+	defaultInvitationTTL         = 7 * 24 * time.Hour
+	maxInvitationTTL             = 30 * 24 * time.Hour
+)
+
+// 邀请状态。
+const (
+	invitationPending  = "pending"
+	invitationAccepted = "accepted"
+	invitationRevoked  = "revoked"
+	invitationExpired  = "expired"
+)
+
+// Invitation 加入账号的邀请。链接中的令牌只在创建时返回一次，持久化时仅保存哈希。
+type Invitation struct {
+	ID         string     `json:"id"`
+	TokenHash  string     `json:"token_hash"`
+	Email      string     `json:"email,omitempty"`
+	Role       string     `json:"role"`
+	CreatedBy  string     `json:"created_by"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	AcceptedAt *time.Time `json:"accepted_at,omitempty"`
+	AcceptedBy string     `json:"accepted_by,omitempty"` // 接受邀请后创建的成员 ID
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+func (inv Invitation) status(now time.Time) string {
+	switch {
+	case inv.AcceptedAt != nil:
+		return invitationAccepted
+	case inv.RevokedAt != nil:
+		return invitationRevoked
+	case !now.Before(inv.ExpiresAt):
+		return invitationExpired
+	}
+	return invitationPending
+}
+
+func hashInvitationToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func buildInvitationURL(r *http.Request, token string) string {
+	return requestBaseURL(r) + "/invite/" + token
+}
+
+func invitationView(inv Invitation, now time.Time) map[string]interface{} {
+	return map[string]interface{}{
+		"id":          inv.ID,
+		"email":       inv.Email,
+		"role":        inv.Role,
+		"status":      inv.status(now),
+		"created_by":  inv.CreatedBy,
+		"created_at":  inv.CreatedAt,
+		"expires_at":  inv.ExpiresAt,
+		"accepted_at": inv.AcceptedAt,
+		"accepted_by": inv.AcceptedBy,
+		"revoked_at":  inv.RevokedAt,
+	}
+}
+
+func (p *Server) loadAccountInvitations(accountID string) []Invitation {
+	var list []Invitation
+	if p.store == nil {
+		return list
+	}
+	setting, err := p.store.GetSetting(accountInvitationsSettingKey, "account", accountID)
+	if err != nil || setting == nil {
+		return list
+	}
+	if b, err := json.Marshal(setting.Value); err == nil {
+		_ = json.Unmarshal(b, &list)
+	}
+	return list
+}
+
+func (p *Server) persistAccountInvitations(accountID string, list []Invitation, updatedBy string) error {
+	if p.store == nil {
+		return nil
+	}
+	id := accountID
+	desc := "加入账号的邀请（仅保存令牌哈希）"
+	setting := &store.Setting{
+		Key:         accountInvitationsSettingKey,
+		Scope:       "account",
+		AccountID:   &id,
+		Value:       list,
+		DataType:    "array",
+		Category:    "security",
+		Description: &desc,
+	}
+	if updatedBy != "" {
+		setting.UpdatedBy = &updatedBy
+	}
+	return p.store.UpsertSetting(setting)
+}
+
+// GET/POST /api/accounts/:id/invitations、DELETE /api/accounts/:id/invitations/:invitation_id
+// GET 默认只列出待接受的邀请，?all=true 返回全部；POST 返回可通过邮件发送的一次性邀请链接。
+func (p *Server) handleAccountInvitations(w http.ResponseWriter, r *http.Request, acc *Account, invitationID string) {
+	if !canAdministerAccount(r.Context(), acc.ID) {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+		return
+	}
+	now := time.Now().UTC()
+	switch {
+	case r.Method == http.MethodGet && invitationID == "":
+		all := r.URL.Query().Get("all") == "true"
+		p.mu.RLock()
+		list := make([]map[string]interface{}, 0, len(acc.Invitations))
+		for _, inv := range acc.Invitations {
+			if all || inv.status(now) == invitationPending {
+				list = append(list, invitationView(inv, now))
+			}
+		}
+		p.mu.RUnlock()
+		writeJSON(w, http.StatusOK, map[string]interface{}{"account_id": acc.ID, "invitations": list})
+	case r.Method == http.MethodPost && invitationID == "":
+		p.createInvitation(w, r, acc, now)
+	case r.Method == http.MethodDelete && invitationID != "":
+		p.mu.Lock()
+		var revoked *Invitation
+		for i := range acc.Invitations {
+			if inv := &acc.Invitations[i]; inv.ID == invitationID && inv.status(now) == invitationPending {
+				inv.RevokedAt = &now
+				revoked = inv
+				break
+			}
+		}
+		list := append([]Invitation(nil), acc.Invitations...)
+		p.mu.Unlock()
+		if revoked == nil {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "pending invitation not found"})
+			return
+		}
+		if err := p.persistAccountInvitations(acc.ID, list, auditActor(r)); err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		p.audit(acc.ID, auditActor(r), "account.invitation.revoke", invitationID, nil)
+		writeJSON(w, http.StatusOK, map[string]string{"revoked": invitationID})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (p *Server) createInvitation(w http.ResponseWriter, r *http.Request, acc *Account, now time.Time) {
+	var req struct {
+		Email          string `json:"email"`
+		Role           string `json:"role"`
+		ExpiresInHours int    `json:"expires_in_hours"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
+		return
+	}
+	req.Role = strings.ToLower(chooseNonEmpty(strings.TrimSpace(req.Role), roleMember))
+	if !validMemberRole(req.Role) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "role must be admin, member or viewer"})
+		return
+	}
+	ttl := defaultInvitationTTL
+	if req.ExpiresInHours != 0 {
+		ttl = time.Duration(req.ExpiresInHours) * time.Hour
+		if ttl <= 0 || ttl > maxInvitationTTL {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("expires_in_hours must be between 1 and %d", int(maxInvitationTTL.Hours()))})
+			return
+		}
+	}
+	token := randomToken(24)
+	inv := Invitation{
+		ID:        fmt.Sprintf("inv-%d", now.UnixNano()),
+		TokenHash: hashInvitationToken(token),
+		Email:     strings.TrimSpace(req.Email),
+		Role:      req.Role,
+		CreatedBy: auditActor(r),
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}
+	p.mu.Lock()
+	acc.Invitations = append(acc.Invitations, inv)
+	list := append([]Invitation(nil), acc.Invitations...)
+	p.mu.Unlock()
+	if err := p.persistAccountInvitations(acc.ID, list, auditActor(r)); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	p.audit(acc.ID, auditActor(r), "account.invitation.create", inv.ID, map[string]string{"email": inv.Email, "role": inv.Role})
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"invitation": invitationView(inv, now),
+		"invite_url": buildInvitationURL(r, token),
+	})
+}
+
+// findInvitationLocked 按令牌查找邀请，调用方需持有 p.mu。
+func (p *Server) findInvitationLocked(token string) (*Account, *Invitation) {
+	hash := hashInvitationToken(token)
+	for _, acc := range p.accountByID {
+		for i := range acc.Invitations {
+			if acc.Invitations[i].TokenHash == hash {
+				return acc, &acc.Invitations[i]
+			}
+		}
+	}
+	return nil, nil
+}
+
+// GET /api/invitations/:token、POST /api/invitations/:token/accept
+// 无需登录：GET 查看邀请信息，POST 以 {name,password} 创建成员、加入账号并登录。
+func (p *Server) handleInvitationLink(w http.ResponseWriter, r *http.Request) {
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, invitationsAPIPrefix), "/")
+	token, action, _ := strings.Cut(rest, "/")
+	if token == "" || (action != "" && action != "accept") {
+		http.NotFound(w, r)
+		return
+	}
+	now := time.Now().UTC()
+
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		p.mu.RLock()
+		acc, inv := p.findInvitationLocked(token)
+		var view map[string]interface{}
+		if inv != nil && inv.status(now) == invitationPending {
+			view = map[string]interface{}{
+				"account_name": acc.Name,
+				"email":        inv.Email,
+				"role":         inv.Role,
+				"expires_at":   inv.ExpiresAt,
+			}
+		}
+		p.mu.RUnlock()
+		if view == nil {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "invitation not found or no longer valid"})
+			return
+		}
+		writeJSON(w, http.StatusOK, view)
+	case action == "accept" && r.Method == http.MethodPost:
+		p.acceptInvitation(w, r, token, now)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (p *Server) acceptInvitation(w http.ResponseWriter, r *http.Request, token string, now time.Time) {
+	var req struct {
+		Name     string `json:"name"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "name required"})
+		return
+	}
+	if err := p.passwordPolicy().validate(req.Password); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	hash := hashPassword(req.Password)
+
+	p.mu.Lock()
+	acc, inv := p.findInvitationLocked(token)
+	if inv == nil || inv.status(now) != invitationPending {
+		p.mu.Unlock()
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "invitation not found or no longer valid"})
+		return
+	}
+	if p.loginNameTakenLocked(req.Name) {
+		p.mu.Unlock()
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "name already taken"})
+		return
+	}
+	user := AccountUser{
+		ID:           fmt.Sprintf("usr-%d", now.UnixNano()),
+		Name:         req.Name,
+		Email:        inv.Email,
+		Role:         inv.Role,
+		PasswordHash: hash,
+		PasswordMeta: passwordMeta{ChangedAt: &now},
+		InvitedBy:    inv.CreatedBy,
+		CreatedAt:    now,
+	}
+	inv.AcceptedAt, inv.AcceptedBy = &now, user.ID
+	acc.Users = append(acc.Users, user)
+	users := append([]AccountUser(nil), acc.Users...)
+	invitations := append([]Invitation(nil), acc.Invitations...)
+	invID := inv.ID
+	p.mu.Unlock()
+
+	if err := p.persistAccountUsers(acc.ID, users, user.ID); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	_ = p.persistAccountInvitations(acc.ID, invitations, user.ID)
+	p.audit(acc.ID, user.ID, "account.invitation.accept", invID, map[string]string{"user": user.Name, "role": user.Role})
+
+	if sess := p.createUserSession(acc, user); sess != nil {
+		http.SetCookie(w, &http.Cookie{
+			Name:     "session_token",
+			Value:    sess.Token,
+			Path:     "/",
+			MaxAge:   86400,
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+	writeJSON(w, http.StatusCreated, map[string]interface{}{"account_id": acc.ID, "user": accountUserView(user)})
+}
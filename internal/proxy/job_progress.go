@@ -0,0 +1,159 @@
+package proxy
+
+import (
+	"encoding/json"
+	"math"
+	"sync"
+	"time"
+
+	"qcc_plus/internal/store"
+	"qcc_plus/internal/timeutil"
+)
+
+const (
+	wsTopicJobProgress  = "job_progress"
+	jobProgressInterval = time.Second // 同一任务两次进度推送的最小间隔
+)
+
+// JobProgress WS job_progress 消息与任务详情中的进度。客户端以 type+job_id 区分任务：
+// 队列任务使用 jobs 表的编号；未启用存储时在本进程内执行的任务，以及启动补聚合（aggregation_backfill）
+// 与批量导入节点（node_import）这类不入队的操作使用进程内编号。
+type JobProgress struct {
+	JobID      int64   `json:"job_id"`
+	Type       string  `json:"type"`
+	AccountID  string  `json:"account_id,omitempty"`
+	Status     string  `json:"status"`
+	Stage      string  `json:"stage,omitempty"`
+	Processed  int64   `json:"processed"`
+	Total      int64   `json:"total"`                 // 0 表示总量未知
+	Percent    float64 `json:"percent"`               // 总量未知时为 0，成功结束时为 100
+	ETASeconds *int64  `json:"eta_seconds,omitempty"` // 按已用时间与完成比例估算，无法估算时省略
+	Elapsed    int64   `json:"elapsed_seconds"`
+	Error      string  `json:"error,omitempty"`
+	Timestamp  string  `json:"timestamp"`
+}
+
+// buildJobProgress 计算百分比与预计剩余时间。
+func buildJobProgress(processed, total int64, started, now time.Time) JobProgress {
+	p := JobProgress{Processed: processed, Total: total, Timestamp: timeutil.FormatBeijingTime(now)}
+	elapsed := now.Sub(started)
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	p.Elapsed = int64(elapsed / time.Second)
+	if total > 0 {
+		if processed > total {
+			processed = total
+		}
+		p.Percent = math.Round(float64(processed)*1000/float64(total)) / 10
+		if processed > 0 && processed < total {
+			eta := int64(elapsed.Seconds() * float64(total-processed) / float64(processed))
+			p.ETASeconds = &eta
+		}
+	}
+	return p
+}
+
+// jobReporter 供任务处理函数上报进度：推送按 jobProgressInterval 节流，最新进度随心跳持久化。
+// 方法对 nil 安全，处理函数可不上报进度。
+type jobReporter struct {
+	job     *store.Job
+	started time.Time
+	publish func(JobProgress)
+
+	mu        sync.Mutex
+	stage     string
+	processed int64
+	total     int64
+	lastSent  time.Time
+	dirty     bool // 有未持久化的进度
+}
+
+func newJobReporter(job *store.Job, publish func(JobProgress)) *jobReporter {
+	return &jobReporter{job: job, started: time.Now(), publish: publish}
+}
+
+// Update 上报已处理数量与总量，total 未知时传 0。
+func (r *jobReporter) Update(processed, total int64) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	r.processed, r.total, r.dirty = processed, total, true
+	r.mu.Unlock()
+	r.maybePublish()
+}
+
+// Stage 设置当前阶段说明（如正在处理的表），随下一次进度推送。
+func (r *jobReporter) Stage(stage string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	r.stage, r.dirty = stage, true
+	r.mu.Unlock()
+}
+
+func (r *jobReporter) maybePublish() {
+	now := time.Now()
+	r.mu.Lock()
+	if now.Sub(r.lastSent) < jobProgressInterval {
+		r.mu.Unlock()
+		return
+	}
+	r.lastSent = now
+	ev := r.snapshotLocked(store.JobRunning, now)
+	r.mu.Unlock()
+	if r.publish != nil {
+		r.publish(ev)
+	}
+}
+
+func (r *jobReporter) snapshotLocked(status string, now time.Time) JobProgress {
+	ev := buildJobProgress(r.processed, r.total, r.started, now)
+	ev.JobID, ev.Type, ev.AccountID, ev.Status, ev.Stage = r.job.ID, r.job.Type, r.job.AccountID, status, r.stage
+	return ev
+}
+
+// pending 返回自上次调用以来有变化的进度（供心跳持久化），无变化时为 nil。
+func (r *jobReporter) pending() json.RawMessage {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.dirty {
+		return nil
+	}
+	r.dirty = false
+	b, _ := json.Marshal(r.snapshotLocked(store.JobRunning, time.Now()))
+	return b
+}
+
+// finish 生成任务结束时的进度并立即推送，成功时进度记为 100%。
+func (r *jobReporter) finish(status, errText string) json.RawMessage {
+	r.mu.Lock()
+	if status == store.JobSucceeded && r.total > 0 {
+		r.processed = r.total
+	}
+	ev := r.snapshotLocked(status, time.Now())
+	if status == store.JobSucceeded {
+		ev.Percent = 100
+	}
+	ev.Error = errText
+	r.mu.Unlock()
+	if r.publish != nil {
+		r.publish(ev)
+	}
+	b, _ := json.Marshal(ev)
+	return b
+}
+
+// broadcastJobProgress 账号任务推送给该账号的连接，系统任务只推送给管理员。
+func (p *Server) broadcastJobProgress(ev JobProgress) {
+	if p.wsHub == nil {
+		return
+	}
+	if ev.AccountID == "" {
+		p.wsHub.BroadcastAdmins(wsTopicJobProgress, ev)
+		return
+	}
+	p.wsHub.Broadcast(ev.AccountID, wsTopicJobProgress, ev)
+}
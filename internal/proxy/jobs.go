@@ -0,0 +1,411 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"qcc_plus/internal/store"
+)
+
+const (
+	defaultJobWorkers   = 2
+	jobPollInterval     = 2 * time.Second
+	jobHeartbeatEvery   = 15 * time.Second
+	jobStaleAfter       = 2 * time.Minute // 超过该时间没有心跳的运行中任务视为 worker 已失联
+	jobRetryBaseDelay   = 30 * time.Second
+	jobRetryMaxDelay    = 30 * time.Minute
+	jobMaxAttemptsLimit = 10
+)
+
+// jobQueue 后台任务的持久化队列，由 *store.Store 实现。
+type jobQueue interface {
+	EnqueueJob(ctx context.Context, job *store.Job) error
+	GetJob(ctx context.Context, id int64) (*store.Job, error)
+	ListJobs(ctx context.Context, f store.JobFilter) ([]store.Job, error)
+	ClaimJob(ctx context.Context, worker string, types []string) (*store.Job, error)
+	HeartbeatJob(ctx context.Context, id int64, worker string, progress json.RawMessage) (bool, error)
+	FinishJob(ctx context.Context, id int64, worker, status string, result, progress json.RawMessage, errText string, retryAt time.Time) error
+	ReleaseJob(ctx context.Context, id int64, worker string) error
+	CancelJob(ctx context.Context, id int64) (*store.Job, error)
+	RetryJob(ctx context.Context, id int64) (*store.Job, error)
+	RequeueStaleJobs(ctx context.Context, lockedBefore time.Time) (int64, error)
+}
+
+// jobHandler 执行一种类型的任务，返回值序列化后作为任务结果；耗时任务通过 progress 上报进度。
+// ctx 在任务被取消或进程退出时结束，处理函数应及时返回；返回错误时按任务的 max_attempts 退避重试。
+type jobHandler func(ctx context.Context, job *store.Job, progress *jobReporter) (any, error)
+
+// 内置任务类型，处理函数见 builtinJobHandlers。
+const (
+	jobTypeAccountExport = "account_export"
+	jobTypeAccountPurge  = "account_purge"
+	jobTypeNodeBenchmark = "node_benchmark"
+	jobTypeABComparison  = "ab_comparison"
+)
+
+// 在本进程内同步执行、不进入队列的操作，只借用任务进度推送：启动补聚合（系统任务）与批量导入节点。
+const (
+	jobTypeAggregationBackfill = "aggregation_backfill"
+	jobTypeNodeImport          = "node_import"
+)
+
+// jobRunner 持久化任务的 worker 池，与指标调度器运行在同一进程中（METRICS_SCHEDULER_ENABLED 关闭时不执行任务，
+// 但仍可入队与查询，由其他实例执行）。账号导出、账号数据清理、节点压测与 A/B 对比通过 register 注册任务类型，
+// 由接口入队后在这里执行。
+type jobRunner struct {
+	queue     jobQueue
+	logger    *log.Logger
+	workerID  string
+	workers   int
+	heartbeat time.Duration
+	paused    func() bool       // 返回 true 时暂停领取新任务（维护模式）
+	publish   func(JobProgress) // 推送任务进度，未设置时只持久化
+
+	mu       sync.RWMutex
+	handlers map[string]jobHandler
+
+	ctx      context.Context // Stop 时取消，正在执行的任务随之中止并交还队列
+	stop     context.CancelFunc
+	wg       sync.WaitGroup
+	stopOnce sync.Once
+}
+
+func newJobRunner(q jobQueue, logger *log.Logger, workers int) *jobRunner {
+	if logger == nil {
+		logger = log.Default()
+	}
+	host, _ := os.Hostname()
+	if host == "" {
+		host = "qcc"
+	}
+	ctx, stop := context.WithCancel(context.Background())
+	return &jobRunner{
+		queue:     q,
+		logger:    logger,
+		workerID:  fmt.Sprintf("%s-%d-%s", host, os.Getpid(), randomToken(3)),
+		workers:   workers,
+		heartbeat: jobHeartbeatEvery,
+		handlers:  make(map[string]jobHandler),
+		ctx:       ctx,
+		stop:      stop,
+	}
+}
+
+// jobWorkersFromEnv 读取 JOB_WORKERS，未设置时为默认值，0 表示本实例不执行任务。
+func jobWorkersFromEnv(logger *log.Logger) int {
+	v := os.Getenv("JOB_WORKERS")
+	if v == "" {
+		return defaultJobWorkers
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		logger.Printf("invalid JOB_WORKERS=%s, fallback to %d", v, defaultJobWorkers)
+		return defaultJobWorkers
+	}
+	return n
+}
+
+// register 注册任务类型的处理函数，需在 Start 之前调用。
+func (r *jobRunner) register(typ string, h jobHandler) {
+	r.mu.Lock()
+	r.handlers[typ] = h
+	r.mu.Unlock()
+}
+
+func (r *jobRunner) handler(typ string) jobHandler {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.handlers[typ]
+}
+
+func (r *jobRunner) types() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make([]string, 0, len(r.handlers))
+	for typ := range r.handlers {
+		out = append(out, typ)
+	}
+	return out
+}
+
+// Start 启动 worker 与失联任务回收。
+func (r *jobRunner) Start() error {
+	if r == nil || r.queue == nil || r.workers <= 0 {
+		return nil
+	}
+	r.wg.Add(r.workers + 1)
+	for i := 0; i < r.workers; i++ {
+		go r.workerLoop()
+	}
+	go r.reapLoop()
+	return nil
+}
+
+// Stop 中止正在执行的任务并等待 worker 退出，最多等待 30 秒。
+func (r *jobRunner) Stop() {
+	if r == nil {
+		return
+	}
+	r.stopOnce.Do(r.stop)
+	done := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(30 * time.Second):
+		r.logger.Printf("[JobRunner] stop timeout, exiting forcefully")
+	}
+}
+
+func (r *jobRunner) workerLoop() {
+	defer r.wg.Done()
+	ticker := time.NewTicker(jobPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.ctx.Done():
+			return
+		case <-ticker.C:
+			for r.ctx.Err() == nil && !r.isPaused() && r.runOnce() {
+			}
+		}
+	}
+}
+
+func (r *jobRunner) reapLoop() {
+	defer r.wg.Done()
+	ticker := time.NewTicker(jobStaleAfter / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.ctx.Done():
+			return
+		case <-ticker.C:
+			if n, err := r.queue.RequeueStaleJobs(context.Background(), time.Now().Add(-jobStaleAfter)); err != nil {
+				r.logger.Printf("[JobRunner] requeue stale jobs failed: %v", err)
+			} else if n > 0 {
+				r.logger.Printf("[JobRunner] requeued %d stale jobs", n)
+			}
+		}
+	}
+}
+
+func (r *jobRunner) isPaused() bool {
+	return r.paused != nil && r.paused()
+}
+
+// runOnce 领取并执行一个任务，没有可执行的任务时返回 false。
+func (r *jobRunner) runOnce() bool {
+	job, err := r.queue.ClaimJob(context.Background(), r.workerID, r.types())
+	if err != nil {
+		if !errors.Is(err, store.ErrNotFound) {
+			r.logger.Printf("[JobRunner] claim job failed: %v", err)
+		}
+		return false
+	}
+	r.execute(job)
+	return true
+}
+
+func (r *jobRunner) execute(job *store.Job) {
+	ctx, cancel := context.WithCancel(r.ctx)
+	defer cancel()
+	var cancelled atomic.Bool
+	progress := newJobReporter(job, r.publish)
+	hbDone := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(r.heartbeat)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-hbDone:
+				return
+			case <-ticker.C:
+				requested, err := r.queue.HeartbeatJob(context.Background(), job.ID, r.workerID, progress.pending())
+				if errors.Is(err, store.ErrNotFound) || requested {
+					// 任务已被取消或被回收给其他 worker
+					cancelled.Store(true)
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+
+	start := time.Now()
+	result, runErr := r.invoke(ctx, job, progress)
+	close(hbDone)
+
+	var (
+		status  = store.JobSucceeded
+		errText string
+		retryAt time.Time
+		payload json.RawMessage
+	)
+	switch {
+	case cancelled.Load():
+		status, errText = store.JobCancelled, "cancelled"
+	case runErr != nil && r.ctx.Err() != nil:
+		// 进程退出导致的中止不计入尝试次数
+		if err := r.queue.ReleaseJob(context.Background(), job.ID, r.workerID); err != nil {
+			r.logger.Printf("[JobRunner] release job %d failed: %v", job.ID, err)
+		}
+		return
+	case runErr != nil && job.Attempts < job.MaxAttempts:
+		status, errText, retryAt = store.JobPending, runErr.Error(), time.Now().Add(jobRetryDelay(job.Attempts))
+	case runErr != nil:
+		status, errText = store.JobFailed, runErr.Error()
+	case result != nil:
+		b, err := json.Marshal(result)
+		if err != nil {
+			status, errText = store.JobFailed, fmt.Sprintf("encode result: %v", err)
+		} else {
+			payload = b
+		}
+	}
+	final := progress.finish(status, errText)
+	if err := r.queue.FinishJob(context.Background(), job.ID, r.workerID, status, payload, final, errText, retryAt); err != nil && !errors.Is(err, store.ErrNotFound) {
+		r.logger.Printf("[JobRunner] save job %d failed: %v", job.ID, err)
+	}
+	if runErr != nil {
+		r.logger.Printf("[JobRunner] job %d (%s) attempt %d/%d -> %s after %v: %v",
+			job.ID, job.Type, job.Attempts, job.MaxAttempts, status, time.Since(start).Round(time.Millisecond), runErr)
+	}
+}
+
+// invoke 调用处理函数，panic 视为本次执行失败。
+func (r *jobRunner) invoke(ctx context.Context, job *store.Job, progress *jobReporter) (result any, err error) {
+	h := r.handler(job.Type)
+	if h == nil {
+		return nil, fmt.Errorf("unknown job type %q", job.Type)
+	}
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = fmt.Errorf("panic: %v", rec)
+		}
+	}()
+	return h(ctx, job, progress)
+}
+
+// jobRetryDelay 第 n 次失败后的退避时间：30s 起按 2 倍增长，最长 30 分钟。
+func jobRetryDelay(attempt int) time.Duration {
+	d := jobRetryBaseDelay
+	for i := 1; i < attempt && d < jobRetryMaxDelay; i++ {
+		d *= 2
+	}
+	if d > jobRetryMaxDelay {
+		d = jobRetryMaxDelay
+	}
+	return d
+}
+
+// enqueueJob 将已注册类型的任务写入队列，maxAttempts 为总执行次数（含首次）。
+func (p *Server) enqueueJob(ctx context.Context, typ, accountID, actor string, payload any, maxAttempts int) (*store.Job, error) {
+	if p.jobs == nil {
+		return nil, errors.New("job queue not enabled")
+	}
+	if p.jobs.handler(typ) == nil {
+		return nil, fmt.Errorf("unknown job type %q", typ)
+	}
+	if maxAttempts > jobMaxAttemptsLimit {
+		maxAttempts = jobMaxAttemptsLimit
+	}
+	job := &store.Job{Type: typ, AccountID: accountID, CreatedBy: actor, MaxAttempts: maxAttempts}
+	if payload != nil {
+		b, err := json.Marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+		job.Payload = b
+	}
+	if err := p.jobs.queue.EnqueueJob(ctx, job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// builtinJobHandlers 内置任务类型的处理函数。
+func (p *Server) builtinJobHandlers() map[string]jobHandler {
+	return map[string]jobHandler{
+		jobTypeAccountExport: p.accountExportJob,
+		jobTypeAccountPurge:  p.accountPurgeJob,
+		jobTypeNodeBenchmark: p.nodeBenchmarkJob,
+		jobTypeABComparison:  p.abComparisonJob,
+	}
+}
+
+// localJobSeq 未进入队列、在本进程内执行的任务编号，与队列任务按 type 区分。
+var localJobSeq atomic.Int64
+
+// newLocalJob 生成本进程内执行的任务描述，用于进度推送。
+func newLocalJob(typ, accountID, actor string) *store.Job {
+	return &store.Job{ID: localJobSeq.Add(1), Type: typ, AccountID: accountID, CreatedBy: actor, Attempts: 1, MaxAttempts: 1}
+}
+
+// submitJob 有任务队列时入队，由 worker 执行；未启用存储时没有队列，直接在本进程内异步执行同一处理函数
+// （不持久化、不重试，进度照常推送）。返回任务编号。
+func (p *Server) submitJob(ctx context.Context, typ, accountID, actor string, payload any, maxAttempts int) (int64, error) {
+	if p.jobs != nil {
+		job, err := p.enqueueJob(ctx, typ, accountID, actor, payload, maxAttempts)
+		if err != nil {
+			return 0, err
+		}
+		return job.ID, nil
+	}
+	h := p.builtinJobHandlers()[typ]
+	if h == nil {
+		return 0, fmt.Errorf("unknown job type %q", typ)
+	}
+	job := newLocalJob(typ, accountID, actor)
+	if payload != nil {
+		b, err := json.Marshal(payload)
+		if err != nil {
+			return 0, err
+		}
+		job.Payload = b
+	}
+	go func() {
+		progress := newJobReporter(job, p.broadcastJobProgress)
+		status, errText := store.JobSucceeded, ""
+		defer func() {
+			if rec := recover(); rec != nil {
+				status, errText = store.JobFailed, fmt.Sprintf("panic: %v", rec)
+			}
+			if errText != "" {
+				p.logger.Printf("job %s (%d) failed: %s", job.Type, job.ID, errText)
+			}
+			progress.finish(status, errText)
+		}()
+		if _, err := h(context.Background(), job, progress); err != nil {
+			status, errText = store.JobFailed, err.Error()
+		}
+	}()
+	return job.ID, nil
+}
+
+// hasActiveJob 账号下是否有待执行或运行中的指定类型任务，用于同一账号同时只运行一个任务。
+func (p *Server) hasActiveJob(ctx context.Context, typ, accountID string) (bool, error) {
+	if p.jobs == nil {
+		return false, nil
+	}
+	for _, status := range []string{store.JobPending, store.JobRunning} {
+		jobs, err := p.jobs.queue.ListJobs(ctx, store.JobFilter{AccountID: accountID, Type: typ, Status: status, Limit: 1})
+		if err != nil {
+			return false, err
+		}
+		if len(jobs) > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,297 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"time"
+
+	"qcc_plus/internal/store"
+)
+
+const accountKeySettingKey = "account.key_lifecycle"
+
+const (
+	maxKeyOrigins       = 20          // 每个密钥保留的来源 IP 数
+	keyUsagePersistEach = time.Minute // 使用记录最短持久化间隔，避免每个请求都写库
+)
+
+// 代理密钥停用原因。
+const (
+	keyDisabledExpired  = "expired"  // 超过过期时间
+	keyDisabledInactive = "inactive" // 超过闲置天数未使用
+	keyDisabledManual   = "manual"   // 管理员手动停用
+)
+
+// KeyLifecycle 代理密钥的过期配置与使用记录，持久化为账号级配置 account.key_lifecycle。
+type KeyLifecycle struct {
+	ExpiresAt         *time.Time  `json:"expires_at,omitempty"`          // 过期时间，为空表示不过期
+	InactiveDays      int         `json:"inactive_days"`                 // 连续闲置天数达到后自动停用，0 表示不限制
+	IssuedAt          *time.Time  `json:"issued_at,omitempty"`           // 密钥签发或重新启用时间，闲置计算的起点
+	LastUsedAt        *time.Time  `json:"last_used_at,omitempty"`        // 最近一次代理请求时间
+	Origins           []KeyOrigin `json:"origins,omitempty"`             // 最近使用的来源 IP
+	DisabledAt        *time.Time  `json:"disabled_at,omitempty"`         // 停用时间
+	DisabledReason    string      `json:"disabled_reason,omitempty"`     // 停用原因：expired/inactive/manual
+	AllowNodeOverride bool        `json:"allow_node_override,omitempty"` // 允许使用该密钥的请求通过 X-QCC-Node 强制指定节点
+}
+
+// KeyOrigin 密钥的一个来源 IP。
+type KeyOrigin struct {
+	IP       string    `json:"ip"`
+	LastSeen time.Time `json:"last_seen"`
+	Requests int64     `json:"requests"`
+}
+
+// disableReason 返回密钥在 now 时应停用的原因，可用时返回空字符串。
+func (k KeyLifecycle) disableReason(now time.Time) string {
+	if k.DisabledAt != nil {
+		return k.DisabledReason
+	}
+	if k.ExpiresAt != nil && !now.Before(*k.ExpiresAt) {
+		return keyDisabledExpired
+	}
+	if k.InactiveDays > 0 {
+		since := k.LastUsedAt
+		if since == nil {
+			since = k.IssuedAt
+		}
+		if since != nil && now.Sub(*since) >= time.Duration(k.InactiveDays)*24*time.Hour {
+			return keyDisabledInactive
+		}
+	}
+	return ""
+}
+
+func (k KeyLifecycle) status(now time.Time) string {
+	if reason := k.disableReason(now); reason != "" {
+		return "disabled"
+	}
+	return "active"
+}
+
+// touch 记录一次来自 ip 的使用，来源超过上限时淘汰最久未见的。
+func (k *KeyLifecycle) touch(ip string, now time.Time) {
+	k.LastUsedAt = &now
+	if ip == "" {
+		return
+	}
+	for i := range k.Origins {
+		if k.Origins[i].IP == ip {
+			k.Origins[i].LastSeen = now
+			k.Origins[i].Requests++
+			return
+		}
+	}
+	k.Origins = append(k.Origins, KeyOrigin{IP: ip, LastSeen: now, Requests: 1})
+	if len(k.Origins) > maxKeyOrigins {
+		sort.Slice(k.Origins, func(i, j int) bool { return k.Origins[i].LastSeen.After(k.Origins[j].LastSeen) })
+		k.Origins = k.Origins[:maxKeyOrigins]
+	}
+}
+
+// resetUsage 在密钥轮换后清空使用记录与停用状态；过期时间针对旧密钥，一并清除，
+// 闲置天数与节点指定权限属于密钥配置，沿用到新密钥。
+func (k *KeyLifecycle) resetUsage(now time.Time) {
+	*k = KeyLifecycle{InactiveDays: k.InactiveDays, AllowNodeOverride: k.AllowNodeOverride, IssuedAt: &now}
+}
+
+func (k KeyLifecycle) clone() KeyLifecycle {
+	out := k
+	out.Origins = append([]KeyOrigin(nil), k.Origins...)
+	return out
+}
+
+// accountKey 返回账号密钥生命周期副本。
+func (p *Server) accountKey(acc *Account) KeyLifecycle {
+	if acc == nil {
+		return KeyLifecycle{}
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return acc.Key.clone()
+}
+
+// loadAccountKey 从配置表读取密钥生命周期，不存在时返回零值。
+func (p *Server) loadAccountKey(accountID string) KeyLifecycle {
+	var key KeyLifecycle
+	if p.store == nil {
+		return key
+	}
+	setting, err := p.store.GetSetting(accountKeySettingKey, "account", accountID)
+	if err != nil || setting == nil {
+		return key
+	}
+	if b, err := json.Marshal(setting.Value); err == nil {
+		_ = json.Unmarshal(b, &key)
+	}
+	return key
+}
+
+// persistAccountKey 保存密钥生命周期。
+func (p *Server) persistAccountKey(accountID string, key KeyLifecycle, updatedBy string) error {
+	if p.store == nil {
+		return nil
+	}
+	id := accountID
+	desc := "代理密钥过期配置与使用记录"
+	setting := &store.Setting{
+		Key:         accountKeySettingKey,
+		Scope:       "account",
+		AccountID:   &id,
+		Value:       key,
+		DataType:    "object",
+		Category:    "security",
+		Description: &desc,
+	}
+	if updatedBy != "" {
+		setting.UpdatedBy = &updatedBy
+	}
+	return p.store.UpsertSetting(setting)
+}
+
+// checkProxyKey 校验代理密钥是否仍可用并记录使用情况；密钥已停用时写出 401 并返回 true。
+// 过期或闲置超限的密钥在首次被拒时标记为停用并记录审计事件，之后需管理员重新启用或轮换密钥。
+func (p *Server) checkProxyKey(w http.ResponseWriter, r *http.Request, acc *Account) bool {
+	now := time.Now().UTC()
+	ip := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
+
+	p.mu.Lock()
+	key := &acc.Key
+	reason := key.disableReason(now)
+	newlyDisabled := reason != "" && key.DisabledAt == nil
+	if newlyDisabled {
+		key.DisabledAt, key.DisabledReason = &now, reason
+	}
+	persist := newlyDisabled
+	if reason == "" {
+		key.touch(ip, now)
+		persist = now.Sub(acc.keyPersistedAt) >= keyUsagePersistEach
+	}
+	if persist {
+		acc.keyPersistedAt = now
+	}
+	snapshot := key.clone()
+	p.mu.Unlock()
+
+	if persist {
+		go func() {
+			if err := p.persistAccountKey(acc.ID, snapshot, ""); err != nil {
+				p.logger.Printf("persist key usage for account %s failed: %v", acc.ID, err)
+			}
+		}()
+	}
+	if reason == "" {
+		return false
+	}
+	if newlyDisabled {
+		p.audit(acc.ID, auditActorSystem, "account.key.disabled", acc.ID, map[string]interface{}{
+			"reason":       reason,
+			"last_used_at": snapshot.LastUsedAt,
+			"expires_at":   snapshot.ExpiresAt,
+			"ip":           ip,
+		})
+	}
+	p.logger.Printf("reject %s %s: proxy key disabled (%s, account=%s)", r.Method, r.URL.Path, reason, acc.ID)
+	writeProxyError(w, http.StatusUnauthorized, "key_disabled",
+		fmt.Sprintf("this key has been disabled (%s)", reason), map[string]any{"reason": reason})
+	return true
+}
+
+func keyLifecycleView(acc *Account, key KeyLifecycle, now time.Time) map[string]interface{} {
+	reason := key.disableReason(now)
+	return map[string]interface{}{
+		"account_id":          acc.ID,
+		"status":              key.status(now),
+		"disabled_reason":     reason,
+		"disabled_at":         key.DisabledAt,
+		"expires_at":          key.ExpiresAt,
+		"inactive_days":       key.InactiveDays,
+		"issued_at":           key.IssuedAt,
+		"last_used_at":        key.LastUsedAt,
+		"origins":             key.Origins,
+		"allow_node_override": key.AllowNodeOverride,
+	}
+}
+
+// GET/PUT /admin/api/accounts/key?account_id=
+// 查看密钥使用记录与过期配置；PUT 仅管理员可用，可设置过期时间、闲置天数、节点指定权限或启停密钥。
+func (p *Server) handleAccountKey(w http.ResponseWriter, r *http.Request) {
+	caller := accountFromCtx(r)
+	if caller == nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		return
+	}
+	id := chooseNonEmpty(r.URL.Query().Get("account_id"), caller.ID)
+	if !canManageAccount(r.Context(), id) {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+		return
+	}
+	acc := p.getAccountByID(id)
+	if acc == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "account not found"})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, keyLifecycleView(acc, p.accountKey(acc), time.Now().UTC()))
+	case http.MethodPut:
+		if !isAdmin(r.Context()) {
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+			return
+		}
+		var req struct {
+			ExpiresAt         *time.Time `json:"expires_at"`
+			InactiveDays      *int       `json:"inactive_days"`
+			Enabled           *bool      `json:"enabled"`
+			AllowNodeOverride *bool      `json:"allow_node_override"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
+			return
+		}
+		if req.InactiveDays != nil && *req.InactiveDays < 0 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "inactive_days must be non-negative"})
+			return
+		}
+		now := time.Now().UTC()
+		p.mu.Lock()
+		key := &acc.Key
+		// expires_at 总是整体替换，省略即表示不过期。
+		key.ExpiresAt = req.ExpiresAt
+		if req.InactiveDays != nil {
+			key.InactiveDays = *req.InactiveDays
+		}
+		if req.AllowNodeOverride != nil {
+			key.AllowNodeOverride = *req.AllowNodeOverride
+		}
+		if key.IssuedAt == nil {
+			key.IssuedAt = &now
+		}
+		if req.Enabled != nil {
+			if *req.Enabled {
+				// 重新启用时重置闲置计时，避免立即再次因闲置被停用。
+				key.DisabledAt, key.DisabledReason = nil, ""
+				key.IssuedAt, key.LastUsedAt = &now, nil
+			} else if key.DisabledAt == nil {
+				key.DisabledAt, key.DisabledReason = &now, keyDisabledManual
+			}
+		}
+		snapshot := key.clone()
+		acc.keyPersistedAt = now
+		p.mu.Unlock()
+		if err := p.persistAccountKey(acc.ID, snapshot, caller.ID); err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		p.audit(acc.ID, auditActor(r), "account.key.update", acc.ID, req)
+		writeJSON(w, http.StatusOK, keyLifecycleView(acc, snapshot, now))
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
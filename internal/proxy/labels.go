@@ -0,0 +1,92 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"qcc_plus/internal/timeutil"
+)
+
+// labelHeader 客户端用于归因用量的团队/项目标签。
+const (
+	labelHeader    = "X-QCC-Label"
+	maxLabelLength = 64
+)
+
+// requestDims 描述一次请求在指标中的附加维度。
+type requestDims struct {
+	label      string
+	model      string
+	keyID      string
+	errorClass string // 请求完成后填充的失败分类
+}
+
+// resolveLabel 校验请求携带的标签是否在账号白名单内；未携带标签时返回空串。
+func (p *Server) resolveLabel(acc *Account, r *http.Request) (string, error) {
+	label := strings.TrimSpace(r.Header.Get(labelHeader))
+	if label == "" {
+		return "", nil
+	}
+	if len(label) > maxLabelLength {
+		return "", fmt.Errorf("label exceeds %d characters", maxLabelLength)
+	}
+	for _, allowed := range p.accountPolicy(acc).AllowedLabels {
+		if label == allowed {
+			return label, nil
+		}
+	}
+	return "", fmt.Errorf("label %q is not in the allowlist for this key", label)
+}
+
+// GET /api/usage/labels?account_id=&from=&to=
+func (p *Server) handleLabelUsage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if p.store == nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "store not enabled"})
+		return
+	}
+	caller := accountFromCtx(r)
+	if caller == nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		return
+	}
+	q := r.URL.Query()
+	accountID := chooseNonEmpty(q.Get("account_id"), caller.ID)
+	if !canManageAccount(r.Context(), accountID) {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+		return
+	}
+	from, to, err := parseTimeRange(q.Get("from"), q.Get("to"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	usage, err := p.store.UsageByLabel(r.Context(), accountID, from, to)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	items := make([]map[string]interface{}, 0, len(usage))
+	for _, u := range usage {
+		items = append(items, map[string]interface{}{
+			"label":           chooseNonEmpty(u.Label, "(unlabeled)"),
+			"requests_total":  u.RequestsTotal,
+			"requests_failed": u.RequestsFailed,
+			"input_tokens":    u.InputTokensTotal,
+			"output_tokens":   u.OutputTokensTotal,
+			"bytes_total":     u.BytesTotal,
+		})
+	}
+	resp := map[string]interface{}{"account_id": accountID, "labels": items}
+	if !from.IsZero() {
+		resp["from"] = timeutil.FormatBeijingTime(from)
+	}
+	if !to.IsZero() {
+		resp["to"] = timeutil.FormatBeijingTime(to)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
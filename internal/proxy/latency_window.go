@@ -0,0 +1,72 @@
+package proxy
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const latencyWindowSize = 200
+
+type latencySample struct {
+	dur time.Duration
+	ok  bool
+}
+
+// latencyWindow 保存节点最近 N 次请求的耗时与结果，用于计算 p95 与错误率。
+type latencyWindow struct {
+	mu      sync.Mutex
+	samples [latencyWindowSize]latencySample
+	next    int
+	count   int
+}
+
+func (w *latencyWindow) add(d time.Duration, ok bool) {
+	w.mu.Lock()
+	w.samples[w.next] = latencySample{dur: d, ok: ok}
+	w.next = (w.next + 1) % latencyWindowSize
+	if w.count < latencyWindowSize {
+		w.count++
+	}
+	w.mu.Unlock()
+}
+
+// stats 返回样本数、p95 耗时（仅统计成功请求）与错误率。
+func (w *latencyWindow) stats() (int, time.Duration, float64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.count == 0 {
+		return 0, 0, 0
+	}
+	durs := make([]time.Duration, 0, w.count)
+	failed := 0
+	for i := 0; i < w.count; i++ {
+		s := w.samples[i]
+		if !s.ok {
+			failed++
+			continue
+		}
+		durs = append(durs, s.dur)
+	}
+	var p95 time.Duration
+	if len(durs) > 0 {
+		sort.Slice(durs, func(i, j int) bool { return durs[i] < durs[j] })
+		p95 = percentile(durs, 95)
+	}
+	return w.count, p95, float64(failed) / float64(w.count)
+}
+
+// recordLatency 记录节点一次请求的耗时。
+func (p *Server) recordLatency(nodeID string, d time.Duration, ok bool) {
+	v, _ := p.latency.LoadOrStore(nodeID, &latencyWindow{})
+	v.(*latencyWindow).add(d, ok)
+}
+
+// nodeLatencyStats 返回节点近期的样本数、p95 与错误率。
+func (p *Server) nodeLatencyStats(nodeID string) (int, time.Duration, float64) {
+	v, ok := p.latency.Load(nodeID)
+	if !ok {
+		return 0, 0, 0
+	}
+	return v.(*latencyWindow).stats()
+}
@@ -0,0 +1,57 @@
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+const (
+	unixSocketPrefix      = "unix:"
+	defaultUnixSocketMode = os.FileMode(0o660)
+)
+
+// unixSocketPath 解析 unix:/path/to/qcc.sock 形式的监听地址。
+func unixSocketPath(addr string) (string, bool) {
+	if !strings.HasPrefix(addr, unixSocketPrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(addr, unixSocketPrefix), true
+}
+
+// listen 创建监听：unix: 前缀的地址监听 unix socket 并设置文件权限，其余按 TCP 地址处理。
+func (p *Server) listen(addr string) (net.Listener, error) {
+	path, ok := unixSocketPath(addr)
+	if !ok {
+		if addr == "" {
+			addr = ":http"
+		}
+		return net.Listen("tcp", addr)
+	}
+	if path == "" {
+		return nil, fmt.Errorf("empty unix socket path in %q", addr)
+	}
+	// 清理上次异常退出遗留的 socket 文件，普通文件不删除以免误删。
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("unix socket path %s exists and is not a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("remove stale unix socket %s: %w", path, err)
+		}
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	mode := p.unixSocketMode
+	if mode == 0 {
+		mode = defaultUnixSocketMode
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		ln.Close()
+		return nil, fmt.Errorf("chmod unix socket %s: %w", path, err)
+	}
+	return ln, nil
+}
@@ -0,0 +1,111 @@
+package proxy
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultMaintenanceMessage = "service is under maintenance, please retry later"
+
+// maintenanceWindow 维护模式配置：开启后在 [StartAt, EndAt) 内生效，未设置的一端不限制。
+type maintenanceWindow struct {
+	Enabled bool
+	Message string
+	StartAt time.Time
+	EndAt   time.Time
+}
+
+func (p *Server) maintenanceWindow() maintenanceWindow {
+	mw := maintenanceWindow{Message: defaultMaintenanceMessage}
+	if p.settingsCache == nil {
+		return mw
+	}
+	mw.Enabled = p.settingsCache.GetBool("maintenance.enabled", false)
+	if msg := strings.TrimSpace(p.settingsCache.GetString("maintenance.message", "")); msg != "" {
+		mw.Message = msg
+	}
+	if t, err := time.Parse(time.RFC3339, p.settingsCache.GetString("maintenance.start_at", "")); err == nil {
+		mw.StartAt = t
+	}
+	if t, err := time.Parse(time.RFC3339, p.settingsCache.GetString("maintenance.end_at", "")); err == nil {
+		mw.EndAt = t
+	}
+	return mw
+}
+
+// active 判断 now 时刻是否处于维护期。
+func (mw maintenanceWindow) active(now time.Time) bool {
+	if !mw.Enabled {
+		return false
+	}
+	if !mw.StartAt.IsZero() && now.Before(mw.StartAt) {
+		return false
+	}
+	return mw.EndAt.IsZero() || now.Before(mw.EndAt)
+}
+
+// maintenanceActive 当前是否处于维护模式，维护期间代理请求返回 503、定时任务暂停执行。
+func (p *Server) maintenanceActive() bool {
+	if p == nil {
+		return false
+	}
+	return p.maintenanceWindow().active(time.Now())
+}
+
+func (mw maintenanceWindow) view(now time.Time) map[string]interface{} {
+	v := map[string]interface{}{
+		"active":  mw.active(now),
+		"enabled": mw.Enabled,
+		"message": mw.Message,
+	}
+	if !mw.StartAt.IsZero() {
+		v["start_at"] = mw.StartAt
+	}
+	if !mw.EndAt.IsZero() {
+		v["end_at"] = mw.EndAt
+	}
+	return v
+}
+
+// rejectForMaintenance 维护期间拒绝代理请求，返回 true 表示已写出 503 响应；管理面不受影响。
+func (p *Server) rejectForMaintenance(w http.ResponseWriter) bool {
+	now := time.Now()
+	mw := p.maintenanceWindow()
+	if !mw.active(now) {
+		return false
+	}
+	extra := map[string]any{}
+	if !mw.EndAt.IsZero() {
+		retry := int(mw.EndAt.Sub(now).Seconds()) + 1
+		w.Header().Set("Retry-After", strconv.Itoa(retry))
+		extra["end_at"] = mw.EndAt
+	}
+	writeProxyError(w, http.StatusServiceUnavailable, "maintenance", mw.Message, extra)
+	return true
+}
+
+// checkMaintenance 检测维护状态的切换（含到达计划的开始/结束时间），切换时向所有账号的 WebSocket 连接推送 maintenance 事件。
+func (p *Server) checkMaintenance(now time.Time) {
+	mw := p.maintenanceWindow()
+	active := mw.active(now)
+	if p.maintenanceOn.Swap(active) == active {
+		return
+	}
+	if active {
+		p.logger.Printf("maintenance mode started: %s", mw.Message)
+	} else {
+		p.logger.Printf("maintenance mode ended")
+	}
+	payload := mw.view(now)
+	p.mu.RLock()
+	ids := make([]string, 0, len(p.accountByID))
+	for id := range p.accountByID {
+		ids = append(ids, id)
+	}
+	p.mu.RUnlock()
+	for _, id := range ids {
+		p.wsHub.Broadcast(id, "maintenance", payload)
+	}
+}
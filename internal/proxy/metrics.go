@@ -8,7 +8,6 @@ import (
 	"time"
 
 	"qcc_plus/internal/store"
-	"qcc_plus/internal/timeutil"
 )
 
 type metricsWriter struct {
@@ -40,7 +39,7 @@ func (mw *metricsWriter) Write(b []byte) (int, error) {
 	return mw.ResponseWriter.Write(b)
 }
 
-func (p *Server) recordMetrics(nodeID string, start time.Time, mw *metricsWriter, u *usage) {
+func (p *Server) recordMetrics(nodeID string, start time.Time, mw *metricsWriter, u *usage, dims requestDims) {
 	end := time.Now()
 	var (
 		nodeRec      store.NodeRecord
@@ -88,7 +87,12 @@ func (p *Server) recordMetrics(nodeID string, start time.Time, mw *metricsWriter
 		node.Metrics.FailCount++
 		node.Metrics.FailStreak++
 	}
+	var (
+		fromState    string
+		stateChanged bool
+	)
 	if mw != nil && mw.status == http.StatusOK {
+		fromState, stateChanged = setFaultState(node, NodeStateHealthy, end)
 		node.Metrics.FailStreak = 0
 		node.LastError = ""
 		node.Failed = false
@@ -99,6 +103,10 @@ func (p *Server) recordMetrics(nodeID string, start time.Time, mw *metricsWriter
 	if p.store != nil {
 		nodeRec = toRecord(node)
 		metricsRec = buildMetricsRecord(accountID, nodeID, start, end, mw, u)
+		metricsRec.Label = dims.label
+		metricsRec.Model = dims.model
+		metricsRec.KeyID = dims.keyID
+		metricsRec.ErrorClass = dims.errorClass
 	}
 	nodeName = node.Name
 	nodeIDCopy = node.ID
@@ -112,62 +120,55 @@ func (p *Server) recordMetrics(nodeID string, start time.Time, mw *metricsWriter
 	healthErr = node.Metrics.LastPingErr
 	healthAt = node.Metrics.LastHealthCheckAt
 	method = node.HealthCheckMethod
+	nodeStateNow := nodeState(node)
 	p.mu.Unlock()
+	if mw != nil {
+		p.recordLatency(nodeID, end.Sub(start), mw.status == http.StatusOK)
+	}
+	if stateChanged {
+		p.onNodeStateChange(nodeID, fromState, nodeStateNow)
+		if acc != nil && fromState != NodeStateHealthy {
+			p.maybePromoteRecovered(node)
+		}
+	}
 
 	if p.store != nil {
-		_ = p.store.UpsertNode(context.Background(), nodeRec)
-		if metricsRec != nil {
-			_ = p.store.InsertMetrics(context.Background(), *metricsRec)
+		if p.metricsFlusher.enabled() {
+			p.metricsFlusher.addNode(nodeID)
+			if metricsRec != nil {
+				p.metricsFlusher.add(*metricsRec)
+			}
+		} else {
+			_ = p.store.UpsertNode(context.Background(), nodeRec)
+			if metricsRec != nil {
+				_ = p.store.InsertMetrics(context.Background(), *metricsRec)
+			}
 		}
 	}
 
 	if p.wsHub != nil {
-		traffic := summarizeTraffic(metrics{
-			Requests:     requests,
-			StreamDur:    streamDur,
-			FirstByteDur: firstByteDur,
-			FailCount:    failCount,
-			LastPingMS:   lastPingMS,
-			LastPingErr:  healthErr,
-		})
 		healthInterval := p.healthEvery
 		if acc != nil && acc.Config.HealthEvery > 0 {
 			healthInterval = acc.Config.HealthEvery
 		}
-		health := summarizeHealth(metrics{
-			Requests:          requests,
-			StreamDur:         streamDur,
-			FirstByteDur:      firstByteDur,
-			FailCount:         failCount,
-			LastPingMS:        lastPingMS,
-			LastPingErr:       healthErr,
-			LastHealthCheckAt: healthAt,
-		}, method, healthInterval, time.Now())
-
-		status := "unknown"
-		if nodeDisabled {
-			status = "disabled"
-		} else if nodeFailed || health.Status == "down" {
-			status = "offline"
-		} else if health.Status == "stale" {
-			status = "degraded"
-		} else {
-			status = "online"
-		}
-
-		timestamp := timeutil.FormatBeijingTime(time.Now())
-		if health.LastCheckAt != nil {
-			timestamp = *health.LastCheckAt
-		}
-
-		p.wsHub.Broadcast(accountID, "node_metrics", map[string]interface{}{
-			"node_id":   nodeIDCopy,
-			"node_name": nodeName,
-			"status":    status,
-			"traffic":   traffic,
-			"health":    health,
-			"timestamp": timestamp,
-		})
+		payload := buildNodeMetrics(nodeMetricsInput{
+			ID:       nodeIDCopy,
+			Name:     nodeName,
+			State:    nodeStateNow,
+			Failed:   nodeFailed,
+			Disabled: nodeDisabled,
+			Method:   method,
+			Metrics: metrics{
+				Requests:          requests,
+				StreamDur:         streamDur,
+				FirstByteDur:      firstByteDur,
+				FailCount:         failCount,
+				LastPingMS:        lastPingMS,
+				LastPingErr:       healthErr,
+				LastHealthCheckAt: healthAt,
+			},
+		}, healthInterval, time.Now())
+		p.wsHub.Broadcast(accountID, "node_metrics", payload)
 	}
 }
 
@@ -197,6 +198,14 @@ func buildMetricsRecord(accountID, nodeID string, start, end time.Time, mw *metr
 	if u != nil {
 		rec.InputTokensTotal = u.input
 		rec.OutputTokensTotal = u.output
+		if u.hedged {
+			rec.HedgedTotal = 1
+			// 落败请求的用量无法获知，按相同提示词的输入 token 估算。
+			rec.HedgeWastedTokens = u.input
+			if u.hedgeWon {
+				rec.HedgeWinsTotal = 1
+			}
+		}
 	}
 	return rec
 }
@@ -0,0 +1,254 @@
+package proxy
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"qcc_plus/internal/store"
+)
+
+const (
+	defaultMetricsFlushInterval = 10 * time.Second
+	// maxPendingMetricsRows 待写入的指标行数上限：写入失败的行放回缓冲等待下次重试，
+	// 存储长时间不可用时超出上限的行被丢弃，避免内存无限增长。
+	maxPendingMetricsRows = 20000
+)
+
+// metricsBucketKey 累加维度：同一小时内相同节点、维度与失败分类的请求合并为一行。
+type metricsBucketKey struct {
+	accountID  string
+	nodeID     string
+	label      string
+	model      string
+	keyID      string
+	errorClass string
+	hour       int64
+}
+
+// MetricsFlusher 在内存中累加请求指标，按配置间隔批量写入 node_metrics_raw，显著降低写入量；
+// 节点累计统计（nodes 表）只记录有变化的节点，写入时读取节点的当前状态，已删除的节点不再写回。
+// metrics.flush_interval_sec 为 0 时退化为逐请求写入。
+type MetricsFlusher struct {
+	server   *Server
+	logger   *log.Logger
+	stopCh   chan struct{}
+	wg       sync.WaitGroup
+	stopOnce sync.Once
+
+	mu      sync.Mutex
+	pending map[metricsBucketKey]*store.MetricsRecord
+	nodes   map[string]struct{} // 统计有变化、待写入的节点
+	dropped int64               // 因超出 maxPendingMetricsRows 丢弃的行数
+}
+
+// NewMetricsFlusher 创建指标批量写入器。
+func NewMetricsFlusher(server *Server, logger *log.Logger) *MetricsFlusher {
+	if logger == nil {
+		logger = log.Default()
+	}
+	return &MetricsFlusher{
+		server:  server,
+		logger:  logger,
+		stopCh:  make(chan struct{}),
+		pending: make(map[metricsBucketKey]*store.MetricsRecord),
+		nodes:   make(map[string]struct{}),
+	}
+}
+
+func (f *MetricsFlusher) interval() time.Duration {
+	if f == nil {
+		return 0
+	}
+	if cache := f.server.settingsCache; cache != nil {
+		sec := cache.GetInt("metrics.flush_interval_sec", int(defaultMetricsFlushInterval/time.Second))
+		if sec <= 0 {
+			return 0
+		}
+		return time.Duration(sec) * time.Second
+	}
+	return defaultMetricsFlushInterval
+}
+
+// enabled 表示当前是否走批量写入。
+func (f *MetricsFlusher) enabled() bool {
+	return f != nil && f.server.store != nil && f.interval() > 0
+}
+
+// add 将单次请求的指标合并到待写入缓冲。
+func (f *MetricsFlusher) add(rec store.MetricsRecord) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.mergeLocked(rec)
+}
+
+// addNode 标记节点的累计统计有变化，随下次批量写入。
+func (f *MetricsFlusher) addNode(nodeID string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.nodes[nodeID] = struct{}{}
+}
+
+// mergeLocked 将一行指标累加到缓冲中同维度的行；缓冲已满且没有可合并的行时丢弃。
+func (f *MetricsFlusher) mergeLocked(rec store.MetricsRecord) {
+	key := metricsBucketKey{
+		accountID:  rec.AccountID,
+		nodeID:     rec.NodeID,
+		label:      rec.Label,
+		model:      rec.Model,
+		keyID:      rec.KeyID,
+		errorClass: rec.ErrorClass,
+		hour:       rec.Timestamp.Truncate(time.Hour).Unix(),
+	}
+	cur, ok := f.pending[key]
+	if !ok {
+		if len(f.pending) >= maxPendingMetricsRows {
+			f.dropped++
+			return
+		}
+		copied := rec
+		f.pending[key] = &copied
+		return
+	}
+	if rec.Timestamp.After(cur.Timestamp) {
+		cur.Timestamp = rec.Timestamp
+	}
+	cur.RequestsTotal += rec.RequestsTotal
+	cur.RequestsSuccess += rec.RequestsSuccess
+	cur.RequestsFailed += rec.RequestsFailed
+	cur.ResponseTimeSumMs += rec.ResponseTimeSumMs
+	cur.ResponseTimeCount += rec.ResponseTimeCount
+	cur.BytesTotal += rec.BytesTotal
+	cur.InputTokensTotal += rec.InputTokensTotal
+	cur.OutputTokensTotal += rec.OutputTokensTotal
+	cur.FirstByteTimeSumMs += rec.FirstByteTimeSumMs
+	cur.StreamDurationSumMs += rec.StreamDurationSumMs
+	cur.HedgedTotal += rec.HedgedTotal
+	cur.HedgeWinsTotal += rec.HedgeWinsTotal
+	cur.HedgeWastedTokens += rec.HedgeWastedTokens
+}
+
+// flush 写出所有缓冲的指标与节点统计，返回写入的指标行数。某行写入失败时视为存储不可用，
+// 停止本批写入，未写出的行放回缓冲（与期间新到的同维度数据合并）等待下次重试。
+func (f *MetricsFlusher) flush() int {
+	f.mu.Lock()
+	batch, nodes := f.pending, f.nodes
+	f.pending = make(map[metricsBucketKey]*store.MetricsRecord)
+	f.nodes = make(map[string]struct{})
+	f.mu.Unlock()
+	if f.server.store == nil || (len(batch) == 0 && len(nodes) == 0) {
+		return 0
+	}
+
+	var failedNodes []string
+	for id := range nodes {
+		f.server.mu.RLock()
+		node := f.server.nodeIndex[id]
+		var rec store.NodeRecord
+		if node != nil {
+			rec = toRecord(node)
+		}
+		f.server.mu.RUnlock()
+		if node == nil {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		err := f.server.store.UpsertNode(ctx, rec)
+		cancel()
+		if err != nil {
+			f.logger.Printf("[MetricsFlusher] upsert node %s failed: %v", id, err)
+			failedNodes = append(failedNodes, id)
+		}
+	}
+
+	written := 0
+	var failed []store.MetricsRecord
+	for _, rec := range batch {
+		if failed != nil {
+			failed = append(failed, *rec)
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		err := f.server.store.InsertMetrics(ctx, *rec)
+		cancel()
+		if err != nil {
+			f.logger.Printf("[MetricsFlusher] insert metrics for node %s failed, requeueing %d rows: %v", rec.NodeID, len(batch)-written, err)
+			failed = append(failed, *rec)
+			continue
+		}
+		written++
+	}
+
+	if len(failed) == 0 && len(failedNodes) == 0 {
+		return written
+	}
+	f.mu.Lock()
+	for _, id := range failedNodes {
+		f.nodes[id] = struct{}{}
+	}
+	before := f.dropped
+	for _, rec := range failed {
+		f.mergeLocked(rec)
+	}
+	dropped := f.dropped - before
+	f.mu.Unlock()
+	if dropped > 0 {
+		f.logger.Printf("[MetricsFlusher] pending buffer full (%d rows), dropped %d rows", maxPendingMetricsRows, dropped)
+	}
+	return written
+}
+
+// Start 启动定时写入循环。
+func (f *MetricsFlusher) Start() error {
+	if f == nil || f.server == nil {
+		return nil
+	}
+	f.wg.Add(1)
+	go f.loop()
+	return nil
+}
+
+// Stop 停止循环并写出剩余数据。
+func (f *MetricsFlusher) Stop() {
+	if f == nil {
+		return
+	}
+	f.stopOnce.Do(func() {
+		close(f.stopCh)
+		f.wg.Wait()
+		if n := f.flush(); n > 0 {
+			f.logger.Printf("[MetricsFlusher] flushed %d rows on shutdown", n)
+		}
+	})
+}
+
+func (f *MetricsFlusher) loop() {
+	defer f.wg.Done()
+	defer func() {
+		if r := recover(); r != nil {
+			f.logger.Printf("[MetricsFlusher] panic recovered: %v", r)
+		}
+	}()
+
+	next := f.interval()
+	if next <= 0 {
+		next = defaultMetricsFlushInterval
+	}
+	timer := time.NewTimer(next)
+	defer timer.Stop()
+	for {
+		select {
+		case <-f.stopCh:
+			return
+		case <-timer.C:
+			// 切换为逐请求写入时也要写出残留数据。
+			f.flush()
+			next = f.interval()
+			if next <= 0 {
+				next = defaultMetricsFlushInterval
+			}
+			timer.Reset(next)
+		}
+	}
+}
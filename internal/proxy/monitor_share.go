@@ -16,6 +16,11 @@ func generateShareToken() (string, error) {
 }
 
 func buildShareURL(r *http.Request, token string) string {
+	return requestBaseURL(r) + "/monitor/share/" + token
+}
+
+// requestBaseURL 根据请求推断对外访问的 scheme://host。
+func requestBaseURL(r *http.Request) string {
 	scheme := "http"
 	if r != nil {
 		if proto := r.Header.Get("X-Forwarded-Proto"); strings.EqualFold(proto, "https") {
@@ -28,5 +33,5 @@ func buildShareURL(r *http.Request, token string) string {
 	if r != nil {
 		host = r.Host
 	}
-	return scheme + "://" + host + "/monitor/share/" + token
+	return scheme + "://" + host
 }
@@ -0,0 +1,179 @@
+package proxy
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultLongPollTimeout = 25 * time.Second
+	maxLongPollTimeout     = 60 * time.Second
+)
+
+type nodeChange struct {
+	version   int64
+	accountID string
+	deleted   bool
+}
+
+// nodeChangeLog 记录节点状态变更版本，用于长轮询增量查询。
+type nodeChangeLog struct {
+	mu      sync.Mutex
+	version int64
+	changes map[string]nodeChange // nodeID -> 最近一次变更
+	wake    chan struct{}         // 每次变更时关闭并替换，唤醒等待者
+}
+
+func newNodeChangeLog() *nodeChangeLog {
+	return &nodeChangeLog{changes: make(map[string]nodeChange), wake: make(chan struct{})}
+}
+
+func (l *nodeChangeLog) mark(nodeID, accountID string, deleted bool) {
+	if l == nil || nodeID == "" {
+		return
+	}
+	l.mu.Lock()
+	l.version++
+	l.changes[nodeID] = nodeChange{version: l.version, accountID: accountID, deleted: deleted}
+	close(l.wake)
+	l.wake = make(chan struct{})
+	l.mu.Unlock()
+}
+
+// since 返回指定账号在 version 之后变更的节点，以及当前版本与等待通道。
+func (l *nodeChangeLog) since(accountID string, version int64) (changed []string, deleted []string, current int64, wait <-chan struct{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for id, c := range l.changes {
+		if c.version <= version || c.accountID != accountID {
+			continue
+		}
+		if c.deleted {
+			deleted = append(deleted, id)
+		} else {
+			changed = append(changed, id)
+		}
+	}
+	return changed, deleted, l.version, l.wake
+}
+
+// markNodeChanged 标记节点状态已变化（新增、更新、故障、恢复、启停、激活切换）。
+func (p *Server) markNodeChanged(nodeID string) {
+	if p == nil || p.nodeChanges == nil {
+		return
+	}
+	p.mu.RLock()
+	accountID := ""
+	if acc := p.nodeAccount[nodeID]; acc != nil {
+		accountID = acc.ID
+	} else if n := p.nodeIndex[nodeID]; n != nil {
+		accountID = n.AccountID
+	}
+	p.mu.RUnlock()
+	p.nodeChanges.mark(nodeID, accountID, false)
+}
+
+// GET /api/nodes/changes?since=<version>&timeout=<秒>
+// 无变更时最多阻塞 timeout 秒（默认 25，最大 60），仅返回状态变化过的节点。
+func (p *Server) handleNodeChanges(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	acc := accountFromCtx(r)
+	if acc == nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		return
+	}
+	if aid := r.URL.Query().Get("account_id"); aid != "" && aid != acc.ID {
+		if !isAdmin(r.Context()) {
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+			return
+		}
+		target := p.getAccountByID(aid)
+		if target == nil {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "account not found"})
+			return
+		}
+		acc = target
+	}
+
+	var since int64
+	if v := r.URL.Query().Get("since"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid since"})
+			return
+		}
+		since = n
+	}
+	timeout := defaultLongPollTimeout
+	if v := r.URL.Query().Get("timeout"); v != "" {
+		sec, err := strconv.Atoi(v)
+		if err != nil || sec < 0 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid timeout"})
+			return
+		}
+		timeout = time.Duration(sec) * time.Second
+		if timeout > maxLongPollTimeout {
+			timeout = maxLongPollTimeout
+		}
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		changed, deleted, current, wait := p.nodeChanges.since(acc.ID, since)
+		// since 为 0 或大于当前版本（服务重启）时返回全量，客户端据此重建状态。
+		if since == 0 || since > current {
+			writeJSON(w, http.StatusOK, map[string]interface{}{
+				"version": current,
+				"full":    true,
+				"nodes":   p.listNodes(acc),
+				"deleted": []string{},
+			})
+			return
+		}
+		if len(changed) > 0 || len(deleted) > 0 {
+			writeJSON(w, http.StatusOK, map[string]interface{}{
+				"version": current,
+				"full":    false,
+				"nodes":   p.filterNodeViews(acc, changed),
+				"deleted": deleted,
+			})
+			return
+		}
+		select {
+		case <-wait:
+		case <-timer.C:
+			writeJSON(w, http.StatusOK, map[string]interface{}{
+				"version": current,
+				"full":    false,
+				"nodes":   []map[string]interface{}{},
+				"deleted": []string{},
+			})
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// filterNodeViews 复用节点列表视图，只保留指定节点。
+func (p *Server) filterNodeViews(acc *Account, ids []string) []map[string]interface{} {
+	want := make(map[string]struct{}, len(ids))
+	for _, id := range ids {
+		want[id] = struct{}{}
+	}
+	out := make([]map[string]interface{}, 0, len(ids))
+	for _, view := range p.listNodes(acc) {
+		if id, _ := view["id"].(string); id != "" {
+			if _, ok := want[id]; ok {
+				out = append(out, view)
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,350 @@
+package proxy
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"qcc_plus/internal/notify"
+	"qcc_plus/internal/store"
+	"qcc_plus/internal/timeutil"
+)
+
+const (
+	maxClientCertPEMBytes      = 64 * 1024
+	defaultCertExpiryWarnDays  = 14
+	clientCertCheckInterval    = time.Hour
+	clientCertRenotifyInterval = 24 * time.Hour
+)
+
+// nodeClientCert 节点 mTLS 客户端证书的展示信息，证书与私钥本身只保存在传输层与加密的存储中。
+type nodeClientCert struct {
+	Subject     string    `json:"subject"`
+	Issuer      string    `json:"issuer"`
+	Fingerprint string    `json:"fingerprint"` // 证书 DER 的 SHA-256
+	NotAfter    time.Time `json:"not_after"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	UpdatedBy   string    `json:"updated_by,omitempty"`
+}
+
+func (c *nodeClientCert) view(now time.Time) map[string]interface{} {
+	return map[string]interface{}{
+		"subject":     c.Subject,
+		"issuer":      c.Issuer,
+		"fingerprint": c.Fingerprint,
+		"not_after":   c.NotAfter,
+		"days_left":   int(c.NotAfter.Sub(now).Hours() / 24),
+		"expired":     !now.Before(c.NotAfter),
+		"updated_at":  c.UpdatedAt,
+		"updated_by":  c.UpdatedBy,
+	}
+}
+
+// clientCertBundle 加密落库的证书与私钥。
+type clientCertBundle struct {
+	CertPEM string `json:"cert_pem"`
+	KeyPEM  string `json:"key_pem"`
+}
+
+// parseClientCert 校验证书与私钥是否匹配，返回 TLS 证书与展示信息；已过期的证书直接拒绝。
+func parseClientCert(b clientCertBundle, now time.Time) (tls.Certificate, *nodeClientCert, error) {
+	if len(b.CertPEM) > maxClientCertPEMBytes || len(b.KeyPEM) > maxClientCertPEMBytes {
+		return tls.Certificate{}, nil, errors.New("certificate or key too large")
+	}
+	cert, err := tls.X509KeyPair([]byte(b.CertPEM), []byte(b.KeyPEM))
+	if err != nil {
+		return tls.Certificate{}, nil, fmt.Errorf("invalid certificate/key pair: %v", err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return tls.Certificate{}, nil, fmt.Errorf("invalid certificate: %v", err)
+	}
+	if !now.Before(leaf.NotAfter) {
+		return tls.Certificate{}, nil, fmt.Errorf("certificate expired at %s", leaf.NotAfter.UTC().Format(time.RFC3339))
+	}
+	cert.Leaf = leaf
+	sum := sha256.Sum256(leaf.Raw)
+	return cert, &nodeClientCert{
+		Subject:     leaf.Subject.String(),
+		Issuer:      leaf.Issuer.String(),
+		Fingerprint: hex.EncodeToString(sum[:]),
+		NotAfter:    leaf.NotAfter.UTC(),
+	}, nil
+}
+
+// loadNodeClientCerts 启动时解密并安装账号下节点的客户端证书。
+func (p *Server) loadNodeClientCerts(acc *Account) {
+	if p.store == nil {
+		return
+	}
+	recs, err := p.store.ListNodeClientCerts(context.Background(), acc.ID)
+	if err != nil {
+		p.logger.Printf("load client certs for account %s failed: %v", acc.ID, err)
+		return
+	}
+	for _, rec := range recs {
+		n := acc.Nodes[rec.NodeID]
+		if n == nil {
+			continue
+		}
+		plain, err := p.secrets.open(rec.Bundle)
+		var bundle clientCertBundle
+		if err == nil {
+			err = json.Unmarshal(plain, &bundle)
+		}
+		var cert tls.Certificate
+		if err == nil {
+			// 已过期的证书仍然安装，由上游拒绝握手并触发告警，而不是静默退回无证书连接。
+			cert, err = tls.X509KeyPair([]byte(bundle.CertPEM), []byte(bundle.KeyPEM))
+		}
+		if err != nil {
+			p.logger.Printf("client cert for node %s ignored: %v", n.Name, err)
+			continue
+		}
+		p.nodeTLS.setClientCert(n.ID, n.URL.Host, &cert)
+		n.ClientCert = &nodeClientCert{
+			Subject:     rec.Subject,
+			Issuer:      rec.Issuer,
+			Fingerprint: rec.Fingerprint,
+			NotAfter:    rec.NotAfter.UTC(),
+			UpdatedAt:   rec.UpdatedAt,
+			UpdatedBy:   rec.UpdatedBy,
+		}
+	}
+}
+
+// GET    /api/nodes/:id/client-cert 查看证书信息（不返回证书与私钥）
+// PUT    /api/nodes/:id/client-cert {"cert_pem":"...","key_pem":"..."}
+// DELETE /api/nodes/:id/client-cert
+func (p *Server) handleNodeClientCert(w http.ResponseWriter, r *http.Request) {
+	caller := accountFromCtx(r)
+	if caller == nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		return
+	}
+	snapshot, ok := p.benchmarkNodeForCaller(w, r, caller, "/client-cert")
+	if !ok {
+		return
+	}
+	now := time.Now()
+	switch r.Method {
+	case http.MethodGet:
+		var cert interface{}
+		p.mu.RLock()
+		if n := p.nodeIndex[snapshot.ID]; n != nil && n.ClientCert != nil {
+			cert = n.ClientCert.view(now)
+		}
+		p.mu.RUnlock()
+		writeJSON(w, http.StatusOK, map[string]interface{}{"node_id": snapshot.ID, "client_cert": cert})
+	case http.MethodPut:
+		var req clientCertBundle
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4*maxClientCertPEMBytes)).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
+			return
+		}
+		if snapshot.URL == nil || snapshot.URL.Scheme != "https" {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "client certificates require an https base_url"})
+			return
+		}
+		cert, meta, err := parseClientCert(req, now)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		actor := auditActor(r)
+		meta.UpdatedAt, meta.UpdatedBy = now.UTC(), actor
+		if p.store != nil {
+			plain, _ := json.Marshal(req)
+			sealed, err := p.secrets.seal(plain)
+			if err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "cannot store client certificate: " + err.Error()})
+				return
+			}
+			if err := p.store.SaveNodeClientCert(r.Context(), store.NodeClientCertRecord{
+				NodeID:      snapshot.ID,
+				AccountID:   snapshot.AccountID,
+				Bundle:      sealed,
+				Subject:     meta.Subject,
+				Issuer:      meta.Issuer,
+				Fingerprint: meta.Fingerprint,
+				NotAfter:    meta.NotAfter,
+				UpdatedBy:   actor,
+				UpdatedAt:   meta.UpdatedAt,
+			}); err != nil {
+				writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+				return
+			}
+		}
+		p.nodeTLS.setClientCert(snapshot.ID, snapshot.URL.Host, &cert)
+		p.mu.Lock()
+		if n := p.nodeIndex[snapshot.ID]; n != nil {
+			n.ClientCert = meta
+		}
+		p.mu.Unlock()
+		p.healthProbes.forget(snapshot.ID)
+		p.markNodeChanged(snapshot.ID)
+		p.audit(snapshot.AccountID, actor, "node.client_cert.update", snapshot.ID, map[string]interface{}{
+			"fingerprint": meta.Fingerprint,
+			"not_after":   meta.NotAfter,
+		})
+		writeJSON(w, http.StatusOK, map[string]interface{}{"node_id": snapshot.ID, "client_cert": meta.view(now)})
+	case http.MethodDelete:
+		if err := p.removeNodeClientCert(snapshot.ID); err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		p.healthProbes.forget(snapshot.ID)
+		p.markNodeChanged(snapshot.ID)
+		p.audit(snapshot.AccountID, auditActor(r), "node.client_cert.delete", snapshot.ID, nil)
+		writeJSON(w, http.StatusOK, map[string]interface{}{"node_id": snapshot.ID, "client_cert": nil})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// removeNodeClientCert 卸载并删除节点的客户端证书。
+func (p *Server) removeNodeClientCert(nodeID string) error {
+	if p.store != nil {
+		if err := p.store.DeleteNodeClientCert(context.Background(), nodeID); err != nil {
+			return err
+		}
+	}
+	p.nodeTLS.setClientCert(nodeID, "", nil)
+	p.mu.Lock()
+	if n := p.nodeIndex[nodeID]; n != nil {
+		n.ClientCert = nil
+	}
+	p.mu.Unlock()
+	return nil
+}
+
+// ClientCertWatcher 定期检查节点客户端证书的到期时间，在到期前 node_cert.expiry_warn_days 天内每天提醒一次。
+type ClientCertWatcher struct {
+	server   *Server
+	logger   *log.Logger
+	stopCh   chan struct{}
+	wg       sync.WaitGroup
+	stopOnce sync.Once
+
+	mu       sync.Mutex
+	notified map[string]time.Time // nodeID -> 最近一次提醒时间
+}
+
+// NewClientCertWatcher 创建证书到期检查器。
+func NewClientCertWatcher(server *Server, logger *log.Logger) *ClientCertWatcher {
+	if logger == nil {
+		logger = log.Default()
+	}
+	return &ClientCertWatcher{
+		server:   server,
+		logger:   logger,
+		stopCh:   make(chan struct{}),
+		notified: make(map[string]time.Time),
+	}
+}
+
+// Start 启动检查循环，启动时立即检查一次。
+func (c *ClientCertWatcher) Start() error {
+	if c == nil || c.server == nil {
+		return nil
+	}
+	c.wg.Add(1)
+	go c.loop()
+	return nil
+}
+
+// Stop 停止检查循环。
+func (c *ClientCertWatcher) Stop() {
+	if c == nil {
+		return
+	}
+	c.stopOnce.Do(func() {
+		close(c.stopCh)
+	})
+	c.wg.Wait()
+}
+
+func (c *ClientCertWatcher) loop() {
+	defer c.wg.Done()
+	ticker := time.NewTicker(clientCertCheckInterval)
+	defer ticker.Stop()
+	c.check(time.Now())
+	for {
+		select {
+		case <-c.stopCh:
+			return
+		case <-ticker.C:
+			c.check(time.Now())
+		}
+	}
+}
+
+func (c *ClientCertWatcher) warnWindow() time.Duration {
+	days := defaultCertExpiryWarnDays
+	if cache := c.server.settingsCache; cache != nil {
+		if v := cache.GetInt("node_cert.expiry_warn_days", days); v > 0 {
+			days = v
+		}
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// check 对即将到期或已过期的证书发出告警，返回本次提醒的节点数。
+func (c *ClientCertWatcher) check(now time.Time) int {
+	type expiring struct {
+		node Node
+		cert nodeClientCert
+	}
+	window := c.warnWindow()
+	var due []expiring
+	p := c.server
+	p.mu.RLock()
+	for _, n := range p.nodeIndex {
+		if n.ClientCert != nil && n.ClientCert.NotAfter.Sub(now) <= window {
+			due = append(due, expiring{node: *n, cert: *n.ClientCert})
+		}
+	}
+	p.mu.RUnlock()
+
+	sent := 0
+	for _, d := range due {
+		c.mu.Lock()
+		last, seen := c.notified[d.node.ID]
+		if seen && now.Sub(last) < clientCertRenotifyInterval {
+			c.mu.Unlock()
+			continue
+		}
+		c.notified[d.node.ID] = now
+		c.mu.Unlock()
+		sent++
+
+		left := d.cert.NotAfter.Sub(now)
+		status := fmt.Sprintf("%d 天后到期", int(left.Hours()/24))
+		if left <= 0 {
+			status = "已过期"
+		}
+		c.logger.Printf("client certificate for node %s expires at %s", d.node.Name, d.cert.NotAfter.Format(time.RFC3339))
+		if p.notifyMgr != nil {
+			p.notifyMgr.Publish(notify.Event{
+				AccountID: d.node.AccountID,
+				EventType: notify.EventNodeCertExpiring,
+				Title:     "节点客户端证书即将到期",
+				Content: fmt.Sprintf("**节点名称**: %s\n**证书主题**: %s\n**到期时间**: %s（%s）",
+					d.node.Name, d.cert.Subject, timeutil.FormatBeijingTime(d.cert.NotAfter), status),
+				DedupKey:   d.node.ID + ":" + d.cert.Fingerprint,
+				Node:       d.node.Name,
+				OccurredAt: now,
+			})
+		}
+	}
+	return sent
+}
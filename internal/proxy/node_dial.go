@@ -0,0 +1,166 @@
+package proxy
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"qcc_plus/internal/config"
+)
+
+const (
+	defaultDialTimeout   = 30 * time.Second
+	defaultFallbackDelay = 300 * time.Millisecond
+	maxNodeDialTimeout   = 5 * time.Minute
+)
+
+// dialPolicy 拨号参数：地址族选择、首选地址族未连通时回退到另一族的等待时间与建连超时。
+// 部署级默认值来自启动配置 dial，节点解析设置中的同名字段可单独覆盖。
+type dialPolicy struct {
+	family   string
+	fallback time.Duration // 0 为默认 300ms，负值表示首选失败后才回退
+	timeout  time.Duration
+}
+
+func defaultDialPolicy() dialPolicy {
+	return dialPolicy{family: config.IPFamilyAuto, timeout: defaultDialTimeout}
+}
+
+func newDialPolicy(opts config.DialOptions) dialPolicy {
+	d := dialPolicy{family: opts.IPFamily, fallback: opts.FallbackDelay, timeout: opts.Timeout}
+	if d.family == "" {
+		d.family = config.IPFamilyAuto
+	}
+	if d.timeout <= 0 {
+		d.timeout = defaultDialTimeout
+	}
+	return d
+}
+
+// withNode 以节点设置覆盖部署级默认值，未设置的字段沿用默认。
+func (d dialPolicy) withNode(cfg *nodeDNS) dialPolicy {
+	if cfg == nil {
+		return d
+	}
+	if cfg.IPFamily != "" {
+		d.family = cfg.IPFamily
+	}
+	if cfg.FallbackDelayMs != 0 {
+		d.fallback = time.Duration(cfg.FallbackDelayMs) * time.Millisecond
+	}
+	if cfg.DialTimeoutMs > 0 {
+		d.timeout = time.Duration(cfg.DialTimeoutMs) * time.Millisecond
+	}
+	return d
+}
+
+// preferIPv6 解析时是否优先查询 AAAA 记录。
+func (d dialPolicy) preferIPv6() bool {
+	return d.family == config.IPFamilyIPv6 || d.family == config.IPFamilyPreferIPv6
+}
+
+func (d dialPolicy) dialContext() func(ctx context.Context, network, addr string) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: d.timeout, KeepAlive: 30 * time.Second, FallbackDelay: d.fallback}
+	switch d.family {
+	case config.IPFamilyIPv4, config.IPFamilyIPv6:
+		suffix := "4"
+		if d.family == config.IPFamilyIPv6 {
+			suffix = "6"
+		}
+		return func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return dialer.DialContext(ctx, forceIPFamily(network, suffix), addr)
+		}
+	case config.IPFamilyPreferIPv4, config.IPFamilyPreferIPv6:
+		primary, fallback := "4", "6"
+		if d.family == config.IPFamilyPreferIPv6 {
+			primary, fallback = "6", "4"
+		}
+		return func(ctx context.Context, network, addr string) (net.Conn, error) {
+			if network != "tcp" {
+				return dialer.DialContext(ctx, network, addr)
+			}
+			return dialPreferred(ctx, dialer.DialContext, "tcp"+primary, "tcp"+fallback, addr, d.fallback)
+		}
+	default:
+		return dialer.DialContext
+	}
+}
+
+func forceIPFamily(network, suffix string) string {
+	if network == "tcp" || network == "udp" {
+		return network + suffix
+	}
+	return network
+}
+
+// dialPreferred 先用首选地址族拨号，delay 后仍未连通（或首选已失败）时并行尝试另一族，取先成功的连接。
+// delay 为负时只在首选失败后回退。
+func dialPreferred(ctx context.Context, dial func(ctx context.Context, network, addr string) (net.Conn, error), primary, fallback, addr string, delay time.Duration) (net.Conn, error) {
+	if delay == 0 {
+		delay = defaultFallbackDelay
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		conn    net.Conn
+		err     error
+		primary bool
+	}
+	results := make(chan result, 2)
+	start := func(network string, isPrimary bool) {
+		go func() {
+			conn, err := dial(ctx, network, addr)
+			results <- result{conn: conn, err: err, primary: isPrimary}
+		}()
+	}
+	start(primary, true)
+	pending, fallbackStarted := 1, false
+	var timerC <-chan time.Time
+	if delay > 0 {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		timerC = timer.C
+	}
+
+	var primaryErr error
+	for {
+		select {
+		case <-timerC:
+			timerC = nil
+			if !fallbackStarted {
+				fallbackStarted = true
+				pending++
+				start(fallback, false)
+			}
+		case r := <-results:
+			pending--
+			if r.err == nil {
+				// 另一路稍后成功的连接直接关闭。
+				for ; pending > 0; pending-- {
+					go func() {
+						if late := <-results; late.conn != nil {
+							late.conn.Close()
+						}
+					}()
+				}
+				return r.conn, nil
+			}
+			if r.primary {
+				primaryErr = r.err
+			}
+			if !fallbackStarted {
+				fallbackStarted = true
+				pending++
+				start(fallback, false)
+				continue
+			}
+			if pending == 0 {
+				if primaryErr != nil {
+					return nil, primaryErr
+				}
+				return nil, r.err
+			}
+		}
+	}
+}
@@ -0,0 +1,537 @@
+package proxy
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"strings"
+	"sync"
+	"time"
+
+	"qcc_plus/internal/config"
+	"qcc_plus/internal/store"
+)
+
+const (
+	maxNodeStaticIPs = 16
+	dnsQueryTimeout  = 3 * time.Second
+	maxDNSCacheTTL   = time.Hour
+)
+
+const (
+	dnsTypeA    uint16 = 1
+	dnsTypeAAAA uint16 = 28
+)
+
+// nodeDNS 节点的解析与拨号设置：固定 IP 跳过解析直接连接，指定 DNS 服务器时按记录 TTL 缓存结果，
+// 两者互斥；TLS 校验与 Host 头仍使用节点地址中的域名。拨号字段为空或 0 时沿用部署级 dial 配置。
+type nodeDNS struct {
+	StaticIPs       []string  `json:"static_ips,omitempty"`
+	Resolver        string    `json:"resolver,omitempty"`
+	IPFamily        string    `json:"ip_family,omitempty"`
+	FallbackDelayMs int       `json:"fallback_delay_ms,omitempty"`
+	DialTimeoutMs   int       `json:"dial_timeout_ms,omitempty"`
+	UpdatedAt       time.Time `json:"updated_at"`
+	UpdatedBy       string    `json:"updated_by,omitempty"`
+}
+
+func (d *nodeDNS) view() map[string]interface{} {
+	return map[string]interface{}{
+		"static_ips":        d.StaticIPs,
+		"resolver":          d.Resolver,
+		"ip_family":         d.IPFamily,
+		"fallback_delay_ms": d.FallbackDelayMs,
+		"dial_timeout_ms":   d.DialTimeoutMs,
+		"updated_at":        d.UpdatedAt,
+		"updated_by":        d.UpdatedBy,
+	}
+}
+
+// overridesResolution 是否替换了系统解析。
+func (d *nodeDNS) overridesResolution() bool {
+	return len(d.StaticIPs) > 0 || d.Resolver != ""
+}
+
+// overridesDial 是否覆盖了部署级拨号参数。
+func (d *nodeDNS) overridesDial() bool {
+	return d.IPFamily != "" || d.FallbackDelayMs != 0 || d.DialTimeoutMs != 0
+}
+
+// normalizeNodeDNS 校验解析与拨号设置，DNS 服务器缺省端口为 53。
+func normalizeNodeDNS(req nodeDNS) (*nodeDNS, error) {
+	cfg := &nodeDNS{IPFamily: strings.TrimSpace(req.IPFamily), FallbackDelayMs: req.FallbackDelayMs, DialTimeoutMs: req.DialTimeoutMs}
+	if cfg.IPFamily != "" && !config.ValidIPFamily(cfg.IPFamily) {
+		return nil, fmt.Errorf("invalid ip_family %q: expected auto, ipv4, ipv6, prefer_ipv4 or prefer_ipv6", cfg.IPFamily)
+	}
+	if cfg.DialTimeoutMs < 0 || time.Duration(cfg.DialTimeoutMs)*time.Millisecond > maxNodeDialTimeout {
+		return nil, fmt.Errorf("dial_timeout_ms must be between 0 and %d", maxNodeDialTimeout.Milliseconds())
+	}
+	for _, raw := range req.StaticIPs {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		ip := net.ParseIP(raw)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid static ip %q", raw)
+		}
+		cfg.StaticIPs = append(cfg.StaticIPs, ip.String())
+	}
+	if len(cfg.StaticIPs) > maxNodeStaticIPs {
+		return nil, fmt.Errorf("at most %d static ips are allowed", maxNodeStaticIPs)
+	}
+	if resolver := strings.TrimSpace(req.Resolver); resolver != "" {
+		host, port, err := net.SplitHostPort(resolver)
+		if err != nil {
+			host, port = strings.Trim(resolver, "[]"), "53"
+		}
+		// DNS 服务器必须是 IP，否则解析它本身又依赖系统 DNS。
+		if net.ParseIP(host) == nil {
+			return nil, fmt.Errorf("resolver %q must be an ip address", resolver)
+		}
+		cfg.Resolver = net.JoinHostPort(host, port)
+	}
+	switch {
+	case !cfg.overridesResolution() && !cfg.overridesDial():
+		return nil, errors.New("static_ips, resolver or dial settings required")
+	case len(cfg.StaticIPs) > 0 && cfg.Resolver != "":
+		return nil, errors.New("static_ips and resolver are mutually exclusive")
+	}
+	return cfg, nil
+}
+
+// dnsCache 缓存指定 DNS 服务器的解析结果，有效期取应答记录中最小的 TTL；TTL 为 0 时不缓存。
+type dnsCache struct {
+	mu      sync.Mutex
+	entries map[string]dnsCacheEntry // resolver + "|" + host，优先 AAAA 时追加 "|6"
+}
+
+type dnsCacheEntry struct {
+	ips     []string
+	expires time.Time
+}
+
+func newDNSCache() *dnsCache {
+	return &dnsCache{entries: make(map[string]dnsCacheEntry)}
+}
+
+func dnsCacheKey(resolver, host string, preferV6 bool) string {
+	key := resolver + "|" + strings.ToLower(host)
+	if preferV6 {
+		key += "|6"
+	}
+	return key
+}
+
+// lookup 返回域名的 IP 列表，cached 表示命中缓存。默认先查 A 记录，无结果再查 AAAA；preferV6 时相反。
+func (c *dnsCache) lookup(ctx context.Context, resolver, host string, preferV6 bool) ([]string, bool, error) {
+	key := dnsCacheKey(resolver, host, preferV6)
+	now := time.Now()
+	c.mu.Lock()
+	if e, ok := c.entries[key]; ok {
+		if now.Before(e.expires) {
+			c.mu.Unlock()
+			return e.ips, true, nil
+		}
+		delete(c.entries, key)
+	}
+	c.mu.Unlock()
+
+	first, second := dnsTypeA, dnsTypeAAAA
+	if preferV6 {
+		first, second = second, first
+	}
+	ips, ttl, err := queryDNS(ctx, resolver, host, first)
+	if err == nil && len(ips) == 0 {
+		ips, ttl, err = queryDNS(ctx, resolver, host, second)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if len(ips) == 0 {
+		return nil, false, fmt.Errorf("lookup %s on %s: no such host", host, resolver)
+	}
+	if ttl > maxDNSCacheTTL {
+		ttl = maxDNSCacheTTL
+	}
+	if ttl > 0 {
+		c.mu.Lock()
+		c.entries[key] = dnsCacheEntry{ips: ips, expires: now.Add(ttl)}
+		c.mu.Unlock()
+	}
+	return ips, false, nil
+}
+
+// peek 返回缓存条目而不触发查询，供接口展示。
+func (c *dnsCache) peek(resolver, host string, preferV6 bool) (dnsCacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[dnsCacheKey(resolver, host, preferV6)]
+	if !ok || !time.Now().Before(e.expires) {
+		return dnsCacheEntry{}, false
+	}
+	return e, true
+}
+
+// forget 清除指定 DNS 服务器的全部缓存，解析设置变更后调用。
+func (c *dnsCache) forget(resolver string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key := range c.entries {
+		if strings.HasPrefix(key, resolver+"|") {
+			delete(c.entries, key)
+		}
+	}
+}
+
+// dialContext 按节点解析设置替换拨号时的域名解析，逐个尝试解析出的地址。
+// 自行解析时同样触发 httptrace 的 DNS 回调，健康检查据此统计解析耗时。
+func (c *dnsCache) dialContext(cfg *nodeDNS, preferV6 bool, dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	if dial == nil {
+		dial = (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}).DialContext
+	}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil || net.ParseIP(host) != nil {
+			return dial(ctx, network, addr)
+		}
+		trace := httptrace.ContextClientTrace(ctx)
+		if trace != nil && trace.DNSStart != nil {
+			trace.DNSStart(httptrace.DNSStartInfo{Host: host})
+		}
+		ips := cfg.StaticIPs
+		if len(ips) == 0 {
+			ips, _, err = c.lookup(ctx, cfg.Resolver, host, preferV6)
+		}
+		if trace != nil && trace.DNSDone != nil {
+			addrs := make([]net.IPAddr, 0, len(ips))
+			for _, ip := range ips {
+				addrs = append(addrs, net.IPAddr{IP: net.ParseIP(ip)})
+			}
+			trace.DNSDone(httptrace.DNSDoneInfo{Addrs: addrs, Err: err})
+		}
+		if err != nil {
+			return nil, err
+		}
+		var lastErr error
+		for _, ip := range ips {
+			conn, err := dial(ctx, network, net.JoinHostPort(ip, port))
+			if err == nil {
+				return conn, nil
+			}
+			lastErr = err
+		}
+		return nil, lastErr
+	}
+}
+
+// queryDNS 通过 UDP 向 DNS 服务器查询一种记录，返回地址及应答中最小的 TTL。
+func queryDNS(ctx context.Context, server, host string, qtype uint16) ([]string, time.Duration, error) {
+	query, id, err := buildDNSQuery(host, qtype)
+	if err != nil {
+		return nil, 0, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, dnsQueryTimeout)
+	defer cancel()
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", server)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer conn.Close()
+	deadline, _ := ctx.Deadline()
+	_ = conn.SetDeadline(deadline)
+	if _, err := conn.Write(query); err != nil {
+		return nil, 0, err
+	}
+	buf := make([]byte, 4096)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, 0, fmt.Errorf("lookup %s on %s: %v", host, server, err)
+		}
+		// 忽略 ID 不匹配的迟到应答。
+		if n >= 2 && binary.BigEndian.Uint16(buf) == id {
+			return parseDNSResponse(buf[:n], host, qtype)
+		}
+	}
+}
+
+func buildDNSQuery(host string, qtype uint16) ([]byte, uint16, error) {
+	var idb [2]byte
+	_, _ = rand.Read(idb[:])
+	id := binary.BigEndian.Uint16(idb[:])
+	msg := make([]byte, 12, 12+len(host)+6)
+	binary.BigEndian.PutUint16(msg[0:], id)
+	binary.BigEndian.PutUint16(msg[2:], 0x0100) // RD
+	binary.BigEndian.PutUint16(msg[4:], 1)      // QDCOUNT
+	for _, label := range strings.Split(strings.TrimSuffix(host, "."), ".") {
+		if label == "" || len(label) > 63 {
+			return nil, 0, fmt.Errorf("invalid host %q", host)
+		}
+		msg = append(msg, byte(len(label)))
+		msg = append(msg, label...)
+	}
+	msg = append(msg, 0, byte(qtype>>8), byte(qtype), 0, 1)
+	return msg, id, nil
+}
+
+func parseDNSResponse(msg []byte, host string, qtype uint16) ([]string, time.Duration, error) {
+	if len(msg) < 12 {
+		return nil, 0, errors.New("dns response too short")
+	}
+	flags := binary.BigEndian.Uint16(msg[2:])
+	switch {
+	case flags&0x8000 == 0:
+		return nil, 0, errors.New("dns response is not a reply")
+	case flags&0x0200 != 0:
+		return nil, 0, errors.New("dns response truncated")
+	case flags&0x000f == 3:
+		return nil, 0, fmt.Errorf("lookup %s: no such host", host)
+	case flags&0x000f != 0:
+		return nil, 0, fmt.Errorf("lookup %s: dns rcode %d", host, flags&0x000f)
+	}
+	qd := int(binary.BigEndian.Uint16(msg[4:]))
+	an := int(binary.BigEndian.Uint16(msg[6:]))
+	off := 12
+	var err error
+	for i := 0; i < qd; i++ {
+		if off, err = skipDNSName(msg, off); err != nil {
+			return nil, 0, err
+		}
+		off += 4
+	}
+	var (
+		ips    []string
+		minTTL uint32
+	)
+	for i := 0; i < an; i++ {
+		if off, err = skipDNSName(msg, off); err != nil {
+			return nil, 0, err
+		}
+		if off+10 > len(msg) {
+			return nil, 0, errors.New("dns response truncated")
+		}
+		typ := binary.BigEndian.Uint16(msg[off:])
+		ttl := binary.BigEndian.Uint32(msg[off+4:])
+		rdlen := int(binary.BigEndian.Uint16(msg[off+8:]))
+		off += 10
+		if off+rdlen > len(msg) {
+			return nil, 0, errors.New("dns response truncated")
+		}
+		// CNAME 链上的 TTL 同样限制结果的有效期。
+		if i == 0 || ttl < minTTL {
+			minTTL = ttl
+		}
+		if typ == qtype && (rdlen == net.IPv4len || rdlen == net.IPv6len) {
+			ips = append(ips, net.IP(msg[off:off+rdlen]).String())
+		}
+		off += rdlen
+	}
+	return ips, time.Duration(minTTL) * time.Second, nil
+}
+
+func skipDNSName(msg []byte, off int) (int, error) {
+	for {
+		if off >= len(msg) {
+			return 0, errors.New("dns response truncated")
+		}
+		l := int(msg[off])
+		switch {
+		case l == 0:
+			return off + 1, nil
+		case l&0xc0 == 0xc0:
+			return off + 2, nil
+		}
+		off += 1 + l
+	}
+}
+
+// dnsTimer 通过 httptrace 统计请求中的域名解析耗时；复用连接时不发生解析，耗时为 0。
+type dnsTimer struct {
+	mu    sync.Mutex
+	start time.Time
+	took  time.Duration
+}
+
+func (t *dnsTimer) trace(ctx context.Context) context.Context {
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			t.mu.Lock()
+			t.start = time.Now()
+			t.mu.Unlock()
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			t.mu.Lock()
+			if !t.start.IsZero() {
+				t.took += time.Since(t.start)
+				t.start = time.Time{}
+			}
+			t.mu.Unlock()
+		},
+	})
+}
+
+func (t *dnsTimer) elapsed() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.took
+}
+
+// loadNodeDNS 启动时安装账号下节点的解析设置。
+func (p *Server) loadNodeDNS(acc *Account) {
+	if p.store == nil {
+		return
+	}
+	recs, err := p.store.ListNodeDNS(context.Background(), acc.ID)
+	if err != nil {
+		p.logger.Printf("load dns settings for account %s failed: %v", acc.ID, err)
+		return
+	}
+	for _, rec := range recs {
+		n := acc.Nodes[rec.NodeID]
+		if n == nil {
+			continue
+		}
+		var ips []string
+		if rec.StaticIPs != "" {
+			ips = strings.Split(rec.StaticIPs, ",")
+		}
+		cfg, err := normalizeNodeDNS(nodeDNS{
+			StaticIPs:       ips,
+			Resolver:        rec.Resolver,
+			IPFamily:        rec.IPFamily,
+			FallbackDelayMs: rec.FallbackDelayMs,
+			DialTimeoutMs:   rec.DialTimeoutMs,
+		})
+		if err != nil {
+			p.logger.Printf("dns settings for node %s ignored: %v", n.Name, err)
+			continue
+		}
+		cfg.UpdatedAt, cfg.UpdatedBy = rec.UpdatedAt, rec.UpdatedBy
+		p.nodeTLS.setDNS(n.ID, n.URL.Host, cfg)
+		n.DNS = cfg
+	}
+}
+
+// removeNodeDNS 删除节点的解析设置，恢复使用系统解析。
+func (p *Server) removeNodeDNS(nodeID string) error {
+	if p.store != nil {
+		if err := p.store.DeleteNodeDNS(context.Background(), nodeID); err != nil {
+			return err
+		}
+	}
+	p.nodeTLS.setDNS(nodeID, "", nil)
+	p.mu.Lock()
+	if n := p.nodeIndex[nodeID]; n != nil {
+		n.DNS = nil
+	}
+	p.mu.Unlock()
+	return nil
+}
+
+// GET    /api/nodes/:id/dns 查看解析设置及当前缓存
+// PUT    /api/nodes/:id/dns {"static_ips":["10.0.0.8"]} 或 {"resolver":"10.0.0.53:53"}，可附带 ip_family、fallback_delay_ms、dial_timeout_ms
+// DELETE /api/nodes/:id/dns 恢复使用系统解析
+func (p *Server) handleNodeDNS(w http.ResponseWriter, r *http.Request) {
+	caller := accountFromCtx(r)
+	if caller == nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		return
+	}
+	snapshot, ok := p.benchmarkNodeForCaller(w, r, caller, "/dns")
+	if !ok {
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		var (
+			settings interface{}
+			cache    interface{}
+		)
+		p.mu.RLock()
+		n := p.nodeIndex[snapshot.ID]
+		if n != nil && n.DNS != nil {
+			settings = n.DNS.view()
+			if n.DNS.Resolver != "" && n.URL != nil {
+				if e, ok := p.nodeTLS.dns.peek(n.DNS.Resolver, n.URL.Hostname(), p.nodeTLS.dial.withNode(n.DNS).preferIPv6()); ok {
+					cache = map[string]interface{}{
+						"ips":        e.ips,
+						"expires_at": e.expires.UTC(),
+						"ttl_sec":    int(time.Until(e.expires).Seconds()),
+					}
+				}
+			}
+		}
+		p.mu.RUnlock()
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"node_id":     snapshot.ID,
+			"dns":         settings,
+			"cache":       cache,
+			"last_dns_ms": snapshot.Metrics.LastDNSMS,
+		})
+	case http.MethodPut:
+		var req nodeDNS
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 16*1024)).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
+			return
+		}
+		cfg, err := normalizeNodeDNS(req)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		actor := auditActor(r)
+		cfg.UpdatedAt, cfg.UpdatedBy = time.Now().UTC(), actor
+		if p.store != nil {
+			if err := p.store.SaveNodeDNS(r.Context(), store.NodeDNSRecord{
+				NodeID:          snapshot.ID,
+				AccountID:       snapshot.AccountID,
+				StaticIPs:       strings.Join(cfg.StaticIPs, ","),
+				Resolver:        cfg.Resolver,
+				IPFamily:        cfg.IPFamily,
+				FallbackDelayMs: cfg.FallbackDelayMs,
+				DialTimeoutMs:   cfg.DialTimeoutMs,
+				UpdatedBy:       actor,
+				UpdatedAt:       cfg.UpdatedAt,
+			}); err != nil {
+				writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+				return
+			}
+		}
+		if cfg.Resolver != "" {
+			p.nodeTLS.dns.forget(cfg.Resolver)
+		}
+		p.nodeTLS.setDNS(snapshot.ID, snapshot.URL.Host, cfg)
+		p.mu.Lock()
+		if n := p.nodeIndex[snapshot.ID]; n != nil {
+			n.DNS = cfg
+		}
+		p.mu.Unlock()
+		p.healthProbes.forget(snapshot.ID)
+		p.markNodeChanged(snapshot.ID)
+		p.audit(snapshot.AccountID, actor, "node.dns.update", snapshot.ID, map[string]interface{}{
+			"static_ips": cfg.StaticIPs,
+			"resolver":   cfg.Resolver,
+			"ip_family":  cfg.IPFamily,
+		})
+		writeJSON(w, http.StatusOK, map[string]interface{}{"node_id": snapshot.ID, "dns": cfg.view()})
+	case http.MethodDelete:
+		if err := p.removeNodeDNS(snapshot.ID); err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		p.healthProbes.forget(snapshot.ID)
+		p.markNodeChanged(snapshot.ID)
+		p.audit(snapshot.AccountID, auditActor(r), "node.dns.delete", snapshot.ID, nil)
+		writeJSON(w, http.StatusOK, map[string]interface{}{"node_id": snapshot.ID, "dns": nil})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
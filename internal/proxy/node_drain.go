@@ -0,0 +1,148 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// inflightCounter 返回节点的在途请求计数器。
+func (p *Server) inflightCounter(nodeID string) *atomic.Int64 {
+	v, _ := p.inflight.LoadOrStore(nodeID, new(atomic.Int64))
+	return v.(*atomic.Int64)
+}
+
+// nodeInflight 返回节点当前在途请求数。
+func (p *Server) nodeInflight(nodeID string) int64 {
+	if v, ok := p.inflight.Load(nodeID); ok {
+		return v.(*atomic.Int64).Load()
+	}
+	return 0
+}
+
+// beginNodeRequest 记录请求开始，返回结束时的回调。
+func (p *Server) beginNodeRequest(nodeID string) func() {
+	c := p.inflightCounter(nodeID)
+	c.Add(1)
+	return func() {
+		if c.Add(-1) <= 0 {
+			p.maybeFinishDrain(nodeID)
+		}
+	}
+}
+
+// drainNode 将节点置为排空状态：不再接收新请求，存量请求继续完成。
+func (p *Server) drainNode(id string, autoDisable bool) error {
+	p.mu.Lock()
+	n, ok := p.nodeIndex[id]
+	if !ok {
+		p.mu.Unlock()
+		return fmt.Errorf("node %s not found", id)
+	}
+	acc := p.nodeAccount[id]
+	if nodeState(n) == NodeStateDraining {
+		n.DrainAutoDisable = autoDisable
+		p.mu.Unlock()
+		p.maybeFinishDrain(id)
+		return nil
+	}
+	fromState, changed := setNodeState(n, NodeStateDraining, time.Now())
+	if !changed {
+		p.mu.Unlock()
+		return fmt.Errorf("node %s cannot drain from state %s", id, fromState)
+	}
+	n.DrainAutoDisable = autoDisable
+	wasActive := acc != nil && acc.ActiveID == id
+	p.mu.Unlock()
+
+	p.onNodeStateChange(id, fromState, NodeStateDraining)
+	if wasActive {
+		p.selectBestAndActivate(acc, "节点排空")
+	}
+	p.maybeFinishDrain(id)
+	return nil
+}
+
+// maybeFinishDrain 在排空节点无在途请求且开启自动禁用时禁用节点。
+func (p *Server) maybeFinishDrain(id string) {
+	if p.nodeInflight(id) > 0 {
+		return
+	}
+	p.mu.RLock()
+	n := p.nodeIndex[id]
+	done := n != nil && nodeState(n) == NodeStateDraining && n.DrainAutoDisable
+	p.mu.RUnlock()
+	if !done {
+		return
+	}
+	if err := p.disableNode(id); err != nil {
+		p.logger.Printf("auto disable drained node %s failed: %v", id, err)
+		return
+	}
+	p.logger.Printf("node %s drained, auto disabled", id)
+}
+
+// drainStatus 返回排空进度。
+func (p *Server) drainStatus(id string) map[string]interface{} {
+	p.mu.RLock()
+	n := p.nodeIndex[id]
+	state := nodeState(n)
+	autoDisable := n != nil && n.DrainAutoDisable
+	p.mu.RUnlock()
+	remaining := p.nodeInflight(id)
+	return map[string]interface{}{
+		"id":           id,
+		"state":        state,
+		"draining":     state == NodeStateDraining,
+		"inflight":     remaining,
+		"drained":      remaining == 0 && (state == NodeStateDraining || state == NodeStateDisabled),
+		"auto_disable": autoDisable,
+	}
+}
+
+// /admin/api/nodes/drain
+// POST {"id": "...", "auto_disable": true} 开始排空；GET ?id=... 查询进度。
+func (p *Server) handleDrain(w http.ResponseWriter, r *http.Request) {
+	var id string
+	var autoDisable bool
+	switch r.Method {
+	case http.MethodGet:
+		id = r.URL.Query().Get("id")
+	case http.MethodPost:
+		var req struct {
+			ID          string `json:"id"`
+			AutoDisable bool   `json:"auto_disable"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
+			return
+		}
+		id = req.ID
+		autoDisable = req.AutoDisable
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if id == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "id required"})
+		return
+	}
+	node := p.getNode(id)
+	if node == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "node not found"})
+		return
+	}
+	if !canManageAccount(r.Context(), node.AccountID) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	if r.Method == http.MethodPost {
+		if err := p.drainNode(id, autoDisable); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, p.drainStatus(id))
+}
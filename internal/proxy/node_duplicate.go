@@ -0,0 +1,182 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"qcc_plus/internal/store"
+)
+
+// 创建或导入节点时遇到重复节点（同账号下 base_url 与 api_key 相同）的处理方式。
+const (
+	onDuplicateSkip      = "skip"      // 保留已有节点，不创建
+	onDuplicateUpdate    = "update"    // 用请求中的名称、权重、健康检查方式更新已有节点
+	onDuplicateDuplicate = "duplicate" // 仍然创建新节点
+)
+
+const maxNodeImport = 200
+
+var onDuplicateOptions = []string{onDuplicateSkip, onDuplicateUpdate, onDuplicateDuplicate}
+
+// nodeCreateRequest 创建/导入节点的请求体；OnDuplicate 为空时遇到重复节点返回冲突。
+type nodeCreateRequest struct {
+	BaseURL           string            `json:"base_url"`
+	APIKey            string            `json:"api_key"`
+	Name              string            `json:"name"`
+	Weight            int               `json:"weight"`
+	HealthCheckMethod string            `json:"health_check_method"`
+	HealthIntervalSec int               `json:"health_interval_sec"`
+	Headers           map[string]string `json:"headers"`
+	OnDuplicate       string            `json:"on_duplicate"`
+}
+
+// normalizeNodeURL 归一化地址用于比较：忽略协议/主机大小写与末尾斜杠。
+func normalizeNodeURL(raw string) string {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || u.Host == "" {
+		return strings.TrimRight(strings.ToLower(strings.TrimSpace(raw)), "/")
+	}
+	return strings.ToLower(u.Scheme) + "://" + strings.ToLower(u.Host) + strings.TrimRight(u.EscapedPath(), "/")
+}
+
+// findDuplicateNode 查找账号下 base_url 与 api_key 相同的节点。
+func (p *Server) findDuplicateNode(acc *Account, baseURL, apiKey string) *Node {
+	if acc == nil {
+		return nil
+	}
+	want := normalizeNodeURL(baseURL)
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	var found *Node
+	for _, n := range acc.Nodes {
+		if n.URL == nil || n.APIKey != apiKey || normalizeNodeURL(n.URL.String()) != want {
+			continue
+		}
+		// 多个重复时返回最早创建的节点，保证结果稳定
+		if found == nil || n.CreatedAt.Before(found.CreatedAt) {
+			found = n
+		}
+	}
+	return found
+}
+
+// nodeConflict 重复节点冲突的结构化描述，附带可选的处理方式。
+func nodeConflict(existing *Node) map[string]interface{} {
+	return map[string]interface{}{
+		"error": "duplicate node",
+		"code":  "duplicate_node",
+		"existing": map[string]interface{}{
+			"id":       existing.ID,
+			"name":     existing.Name,
+			"base_url": existing.URL.String(),
+			"weight":   existing.Weight,
+		},
+		"options": onDuplicateOptions,
+	}
+}
+
+// createNodeWithDedup 按 on_duplicate 处理重复节点后创建节点，新建节点未指定的字段由账号节点模板填充。
+// 返回节点与结果（created/skipped/updated）；未指定处理方式且存在重复时返回冲突节点。
+func (p *Server) createNodeWithDedup(acc *Account, req nodeCreateRequest) (node *Node, outcome string, conflict *Node, err error) {
+	if err := validateNodeHealthInterval(req.HealthIntervalSec); err != nil {
+		return nil, "", nil, err
+	}
+	if req.Headers, err = normalizeNodeHeaders(req.Headers); err != nil {
+		return nil, "", nil, err
+	}
+	switch req.OnDuplicate {
+	case "", onDuplicateSkip, onDuplicateUpdate, onDuplicateDuplicate:
+	default:
+		return nil, "", nil, fmt.Errorf("invalid on_duplicate: %s (options: %s)", req.OnDuplicate, strings.Join(onDuplicateOptions, "/"))
+	}
+	if req.OnDuplicate != onDuplicateDuplicate && req.BaseURL != "" {
+		if existing := p.findDuplicateNode(acc, req.BaseURL, req.APIKey); existing != nil {
+			switch req.OnDuplicate {
+			case onDuplicateSkip:
+				return existing, "skipped", nil, nil
+			case onDuplicateUpdate:
+				weight := req.Weight
+				if weight <= 0 {
+					weight = existing.Weight
+				}
+				var method *string
+				if req.HealthCheckMethod != "" {
+					method = &req.HealthCheckMethod
+				}
+				if err := p.updateNode(existing.ID, req.Name, req.BaseURL, nil, weight, method); err != nil {
+					return nil, "", nil, err
+				}
+				return existing, "updated", nil, nil
+			default:
+				return nil, "", existing, nil
+			}
+		}
+	}
+	req = p.nodeTemplate(acc).apply(req)
+	node, err = p.addNodeWithOptions(acc, req.Name, req.BaseURL, req.APIKey, req.Weight, req.HealthCheckMethod, req.Headers, time.Duration(req.HealthIntervalSec)*time.Second)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	return node, "created", nil, nil
+}
+
+// handleImportNodes 处理 POST /api/nodes/import：批量导入节点，顶层 on_duplicate 作为各项的默认处理方式，
+// 逐项返回 created/skipped/updated/conflict/error，单项失败不影响其他项。导入过程中按已处理的项数
+// 向账号推送 node_import 进度，响应中的 job_id 与推送的进度对应。
+func (p *Server) handleImportNodes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	acc, ok := p.nodesAccount(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		Nodes       []nodeCreateRequest `json:"nodes"`
+		OnDuplicate string              `json:"on_duplicate"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
+		return
+	}
+	if len(req.Nodes) == 0 || len(req.Nodes) > maxNodeImport {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("nodes required (max %d)", maxNodeImport)})
+		return
+	}
+	counts := map[string]int{}
+	results := make([]map[string]interface{}, 0, len(req.Nodes))
+	job := newLocalJob(jobTypeNodeImport, acc.ID, auditActor(r))
+	progress := newJobReporter(job, p.broadcastJobProgress)
+	progress.Update(0, int64(len(req.Nodes)))
+	for i, item := range req.Nodes {
+		if item.OnDuplicate == "" {
+			item.OnDuplicate = req.OnDuplicate
+		}
+		res := map[string]interface{}{"index": i, "name": item.Name, "base_url": item.BaseURL}
+		node, outcome, conflict, err := p.createNodeWithDedup(acc, item)
+		switch {
+		case err != nil:
+			outcome = "error"
+			res["error"] = err.Error()
+		case conflict != nil:
+			outcome = "conflict"
+			for k, v := range nodeConflict(conflict) {
+				res[k] = v
+			}
+		default:
+			res["id"] = node.ID
+		}
+		res["status"] = outcome
+		counts[outcome]++
+		results = append(results, res)
+		progress.Update(int64(i+1), int64(len(req.Nodes)))
+	}
+	progress.finish(store.JobSucceeded, "")
+	p.audit(acc.ID, auditActor(r), "node.import", "", counts)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"job_id": job.ID, "results": results, "summary": counts})
+}
@@ -0,0 +1,423 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"qcc_plus/internal/notify"
+	"qcc_plus/internal/store"
+)
+
+const (
+	nodeHooksSettingKey  = "account.node_hooks"
+	nodeHooksAPIPrefix   = "/api/node-hooks/"
+	nodeHookSecretPrefix = "nhsec_"
+	maxNodeHookBytes     = 16 << 10
+	maxNodeHooks         = 50
+
+	nodeHookDisable = "disable"
+	nodeHookEnable  = "enable"
+	nodeHookDrain   = "drain"
+)
+
+var nodeHookActions = []string{nodeHookDisable, nodeHookEnable, nodeHookDrain}
+
+// NodeHook 供部署流水线等外部自动化调用的入站 Webhook，用于上游维护前后禁用/启用/排空节点。
+// 请求按出站回调相同的方式签名（X-QCC-Timestamp + X-QCC-Signature），因此密钥需要保存原文，配置以 is_secret 存储。
+// Nodes 为空表示账号下全部节点，否则只允许操作列出的节点（ID 或名称）；Actions 限定允许的操作。
+type NodeHook struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Secret     string     `json:"secret"`
+	Nodes      []string   `json:"nodes,omitempty"`
+	Actions    []string   `json:"actions"`
+	Disabled   bool       `json:"disabled"`
+	CreatedAt  time.Time  `json:"created_at"`
+	CreatedBy  string     `json:"created_by,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+func (h NodeHook) allows(action string, n *Node) bool {
+	if !containsString(h.Actions, action) {
+		return false
+	}
+	if len(h.Nodes) == 0 {
+		return true
+	}
+	return containsString(h.Nodes, n.ID) || containsString(h.Nodes, n.Name)
+}
+
+// nodeHookReplay 记录重放窗口内已处理的投递 ID，同一 ID 再次到达时拒绝。
+type nodeHookReplay struct {
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+// claim 登记投递 ID，已存在时返回 false；顺带清理窗口外的记录。
+func (c *nodeHookReplay) claim(key string, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.seen == nil {
+		c.seen = make(map[string]time.Time)
+	}
+	for k, at := range c.seen {
+		if now.Sub(at) > 2*notify.DefaultReplayWindow {
+			delete(c.seen, k)
+		}
+	}
+	if _, ok := c.seen[key]; ok {
+		return false
+	}
+	c.seen[key] = now
+	return true
+}
+
+// loadNodeHooks 从配置表读取账号下的节点 Webhook。
+func (p *Server) loadNodeHooks(accountID string) []NodeHook {
+	var list []NodeHook
+	if p.store == nil {
+		return list
+	}
+	setting, err := p.store.GetSetting(nodeHooksSettingKey, "account", accountID)
+	if err != nil || setting == nil {
+		return list
+	}
+	if b, err := json.Marshal(setting.Value); err == nil {
+		_ = json.Unmarshal(b, &list)
+	}
+	return list
+}
+
+func (p *Server) persistNodeHooks(accountID string, list []NodeHook, updatedBy string) error {
+	if p.store == nil {
+		return nil
+	}
+	id := accountID
+	desc := "节点维护入站 Webhook（含签名密钥）"
+	setting := &store.Setting{
+		Key:         nodeHooksSettingKey,
+		Scope:       "account",
+		AccountID:   &id,
+		Value:       list,
+		DataType:    "array",
+		Category:    "security",
+		Description: &desc,
+		IsSecret:    true,
+	}
+	if updatedBy != "" {
+		setting.UpdatedBy = &updatedBy
+	}
+	return p.store.UpsertSetting(setting)
+}
+
+// updateNodeHooks 在写锁内修改账号的节点 Webhook 列表并持久化。
+func (p *Server) updateNodeHooks(acc *Account, updatedBy string, fn func(list []NodeHook) ([]NodeHook, error)) ([]NodeHook, error) {
+	p.mu.Lock()
+	list, err := fn(append([]NodeHook(nil), acc.NodeHooks...))
+	if err != nil {
+		p.mu.Unlock()
+		return nil, err
+	}
+	acc.NodeHooks = list
+	p.mu.Unlock()
+	return list, p.persistNodeHooks(acc.ID, list, updatedBy)
+}
+
+// nodeHookByID 查找 Webhook 及其所属账号。
+func (p *Server) nodeHookByID(id string) (*Account, NodeHook, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	for _, acc := range p.accountByID {
+		for _, h := range acc.NodeHooks {
+			if h.ID == id {
+				return acc, h, true
+			}
+		}
+	}
+	return nil, NodeHook{}, false
+}
+
+var errNodeHookNotFound = errors.New("node hook not found")
+
+func nodeHookView(h NodeHook) map[string]interface{} {
+	return map[string]interface{}{
+		"id":           h.ID,
+		"name":         h.Name,
+		"url":          nodeHooksAPIPrefix + h.ID,
+		"nodes":        h.Nodes,
+		"actions":      h.Actions,
+		"disabled":     h.Disabled,
+		"created_at":   h.CreatedAt,
+		"created_by":   h.CreatedBy,
+		"last_used_at": h.LastUsedAt,
+	}
+}
+
+func normalizeNodeHookActions(actions []string) ([]string, error) {
+	if len(actions) == 0 {
+		return append([]string(nil), nodeHookActions...), nil
+	}
+	out := make([]string, 0, len(actions))
+	for _, a := range actions {
+		a = strings.ToLower(strings.TrimSpace(a))
+		if !containsString(nodeHookActions, a) {
+			return nil, fmt.Errorf("unsupported action %q", a)
+		}
+		if !containsString(out, a) {
+			out = append(out, a)
+		}
+	}
+	return out, nil
+}
+
+// GET    /api/accounts/:id/node-hooks           列出节点 Webhook（不含密钥）
+// POST   /api/accounts/:id/node-hooks           创建，{"name","nodes":[],"actions":["drain","enable"]}，返回一次密钥
+// PUT    /api/accounts/:id/node-hooks/:hook_id  修改 nodes/actions/disabled
+// DELETE /api/accounts/:id/node-hooks/:hook_id  删除
+func (p *Server) handleAccountNodeHooks(w http.ResponseWriter, r *http.Request, acc *Account, hookID string) {
+	if !canAdministerAccount(r.Context(), acc.ID) {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+		return
+	}
+	actor := auditActor(r)
+	switch {
+	case r.Method == http.MethodGet && hookID == "":
+		p.mu.RLock()
+		list := make([]map[string]interface{}, 0, len(acc.NodeHooks))
+		for _, h := range acc.NodeHooks {
+			list = append(list, nodeHookView(h))
+		}
+		p.mu.RUnlock()
+		writeJSON(w, http.StatusOK, map[string]interface{}{"account_id": acc.ID, "node_hooks": list})
+	case r.Method == http.MethodPost && hookID == "":
+		var req struct {
+			Name    string   `json:"name"`
+			Nodes   []string `json:"nodes"`
+			Actions []string `json:"actions"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
+			return
+		}
+		req.Name = strings.TrimSpace(req.Name)
+		if req.Name == "" {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "name required"})
+			return
+		}
+		actions, err := normalizeNodeHookActions(req.Actions)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		h := NodeHook{
+			ID:        "nh-" + randomToken(8),
+			Name:      req.Name,
+			Secret:    nodeHookSecretPrefix + randomToken(24),
+			Nodes:     trimNonEmpty(req.Nodes),
+			Actions:   actions,
+			CreatedAt: time.Now().UTC(),
+			CreatedBy: actor,
+		}
+		if _, err := p.updateNodeHooks(acc, actor, func(list []NodeHook) ([]NodeHook, error) {
+			if len(list) >= maxNodeHooks {
+				return nil, fmt.Errorf("at most %d node hooks per account", maxNodeHooks)
+			}
+			return append(list, h), nil
+		}); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		p.audit(acc.ID, actor, "node_hook.create", h.ID, map[string]interface{}{"name": h.Name, "nodes": h.Nodes, "actions": h.Actions})
+		writeJSON(w, http.StatusCreated, map[string]interface{}{"node_hook": nodeHookView(h), "secret": h.Secret})
+	case r.Method == http.MethodPut && hookID != "":
+		var req struct {
+			Nodes    *[]string `json:"nodes"`
+			Actions  *[]string `json:"actions"`
+			Disabled *bool     `json:"disabled"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
+			return
+		}
+		var actions []string
+		if req.Actions != nil {
+			var err error
+			if actions, err = normalizeNodeHookActions(*req.Actions); err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+				return
+			}
+		}
+		var updated NodeHook
+		_, err := p.updateNodeHooks(acc, actor, func(list []NodeHook) ([]NodeHook, error) {
+			for i := range list {
+				if list[i].ID != hookID {
+					continue
+				}
+				if req.Nodes != nil {
+					list[i].Nodes = trimNonEmpty(*req.Nodes)
+				}
+				if req.Actions != nil {
+					list[i].Actions = actions
+				}
+				if req.Disabled != nil {
+					list[i].Disabled = *req.Disabled
+				}
+				updated = list[i]
+				return list, nil
+			}
+			return nil, errNodeHookNotFound
+		})
+		if errors.Is(err, errNodeHookNotFound) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		p.audit(acc.ID, actor, "node_hook.update", hookID, req)
+		writeJSON(w, http.StatusOK, map[string]interface{}{"node_hook": nodeHookView(updated)})
+	case r.Method == http.MethodDelete && hookID != "":
+		_, err := p.updateNodeHooks(acc, actor, func(list []NodeHook) ([]NodeHook, error) {
+			for i := range list {
+				if list[i].ID == hookID {
+					return append(list[:i], list[i+1:]...), nil
+				}
+			}
+			return nil, errNodeHookNotFound
+		})
+		if errors.Is(err, errNodeHookNotFound) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		p.audit(acc.ID, actor, "node_hook.delete", hookID, nil)
+		writeJSON(w, http.StatusOK, map[string]string{"deleted": hookID})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// POST /api/node-hooks/:hook_id
+// 请求体 {"node": "<ID 或名称>", "action": "disable|enable|drain", "auto_disable": true}，
+// 须携带 X-QCC-Timestamp / X-QCC-Signature（v1=HMAC-SHA256("<ts>.<body>")）与 X-QCC-Webhook-Id；
+// 时间戳超出重放窗口或投递 ID 重复时拒绝。
+func (p *Server) handleNodeHook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	hookID := strings.Trim(strings.TrimPrefix(r.URL.Path, nodeHooksAPIPrefix), "/")
+	acc, hook, ok := p.nodeHookByID(hookID)
+	if !ok || hook.Disabled {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "node hook not found"})
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxNodeHookBytes))
+	if err != nil {
+		writeJSON(w, http.StatusRequestEntityTooLarge, map[string]string{"error": "body too large"})
+		return
+	}
+	now := time.Now()
+	if err := notify.VerifyWebhook(hook.Secret, r.Header, body, notify.DefaultReplayWindow, now); err != nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": err.Error()})
+		return
+	}
+	deliveryID := r.Header.Get(notify.HeaderWebhookID)
+	if deliveryID == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": notify.HeaderWebhookID + " required"})
+		return
+	}
+	if !p.nodeHookReplay.claim(hook.ID+":"+deliveryID, now) {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "duplicate delivery"})
+		return
+	}
+
+	var req struct {
+		Node        string `json:"node"`
+		Action      string `json:"action"`
+		AutoDisable bool   `json:"auto_disable"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
+		return
+	}
+	req.Action = strings.ToLower(strings.TrimSpace(req.Action))
+	if !containsString(nodeHookActions, req.Action) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "action must be one of disable, enable, drain"})
+		return
+	}
+	p.mu.RLock()
+	var node *Node
+	for _, n := range acc.Nodes {
+		if n.ID == req.Node || (node == nil && n.Name == req.Node) {
+			node = n
+		}
+	}
+	p.mu.RUnlock()
+	if node == nil || req.Node == "" {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "node not found"})
+		return
+	}
+	actor := "hook:" + hook.Name
+	detail := map[string]interface{}{"hook_id": hook.ID, "delivery_id": deliveryID, "node": node.Name}
+	if !hook.allows(req.Action, node) {
+		detail["denied"] = true
+		p.audit(acc.ID, actor, "node_hook."+req.Action, node.ID, detail)
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "action not permitted for this hook"})
+		return
+	}
+
+	switch req.Action {
+	case nodeHookDisable:
+		err = p.disableNode(node.ID)
+	case nodeHookEnable:
+		err = p.enableNode(node.ID)
+	case nodeHookDrain:
+		detail["auto_disable"] = req.AutoDisable
+		err = p.drainNode(node.ID, req.AutoDisable)
+	}
+	if err != nil {
+		detail["error"] = err.Error()
+		p.audit(acc.ID, actor, "node_hook."+req.Action, node.ID, detail)
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	p.audit(acc.ID, actor, "node_hook."+req.Action, node.ID, detail)
+	p.touchNodeHook(acc, hook.ID, now)
+	writeJSON(w, http.StatusOK, p.drainStatus(node.ID))
+}
+
+// touchNodeHook 记录最近调用时间；持久化失败只记日志。
+func (p *Server) touchNodeHook(acc *Account, id string, now time.Time) {
+	if _, err := p.updateNodeHooks(acc, "", func(list []NodeHook) ([]NodeHook, error) {
+		for i := range list {
+			if list[i].ID == id {
+				at := now.UTC()
+				list[i].LastUsedAt = &at
+			}
+		}
+		return list, nil
+	}); err != nil {
+		p.logger.Printf("persist node hook usage for account %s failed: %v", acc.ID, err)
+	}
+}
+
+func trimNonEmpty(in []string) []string {
+	var out []string
+	for _, s := range in {
+		if s = strings.TrimSpace(s); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
@@ -24,6 +24,11 @@ func (p *Server) addNodeToAccount(acc *Account, name, rawURL, apiKey string, wei
 
 // 添加指定账号的节点并自定义健康检查方式。
 func (p *Server) addNodeWithMethod(acc *Account, name, rawURL, apiKey string, weight int, healthMethod string) (*Node, error) {
+	return p.addNodeWithOptions(acc, name, rawURL, apiKey, weight, healthMethod, nil, 0)
+}
+
+// addNodeWithOptions 创建节点，可附带自定义请求头与节点级健康检查间隔。
+func (p *Server) addNodeWithOptions(acc *Account, name, rawURL, apiKey string, weight int, healthMethod string, headers map[string]string, healthInterval time.Duration) (*Node, error) {
 	if acc == nil {
 		return nil, errors.New("account required")
 	}
@@ -51,20 +56,21 @@ func (p *Server) addNodeWithMethod(acc *Account, name, rawURL, apiKey string, we
 		healthMethod = HealthCheckMethodHEAD
 	}
 	id := fmt.Sprintf("n-%d", time.Now().UnixNano())
-	node := &Node{ID: id, Name: name, URL: u, APIKey: apiKey, HealthCheckMethod: healthMethod, AccountID: acc.ID, CreatedAt: time.Now(), Weight: weight}
+	node := &Node{ID: id, Name: name, URL: u, APIKey: apiKey, HealthCheckMethod: healthMethod, AccountID: acc.ID, CreatedAt: time.Now(), Weight: weight, Headers: headers, HealthInterval: healthInterval}
 
 	p.mu.Lock()
 	acc.Nodes[id] = node
 	p.nodeIndex[id] = node
 	p.nodeAccount[id] = acc
 	cur := acc.Nodes[acc.ActiveID]
-	curFailed := cur != nil && (cur.Failed || cur.Disabled)
-	needSwitch := cur == nil || curFailed || node.Weight < cur.Weight
+	curFailed := cur != nil && !nodeRoutable(cur)
+	needSwitch := cur == nil || curFailed || effectiveWeight(node) < effectiveWeight(cur)
 	var rec store.NodeRecord
 	if p.store != nil {
-		rec = store.NodeRecord{ID: id, Name: name, BaseURL: rawURL, APIKey: apiKey, HealthCheckMethod: healthMethod, AccountID: acc.ID, Weight: weight, CreatedAt: node.CreatedAt}
+		rec = store.NodeRecord{ID: id, Name: name, BaseURL: rawURL, APIKey: apiKey, HealthCheckMethod: healthMethod, AccountID: acc.ID, Weight: weight, CreatedAt: node.CreatedAt, Headers: headers, HealthIntervalSec: int(healthInterval / time.Second)}
 	}
 	p.mu.Unlock()
+	p.markNodeChanged(id)
 
 	if p.store != nil {
 		_ = p.store.UpsertNode(context.Background(), rec)
@@ -77,6 +83,7 @@ func (p *Server) addNodeWithMethod(acc *Account, name, rawURL, apiKey string, we
 			Title:      "节点新增",
 			Content:    fmt.Sprintf("**节点名称**: %s\n**地址**: %s\n**权重**: %d\n**时间**: %s", node.Name, node.URL.String(), node.Weight, timeutil.FormatBeijingTime(time.Now())),
 			DedupKey:   node.ID,
+			Node:       node.Name,
 			OccurredAt: time.Now(),
 		})
 	}
@@ -126,11 +133,19 @@ func (p *Server) updateNode(id, name, rawURL string, apiKey *string, weight int,
 		n.Name = name
 	}
 	n.URL = u
+	p.nodeTLS.rehost(id, u.Host)
 	n.APIKey = newAPIKey
+	if weight != oldWeight {
+		// 用户显式修改的权重优先，自适应调度从新权重重新起步。
+		n.AdaptiveWeight = 0
+	}
 	n.Weight = weight
 	n.HealthCheckMethod = desiredMethod
 	acc := p.nodeAccount[id]
 	p.mu.Unlock()
+	p.markNodeChanged(id)
+	// 地址、密钥或检查方式可能已变，缓存的按需检查结果不再可信。
+	p.healthProbes.forget(id)
 
 	if p.store != nil {
 		rec := toRecord(n)
@@ -146,6 +161,7 @@ func (p *Server) updateNode(id, name, rawURL string, apiKey *string, weight int,
 			Title:      "节点已更新",
 			Content:    fmt.Sprintf("**节点名称**: %s\n**地址**: %s\n**权重**: %d", n.Name, n.URL.String(), n.Weight),
 			DedupKey:   n.ID,
+			Node:       n.Name,
 			OccurredAt: time.Now(),
 		})
 	}
@@ -178,12 +194,29 @@ func (p *Server) deleteNode(id string) error {
 	delete(p.nodeIndex, id)
 	delete(p.nodeAccount, id)
 	p.mu.Unlock()
+	p.nodeChanges.mark(id, chooseNonEmpty(accID, n.AccountID), true)
+	p.healthProbes.forget(id)
 
 	if p.store != nil {
 		if err := p.store.DeleteNode(context.Background(), id); err != nil {
 			return err
 		}
 	}
+	if n.ClientCert != nil {
+		if err := p.removeNodeClientCert(id); err != nil {
+			p.logger.Printf("remove client cert of deleted node %s failed: %v", n.Name, err)
+		}
+	}
+	if n.CABundle != nil {
+		if err := p.removeNodeCABundle(id); err != nil {
+			p.logger.Printf("remove ca bundle of deleted node %s failed: %v", n.Name, err)
+		}
+	}
+	if n.DNS != nil {
+		if err := p.removeNodeDNS(id); err != nil {
+			p.logger.Printf("remove dns settings of deleted node %s failed: %v", n.Name, err)
+		}
+	}
 
 	if p.notifyMgr != nil && acc != nil {
 		baseURL := ""
@@ -196,6 +229,7 @@ func (p *Server) deleteNode(id string) error {
 			Title:      "节点已删除",
 			Content:    fmt.Sprintf("**节点名称**: %s\n**地址**: %s", n.Name, baseURL),
 			DedupKey:   n.ID,
+			Node:       n.Name,
 			OccurredAt: time.Now(),
 		})
 	}
@@ -214,10 +248,15 @@ func (p *Server) activate(id string) error {
 	if _, ok := acc.Nodes[id]; !ok {
 		return fmt.Errorf("node %s not found", id)
 	}
+	prevID := acc.ActiveID
 	acc.ActiveID = id
 	if p.store != nil {
 		_ = p.store.SetActive(context.Background(), acc.ID, id)
 	}
+	if prevID != id {
+		p.nodeChanges.mark(prevID, acc.ID, false)
+		p.nodeChanges.mark(id, acc.ID, false)
+	}
 	return nil
 }
 
@@ -236,7 +275,7 @@ func (p *Server) getActiveNodeForAccount(acc *Account) (*Node, error) {
 	p.mu.RLock()
 	activeID := acc.ActiveID
 	n, ok := acc.Nodes[activeID]
-	failed := ok && (n.Failed || n.Disabled)
+	failed := ok && !nodeRoutable(n)
 	p.mu.RUnlock()
 
 	if !ok || failed {
@@ -253,6 +292,39 @@ func (p *Server) getActiveNode(acc ...*Account) (*Node, error) {
 	return p.getActiveNodeForAccount(p.defaultAccount)
 }
 
+// bestRoutableNode 返回有效权重最低（最高优先级）的可路由节点，调用方需持有 p.mu。
+func bestRoutableNode(nodes map[string]*Node) (string, *Node) {
+	bestID := ""
+	var bestNode *Node
+	bestWeight := 0
+	for id, n := range nodes {
+		if !nodeRoutable(n) {
+			continue
+		}
+		// 按状态降权后的有效权重比较，degraded/failing 节点优先级降低。
+		w := effectiveWeight(n)
+		if bestNode == nil || w < bestWeight || (w == bestWeight && n.CreatedAt.Before(bestNode.CreatedAt)) {
+			bestWeight = w
+			bestNode = n
+			bestID = id
+		}
+	}
+	return bestID, bestNode
+}
+
+// bestRoutableNodeExcept 返回 excludeID 之外有效权重最低的可路由节点，用于预热分流与对冲备用节点，
+// 调用方需持有 p.mu。
+func bestRoutableNodeExcept(nodes map[string]*Node, excludeID string) *Node {
+	others := make(map[string]*Node, len(nodes))
+	for id, n := range nodes {
+		if id != excludeID {
+			others[id] = n
+		}
+	}
+	_, n := bestRoutableNode(others)
+	return n
+}
+
 // 选择最低权重（最高优先级）的健康节点并激活。
 func (p *Server) selectBestAndActivate(acc *Account, reason ...string) (*Node, error) {
 	if acc == nil {
@@ -266,17 +338,7 @@ func (p *Server) selectBestAndActivate(acc *Account, reason ...string) (*Node, e
 	p.mu.Lock()
 	prevID := acc.ActiveID
 	prevNode := acc.Nodes[prevID]
-	bestID := ""
-	var bestNode *Node
-	for id, n := range acc.Nodes {
-		if n.Failed || n.Disabled {
-			continue
-		}
-		if bestNode == nil || n.Weight < bestNode.Weight || (n.Weight == bestNode.Weight && n.CreatedAt.Before(bestNode.CreatedAt)) {
-			bestNode = n
-			bestID = id
-		}
-	}
+	bestID, bestNode := bestRoutableNode(acc.Nodes)
 	if bestNode == nil {
 		p.mu.Unlock()
 		return nil, ErrNoActiveNode
@@ -285,6 +347,10 @@ func (p *Server) selectBestAndActivate(acc *Account, reason ...string) (*Node, e
 	if p.store != nil {
 		_ = p.store.SetActive(context.Background(), acc.ID, bestID)
 	}
+	if prevID != bestID {
+		p.nodeChanges.mark(prevID, acc.ID, false)
+		p.nodeChanges.mark(bestID, acc.ID, false)
+	}
 	p.mu.Unlock()
 
 	if p.notifyMgr != nil && acc != nil && prevID != bestID {
@@ -298,6 +364,7 @@ func (p *Server) selectBestAndActivate(acc *Account, reason ...string) (*Node, e
 			Title:      "节点自动切换",
 			Content:    fmt.Sprintf("**从节点**: %s\n**到节点**: %s (权重: %d)\n**切换原因**: %s", chooseNonEmpty(fromName, "-"), bestNode.Name, bestNode.Weight, switchReason),
 			DedupKey:   fmt.Sprintf("switch:%s", acc.ID),
+			Node:       bestNode.Name,
 			OccurredAt: time.Now(),
 		})
 	}
@@ -314,9 +381,15 @@ func (p *Server) disableNode(id string) error {
 		return fmt.Errorf("node %s not found", id)
 	}
 	acc := p.nodeAccount[id]
+	fromState, stateChanged := setNodeState(n, NodeStateDisabled, time.Now())
 	n.Disabled = true
 	wasActive := acc != nil && id == acc.ActiveID
 	p.mu.Unlock()
+	if stateChanged {
+		p.onNodeStateChange(id, fromState, NodeStateDisabled)
+	} else {
+		p.markNodeChanged(id)
+	}
 
 	if p.store != nil {
 		rec := toRecord(n)
@@ -332,6 +405,7 @@ func (p *Server) disableNode(id string) error {
 			Title:      "节点已禁用",
 			Content:    fmt.Sprintf("**节点名称**: %s\n**操作**: 手动禁用", n.Name),
 			DedupKey:   n.ID,
+			Node:       n.Name,
 			OccurredAt: time.Now(),
 		})
 	}
@@ -353,6 +427,7 @@ func (p *Server) enableNode(id string) error {
 		return fmt.Errorf("node %s not found", id)
 	}
 	acc := p.nodeAccount[id]
+	fromState, stateChanged := setNodeState(n, NodeStateHealthy, time.Now())
 	n.Disabled = false
 	n.Failed = false
 	n.Metrics.FailStreak = 0
@@ -360,6 +435,11 @@ func (p *Server) enableNode(id string) error {
 		delete(acc.FailedSet, id)
 	}
 	p.mu.Unlock()
+	if stateChanged {
+		p.onNodeStateChange(id, fromState, NodeStateHealthy)
+	} else {
+		p.markNodeChanged(id)
+	}
 
 	if p.store != nil {
 		rec := toRecord(n)
@@ -375,21 +455,28 @@ func (p *Server) enableNode(id string) error {
 			Title:      "节点已启用",
 			Content:    fmt.Sprintf("**节点名称**: %s\n**权重**: %d", n.Name, n.Weight),
 			DedupKey:   n.ID,
+			Node:       n.Name,
 			OccurredAt: time.Now(),
 		})
 	}
 
 	// 检查是否需要切换到刚启用的节点（如果其优先级更高）
 	cur, _ := p.getActiveNodeForAccount(acc)
-	if cur == nil || cur.Failed || n.Weight < cur.Weight {
+	if cur == nil || !nodeRoutable(cur) || effectiveWeight(n) < effectiveWeight(cur) {
 		p.mu.Lock()
+		prevID := ""
 		if acc != nil {
+			prevID = acc.ActiveID
 			acc.ActiveID = id
 		}
 		if p.store != nil {
 			_ = p.store.SetActive(context.Background(), acc.ID, id)
 		}
 		p.mu.Unlock()
+		if acc != nil && prevID != id {
+			p.nodeChanges.mark(prevID, acc.ID, false)
+			p.nodeChanges.mark(id, acc.ID, false)
+		}
 		p.logger.Printf("auto-switch to enabled node %s (weight %d)", n.Name, n.Weight)
 	}
 	return nil
@@ -0,0 +1,142 @@
+package proxy
+
+import (
+	"net/http"
+	"time"
+
+	"qcc_plus/internal/timeutil"
+)
+
+// nodeMetricsSchemaVersion 节点状态载荷的结构版本。
+// 只新增字段时版本不变；字段改名、删除或语义变化时加 1，并在一个版本内保留旧字段供旧客户端过渡。
+const nodeMetricsSchemaVersion = 1
+
+// NodeMetrics 节点实时状态与指标。GET /api/nodes/:id/metrics 的 current、监控面板的节点条目与
+// WS node_metrics 广播共用该结构，前端只需一套解析逻辑。
+type NodeMetrics struct {
+	SchemaVersion int           `json:"schema_version"`
+	NodeID        string        `json:"node_id"`
+	NodeName      string        `json:"node_name"`
+	Status        string        `json:"status"` // 综合状态: online/degraded/offline/unknown/disabled
+	State         string        `json:"state"`  // 状态机状态: healthy/degraded/failing/down/disabled/draining
+	Traffic       ProxySummary  `json:"traffic"`
+	Health        HealthSummary `json:"health"`
+	Timestamp     string        `json:"timestamp"` // 最近健康检查时间，未检查时为生成时间
+}
+
+// nodeMetricsInput 生成 NodeMetrics 所需的节点快照。
+type nodeMetricsInput struct {
+	ID       string
+	Name     string
+	State    string
+	Failed   bool
+	Disabled bool
+	Method   string
+	Metrics  metrics
+}
+
+func buildNodeMetrics(in nodeMetricsInput, interval time.Duration, now time.Time) NodeMetrics {
+	health := summarizeHealth(in.Metrics, in.Method, interval, now)
+	timestamp := timeutil.FormatBeijingTime(now)
+	if health.LastCheckAt != nil {
+		timestamp = *health.LastCheckAt
+	}
+	return NodeMetrics{
+		SchemaVersion: nodeMetricsSchemaVersion,
+		NodeID:        in.ID,
+		NodeName:      in.Name,
+		Status:        overallNodeStatus(in.Disabled, in.Failed, health),
+		State:         in.State,
+		Traffic:       summarizeTraffic(in.Metrics),
+		Health:        health,
+		Timestamp:     timestamp,
+	}
+}
+
+// overallNodeStatus 综合启停、故障标记与健康检查结果得到节点状态。
+func overallNodeStatus(disabled, failed bool, health HealthSummary) string {
+	switch {
+	case disabled:
+		return "disabled"
+	case failed || health.Status == "down":
+		return "offline"
+	case health.Status == "stale":
+		return "degraded"
+	default:
+		return "online"
+	}
+}
+
+// nodeMetricsFor 读取节点当前状态，调用方不得持有 p.mu。
+func (p *Server) nodeMetricsFor(n *Node, now time.Time) NodeMetrics {
+	p.mu.RLock()
+	in := nodeMetricsInput{
+		ID:       n.ID,
+		Name:     n.Name,
+		State:    nodeState(n),
+		Failed:   n.Failed,
+		Disabled: n.Disabled,
+		Method:   n.HealthCheckMethod,
+		Metrics:  n.Metrics,
+	}
+	interval := p.healthEvery
+	if acc := p.nodeAccount[n.ID]; acc != nil && acc.Config.HealthEvery > 0 {
+		interval = acc.Config.HealthEvery
+	}
+	p.mu.RUnlock()
+	return buildNodeMetrics(in, interval, now)
+}
+
+// nodeMetricsJSONSchema 描述 NodeMetrics 的 JSON Schema，随 nodeMetricsSchemaVersion 演进。
+func nodeMetricsJSONSchema() map[string]interface{} {
+	str := map[string]interface{}{"type": "string"}
+	integer := map[string]interface{}{"type": "integer"}
+	number := map[string]interface{}{"type": "number"}
+	enum := func(values ...string) map[string]interface{} {
+		return map[string]interface{}{"type": "string", "enum": values}
+	}
+	return map[string]interface{}{
+		"$schema":  "https://json-schema.org/draft/2020-12/schema",
+		"$id":      "qcc_plus/node-metrics",
+		"title":    "NodeMetrics",
+		"type":     "object",
+		"required": []string{"schema_version", "node_id", "status", "traffic", "health", "timestamp"},
+		"properties": map[string]interface{}{
+			"schema_version": map[string]interface{}{"type": "integer", "const": nodeMetricsSchemaVersion},
+			"node_id":        str,
+			"node_name":      str,
+			"status":         enum("online", "degraded", "offline", "unknown", "disabled"),
+			"state":          str,
+			"timestamp":      str,
+			"traffic": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"success_rate":      number,
+					"avg_response_time": integer,
+					"total_requests":    integer,
+					"failed_requests":   integer,
+				},
+			},
+			"health": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"status":        enum("up", "down", "stale"),
+					"last_check_at": map[string]interface{}{"type": []string{"string", "null"}},
+					"last_ping_ms":  integer,
+					"last_ping_err": str,
+					"check_method":  str,
+				},
+			},
+		},
+	}
+}
+
+// GET /api/monitor/schema/node-metrics
+// 返回节点状态载荷的 JSON Schema 与当前版本。
+func (p *Server) handleNodeMetricsSchema(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, nodeMetricsJSONSchema())
+}
@@ -0,0 +1,116 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+const maxNodeOrderIDs = 5000
+
+// nodeOrderError 排序请求不合法（未列全节点、重复或不属于该账号），接口返回 400。
+type nodeOrderError struct{ msg string }
+
+func (e *nodeOrderError) Error() string { return e.msg }
+
+// reorderNodes 按 ids 顺序重排账号下的节点：权重依次设为 1..n（越小越优先），
+// ids 必须恰好包含账号下的全部节点各一次。存储层以单条语句批量更新。
+// 排序同时清除自适应调度的运行时权重，使新顺序立即生效。
+// 先写存储再修改内存，存储写入失败时内存中的顺序保持不变。
+func (p *Server) reorderNodes(acc *Account, ids []string) error {
+	if acc == nil {
+		return errors.New("account missing")
+	}
+	p.mu.RLock()
+	err := validateNodeOrder(acc, ids)
+	changed := false
+	if err == nil {
+		for i, id := range ids {
+			if n := acc.Nodes[id]; n.Weight != i+1 || n.AdaptiveWeight != 0 {
+				changed = true
+				break
+			}
+		}
+	}
+	p.mu.RUnlock()
+	if err != nil || !changed {
+		return err
+	}
+
+	if p.store != nil {
+		if err := p.store.UpdateNodeOrders(context.Background(), acc.ID, ids); err != nil {
+			return err
+		}
+	}
+	var updated []string
+	p.mu.Lock()
+	for i, id := range ids {
+		// 写入存储期间被删除的节点直接跳过
+		if n := acc.Nodes[id]; n != nil && (n.Weight != i+1 || n.AdaptiveWeight != 0) {
+			n.Weight = i + 1
+			n.AdaptiveWeight = 0
+			updated = append(updated, id)
+		}
+	}
+	p.mu.Unlock()
+	for _, id := range updated {
+		p.markNodeChanged(id)
+	}
+	_, _ = p.selectBestAndActivate(acc, "节点排序")
+	return nil
+}
+
+// validateNodeOrder 校验 ids 恰好列出账号下的全部节点各一次，调用方需持有 p.mu。
+func validateNodeOrder(acc *Account, ids []string) error {
+	if len(ids) != len(acc.Nodes) {
+		return &nodeOrderError{fmt.Sprintf("ids must list all %d nodes of the account", len(acc.Nodes))}
+	}
+	seen := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		if seen[id] {
+			return &nodeOrderError{fmt.Sprintf("duplicate node id %s", id)}
+		}
+		if acc.Nodes[id] == nil {
+			return &nodeOrderError{fmt.Sprintf("node %s not found in account", id)}
+		}
+		seen[id] = true
+	}
+	return nil
+}
+
+// PUT /api/nodes/order?account_id=xxx
+// 请求体: {"ids": ["node-a", "node-b", ...]}，按优先级从高到低列出账号下的全部节点。
+func (p *Server) handleNodeOrder(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	acc, ok := p.nodesAccount(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		IDs []string `json:"ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
+		return
+	}
+	if len(req.IDs) > maxNodeOrderIDs {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("too many ids (max %d)", maxNodeOrderIDs)})
+		return
+	}
+	if err := p.reorderNodes(acc, req.IDs); err != nil {
+		status := http.StatusInternalServerError
+		var invalid *nodeOrderError
+		if errors.As(err, &invalid) {
+			status = http.StatusBadRequest
+		}
+		writeJSON(w, status, map[string]string{"error": err.Error()})
+		return
+	}
+	p.audit(acc.ID, auditActor(r), "node.reorder", "", map[string]interface{}{"count": len(req.IDs)})
+	writeJSON(w, http.StatusOK, map[string]interface{}{"ids": req.IDs})
+}
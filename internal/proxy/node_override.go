@@ -0,0 +1,48 @@
+package proxy
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// nodeOverrideHeader 允许调试/评测请求绕过路由，强制使用指定节点（节点 ID 或名称）。
+const nodeOverrideHeader = "X-QCC-Node"
+
+// nodeOverrideAllowed 判断请求所用密钥是否允许指定节点：服务账号按其自身设置，账号密钥按
+// account.key_lifecycle 中的设置；未携带有效密钥（回落到默认账号）的请求一律不允许。
+func (p *Server) nodeOverrideAllowed(acc *Account, service *ServiceAccount, keyed bool) bool {
+	switch {
+	case service != nil:
+		return service.AllowNodeOverride
+	case keyed:
+		return p.accountKey(acc).AllowNodeOverride
+	default:
+		return false
+	}
+}
+
+// resolveNodeOverride 按密钥权限查找被指定的节点，失败时返回应答状态码。
+func (p *Server) resolveNodeOverride(acc *Account, allowed bool, ref string) (*Node, int, error) {
+	if !allowed {
+		return nil, http.StatusForbidden, errors.New("node override not permitted for this key")
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	n := acc.Nodes[ref]
+	if n == nil {
+		for _, candidate := range acc.Nodes {
+			if strings.EqualFold(candidate.Name, ref) {
+				n = candidate
+				break
+			}
+		}
+	}
+	if n == nil {
+		return nil, http.StatusNotFound, errors.New("override node not found")
+	}
+	if nodeState(n) == NodeStateDisabled {
+		return nil, http.StatusConflict, errors.New("override node is disabled")
+	}
+	return n, 0, nil
+}
@@ -0,0 +1,169 @@
+package proxy
+
+import (
+	"context"
+	"time"
+
+	"qcc_plus/internal/timeutil"
+)
+
+// 节点状态机中的显式状态。
+const (
+	NodeStateHealthy  = "healthy"  // 正常
+	NodeStateDegraded = "degraded" // 出现失败但未达阈值，降低优先级
+	NodeStateFailing  = "failing"  // 连续失败过半，进一步降权
+	NodeStateDown     = "down"     // 达到失败阈值，停止路由，等待探活恢复
+	NodeStateDisabled = "disabled" // 用户手动禁用
+	NodeStateDraining = "draining" // 排空中：不接新请求，等待存量请求结束
+)
+
+// nodeStateTransitions 定义允许的状态迁移；未列出的迁移会被忽略。
+var nodeStateTransitions = map[string][]string{
+	NodeStateHealthy:  {NodeStateDegraded, NodeStateFailing, NodeStateDown, NodeStateDisabled, NodeStateDraining},
+	NodeStateDegraded: {NodeStateHealthy, NodeStateFailing, NodeStateDown, NodeStateDisabled, NodeStateDraining},
+	NodeStateFailing:  {NodeStateHealthy, NodeStateDegraded, NodeStateDown, NodeStateDisabled, NodeStateDraining},
+	NodeStateDown:     {NodeStateHealthy, NodeStateDisabled, NodeStateDraining},
+	NodeStateDisabled: {NodeStateHealthy},
+	NodeStateDraining: {NodeStateHealthy, NodeStateDisabled},
+}
+
+// nodeStateWeightFactor 路由时的权重放大系数（权重越小优先级越高）。
+var nodeStateWeightFactor = map[string]int{
+	NodeStateHealthy:  1,
+	NodeStateDegraded: 2,
+	NodeStateFailing:  4,
+}
+
+func canTransitionNodeState(from, to string) bool {
+	if from == to {
+		return false
+	}
+	for _, s := range nodeStateTransitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// nodeState 返回节点当前状态；旧数据未设置状态时由 Failed/Disabled 推导。
+func nodeState(n *Node) string {
+	if n == nil {
+		return ""
+	}
+	if n.State != "" {
+		return n.State
+	}
+	switch {
+	case n.Disabled:
+		return NodeStateDisabled
+	case n.Failed:
+		return NodeStateDown
+	default:
+		return NodeStateHealthy
+	}
+}
+
+// setNodeState 按迁移规则更新状态（调用方需持有 p.mu 写锁），并同步兼容字段 Failed/Disabled。
+func setNodeState(n *Node, to string, now time.Time) (string, bool) {
+	from := nodeState(n)
+	if !canTransitionNodeState(from, to) {
+		return from, false
+	}
+	n.State = to
+	n.StateChangedAt = now
+	switch {
+	case from == NodeStateDown && to == NodeStateHealthy:
+		n.WarmupSince = now
+	case to == NodeStateDown || to == NodeStateDisabled || to == NodeStateDraining:
+		n.WarmupSince = time.Time{}
+	}
+	n.Failed = to == NodeStateDown
+	n.Disabled = to == NodeStateDisabled
+	return from, true
+}
+
+// setFaultState 仅在故障相关状态之间迁移，不影响禁用与排空中的节点。
+func setFaultState(n *Node, to string, now time.Time) (string, bool) {
+	cur := nodeState(n)
+	if cur == NodeStateDisabled || cur == NodeStateDraining {
+		return cur, false
+	}
+	return setNodeState(n, to, now)
+}
+
+// stateForFailStreak 根据连续失败次数计算应处的状态。
+func stateForFailStreak(streak int64, failLimit int) string {
+	if failLimit <= 0 {
+		failLimit = 3
+	}
+	switch {
+	case streak >= int64(failLimit):
+		return NodeStateDown
+	case failLimit > 2 && streak >= int64((failLimit+1)/2):
+		return NodeStateFailing
+	case streak > 0:
+		return NodeStateDegraded
+	default:
+		return NodeStateHealthy
+	}
+}
+
+// nodeRoutable 判断节点是否可承接新请求。
+func nodeRoutable(n *Node) bool {
+	_, ok := nodeStateWeightFactor[nodeState(n)]
+	return ok
+}
+
+// routingWeight 返回参与路由的基础权重：存在自适应权重时优先使用，否则为配置权重。
+func routingWeight(n *Node) int {
+	if n.AdaptiveWeight > 0 {
+		return n.AdaptiveWeight
+	}
+	return n.Weight
+}
+
+// effectiveWeight 返回按状态降权后的路由权重。
+func effectiveWeight(n *Node) int {
+	factor, ok := nodeStateWeightFactor[nodeState(n)]
+	if !ok {
+		factor = 1
+	}
+	w := routingWeight(n)
+	if w <= 0 {
+		w = 1
+	}
+	return w * factor
+}
+
+// onNodeStateChange 在状态迁移后持久化并推送事件（不可持有 p.mu 调用）。
+func (p *Server) onNodeStateChange(nodeID, from, to string) {
+	p.mu.RLock()
+	n := p.nodeIndex[nodeID]
+	acc := p.nodeAccount[nodeID]
+	if n == nil {
+		p.mu.RUnlock()
+		return
+	}
+	rec := toRecord(n)
+	name := n.Name
+	changedAt := n.StateChangedAt
+	p.mu.RUnlock()
+
+	p.markNodeChanged(nodeID)
+	if p.logger != nil {
+		p.logger.Printf("node %s state %s -> %s", name, from, to)
+	}
+	if p.store != nil {
+		_ = p.store.UpsertNode(context.Background(), rec)
+	}
+	if p.wsHub != nil && acc != nil {
+		p.wsHub.Broadcast(acc.ID, "node_state", map[string]interface{}{
+			"node_id":    nodeID,
+			"node_name":  name,
+			"from":       from,
+			"state":      to,
+			"changed_at": timeutil.FormatBeijingTime(changedAt),
+		})
+	}
+}
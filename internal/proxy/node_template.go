@@ -0,0 +1,250 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/textproto"
+	"sort"
+	"strings"
+	"time"
+
+	"qcc_plus/internal/store"
+)
+
+const (
+	nodeTemplateSettingKey = "node.template"
+	maxNodeHeaders         = 20
+	minNodeHealthInterval  = 5 * time.Second
+	maxNodeHealthInterval  = 24 * time.Hour
+)
+
+// reservedNodeHeaders 由代理自身维护的请求头，不允许通过节点配置覆盖。
+var reservedNodeHeaders = map[string]bool{
+	"Host":              true,
+	"Authorization":     true,
+	"X-Api-Key":         true,
+	"Content-Length":    true,
+	"Content-Type":      true,
+	"Transfer-Encoding": true,
+	"Connection":        true,
+	"Upgrade":           true,
+	nodeOverrideHeader:  true,
+	labelHeader:         true,
+	conversationHeader:  true,
+}
+
+// NodeTemplate 账号级节点默认配置，新建或导入节点时填充请求中未指定的字段，持久化为账号级配置 node.template。
+type NodeTemplate struct {
+	Weight            int               `json:"weight"`              // 默认权重，0 表示使用 1
+	HealthCheckMethod string            `json:"health_check_method"` // 默认健康检查方式，空表示使用全局默认
+	HealthIntervalSec int               `json:"health_interval_sec"` // 节点级健康检查间隔，0 表示沿用账号配置
+	Headers           map[string]string `json:"headers"`             // 转发与探活时附加的请求头
+}
+
+// normalizeNodeHeaders 校验并规范化节点请求头名称，返回新的 map。
+func normalizeNodeHeaders(headers map[string]string) (map[string]string, error) {
+	if len(headers) == 0 {
+		return nil, nil
+	}
+	if len(headers) > maxNodeHeaders {
+		return nil, fmt.Errorf("too many headers (max %d)", maxNodeHeaders)
+	}
+	out := make(map[string]string, len(headers))
+	for name, value := range headers {
+		name = strings.TrimSpace(name)
+		if name == "" || strings.ContainsAny(name, " \t\r\n:") {
+			return nil, fmt.Errorf("invalid header name: %q", name)
+		}
+		key := textproto.CanonicalMIMEHeaderKey(name)
+		if reservedNodeHeaders[key] {
+			return nil, fmt.Errorf("header %s is managed by the proxy", key)
+		}
+		if strings.ContainsAny(value, "\r\n") {
+			return nil, fmt.Errorf("invalid value for header %s", key)
+		}
+		out[key] = value
+	}
+	return out, nil
+}
+
+func validateNodeHealthInterval(sec int) error {
+	d := time.Duration(sec) * time.Second
+	if sec != 0 && (d < minNodeHealthInterval || d > maxNodeHealthInterval) {
+		return fmt.Errorf("health_interval_sec must be 0 or between %d and %d", int(minNodeHealthInterval/time.Second), int(maxNodeHealthInterval/time.Second))
+	}
+	return nil
+}
+
+// normalize 校验模板并返回规范化后的副本。
+func (t NodeTemplate) normalize() (NodeTemplate, error) {
+	if t.Weight < 0 {
+		return t, fmt.Errorf("weight must be non-negative")
+	}
+	if m := strings.ToLower(t.HealthCheckMethod); m != "" {
+		if m != HealthCheckMethodAPI && m != HealthCheckMethodHEAD && m != HealthCheckMethodCLI {
+			return t, fmt.Errorf("invalid health_check_method: %s", t.HealthCheckMethod)
+		}
+		t.HealthCheckMethod = m
+	}
+	if err := validateNodeHealthInterval(t.HealthIntervalSec); err != nil {
+		return t, err
+	}
+	headers, err := normalizeNodeHeaders(t.Headers)
+	if err != nil {
+		return t, err
+	}
+	t.Headers = headers
+	return t, nil
+}
+
+// apply 用模板填充请求中未指定的字段；请求头合并，同名时以请求为准。
+func (t NodeTemplate) apply(req nodeCreateRequest) nodeCreateRequest {
+	if req.Weight <= 0 {
+		req.Weight = t.Weight
+	}
+	if req.HealthCheckMethod == "" {
+		req.HealthCheckMethod = t.HealthCheckMethod
+	}
+	if req.HealthIntervalSec == 0 {
+		req.HealthIntervalSec = t.HealthIntervalSec
+	}
+	if len(t.Headers) > 0 {
+		merged := make(map[string]string, len(t.Headers)+len(req.Headers))
+		for k, v := range t.Headers {
+			merged[k] = v
+		}
+		for k, v := range req.Headers {
+			merged[textproto.CanonicalMIMEHeaderKey(strings.TrimSpace(k))] = v
+		}
+		req.Headers = merged
+	}
+	return req
+}
+
+// applyNodeHeaders 为发往节点的请求附加节点自定义请求头，需在设置鉴权头之前调用。
+func applyNodeHeaders(h http.Header, headers map[string]string) {
+	for k, v := range headers {
+		h.Set(k, v)
+	}
+}
+
+// nodeHeaderNames 返回节点自定义请求头名称（不含取值，避免泄露其中的凭据）。
+func nodeHeaderNames(headers map[string]string) []string {
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// nodeTemplate 返回账号节点模板副本。
+func (p *Server) nodeTemplate(acc *Account) NodeTemplate {
+	if acc == nil {
+		return NodeTemplate{}
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return acc.NodeTemplate
+}
+
+// loadNodeTemplate 从配置表读取账号节点模板，不存在或无效时返回零值。
+func (p *Server) loadNodeTemplate(accountID string) NodeTemplate {
+	var tmpl NodeTemplate
+	if p.store == nil {
+		return tmpl
+	}
+	setting, err := p.store.GetSetting(nodeTemplateSettingKey, "account", accountID)
+	if err != nil || setting == nil {
+		return tmpl
+	}
+	if b, err := json.Marshal(setting.Value); err == nil {
+		_ = json.Unmarshal(b, &tmpl)
+	}
+	if tmpl, err = tmpl.normalize(); err != nil {
+		p.logger.Printf("account %s node template ignored: %v", accountID, err)
+		return NodeTemplate{}
+	}
+	return tmpl
+}
+
+// setNodeTemplate 更新内存中的账号节点模板并持久化；reset 时删除账号配置。
+func (p *Server) setNodeTemplate(accountID string, tmpl NodeTemplate, reset bool, updatedBy string) error {
+	if p.store != nil {
+		if reset {
+			if err := p.store.DeleteSetting(nodeTemplateSettingKey, "account", accountID); err != nil && !errors.Is(err, store.ErrNotFound) {
+				return err
+			}
+		} else {
+			id := accountID
+			desc := "账号节点默认配置模板"
+			setting := &store.Setting{
+				Key:         nodeTemplateSettingKey,
+				Scope:       "account",
+				AccountID:   &id,
+				Value:       tmpl,
+				DataType:    "object",
+				Category:    "health",
+				Description: &desc,
+			}
+			if updatedBy != "" {
+				setting.UpdatedBy = &updatedBy
+			}
+			if err := p.store.UpsertSetting(setting); err != nil {
+				return err
+			}
+		}
+	}
+	p.mu.Lock()
+	if acc := p.accountByID[accountID]; acc != nil {
+		acc.NodeTemplate = tmpl
+	}
+	p.mu.Unlock()
+	return nil
+}
+
+// GET/PUT/DELETE /api/nodes/template?account_id=
+// PUT 整体替换模板，DELETE 清空模板。
+func (p *Server) handleNodeTemplate(w http.ResponseWriter, r *http.Request) {
+	acc, ok := p.nodesAccount(w, r)
+	if !ok {
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, map[string]interface{}{"account_id": acc.ID, "template": p.nodeTemplate(acc)})
+	case http.MethodPut:
+		var tmpl NodeTemplate
+		if err := json.NewDecoder(r.Body).Decode(&tmpl); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
+			return
+		}
+		tmpl, err := tmpl.normalize()
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		if err := p.setNodeTemplate(acc.ID, tmpl, false, auditActor(r)); err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		p.audit(acc.ID, auditActor(r), "node.template.update", acc.ID, map[string]interface{}{
+			"weight":              tmpl.Weight,
+			"health_check_method": tmpl.HealthCheckMethod,
+			"health_interval_sec": tmpl.HealthIntervalSec,
+			"headers":             nodeHeaderNames(tmpl.Headers),
+		})
+		writeJSON(w, http.StatusOK, map[string]interface{}{"account_id": acc.ID, "template": tmpl})
+	case http.MethodDelete:
+		if err := p.setNodeTemplate(acc.ID, NodeTemplate{}, true, auditActor(r)); err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		p.audit(acc.ID, auditActor(r), "node.template.reset", acc.ID, nil)
+		writeJSON(w, http.StatusOK, map[string]interface{}{"account_id": acc.ID, "template": NodeTemplate{}})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
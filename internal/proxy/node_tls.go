@@ -0,0 +1,429 @@
+package proxy
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"qcc_plus/internal/store"
+)
+
+const (
+	maxCABundlePEMBytes = 256 * 1024
+	nodeTLSTestTimeout  = 10 * time.Second
+)
+
+// nodeTLSTransport 为配置了客户端证书、自定义 CA 或解析设置的节点使用独立的传输层，其余请求走默认传输层。
+// 代理转发按请求上下文中的节点匹配；健康检查、压测等直连请求不带节点上下文，按目标地址匹配。
+type nodeTLSTransport struct {
+	base http.RoundTripper
+	dns  *dnsCache
+	dial dialPolicy // 部署级拨号参数，节点设置在此基础上覆盖
+
+	mu    sync.RWMutex
+	nodes map[string]*nodeTLSRoute // nodeID -> 路由
+}
+
+type nodeTLSRoute struct {
+	host  string
+	cert  *tls.Certificate
+	roots *x509.CertPool
+	dns   *nodeDNS
+	rt    *http.Transport
+}
+
+func newNodeTLSTransport(base http.RoundTripper, dial dialPolicy) *nodeTLSTransport {
+	return &nodeTLSTransport{base: base, dns: newDNSCache(), dial: dial, nodes: make(map[string]*nodeTLSRoute)}
+}
+
+// roundTripper 基于默认传输层构建带指定证书、信任根与解析设置的传输层。
+func (t *nodeTLSTransport) roundTripper(route nodeTLSRoute) *http.Transport {
+	var rt *http.Transport
+	if bt, ok := t.base.(*http.Transport); ok {
+		rt = bt.Clone()
+	} else {
+		rt = http.DefaultTransport.(*http.Transport).Clone()
+	}
+	if rt.TLSClientConfig == nil {
+		rt.TLSClientConfig = &tls.Config{}
+	}
+	if route.cert != nil {
+		rt.TLSClientConfig.Certificates = []tls.Certificate{*route.cert}
+	}
+	if route.roots != nil {
+		rt.TLSClientConfig.RootCAs = route.roots
+	}
+	if cfg := route.dns; cfg != nil {
+		policy := t.dial.withNode(cfg)
+		if cfg.overridesDial() {
+			rt.DialContext = policy.dialContext()
+		}
+		if cfg.overridesResolution() {
+			rt.DialContext = t.dns.dialContext(cfg, policy.preferIPv6(), rt.DialContext)
+		}
+	}
+	return rt
+}
+
+// update 修改节点的 TLS 配置并重建传输层；替换时关闭旧连接，保证之后的请求按新配置握手。
+// host 为空时沿用已有的主机名。
+func (t *nodeTLSTransport) update(nodeID, host string, fn func(r *nodeTLSRoute)) {
+	t.mu.Lock()
+	old := t.nodes[nodeID]
+	next := &nodeTLSRoute{host: host}
+	if old != nil {
+		next.cert, next.roots, next.dns = old.cert, old.roots, old.dns
+		if host == "" {
+			next.host = old.host
+		}
+	}
+	fn(next)
+	if next.cert == nil && next.roots == nil && next.dns == nil {
+		delete(t.nodes, nodeID)
+	} else {
+		next.rt = t.roundTripper(*next)
+		t.nodes[nodeID] = next
+	}
+	t.mu.Unlock()
+	if old != nil {
+		old.rt.CloseIdleConnections()
+	}
+}
+
+// setClientCert 安装或（cert 为 nil 时）移除节点的客户端证书。
+func (t *nodeTLSTransport) setClientCert(nodeID, host string, cert *tls.Certificate) {
+	t.update(nodeID, host, func(r *nodeTLSRoute) { r.cert = cert })
+}
+
+// setRootCAs 安装或（roots 为 nil 时）移除节点信任的自定义 CA。
+func (t *nodeTLSTransport) setRootCAs(nodeID, host string, roots *x509.CertPool) {
+	t.update(nodeID, host, func(r *nodeTLSRoute) { r.roots = roots })
+}
+
+// setDNS 安装或（cfg 为 nil 时）移除节点的解析设置。
+func (t *nodeTLSTransport) setDNS(nodeID, host string, cfg *nodeDNS) {
+	t.update(nodeID, host, func(r *nodeTLSRoute) { r.dns = cfg })
+}
+
+// settings 返回节点当前的连接配置（不含传输层）。
+func (t *nodeTLSTransport) settings(nodeID string) nodeTLSRoute {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if r := t.nodes[nodeID]; r != nil {
+		return nodeTLSRoute{host: r.host, cert: r.cert, roots: r.roots, dns: r.dns}
+	}
+	return nodeTLSRoute{}
+}
+
+// rehost 节点地址变更后更新按地址匹配所用的主机名。
+func (t *nodeTLSTransport) rehost(nodeID, host string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if r := t.nodes[nodeID]; r != nil {
+		r.host = host
+	}
+}
+
+func (t *nodeTLSTransport) route(req *http.Request) http.RoundTripper {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if len(t.nodes) == 0 {
+		return t.base
+	}
+	if n := nodeFromCtx(req); n != nil {
+		if r := t.nodes[n.ID]; r != nil && r.host == req.URL.Host {
+			return r.rt
+		}
+	}
+	for _, r := range t.nodes {
+		if r.host == req.URL.Host {
+			return r.rt
+		}
+	}
+	return t.base
+}
+
+func (t *nodeTLSTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.route(req).RoundTrip(req)
+}
+
+// nodeCABundle 节点自定义 CA 的展示信息。
+type nodeCABundle struct {
+	Subjects    []string  `json:"subjects"`
+	Fingerprint string    `json:"fingerprint"` // PEM 中全部证书 DER 拼接后的 SHA-256
+	NotAfter    time.Time `json:"not_after"`   // 最早到期的证书
+	UpdatedAt   time.Time `json:"updated_at"`
+	UpdatedBy   string    `json:"updated_by,omitempty"`
+}
+
+func (b *nodeCABundle) view(now time.Time) map[string]interface{} {
+	return map[string]interface{}{
+		"subjects":    b.Subjects,
+		"fingerprint": b.Fingerprint,
+		"not_after":   b.NotAfter,
+		"expired":     !now.Before(b.NotAfter),
+		"updated_at":  b.UpdatedAt,
+		"updated_by":  b.UpdatedBy,
+	}
+}
+
+// parseCABundle 解析 PEM 中的 CA 证书，至少包含一张证书且不允许夹带私钥等其他内容。
+func parseCABundle(data string) (*x509.CertPool, *nodeCABundle, error) {
+	if len(data) > maxCABundlePEMBytes {
+		return nil, nil, errors.New("ca bundle too large")
+	}
+	pool := x509.NewCertPool()
+	info := &nodeCABundle{}
+	h := sha256.New()
+	rest := []byte(data)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			return nil, nil, fmt.Errorf("unexpected PEM block %q: only CERTIFICATE blocks are allowed", block.Type)
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid certificate: %v", err)
+		}
+		pool.AddCert(cert)
+		h.Write(cert.Raw)
+		info.Subjects = append(info.Subjects, cert.Subject.String())
+		if info.NotAfter.IsZero() || cert.NotAfter.Before(info.NotAfter) {
+			info.NotAfter = cert.NotAfter.UTC()
+		}
+	}
+	if strings.TrimSpace(string(rest)) != "" {
+		return nil, nil, errors.New("ca bundle contains data that is not PEM encoded")
+	}
+	if len(info.Subjects) == 0 {
+		return nil, nil, errors.New("ca bundle contains no certificates")
+	}
+	info.Fingerprint = hex.EncodeToString(h.Sum(nil))
+	return pool, info, nil
+}
+
+// nodeTLSTestResult 节点 TLS 连通性测试结果。
+type nodeTLSTestResult struct {
+	OK         bool     `json:"ok"`
+	Status     int      `json:"status,omitempty"`
+	LatencyMs  int64    `json:"latency_ms"`
+	TLSVersion string   `json:"tls_version,omitempty"`
+	PeerChain  []string `json:"peer_chain,omitempty"` // 上游证书链主题，便于排查信任配置
+	Error      string   `json:"error,omitempty"`
+}
+
+// testNodeTLS 以给定的信任根（nil 表示沿用当前配置）向节点地址发起请求，只要完成 TLS 握手并收到 HTTP 响应即视为通过。
+func (p *Server) testNodeTLS(ctx context.Context, node Node, roots *x509.CertPool) nodeTLSTestResult {
+	var res nodeTLSTestResult
+	route := p.nodeTLS.settings(node.ID)
+	if roots != nil {
+		route.roots = roots
+	}
+	rt := p.nodeTLS.roundTripper(route)
+	defer rt.CloseIdleConnections()
+	ctx, cancel := context.WithTimeout(ctx, nodeTLSTestTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, node.URL.String(), nil)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	applyNodeHeaders(req.Header, node.Headers)
+	start := time.Now()
+	resp, err := rt.RoundTrip(req)
+	res.LatencyMs = time.Since(start).Milliseconds()
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	resp.Body.Close()
+	res.OK, res.Status = true, resp.StatusCode
+	if resp.TLS != nil {
+		res.TLSVersion = tls.VersionName(resp.TLS.Version)
+		for _, c := range resp.TLS.PeerCertificates {
+			res.PeerChain = append(res.PeerChain, c.Subject.String())
+		}
+	}
+	return res
+}
+
+// loadNodeCABundles 启动时安装账号下节点的自定义 CA。
+func (p *Server) loadNodeCABundles(acc *Account) {
+	if p.store == nil {
+		return
+	}
+	recs, err := p.store.ListNodeCABundles(context.Background(), acc.ID)
+	if err != nil {
+		p.logger.Printf("load ca bundles for account %s failed: %v", acc.ID, err)
+		return
+	}
+	for _, rec := range recs {
+		n := acc.Nodes[rec.NodeID]
+		if n == nil {
+			continue
+		}
+		pool, info, err := parseCABundle(rec.PEM)
+		if err != nil {
+			p.logger.Printf("ca bundle for node %s ignored: %v", n.Name, err)
+			continue
+		}
+		info.UpdatedAt, info.UpdatedBy = rec.UpdatedAt, rec.UpdatedBy
+		p.nodeTLS.setRootCAs(n.ID, n.URL.Host, pool)
+		n.CABundle = info
+	}
+}
+
+// removeNodeCABundle 卸载并删除节点的自定义 CA，恢复使用系统根证书。
+func (p *Server) removeNodeCABundle(nodeID string) error {
+	if p.store != nil {
+		if err := p.store.DeleteNodeCABundle(context.Background(), nodeID); err != nil {
+			return err
+		}
+	}
+	p.nodeTLS.setRootCAs(nodeID, "", nil)
+	p.mu.Lock()
+	if n := p.nodeIndex[nodeID]; n != nil {
+		n.CABundle = nil
+	}
+	p.mu.Unlock()
+	return nil
+}
+
+// GET    /api/nodes/:id/ca-bundle 查看节点信任的自定义 CA
+// PUT    /api/nodes/:id/ca-bundle {"ca_pem":"..."}，保存前用新 CA 测试连通，失败时不保存
+// DELETE /api/nodes/:id/ca-bundle 恢复使用系统根证书
+func (p *Server) handleNodeCABundle(w http.ResponseWriter, r *http.Request) {
+	caller := accountFromCtx(r)
+	if caller == nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		return
+	}
+	snapshot, ok := p.benchmarkNodeForCaller(w, r, caller, "/ca-bundle")
+	if !ok {
+		return
+	}
+	now := time.Now()
+	switch r.Method {
+	case http.MethodGet:
+		var bundle interface{}
+		p.mu.RLock()
+		if n := p.nodeIndex[snapshot.ID]; n != nil && n.CABundle != nil {
+			bundle = n.CABundle.view(now)
+		}
+		p.mu.RUnlock()
+		writeJSON(w, http.StatusOK, map[string]interface{}{"node_id": snapshot.ID, "ca_bundle": bundle})
+	case http.MethodPut:
+		var req struct {
+			CAPEM string `json:"ca_pem"`
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 2*maxCABundlePEMBytes)).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
+			return
+		}
+		if snapshot.URL == nil || snapshot.URL.Scheme != "https" {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "ca bundles require an https base_url"})
+			return
+		}
+		pool, info, err := parseCABundle(req.CAPEM)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		test := p.testNodeTLS(r.Context(), snapshot, pool)
+		if !test.OK {
+			writeJSON(w, http.StatusBadRequest, map[string]interface{}{"error": "tls test with the new ca bundle failed: " + test.Error, "test": test})
+			return
+		}
+		actor := auditActor(r)
+		info.UpdatedAt, info.UpdatedBy = now.UTC(), actor
+		if p.store != nil {
+			if err := p.store.SaveNodeCABundle(r.Context(), store.NodeCABundleRecord{
+				NodeID:      snapshot.ID,
+				AccountID:   snapshot.AccountID,
+				PEM:         req.CAPEM,
+				Subjects:    strings.Join(info.Subjects, "\n"),
+				Fingerprint: info.Fingerprint,
+				NotAfter:    info.NotAfter,
+				UpdatedBy:   actor,
+				UpdatedAt:   info.UpdatedAt,
+			}); err != nil {
+				writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+				return
+			}
+		}
+		p.nodeTLS.setRootCAs(snapshot.ID, snapshot.URL.Host, pool)
+		p.mu.Lock()
+		if n := p.nodeIndex[snapshot.ID]; n != nil {
+			n.CABundle = info
+		}
+		p.mu.Unlock()
+		p.healthProbes.forget(snapshot.ID)
+		p.markNodeChanged(snapshot.ID)
+		p.audit(snapshot.AccountID, actor, "node.ca_bundle.update", snapshot.ID, map[string]interface{}{
+			"fingerprint": info.Fingerprint,
+			"subjects":    info.Subjects,
+		})
+		writeJSON(w, http.StatusOK, map[string]interface{}{"node_id": snapshot.ID, "ca_bundle": info.view(now), "test": test})
+	case http.MethodDelete:
+		if err := p.removeNodeCABundle(snapshot.ID); err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		p.healthProbes.forget(snapshot.ID)
+		p.markNodeChanged(snapshot.ID)
+		p.audit(snapshot.AccountID, auditActor(r), "node.ca_bundle.delete", snapshot.ID, nil)
+		writeJSON(w, http.StatusOK, map[string]interface{}{"node_id": snapshot.ID, "ca_bundle": nil})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// POST /api/nodes/:id/tls-test {"ca_pem":"..."}
+// 测试节点的 TLS 连通性；提供 ca_pem 时用该 CA 试连而不保存，便于保存前验证。
+func (p *Server) handleNodeTLSTest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	caller := accountFromCtx(r)
+	if caller == nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		return
+	}
+	snapshot, ok := p.benchmarkNodeForCaller(w, r, caller, "/tls-test")
+	if !ok {
+		return
+	}
+	var req struct {
+		CAPEM string `json:"ca_pem"`
+	}
+	if r.Body != nil && r.ContentLength != 0 {
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 2*maxCABundlePEMBytes)).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
+			return
+		}
+	}
+	var pool *x509.CertPool
+	if strings.TrimSpace(req.CAPEM) != "" {
+		var err error
+		if pool, _, err = parseCABundle(req.CAPEM); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, p.testNodeTLS(r.Context(), snapshot, pool))
+}
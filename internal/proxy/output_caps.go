@@ -0,0 +1,131 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// 输出上限的处理方式。
+const (
+	outputCapClamp  = "clamp"  // 将请求的 max_tokens 压到上限（默认）
+	outputCapReject = "reject" // 超限直接返回结构化错误
+)
+
+const maxTokensClampedHeader = "X-QCC-Max-Tokens-Clamped"
+
+// applyOutputCaps 按账号策略限制 max_tokens；请求被拒绝时已写出响应并返回 true。
+func (p *Server) applyOutputCaps(w http.ResponseWriter, r *http.Request, acc *Account) bool {
+	policy := p.accountPolicy(acc)
+	limit := policy.MaxOutputTokens
+	if limit <= 0 || r.Method != http.MethodPost ||
+		!strings.Contains(strings.ToLower(r.Header.Get("Content-Type")), "application/json") {
+		return false
+	}
+	body, err := peekBody(r)
+	if err != nil || len(body) == 0 {
+		return false
+	}
+	var payload map[string]any
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return false
+	}
+	requested, hasMax := payload["max_tokens"].(float64)
+	if hasMax && int(requested) <= limit {
+		return false
+	}
+	if hasMax && strings.EqualFold(policy.CapMode, outputCapReject) {
+		writeProxyError(w, http.StatusBadRequest, "max_tokens_exceeded",
+			fmt.Sprintf("max_tokens %d exceeds the limit %d for this key", int(requested), limit),
+			map[string]any{"requested": int(requested), "limit": limit})
+		return true
+	}
+
+	payload["max_tokens"] = limit
+	rewritten, err := json.Marshal(payload)
+	if err != nil {
+		return false
+	}
+	r.Body = io.NopCloser(bytes.NewReader(rewritten))
+	r.ContentLength = int64(len(rewritten))
+	r.Header.Set("Content-Length", strconv.Itoa(len(rewritten)))
+	if hasMax {
+		w.Header().Set(maxTokensClampedHeader, fmt.Sprintf("requested=%d; limit=%d", int(requested), limit))
+	} else {
+		w.Header().Set(maxTokensClampedHeader, fmt.Sprintf("requested=none; limit=%d", limit))
+	}
+	return false
+}
+
+// responseCapWriter 在响应体超过上限后丢弃后续内容；SSE 响应会追加一条 error 事件。
+// 不向 ReverseProxy 返回写错误，避免其 panic 中断后续的指标与日志记录。
+type responseCapWriter struct {
+	http.ResponseWriter
+	limit       int64
+	written     int64
+	exceeded    bool
+	wroteHeader bool
+}
+
+// WriteHeader 在声明长度超过上限（或无法解析）时删除 Content-Length：截断后实际字节数
+// 与声明不符会使客户端读取失败，改为按连接关闭/分块结束响应体。
+func (c *responseCapWriter) WriteHeader(code int) {
+	if !c.wroteHeader {
+		c.wroteHeader = true
+		if v := c.Header().Get("Content-Length"); v != "" {
+			if n, err := strconv.ParseInt(v, 10, 64); err != nil || n > c.limit {
+				c.Header().Del("Content-Length")
+			}
+		}
+	}
+	c.ResponseWriter.WriteHeader(code)
+}
+
+func (c *responseCapWriter) Write(b []byte) (int, error) {
+	if !c.wroteHeader {
+		c.WriteHeader(http.StatusOK)
+	}
+	if c.exceeded {
+		return len(b), nil
+	}
+	if c.written+int64(len(b)) <= c.limit {
+		n, err := c.ResponseWriter.Write(b)
+		c.written += int64(n)
+		return n, err
+	}
+	c.exceeded = true
+	if strings.HasPrefix(c.Header().Get("Content-Type"), "text/event-stream") {
+		msg, _ := json.Marshal(map[string]any{
+			"type": "error",
+			"error": map[string]any{
+				"type":    "response_too_large",
+				"message": fmt.Sprintf("response exceeded the %d byte limit for this key", c.limit),
+			},
+		})
+		_, _ = fmt.Fprintf(c.ResponseWriter, "\n\nevent: error\ndata: %s\n\n", msg)
+		c.Flush()
+	}
+	return len(b), nil
+}
+
+func (c *responseCapWriter) Flush() {
+	if f, ok := c.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (c *responseCapWriter) Unwrap() http.ResponseWriter { return c.ResponseWriter }
+
+// wrapResponseCap 在账号配置了响应大小上限时包装 ResponseWriter。
+func (p *Server) wrapResponseCap(w http.ResponseWriter, acc *Account) (http.ResponseWriter, *responseCapWriter) {
+	limit := p.accountPolicy(acc).MaxResponseBytes
+	if limit <= 0 {
+		return w, nil
+	}
+	cw := &responseCapWriter{ResponseWriter: w, limit: limit}
+	return cw, cw
+}
@@ -0,0 +1,75 @@
+package proxy
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	passwordHashScheme = "pbkdf2-sha256"
+	passwordHashIter   = 100000
+	passwordSaltBytes  = 16
+	passwordKeyBytes   = 32
+)
+
+// hashPassword 以 PBKDF2-HMAC-SHA256 生成口令哈希，格式为 scheme$iter$salt$hash。
+func hashPassword(password string) string {
+	salt, _ := hex.DecodeString(randomToken(passwordSaltBytes))
+	key := pbkdf2SHA256([]byte(password), salt, passwordHashIter, passwordKeyBytes)
+	return fmt.Sprintf("%s$%d$%x$%x", passwordHashScheme, passwordHashIter, salt, key)
+}
+
+// checkPassword 校验口令是否与 hashPassword 生成的哈希匹配。
+func checkPassword(encoded, password string) bool {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 4 || parts[0] != passwordHashScheme {
+		return false
+	}
+	iter, err := strconv.Atoi(parts[1])
+	if err != nil || iter <= 0 {
+		return false
+	}
+	salt, err := hex.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	want, err := hex.DecodeString(parts[3])
+	if err != nil || len(want) == 0 {
+		return false
+	}
+	got := pbkdf2SHA256([]byte(password), salt, iter, len(want))
+	return subtle.ConstantTimeCompare(got, want) == 1
+}
+
+// pbkdf2SHA256 按 RFC 8018 派生密钥。
+func pbkdf2SHA256(password, salt []byte, iter, keyLen int) []byte {
+	prf := hmac.New(sha256.New, password)
+	hashLen := prf.Size()
+	blocks := (keyLen + hashLen - 1) / hashLen
+	out := make([]byte, 0, blocks*hashLen)
+	var counter [4]byte
+	for block := 1; block <= blocks; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		binary.BigEndian.PutUint32(counter[:], uint32(block))
+		prf.Write(counter[:])
+		u := prf.Sum(nil)
+		t := append([]byte(nil), u...)
+		for n := 2; n <= iter; n++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for i := range t {
+				t[i] ^= u[i]
+			}
+		}
+		out = append(out, t...)
+	}
+	return out[:keyLen]
+}
@@ -0,0 +1,301 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+
+	"qcc_plus/internal/store"
+)
+
+const (
+	accountPasswordSettingKey = "account.password_meta"
+	passwordChangePath        = "/api/auth/password"
+	passwordExpiredHeader     = "X-QCC-Password-Expired"
+	defaultPasswordMinLength  = 6
+)
+
+// passwordPolicy 口令复杂度与轮换规则，由系统配置 password.* 驱动。
+type passwordPolicy struct {
+	MinLength     int
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+	History       int // 禁止与最近 N 次使用过的口令相同，0 表示不检查
+	MaxAgeDays    int // 口令使用超过该天数后下次登录须修改，0 表示不限制
+}
+
+func (p *Server) passwordPolicy() passwordPolicy {
+	policy := passwordPolicy{MinLength: defaultPasswordMinLength}
+	if p.settingsCache == nil {
+		return policy
+	}
+	if n := p.settingsCache.GetInt("password.min_length", defaultPasswordMinLength); n > 0 {
+		policy.MinLength = n
+	}
+	policy.RequireUpper = p.settingsCache.GetBool("password.require_upper", false)
+	policy.RequireLower = p.settingsCache.GetBool("password.require_lower", false)
+	policy.RequireDigit = p.settingsCache.GetBool("password.require_digit", false)
+	policy.RequireSymbol = p.settingsCache.GetBool("password.require_symbol", false)
+	if n := p.settingsCache.GetInt("password.history", 0); n > 0 {
+		policy.History = n
+	}
+	if n := p.settingsCache.GetInt("password.max_age_days", 0); n > 0 {
+		policy.MaxAgeDays = n
+	}
+	return policy
+}
+
+// validate 检查口令长度与字符类别。
+func (pp passwordPolicy) validate(password string) error {
+	if len([]rune(password)) < pp.MinLength {
+		return fmt.Errorf("密码至少%d位", pp.MinLength)
+	}
+	var upper, lower, digit, symbol bool
+	for _, c := range password {
+		switch {
+		case unicode.IsUpper(c):
+			upper = true
+		case unicode.IsLower(c):
+			lower = true
+		case unicode.IsDigit(c):
+			digit = true
+		case unicode.IsPunct(c) || unicode.IsSymbol(c):
+			symbol = true
+		}
+	}
+	var missing []string
+	if pp.RequireUpper && !upper {
+		missing = append(missing, "大写字母")
+	}
+	if pp.RequireLower && !lower {
+		missing = append(missing, "小写字母")
+	}
+	if pp.RequireDigit && !digit {
+		missing = append(missing, "数字")
+	}
+	if pp.RequireSymbol && !symbol {
+		missing = append(missing, "特殊字符")
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("密码需包含%s", strings.Join(missing, "、"))
+	}
+	return nil
+}
+
+var errPasswordReused = errors.New("不能使用最近用过的密码")
+
+// passwordMeta 口令修改时间与历史哈希，用于强制轮换与防止重复使用。
+type passwordMeta struct {
+	ChangedAt *time.Time `json:"changed_at,omitempty"`
+	History   []string   `json:"history,omitempty"` // 旧口令哈希，最新的在前
+}
+
+// reused 判断新口令是否与最近 n 个历史口令之一相同（当前口令由调用方单独比较）。
+func (m passwordMeta) reused(password string, n int) bool {
+	for i, h := range m.History {
+		if i >= n {
+			break
+		}
+		if checkPassword(h, password) {
+			return true
+		}
+	}
+	return false
+}
+
+// record 记录一次口令修改，旧口令哈希进入历史，最多保留 keep 个。
+func (m *passwordMeta) record(oldHash string, keep int, now time.Time) {
+	m.ChangedAt = &now
+	if oldHash != "" && keep > 0 {
+		m.History = append([]string{oldHash}, m.History...)
+	}
+	if len(m.History) > keep {
+		m.History = m.History[:keep]
+	}
+}
+
+// expired 判断口令是否超过最长使用期限；从未记录修改时间的口令不视为过期。
+func (m passwordMeta) expired(policy passwordPolicy, now time.Time) bool {
+	return policy.MaxAgeDays > 0 && m.ChangedAt != nil &&
+		now.Sub(*m.ChangedAt) >= time.Duration(policy.MaxAgeDays)*24*time.Hour
+}
+
+func (p *Server) loadPasswordMeta(accountID string) passwordMeta {
+	var meta passwordMeta
+	if p.store == nil {
+		return meta
+	}
+	setting, err := p.store.GetSetting(accountPasswordSettingKey, "account", accountID)
+	if err != nil || setting == nil {
+		return meta
+	}
+	if b, err := json.Marshal(setting.Value); err == nil {
+		_ = json.Unmarshal(b, &meta)
+	}
+	return meta
+}
+
+func (p *Server) persistPasswordMeta(accountID string, meta passwordMeta) error {
+	if p.store == nil {
+		return nil
+	}
+	id := accountID
+	desc := "账号密码修改时间与历史哈希"
+	return p.store.UpsertSetting(&store.Setting{
+		Key:         accountPasswordSettingKey,
+		Scope:       "account",
+		AccountID:   &id,
+		Value:       meta,
+		DataType:    "object",
+		Category:    "security",
+		Description: &desc,
+		IsSecret:    true,
+	})
+}
+
+// checkAccountPasswordChangeLocked 校验账号的新口令是否符合策略且未重复使用，调用方需持有 p.mu。
+func (p *Server) checkAccountPasswordChangeLocked(acc *Account, password string, policy passwordPolicy) error {
+	if err := policy.validate(password); err != nil {
+		return err
+	}
+	if policy.History > 0 && (password == acc.Password || acc.PasswordMeta.reused(password, policy.History)) {
+		return errPasswordReused
+	}
+	return nil
+}
+
+// setAccountPasswordLocked 修改账号口令并记录历史，调用方需持有 p.mu 写锁，返回需持久化的元数据。
+func (p *Server) setAccountPasswordLocked(acc *Account, password string, policy passwordPolicy) passwordMeta {
+	old := ""
+	if acc.Password != "" && policy.History > 0 {
+		old = hashPassword(acc.Password)
+	}
+	acc.Password = password
+	acc.PasswordMeta.record(old, policy.History, time.Now().UTC())
+	meta := acc.PasswordMeta
+	meta.History = append([]string(nil), meta.History...)
+	return meta
+}
+
+// accountPasswordExpired 判断账号口令是否需要强制修改；开启最长期限时，
+// 未记录修改时间的旧口令以本次登录作为起点开始计时。
+func (p *Server) accountPasswordExpired(acc *Account) bool {
+	policy := p.passwordPolicy()
+	if policy.MaxAgeDays <= 0 {
+		return false
+	}
+	now := time.Now().UTC()
+	p.mu.Lock()
+	if acc.PasswordMeta.ChangedAt == nil {
+		acc.PasswordMeta.ChangedAt = &now
+		meta := acc.PasswordMeta
+		p.mu.Unlock()
+		_ = p.persistPasswordMeta(acc.ID, meta)
+		return false
+	}
+	expired := acc.PasswordMeta.expired(policy, now)
+	p.mu.Unlock()
+	return expired
+}
+
+// POST /api/auth/password
+// 当前登录的账号或成员修改自己的口令；口令过期的会话只能访问该接口。
+func (p *Server) handleChangePassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	acc := accountFromCtx(r)
+	if acc == nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		return
+	}
+	var req struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
+		return
+	}
+	if req.NewPassword == req.CurrentPassword {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "新密码不能与当前密码相同"})
+		return
+	}
+	policy := p.passwordPolicy()
+	user := sessionUserFromCtx(r.Context())
+
+	p.mu.Lock()
+	var (
+		err      error
+		meta     passwordMeta
+		users    []AccountUser
+		verified bool
+	)
+	if user == nil {
+		verified = acc.Password == req.CurrentPassword
+		if verified {
+			if err = p.checkAccountPasswordChangeLocked(acc, req.NewPassword, policy); err == nil {
+				meta = p.setAccountPasswordLocked(acc, req.NewPassword, policy)
+			}
+		}
+	} else {
+		for i := range acc.Users {
+			u := &acc.Users[i]
+			if u.ID != user.ID {
+				continue
+			}
+			verified = checkPassword(u.PasswordHash, req.CurrentPassword)
+			if verified {
+				if err = u.changePassword(req.NewPassword, policy); err == nil {
+					users = append([]AccountUser(nil), acc.Users...)
+				}
+			}
+			break
+		}
+	}
+	p.mu.Unlock()
+
+	switch {
+	case !verified:
+		p.emitAuthEvent(r, authEventPasswordChange, "failure", acc.ID, auditActor(r), "invalid_current_password")
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "当前密码错误"})
+		return
+	case err != nil:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	if user == nil {
+		if p.store != nil {
+			_ = p.store.UpdateAccount(r.Context(), store.AccountRecord{
+				ID:          acc.ID,
+				Name:        acc.Name,
+				Password:    req.NewPassword,
+				ProxyAPIKey: acc.ProxyAPIKey,
+				IsAdmin:     acc.IsAdmin,
+			})
+		}
+		err = p.persistPasswordMeta(acc.ID, meta)
+	} else {
+		err = p.persistAccountUsers(acc.ID, users, user.ID)
+	}
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	if cookie, cerr := r.Cookie("session_token"); cerr == nil {
+		if sess := p.sessionMgr.Get(cookie.Value); sess != nil {
+			sess.mustChangePassword.Store(false)
+			p.sessionMgr.Save(sess)
+		}
+	}
+	p.audit(acc.ID, auditActor(r), "auth.password.change", auditActor(r), nil)
+	p.emitAuthEvent(r, authEventPasswordChange, "success", acc.ID, auditActor(r), "")
+	writeJSON(w, http.StatusOK, map[string]bool{"changed": true})
+}
@@ -1,14 +1,51 @@
 package proxy
 
 import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"encoding/hex"
 	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
 	"io"
+	"math"
+	"math/big"
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"qcc_plus/internal/config"
+	"qcc_plus/internal/i18n"
+	"qcc_plus/internal/logfile"
+	"qcc_plus/internal/notify"
+	"qcc_plus/internal/store"
+	"qcc_plus/internal/timeutil"
+	"qcc_plus/internal/version"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gorilla/websocket"
 )
 
 func TestBuilderMissingUpstream(t *testing.T) {
@@ -704,3 +741,6542 @@ func TestNodeRecoveryAutoSwitch(t *testing.T) {
 		t.Errorf("expected node2 to be active after node1 fails, got %s", activeID)
 	}
 }
+
+func TestIdempotencyKeyReplaysNodeCreate(t *testing.T) {
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer up.Close()
+
+	srv, err := NewBuilder().WithUpstream(up.URL).Build()
+	if err != nil {
+		t.Fatalf("build proxy: %v", err)
+	}
+	sess := srv.sessionMgr.Create(srv.defaultAccount.ID, false)
+
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/admin/api/nodes", strings.NewReader(body))
+		req.Header.Set("Idempotency-Key", "create-n1")
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: sess.Token})
+		rec := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+
+	body := `{"name":"n1","base_url":"` + up.URL + `","api_key":"k1","weight":2}`
+	first := post(body)
+	if first.Code != http.StatusCreated {
+		t.Fatalf("create node status %d", first.Code)
+	}
+	second := post(body)
+	if second.Code != http.StatusCreated || second.Header().Get("Idempotent-Replayed") != "true" {
+		t.Fatalf("expected replayed response, got %d", second.Code)
+	}
+	if first.Body.String() != second.Body.String() {
+		t.Fatalf("replayed body mismatch: %s vs %s", first.Body.String(), second.Body.String())
+	}
+	if n := len(srv.defaultAccount.Nodes); n != 2 {
+		t.Fatalf("expected 2 nodes after retried create, got %d", n)
+	}
+
+	if rec := post(`{"name":"n2","base_url":"` + up.URL + `"}`); rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422 for reused key, got %d", rec.Code)
+	}
+}
+
+func TestIdempotencyKeyReleasedOnPanic(t *testing.T) {
+	srv := &Server{idempotency: NewIdempotencyStore(time.Minute)}
+	calls := 0
+	h := srv.withIdempotency(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			panic(http.ErrAbortHandler)
+		}
+		w.WriteHeader(http.StatusCreated)
+	})
+	post := func() (rec *httptest.ResponseRecorder, panicked bool) {
+		defer func() { panicked = recover() != nil }()
+		req := httptest.NewRequest(http.MethodPost, "/admin/api/nodes", strings.NewReader(`{}`))
+		req.Header.Set(idempotencyHeader, "k1")
+		rec = httptest.NewRecorder()
+		h(rec, req)
+		return rec, false
+	}
+
+	if _, panicked := post(); !panicked {
+		t.Fatalf("panic should propagate to the server")
+	}
+	rec, _ := post()
+	if rec.Code != http.StatusCreated || calls != 2 {
+		t.Fatalf("retry after panic: status=%d calls=%d", rec.Code, calls)
+	}
+}
+
+func TestIdempotencyStoreBounds(t *testing.T) {
+	s := NewIdempotencyStore(time.Minute)
+	s.maxPerOwner, s.maxTotal = 2, 3
+	for _, k := range []string{"a1", "a2", "a3"} {
+		s.begin("acc-a", k, "fp")
+		s.finish(k, http.StatusOK, nil, []byte(k), false)
+	}
+	// 单个账号超出上限时淘汰该账号最早的键
+	if _, ok := s.entries["a1"]; ok || len(s.entries) != 2 {
+		t.Fatalf("oldest key of the account should be evicted: %v", s.entries)
+	}
+	s.begin("acc-b", "b1", "fp")
+	s.begin("acc-b", "b2", "fp")
+	// 全局超出上限时淘汰全局最早的键，其他账号的键不受账号上限影响
+	if _, ok := s.entries["a2"]; ok || len(s.entries) != 3 || s.evictions != 2 {
+		t.Fatalf("oldest key overall should be evicted: %v evictions=%d", s.entries, s.evictions)
+	}
+	if s.owners["acc-a"].Len() != 1 || s.owners["acc-b"].Len() != 2 {
+		t.Fatalf("per-account order out of sync: a=%d b=%d", s.owners["acc-a"].Len(), s.owners["acc-b"].Len())
+	}
+
+	// 超过快照上限的响应不保存，重复请求返回 409 而不是再次执行
+	srv := &Server{idempotency: NewIdempotencyStore(time.Minute)}
+	calls := 0
+	h := srv.withIdempotency(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write(bytes.Repeat([]byte("x"), maxIdempotencySnapshotBytes+1))
+	})
+	post := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/admin/api/nodes", strings.NewReader(`{}`))
+		req.Header.Set(idempotencyHeader, "big")
+		rec := httptest.NewRecorder()
+		h(rec, req)
+		return rec
+	}
+	if rec := post(); rec.Code != http.StatusCreated || rec.Body.Len() != maxIdempotencySnapshotBytes+1 {
+		t.Fatalf("first request should pass through in full: %d len=%d", rec.Code, rec.Body.Len())
+	}
+	if rec := post(); rec.Code != http.StatusConflict || calls != 1 {
+		t.Fatalf("oversized response should not be replayed or re-run: %d calls=%d", rec.Code, calls)
+	}
+	for _, e := range srv.idempotency.entries {
+		if e.body != nil {
+			t.Fatalf("oversized snapshot must not be kept")
+		}
+	}
+
+	// 请求体同样受限，超出时不执行处理函数也不登记幂等键
+	req := httptest.NewRequest(http.MethodPost, "/admin/api/nodes", bytes.NewReader(bytes.Repeat([]byte("x"), maxIdempotencyBodyBytes+1)))
+	req.Header.Set(idempotencyHeader, "huge")
+	rec := httptest.NewRecorder()
+	h(rec, req)
+	if rec.Code != http.StatusRequestEntityTooLarge || calls != 1 || len(srv.idempotency.entries) != 1 {
+		t.Fatalf("oversized request body should be rejected with 413: %d calls=%d entries=%d", rec.Code, calls, len(srv.idempotency.entries))
+	}
+}
+
+func TestNodeListETagNotModified(t *testing.T) {
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer up.Close()
+
+	srv, err := NewBuilder().WithUpstream(up.URL).Build()
+	if err != nil {
+		t.Fatalf("build proxy: %v", err)
+	}
+	sess := srv.sessionMgr.Create(srv.defaultAccount.ID, false)
+
+	get := func(etag string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/admin/api/nodes", nil)
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: sess.Token})
+		rec := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+
+	first := get("")
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || etag == "" {
+		t.Fatalf("expected 200 with etag, got %d %q", first.Code, etag)
+	}
+	if rec := get(etag); rec.Code != http.StatusNotModified {
+		t.Fatalf("expected 304, got %d", rec.Code)
+	}
+	if _, err := srv.addNodeWithMethod(srv.defaultAccount, "n2", up.URL, "", 2, ""); err != nil {
+		t.Fatalf("add node: %v", err)
+	}
+	if rec := get(etag); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 after change, got %d", rec.Code)
+	}
+}
+
+func TestAPIResponseCompressionNegotiation(t *testing.T) {
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer up.Close()
+
+	srv, err := NewBuilder().WithUpstream(up.URL).Build()
+	if err != nil {
+		t.Fatalf("build proxy: %v", err)
+	}
+	sess := srv.sessionMgr.Create(srv.defaultAccount.ID, false)
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/api/nodes", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	req.AddCookie(&http.Cookie{Name: "session_token", Value: sess.Token})
+	rec := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, req)
+	if rec.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("expected gzip response, headers=%v", rec.Header())
+	}
+	zr, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatalf("gzip reader: %v", err)
+	}
+	var payload map[string][]map[string]interface{}
+	if err := json.NewDecoder(zr).Decode(&payload); err != nil {
+		t.Fatalf("decode gzip body: %v", err)
+	}
+	if len(payload["nodes"]) != 1 {
+		t.Fatalf("unexpected payload: %+v", payload)
+	}
+	if stats := srv.compression.snapshot(); stats["saved_bytes"] <= 0 {
+		t.Fatalf("expected byte savings recorded, got %+v", stats)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/admin/api/nodes", nil)
+	req.Header.Set("Accept-Encoding", "gzip;q=0.8, br")
+	req.AddCookie(&http.Cookie{Name: "session_token", Value: sess.Token})
+	rec = httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, req)
+	if rec.Header().Get("Content-Encoding") != encodingBrotli {
+		t.Fatalf("expected br response, headers=%v", rec.Header())
+	}
+	payload = nil
+	if err := json.NewDecoder(brotli.NewReader(rec.Body)).Decode(&payload); err != nil {
+		t.Fatalf("decode br body: %v", err)
+	}
+	if len(payload["nodes"]) != 1 {
+		t.Fatalf("unexpected br payload: %+v", payload)
+	}
+}
+
+func TestNegotiateEncodingQValues(t *testing.T) {
+	cases := map[string]string{
+		"":                    "",
+		"gzip":                encodingGzip,
+		"gzip;q=0.5":          encodingGzip,
+		"br, gzip; q=0.8":     encodingBrotli,
+		"gzip, br":            encodingBrotli,
+		"br;q=0.5, gzip":      encodingGzip,
+		"br;q=0, gzip;q=0.1":  encodingGzip,
+		"gzip;q=0":            "",
+		"gzip;q=0.0":          "",
+		"*;q=0.1":             encodingBrotli,
+		"gzip;q=0.9, *;q=0.5": encodingGzip,
+		"gzip;q=0, *":         encodingBrotli,
+		"br;q=0, gzip;q=0, *": "",
+		"br, deflate":         encodingBrotli,
+		"deflate":             "",
+		"identity, *;q=0":     "",
+	}
+	for header, want := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Accept-Encoding", header)
+		if got := negotiateEncoding(req); got != want {
+			t.Errorf("negotiateEncoding(%q) = %q, want %q", header, got, want)
+		}
+	}
+}
+
+// deadlineRecorder 记录写超时设置的 ResponseWriter。
+type deadlineRecorder struct {
+	*httptest.ResponseRecorder
+	deadline time.Time
+}
+
+func (d *deadlineRecorder) SetWriteDeadline(t time.Time) error {
+	d.deadline = t
+	return nil
+}
+
+func TestCompressWriterSupportsResponseController(t *testing.T) {
+	inner := &deadlineRecorder{ResponseRecorder: httptest.NewRecorder()}
+	gw := &compressResponseWriter{ResponseWriter: inner, encoding: encodingGzip}
+	gw.Header().Set("Content-Type", "application/json")
+	rc := http.NewResponseController(gw)
+	deadline := time.Now().Add(time.Minute)
+	if err := rc.SetWriteDeadline(deadline); err != nil || !inner.deadline.Equal(deadline) {
+		t.Fatalf("write deadline should reach the underlying writer: %v", err)
+	}
+	_, _ = gw.Write([]byte(strings.Repeat("{}", minCompressBytes)))
+	if err := rc.Flush(); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	if inner.Header().Get("Content-Encoding") != "gzip" || inner.Body.Len() == 0 {
+		t.Fatalf("flush through the controller should emit compressed data, headers=%v", inner.Header())
+	}
+	gw.finish()
+}
+
+func TestNodeChangesLongPoll(t *testing.T) {
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer up.Close()
+
+	srv, err := NewBuilder().WithUpstream(up.URL).Build()
+	if err != nil {
+		t.Fatalf("build proxy: %v", err)
+	}
+	node, err := srv.addNodeWithMethod(srv.defaultAccount, "n2", up.URL, "", 5, "")
+	if err != nil {
+		t.Fatalf("add node: %v", err)
+	}
+	sess := srv.sessionMgr.Create(srv.defaultAccount.ID, false)
+	_, _, version, _ := srv.nodeChanges.since(srv.defaultAccount.ID, 0)
+
+	done := make(chan *httptest.ResponseRecorder, 1)
+	go func() {
+		req := httptest.NewRequest(http.MethodGet, "/api/nodes/changes?since="+strconv.FormatInt(version, 10)+"&timeout=5", nil)
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: sess.Token})
+		rec := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(rec, req)
+		done <- rec
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	if err := srv.disableNode(node.ID); err != nil {
+		t.Fatalf("disable node: %v", err)
+	}
+
+	select {
+	case rec := <-done:
+		var resp struct {
+			Version int64                    `json:"version"`
+			Nodes   []map[string]interface{} `json:"nodes"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if resp.Version <= version || len(resp.Nodes) != 1 || resp.Nodes[0]["id"] != node.ID {
+			t.Fatalf("unexpected changes response: %+v", resp)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatalf("long poll did not return after change")
+	}
+}
+
+func TestNodeStateMachineDegradesAndRecovers(t *testing.T) {
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer up.Close()
+
+	srv, err := NewBuilder().WithUpstream(up.URL).WithFailLimit(4).Build()
+	if err != nil {
+		t.Fatalf("build proxy: %v", err)
+	}
+	primary := srv.getNode("default")
+	if err := srv.updateNode("default", primary.Name, primary.URL.String(), nil, 2, nil); err != nil {
+		t.Fatalf("update default weight: %v", err)
+	}
+	backup, err := srv.addNode("backup", up.URL, "", 3)
+	if err != nil {
+		t.Fatalf("add backup: %v", err)
+	}
+	if srv.defaultAccount.ActiveID != "default" {
+		t.Fatalf("expected default active, got %s", srv.defaultAccount.ActiveID)
+	}
+
+	fail := func() {
+		srv.mu.Lock()
+		primary.Metrics.FailStreak++
+		srv.mu.Unlock()
+		srv.handleFailure("default", "status 500")
+	}
+
+	// 首次失败：degraded，权重 2*2=4 > 3，切换到 backup。
+	fail()
+	if st := nodeState(primary); st != NodeStateDegraded {
+		t.Fatalf("expected degraded, got %s", st)
+	}
+	if srv.defaultAccount.ActiveID != backup.ID {
+		t.Fatalf("expected switch to backup after degrade, got %s", srv.defaultAccount.ActiveID)
+	}
+
+	fail()
+	if st := nodeState(primary); st != NodeStateFailing {
+		t.Fatalf("expected failing, got %s", st)
+	}
+	fail()
+	fail()
+	if st := nodeState(primary); st != NodeStateDown || !primary.Failed {
+		t.Fatalf("expected down, got %s failed=%v", st, primary.Failed)
+	}
+
+	srv.recordMetrics("default", time.Now(), &metricsWriter{status: http.StatusOK}, nil, requestDims{})
+	if st := nodeState(primary); st != NodeStateHealthy || primary.Failed {
+		t.Fatalf("expected healthy after success, got %s", st)
+	}
+	if primary.StateChangedAt.IsZero() {
+		t.Fatalf("state change timestamp missing")
+	}
+	if srv.defaultAccount.ActiveID != "default" {
+		t.Fatalf("expected recovered node to regain priority, got %s", srv.defaultAccount.ActiveID)
+	}
+}
+
+func TestDrainNodeAutoDisablesWhenEmpty(t *testing.T) {
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer up.Close()
+
+	srv, err := NewBuilder().WithUpstream(up.URL).Build()
+	if err != nil {
+		t.Fatalf("build proxy: %v", err)
+	}
+	backup, err := srv.addNode("backup", up.URL, "", 5)
+	if err != nil {
+		t.Fatalf("add backup: %v", err)
+	}
+
+	end := srv.beginNodeRequest("default")
+	if err := srv.drainNode("default", true); err != nil {
+		t.Fatalf("drain: %v", err)
+	}
+	if srv.defaultAccount.ActiveID != backup.ID {
+		t.Fatalf("expected new requests routed to backup, got %s", srv.defaultAccount.ActiveID)
+	}
+	status := srv.drainStatus("default")
+	if status["state"] != NodeStateDraining || status["inflight"].(int64) != 1 {
+		t.Fatalf("unexpected drain status: %+v", status)
+	}
+
+	end()
+	if st := nodeState(srv.getNode("default")); st != NodeStateDisabled {
+		t.Fatalf("expected drained node disabled, got %s", st)
+	}
+}
+
+func TestAdaptiveWeightShiftsToFasterNode(t *testing.T) {
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer up.Close()
+
+	srv, err := NewBuilder().WithUpstream(up.URL).Build()
+	if err != nil {
+		t.Fatalf("build proxy: %v", err)
+	}
+	fast, err := srv.addNode("fast", up.URL, "", 3)
+	if err != nil {
+		t.Fatalf("add fast: %v", err)
+	}
+	srv.mu.Lock()
+	srv.nodeIndex["default"].Weight = 3
+	srv.mu.Unlock()
+
+	for i := 0; i < adaptiveWeightMinSamples; i++ {
+		srv.recordLatency("default", time.Second, true)
+		srv.recordLatency(fast.ID, 100*time.Millisecond, true)
+	}
+	NewAdaptiveWeightScheduler(srv, nil).adjustAll(1, 10)
+
+	if w := srv.getNode(fast.ID).AdaptiveWeight; w != 2 {
+		t.Fatalf("expected fast node adaptive weight 2, got %d", w)
+	}
+	if w := srv.getNode("default").AdaptiveWeight; w != 4 {
+		t.Fatalf("expected slow node adaptive weight 4, got %d", w)
+	}
+	// 配置权重保持不变，自适应结果只影响路由。
+	if srv.getNode(fast.ID).Weight != 3 || srv.getNode("default").Weight != 3 {
+		t.Fatalf("configured weights changed: fast=%d default=%d", srv.getNode(fast.ID).Weight, srv.getNode("default").Weight)
+	}
+	if srv.defaultAccount.ActiveID != fast.ID {
+		t.Fatalf("expected fast node active, got %s", srv.defaultAccount.ActiveID)
+	}
+
+	// 显式排序覆盖自适应结果，按新顺序选择活跃节点。
+	if err := srv.reorderNodes(srv.defaultAccount, []string{"default", fast.ID}); err != nil {
+		t.Fatalf("reorder: %v", err)
+	}
+	if n := srv.getNode(fast.ID); n.AdaptiveWeight != 0 || n.Weight != 2 {
+		t.Fatalf("fast node after reorder: weight=%d adaptive=%d", n.Weight, n.AdaptiveWeight)
+	}
+	if srv.defaultAccount.ActiveID != "default" {
+		t.Fatalf("expected reordered node active, got %s", srv.defaultAccount.ActiveID)
+	}
+}
+
+func TestNodeOverrideHeaderRequiresKeyPermission(t *testing.T) {
+	var sawHeader atomic.Bool
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(nodeOverrideHeader) != "" {
+			sawHeader.Store(true)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer up.Close()
+
+	srv, err := NewBuilder().WithUpstream(up.URL).Build()
+	if err != nil {
+		t.Fatalf("build proxy: %v", err)
+	}
+	if _, err := srv.addNode("eval", up.URL, "", 9); err != nil {
+		t.Fatalf("add node: %v", err)
+	}
+
+	send := func(key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(`{}`))
+		req.Header.Set(nodeOverrideHeader, "eval")
+		if key != "" {
+			req.Header.Set("x-api-key", key)
+		}
+		rec := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+	accountKey := srv.defaultAccount.ProxyAPIKey
+
+	if rec := send(accountKey); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 without permission, got %d", rec.Code)
+	}
+
+	srv.mu.Lock()
+	srv.defaultAccount.Key.AllowNodeOverride = true
+	srv.mu.Unlock()
+	rec := send(accountKey)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 with override, got %d", rec.Code)
+	}
+	if got := rec.Header().Get("X-Proxy-Node"); got != "eval" {
+		t.Fatalf("expected request routed to eval node, got %q", got)
+	}
+	// 权限属于密钥：未携带密钥回落到默认账号的请求不能指定节点。
+	if rec := send(""); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 without key, got %d", rec.Code)
+	}
+
+	// 服务账号密钥按自身设置判断，不继承账号密钥的权限。
+	saKey := serviceKeyPrefix + "override-test"
+	if _, err := srv.updateServiceAccounts(srv.defaultAccount, "", func(list []ServiceAccount) ([]ServiceAccount, error) {
+		return append(list, ServiceAccount{ID: "sa-1", Name: "ci", Label: "ci", KeyHash: hashServiceKey(saKey)}), nil
+	}); err != nil {
+		t.Fatalf("create service account: %v", err)
+	}
+	if rec := send(saKey); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for service key without permission, got %d", rec.Code)
+	}
+	if _, err := srv.updateServiceAccounts(srv.defaultAccount, "", func(list []ServiceAccount) ([]ServiceAccount, error) {
+		list[0].AllowNodeOverride = true
+		return list, nil
+	}); err != nil {
+		t.Fatalf("update service account: %v", err)
+	}
+	if rec := send(saKey); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 for permitted service key, got %d", rec.Code)
+	}
+	if sawHeader.Load() {
+		t.Fatalf("override header should not be forwarded upstream")
+	}
+}
+
+func TestRoutingExplainHasNoSideEffects(t *testing.T) {
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer up.Close()
+
+	srv, err := NewBuilder().WithUpstream(up.URL).Build()
+	if err != nil {
+		t.Fatalf("build proxy: %v", err)
+	}
+	backup, err := srv.addNode("backup", up.URL, "", 5)
+	if err != nil {
+		t.Fatalf("add backup: %v", err)
+	}
+	srv.mu.Lock()
+	setNodeState(srv.nodeIndex["default"], NodeStateDown, time.Now())
+	srv.mu.Unlock()
+
+	sess := srv.sessionMgr.Create(srv.defaultAccount.ID, false)
+	req := httptest.NewRequest(http.MethodPost, "/api/routing/explain", strings.NewReader(`{"model":"claude-3"}`))
+	req.AddCookie(&http.Cookie{Name: "session_token", Value: sess.Token})
+	rec := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("explain status %d: %s", rec.Code, rec.Body.String())
+	}
+	var exp routingExplanation
+	if err := json.Unmarshal(rec.Body.Bytes(), &exp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if exp.Chosen == nil || exp.Chosen.ID != backup.ID {
+		t.Fatalf("expected backup chosen, got %+v", exp.Chosen)
+	}
+	if len(exp.Candidates) != 2 || exp.Candidates[1].Routable {
+		t.Fatalf("unexpected candidates: %+v", exp.Candidates)
+	}
+	if srv.defaultAccount.ActiveID != "default" {
+		t.Fatalf("explain must not switch active node, got %s", srv.defaultAccount.ActiveID)
+	}
+}
+
+func TestRoutingExplainAffinityHedgeAndAccess(t *testing.T) {
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer up.Close()
+
+	srv, err := NewBuilder().WithUpstream(up.URL).Build()
+	if err != nil {
+		t.Fatalf("build proxy: %v", err)
+	}
+	backup, err := srv.addNode("backup", up.URL, "", 5)
+	if err != nil {
+		t.Fatalf("add backup: %v", err)
+	}
+	srv.settingsCache = &SettingsCache{data: map[string]any{
+		"routing.hedge.enabled":      true,
+		"routing.hedge.threshold_ms": float64(300),
+		"routing.hedge.budget_pct":   float64(10),
+	}}
+	srv.affinity.set(srv.defaultAccount.ID, "conv-1", backup.ID, time.Now(), time.Minute, 100)
+	before := srv.affinity.stats("")
+
+	explain := func(token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/routing/explain", strings.NewReader(body))
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: token})
+		rec := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+	admin := srv.sessionMgr.Create(srv.defaultAccount.ID, false)
+	rec := explain(admin.Token, `{"headers":{"X-QCC-Conversation":"conv-1"}}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("explain status %d: %s", rec.Code, rec.Body.String())
+	}
+	var exp routingExplanation
+	if err := json.Unmarshal(rec.Body.Bytes(), &exp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if exp.Chosen == nil || exp.Chosen.ID != backup.ID {
+		t.Fatalf("expected pinned backup chosen, got %+v", exp.Chosen)
+	}
+	steps := strings.Join(exp.Steps, "\n")
+	if !strings.Contains(steps, "pinned to node backup") || !strings.Contains(steps, "duplicate request goes to default") {
+		t.Fatalf("expected affinity and hedging steps, got:\n%s", steps)
+	}
+	if after := srv.affinity.stats(""); after.Hits != before.Hits || after.Misses != before.Misses {
+		t.Fatalf("explain must not touch affinity stats: before=%+v after=%+v", before, after)
+	}
+
+	// 账号不存在与无权管理返回相同状态，不泄露账号是否存在。
+	team, err := srv.createAccount("team", "team-key", "secret123", false)
+	if err != nil {
+		t.Fatalf("create account: %v", err)
+	}
+	member := srv.sessionMgr.Create(team.ID, false)
+	missing := explain(member.Token, `{"account_id":"no-such-account"}`)
+	foreign := explain(member.Token, `{"account_id":"`+srv.defaultAccount.ID+`"}`)
+	foreignKey := explain(member.Token, `{"headers":{"x-api-key":"`+srv.defaultAccount.ProxyAPIKey+`"}}`)
+	if missing.Code != http.StatusNotFound || foreign.Code != missing.Code || foreignKey.Code != missing.Code {
+		t.Fatalf("expected uniform 404, got missing=%d foreign=%d foreign_key=%d", missing.Code, foreign.Code, foreignKey.Code)
+	}
+}
+
+func TestContentFilterRejectsBlockedPattern(t *testing.T) {
+	var upstreamHits atomic.Int64
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamHits.Add(1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer up.Close()
+
+	srv, err := NewBuilder().WithUpstream(up.URL).Build()
+	if err != nil {
+		t.Fatalf("build proxy: %v", err)
+	}
+	policy := AccountPolicy{BlockedPatterns: []string{`(?i)project\s+phoenix`}}
+	if err := srv.setAccountPolicy(srv.defaultAccount.ID, policy, ""); err != nil {
+		t.Fatalf("set policy: %v", err)
+	}
+
+	send := func(body string) int {
+		req := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	blocked := `{"messages":[{"role":"user","content":[{"type":"text","text":"status of Project Phoenix?"}]}]}`
+	if code := send(blocked); code != http.StatusBadRequest {
+		t.Fatalf("expected blocked request 400, got %d", code)
+	}
+	if code := send(`{"messages":[{"role":"user","content":"hello"}]}`); code != http.StatusOK {
+		t.Fatalf("expected clean request 200, got %d", code)
+	}
+	if upstreamHits.Load() != 1 {
+		t.Fatalf("expected only clean request forwarded, got %d", upstreamHits.Load())
+	}
+	if c := srv.contentFilterCountersFor(srv.defaultAccount.ID); c.blocked.Load() != 1 || c.hits.Load() != 1 {
+		t.Fatalf("unexpected counters: hits=%d blocked=%d", c.hits.Load(), c.blocked.Load())
+	}
+}
+
+func TestRedactorMasksPII(t *testing.T) {
+	r, err := newRedactor(AccountPolicy{RedactPatterns: []string{`ticket-\d+`}})
+	if err != nil {
+		t.Fatalf("new redactor: %v", err)
+	}
+	in := "mail bob@example.com, card 4111 1111 1111 1111, call +1 415-555-2671 or (415) 555-0199, order 1234567890123, ticket-42"
+	out := r.redact(in)
+	for _, leaked := range []string{"bob@example.com", "4111 1111 1111 1111", "415-555-2671", "555-0199", "ticket-42"} {
+		if strings.Contains(out, leaked) {
+			t.Fatalf("expected %q redacted, got %q", leaked, out)
+		}
+	}
+	for _, want := range []string{"[REDACTED:email]", "[REDACTED:card]", "[REDACTED:phone]", "[REDACTED:custom]"} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("expected %s in %q", want, out)
+		}
+	}
+	if !strings.Contains(out, "1234567890123") {
+		t.Fatalf("non-luhn number should be kept, got %q", out)
+	}
+}
+
+func TestOutputCapsClampAndReject(t *testing.T) {
+	var gotMax atomic.Int64
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			MaxTokens int64 `json:"max_tokens"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		gotMax.Store(payload.MaxTokens)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer up.Close()
+
+	srv, err := NewBuilder().WithUpstream(up.URL).Build()
+	if err != nil {
+		t.Fatalf("build proxy: %v", err)
+	}
+	send := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(`{"max_tokens":100000,"messages":[]}`))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+
+	if err := srv.setAccountPolicy(srv.defaultAccount.ID, AccountPolicy{MaxOutputTokens: 4096}, ""); err != nil {
+		t.Fatalf("set policy: %v", err)
+	}
+	rec := send()
+	if rec.Code != http.StatusOK || gotMax.Load() != 4096 {
+		t.Fatalf("expected clamped max_tokens 4096, got status=%d max=%d", rec.Code, gotMax.Load())
+	}
+	if rec.Header().Get(maxTokensClampedHeader) == "" {
+		t.Fatalf("expected clamp header")
+	}
+
+	if err := srv.setAccountPolicy(srv.defaultAccount.ID, AccountPolicy{MaxOutputTokens: 4096, CapMode: outputCapReject}, ""); err != nil {
+		t.Fatalf("set policy: %v", err)
+	}
+	rec = send()
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "max_tokens_exceeded") {
+		t.Fatalf("expected structured rejection, got %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestResponseCapDropsContentLength(t *testing.T) {
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := `{"ok":true}`
+		if r.URL.Query().Get("big") == "1" {
+			body = `{"text":"` + strings.Repeat("x", 2048) + `"}`
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		_, _ = io.WriteString(w, body)
+	}))
+	defer up.Close()
+
+	srv, err := NewBuilder().WithUpstream(up.URL).Build()
+	if err != nil {
+		t.Fatalf("build proxy: %v", err)
+	}
+	if err := srv.setAccountPolicy(srv.defaultAccount.ID, AccountPolicy{MaxResponseBytes: 100}, ""); err != nil {
+		t.Fatalf("set policy: %v", err)
+	}
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/v1/models?big=1")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatalf("truncated body must end cleanly: %v", err)
+	}
+	if len(body) > 100 || (resp.ContentLength >= 0 && resp.ContentLength != int64(len(body))) {
+		t.Fatalf("expected at most 100 bytes matching the framing, got %d bytes, Content-Length=%d", len(body), resp.ContentLength)
+	}
+
+	// 声明长度在上限内时保留 Content-Length。
+	resp, err = http.Get(ts.URL + "/v1/models")
+	if err != nil {
+		t.Fatalf("get small: %v", err)
+	}
+	resp.Body.Close()
+	if resp.ContentLength != int64(len(`{"ok":true}`)) {
+		t.Fatalf("small response content length = %d", resp.ContentLength)
+	}
+}
+
+func TestRequestBodyLimitAndJSONValidation(t *testing.T) {
+	var hits atomic.Int64
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer up.Close()
+
+	srv, err := NewBuilder().WithUpstream(up.URL).Build()
+	if err != nil {
+		t.Fatalf("build proxy: %v", err)
+	}
+	send := func(body string, chunked bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if chunked {
+			req.ContentLength = -1
+		}
+		rec := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+
+	if err := srv.setAccountPolicy(srv.defaultAccount.ID, AccountPolicy{MaxRequestBytes: 64}, ""); err != nil {
+		t.Fatalf("set policy: %v", err)
+	}
+	big := `{"messages":[{"role":"user","content":"` + strings.Repeat("x", 100) + `"}]}`
+	for _, chunked := range []bool{false, true} {
+		rec := send(big, chunked)
+		if rec.Code != http.StatusRequestEntityTooLarge || !strings.Contains(rec.Body.String(), "request_too_large") {
+			t.Fatalf("expected 413 (chunked=%v), got %d %s", chunked, rec.Code, rec.Body.String())
+		}
+	}
+	if rec := send(`{"messages":[}`, false); rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "not valid JSON") {
+		t.Fatalf("expected malformed json rejection, got %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := send(`[1,2]`, false); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected non-object rejection, got %d", rec.Code)
+	}
+	if hits.Load() != 0 {
+		t.Fatalf("rejected requests must not reach upstream, got %d", hits.Load())
+	}
+	if rec := send(`{"messages":[]}`, false); rec.Code != http.StatusOK || hits.Load() != 1 {
+		t.Fatalf("expected valid request forwarded, got %d hits=%d", rec.Code, hits.Load())
+	}
+
+	srv.settingsCache = &SettingsCache{data: map[string]any{"proxy.validate_json": false}}
+	if rec := send(`{"messages":[}`, false); rec.Code != http.StatusOK {
+		t.Fatalf("expected validation disabled, got %d", rec.Code)
+	}
+}
+
+func TestEndpointAllowlistPerKey(t *testing.T) {
+	var hits atomic.Int64
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer up.Close()
+
+	srv, err := NewBuilder().WithUpstream(up.URL).Build()
+	if err != nil {
+		t.Fatalf("build proxy: %v", err)
+	}
+	if err := srv.setAccountPolicy(srv.defaultAccount.ID, AccountPolicy{AllowedPaths: []string{"/v1/messages", "/v1/models/*"}}, ""); err != nil {
+		t.Fatalf("set policy: %v", err)
+	}
+	send := func(path string) int {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		rec := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(rec, req)
+		return rec.Code
+	}
+	for path, want := range map[string]int{
+		"/v1/messages":             http.StatusOK,
+		"/v1/models/claude":        http.StatusOK,
+		"/v1/files":                http.StatusForbidden,
+		"/v1/messages/../files":    http.StatusForbidden,
+		"/v1/messages/count_token": http.StatusForbidden,
+	} {
+		if got := send(path); got != want {
+			t.Fatalf("%s: expected %d, got %d", path, want, got)
+		}
+	}
+	if hits.Load() != 2 {
+		t.Fatalf("denied requests must not reach upstream, got %d hits", hits.Load())
+	}
+	if err := validateAllowedPaths([]string{"v1/messages"}); err == nil {
+		t.Fatalf("expected relative path rejected")
+	}
+}
+
+func TestEndpointAllowlistPerServiceAccount(t *testing.T) {
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer up.Close()
+
+	srv, err := NewBuilder().WithUpstream(up.URL).Build()
+	if err != nil {
+		t.Fatalf("build proxy: %v", err)
+	}
+	// 账号策略只约束账号代理密钥，服务账号不继承。
+	if err := srv.setAccountPolicy(srv.defaultAccount.ID, AccountPolicy{AllowedPaths: []string{"/v1/models/*"}}, ""); err != nil {
+		t.Fatalf("set policy: %v", err)
+	}
+	sess := srv.sessionMgr.Create(srv.defaultAccount.ID, true)
+	manage := func(method, query, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/admin/api/accounts/service-accounts"+query, strings.NewReader(body))
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: sess.Token})
+		rec := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+	create := func(body string) (id, key string) {
+		rec := manage(http.MethodPost, "", body)
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("create service account: %d %s", rec.Code, rec.Body.String())
+		}
+		var created struct {
+			APIKey         string         `json:"api_key"`
+			ServiceAccount map[string]any `json:"service_account"`
+		}
+		_ = json.NewDecoder(rec.Body).Decode(&created)
+		id, _ = created.ServiceAccount["id"].(string)
+		return id, created.APIKey
+	}
+	if rec := manage(http.MethodPost, "", `{"name":"bad","allowed_paths":["v1/files"]}`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected invalid allowed_paths rejected, got %d", rec.Code)
+	}
+	_, messagesKey := create(`{"name":"chat-bot","allowed_paths":["/v1/messages"]}`)
+	filesID, filesKey := create(`{"name":"files-bot","allowed_paths":["/v1/files*"]}`)
+
+	send := func(key, path string) int {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(`{}`))
+		req.Header.Set("x-api-key", key)
+		rec := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(rec, req)
+		return rec.Code
+	}
+	for _, tc := range []struct {
+		key, path string
+		want      int
+	}{
+		{messagesKey, "/v1/messages", http.StatusOK},
+		{messagesKey, "/v1/files", http.StatusForbidden},
+		{filesKey, "/v1/messages", http.StatusForbidden},
+		{filesKey, "/v1/files", http.StatusOK},
+		{srv.defaultAccount.ProxyAPIKey, "/v1/messages", http.StatusForbidden},
+	} {
+		if got := send(tc.key, tc.path); got != tc.want {
+			t.Fatalf("%s with key %s: expected %d, got %d", tc.path, tc.key[:10], tc.want, got)
+		}
+	}
+
+	if rec := manage(http.MethodPut, "?id="+filesID, `{"allowed_paths":["/v1/messages"]}`); rec.Code != http.StatusOK {
+		t.Fatalf("update allowed_paths: %d %s", rec.Code, rec.Body.String())
+	}
+	if send(filesKey, "/v1/messages") != http.StatusOK || send(filesKey, "/v1/files") != http.StatusForbidden {
+		t.Fatalf("expected updated allowed_paths applied to the key")
+	}
+}
+
+func TestProxyKeyLastSeenAndExpiry(t *testing.T) {
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer up.Close()
+
+	srv, err := NewBuilder().WithUpstream(up.URL).WithDefaultAccount("default", "client-key").Build()
+	if err != nil {
+		t.Fatalf("build proxy: %v", err)
+	}
+	sess := srv.sessionMgr.Create(srv.defaultAccount.ID, true)
+	send := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(`{}`))
+		req.Header.Set("x-api-key", "client-key")
+		req.RemoteAddr = "203.0.113.7:5555"
+		rec := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+	admin := func(method, body string) map[string]interface{} {
+		req := httptest.NewRequest(method, "/admin/api/accounts/key", strings.NewReader(body))
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: sess.Token})
+		rec := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s key: status %d %s", method, rec.Code, rec.Body.String())
+		}
+		var out map[string]interface{}
+		_ = json.NewDecoder(rec.Body).Decode(&out)
+		return out
+	}
+
+	if rec := send(); rec.Code != http.StatusOK {
+		t.Fatalf("expected request allowed, got %d", rec.Code)
+	}
+	view := admin(http.MethodGet, "")
+	origins, _ := view["origins"].([]interface{})
+	if view["last_used_at"] == nil || len(origins) != 1 || origins[0].(map[string]interface{})["ip"] != "203.0.113.7" {
+		t.Fatalf("expected last-used and origin ip recorded, got %+v", view)
+	}
+
+	past := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	admin(http.MethodPut, `{"expires_at":"`+past+`"}`)
+	if rec := send(); rec.Code != http.StatusUnauthorized || !strings.Contains(rec.Body.String(), keyDisabledExpired) {
+		t.Fatalf("expected expired key rejected, got %d %s", rec.Code, rec.Body.String())
+	}
+	if view := admin(http.MethodGet, ""); view["status"] != "disabled" || view["disabled_reason"] != keyDisabledExpired {
+		t.Fatalf("expected key disabled as expired, got %+v", view)
+	}
+
+	admin(http.MethodPut, `{"inactive_days":30,"enabled":true}`)
+	if rec := send(); rec.Code != http.StatusOK {
+		t.Fatalf("expected re-enabled key allowed, got %d", rec.Code)
+	}
+	srv.mu.Lock()
+	stale := time.Now().Add(-31 * 24 * time.Hour)
+	srv.defaultAccount.Key.LastUsedAt = &stale
+	srv.mu.Unlock()
+	if rec := send(); rec.Code != http.StatusUnauthorized || !strings.Contains(rec.Body.String(), keyDisabledInactive) {
+		t.Fatalf("expected inactive key rejected, got %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestLabelHeaderValidatedAgainstAllowlist(t *testing.T) {
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer up.Close()
+
+	srv, err := NewBuilder().WithUpstream(up.URL).Build()
+	if err != nil {
+		t.Fatalf("build proxy: %v", err)
+	}
+	if err := srv.setAccountPolicy(srv.defaultAccount.ID, AccountPolicy{AllowedLabels: []string{"team-search"}}, ""); err != nil {
+		t.Fatalf("set policy: %v", err)
+	}
+	send := func(label string) int {
+		req := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(`{}`))
+		req.Header.Set(labelHeader, label)
+		rec := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(rec, req)
+		return rec.Code
+	}
+	if code := send("team-search"); code != http.StatusOK {
+		t.Fatalf("expected allowed label to pass, got %d", code)
+	}
+	if code := send("team-unknown"); code != http.StatusBadRequest {
+		t.Fatalf("expected unknown label rejected, got %d", code)
+	}
+}
+
+func TestServiceAccountKeysRouteToOwningAccount(t *testing.T) {
+	var teamHits atomic.Int64
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer up.Close()
+	teamUp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		teamHits.Add(1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer teamUp.Close()
+
+	srv, err := NewBuilder().WithUpstream(up.URL).Build()
+	if err != nil {
+		t.Fatalf("build proxy: %v", err)
+	}
+	team, err := srv.createAccount("team", "team-key", "secret123", false)
+	if err != nil {
+		t.Fatalf("create account: %v", err)
+	}
+	if _, err := srv.addNodeWithOptions(team, "team-node", teamUp.URL, "", 1, "", nil, 0); err != nil {
+		t.Fatalf("add node: %v", err)
+	}
+	if err := srv.setAccountPolicy(team.ID, AccountPolicy{AllowedLabels: []string{"humans"}}, ""); err != nil {
+		t.Fatalf("set policy: %v", err)
+	}
+	sess := srv.sessionMgr.Create(team.ID, false)
+	manage := func(method, query, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/admin/api/accounts/service-accounts"+query, strings.NewReader(body))
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: sess.Token})
+		rec := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := manage(http.MethodPost, "", `{"name":"ci-bot","label":"ci"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create service account: %d %s", rec.Code, rec.Body.String())
+	}
+	var created struct {
+		APIKey         string         `json:"api_key"`
+		ServiceAccount map[string]any `json:"service_account"`
+	}
+	_ = json.NewDecoder(rec.Body).Decode(&created)
+	if !strings.HasPrefix(created.APIKey, serviceKeyPrefix) {
+		t.Fatalf("expected generated key, got %+v", created)
+	}
+	if list := manage(http.MethodGet, "", "").Body.String(); strings.Contains(list, created.APIKey) || !strings.Contains(list, "ci-bot") {
+		t.Fatalf("list must show the service account without its key: %s", list)
+	}
+
+	send := func() int {
+		req := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(`{}`))
+		req.Header.Set("x-api-key", created.APIKey)
+		// 服务账号的标签固定，请求头中的标签不参与校验。
+		req.Header.Set(labelHeader, "not-allowed")
+		rec := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(rec, req)
+		return rec.Code
+	}
+	if code := send(); code != http.StatusOK || teamHits.Load() != 1 {
+		t.Fatalf("expected request served by owning account, got %d hits=%d", code, teamHits.Load())
+	}
+
+	id, _ := created.ServiceAccount["id"].(string)
+	if rec := manage(http.MethodPut, "?id="+id, `{"disabled":true}`); rec.Code != http.StatusOK {
+		t.Fatalf("disable service account: %d", rec.Code)
+	}
+	if code := send(); code != http.StatusUnauthorized {
+		t.Fatalf("expected disabled service account rejected, got %d", code)
+	}
+	if rec := manage(http.MethodDelete, "?id="+id, ""); rec.Code != http.StatusOK {
+		t.Fatalf("delete service account: %d", rec.Code)
+	}
+	if _, _, disabled := srv.serviceAccountByKey(created.APIKey); disabled || len(srv.serviceKeys) != 0 {
+		t.Fatalf("expected key index cleared after delete")
+	}
+}
+
+func TestAccountInvitationFlow(t *testing.T) {
+	srv, err := NewBuilder().WithUpstream("http://127.0.0.1:1").Build()
+	if err != nil {
+		t.Fatalf("build proxy: %v", err)
+	}
+	owner := srv.sessionMgr.Create(srv.defaultAccount.ID, true)
+	do := func(method, path, body string, cookie string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if cookie != "" {
+			req.AddCookie(&http.Cookie{Name: "session_token", Value: cookie})
+		}
+		rec := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+	base := "/api/accounts/" + srv.defaultAccount.ID + "/invitations"
+	invite := func(role string) (string, string) {
+		rec := do(http.MethodPost, base, `{"email":"dev@example.com","role":"`+role+`"}`, owner.Token)
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("create invitation: %d %s", rec.Code, rec.Body.String())
+		}
+		var out struct {
+			InviteURL  string         `json:"invite_url"`
+			Invitation map[string]any `json:"invitation"`
+		}
+		_ = json.NewDecoder(rec.Body).Decode(&out)
+		id, _ := out.Invitation["id"].(string)
+		return out.InviteURL[strings.LastIndex(out.InviteURL, "/")+1:], id
+	}
+
+	token, _ := invite(roleViewer)
+	if rec := do(http.MethodGet, base, "", owner.Token); !strings.Contains(rec.Body.String(), `"status":"pending"`) {
+		t.Fatalf("expected pending invitation listed, got %s", rec.Body.String())
+	}
+	if rec := do(http.MethodGet, invitationsAPIPrefix+token, "", ""); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), roleViewer) {
+		t.Fatalf("expected public invitation lookup, got %d %s", rec.Code, rec.Body.String())
+	}
+	rec := do(http.MethodPost, invitationsAPIPrefix+token+"/accept", `{"name":"dev","password":"s3cret-pass"}`, "")
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("accept invitation: %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := do(http.MethodPost, invitationsAPIPrefix+token+"/accept", `{"name":"dev2","password":"s3cret-pass"}`, ""); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected invitation to be single use, got %d", rec.Code)
+	}
+
+	login := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader("username=dev&password=s3cret-pass"))
+	login.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	loginRec := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(loginRec, login)
+	var viewer string
+	for _, c := range loginRec.Result().Cookies() {
+		if c.Name == "session_token" {
+			viewer = c.Value
+		}
+	}
+	if viewer == "" {
+		t.Fatalf("expected member login to create a session, got %d %s", loginRec.Code, loginRec.Body.String())
+	}
+	if rec := do(http.MethodGet, "/api/accounts/"+srv.defaultAccount.ID+"/users", "", viewer); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"name":"dev"`) || strings.Contains(rec.Body.String(), "pbkdf2") {
+		t.Fatalf("expected member listed without password hash, got %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := do(http.MethodPost, base, `{"role":"admin"}`, viewer); rec.Code != http.StatusForbidden {
+		t.Fatalf("viewer must not invite, got %d", rec.Code)
+	}
+
+	token2, id2 := invite(roleMember)
+	if rec := do(http.MethodDelete, base+"/"+id2, "", owner.Token); rec.Code != http.StatusOK {
+		t.Fatalf("revoke invitation: %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := do(http.MethodPost, invitationsAPIPrefix+token2+"/accept", `{"name":"late","password":"s3cret-pass"}`, ""); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected revoked invitation rejected, got %d", rec.Code)
+	}
+}
+
+func TestPasswordPolicyAndForcedRotation(t *testing.T) {
+	srv, err := NewBuilder().WithUpstream("http://127.0.0.1:1").Build()
+	if err != nil {
+		t.Fatalf("build proxy: %v", err)
+	}
+	srv.settingsCache = &SettingsCache{data: map[string]any{
+		"password.min_length":    10,
+		"password.require_digit": true,
+		"password.history":       2,
+		"password.max_age_days":  30,
+	}}
+	admin := srv.sessionMgr.Create(srv.defaultAccount.ID, true)
+	do := func(method, path, body, cookie string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: cookie})
+		rec := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := do(http.MethodPost, "/admin/api/accounts", `{"name":"ops","proxy_api_key":"ops-key","password":"short"}`, admin.Token); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected short password rejected, got %d", rec.Code)
+	}
+	if rec := do(http.MethodPost, "/admin/api/accounts", `{"name":"ops","proxy_api_key":"ops-key","password":"longenoughpass"}`, admin.Token); rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "数字") {
+		t.Fatalf("expected missing digit rejected, got %d %s", rec.Code, rec.Body.String())
+	}
+	rec := do(http.MethodPost, "/admin/api/accounts", `{"name":"ops","proxy_api_key":"ops-key","password":"rotation-0001"}`, admin.Token)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create account: %d %s", rec.Code, rec.Body.String())
+	}
+	var created map[string]string
+	_ = json.NewDecoder(rec.Body).Decode(&created)
+	ops := srv.getAccountByID(created["id"])
+
+	put := func(password string) int {
+		return do(http.MethodPut, "/admin/api/accounts?id="+ops.ID, `{"password":"`+password+`"}`, admin.Token).Code
+	}
+	if code := put("rotation-0002"); code != http.StatusOK {
+		t.Fatalf("expected password change accepted, got %d", code)
+	}
+	if code := put("rotation-0001"); code != http.StatusBadRequest {
+		t.Fatalf("expected recent password reuse rejected, got %d", code)
+	}
+
+	srv.mu.Lock()
+	old := time.Now().Add(-40 * 24 * time.Hour)
+	ops.PasswordMeta.ChangedAt = &old
+	srv.mu.Unlock()
+	login := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader("username=ops&password=rotation-0002"))
+	login.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	loginRec := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(loginRec, login)
+	if loginRec.Header().Get(passwordExpiredHeader) != "true" {
+		t.Fatalf("expected expired password flagged at login, got %d", loginRec.Code)
+	}
+	var token string
+	for _, c := range loginRec.Result().Cookies() {
+		if c.Name == "session_token" {
+			token = c.Value
+		}
+	}
+	if rec := do(http.MethodGet, "/admin/api/accounts", "", token); rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), "password_expired") {
+		t.Fatalf("expected API blocked until rotation, got %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := do(http.MethodPost, passwordChangePath, `{"current_password":"rotation-0002","new_password":"rotation-0003"}`, token); rec.Code != http.StatusOK {
+		t.Fatalf("change password: %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := do(http.MethodGet, "/admin/api/accounts", "", token); rec.Code != http.StatusOK {
+		t.Fatalf("expected API allowed after rotation, got %d", rec.Code)
+	}
+}
+
+func TestExpiredViewerCanChangePassword(t *testing.T) {
+	srv, err := NewBuilder().WithUpstream("http://127.0.0.1:1").Build()
+	if err != nil {
+		t.Fatalf("build proxy: %v", err)
+	}
+	srv.settingsCache = &SettingsCache{data: map[string]any{"password.max_age_days": 30}}
+	old := time.Now().Add(-40 * 24 * time.Hour)
+	srv.mu.Lock()
+	srv.defaultAccount.Users = append(srv.defaultAccount.Users, AccountUser{ID: "u-viewer", Name: "reader", Role: roleViewer,
+		PasswordHash: hashPassword("viewer-pass-1"), PasswordMeta: passwordMeta{ChangedAt: &old}})
+	srv.mu.Unlock()
+
+	login := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader("username=reader&password=viewer-pass-1"))
+	login.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	loginRec := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(loginRec, login)
+	if loginRec.Header().Get(passwordExpiredHeader) != "true" {
+		t.Fatalf("expected expired password flagged at login, got %d", loginRec.Code)
+	}
+	var token string
+	for _, c := range loginRec.Result().Cookies() {
+		if c.Name == "session_token" {
+			token = c.Value
+		}
+	}
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: token})
+		rec := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+	if rec := do(http.MethodPost, passwordChangePath, `{"current_password":"viewer-pass-1","new_password":"viewer-pass-2"}`); rec.Code != http.StatusOK {
+		t.Fatalf("expired viewer must be able to rotate its password, got %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := do(http.MethodGet, "/api/accounts/"+srv.defaultAccount.ID+"/users", ""); rec.Code != http.StatusOK {
+		t.Fatalf("expected API allowed after rotation, got %d", rec.Code)
+	}
+	if rec := do(http.MethodPost, "/api/accounts/"+srv.defaultAccount.ID+"/invitations", `{"role":"viewer"}`); rec.Code != http.StatusForbidden {
+		t.Fatalf("viewer must stay read-only elsewhere, got %d", rec.Code)
+	}
+}
+
+func TestAuthEventsWebhookWithRetryAndRateLimit(t *testing.T) {
+	var attempts atomic.Int32
+	events := make(chan *http.Request, 4)
+	bodies := make(chan []byte, 4)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		b, _ := io.ReadAll(r.Body)
+		events <- r
+		bodies <- b
+	}))
+	defer hook.Close()
+
+	srv, err := NewBuilder().WithUpstream("http://127.0.0.1:1").Build()
+	if err != nil {
+		t.Fatalf("build proxy: %v", err)
+	}
+	defer srv.authEvents.close()
+	srv.authEvents.retryBase = time.Millisecond
+	srv.settingsCache = &SettingsCache{data: map[string]any{
+		"siem.enabled":            true,
+		"siem.webhook_url":        hook.URL,
+		"siem.webhook_secret":     "s3cret",
+		"siem.rate_limit_per_min": 1,
+	}}
+	login := func() {
+		form := url.Values{"username": {"nobody"}, "password": {"wrong"}}
+		req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		srv.Handler().ServeHTTP(httptest.NewRecorder(), req)
+	}
+	login()
+	login()
+
+	var req *http.Request
+	var body []byte
+	select {
+	case req = <-events:
+		body = <-bodies
+	case <-time.After(2 * time.Second):
+		t.Fatalf("auth event not delivered, attempts=%d", attempts.Load())
+	}
+	if attempts.Load() != 2 {
+		t.Fatalf("expected one retry, got %d attempts", attempts.Load())
+	}
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write(body)
+	if got := req.Header.Get(authEventSignHeader); got != "sha256="+hex.EncodeToString(mac.Sum(nil)) {
+		t.Fatalf("unexpected signature %q", got)
+	}
+	var ev authEvent
+	if err := json.Unmarshal(body, &ev); err != nil {
+		t.Fatalf("decode event: %v", err)
+	}
+	if ev.Schema != authEventSchema || ev.Event != authEventLogin || ev.Outcome != "failure" || ev.User != "nobody" || ev.Reason != "invalid_credentials" {
+		t.Fatalf("unexpected event %+v", ev)
+	}
+	if srv.authEvents.dropped.Load() != 1 {
+		t.Fatalf("expected second event rate limited, dropped=%d", srv.authEvents.dropped.Load())
+	}
+	srv.authEvents.close()
+	if srv.authEvents.sent.Load() != 1 {
+		t.Fatalf("expected one event sent, got %d", srv.authEvents.sent.Load())
+	}
+}
+
+// memSettingsStore 内存版配置存储，供配置相关接口测试使用。
+type memSettingsStore struct {
+	mu       sync.Mutex
+	settings []store.Setting
+	version  int64
+	changes  []store.SettingChange
+}
+
+func (m *memSettingsStore) logChange(s store.Setting, action, actor string) {
+	c := store.SettingChange{Version: m.version, Key: s.Key, Scope: s.Scope, AccountID: s.AccountID,
+		SettingVersion: s.Version, Action: action, ChangedAt: time.Now()}
+	if action == store.SettingChangeDelete {
+		c.SettingVersion = 0
+	}
+	if actor != "" {
+		c.Actor = &actor
+	}
+	m.changes = append(m.changes, c)
+}
+
+func (m *memSettingsStore) ListSettings(scope, category, accountID string) ([]store.Setting, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []store.Setting
+	for _, s := range m.settings {
+		if (scope == "" || s.Scope == scope) && (category == "" || s.Category == category) &&
+			(accountID == "" || (s.AccountID != nil && *s.AccountID == accountID)) {
+			out = append(out, s)
+		}
+	}
+	return out, nil
+}
+
+func (m *memSettingsStore) find(key, scope, accountID string) int {
+	for i, s := range m.settings {
+		acc := ""
+		if s.AccountID != nil {
+			acc = *s.AccountID
+		}
+		if s.Key == key && (scope == "" || s.Scope == scope) && acc == accountID {
+			return i
+		}
+	}
+	return -1
+}
+
+func (m *memSettingsStore) GetSetting(key, scope, accountID string) (*store.Setting, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if i := m.find(key, scope, accountID); i >= 0 {
+		s := m.settings[i]
+		return &s, nil
+	}
+	return nil, store.ErrNotFound
+}
+
+func (m *memSettingsStore) UpsertSetting(s *store.Setting) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	acc := ""
+	if s.AccountID != nil {
+		acc = *s.AccountID
+	}
+	m.version++
+	if i := m.find(s.Key, s.Scope, acc); i >= 0 {
+		s.Version = m.settings[i].Version + 1
+		m.settings[i] = *s
+	} else {
+		s.Version = 1
+		m.settings = append(m.settings, *s)
+	}
+	actor := ""
+	if s.UpdatedBy != nil {
+		actor = *s.UpdatedBy
+	}
+	m.logChange(*s, store.SettingChangeUpsert, actor)
+	return nil
+}
+
+func (m *memSettingsStore) UpdateSetting(s *store.Setting) error {
+	m.mu.Lock()
+	acc := ""
+	if s.AccountID != nil {
+		acc = *s.AccountID
+	}
+	i := m.find(s.Key, s.Scope, acc)
+	if i < 0 {
+		m.mu.Unlock()
+		return store.ErrNotFound
+	}
+	if m.settings[i].Version != s.Version {
+		m.mu.Unlock()
+		return store.ErrVersionConflict
+	}
+	m.mu.Unlock()
+	return m.UpsertSetting(s)
+}
+
+func (m *memSettingsStore) DeleteSetting(key, scope, accountID string) error {
+	return m.DeleteSettingBy(key, scope, accountID, "")
+}
+
+func (m *memSettingsStore) DeleteSettingBy(key, scope, accountID, actor string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i := m.find(key, scope, accountID)
+	if i < 0 {
+		return store.ErrNotFound
+	}
+	removed := m.settings[i]
+	m.settings = append(m.settings[:i], m.settings[i+1:]...)
+	m.version++
+	m.logChange(removed, store.SettingChangeDelete, actor)
+	return nil
+}
+
+func (m *memSettingsStore) ListSettingChanges(sinceVersion int64, limit int) ([]store.SettingChange, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []store.SettingChange
+	for _, c := range m.changes {
+		if c.Version > sinceVersion && len(out) < limit {
+			out = append(out, c)
+		}
+	}
+	return out, nil
+}
+
+func (m *memSettingsStore) BatchUpdateSettings(settings []store.Setting) error {
+	for i := range settings {
+		if err := m.UpsertSetting(&settings[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *memSettingsStore) GetGlobalVersion() (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.version, nil
+}
+
+func (m *memSettingsStore) GetSettingsStamp() (string, error) {
+	v, _ := m.GetGlobalVersion()
+	return strconv.FormatInt(v, 10), nil
+}
+
+func TestSettingsDiffBetweenAccountsAndExport(t *testing.T) {
+	accA, accB := "acc-a", "acc-b"
+	mem := &memSettingsStore{}
+	seed := func(acc *string, key string, value any, secret bool) {
+		scope := "system"
+		if acc != nil {
+			scope = "account"
+		}
+		_ = mem.UpsertSetting(&store.Setting{Key: key, Scope: scope, AccountID: acc, Value: value, IsSecret: secret})
+	}
+	seed(&accA, "limits.rpm", 60.0, false)
+	seed(&accA, "webhook.secret", "a-secret", true)
+	seed(&accA, "only.a", true, false)
+	seed(&accA, "same", map[string]any{"x": 1.0, "y": "z"}, false)
+	seed(&accB, "limits.rpm", 120.0, false)
+	seed(&accB, "webhook.secret", "b-secret", true)
+	seed(&accB, "only.b", "hello", false)
+	seed(&accB, "same", map[string]any{"y": "z", "x": 1.0}, false)
+	seed(nil, "limits.rpm", 60.0, false)
+
+	h := &SettingsHandler{store: mem}
+	do := func(method, target, body string) (int, settingsDiffResult) {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req = req.WithContext(context.WithValue(req.Context(), isAdminContextKey{}, true))
+		rec := httptest.NewRecorder()
+		h.DiffSettings(rec, req)
+		var res settingsDiffResult
+		_ = json.NewDecoder(rec.Body).Decode(&res)
+		return rec.Code, res
+	}
+
+	code, res := do(http.MethodGet, "/api/settings/diff?left="+accA+"&right="+accB, "")
+	if code != http.StatusOK {
+		t.Fatalf("diff status %d", code)
+	}
+	if res.Identical || res.Unchanged != 1 {
+		t.Fatalf("unexpected summary %+v", res)
+	}
+	if len(res.Added) != 1 || res.Added[0].Key != "only.b" || res.Added[0].Value != "hello" {
+		t.Fatalf("unexpected added %+v", res.Added)
+	}
+	if len(res.Removed) != 1 || res.Removed[0].Key != "only.a" {
+		t.Fatalf("unexpected removed %+v", res.Removed)
+	}
+	if len(res.Changed) != 2 || res.Changed[0].Key != "limits.rpm" || res.Changed[1].Key != "webhook.secret" {
+		t.Fatalf("unexpected changed %+v", res.Changed)
+	}
+	if res.Changed[1].Left != settingsSecretMask || res.Changed[1].Right != settingsSecretMask {
+		t.Fatalf("secret values must be masked, got %+v", res.Changed[1])
+	}
+
+	export := `{"data":[{"key":"limits.rpm","value":60},{"key":"webhook.secret","value":"******","is_secret":true},{"key":"only.a","value":true},{"key":"same","value":{"x":1,"y":"z"}}]}`
+	code, res = do(http.MethodPost, "/api/settings/diff?left="+accA, export)
+	if code != http.StatusOK {
+		t.Fatalf("export diff status %d", code)
+	}
+	if res.Right != "upload" || len(res.Changed) != 0 || len(res.Unverified) != 1 || res.Unverified[0] != "webhook.secret" || res.Unchanged != 3 {
+		t.Fatalf("unexpected export diff %+v", res)
+	}
+
+	if code, _ := do(http.MethodGet, "/api/settings/diff?left="+accA, ""); code != http.StatusBadRequest {
+		t.Fatalf("expected missing right rejected, got %d", code)
+	}
+}
+
+func TestScheduledSettingChangeAppliedAndCancellable(t *testing.T) {
+	mem := &memSettingsStore{}
+	_ = mem.UpsertSetting(&store.Setting{Key: "proxy.retry_max", Scope: "system", Value: 3.0, DataType: "number", Category: "performance"})
+	cache := NewSettingsCache(mem)
+	var notified []string
+	cache.OnChange(func(key string, value any) { notified = append(notified, key) })
+	h := &SettingsHandler{store: mem, cache: cache, scheduler: newSettingsScheduler(mem, cache, nil, nil)}
+	do := func(method, target, body string) (int, map[string]json.RawMessage) {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req = req.WithContext(context.WithValue(req.Context(), isAdminContextKey{}, true))
+		rec := httptest.NewRecorder()
+		h.ScheduledChanges(rec, req)
+		var out map[string]json.RawMessage
+		_ = json.NewDecoder(rec.Body).Decode(&out)
+		return rec.Code, out
+	}
+	schedule := func(value int, at time.Time) scheduledSettingChange {
+		body := fmt.Sprintf(`{"key":"proxy.retry_max","value":%d,"apply_at":%q}`, value, at.Format(time.RFC3339))
+		code, out := do(http.MethodPost, "/api/settings/scheduled", body)
+		if code != http.StatusCreated {
+			t.Fatalf("schedule: %d %s", code, out["error"])
+		}
+		var c scheduledSettingChange
+		_ = json.Unmarshal(out["data"], &c)
+		return c
+	}
+
+	if code, _ := do(http.MethodPost, "/api/settings/scheduled", `{"key":"proxy.retry_max","value":5,"apply_at":"2000-01-01T00:00:00Z"}`); code != http.StatusBadRequest {
+		t.Fatalf("expected past apply_at rejected, got %d", code)
+	}
+	now := time.Now()
+	first := schedule(5, now.Add(time.Hour))
+	second := schedule(9, now.Add(2*time.Hour))
+	if code, _ := do(http.MethodDelete, scheduledSettingsPrefix+second.ID, ""); code != http.StatusOK {
+		t.Fatalf("cancel: %d", code)
+	}
+	_, out := do(http.MethodGet, "/api/settings/scheduled", "")
+	var pending []scheduledSettingChange
+	_ = json.Unmarshal(out["data"], &pending)
+	if len(pending) != 1 || pending[0].ID != first.ID {
+		t.Fatalf("expected only first change pending, got %+v", pending)
+	}
+
+	if n := h.scheduler.applyDue(now.Add(30 * time.Minute)); n != 0 {
+		t.Fatalf("change applied before its time: %d", n)
+	}
+	if n := h.scheduler.applyDue(now.Add(3 * time.Hour)); n != 1 {
+		t.Fatalf("expected one change applied, got %d", n)
+	}
+	setting, _ := mem.GetSetting("proxy.retry_max", "system", "")
+	if setting.Value != 5.0 {
+		t.Fatalf("unexpected value %v", setting.Value)
+	}
+	if setting.Version != 2 || setting.DataType != "number" {
+		t.Fatalf("expected normal version bump with metadata kept, got %+v", setting)
+	}
+	if cache.GetInt("proxy.retry_max", 0) != 5 || len(notified) != 1 {
+		t.Fatalf("cache not updated: %v %v", cache.GetInt("proxy.retry_max", 0), notified)
+	}
+	if code, _ := do(http.MethodDelete, scheduledSettingsPrefix+first.ID, ""); code != http.StatusConflict {
+		t.Fatalf("expected applied change not cancellable, got %d", code)
+	}
+	_, out = do(http.MethodGet, "/api/settings/scheduled?all=true", "")
+	var all []scheduledSettingChange
+	_ = json.Unmarshal(out["data"], &all)
+	if len(all) != 2 || all[0].Status != scheduledApplied || all[0].Version != 2 || all[1].Status != scheduledCancelled {
+		t.Fatalf("unexpected history %+v", all)
+	}
+}
+
+func TestSettingsValidateDryRunReportsAllViolations(t *testing.T) {
+	mem := &memSettingsStore{}
+	_ = mem.UpsertSetting(&store.Setting{Key: "metrics.aggregate_interval", Scope: "system", Value: "1h", DataType: "duration"})
+	_ = mem.UpsertSetting(&store.Setting{Key: "retention.policy", Scope: "system", Value: map[string]any{"raw_metrics": 7.0}, DataType: "object"})
+	_ = mem.UpsertSetting(&store.Setting{Key: "proxy.retry_max", Scope: "system", Value: 3.0, DataType: "number"})
+	before, _ := mem.GetGlobalVersion()
+	h := &SettingsHandler{store: mem}
+	validate := func(body string) (bool, []settingViolation) {
+		req := httptest.NewRequest(http.MethodPost, "/api/settings/validate", strings.NewReader(body))
+		req = req.WithContext(context.WithValue(req.Context(), isAdminContextKey{}, true))
+		rec := httptest.NewRecorder()
+		h.ValidateSettings(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("validate status %d: %s", rec.Code, rec.Body.String())
+		}
+		var out struct {
+			Valid      bool               `json:"valid"`
+			Violations []settingViolation `json:"violations"`
+		}
+		_ = json.NewDecoder(rec.Body).Decode(&out)
+		return out.Valid, out.Violations
+	}
+
+	valid, violations := validate(`{"settings":[
+		{"key":"proxy.retry_max","value":"three"},
+		{"key":"routing.hedge.budget_pct","value":150,"data_type":"number"},
+		{"key":"retention.policy","value":{"raw_metrics":1}},
+		{"key":"metrics.aggregate_interval","value":"48h"},
+		{"key":"routing.adaptive_weight.min","value":8,"data_type":"number"},
+		{"key":"routing.adaptive_weight.max","value":4,"data_type":"number"}
+	]}`)
+	if valid {
+		t.Fatalf("expected violations")
+	}
+	got := map[string]string{}
+	for _, v := range violations {
+		got[v.Key] = v.Error
+	}
+	if len(violations) != 4 || got["proxy.retry_max"] == "" || got["routing.hedge.budget_pct"] == "" ||
+		!strings.Contains(got["metrics.aggregate_interval"], "raw metrics retention") || !strings.Contains(got["routing.adaptive_weight.min"], "must not exceed") {
+		t.Fatalf("unexpected violations %+v", violations)
+	}
+
+	valid, violations = validate(`{"settings":[{"key":"metrics.aggregate_interval","value":"30m"},{"key":"proxy.retry_max","value":5}]}`)
+	if !valid || len(violations) != 0 {
+		t.Fatalf("expected valid batch, got %+v", violations)
+	}
+	if after, _ := mem.GetGlobalVersion(); after != before {
+		t.Fatalf("dry-run must not persist, version %d -> %d", before, after)
+	}
+	setting, _ := mem.GetSetting("proxy.retry_max", "system", "")
+	if setting.Value != 3.0 {
+		t.Fatalf("setting changed by dry-run: %v", setting.Value)
+	}
+}
+
+func TestMaintenanceModeRejectsProxyTrafficOnly(t *testing.T) {
+	var hits atomic.Int64
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer up.Close()
+
+	srv, err := NewBuilder().WithUpstream(up.URL).Build()
+	if err != nil {
+		t.Fatalf("build proxy: %v", err)
+	}
+	end := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	srv.settingsCache = &SettingsCache{data: map[string]any{
+		"maintenance.enabled": true,
+		"maintenance.message": "upgrading database",
+		"maintenance.end_at":  end,
+	}}
+	admin := srv.sessionMgr.Create(srv.defaultAccount.ID, true)
+
+	rec := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(`{}`)))
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), "upgrading database") {
+		t.Fatalf("expected 503 maintenance response, got %d %s", rec.Code, rec.Body.String())
+	}
+	if rec.Header().Get("Retry-After") == "" || hits.Load() != 0 {
+		t.Fatalf("expected Retry-After and no upstream call, hits=%d", hits.Load())
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/admin/auth-events", nil)
+	req.AddCookie(&http.Cookie{Name: "session_token", Value: admin.Token})
+	rec = httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("admin API must stay available during maintenance, got %d", rec.Code)
+	}
+
+	srv.checkMaintenance(time.Now())
+	if !srv.maintenanceOn.Load() {
+		t.Fatalf("expected maintenance transition detected")
+	}
+
+	// 计划开始时间未到时不生效
+	srv.settingsCache = &SettingsCache{data: map[string]any{
+		"maintenance.enabled":  true,
+		"maintenance.start_at": time.Now().Add(time.Hour).UTC().Format(time.RFC3339),
+	}}
+	if srv.maintenanceActive() {
+		t.Fatalf("maintenance must not start before start_at")
+	}
+	srv.checkMaintenance(time.Now())
+	if srv.maintenanceOn.Load() {
+		t.Fatalf("expected maintenance end detected")
+	}
+	rec = httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(`{}`)))
+	if rec.Code != http.StatusOK || hits.Load() != 1 {
+		t.Fatalf("expected traffic forwarded outside the window, got %d", rec.Code)
+	}
+}
+
+func TestAdminRouteMetricsNormalizedAndExported(t *testing.T) {
+	if got := normalizeAdminRoute("/api/nodes/n-123/metrics"); got != "/api/nodes/:id/metrics" {
+		t.Fatalf("unexpected normalized route %q", got)
+	}
+	if got := normalizeAdminRoute("/api/settings/scheduled/abc"); got != "/api/settings/scheduled/:id" {
+		t.Fatalf("unexpected normalized route %q", got)
+	}
+
+	srv, err := NewBuilder().WithUpstream("http://127.0.0.1:1").WithAdminKey("adm").Build()
+	if err != nil {
+		t.Fatalf("build proxy: %v", err)
+	}
+	admin := srv.sessionMgr.Create(srv.defaultAccount.ID, true)
+	for _, path := range []string{"/api/admin/auth-events", "/api/admin/auth-events"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: admin.Token})
+		srv.Handler().ServeHTTP(httptest.NewRecorder(), req)
+	}
+	srv.Handler().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/admin/auth-events", nil))
+
+	var found map[string]interface{}
+	for _, v := range srv.adminRoutes.view() {
+		if v["route"] == "/api/admin/auth-events" && v["method"] == http.MethodGet {
+			found = v
+		}
+	}
+	if found == nil || found["count"] != int64(3) || found["status_2xx"] != int64(2) || found["status_4xx"] != int64(1) {
+		t.Fatalf("unexpected admin route stats: %v", found)
+	}
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/admin/prometheus", nil)
+	req.Header.Set("x-admin-key", "adm")
+	srv.Handler().ServeHTTP(rec, req)
+	body := rec.Body.String()
+	if rec.Code != http.StatusOK ||
+		!strings.Contains(body, `qcc_admin_http_requests_total{method="GET",route="/api/admin/auth-events",code="2xx"} 2`) ||
+		!strings.Contains(body, `qcc_admin_http_request_duration_seconds_count{method="GET",route="/api/admin/auth-events"} 3`) {
+		t.Fatalf("unexpected prometheus output: %d %s", rec.Code, body)
+	}
+}
+
+func TestNodeOrderAPIReordersAllNodes(t *testing.T) {
+	srv, err := NewBuilder().WithUpstream("http://127.0.0.1:1").Build()
+	if err != nil {
+		t.Fatalf("build proxy: %v", err)
+	}
+	b, err := srv.addNode("B", "http://127.0.0.1:2", "", 1)
+	if err != nil {
+		t.Fatalf("add node: %v", err)
+	}
+	c, err := srv.addNode("C", "http://127.0.0.1:3", "", 1)
+	if err != nil {
+		t.Fatalf("add node: %v", err)
+	}
+	def := srv.defaultAccount.ActiveID
+	admin := srv.sessionMgr.Create(srv.defaultAccount.ID, true)
+	put := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/api/nodes/order", strings.NewReader(body))
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: admin.Token})
+		rec := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := put(fmt.Sprintf(`{"ids":[%q,%q]}`, c.ID, b.ID)); rec.Code != http.StatusBadRequest {
+		t.Fatalf("partial list must be rejected, got %d", rec.Code)
+	}
+	if rec := put(fmt.Sprintf(`{"ids":[%q,%q,%q]}`, c.ID, c.ID, def)); rec.Code != http.StatusBadRequest {
+		t.Fatalf("duplicate ids must be rejected, got %d", rec.Code)
+	}
+	if rec := put(fmt.Sprintf(`{"ids":[%q,%q,%q]}`, c.ID, def, b.ID)); rec.Code != http.StatusOK {
+		t.Fatalf("reorder failed: %d %s", rec.Code, rec.Body.String())
+	}
+	if w := []int{srv.getNode(c.ID).Weight, srv.getNode(def).Weight, srv.getNode(b.ID).Weight}; w[0] != 1 || w[1] != 2 || w[2] != 3 {
+		t.Fatalf("unexpected weights after reorder: %v", w)
+	}
+
+	// 存储写入失败返回 500，内存中的顺序保持不变
+	st, err := store.Open("sqlite:" + filepath.Join(t.TempDir(), "qcc.db"))
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	st.Close()
+	srv.store = st
+	if rec := put(fmt.Sprintf(`{"ids":[%q,%q,%q]}`, b.ID, def, c.ID)); rec.Code != http.StatusInternalServerError {
+		t.Fatalf("store failure should return 500, got %d %s", rec.Code, rec.Body.String())
+	}
+	if w := []int{srv.getNode(c.ID).Weight, srv.getNode(def).Weight, srv.getNode(b.ID).Weight}; w[0] != 1 || w[1] != 2 || w[2] != 3 {
+		t.Fatalf("weights must not change when the store write fails: %v", w)
+	}
+	if rec := put(fmt.Sprintf(`{"ids":[%q,%q]}`, c.ID, b.ID)); rec.Code != http.StatusBadRequest {
+		t.Fatalf("validation errors stay 400, got %d", rec.Code)
+	}
+}
+
+func TestDeclarativeSyncPlanAndApply(t *testing.T) {
+	srv, err := NewBuilder().WithUpstream("http://127.0.0.1:1").Build()
+	if err != nil {
+		t.Fatalf("build proxy: %v", err)
+	}
+	old, err := srv.addNode("old", "http://127.0.0.1:2", "k-old", 1)
+	if err != nil {
+		t.Fatalf("add node: %v", err)
+	}
+	keep, err := srv.addNode("keep", "http://127.0.0.1:3", "k-keep", 1)
+	if err != nil {
+		t.Fatalf("add node: %v", err)
+	}
+	def := srv.getNode(srv.defaultAccount.ActiveID).Name
+	admin := srv.sessionMgr.Create(srv.defaultAccount.ID, true)
+	user := srv.sessionMgr.Create(srv.defaultAccount.ID, false)
+	put := func(token, query, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/api/declarative"+query, strings.NewReader(body))
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: token})
+		rec := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+	doc := fmt.Sprintf(`{"nodes":[
+		{"name":%q,"base_url":"http://127.0.0.1:1"},
+		{"name":"keep","base_url":"http://127.0.0.1:3","weight":5},
+		{"name":"new","base_url":"http://127.0.0.1:4","api_key":"k-new","disabled":true}
+	],"routing":{"max_output_tokens":1000}}`, def)
+
+	if rec := put(user.Token, "", doc); rec.Code != http.StatusForbidden {
+		t.Fatalf("non-admin must be rejected, got %d", rec.Code)
+	}
+	if rec := put(admin.Token, "", `{"nodes":[{"name":"a","base_url":"ftp://x"},{"name":"a","base_url":"http://x"}]}`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("invalid document must be rejected, got %d", rec.Code)
+	}
+
+	rec := put(admin.Token, "?dry_run=true", doc)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("dry run failed: %d %s", rec.Code, rec.Body.String())
+	}
+	var plan struct {
+		Summary map[string]int `json:"summary"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &plan); err != nil {
+		t.Fatalf("decode plan: %v", err)
+	}
+	if plan.Summary["create"] != 1 || plan.Summary["update"] != 2 || plan.Summary["delete"] != 1 {
+		t.Fatalf("unexpected plan summary: %v", plan.Summary)
+	}
+	if strings.Contains(rec.Body.String(), "k-new") {
+		t.Fatalf("plan must not expose api keys: %s", rec.Body.String())
+	}
+	if srv.getNode(old.ID) == nil || srv.getNode(keep.ID).Weight != 1 {
+		t.Fatalf("dry run must not change state")
+	}
+
+	if rec := put(admin.Token, "", doc); rec.Code != http.StatusOK {
+		t.Fatalf("apply failed: %d %s", rec.Code, rec.Body.String())
+	}
+	if srv.getNode(old.ID) != nil {
+		t.Fatalf("unlisted node should be deleted")
+	}
+	if srv.getNode(keep.ID).Weight != 5 {
+		t.Fatalf("weight not updated")
+	}
+	if srv.accountPolicy(srv.defaultAccount).MaxOutputTokens != 1000 {
+		t.Fatalf("routing policy not applied")
+	}
+	var created *Node
+	for _, n := range srv.defaultAccount.Nodes {
+		if n.Name == "new" {
+			created = n
+		}
+	}
+	if created == nil || !created.Disabled || created.APIKey != "k-new" {
+		t.Fatalf("node not created as declared: %+v", created)
+	}
+
+	rec = put(admin.Token, "?dry_run=true", doc)
+	if err := json.Unmarshal(rec.Body.Bytes(), &plan); err != nil {
+		t.Fatalf("decode plan: %v", err)
+	}
+	if plan.Summary["create"]+plan.Summary["update"]+plan.Summary["delete"] != 0 {
+		t.Fatalf("second plan should be empty: %s", rec.Body.String())
+	}
+}
+
+func TestUpstreamStatusWebhookAnnotatesNodes(t *testing.T) {
+	srv, err := NewBuilder().WithUpstream("http://127.0.0.1:1").Build()
+	if err != nil {
+		t.Fatalf("build proxy: %v", err)
+	}
+	srv.settingsCache = &SettingsCache{data: map[string]any{
+		"upstream_status.webhook_token": "secret",
+		"upstream_status.providers": map[string]any{
+			"anthropic": map[string]any{"hosts": []any{"anthropic.example"}},
+		},
+	}}
+	official, err := srv.addNode("official", "https://api.anthropic.example", "", 1)
+	if err != nil {
+		t.Fatalf("add node: %v", err)
+	}
+	relay, err := srv.addNode("relay", "https://relay.example", "", 1)
+	if err != nil {
+		t.Fatalf("add node: %v", err)
+	}
+	post := func(path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+	incident := `{"incident":{"id":"inc1","name":"Elevated errors","status":"%s","impact":"major","updated_at":"2026-01-01T00:00:00Z"}}`
+
+	if rec := post("/api/upstream-status/webhook/anthropic?token=wrong", fmt.Sprintf(incident, "investigating")); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("wrong token must be rejected, got %d", rec.Code)
+	}
+	if rec := post("/api/upstream-status/webhook/unknown?token=secret", fmt.Sprintf(incident, "investigating")); rec.Code != http.StatusNotFound {
+		t.Fatalf("unknown provider must be rejected, got %d", rec.Code)
+	}
+	if rec := post("/api/upstream-status/webhook/anthropic?token=secret", fmt.Sprintf(incident, "investigating")); rec.Code != http.StatusOK {
+		t.Fatalf("webhook failed: %d %s", rec.Code, rec.Body.String())
+	}
+	if v := srv.nodeView(srv.defaultAccount, official.ID); v["upstream_incident"] == nil {
+		t.Fatalf("official node should be flagged: %v", v["upstream_incident"])
+	}
+	if v := srv.nodeView(srv.defaultAccount, relay.ID); v["upstream_incident"] != nil {
+		t.Fatalf("relay node must not be flagged: %v", v["upstream_incident"])
+	}
+	evt := srv.withUpstreamIncident(notify.Event{EventType: notify.EventNodeFailed}, official.URL)
+	if evt.UpstreamIncident == "" || notify.SeverityFor(evt) != notify.SeverityWarning {
+		t.Fatalf("alert should be annotated and downgraded: %+v", evt)
+	}
+
+	if rec := post("/api/upstream-status/webhook/anthropic?token=secret", fmt.Sprintf(incident, "resolved")); rec.Code != http.StatusOK {
+		t.Fatalf("resolve webhook failed: %d", rec.Code)
+	}
+	if v := srv.nodeView(srv.defaultAccount, official.ID); v["upstream_incident"] != nil {
+		t.Fatalf("flag should clear after resolution")
+	}
+}
+
+func TestParseUpstreamFeed(t *testing.T) {
+	now := time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)
+	list, err := parseUpstreamFeed("openai", []byte(`{"incidents":[{"id":"a","name":"Outage","status":"identified"},{"id":"b","name":"Old","status":"resolved"}]}`), now)
+	if err != nil || len(list) != 1 || list[0].ID != "a" {
+		t.Fatalf("unexpected json feed result: %+v %v", list, err)
+	}
+	rss := `<?xml version="1.0"?><rss><channel>
+<item><title>Degraded API</title><guid>g1</guid><pubDate>Thu, 01 Jan 2026 20:00:00 +0000</pubDate><description>&lt;p&gt;&lt;strong&gt;Monitoring&lt;/strong&gt; - fix deployed&lt;/p&gt;</description></item>
+<item><title>Fixed</title><guid>g2</guid><pubDate>Thu, 01 Jan 2026 20:00:00 +0000</pubDate><description>&lt;strong&gt;Resolved&lt;/strong&gt; - done</description></item>
+<item><title>Stale</title><guid>g3</guid><pubDate>Mon, 01 Dec 2025 00:00:00 +0000</pubDate><description>&lt;strong&gt;Investigating&lt;/strong&gt;</description></item>
+</channel></rss>`
+	list, err = parseUpstreamFeed("openai", []byte(rss), now)
+	if err != nil || len(list) != 1 || list[0].ID != "g1" || list[0].Status != "monitoring" {
+		t.Fatalf("unexpected rss feed result: %+v %v", list, err)
+	}
+}
+
+func TestBadgeUptimeAndRendering(t *testing.T) {
+	now := time.Date(2026, 3, 31, 12, 0, 0, 0, time.UTC)
+	day := func(offset int) time.Time { return time.Date(2026, 3, 31+offset, 0, 0, 0, 0, time.UTC) }
+	uptime := map[string][]store.UptimeDay{
+		"a": {{NodeID: "a", Day: day(-40), ChecksTotal: 100, ChecksOK: 0}, {NodeID: "a", Day: day(-1), ChecksTotal: 100, ChecksOK: 99}},
+		"b": {{NodeID: "b", Day: day(0), ChecksTotal: 100, ChecksOK: 100}},
+	}
+	nodes := []badgeNode{{id: "a"}, {id: "b"}}
+	if pct := badgeUptime(uptime, nodes, 30, now); pct == nil || *pct != 99.5 {
+		t.Fatalf("30d uptime should ignore older days, got %v", pct)
+	}
+	if pct := badgeUptime(uptime, nodes[:1], 1, now); pct != nil {
+		t.Fatalf("no checks today should report no data, got %v", *pct)
+	}
+	if text, color := badgeUptimeText(badgeUptime(uptime, nodes[1:], 7, now)); text != "100%" || color != "#4c1" {
+		t.Fatalf("unexpected uptime text %s %s", text, color)
+	}
+	almost := 99.999
+	if text, _ := badgeUptimeText(&almost); text != "99.99%" {
+		t.Fatalf("uptime must not round up to 100%%, got %s", text)
+	}
+	svg := string(renderBadgeSVG("<a&b>", "operational", badgeStatusColor(statusOperational)))
+	if !strings.HasPrefix(svg, "<svg") || strings.Contains(svg, "<a&b>") || !strings.Contains(svg, "&lt;a&amp;b&gt;") {
+		t.Fatalf("badge text must be escaped: %s", svg)
+	}
+
+	srv, err := NewBuilder().WithUpstream("http://127.0.0.1:1").Build()
+	if err != nil {
+		t.Fatalf("build proxy: %v", err)
+	}
+	rec := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/badge/tok/uptime-120d.svg", nil))
+	if rec.Code != http.StatusNotFound || rec.Header().Get("Content-Type") != "image/svg+xml; charset=utf-8" {
+		t.Fatalf("invalid badge should be a 404 svg, got %d %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+}
+
+func TestWebhookSigningDualKeysAndReplayWindow(t *testing.T) {
+	now := time.Now()
+	keys := notify.SigningKeys{Current: "whsec_new", Previous: "whsec_old", PreviousUntil: now.Add(time.Hour)}
+
+	var got http.Header
+	var body []byte
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer ts.Close()
+
+	ch, err := notify.BuildChannel(store.NotificationChannelRecord{ChannelType: notify.ChannelWebhook, Config: []byte(`{"url":"` + ts.URL + `"}`)}, "")
+	if err != nil {
+		t.Fatalf("build channel: %v", err)
+	}
+	notify.WithSigningKeys(ch, keys)
+	if err := ch.Send(context.Background(), notify.NotificationMessage{AccountID: "a1", EventType: "node.down", Title: "t", OccurredAt: now}); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if got.Get(notify.HeaderWebhookID) == "" || strings.Count(got.Get(notify.HeaderWebhookSignature), "v1=") != 2 {
+		t.Fatalf("expected id and dual signatures, got %v", got)
+	}
+	for _, secret := range []string{"whsec_new", "whsec_old"} {
+		if err := notify.VerifyWebhook(secret, got, body, 0, now); err != nil {
+			t.Fatalf("verify with %s: %v", secret, err)
+		}
+	}
+	if err := notify.VerifyWebhook("whsec_other", got, body, 0, now); !errors.Is(err, notify.ErrSignatureMismatch) {
+		t.Fatalf("expected mismatch, got %v", err)
+	}
+	if err := notify.VerifyWebhook("whsec_new", got, append(body, ' '), 0, now); !errors.Is(err, notify.ErrSignatureMismatch) {
+		t.Fatalf("tampered body should fail, got %v", err)
+	}
+	if err := notify.VerifyWebhook("whsec_new", got, body, 0, now.Add(6*time.Minute)); !errors.Is(err, notify.ErrSignatureExpired) {
+		t.Fatalf("expected replay window rejection, got %v", err)
+	}
+
+	// 宽限期结束后只保留新密钥签名。
+	h := http.Header{}
+	keys.PreviousUntil = now.Add(-time.Second)
+	notify.SignWebhook(h, keys, body, now)
+	if strings.Count(h.Get(notify.HeaderWebhookSignature), "v1=") != 1 {
+		t.Fatalf("expected single signature after grace, got %q", h.Get(notify.HeaderWebhookSignature))
+	}
+	if err := notify.VerifyWebhook("whsec_old", h, body, 0, now); !errors.Is(err, notify.ErrSignatureMismatch) {
+		t.Fatalf("old secret should be rejected after grace, got %v", err)
+	}
+}
+
+func TestNodeHookSignedActions(t *testing.T) {
+	srv, err := NewBuilder().WithUpstream("http://127.0.0.1:1").Build()
+	if err != nil {
+		t.Fatalf("build proxy: %v", err)
+	}
+	target, err := srv.addNode("maint", "https://maint.example", "", 1)
+	if err != nil {
+		t.Fatalf("add node: %v", err)
+	}
+	other, err := srv.addNode("other", "https://other.example", "", 2)
+	if err != nil {
+		t.Fatalf("add node: %v", err)
+	}
+	hook := NodeHook{ID: "nh-test", Name: "deploy", Secret: "nhsec_test", Nodes: []string{"maint"}, Actions: []string{nodeHookDrain, nodeHookEnable}}
+	srv.defaultAccount.NodeHooks = []NodeHook{hook}
+
+	post := func(secret, id, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, nodeHooksAPIPrefix+hook.ID, strings.NewReader(body))
+		req.Header.Set(notify.HeaderWebhookID, id)
+		notify.SignWebhook(req.Header, notify.SigningKeys{Current: secret}, []byte(body), time.Now())
+		rec := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+	if rec := post("nhsec_wrong", "d1", `{"node":"maint","action":"drain"}`); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("bad signature must be rejected, got %d", rec.Code)
+	}
+	if rec := post(hook.Secret, "d2", `{"node":"maint","action":"disable"}`); rec.Code != http.StatusForbidden {
+		t.Fatalf("action outside scope must be rejected, got %d", rec.Code)
+	}
+	if rec := post(hook.Secret, "d3", `{"node":"`+other.ID+`","action":"drain"}`); rec.Code != http.StatusForbidden {
+		t.Fatalf("node outside scope must be rejected, got %d", rec.Code)
+	}
+	if rec := post(hook.Secret, "d4", `{"node":"maint","action":"drain"}`); rec.Code != http.StatusOK {
+		t.Fatalf("drain failed: %d %s", rec.Code, rec.Body.String())
+	}
+	if state := nodeState(srv.getNode(target.ID)); state != NodeStateDraining {
+		t.Fatalf("expected draining, got %s", state)
+	}
+	if rec := post(hook.Secret, "d4", `{"node":"maint","action":"drain"}`); rec.Code != http.StatusConflict {
+		t.Fatalf("replayed delivery must be rejected, got %d", rec.Code)
+	}
+	if rec := post(hook.Secret, "d5", `{"node":"`+target.ID+`","action":"enable"}`); rec.Code != http.StatusOK {
+		t.Fatalf("enable failed: %d %s", rec.Code, rec.Body.String())
+	}
+	if state := nodeState(srv.getNode(target.ID)); state != NodeStateHealthy {
+		t.Fatalf("expected healthy after enable, got %s", state)
+	}
+	if srv.defaultAccount.NodeHooks[0].LastUsedAt == nil {
+		t.Fatalf("last_used_at should be recorded")
+	}
+}
+
+func TestChaosModeInjectsFailures(t *testing.T) {
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "hello world")
+	}))
+	defer up.Close()
+	srv, err := NewBuilder().WithUpstream(up.URL).WithRetry(1).Build()
+	if err != nil {
+		t.Fatalf("build proxy: %v", err)
+	}
+	nodeID := srv.defaultAccount.ActiveID
+	admin := srv.sessionMgr.Create(srv.defaultAccount.ID, true)
+	user := srv.sessionMgr.Create(srv.defaultAccount.ID, false)
+	chaosReq := func(method, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/api/admin/chaos", strings.NewReader(body))
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: token})
+		rec := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+	send := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(`{}`))
+		rec := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+
+	rule := `{"rules":[{"node_id":"` + nodeID + `","error_rate":1,"error_status":529}],"duration_sec":60}`
+	if rec := chaosReq(http.MethodPut, user.Token, rule); rec.Code != http.StatusForbidden {
+		t.Fatalf("non-admin must be rejected, got %d", rec.Code)
+	}
+	if rec := chaosReq(http.MethodPut, admin.Token, `{"rules":[{"node_id":"`+nodeID+`","error_rate":2}]}`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("invalid rate must be rejected, got %d", rec.Code)
+	}
+	if rec := chaosReq(http.MethodPut, admin.Token, `{"rules":[{"node_id":"missing","error_rate":1}]}`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("unknown node must be rejected, got %d", rec.Code)
+	}
+	if rec := chaosReq(http.MethodPut, admin.Token, rule); rec.Code != http.StatusOK {
+		t.Fatalf("enable chaos failed: %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := send(); rec.Code != http.StatusBadGateway || rec.Header().Get("X-Upstream-Status") != "529" {
+		t.Fatalf("expected injected failure, got %d %q", rec.Code, rec.Header().Get("X-Upstream-Status"))
+	}
+	if _, counters, ok := srv.chaos.rule(nodeID, time.Now()); !ok || counters.errors.Load() == 0 {
+		t.Fatalf("injected errors should be counted")
+	}
+	if fail, _ := srv.chaos.healthFailure(nodeID); fail {
+		t.Fatalf("health checks are unaffected unless health_checks is set")
+	}
+
+	if rec := chaosReq(http.MethodDelete, admin.Token, ""); rec.Code != http.StatusOK {
+		t.Fatalf("disable chaos failed: %d", rec.Code)
+	}
+	if rec := send(); rec.Code != http.StatusOK || rec.Body.String() != "hello world" {
+		t.Fatalf("expected normal response after disabling chaos, got %d %q", rec.Code, rec.Body.String())
+	}
+
+	// 规则到期后自动失效。
+	srv.chaos.start([]chaosRule{{NodeID: nodeID, ErrorRate: 1}}, time.Millisecond, "test", time.Now().Add(-time.Second))
+	if _, _, ok := srv.chaos.rule(nodeID, time.Now()); ok {
+		t.Fatalf("expired chaos rules must not apply")
+	}
+
+	r := &chaosDropReader{rc: io.NopCloser(strings.NewReader("hello world")), remaining: 5}
+	b, err := io.ReadAll(r)
+	if !errors.Is(err, io.ErrUnexpectedEOF) || string(b) != "hello" {
+		t.Fatalf("expected stream dropped after 5 bytes, got %q %v", b, err)
+	}
+}
+
+func TestReplayCorpusAndBaselineComparison(t *testing.T) {
+	var calls atomic.Int64
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if r.Header.Get("x-api-key") != "k-replay" || r.URL.Path != "/v1/messages" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = io.WriteString(w, `{"content":[],"usage":{"input_tokens":12,"output_tokens":7}}`)
+	}))
+	defer up.Close()
+	srv, err := NewBuilder().WithUpstream("http://127.0.0.1:1").Build()
+	if err != nil {
+		t.Fatalf("build proxy: %v", err)
+	}
+	node, err := srv.addNode("replay", up.URL, "k-replay", 1)
+	if err != nil {
+		t.Fatalf("add node: %v", err)
+	}
+	sess := srv.sessionMgr.Create(srv.defaultAccount.ID, false)
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: sess.Token})
+		rec := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do(http.MethodPost, "/api/replay/corpus", `{"name":"greeting","body":{"model":"m1","metadata":{"user_id":"u1"},"messages":[{"role":"user","content":"mail bob@example.com"}]}}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("add corpus failed: %d %s", rec.Code, rec.Body.String())
+	}
+	var entry ReplayEntry
+	_ = json.Unmarshal(rec.Body.Bytes(), &entry)
+	if strings.Contains(entry.Body, "bob@example.com") || strings.Contains(entry.Body, "metadata") || entry.Model != "m1" || entry.Path != "/v1/messages" {
+		t.Fatalf("corpus entry not sanitized: %+v", entry)
+	}
+	if rec := do(http.MethodPost, "/api/replay/corpus", `{"body":"not an object"}`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("non-object body must be rejected, got %d", rec.Code)
+	}
+
+	run := func(body string) map[string]interface{} {
+		rec := do(http.MethodPost, "/api/replay/runs", body)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("replay failed: %d %s", rec.Code, rec.Body.String())
+		}
+		var out map[string]interface{}
+		_ = json.Unmarshal(rec.Body.Bytes(), &out)
+		return out
+	}
+	base := run(`{"node_ids":["` + node.ID + `"],"label":"baseline"}`)
+	summary := base["summary"].([]interface{})[0].(map[string]interface{})
+	if summary["ok"].(float64) != 1 || summary["input_tokens"].(float64) != 12 || summary["output_tokens"].(float64) != 7 {
+		t.Fatalf("unexpected summary: %v", summary)
+	}
+	next := run(`{"node_ids":["` + node.ID + `"],"baseline_id":"` + base["id"].(string) + `"}`)
+	cmp := next["comparison"].([]interface{})[0].(map[string]interface{})
+	if cmp["matched"].(float64) != 1 || cmp["regressions"].(float64) != 0 || cmp["output_tokens_delta"].(float64) != 0 {
+		t.Fatalf("unexpected comparison: %v", cmp)
+	}
+	if calls.Load() != 2 {
+		t.Fatalf("expected 2 upstream calls, got %d", calls.Load())
+	}
+	if rec := do(http.MethodPost, "/api/replay/runs", `{"node_ids":["missing"]}`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("unknown node must be rejected, got %d", rec.Code)
+	}
+	if rec := do(http.MethodGet, "/api/replay/runs/"+next["id"].(string), ""); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"comparison"`) {
+		t.Fatalf("run detail failed: %d %s", rec.Code, rec.Body.String())
+	}
+
+	sse := []byte("event: message_start\ndata: {\"message\":{\"usage\":{\"input_tokens\":30,\"cache_creation\":{\"ephemeral_5m_input_tokens\":0},\"output_tokens\":1}}}\n\n" +
+		"event: message_delta\ndata: {\"usage\":{\"output_tokens\":42}}\n\n")
+	if in, out := replayUsage(sse); in != 30 || out != 42 {
+		t.Fatalf("expected stream usage 30/42, got %d/%d", in, out)
+	}
+}
+
+func TestABComparisonSideBySide(t *testing.T) {
+	upstream := func(key, text string, out int, delay time.Duration) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var body map[string]any
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			if r.Header.Get("x-api-key") != key || body["stream"] != false {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			time.Sleep(delay)
+			fmt.Fprintf(w, `{"content":[{"type":"text","text":%q}],"stop_reason":"end_turn","usage":{"input_tokens":10,"output_tokens":%d}}`, text, out)
+		}))
+	}
+	upA := upstream("k-a", "answer from A", 5, 0)
+	defer upA.Close()
+	upB := upstream("k-b", "a longer answer from B", 9, 30*time.Millisecond)
+	defer upB.Close()
+	srv, err := NewBuilder().WithUpstream("http://127.0.0.1:1").Build()
+	if err != nil {
+		t.Fatalf("build proxy: %v", err)
+	}
+	a, _ := srv.addNode("provider-a", upA.URL, "k-a", 1)
+	b, _ := srv.addNode("provider-b", upB.URL, "k-b", 2)
+	sess := srv.sessionMgr.Create(srv.defaultAccount.ID, false)
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: sess.Token})
+		rec := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := do(http.MethodPost, "/api/ab-comparisons", `{"node_a":"`+a.ID+`","node_b":"`+a.ID+`","prompts":[{"body":{}}]}`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("same node on both sides must be rejected, got %d", rec.Code)
+	}
+	rec := do(http.MethodPost, "/api/ab-comparisons", `{"node_a":"`+a.ID+`","node_b":"`+b.ID+`","label":"pick provider",`+
+		`"prompts":[{"name":"p1","body":{"model":"m1","stream":true,"messages":[{"role":"user","content":"hi"}]}},{"body":{"model":"m1","messages":[]}}]}`)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("start comparison failed: %d %s", rec.Code, rec.Body.String())
+	}
+	var started map[string]interface{}
+	_ = json.Unmarshal(rec.Body.Bytes(), &started)
+	id := started["id"].(string)
+
+	var got struct {
+		Status  string `json:"status"`
+		Summary struct {
+			A abSideSummary `json:"a"`
+			B abSideSummary `json:"b"`
+		} `json:"summary"`
+		Items []abItem `json:"items"`
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for got.Status != exportReady && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		rec = do(http.MethodGet, "/api/ab-comparisons/"+id, "")
+		_ = json.Unmarshal(rec.Body.Bytes(), &got)
+	}
+	if got.Status != exportReady || len(got.Items) != 2 {
+		t.Fatalf("comparison not finished: %s", rec.Body.String())
+	}
+	it := got.Items[0]
+	if it.Prompt.Name != "p1" || it.A.Text != "answer from A" || it.B.Text != "a longer answer from B" || it.B.OutputTokens != 9 || it.A.StopReason != "end_turn" {
+		t.Fatalf("unexpected side-by-side item: %+v", it)
+	}
+	if got.Summary.A.OK != 2 || got.Summary.A.Faster != 2 || got.Summary.B.OutputTokens != 18 || got.Summary.B.NodeName != "provider-b" {
+		t.Fatalf("unexpected summary: %+v", got.Summary)
+	}
+
+	rec = do(http.MethodGet, "/api/ab-comparisons", "")
+	if !strings.Contains(rec.Body.String(), `"count":1`) || strings.Contains(rec.Body.String(), "answer from A") {
+		t.Fatalf("list should include the job without results: %s", rec.Body.String())
+	}
+	if rec = do(http.MethodDelete, "/api/ab-comparisons/"+id, ""); rec.Code != http.StatusOK {
+		t.Fatalf("delete failed: %d", rec.Code)
+	}
+}
+
+func TestTrafficRecordingSampledRedactedJSONL(t *testing.T) {
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"content":[{"type":"text","text":"reach me at alice@example.com"}],"usage":{"input_tokens":3,"output_tokens":4}}`)
+	}))
+	defer up.Close()
+	srv, err := NewBuilder().WithUpstream(up.URL).Build()
+	if err != nil {
+		t.Fatalf("build proxy: %v", err)
+	}
+	dir := t.TempDir()
+	srv.recorder = NewTrafficRecorder(srv, &dirSink{root: dir}, nil)
+	send := func(body string) {
+		req := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "alice@example.com") {
+			t.Fatalf("recording must not alter the client response: %d %s", rec.Code, rec.Body.String())
+		}
+	}
+
+	send(`{"model":"m1","messages":[{"role":"user","content":"not sampled"}]}`)
+	if err := srv.setAccountPolicy(srv.defaultAccount.ID, AccountPolicy{RecordSampleRate: 1, RecordMaxBytes: 64, DisableRedaction: true}, ""); err != nil {
+		t.Fatalf("set policy: %v", err)
+	}
+	send(`{"model":"m1","messages":[{"role":"user","content":"mail bob@example.com"}]}`)
+	if n := srv.recorder.flush(); n != 1 {
+		t.Fatalf("expected one object, got %d", n)
+	}
+
+	var files []string
+	_ = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if len(files) != 1 || !strings.HasSuffix(files[0], ".jsonl") {
+		t.Fatalf("unexpected recording objects: %v", files)
+	}
+	data, _ := os.ReadFile(files[0])
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("expected only the sampled request, got %d lines", len(lines))
+	}
+	var ex recordedExchange
+	if err := json.Unmarshal([]byte(lines[0]), &ex); err != nil {
+		t.Fatalf("invalid jsonl line: %v", err)
+	}
+	if strings.Contains(lines[0], "@example.com") || !strings.Contains(lines[0], "[REDACTED:email]") {
+		t.Fatalf("recording must redact PII even with redaction disabled: %s", lines[0])
+	}
+	if ex.Model != "m1" || ex.Status != http.StatusOK || ex.OutputTokens != 4 || !ex.ResponseTruncated || len(ex.ResponseText) > 64 {
+		t.Fatalf("unexpected exchange: %+v", ex)
+	}
+	stats := srv.recorder.snapshot(srv.defaultAccount.ID)
+	if stats.Captured != 1 || stats.Objects != 1 || stats.LastObject == "" {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+
+	if err := validateAccountPolicy(&AccountPolicy{RecordSampleRate: 1.5}); err == nil {
+		t.Fatalf("sample rate above 1 must be rejected")
+	}
+}
+
+func TestNodeClientCertMTLS(t *testing.T) {
+	newCert := func(cn string, notAfter time.Time, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey, string, string) {
+		key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		tmpl := &x509.Certificate{
+			SerialNumber: big.NewInt(time.Now().UnixNano()),
+			Subject:      pkix.Name{CommonName: cn},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     notAfter,
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		}
+		if parent == nil {
+			tmpl.IsCA, tmpl.BasicConstraintsValid, tmpl.KeyUsage = true, true, x509.KeyUsageCertSign
+			parent, parentKey = tmpl, key
+		}
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+		if err != nil {
+			t.Fatalf("create cert: %v", err)
+		}
+		cert, _ := x509.ParseCertificate(der)
+		keyDER, _ := x509.MarshalECPrivateKey(key)
+		return cert, key, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+			string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+	}
+	ca, caKey, _, _ := newCert("test-ca", time.Now().Add(24*time.Hour), nil, nil)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+
+	up := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, `{"ok":true}`)
+	}))
+	up.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: pool}
+	up.StartTLS()
+	defer up.Close()
+
+	srv, err := NewBuilder().WithUpstream(up.URL).WithTransport(up.Client().Transport).WithRetry(1).Build()
+	if err != nil {
+		t.Fatalf("build proxy: %v", err)
+	}
+	nodeID := srv.defaultAccount.ActiveID
+	proxied := func() int {
+		req := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(`{"messages":[]}`))
+		rec := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(rec, req)
+		return rec.Code
+	}
+	if code := proxied(); code == http.StatusOK {
+		t.Fatalf("upstream requiring mTLS must reject requests without a client certificate")
+	}
+
+	sess := srv.sessionMgr.Create(srv.defaultAccount.ID, false)
+	putCert := func(certPEM, keyPEM string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]string{"cert_pem": certPEM, "key_pem": keyPEM})
+		req := httptest.NewRequest(http.MethodPut, "/api/nodes/"+nodeID+"/client-cert", bytes.NewReader(body))
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: sess.Token})
+		rec := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+	_, _, expiredPEM, expiredKey := newCert("expired", time.Now().Add(-time.Minute), ca, caKey)
+	if rec := putCert(expiredPEM, expiredKey); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expired certificate must be rejected, got %d", rec.Code)
+	}
+	_, _, certPEM, keyPEM := newCert("qcc-client", time.Now().Add(5*24*time.Hour), ca, caKey)
+	if rec := putCert(certPEM, keyPEM); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "CN=qcc-client") || strings.Contains(rec.Body.String(), "PRIVATE KEY") {
+		t.Fatalf("install client cert failed: %d %s", rec.Code, rec.Body.String())
+	}
+	if code := proxied(); code != http.StatusOK {
+		t.Fatalf("expected mTLS request to succeed, got %d", code)
+	}
+
+	if n := srv.certWatch.check(time.Now()); n != 1 {
+		t.Fatalf("certificate expiring within the warning window must alert once, got %d", n)
+	}
+	if n := srv.certWatch.check(time.Now().Add(time.Hour)); n != 0 {
+		t.Fatalf("alert must not repeat within a day, got %d", n)
+	}
+
+	box, _ := newSecretBox("k1")
+	sealed, _ := box.seal([]byte(keyPEM))
+	if strings.Contains(sealed, "PRIVATE") {
+		t.Fatalf("sealed bundle leaks plaintext")
+	}
+	other, _ := newSecretBox("k2")
+	if _, err := other.open(sealed); err == nil {
+		t.Fatalf("opening with the wrong key must fail")
+	}
+	if plain, err := box.open(sealed); err != nil || string(plain) != keyPEM {
+		t.Fatalf("secret box round trip failed: %v", err)
+	}
+}
+
+func TestNodeCABundle(t *testing.T) {
+	up := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, `{"ok":true}`)
+	}))
+	defer up.Close()
+	upstreamCA := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: up.Certificate().Raw}))
+
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "other-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, _ := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	otherCA := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+
+	// 默认传输层只信任系统根证书，私有 CA 签发的上游证书无法通过校验。
+	srv, err := NewBuilder().WithUpstream(up.URL).WithTransport(&http.Transport{}).WithRetry(1).Build()
+	if err != nil {
+		t.Fatalf("build proxy: %v", err)
+	}
+	nodeID := srv.defaultAccount.ActiveID
+	proxied := func() int {
+		req := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(`{"messages":[]}`))
+		rec := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(rec, req)
+		return rec.Code
+	}
+	if code := proxied(); code == http.StatusOK {
+		t.Fatalf("upstream signed by a private CA must not be trusted by default")
+	}
+
+	sess := srv.sessionMgr.Create(srv.defaultAccount.ID, false)
+	call := func(method, suffix, caPEM string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]string{"ca_pem": caPEM})
+		req := httptest.NewRequest(method, "/api/nodes/"+nodeID+suffix, bytes.NewReader(body))
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: sess.Token})
+		rec := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+	if rec := call(http.MethodPut, "/ca-bundle", "not a pem"); rec.Code != http.StatusBadRequest {
+		t.Fatalf("invalid PEM must be rejected, got %d", rec.Code)
+	}
+	if rec := call(http.MethodPut, "/ca-bundle", otherCA); rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "tls test") {
+		t.Fatalf("bundle that does not verify the upstream must be rejected: %d %s", rec.Code, rec.Body.String())
+	}
+	var test nodeTLSTestResult
+	rec := call(http.MethodPost, "/tls-test", upstreamCA)
+	if err := json.Unmarshal(rec.Body.Bytes(), &test); err != nil || !test.OK || len(test.PeerChain) == 0 {
+		t.Fatalf("tls test with the right CA should pass: %d %s", rec.Code, rec.Body.String())
+	}
+	if code := proxied(); code == http.StatusOK {
+		t.Fatalf("tls test must not install the bundle")
+	}
+
+	if rec := call(http.MethodPut, "/ca-bundle", upstreamCA); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "fingerprint") {
+		t.Fatalf("install ca bundle failed: %d %s", rec.Code, rec.Body.String())
+	}
+	if code := proxied(); code != http.StatusOK {
+		t.Fatalf("expected request to succeed with the custom CA, got %d", code)
+	}
+
+	if rec := call(http.MethodDelete, "/ca-bundle", ""); rec.Code != http.StatusOK {
+		t.Fatalf("delete ca bundle failed: %d", rec.Code)
+	}
+	if code := proxied(); code == http.StatusOK {
+		t.Fatalf("removing the bundle must restore system roots")
+	}
+}
+
+func TestNodeDNSOverrideAndCache(t *testing.T) {
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, `{"ok":true}`)
+	}))
+	defer up.Close()
+	_, port, _ := net.SplitHostPort(strings.TrimPrefix(up.URL, "http://"))
+	const host = "api.corp.test"
+
+	// 伪造的 DNS 服务器：对任意 A 查询返回 127.0.0.1，TTL 可调。
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen udp: %v", err)
+	}
+	defer pc.Close()
+	var queries, ttl atomic.Int32
+	ttl.Store(60)
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			queries.Add(1)
+			resp := append([]byte(nil), buf[:n]...)
+			resp[2], resp[3] = 0x81, 0x80
+			resp[6], resp[7] = 0, 1
+			resp = append(resp, 0xc0, 0x0c, 0, 1, 0, 1)
+			resp = binary.BigEndian.AppendUint32(resp, uint32(ttl.Load()))
+			resp = append(resp, 0, 4, 127, 0, 0, 1)
+			_, _ = pc.WriteTo(resp, addr)
+		}
+	}()
+
+	srv, err := NewBuilder().WithUpstream("http://" + net.JoinHostPort(host, port)).WithRetry(1).Build()
+	if err != nil {
+		t.Fatalf("build proxy: %v", err)
+	}
+	nodeID := srv.defaultAccount.ActiveID
+	sess := srv.sessionMgr.Create(srv.defaultAccount.ID, false)
+	call := func(method, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/api/nodes/"+nodeID+"/dns", strings.NewReader(body))
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: sess.Token})
+		rec := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+	proxied := func() int {
+		req := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(`{"messages":[]}`))
+		rec := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if rec := call(http.MethodPut, `{"static_ips":["not-an-ip"]}`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("invalid static ip must be rejected, got %d", rec.Code)
+	}
+	if rec := call(http.MethodPut, `{"static_ips":["127.0.0.1"],"resolver":"127.0.0.1"}`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("static ips and resolver together must be rejected, got %d", rec.Code)
+	}
+	if rec := call(http.MethodPut, `{"static_ips":["127.0.0.1"]}`); rec.Code != http.StatusOK {
+		t.Fatalf("set static ip failed: %d %s", rec.Code, rec.Body.String())
+	}
+	if code := proxied(); code != http.StatusOK {
+		t.Fatalf("static ip override should reach the upstream, got %d", code)
+	}
+
+	resolver := pc.LocalAddr().String()
+	if rec := call(http.MethodPut, `{"resolver":"`+resolver+`"}`); rec.Code != http.StatusOK {
+		t.Fatalf("set resolver failed: %d %s", rec.Code, rec.Body.String())
+	}
+	res, _ := srv.runHealthCheck(srv.defaultAccount, nodeID, false)
+	if res == nil || !res.OK || res.DNS <= 0 || res.DNS > res.Latency {
+		t.Fatalf("health check should resolve through the custom resolver and time it separately: %+v", res)
+	}
+	if code := proxied(); code != http.StatusOK {
+		t.Fatalf("custom resolver should reach the upstream, got %d", code)
+	}
+	if _, cached, err := srv.nodeTLS.dns.lookup(context.Background(), resolver, host, false); err != nil || !cached || queries.Load() != 1 {
+		t.Fatalf("answer must be cached within its TTL: cached=%v err=%v queries=%d", cached, err, queries.Load())
+	}
+	if rec := call(http.MethodGet, ""); !strings.Contains(rec.Body.String(), `"ttl_sec"`) {
+		t.Fatalf("expected cache entry in dns view: %s", rec.Body.String())
+	}
+
+	ttl.Store(0)
+	srv.nodeTLS.dns.forget(resolver)
+	for i := 0; i < 2; i++ {
+		if _, cached, err := srv.nodeTLS.dns.lookup(context.Background(), resolver, host, false); err != nil || cached {
+			t.Fatalf("zero TTL answers must not be cached: cached=%v err=%v", cached, err)
+		}
+	}
+	if queries.Load() != 3 {
+		t.Fatalf("expected a query per lookup with zero TTL, got %d", queries.Load())
+	}
+}
+
+func TestDialIPFamilyPolicy(t *testing.T) {
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, `{"ok":true}`)
+	}))
+	defer up.Close()
+	addr := strings.TrimPrefix(up.URL, "http://")
+
+	if _, err := (config.DialConfig{IPFamily: "v4"}).Options(); err == nil {
+		t.Fatalf("unknown ip family must be rejected")
+	}
+	dial := func(family string) error {
+		conn, err := newDialPolicy(config.DialOptions{IPFamily: family, FallbackDelay: -1}).dialContext()(context.Background(), "tcp", addr)
+		if err == nil {
+			conn.Close()
+		}
+		return err
+	}
+	if err := dial(config.IPFamilyIPv6); err == nil {
+		t.Fatalf("ipv6-only dialing must not reach an ipv4 listener")
+	}
+	if err := dial(config.IPFamilyPreferIPv6); err != nil {
+		t.Fatalf("prefer_ipv6 should fall back to ipv4: %v", err)
+	}
+
+	srv, err := NewBuilder().WithUpstream(up.URL).WithRetry(1).Build()
+	if err != nil {
+		t.Fatalf("build proxy: %v", err)
+	}
+	nodeID := srv.defaultAccount.ActiveID
+	sess := srv.sessionMgr.Create(srv.defaultAccount.ID, false)
+	put := func(body string) int {
+		req := httptest.NewRequest(http.MethodPut, "/api/nodes/"+nodeID+"/dns", strings.NewReader(body))
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: sess.Token})
+		rec := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(rec, req)
+		return rec.Code
+	}
+	proxied := func() int {
+		req := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(`{"messages":[]}`))
+		rec := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(rec, req)
+		return rec.Code
+	}
+	if code := put(`{"ip_family":"ipv5"}`); code != http.StatusBadRequest {
+		t.Fatalf("invalid node ip_family must be rejected, got %d", code)
+	}
+	if code := put(`{"ip_family":"ipv6"}`); code != http.StatusOK {
+		t.Fatalf("set node dial settings failed: %d", code)
+	}
+	if code := proxied(); code == http.StatusOK {
+		t.Fatalf("node forced to ipv6 must not reach an ipv4 upstream")
+	}
+	if code := put(`{"ip_family":"prefer_ipv6","fallback_delay_ms":-1,"dial_timeout_ms":2000}`); code != http.StatusOK {
+		t.Fatalf("set node dial settings failed: %d", code)
+	}
+	if code := proxied(); code != http.StatusOK {
+		t.Fatalf("prefer_ipv6 node should fall back to ipv4, got %d", code)
+	}
+}
+
+func TestHedgingReport(t *testing.T) {
+	now := time.Now()
+	rows := []store.HedgeNodeStats{
+		{NodeID: "primary", RequestsTotal: 180, HedgedTotal: 25, HedgeWinsTotal: 3, HedgeWastedTokens: 2500, InputTokensTotal: 9000, OutputTokensTotal: 1000},
+		{NodeID: "backup", RequestsTotal: 20, HedgedTotal: 5, HedgeWinsTotal: 1, HedgeWastedTokens: 500},
+		{NodeID: "idle", RequestsTotal: 50},
+	}
+	report := buildHedgingReport("acc", now.Add(-time.Hour), now, rows, map[string]string{"primary": "main"})
+	if report["requests"].(int64) != 250 || report["hedged"].(int64) != 30 || report["wasted_tokens"].(int64) != 3000 {
+		t.Fatalf("unexpected totals: %+v", report)
+	}
+	if rate := report["hedge_rate"].(float64); math.Abs(rate-0.12) > 1e-9 {
+		t.Fatalf("expected hedge rate 0.12, got %v", rate)
+	}
+	if overhead := report["token_overhead"].(float64); math.Abs(overhead-0.3) > 1e-9 {
+		t.Fatalf("expected token overhead 0.3, got %v", overhead)
+	}
+	if report["hint"] != hedgeHintRaiseThreshold {
+		t.Fatalf("low win rate should suggest raising the threshold, got %v", report["hint"])
+	}
+	byNode := report["by_node"].([]map[string]interface{})
+	if len(byNode) != 2 || byNode[0]["node_name"] != "main" {
+		t.Fatalf("nodes without hedges must be omitted and sorted by hedge count: %+v", byNode)
+	}
+	if few := buildHedgingReport("acc", now, now, rows[1:], nil); few["hint"] != "" {
+		t.Fatalf("too few samples must not produce a hint, got %v", few["hint"])
+	}
+
+	srv, err := NewBuilder().WithUpstream("http://127.0.0.1:1").Build()
+	if err != nil {
+		t.Fatalf("build proxy: %v", err)
+	}
+	sess := srv.sessionMgr.Create(srv.defaultAccount.ID, false)
+	req := httptest.NewRequest(http.MethodGet, "/api/metrics/hedging", nil)
+	req.AddCookie(&http.Cookie{Name: "session_token", Value: sess.Token})
+	rec := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusInternalServerError || !strings.Contains(rec.Body.String(), "store not enabled") {
+		t.Fatalf("report requires the store: %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestDisabledAPIModules(t *testing.T) {
+	srv, err := NewBuilder().WithUpstream("http://127.0.0.1:1").Build()
+	if err != nil {
+		t.Fatalf("build proxy: %v", err)
+	}
+	srv.settingsCache = &SettingsCache{data: map[string]any{
+		settingDisabledModules: []any{"shares", "status_page", "benchmarks"},
+	}}
+	admin := srv.sessionMgr.Create(srv.defaultAccount.ID, true)
+	do := func(path string, withSession bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if withSession {
+			req.AddCookie(&http.Cookie{Name: "session_token", Value: admin.Token})
+		}
+		rec := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := do("/api/shares", true); rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), `"module":"shares"`) {
+		t.Fatalf("disabled module should return 503 for sessions: %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := do("/status/demo", false); rec.Code != http.StatusNotFound {
+		t.Fatalf("disabled module should return 404 to anonymous callers, got %d", rec.Code)
+	}
+	if rec := do("/api/nodes/n1/health-history?share_token=abc", false); rec.Code != http.StatusNotFound {
+		t.Fatalf("shared health history should follow the shares module, got %d", rec.Code)
+	}
+	if rec := do("/api/nodes/n1/benchmark", true); rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("benchmark routes should be disabled, got %d", rec.Code)
+	}
+	if rec := do("/api/request-logs", true); rec.Code == http.StatusServiceUnavailable {
+		t.Fatalf("enabled modules must not be blocked")
+	}
+
+	rec := do("/api/admin/modules", true)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("list modules: %d %s", rec.Code, rec.Body.String())
+	}
+	var listed struct {
+		Modules []struct {
+			Name    string `json:"name"`
+			Enabled bool   `json:"enabled"`
+		} `json:"modules"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &listed); err != nil {
+		t.Fatalf("decode modules: %v", err)
+	}
+	states := map[string]bool{}
+	for _, m := range listed.Modules {
+		states[m.Name] = m.Enabled
+	}
+	if states["shares"] || !states["ws"] {
+		t.Fatalf("unexpected module states: %+v", states)
+	}
+
+	if err := validateDisabledModules([]any{"shares", "nope"}); err == nil {
+		t.Fatalf("unknown module names must be rejected")
+	}
+	if err := validateDisabledModules([]any{"ws"}); err != nil {
+		t.Fatalf("valid module list rejected: %v", err)
+	}
+}
+
+func TestRoleScopedAPIDocs(t *testing.T) {
+	srv, err := NewBuilder().WithUpstream("http://127.0.0.1:1").Build()
+	if err != nil {
+		t.Fatalf("build proxy: %v", err)
+	}
+	handler := srv.Handler()
+	documented := map[string]bool{}
+	for _, d := range apiRouteDocs {
+		documented[d.Pattern] = true
+	}
+	for pattern := range srv.apiPatterns {
+		if !documented[pattern] {
+			t.Errorf("registered route %s has no API doc entry", pattern)
+		}
+	}
+
+	fetch := func(sess *Session, query string) (int, map[string]map[string]map[string]interface{}) {
+		req := httptest.NewRequest(http.MethodGet, apiDocsPath+query, nil)
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: sess.Token})
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		var spec struct {
+			Paths map[string]map[string]map[string]interface{} `json:"paths"`
+		}
+		if rec.Code == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), &spec); err != nil {
+				t.Fatalf("decode spec: %v", err)
+			}
+		}
+		return rec.Code, spec.Paths
+	}
+
+	admin := srv.sessionMgr.Create(srv.defaultAccount.ID, true)
+	code, full := fetch(admin, "")
+	if code != http.StatusOK || full["/api/settings"]["get"] == nil || full["/admin/api/nodes"]["delete"] == nil {
+		t.Fatalf("admin should get the full spec: %d", code)
+	}
+
+	viewer := srv.sessionMgr.Create(srv.defaultAccount.ID, false)
+	viewer.UserID, viewer.Role = "u1", roleViewer
+	code, paths := fetch(viewer, "")
+	if code != http.StatusOK {
+		t.Fatalf("viewer spec: %d", code)
+	}
+	if paths["/admin/api/nodes"]["get"] == nil || paths["/login"]["post"] == nil {
+		t.Fatalf("viewer should see read and public endpoints: %+v", paths["/admin/api/nodes"])
+	}
+	for path, item := range paths {
+		for method, op := range item {
+			if method != "get" && op["x-min-role"] != "" {
+				t.Fatalf("viewer spec exposes write endpoint %s %s", method, path)
+			}
+		}
+	}
+	if paths["/api/settings"] != nil || paths["/api/accounts/{id}/users"] != nil {
+		t.Fatalf("viewer spec must not include admin endpoints")
+	}
+	if code, _ := fetch(viewer, "?role=member"); code != http.StatusForbidden {
+		t.Fatalf("viewer must not read a higher role's spec, got %d", code)
+	}
+
+	_, member := fetch(admin, "?role=member")
+	if member["/admin/api/nodes"]["delete"] == nil || member["/api/settings"] != nil {
+		t.Fatalf("member view should include writes but no system endpoints")
+	}
+}
+
+func TestNodeMetricsSharedSchema(t *testing.T) {
+	schema := nodeMetricsJSONSchema()
+	props := schema["properties"].(map[string]interface{})
+	typ := reflect.TypeOf(NodeMetrics{})
+	for i := 0; i < typ.NumField(); i++ {
+		tag := strings.Split(typ.Field(i).Tag.Get("json"), ",")[0]
+		if props[tag] == nil {
+			t.Fatalf("field %s missing from JSON schema", tag)
+		}
+	}
+	if len(props) != typ.NumField() {
+		t.Fatalf("schema has %d properties, struct has %d fields", len(props), typ.NumField())
+	}
+
+	now := time.Now()
+	in := nodeMetricsInput{ID: "n1", Name: "main", State: NodeStateHealthy, Method: "head",
+		Metrics: metrics{Requests: 4, FailCount: 1, LastHealthCheckAt: now, LastPingErr: "timeout"}}
+	m := buildNodeMetrics(in, time.Minute, now)
+	if m.SchemaVersion != nodeMetricsSchemaVersion || m.Status != "offline" || m.Traffic.FailedRequests != 1 || m.Health.Status != "down" {
+		t.Fatalf("unexpected payload: %+v", m)
+	}
+	in.Disabled = true
+	if got := buildNodeMetrics(in, time.Minute, now).Status; got != "disabled" {
+		t.Fatalf("disabled node status = %s", got)
+	}
+
+	// 监控面板节点与 WS 载荷字段一致，旧字段 id/name 仍保留。
+	body, err := json.Marshal(MonitorNode{NodeMetrics: m, ID: "n1", Name: "main"})
+	if err != nil {
+		t.Fatalf("marshal monitor node: %v", err)
+	}
+	var node map[string]interface{}
+	_ = json.Unmarshal(body, &node)
+	for _, key := range []string{"schema_version", "node_id", "node_name", "status", "traffic", "health", "timestamp", "id", "name"} {
+		if _, ok := node[key]; !ok {
+			t.Fatalf("monitor node JSON missing %s: %s", key, body)
+		}
+	}
+
+	// 结构化载荷同样按节点合并。
+	hub := NewWSHub()
+	client := &WSClient{hub: hub, accountID: "acc", send: make(chan []byte, wsQueueSize+10)}
+	hub.addClient(client)
+	d := hub.dispatcher("acc")
+	d.running = true
+	hub.Broadcast("acc", "node_metrics", m)
+	hub.Broadcast("acc", "node_metrics", m)
+	if got := hub.counters.coalesced.Load(); got != 1 {
+		t.Fatalf("typed node_metrics payloads should coalesce, got %d", got)
+	}
+}
+
+func TestTokenQuotaSoftWarnings(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"content":[],"usage":{"input_tokens":30,"output_tokens":10}}`)
+	}))
+	defer upstream.Close()
+	srv, err := NewBuilder().WithUpstream(upstream.URL).Build()
+	if err != nil {
+		t.Fatalf("build proxy: %v", err)
+	}
+	if err := srv.setAccountPolicy(srv.defaultAccount.ID, AccountPolicy{TokenQuota: 100, QuotaWarnPct: []int{50}}, ""); err != nil {
+		t.Fatalf("set policy: %v", err)
+	}
+	client := &WSClient{hub: srv.wsHub, accountID: srv.defaultAccount.ID, send: make(chan []byte, 64)}
+	srv.wsHub.addClient(client)
+
+	send := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(`{"model":"m"}`))
+		rec := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+	if rec := send(); rec.Header().Get(quotaRemainingHeader) != "100" || rec.Header().Get(quotaWarningHeader) != "" {
+		t.Fatalf("first request headers: %v", rec.Header())
+	}
+	send() // 80/100，越过 50% 预警
+	rec := send()
+	if rec.Code != http.StatusOK || rec.Header().Get(quotaRemainingHeader) != "20" || rec.Header().Get(quotaWarningHeader) != "50" {
+		t.Fatalf("warning headers: %d %v", rec.Code, rec.Header())
+	}
+	rec = send()
+	if rec.Code != http.StatusTooManyRequests || !strings.Contains(rec.Body.String(), "quota_exceeded") || rec.Header().Get(quotaRemainingHeader) != "0" {
+		t.Fatalf("exhausted quota should be rejected: %d %s", rec.Code, rec.Body.String())
+	}
+
+	var thresholds []float64
+	deadline := time.After(2 * time.Second)
+	for len(thresholds) < 2 {
+		select {
+		case data := <-client.send:
+			var msg struct {
+				Type    string                 `json:"type"`
+				Payload map[string]interface{} `json:"payload"`
+			}
+			if json.Unmarshal(data, &msg) == nil && msg.Type == "quota_warning" {
+				thresholds = append(thresholds, msg.Payload["threshold"].(float64))
+			}
+		case <-deadline:
+			t.Fatalf("expected two quota warnings, got %v", thresholds)
+		}
+	}
+	if thresholds[0] != 50 || thresholds[1] != 100 {
+		t.Fatalf("unexpected warning thresholds: %v", thresholds)
+	}
+
+	if err := validateAccountPolicy(&AccountPolicy{QuotaWarnPct: []int{100}}); err == nil {
+		t.Fatalf("thresholds of 100%% must be rejected")
+	}
+	if err := validateQuotaThresholds([]any{float64(80), float64(95)}); err != nil {
+		t.Fatalf("valid thresholds rejected: %v", err)
+	}
+}
+
+func TestSettingsChangelog(t *testing.T) {
+	mem := &memSettingsStore{}
+	cache := NewSettingsCache(mem)
+	h := &SettingsHandler{store: mem, cache: cache}
+	asAdmin := func(req *http.Request) *http.Request {
+		return req.WithContext(context.WithValue(req.Context(), isAdminContextKey{}, true))
+	}
+	get := func(admin bool, query string) (int, map[string]any) {
+		req := httptest.NewRequest(http.MethodGet, "/api/settings/changes"+query, nil)
+		if admin {
+			req = asAdmin(req)
+		}
+		rec := httptest.NewRecorder()
+		h.ListChanges(rec, req)
+		var body map[string]any
+		_ = json.Unmarshal(rec.Body.Bytes(), &body)
+		return rec.Code, body
+	}
+
+	alice := "alice"
+	_ = mem.UpsertSetting(&store.Setting{Key: "limits.rpm", Scope: "system", Value: 60.0, UpdatedBy: &alice})
+	_ = mem.UpsertSetting(&store.Setting{Key: "limits.rpm", Scope: "system", Value: 90.0, UpdatedBy: &alice})
+	_ = mem.UpsertSetting(&store.Setting{Key: "ui.theme", Scope: "system", Value: "dark"})
+
+	if code, _ := get(false, ""); code != http.StatusForbidden {
+		t.Fatalf("member should be forbidden, got %d", code)
+	}
+	if code, _ := get(true, "?since_version=x"); code != http.StatusBadRequest {
+		t.Fatalf("invalid since_version should be rejected, got %d", code)
+	}
+
+	// 删除经由接口完成，记录操作人
+	rec := httptest.NewRecorder()
+	h.DeleteSetting(rec, asAdmin(httptest.NewRequest(http.MethodDelete, "/api/settings/ui.theme?scope=system", nil)), "ui.theme")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("delete setting: %d %s", rec.Code, rec.Body.String())
+	}
+
+	code, body := get(true, "?since_version=0&limit=2")
+	if code != http.StatusOK {
+		t.Fatalf("list changes: %d", code)
+	}
+	changes := body["changes"].([]any)
+	if len(changes) != 2 || body["has_more"] != true || body["version"].(float64) != 4 {
+		t.Fatalf("unexpected first page: %+v", body)
+	}
+	first := changes[0].(map[string]any)
+	second := changes[1].(map[string]any)
+	if first["version"].(float64) != 1 || first["key"] != "limits.rpm" || first["actor"] != "alice" ||
+		second["version"].(float64) != 2 || second["setting_version"].(float64) != 2 {
+		t.Fatalf("unexpected ordering: %+v", changes)
+	}
+
+	_, body = get(true, "?since_version=2")
+	changes = body["changes"].([]any)
+	if len(changes) != 2 || body["has_more"] != false {
+		t.Fatalf("unexpected incremental page: %+v", body)
+	}
+	del := changes[1].(map[string]any)
+	if del["action"] != store.SettingChangeDelete || del["key"] != "ui.theme" || del["actor"] == nil || del["setting_version"].(float64) != 0 {
+		t.Fatalf("unexpected delete entry: %+v", del)
+	}
+
+	_, body = get(true, "?since_version=4")
+	if changes := body["changes"].([]any); len(changes) != 0 {
+		t.Fatalf("expected no changes past head, got %+v", changes)
+	}
+
+	// 单项与批量更新的操作人都取自会话，请求体中的 updated_by 被忽略
+	asUser := func(req *http.Request) *http.Request {
+		ctx := context.WithValue(req.Context(), isAdminContextKey{}, true)
+		return req.WithContext(context.WithValue(ctx, sessionUserContextKey{}, &sessionUser{ID: "u-bob", Name: "bob"}))
+	}
+	rec = httptest.NewRecorder()
+	h.UpdateSetting(rec, asUser(httptest.NewRequest(http.MethodPut, "/api/settings/limits.rpm",
+		strings.NewReader(`{"value":100,"scope":"system","version":2,"updated_by":"mallory"}`))), "limits.rpm")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("update setting: %d %s", rec.Code, rec.Body.String())
+	}
+	rec = httptest.NewRecorder()
+	h.BatchUpdate(rec, asUser(httptest.NewRequest(http.MethodPost, "/api/settings/batch",
+		strings.NewReader(`{"settings":[{"key":"ui.lang","scope":"system","value":"zh","updated_by":"mallory"}]}`))))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("batch update: %d %s", rec.Code, rec.Body.String())
+	}
+	_, body = get(true, "?since_version=4")
+	changes = body["changes"].([]any)
+	if len(changes) != 2 {
+		t.Fatalf("expected update and batch entries, got %+v", changes)
+	}
+	for _, c := range changes {
+		if entry := c.(map[string]any); entry["actor"] != "u-bob" {
+			t.Fatalf("actor must come from the session: %+v", entry)
+		}
+	}
+
+	// 其他实例写入推进版本号后，定时同步才全量刷新
+	_ = mem.UpsertSetting(&store.Setting{Key: "limits.rpm", Scope: "system", Value: 120.0})
+	cache.RefreshIfChanged()
+	if v := cache.GetInt("limits.rpm", 0); v != 120 {
+		t.Fatalf("expected refreshed value 120, got %d", v)
+	}
+}
+
+// memJobQueue 内存版任务队列，语义与 store 中的实现一致。
+type memJobQueue struct {
+	mu   sync.Mutex
+	jobs []*store.Job
+}
+
+func (m *memJobQueue) EnqueueJob(ctx context.Context, job *store.Job) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if job.MaxAttempts <= 0 {
+		job.MaxAttempts = 1
+	}
+	job.ID, job.Status, job.CreatedAt = int64(len(m.jobs)+1), store.JobPending, time.Now()
+	cp := *job
+	m.jobs = append(m.jobs, &cp)
+	return nil
+}
+
+func (m *memJobQueue) get(id int64) *store.Job {
+	if id <= 0 || int(id) > len(m.jobs) {
+		return nil
+	}
+	return m.jobs[id-1]
+}
+
+func (m *memJobQueue) GetJob(ctx context.Context, id int64) (*store.Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if j := m.get(id); j != nil {
+		cp := *j
+		return &cp, nil
+	}
+	return nil, store.ErrNotFound
+}
+
+func (m *memJobQueue) ListJobs(ctx context.Context, f store.JobFilter) ([]store.Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := []store.Job{}
+	for i := len(m.jobs) - 1; i >= 0; i-- {
+		j := m.jobs[i]
+		if (f.AccountID == "" || j.AccountID == f.AccountID) && (f.Type == "" || j.Type == f.Type) && (f.Status == "" || j.Status == f.Status) {
+			out = append(out, *j)
+		}
+	}
+	return out, nil
+}
+
+func (m *memJobQueue) ClaimJob(ctx context.Context, worker string, types []string) (*store.Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, j := range m.jobs {
+		if j.Status != store.JobPending || j.RunAfter.After(time.Now()) {
+			continue
+		}
+		for _, t := range types {
+			if t == j.Type {
+				j.Status, j.LockedBy = store.JobRunning, worker
+				j.Attempts++
+				cp := *j
+				return &cp, nil
+			}
+		}
+	}
+	return nil, store.ErrNotFound
+}
+
+func (m *memJobQueue) HeartbeatJob(ctx context.Context, id int64, worker string, progress json.RawMessage) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	j := m.get(id)
+	if j == nil || j.Status != store.JobRunning || j.LockedBy != worker {
+		return false, store.ErrNotFound
+	}
+	if progress != nil {
+		j.Progress = progress
+	}
+	return j.CancelRequested, nil
+}
+
+func (m *memJobQueue) FinishJob(ctx context.Context, id int64, worker, status string, result, progress json.RawMessage, errText string, retryAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	j := m.get(id)
+	if j == nil || j.Status != store.JobRunning || j.LockedBy != worker {
+		return store.ErrNotFound
+	}
+	j.Status, j.Result, j.Error, j.RunAfter, j.LockedBy = status, result, errText, retryAt, ""
+	if progress != nil {
+		j.Progress = progress
+	}
+	return nil
+}
+
+func (m *memJobQueue) ReleaseJob(ctx context.Context, id int64, worker string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if j := m.get(id); j != nil && j.Status == store.JobRunning && j.LockedBy == worker {
+		j.Status, j.LockedBy = store.JobPending, ""
+		j.Attempts--
+	}
+	return nil
+}
+
+func (m *memJobQueue) CancelJob(ctx context.Context, id int64) (*store.Job, error) {
+	m.mu.Lock()
+	j := m.get(id)
+	switch {
+	case j != nil && j.Status == store.JobPending:
+		j.Status = store.JobCancelled
+	case j != nil && j.Status == store.JobRunning:
+		j.CancelRequested = true
+	default:
+		m.mu.Unlock()
+		return nil, store.ErrNotFound
+	}
+	m.mu.Unlock()
+	return m.GetJob(ctx, id)
+}
+
+func (m *memJobQueue) RetryJob(ctx context.Context, id int64) (*store.Job, error) {
+	m.mu.Lock()
+	j := m.get(id)
+	if j == nil || (j.Status != store.JobFailed && j.Status != store.JobCancelled) {
+		m.mu.Unlock()
+		return nil, store.ErrNotFound
+	}
+	j.Status, j.Attempts, j.CancelRequested, j.Error, j.RunAfter = store.JobPending, 0, false, "", time.Time{}
+	m.mu.Unlock()
+	return m.GetJob(ctx, id)
+}
+
+func (m *memJobQueue) RequeueStaleJobs(ctx context.Context, lockedBefore time.Time) (int64, error) {
+	return 0, nil
+}
+
+func TestBackgroundJobQueue(t *testing.T) {
+	srv, err := NewBuilder().WithUpstream("http://127.0.0.1:1").Build()
+	if err != nil {
+		t.Fatalf("build proxy: %v", err)
+	}
+	queue := &memJobQueue{}
+	srv.jobs = newJobRunner(queue, srv.logger, 0)
+	srv.jobs.heartbeat = 10 * time.Millisecond
+
+	var calls atomic.Int32
+	srv.jobs.register("flaky", func(ctx context.Context, job *store.Job, _ *jobReporter) (any, error) {
+		if calls.Add(1) < 2 {
+			return nil, errors.New("transient")
+		}
+		return map[string]int{"rows": 42}, nil
+	})
+	started := make(chan struct{})
+	srv.jobs.register("slow", func(ctx context.Context, job *store.Job, _ *jobReporter) (any, error) {
+		close(started)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+
+	if _, err := srv.enqueueJob(context.Background(), "unknown", "", "", nil, 1); err == nil {
+		t.Fatalf("unregistered job types should be rejected")
+	}
+	flaky, err := srv.enqueueJob(context.Background(), "flaky", srv.defaultAccount.ID, "tester", map[string]string{"table": "t"}, 3)
+	if err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+
+	// 首次失败后按退避时间延后，未到时间不会被领取
+	if !srv.jobs.runOnce() {
+		t.Fatalf("expected job to run")
+	}
+	job, _ := queue.GetJob(context.Background(), flaky.ID)
+	if job.Status != store.JobPending || job.Error != "transient" || !job.RunAfter.After(time.Now().Add(20*time.Second)) {
+		t.Fatalf("failed attempt should be scheduled for retry with backoff: %+v", job)
+	}
+	if srv.jobs.runOnce() {
+		t.Fatalf("job should not be claimed before its retry time")
+	}
+	queue.jobs[0].RunAfter = time.Time{}
+	srv.jobs.runOnce()
+	job, _ = queue.GetJob(context.Background(), flaky.ID)
+	if job.Status != store.JobSucceeded || job.Attempts != 2 || string(job.Result) != `{"rows":42}` {
+		t.Fatalf("unexpected job after retry: %+v", job)
+	}
+
+	// 运行中的任务通过接口取消，worker 在心跳时发现并中止
+	slow, _ := srv.enqueueJob(context.Background(), "slow", srv.defaultAccount.ID, "", nil, 3)
+	done := make(chan struct{})
+	go func() { srv.jobs.runOnce(); close(done) }()
+	<-started
+
+	member := srv.sessionMgr.Create(srv.defaultAccount.ID, false)
+	other, _ := srv.enqueueJob(context.Background(), "flaky", "acc-other", "", nil, 1)
+	do := func(method, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: member.Token})
+		rec := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+	if rec := do(http.MethodGet, fmt.Sprintf("/api/jobs/%d", other.ID)); rec.Code != http.StatusNotFound {
+		t.Fatalf("jobs of other accounts should be hidden, got %d", rec.Code)
+	}
+	rec := do(http.MethodGet, "/api/jobs")
+	var list struct {
+		Jobs []store.Job `json:"jobs"`
+	}
+	_ = json.Unmarshal(rec.Body.Bytes(), &list)
+	if rec.Code != http.StatusOK || len(list.Jobs) != 2 {
+		t.Fatalf("expected the account's two jobs, got %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := do(http.MethodPost, fmt.Sprintf("/api/jobs/%d/cancel", slow.ID)); rec.Code != http.StatusOK {
+		t.Fatalf("cancel running job: %d %s", rec.Code, rec.Body.String())
+	}
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("running job was not interrupted after cancellation")
+	}
+	job, _ = queue.GetJob(context.Background(), slow.ID)
+	if job.Status != store.JobCancelled {
+		t.Fatalf("expected cancelled job, got %+v", job)
+	}
+	if rec := do(http.MethodPost, fmt.Sprintf("/api/jobs/%d/cancel", slow.ID)); rec.Code != http.StatusNotFound {
+		t.Fatalf("finished jobs cannot be cancelled again, got %d", rec.Code)
+	}
+	rec = do(http.MethodPost, fmt.Sprintf("/api/jobs/%d/retry", slow.ID))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"status":"pending"`) {
+		t.Fatalf("retry cancelled job: %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestJobProgressBroadcast(t *testing.T) {
+	srv, err := NewBuilder().WithUpstream("http://127.0.0.1:1").Build()
+	if err != nil {
+		t.Fatalf("build proxy: %v", err)
+	}
+	queue := &memJobQueue{}
+	srv.jobs = newJobRunner(queue, srv.logger, 0)
+	srv.jobs.heartbeat = 20 * time.Millisecond
+	srv.jobs.publish = srv.broadcastJobProgress
+	owner := &WSClient{hub: srv.wsHub, accountID: srv.defaultAccount.ID, send: make(chan []byte, 32)}
+	other := &WSClient{hub: srv.wsHub, accountID: "other", send: make(chan []byte, 32)}
+	srv.wsHub.addClient(owner)
+	srv.wsHub.addClient(other)
+
+	persisted := make(chan json.RawMessage, 1)
+	srv.jobs.register("import", func(ctx context.Context, job *store.Job, progress *jobReporter) (any, error) {
+		progress.Stage("nodes")
+		progress.Update(25, 100)
+		// 等待心跳把进度写入队列
+		for i := 0; i < 100; i++ {
+			if j, _ := queue.GetJob(ctx, job.ID); len(j.Progress) > 0 {
+				persisted <- j.Progress
+				break
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		progress.Update(50, 100) // 节流期内，不单独推送
+		return nil, nil
+	})
+	job, _ := srv.enqueueJob(context.Background(), "import", srv.defaultAccount.ID, "", nil, 1)
+	srv.jobs.runOnce()
+
+	select {
+	case raw := <-persisted:
+		var p JobProgress
+		_ = json.Unmarshal(raw, &p)
+		if p.Processed != 25 || p.Total != 100 || p.Stage != "nodes" {
+			t.Fatalf("unexpected persisted progress: %s", raw)
+		}
+	default:
+		t.Fatalf("progress was not persisted through heartbeat")
+	}
+
+	var events []JobProgress
+	deadline := time.After(2 * time.Second)
+	for len(events) < 2 {
+		select {
+		case data := <-owner.send:
+			var msg struct {
+				Type    string      `json:"type"`
+				Payload JobProgress `json:"payload"`
+			}
+			if json.Unmarshal(data, &msg) == nil && msg.Type == wsTopicJobProgress {
+				events = append(events, msg.Payload)
+			}
+		case <-deadline:
+			t.Fatalf("expected two progress events, got %+v", events)
+		}
+	}
+	first, last := events[0], events[1]
+	if first.JobID != job.ID || first.Status != store.JobRunning || first.Percent != 25 || first.ETASeconds == nil {
+		t.Fatalf("unexpected running event: %+v", first)
+	}
+	if last.Status != store.JobSucceeded || last.Percent != 100 || last.Processed != 100 || last.ETASeconds != nil {
+		t.Fatalf("unexpected final event: %+v", last)
+	}
+	stored, _ := queue.GetJob(context.Background(), job.ID)
+	if !strings.Contains(string(stored.Progress), `"status":"succeeded"`) {
+		t.Fatalf("final progress should be saved: %s", stored.Progress)
+	}
+	select {
+	case data := <-other.send:
+		t.Fatalf("other accounts must not receive job progress: %s", data)
+	default:
+	}
+
+	p := buildJobProgress(30, 120, time.Now().Add(-30*time.Second), time.Now())
+	if p.Percent != 25 || p.ETASeconds == nil || *p.ETASeconds != 90 {
+		t.Fatalf("unexpected percent/eta: %+v", p)
+	}
+}
+
+func TestSchedulerOverlapAndCatchUpRanges(t *testing.T) {
+	m := NewMetricsScheduler(nil, nil)
+	unlock, ok := m.tryLockAggregation()
+	if !ok {
+		t.Fatalf("first aggregation should acquire the lock")
+	}
+	if _, ok := m.tryLockAggregation(); ok {
+		t.Fatalf("overlapping aggregation should be rejected")
+	}
+	m.runCatchUp() // 聚合进行中，补聚合直接跳过
+	if _, ok := m.tryLockCleanup(); !ok {
+		t.Fatalf("cleanup lock is independent of aggregation")
+	}
+	unlock()
+	if unlock, ok := m.tryLockAggregation(); !ok {
+		t.Fatalf("lock should be free after unlock")
+	} else {
+		unlock()
+	}
+	skipped := m.status()["skipped_runs"].(map[string]int64)
+	if skipped["aggregation"] != 2 || skipped["cleanup"] != 0 {
+		t.Fatalf("unexpected skip counters: %v", skipped)
+	}
+	var nilSched *MetricsScheduler
+	if unlock, ok := nilSched.tryLockAggregation(); !ok {
+		t.Fatalf("disabled scheduler should not block manual runs")
+	} else {
+		unlock()
+	}
+
+	h := func(day, hour int) time.Time { return time.Date(2026, 3, day, hour, 0, 0, 0, time.UTC) }
+	hourly := func(t time.Time) time.Time { return t.Add(time.Hour) }
+	ranges := bucketRanges([]time.Time{h(1, 1), h(1, 2), h(1, 3), h(1, 7), h(2, 0)}, hourly)
+	want := []bucketRange{{h(1, 1), h(1, 4)}, {h(1, 7), h(1, 8)}, {h(2, 0), h(2, 1)}}
+	if !reflect.DeepEqual(ranges, want) {
+		t.Fatalf("unexpected ranges: %v", ranges)
+	}
+
+	// 回填的小时所在的天需要重算，未结束的当天除外
+	days := mergeBuckets([]time.Time{h(3, 0)}, parentBuckets([]time.Time{h(1, 5), h(1, 9), h(2, 3), h(4, 1)}, startOfDay, h(4, 0)))
+	if !reflect.DeepEqual(days, []time.Time{h(1, 0), h(2, 0), h(3, 0)}) {
+		t.Fatalf("unexpected day buckets: %v", days)
+	}
+	if got := catchUpLookback(0, catchUpHourlyMaxLookback); got != catchUpHourlyMaxLookback {
+		t.Fatalf("unset retention should use the cap, got %v", got)
+	}
+	if got := catchUpLookback(48*time.Hour, catchUpHourlyMaxLookback); got != 48*time.Hour {
+		t.Fatalf("shorter retention should bound lookback, got %v", got)
+	}
+}
+
+func TestConsistencyCheckWindowsAndSkip(t *testing.T) {
+	now := time.Date(2026, 3, 10, 1, 30, 0, 0, time.UTC)
+	hourFrom, hourTo, dayFrom, dayTo := consistencyWindows(now)
+	// 刚结束的小时可能尚未聚合；凌晨 2 点前前一天的最后几个小时仍在等待聚合
+	if !hourTo.Equal(time.Date(2026, 3, 10, 0, 0, 0, 0, time.UTC)) || !hourFrom.Equal(hourTo.Add(-24*time.Hour)) {
+		t.Fatalf("unexpected hourly window: %v - %v", hourFrom, hourTo)
+	}
+	if !dayTo.Equal(time.Date(2026, 3, 9, 0, 0, 0, 0, time.UTC)) || !dayFrom.Equal(time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected daily window: %v - %v", dayFrom, dayTo)
+	}
+	if _, _, _, dayTo := consistencyWindows(now.Add(3 * time.Hour)); !dayTo.Equal(time.Date(2026, 3, 10, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("yesterday should be checked after 02:00, got %v", dayTo)
+	}
+
+	m := NewMetricsScheduler(nil, nil)
+	unlock, _ := m.tryLockAggregation()
+	m.runConsistencyCheck() // 与聚合共用运行锁，聚合进行中时跳过
+	unlock()
+	status := m.status()
+	check := status["consistency_check"].(map[string]interface{})
+	if check["interval"] != defaultConsistencyInterval.String() || check["last_run"] != nil {
+		t.Fatalf("unexpected consistency status: %v", check)
+	}
+	if skipped := status["skipped_runs"].(map[string]int64); skipped["aggregation"] != 1 {
+		t.Fatalf("skipped check should be counted: %v", skipped)
+	}
+	m.consistencyInterval = 0
+	if m.status()["consistency_check"] != nil {
+		t.Fatalf("disabled check should report nil")
+	}
+}
+
+func TestConsistencyCheckAfterDailyAggregation(t *testing.T) {
+	st, err := store.Open("sqlite:" + filepath.Join(t.TempDir(), "qcc.db"))
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	defer st.Close()
+	ctx := context.Background()
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	day := time.Date(2026, 3, 7, 0, 0, 0, 0, time.UTC)
+	for h := 0; h < 6; h++ {
+		rec := store.MetricsRecord{AccountID: "acc1", NodeID: "n1", Timestamp: day.Add(time.Duration(h)*time.Hour + 5*time.Minute),
+			RequestsTotal: 3, InputTokensTotal: 100, OutputTokensTotal: 20, BytesTotal: 1000}
+		if err := st.InsertMetrics(ctx, rec); err != nil {
+			t.Fatalf("insert metrics: %v", err)
+		}
+	}
+	for _, target := range []store.MetricsGranularity{store.MetricsGranularityHourly, store.MetricsGranularityDaily, store.MetricsGranularityMonthly} {
+		if err := st.AggregateMetrics(ctx, "", target, day.AddDate(0, 0, -7), now); err != nil {
+			t.Fatalf("aggregate %s: %v", target, err)
+		}
+	}
+
+	// 一天内的多个小时必须累加到同一个天级桶，检查才不会每次都报告不一致。
+	m := NewMetricsScheduler(st, nil)
+	report := &consistencyReport{}
+	if err := m.checkConsistency(ctx, now, report); err != nil {
+		t.Fatalf("check consistency: %v", err)
+	}
+	if len(report.Mismatches) != 0 {
+		t.Fatalf("unexpected mismatches after aggregation: %+v", report.Mismatches)
+	}
+	months, err := st.CompareAggregateBuckets(ctx, store.MetricsGranularityMonthly, time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil || len(months) != 0 {
+		t.Fatalf("monthly mismatches = %+v, %v", months, err)
+	}
+}
+
+func TestMetricsQueryGuardrails(t *testing.T) {
+	parse := func(query string) error {
+		_, _, _, _, _, err := parseMetricsQueryParams(httptest.NewRequest(http.MethodGet, "/api/nodes/n1/metrics?"+query, nil))
+		return err
+	}
+	if err := parse("granularity=raw&from=2026-03-01T00:00:00Z&to=2026-03-08T00:00:00Z&limit=1000"); err != nil {
+		t.Fatalf("7 days of raw data should be allowed: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	writeQueryError(rec, parse("granularity=raw&from=2026-01-01T00:00:00Z&to=2026-04-01T00:00:00Z"))
+	var body map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if rec.Code != http.StatusBadRequest || body["code"] != "query_too_large" || body["suggested_granularity"] != "hour" || body["max_range_hours"] != float64(7*24) {
+		t.Fatalf("90 days of raw data should suggest hourly granularity: %d %v", rec.Code, body)
+	}
+	var qle *queryLimitError
+	if err := parse("granularity=hour&from=2026-01-01T00:00:00Z&to=2026-03-01T00:00:00Z"); err != nil {
+		t.Fatalf("2 months of hourly data should be allowed: %v", err)
+	}
+	if err := parse("granularity=month&from=2000-01-01T00:00:00Z&to=2026-01-01T00:00:00Z"); !errors.As(err, &qle) || qle.suggested != "" {
+		t.Fatalf("range beyond the coarsest granularity should only ask for a shorter range: %v", err)
+	}
+	if err := parse("limit=5000"); !errors.As(err, &qle) || qle.maxRows != metricsMaxLimit {
+		t.Fatalf("oversized limit should be rejected: %v", err)
+	}
+	if err := parse("from=bad"); errors.As(err, &qle) {
+		t.Fatalf("malformed params are not cost errors: %v", err)
+	}
+	if err := tooManyRowsError(store.MetricsGranularityHourly, metricsMaxScanRows); !errors.As(err, &qle) || qle.suggested != store.MetricsGranularityDaily {
+		t.Fatalf("row cap should suggest the next coarser granularity: %v", err)
+	}
+}
+
+func TestSessionsPersistAcrossRestart(t *testing.T) {
+	st, err := store.Open("sqlite:" + filepath.Join(t.TempDir(), "qcc.db"))
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	defer st.Close()
+	newManager := func() *SessionManager {
+		m := NewSessionManager(time.Hour)
+		m.persist = st
+		return m
+	}
+	first := newManager()
+	sess := first.Create("acc1", false)
+	sess.UserID, sess.UserName, sess.Role = "u1", "alice", roleMember
+	sess.mustChangePassword.Store(true)
+	first.Save(sess)
+	other := first.Create("acc2", false)
+
+	// 重启后（新的管理器）按 token 从存储加载
+	restarted := newManager()
+	got := restarted.Get(sess.Token)
+	if got == nil || got.AccountID != "acc1" || got.UserName != "alice" || got.Role != roleMember || !got.mustChangePassword.Load() {
+		t.Fatalf("session should survive restart: %+v", got)
+	}
+	if restarted.Get("unknown-token") != nil {
+		t.Fatalf("unknown tokens must not resolve")
+	}
+
+	// 一个实例注销后，其他实例缓存的会话在核对时失效
+	restarted.Delete(sess.Token)
+	sess.checkedAt.Store(time.Now().Add(-2 * sessionRecheckInterval).UnixNano())
+	if first.Get(sess.Token) != nil {
+		t.Fatalf("session deleted elsewhere should be dropped on recheck")
+	}
+	restarted.DeleteAccount("acc2")
+	if newManager().Get(other.Token) != nil {
+		t.Fatalf("account sessions should be removed from the store")
+	}
+}
+
+func TestDeleteAccountRevokesSessions(t *testing.T) {
+	srv, err := NewBuilder().WithUpstream("http://127.0.0.1:1").Build()
+	if err != nil {
+		t.Fatalf("build proxy: %v", err)
+	}
+	acc, err := srv.createAccount("tenant", "tenant-key", "", false)
+	if err != nil {
+		t.Fatalf("create account: %v", err)
+	}
+	tenant := srv.sessionMgr.Create(acc.ID, false)
+	admin := srv.sessionMgr.Create(srv.defaultAccount.ID, true)
+
+	req := httptest.NewRequest(http.MethodDelete, "/admin/api/accounts?id="+acc.ID, nil)
+	req.AddCookie(&http.Cookie{Name: "session_token", Value: admin.Token})
+	rec := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || srv.getAccountByID(acc.ID) != nil {
+		t.Fatalf("delete account failed: %d %s", rec.Code, rec.Body.String())
+	}
+	if srv.sessionMgr.Validate(tenant.Token) {
+		t.Fatalf("sessions of deleted account must be revoked")
+	}
+	if !srv.sessionMgr.Validate(admin.Token) {
+		t.Fatalf("admin session must survive")
+	}
+}
+
+func TestAccountExportAsyncArchive(t *testing.T) {
+	srv, err := NewBuilder().WithUpstream("http://127.0.0.1:1").Build()
+	if err != nil {
+		t.Fatalf("build proxy: %v", err)
+	}
+	acc, err := srv.createAccount("tenant", "tenant-key", "", false)
+	if err != nil {
+		t.Fatalf("create account: %v", err)
+	}
+	acc.Users = []AccountUser{{ID: "u1", Name: "alice", Role: roleViewer, PasswordHash: "secret-hash"}}
+	owner := srv.sessionMgr.Create(acc.ID, false)
+	other := srv.sessionMgr.Create(srv.defaultAccount.ID, false)
+	do := func(method, path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: token})
+		rec := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+
+	base := "/api/accounts/" + acc.ID + "/export"
+	if rec := do(http.MethodPost, base, other.Token); rec.Code != http.StatusForbidden {
+		t.Fatalf("other account must not export, got %d", rec.Code)
+	}
+	rec := do(http.MethodPost, base, owner.Token)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("start export failed: %d %s", rec.Code, rec.Body.String())
+	}
+	var job struct {
+		ID     string `json:"id"`
+		Status string `json:"status"`
+	}
+	_ = json.Unmarshal(rec.Body.Bytes(), &job)
+	deadline := time.Now().Add(2 * time.Second)
+	for job.Status != exportReady && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		rec = do(http.MethodGet, base+"/"+job.ID, owner.Token)
+		_ = json.Unmarshal(rec.Body.Bytes(), &job)
+	}
+	if job.Status != exportReady {
+		t.Fatalf("export not ready: %s", rec.Body.String())
+	}
+
+	rec = do(http.MethodGet, base+"/"+job.ID+"/download", owner.Token)
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/zip" {
+		t.Fatalf("download failed: %d", rec.Code)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+	if err != nil {
+		t.Fatalf("open archive: %v", err)
+	}
+	files := map[string]string{}
+	for _, f := range zr.File {
+		rc, _ := f.Open()
+		b, _ := io.ReadAll(rc)
+		rc.Close()
+		files[f.Name] = string(b)
+	}
+	for _, name := range []string{"manifest.json", "account.json", "nodes.json"} {
+		if _, ok := files[name]; !ok {
+			t.Fatalf("archive missing %s: %v", name, files)
+		}
+	}
+	if !strings.Contains(files["account.json"], "alice") || strings.Contains(files["account.json"], "secret-hash") {
+		t.Fatalf("account.json must list members without password hashes: %s", files["account.json"])
+	}
+}
+
+func TestDimensionLimiterCapsCardinality(t *testing.T) {
+	l := newDimensionLimiter()
+	if got := l.admit("acc", "model", "claude-a", 2); got != "claude-a" {
+		t.Fatalf("expected first value admitted, got %s", got)
+	}
+	l.admit("acc", "model", "claude-b", 2)
+	if got := l.admit("acc", "model", "claude-c", 2); got != rollupOtherValue {
+		t.Fatalf("expected overflow bucket, got %s", got)
+	}
+	if got := l.admit("acc", "model", "claude-a", 2); got != "claude-a" {
+		t.Fatalf("expected known value kept, got %s", got)
+	}
+	if got := l.admit("other", "model", "claude-c", 2); got != "claude-c" {
+		t.Fatalf("limits must be per account, got %s", got)
+	}
+}
+
+func TestThroughputBroadcastComputesRates(t *testing.T) {
+	srv, err := NewBuilder().WithUpstream("http://127.0.0.1:1").Build()
+	if err != nil {
+		t.Fatalf("build proxy: %v", err)
+	}
+	client := &WSClient{hub: srv.wsHub, accountID: srv.defaultAccount.ID, send: make(chan []byte, 8)}
+	srv.wsHub.addClient(client)
+
+	tb := NewThroughputBroadcaster(srv, nil)
+	now := time.Now()
+	tb.lastAt = now
+	live := srv.throughputFor(srv.defaultAccount.ID)
+	live.active.Add(1)
+	tb.tick(now.Add(time.Second)) // 建立基线
+
+	live.requests.Add(10)
+	live.tokens.Add(400)
+	tb.tick(now.Add(3 * time.Second))
+
+	var last WSMessage
+	deadline := time.After(2 * time.Second)
+	for i := 0; i < 2; i++ {
+		select {
+		case data := <-client.send:
+			if err := json.Unmarshal(data, &last); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+		case <-deadline:
+			t.Fatalf("timed out waiting for throughput message %d", i)
+		}
+	}
+	payload := last.Payload.(map[string]interface{})
+	if last.Type != "throughput" || payload["rps"].(float64) != 5 || payload["tokens_per_sec"].(float64) != 200 {
+		t.Fatalf("unexpected throughput message: %+v", last)
+	}
+	if payload["active_streams"].(float64) != 1 {
+		t.Fatalf("expected 1 active stream, got %v", payload["active_streams"])
+	}
+}
+
+func TestMetricsFlusherMergesPerBucket(t *testing.T) {
+	srv, err := NewBuilder().WithUpstream("http://127.0.0.1:1").Build()
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	f := NewMetricsFlusher(srv, nil)
+	base := time.Date(2026, 1, 1, 10, 5, 0, 0, time.UTC)
+	rec := func(node string, at time.Time, ok bool) store.MetricsRecord {
+		r := store.MetricsRecord{AccountID: "a1", NodeID: node, Timestamp: at, RequestsTotal: 1, ResponseTimeSumMs: 100, ResponseTimeCount: 1, OutputTokensTotal: 10}
+		if ok {
+			r.RequestsSuccess = 1
+		} else {
+			r.RequestsFailed = 1
+		}
+		return r
+	}
+	f.add(rec("n1", base, true))
+	f.add(rec("n1", base.Add(time.Minute), false))
+	f.add(rec("n2", base, true))
+	f.add(rec("n1", base.Add(time.Hour), true)) // 跨小时单独成行
+
+	if len(f.pending) != 3 {
+		t.Fatalf("expected 3 buckets, got %d", len(f.pending))
+	}
+	key := metricsBucketKey{accountID: "a1", nodeID: "n1", hour: base.Truncate(time.Hour).Unix()}
+	got := f.pending[key]
+	if got == nil || got.RequestsTotal != 2 || got.RequestsSuccess != 1 || got.RequestsFailed != 1 || got.OutputTokensTotal != 20 {
+		t.Fatalf("unexpected merged record: %+v", got)
+	}
+	if !got.Timestamp.Equal(base.Add(time.Minute)) {
+		t.Fatalf("timestamp should be latest sample, got %v", got.Timestamp)
+	}
+	if f.enabled() {
+		t.Fatalf("flusher should be disabled without store")
+	}
+	f.flush()
+	if len(f.pending) != 0 {
+		t.Fatalf("flush should drain pending buckets")
+	}
+}
+
+func TestMetricsFlusherRequeuesFailedBatch(t *testing.T) {
+	srv, err := NewBuilder().WithUpstream("http://127.0.0.1:1").Build()
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "qcc.db")
+	st, err := store.Open("sqlite:" + path)
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	srv.store = st
+	var nodeID string
+	for id := range srv.nodeIndex {
+		nodeID = id
+	}
+	f := NewMetricsFlusher(srv, nil)
+	at := time.Now().UTC()
+	f.add(store.MetricsRecord{AccountID: store.DefaultAccountID, NodeID: nodeID, Timestamp: at, RequestsTotal: 1})
+	f.addNode(nodeID)
+	f.addNode("deleted-node")
+
+	// 存储不可用时本批放回缓冲，与新到的同维度数据合并
+	st.Close()
+	if n := f.flush(); n != 0 {
+		t.Fatalf("nothing should be written while the store is down, got %d", n)
+	}
+	f.add(store.MetricsRecord{AccountID: store.DefaultAccountID, NodeID: nodeID, Timestamp: at, RequestsTotal: 1})
+	if len(f.pending) != 1 || len(f.nodes) != 1 {
+		t.Fatalf("failed rows should be requeued: pending=%d nodes=%v", len(f.pending), f.nodes)
+	}
+	for _, rec := range f.pending {
+		if rec.RequestsTotal != 2 {
+			t.Fatalf("requeued row should merge with new data: %+v", rec)
+		}
+	}
+
+	st, err = store.Open("sqlite:" + path)
+	if err != nil {
+		t.Fatalf("reopen store: %v", err)
+	}
+	defer st.Close()
+	srv.store = st
+	if n := f.flush(); n != 1 || len(f.pending) != 0 || len(f.nodes) != 0 {
+		t.Fatalf("retry should drain the buffer: written=%d pending=%d nodes=%d", n, len(f.pending), len(f.nodes))
+	}
+	nodes, err := st.GetNodesByAccount(context.Background(), store.DefaultAccountID)
+	if err != nil || len(nodes) != 1 || nodes[0].ID != nodeID {
+		t.Fatalf("only existing nodes should be written: %+v %v", nodes, err)
+	}
+
+	// 缓冲已满时新维度的行被丢弃，已有维度仍可合并
+	for i := 0; i < maxPendingMetricsRows; i++ {
+		f.add(store.MetricsRecord{NodeID: strconv.Itoa(i), Timestamp: at, RequestsTotal: 1})
+	}
+	f.add(store.MetricsRecord{NodeID: "overflow", Timestamp: at, RequestsTotal: 1})
+	f.add(store.MetricsRecord{NodeID: "0", Timestamp: at, RequestsTotal: 1})
+	if len(f.pending) != maxPendingMetricsRows || f.dropped != 1 {
+		t.Fatalf("pending rows should be capped: pending=%d dropped=%d", len(f.pending), f.dropped)
+	}
+}
+
+func TestNodeBenchmarkReportsDistribution(t *testing.T) {
+	var hits atomic.Int64
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 每 4 个请求失败一次
+		if hits.Add(1)%4 == 0 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		time.Sleep(2 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer up.Close()
+
+	srv, err := NewBuilder().WithUpstream(up.URL).Build()
+	if err != nil {
+		t.Fatalf("build proxy: %v", err)
+	}
+	node, err := srv.TestAddNode(srv.defaultAccount.ID, "bench", up.URL, "sk-bench", "", 2)
+	if err != nil {
+		t.Fatalf("add node: %v", err)
+	}
+	sess := srv.sessionMgr.Create(srv.defaultAccount.ID, false)
+	req := httptest.NewRequest(http.MethodPost, "/api/nodes/"+node.ID+"/benchmark", strings.NewReader(`{"concurrency":2,"duration_sec":1,"prompt_chars":64}`))
+	req.AddCookie(&http.Cookie{Name: "session_token", Value: sess.Token})
+	rec := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("benchmark status %d: %s", rec.Code, rec.Body.String())
+	}
+	var out struct {
+		RequestsTotal int64            `json:"requests_total"`
+		RequestsFail  int64            `json:"requests_fail"`
+		Errors        map[string]int64 `json:"errors"`
+		LatencyMs     map[string]int64 `json:"latency_ms"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if out.RequestsTotal < 4 || out.RequestsFail == 0 || out.Errors[ErrorClassServerError] != out.RequestsFail {
+		t.Fatalf("unexpected benchmark result: %s", rec.Body.String())
+	}
+	if out.LatencyMs["p50"] > out.LatencyMs["p99"] || out.LatencyMs["min"] > out.LatencyMs["max"] {
+		t.Fatalf("latency distribution not ordered: %v", out.LatencyMs)
+	}
+
+	bad := httptest.NewRequest(http.MethodPost, "/api/nodes/"+node.ID+"/benchmark", strings.NewReader(`{"concurrency":1000}`))
+	bad.AddCookie(&http.Cookie{Name: "session_token", Value: sess.Token})
+	rec = httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, bad)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for excessive concurrency, got %d", rec.Code)
+	}
+}
+
+func TestBenchmarkRegressionThreshold(t *testing.T) {
+	cases := []struct {
+		cmp  benchmarkComparison
+		want bool
+	}{
+		{benchmarkComparison{CurrentP95Ms: 140, CurrentRuns: 3, PreviousP95Ms: 100, PreviousRuns: 7}, true},
+		{benchmarkComparison{CurrentP95Ms: 125, CurrentRuns: 3, PreviousP95Ms: 100, PreviousRuns: 7}, false},
+		{benchmarkComparison{CurrentP95Ms: 500, CurrentRuns: 3}, false}, // 无上周数据不告警
+	}
+	for i, c := range cases {
+		if got := c.cmp.regressed(0.3); got != c.want {
+			t.Fatalf("case %d: regressed=%v want %v", i, got, c.want)
+		}
+	}
+	for path, want := range map[string]bool{
+		"/api/nodes/n1/benchmark":          true,
+		"/api/nodes/n1/benchmark/trend":    true,
+		"/api/nodes/n1/benchmark/schedule": true,
+		"/api/nodes//benchmark":            false,
+		"/api/nodes/a/b/benchmark":         false,
+	} {
+		if got := isNodeBenchmarkPath(path); got != want {
+			t.Fatalf("isNodeBenchmarkPath(%q)=%v want %v", path, got, want)
+		}
+	}
+}
+
+func TestWarmupDivertsTrafficAfterRecovery(t *testing.T) {
+	srv, err := NewBuilder().WithUpstream("http://127.0.0.1:1").Build()
+	if err != nil {
+		t.Fatalf("build proxy: %v", err)
+	}
+	backup, err := srv.addNode("backup", "http://127.0.0.1:2", "", 5)
+	if err != nil {
+		t.Fatalf("add backup: %v", err)
+	}
+	srv.settingsCache = &SettingsCache{data: map[string]any{
+		"routing.warmup.window_sec":  float64(100),
+		"routing.warmup.initial_pct": float64(10),
+	}}
+	now := time.Now()
+	srv.mu.Lock()
+	primary := srv.nodeIndex["default"]
+	setNodeState(primary, NodeStateDown, now.Add(-time.Minute))
+	setNodeState(primary, NodeStateHealthy, now)
+	srv.mu.Unlock()
+	if primary.WarmupSince.IsZero() {
+		t.Fatalf("down -> healthy should start warm-up")
+	}
+
+	if got := warmupShare(now, now.Add(50*time.Second), 100*time.Second, 0.1); got < 0.54 || got > 0.56 {
+		t.Fatalf("expected ~55%% share halfway through window, got %v", got)
+	}
+	if got := warmupShare(now, now.Add(200*time.Second), 100*time.Second, 0.1); got != 1 {
+		t.Fatalf("expected full share after window, got %v", got)
+	}
+
+	orig := warmupRand
+	defer func() { warmupRand = orig }()
+	warmupRand = func() float64 { return 0.99 }
+	if n := srv.applyWarmup(srv.defaultAccount, primary); n.ID != backup.ID {
+		t.Fatalf("expected request diverted to backup during warm-up, got %s", n.ID)
+	}
+	warmupRand = func() float64 { return 0.0 }
+	if n := srv.applyWarmup(srv.defaultAccount, primary); n.ID != primary.ID {
+		t.Fatalf("expected request kept on warming node, got %s", n.ID)
+	}
+}
+
+func TestUpstreamErrorTaxonomy(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	_, dialErr := net.Dial("tcp", addr)
+
+	cases := []struct {
+		status int
+		err    error
+		want   string
+	}{
+		{http.StatusOK, nil, ""},
+		{http.StatusUnauthorized, nil, ErrorClassAuth},
+		{http.StatusForbidden, nil, ErrorClassAuth},
+		{http.StatusTooManyRequests, nil, ErrorClassThrottled},
+		{http.StatusGatewayTimeout, nil, ErrorClassTimeout},
+		{529, nil, ErrorClassServerError},
+		{http.StatusBadRequest, nil, ErrorClassClientError},
+		{0, context.DeadlineExceeded, ErrorClassTimeout},
+		{0, context.Canceled, ErrorClassCanceled},
+		{0, &net.DNSError{Err: "no such host", Name: "x.invalid"}, ErrorClassDNS},
+		{0, dialErr, ErrorClassConnRefused},
+	}
+	for i, c := range cases {
+		if got := classifyUpstreamError(c.status, c.err); got != c.want {
+			t.Fatalf("case %d: got %q want %q (err=%v)", i, got, c.want, c.err)
+		}
+	}
+
+	// 重试耗尽时客户端看到 502，分类以上游真实状态为准。
+	if got := classifyRequest(http.StatusBadGateway, &usage{upstreamStatus: http.StatusTooManyRequests}); got != ErrorClassThrottled {
+		t.Fatalf("expected throttled from upstream status, got %q", got)
+	}
+
+	read := func(chunks ...string) *usage {
+		u := &usage{}
+		r := &usageReader{ReadCloser: io.NopCloser(&chunkReader{chunks: chunks}), tracker: u, buf: &bytes.Buffer{}, sse: true}
+		_, _ = io.Copy(io.Discard, r)
+		r.Close()
+		return u
+	}
+	if u := read("event: content_block_delta\ndata: {}\n\nevent: message_st", "op\ndata: {}\n\n"); u.streamBroken {
+		t.Fatalf("complete stream with split terminator should not be broken")
+	}
+	if u := read("event: content_block_delta\ndata: {}\n\n"); !u.streamBroken {
+		t.Fatalf("stream without terminator should be broken")
+	}
+	if got := classifyRequest(http.StatusOK, read("event: error\ndata: {}\n\nevent: message_stop\n\n")); got != ErrorClassStream {
+		t.Fatalf("expected malformed_stream, got %q", got)
+	}
+}
+
+// chunkReader 按给定分块返回数据，用于模拟流式读取。
+type chunkReader struct {
+	chunks []string
+}
+
+func (c *chunkReader) Read(p []byte) (int, error) {
+	if len(c.chunks) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, c.chunks[0])
+	c.chunks[0] = c.chunks[0][n:]
+	if c.chunks[0] == "" {
+		c.chunks = c.chunks[1:]
+	}
+	return n, nil
+}
+
+func TestHedgedRequestUsesFasterNode(t *testing.T) {
+	primaryCanceled := make(chan struct{}, 1)
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("fast") == "1" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		// 读完请求体后服务端才能感知连接断开。
+		_, _ = io.ReadAll(r.Body)
+		select {
+		case <-time.After(2 * time.Second):
+			w.WriteHeader(http.StatusOK)
+		case <-r.Context().Done():
+			primaryCanceled <- struct{}{}
+		}
+	}))
+	defer slow.Close()
+	var backupHits atomic.Int64
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		backupHits.Add(1)
+		if r.Header.Get("x-api-key") != "sk-backup" {
+			t.Errorf("backup got wrong key %q", r.Header.Get("x-api-key"))
+		}
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(body)
+	}))
+	defer fast.Close()
+
+	srv, err := NewBuilder().WithUpstream(slow.URL).WithRetry(1).Build()
+	if err != nil {
+		t.Fatalf("build proxy: %v", err)
+	}
+	if _, err := srv.TestAddNode(srv.defaultAccount.ID, "backup", fast.URL, "sk-backup", "", 5); err != nil {
+		t.Fatalf("add backup: %v", err)
+	}
+	srv.settingsCache = &SettingsCache{data: map[string]any{
+		"routing.hedge.enabled":      true,
+		"routing.hedge.threshold_ms": float64(50),
+		"routing.hedge.budget_pct":   float64(100),
+	}}
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(`{"model":"m","messages":[]}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || rec.Header().Get("X-Proxy-Node") != "backup" || rec.Header().Get("X-QCC-Hedged") != "true" {
+		t.Fatalf("expected hedge to backup, got %d node=%q hedged=%q", rec.Code, rec.Header().Get("X-Proxy-Node"), rec.Header().Get("X-QCC-Hedged"))
+	}
+	if !strings.Contains(rec.Body.String(), `"model":"m"`) {
+		t.Fatalf("backup should receive the original body, got %q", rec.Body.String())
+	}
+	select {
+	case <-primaryCanceled:
+	case <-time.After(time.Second):
+		t.Fatalf("losing primary request was not cancelled")
+	}
+
+	// 主节点及时响应时不触发对冲。
+	req = httptest.NewRequest(http.MethodGet, "/v1/models?fast=1", nil)
+	rec = httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, req)
+	if rec.Header().Get("X-QCC-Hedged") != "" || backupHits.Load() != 1 {
+		t.Fatalf("fast primary should not be hedged (backup hits %d)", backupHits.Load())
+	}
+}
+
+func TestHedgeSecondaryRequestCarriesSecondaryNode(t *testing.T) {
+	primaryURL, _ := url.Parse("https://primary.example")
+	backupURL, _ := url.Parse("https://backup.example/api")
+	primary := &Node{ID: "p", Name: "primary", URL: primaryURL}
+	h := &hedgeTransport{secondary: &Node{ID: "b", Name: "backup", URL: backupURL}, inPath: "/v1/messages", inHeader: http.Header{}}
+
+	req := httptest.NewRequest(http.MethodPost, "https://primary.example/v1/messages", nil)
+	req = req.WithContext(context.WithValue(req.Context(), nodeContextKey{}, primary))
+	out := h.secondaryRequest(req, []byte(`{}`), req.Context())
+	if n := nodeFromCtx(out); n == nil || n.ID != "b" {
+		t.Fatalf("secondary request context node = %+v, want backup", n)
+	}
+	if out.URL.String() != "https://backup.example/api/v1/messages" {
+		t.Fatalf("secondary url = %s", out.URL)
+	}
+	if n := nodeFromCtx(req); n != primary {
+		t.Fatalf("primary request context must keep the primary node")
+	}
+}
+
+func TestConversationAffinityPinsNode(t *testing.T) {
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(conversationHeader) != "" {
+			t.Errorf("conversation header must not reach upstream")
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer up.Close()
+
+	srv, err := NewBuilder().WithUpstream(up.URL).Build()
+	if err != nil {
+		t.Fatalf("build proxy: %v", err)
+	}
+	backup, err := srv.addNode("backup", up.URL, "", 5)
+	if err != nil {
+		t.Fatalf("add backup: %v", err)
+	}
+	send := func(conv string) string {
+		req := httptest.NewRequest(http.MethodGet, "/v1/models", nil)
+		if conv != "" {
+			req.Header.Set(conversationHeader, conv)
+		}
+		rec := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(rec, req)
+		return rec.Header().Get("X-Proxy-Node")
+	}
+
+	if got := send("c1"); got != "default" {
+		t.Fatalf("first turn should use active node, got %s", got)
+	}
+	// 会话已绑定到 default；将其改绑到 backup 模拟先前由 backup 服务。
+	_, ttl, max := srv.affinitySettings()
+	srv.affinity.set(srv.defaultAccount.ID, "c1", backup.ID, time.Now(), ttl, max)
+	if got := send("c1"); got != "backup" {
+		t.Fatalf("conversation should stick to backup, got %s", got)
+	}
+	if got := send("c2"); got != "default" {
+		t.Fatalf("other conversation should use active node, got %s", got)
+	}
+
+	sess := srv.sessionMgr.Create(srv.defaultAccount.ID, false)
+	req := httptest.NewRequest(http.MethodGet, "/api/routing/affinity", nil)
+	req.AddCookie(&http.Cookie{Name: "session_token", Value: sess.Token})
+	rec := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, req)
+	var st affinityStats
+	if err := json.Unmarshal(rec.Body.Bytes(), &st); err != nil || st.Entries != 2 || st.Hits != 1 {
+		t.Fatalf("unexpected stats %d %s", rec.Code, rec.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodDelete, "/api/routing/affinity", nil)
+	req.AddCookie(&http.Cookie{Name: "session_token", Value: sess.Token})
+	rec = httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"removed":2`) {
+		t.Fatalf("flush failed: %d %s", rec.Code, rec.Body.String())
+	}
+	if got := send("c1"); got != "default" {
+		t.Fatalf("after flush conversation should re-route to active node, got %s", got)
+	}
+
+	c := newAffinityCache()
+	now := time.Now()
+	c.set("a", "x", "n1", now, time.Minute, 2)
+	c.set("a", "y", "n1", now, time.Minute, 2)
+	c.get("a", "x", now)
+	c.set("a", "z", "n1", now, time.Minute, 2)
+	if _, ok := c.get("a", "y", now); ok {
+		t.Fatalf("least recently used entry should be evicted")
+	}
+	if _, ok := c.get("a", "x", now.Add(2*time.Minute)); ok {
+		t.Fatalf("expired entry should not be returned")
+	}
+}
+
+func TestAdminImpersonationIsReadOnlyByDefault(t *testing.T) {
+	srv, err := NewBuilder().WithUpstream("http://127.0.0.1:1").Build()
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	var adminAcc *Account
+	srv.mu.RLock()
+	for _, acc := range srv.accountByID {
+		if acc.IsAdmin {
+			adminAcc = acc
+		}
+	}
+	srv.mu.RUnlock()
+	if adminAcc == nil {
+		t.Fatalf("admin account missing")
+	}
+	tenant := srv.defaultAccount
+	sess := srv.sessionMgr.Create(adminAcc.ID, true)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: sess.Token})
+		rec := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := do(http.MethodPost, "/admin/api/impersonate", `{"account_id":"`+tenant.ID+`"}`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("impersonate without reason status %d", rec.Code)
+	}
+	if rec := do(http.MethodPost, "/admin/api/impersonate", `{"account_id":"`+tenant.ID+`","reason":"ticket-42"}`); rec.Code != http.StatusOK {
+		t.Fatalf("impersonate status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec := do(http.MethodGet, "/admin/api/config", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("get config status %d", rec.Code)
+	}
+	if got := rec.Header().Get(impersonatingHeader); got != tenant.ID {
+		t.Fatalf("expected impersonation banner for %s, got %q", tenant.ID, got)
+	}
+	if got := rec.Header().Get(impersonationModeHeader); got != "read-only" {
+		t.Fatalf("expected read-only mode, got %q", got)
+	}
+	if rec := do(http.MethodGet, "/admin/api/config?account_id="+adminAcc.ID, ""); rec.Code != http.StatusForbidden {
+		t.Fatalf("impersonated view should not keep admin rights, status %d", rec.Code)
+	}
+	if rec := do(http.MethodPut, "/admin/api/config", `{"retries":4}`); rec.Code != http.StatusForbidden {
+		t.Fatalf("write during read-only impersonation status %d", rec.Code)
+	}
+
+	if rec := do(http.MethodDelete, "/admin/api/impersonate", ""); rec.Code != http.StatusOK {
+		t.Fatalf("stop impersonation status %d", rec.Code)
+	}
+	rec = do(http.MethodGet, "/admin/api/config?account_id="+adminAcc.ID, "")
+	if rec.Code != http.StatusOK || rec.Header().Get(impersonatingHeader) != "" {
+		t.Fatalf("admin view not restored: status %d banner %q", rec.Code, rec.Header().Get(impersonatingHeader))
+	}
+}
+
+func TestShareExpireOptionsAndStatus(t *testing.T) {
+	now := time.Now().UTC()
+	exp, err := parseShareExpire("30d")
+	if err != nil || exp.Sub(now) < 29*24*time.Hour {
+		t.Fatalf("expected 30d expiry, got %v (%v)", exp, err)
+	}
+	if exp, err := parseShareExpire("permanent"); err != nil || !exp.IsZero() {
+		t.Fatalf("permanent share should not expire, got %v (%v)", exp, err)
+	}
+	for _, bad := range []string{"", "400d", "-1h", "soon"} {
+		if _, err := parseShareExpire(bad); err == nil {
+			t.Fatalf("expire_in %q should be rejected", bad)
+		}
+	}
+
+	rec := store.MonitorShareRecord{ID: "share-1", Token: "tok", ExpireAt: now.Add(-time.Minute)}
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/api/shares", nil)
+	view := monitorShareView(req, rec, now)
+	if view["status"] != store.MonitorShareExpired {
+		t.Fatalf("expected expired status, got %v", view["status"])
+	}
+	if view["share_url"] != "http://example.com/monitor/share/tok" {
+		t.Fatalf("unexpected share url %v", view["share_url"])
+	}
+	rec.Revoked = true
+	if got := rec.Status(now); got != store.MonitorShareRevoked {
+		t.Fatalf("expected revoked status, got %s", got)
+	}
+
+	srv, err := NewBuilder().WithUpstream("http://127.0.0.1:1").Build()
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	sess := srv.sessionMgr.Create(srv.defaultAccount.ID, false)
+	r := httptest.NewRequest(http.MethodPost, "/api/shares/share-1/regenerate", nil)
+	r.AddCookie(&http.Cookie{Name: "session_token", Value: sess.Token})
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, r)
+	if w.Code != http.StatusInternalServerError || !strings.Contains(w.Body.String(), "STORE_DISABLED") {
+		t.Fatalf("expected shares API to be routed, got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestStatusPageSummarizesNodesAndUptime(t *testing.T) {
+	srv, err := NewBuilder().WithUpstream("http://127.0.0.1:1").Build()
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	acc := srv.defaultAccount
+	down, err := srv.TestAddNode(acc.ID, "backup", "http://127.0.0.1:2", "", "", 2)
+	if err != nil {
+		t.Fatalf("add node: %v", err)
+	}
+	hidden, err := srv.TestAddNode(acc.ID, "internal", "http://127.0.0.1:3", "", "", 3)
+	if err != nil {
+		t.Fatalf("add node: %v", err)
+	}
+	now := time.Now()
+	srv.mu.Lock()
+	setNodeState(down, NodeStateDown, now)
+	setNodeState(hidden, NodeStateDisabled, now)
+	srv.mu.Unlock()
+
+	today := now.UTC().Truncate(24 * time.Hour)
+	uptime := map[string][]store.UptimeDay{
+		down.ID: {
+			{NodeID: down.ID, Day: today.AddDate(0, 0, -1), ChecksTotal: 100, ChecksOK: 100},
+			{NodeID: down.ID, Day: today, ChecksTotal: 100, ChecksOK: 50},
+			{NodeID: down.ID, Day: today.AddDate(0, 0, -200), ChecksTotal: 10, ChecksOK: 0},
+		},
+	}
+	view := srv.buildStatusPage(acc, "Acme API", uptime, nil, now)
+	if view.Title != "Acme API" || view.Status != statusOutage {
+		t.Fatalf("unexpected page header %q %q", view.Title, view.Status)
+	}
+	if len(view.Nodes) != 2 {
+		t.Fatalf("disabled node should be hidden, got %d nodes", len(view.Nodes))
+	}
+	var backup statusNode
+	for _, n := range view.Nodes {
+		if n.Name == "backup" {
+			backup = n
+		}
+	}
+	if len(backup.Days) != statusPageDays || backup.Uptime90 == nil || *backup.Uptime90 != 75 {
+		t.Fatalf("unexpected uptime for backup: %+v", backup.Uptime90)
+	}
+	if last := backup.Days[statusPageDays-1]; last.Uptime == nil || *last.Uptime != 50 {
+		t.Fatalf("today's bar should be 50%%, got %+v", last.Uptime)
+	}
+	if len(view.Incidents) != 1 || !view.Incidents[0].Automatic {
+		t.Fatalf("expected one automatic incident, got %+v", view.Incidents)
+	}
+
+	var html bytes.Buffer
+	if err := statusPageTemplate.Execute(&html, view); err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	if !strings.Contains(html.String(), "Acme API") || strings.Contains(html.String(), "127.0.0.1") {
+		t.Fatalf("status page should show title without node urls")
+	}
+
+	rec := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status/acme", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("status page without store should 404, got %d", rec.Code)
+	}
+}
+
+func TestManualIncidentsAppearOnStatusPage(t *testing.T) {
+	srv, err := NewBuilder().WithUpstream("http://127.0.0.1:1").Build()
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	acc := srv.defaultAccount
+	node, err := srv.TestAddNode(acc.ID, "primary-eu", "http://127.0.0.1:2", "", "", 1)
+	if err != nil {
+		t.Fatalf("add node: %v", err)
+	}
+	srv.mu.Lock()
+	setNodeState(node, NodeStateDown, time.Now())
+	srv.mu.Unlock()
+
+	rec := store.IncidentRecord{AccountID: acc.ID, Status: store.IncidentInvestigating}
+	title, status := "EU outage", store.IncidentResolved
+	unknown := []string{"missing-node"}
+	if err := (incidentRequest{Title: &title, AffectedNodes: &unknown}).apply(srv, acc, &rec); err == nil {
+		t.Fatalf("unknown affected node should be rejected")
+	}
+	affected := []string{node.ID}
+	if err := (incidentRequest{Title: &title, AffectedNodes: &affected}).apply(srv, acc, &rec); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	rec.Updates = []store.IncidentUpdateRecord{{Status: rec.Status, Body: "Upstream **timeouts** <script>", CreatedAt: time.Now()}}
+	rec.Postmortem = "## Root cause\nexpired certificate"
+
+	view := srv.buildStatusPage(acc, "", nil, []store.IncidentRecord{rec}, time.Now())
+	if len(view.Incidents) != 1 || view.Incidents[0].Automatic {
+		t.Fatalf("manual incident should replace automatic one, got %+v", view.Incidents)
+	}
+	if got := view.Incidents[0].Nodes; len(got) != 1 || got[0] != "primary-eu" {
+		t.Fatalf("affected nodes should be shown by name, got %v", got)
+	}
+	var html bytes.Buffer
+	if err := statusPageTemplate.Execute(&html, view); err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	out := html.String()
+	if !strings.Contains(out, "expired certificate") || strings.Contains(out, "<script>") {
+		t.Fatalf("postmortem should render escaped markdown")
+	}
+
+	if err := (incidentRequest{Status: &status}).apply(srv, acc, &rec); err != nil || rec.ResolvedAt.IsZero() {
+		t.Fatalf("resolving should stamp resolved_at: %v", err)
+	}
+}
+
+// fakeNotifyStore 为通知管理器提供固定订阅并记录发送历史。
+type fakeNotifyStore struct {
+	subs    []store.SubscriptionWithChannel
+	history chan store.NotificationHistoryRecord
+}
+
+func (f *fakeNotifyStore) ListEnabledSubscriptionsForEvent(ctx context.Context, accountID, eventType string) ([]store.SubscriptionWithChannel, error) {
+	return f.subs, nil
+}
+
+func (f *fakeNotifyStore) InsertNotificationHistory(ctx context.Context, rec store.NotificationHistoryRecord) error {
+	f.history <- rec
+	return nil
+}
+
+func TestNotificationDigestGroupsByNodeAndSeverity(t *testing.T) {
+	var bodies []string
+	var mu sync.Mutex
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		bodies = append(bodies, string(b))
+		mu.Unlock()
+		_, _ = w.Write([]byte(`{"errcode":0}`))
+	}))
+	defer hook.Close()
+
+	ch := store.NotificationChannelRecord{
+		ID:          "chn-digest",
+		ChannelType: notify.ChannelWechatWork,
+		Config:      json.RawMessage(`{"webhook_url":"` + hook.URL + `"}`),
+		Enabled:     true,
+		DigestMode:  store.Digest15Min,
+	}
+	fs := &fakeNotifyStore{
+		subs:    []store.SubscriptionWithChannel{{Channel: ch}},
+		history: make(chan store.NotificationHistoryRecord, 16),
+	}
+	mgr := notify.NewManager(fs, notify.WithWorkerCount(1))
+	for i := 0; i < 6; i++ {
+		mgr.Publish(notify.Event{AccountID: "acc", EventType: notify.EventNodeFailed, Title: "节点故障告警", Node: "node-a", DedupKey: "a"})
+		mgr.Publish(notify.Event{AccountID: "acc", EventType: notify.EventNodeRecovered, Title: "节点已恢复", Node: "node-a", DedupKey: "a"})
+	}
+	mgr.Publish(notify.Event{AccountID: "acc", EventType: notify.EventNodeFailed, Title: "节点故障告警", Node: "node-b"})
+	mgr.Stop()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(bodies) != 1 {
+		t.Fatalf("expected a single digest message, got %d", len(bodies))
+	}
+	var payload struct {
+		Markdown struct {
+			Content string `json:"content"`
+		} `json:"markdown"`
+	}
+	if err := json.Unmarshal([]byte(bodies[0]), &payload); err != nil {
+		t.Fatalf("decode webhook body: %v", err)
+	}
+	content := payload.Markdown.Content
+	for _, want := range []string{"13 条告警", "**node-a** · critical · 6 条", "**node-a** · info · 6 条", "**node-b** · critical · 1 条"} {
+		if !strings.Contains(content, want) {
+			t.Fatalf("digest missing %q:\n%s", want, content)
+		}
+	}
+	if strings.Index(content, "node-b** · critical") > strings.Index(content, "node-a** · info") {
+		t.Fatalf("critical groups should be listed before info groups:\n%s", content)
+	}
+	if rec := <-fs.history; rec.EventType != notify.EventDigest || rec.Status != "sent" {
+		t.Fatalf("unexpected history record %+v", rec)
+	}
+}
+
+// fakeEscalationStore 在内存中保存升级策略与告警；ListDueAlerts 以 now+skew 判断到期，便于模拟时间推进。
+type fakeEscalationStore struct {
+	fakeNotifyStore
+	mu       sync.Mutex
+	channels map[string]store.NotificationChannelRecord
+	policy   store.EscalationPolicyRecord
+	alerts   []store.AlertRecord
+	skew     time.Duration
+}
+
+func (f *fakeEscalationStore) ListEnabledEscalationPoliciesForEvent(ctx context.Context, accountID, eventType string) ([]store.EscalationPolicyRecord, error) {
+	return []store.EscalationPolicyRecord{f.policy}, nil
+}
+
+func (f *fakeEscalationStore) GetEscalationPolicy(ctx context.Context, id string) (*store.EscalationPolicyRecord, error) {
+	p := f.policy
+	return &p, nil
+}
+
+func (f *fakeEscalationStore) GetNotificationChannel(ctx context.Context, id string) (*store.NotificationChannelRecord, error) {
+	ch, ok := f.channels[id]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	return &ch, nil
+}
+
+func (f *fakeEscalationStore) FindOpenAlert(ctx context.Context, accountID, policyID, dedupKey string) (*store.AlertRecord, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, a := range f.alerts {
+		if a.PolicyID == policyID && a.DedupKey == dedupKey && a.Status == store.AlertOpen {
+			return &a, nil
+		}
+	}
+	return nil, store.ErrNotFound
+}
+
+func (f *fakeEscalationStore) InsertAlert(ctx context.Context, rec store.AlertRecord) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.alerts = append(f.alerts, rec)
+	return nil
+}
+
+func (f *fakeEscalationStore) ListDueAlerts(ctx context.Context, now time.Time) ([]store.AlertRecord, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var due []store.AlertRecord
+	for _, a := range f.alerts {
+		if a.Status == store.AlertOpen && !a.NextEscalationAt.IsZero() && !a.NextEscalationAt.After(now.Add(f.skew)) {
+			due = append(due, a)
+		}
+	}
+	return due, nil
+}
+
+func (f *fakeEscalationStore) AdvanceAlertEscalation(ctx context.Context, id string, step int, next time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i := range f.alerts {
+		if f.alerts[i].ID == id && f.alerts[i].Status == store.AlertOpen {
+			f.alerts[i].Step, f.alerts[i].NextEscalationAt = step, next
+		}
+	}
+	return nil
+}
+
+func (f *fakeEscalationStore) setSkew(d time.Duration) {
+	f.mu.Lock()
+	f.skew = d
+	f.mu.Unlock()
+}
+
+func TestAlertEscalationStopsAfterAcknowledge(t *testing.T) {
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"errcode":0}`))
+	}))
+	defer hook.Close()
+
+	channels := map[string]store.NotificationChannelRecord{}
+	for _, id := range []string{"chn-a", "chn-b", "chn-c"} {
+		channels[id] = store.NotificationChannelRecord{
+			ID: id, ChannelType: notify.ChannelWechatWork, Enabled: true,
+			Config: json.RawMessage(`{"webhook_url":"` + hook.URL + `"}`),
+		}
+	}
+	fs := &fakeEscalationStore{
+		fakeNotifyStore: fakeNotifyStore{history: make(chan store.NotificationHistoryRecord, 16)},
+		channels:        channels,
+		policy: store.EscalationPolicyRecord{ID: "esc-1", Name: "oncall", Enabled: true, Steps: []store.EscalationStep{
+			{ChannelID: "chn-a"}, {ChannelID: "chn-b", AfterMinutes: 1}, {ChannelID: "chn-c", AfterMinutes: 5},
+		}},
+	}
+	hooked := make(chan store.AlertRecord, 16)
+	mgr := notify.NewManager(fs, notify.WithWorkerCount(1), notify.WithEscalationTick(10*time.Millisecond),
+		notify.WithAlertHook(func(rec store.AlertRecord) { hooked <- rec }))
+	defer mgr.Stop()
+
+	waitHistory := func() store.NotificationHistoryRecord {
+		select {
+		case rec := <-fs.history:
+			return rec
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timed out waiting for notification")
+			return store.NotificationHistoryRecord{}
+		}
+	}
+
+	evt := notify.Event{AccountID: "acc", EventType: notify.EventNodeFailed, Title: "节点故障告警", Node: "node-a", DedupKey: "n1"}
+	mgr.Publish(evt)
+	if rec := waitHistory(); rec.ChannelID != "chn-a" || rec.Title != "节点故障告警" {
+		t.Fatalf("first step should notify chn-a, got %+v", rec)
+	}
+	if rec := <-hooked; rec.Step != 0 || rec.Status != store.AlertOpen || rec.Severity != notify.SeverityCritical {
+		t.Fatalf("unexpected hooked alert %+v", rec)
+	}
+
+	// 同一去重键的重复事件不应创建新告警
+	mgr.Publish(evt)
+	fs.setSkew(90 * time.Second)
+	if rec := waitHistory(); rec.ChannelID != "chn-b" || !strings.HasPrefix(rec.Title, "[升级 L2]") {
+		t.Fatalf("second step should notify chn-b after delay, got %+v", rec)
+	}
+	if rec := <-hooked; rec.Step != 1 || rec.NextEscalationAt.IsZero() {
+		t.Fatalf("escalated alert should schedule the next step, got %+v", rec)
+	}
+
+	fs.mu.Lock()
+	if len(fs.alerts) != 1 {
+		fs.mu.Unlock()
+		t.Fatalf("expected a single open alert, got %d", len(fs.alerts))
+	}
+	fs.alerts[0].Status = store.AlertAcknowledged
+	fs.alerts[0].NextEscalationAt = time.Time{}
+	fs.mu.Unlock()
+	fs.setSkew(time.Hour)
+
+	select {
+	case rec := <-fs.history:
+		t.Fatalf("acknowledged alert must not escalate further, got %+v", rec)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// fakeOnCallStore 按事件类型返回订阅，并提供渠道密钥。
+type fakeOnCallStore struct {
+	subs    map[string][]store.SubscriptionWithChannel
+	secrets map[string]string
+	history chan store.NotificationHistoryRecord
+}
+
+func (f *fakeOnCallStore) ListEnabledSubscriptionsForEvent(ctx context.Context, accountID, eventType string) ([]store.SubscriptionWithChannel, error) {
+	return f.subs[eventType], nil
+}
+
+func (f *fakeOnCallStore) InsertNotificationHistory(ctx context.Context, rec store.NotificationHistoryRecord) error {
+	f.history <- rec
+	return nil
+}
+
+func (f *fakeOnCallStore) GetChannelSecret(ctx context.Context, accountID, channelID string) (string, error) {
+	return f.secrets[channelID], nil
+}
+
+func TestOnCallChannelsTriggerAndAutoResolve(t *testing.T) {
+	type call struct {
+		path string
+		auth string
+		body map[string]interface{}
+	}
+	calls := make(chan call, 8)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		calls <- call{path: r.URL.RequestURI(), auth: r.Header.Get("Authorization"), body: body}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer upstream.Close()
+
+	cfg, secret, err := validateChannelConfig(notify.ChannelPagerDuty, json.RawMessage(`{"routing_key":"rk-1","api_url":"`+upstream.URL+`/pd"}`))
+	if err != nil || secret != "rk-1" || strings.Contains(string(cfg), "rk-1") {
+		t.Fatalf("routing_key should be split from stored config: cfg=%s secret=%q err=%v", cfg, secret, err)
+	}
+	pd := store.NotificationChannelRecord{ID: "chn-pd", ChannelType: notify.ChannelPagerDuty, Enabled: true, Config: cfg, DigestMode: store.DigestHourly}
+	og := store.NotificationChannelRecord{ID: "chn-og", ChannelType: notify.ChannelOpsgenie, Enabled: true,
+		Config: json.RawMessage(`{"api_url":"` + upstream.URL + `/og"}`)}
+	fs := &fakeOnCallStore{
+		subs:    map[string][]store.SubscriptionWithChannel{notify.EventNodeFailed: {{Channel: pd}, {Channel: og}}},
+		secrets: map[string]string{"chn-pd": "rk-1", "chn-og": "genie-1"},
+		history: make(chan store.NotificationHistoryRecord, 8),
+	}
+	mgr := notify.NewManager(fs, notify.WithWorkerCount(1))
+	mgr.Publish(notify.Event{AccountID: "acc", EventType: notify.EventNodeFailed, Title: "节点故障告警", Node: "node-a"})
+	mgr.Publish(notify.Event{AccountID: "acc", EventType: notify.EventNodeRecovered, Title: "节点已恢复", Node: "node-a"})
+	mgr.Stop()
+	close(calls)
+
+	wantKey := "qcc:acc:node-a:node_down"
+	var got []call
+	for c := range calls {
+		got = append(got, c)
+	}
+	if len(got) != 4 {
+		t.Fatalf("expected trigger+resolve on both channels, got %d calls: %+v", len(got), got)
+	}
+	for _, c := range got {
+		switch {
+		case c.path == "/pd":
+			if c.body["routing_key"] != "rk-1" || c.body["dedup_key"] != wantKey {
+				t.Fatalf("unexpected pagerduty body %+v", c.body)
+			}
+		case c.path == "/og/v2/alerts":
+			if c.auth != "GenieKey genie-1" || c.body["alias"] != wantKey || c.body["priority"] != "P1" {
+				t.Fatalf("unexpected opsgenie create %+v auth=%q", c.body, c.auth)
+			}
+		case c.path == "/og/v2/alerts/"+url.PathEscape(wantKey)+"/close?identifierType=alias":
+		default:
+			t.Fatalf("unexpected call %s", c.path)
+		}
+	}
+	if got[0].body["event_action"] != "trigger" || got[2].body["event_action"] != "resolve" {
+		t.Fatalf("pagerduty should trigger then resolve, got %v / %v", got[0].body["event_action"], got[2].body["event_action"])
+	}
+}
+
+func TestRequestLogSamplingSettings(t *testing.T) {
+	srv := &Server{}
+	if cfg := srv.requestLogSamplingSettings(); !cfg.shouldLogRequest(store.RequestLogRecord{Status: 200}) {
+		t.Fatalf("without settings every request should be logged")
+	}
+	srv.settingsCache = &SettingsCache{data: map[string]any{
+		"request_log.sample.success_pct": float64(10),
+		"request_log.sample.slow_ms":     float64(5000),
+	}}
+	orig := logSampleRand
+	defer func() { logSampleRand = orig }()
+	logSampleRand = func() float64 { return 0.5 }
+
+	cfg := srv.requestLogSamplingSettings()
+	cases := []struct {
+		rec  store.RequestLogRecord
+		want bool
+	}{
+		{store.RequestLogRecord{Status: 200, DurationMs: 100}, false},
+		{store.RequestLogRecord{Status: 502, DurationMs: 100}, true},
+		{store.RequestLogRecord{Status: 200, DurationMs: 100, ErrorClass: "timeout"}, true},
+		{store.RequestLogRecord{Status: 200, DurationMs: 6000}, true},
+	}
+	for _, c := range cases {
+		if got := cfg.shouldLogRequest(c.rec); got != c.want {
+			t.Fatalf("shouldLogRequest(%+v) = %v, want %v", c.rec, got, c.want)
+		}
+	}
+	logSampleRand = func() float64 { return 0.05 }
+	if !cfg.shouldLogRequest(store.RequestLogRecord{Status: 200}) {
+		t.Fatalf("expected success request within the 10%% sample to be logged")
+	}
+
+	// 热更新：SettingsCache 变更后立即生效
+	srv.settingsCache.UpdateLocal("request_log.sample.error_pct", float64(0), 2)
+	if srv.requestLogSamplingSettings().shouldLogRequest(store.RequestLogRecord{Status: 500}) {
+		t.Fatalf("error_pct=0 should drop failed requests")
+	}
+}
+
+func TestRequestLogSinkBoundedQueue(t *testing.T) {
+	st, err := store.Open("sqlite:" + filepath.Join(t.TempDir(), "qcc.db"))
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	defer st.Close()
+	srv := &Server{store: st}
+	for i := 0; i < 5; i++ {
+		srv.logRequest(store.RequestLogRecord{AccountID: "acc1", NodeID: "n1", Method: http.MethodPost, Path: "/v1/messages", Status: 200})
+	}
+	// 关闭时写完队列中剩余的记录。
+	srv.requestLogs.close()
+	logs, err := st.ListRequestLogs(context.Background(), store.RequestLogQuery{AccountID: "acc1"})
+	if err != nil || len(logs) != 5 || srv.requestLogs.written.Load() != 5 {
+		t.Fatalf("logs=%d written=%d err=%v", len(logs), srv.requestLogs.written.Load(), err)
+	}
+
+	// 队列已满时丢弃新记录而不是再起协程。
+	full := &Server{store: st}
+	full.requestLogs.queue = make(chan store.RequestLogRecord, 1)
+	full.requestLogs.stop = make(chan struct{})
+	full.logRequest(store.RequestLogRecord{AccountID: "acc1", Status: 200})
+	full.logRequest(store.RequestLogRecord{AccountID: "acc1", Status: 200})
+	if full.requestLogs.dropped.Load() != 1 || len(full.requestLogs.queue) != 1 {
+		t.Fatalf("dropped=%d queued=%d", full.requestLogs.dropped.Load(), len(full.requestLogs.queue))
+	}
+}
+
+func TestRequestTimingsBreakdown(t *testing.T) {
+	received := time.Now()
+	start := received.Add(30 * time.Millisecond)
+	mw := &metricsWriter{firstWrite: true, firstAt: start.Add(400 * time.Millisecond), lastAt: start.Add(2400 * time.Millisecond)}
+	queue, ttft, stream := requestTimings(received, start, mw)
+	if queue != 30 || ttft != 400 || stream != 2000 {
+		t.Fatalf("unexpected breakdown queue=%d ttft=%d stream=%d", queue, ttft, stream)
+	}
+	if _, ttft, stream := requestTimings(received, start, &metricsWriter{}); ttft != 0 || stream != 0 {
+		t.Fatalf("no response body should report zero ttft/stream, got %d/%d", ttft, stream)
+	}
+}
+
+func TestRequestLogTailFiltersSubscribers(t *testing.T) {
+	srv, err := NewBuilder().WithUpstream("http://127.0.0.1:1").Build()
+	if err != nil {
+		t.Fatalf("build proxy: %v", err)
+	}
+	owner := &WSClient{hub: srv.wsHub, accountID: srv.defaultAccount.ID, send: make(chan []byte, 8)}
+	admin := &WSClient{hub: srv.wsHub, accountID: "ops", isAdmin: true, send: make(chan []byte, 8)}
+	other := &WSClient{hub: srv.wsHub, accountID: "other", send: make(chan []byte, 8)}
+	share := &WSClient{hub: srv.wsHub, accountID: srv.defaultAccount.ID, isShare: true, send: make(chan []byte, 8)}
+	for _, c := range []*WSClient{owner, admin, other, share} {
+		srv.wsHub.addClient(c)
+	}
+	expectReply := func(c *WSClient, want string) {
+		t.Helper()
+		var msg WSMessage
+		if err := json.Unmarshal(<-c.send, &msg); err != nil || msg.Type != want {
+			t.Fatalf("expected %s reply, got %+v (%v)", want, msg, err)
+		}
+	}
+	owner.handleCommand([]byte(`{"action":"subscribe","topic":"request_log","filter":"node=primary status>=500"}`))
+	expectReply(owner, "subscribed")
+	admin.handleCommand([]byte(`{"action":"subscribe","topic":"request_log","scope":"all"}`))
+	expectReply(admin, "subscribed")
+	other.handleCommand([]byte(`{"action":"subscribe","topic":"request_log","scope":"all"}`))
+	expectReply(other, "error")
+	share.handleCommand([]byte(`{"action":"subscribe","topic":"request_log"}`))
+	expectReply(share, "error")
+	owner.handleCommand([]byte(`{"action":"subscribe","topic":"request_log","filter":"status~5"}`))
+	expectReply(owner, "error")
+	if _, err := parseTailFilter("bogus=1"); err == nil {
+		t.Fatalf("unknown field should be rejected")
+	}
+
+	go srv.wsHub.Run()
+	acc := srv.defaultAccount.ID
+	srv.publishRequestLog(store.RequestLogRecord{AccountID: acc, NodeName: "primary", Status: 200, CreatedAt: time.Now()})
+	srv.publishRequestLog(store.RequestLogRecord{AccountID: acc, NodeName: "primary", Status: 502, CreatedAt: time.Now()})
+
+	var ev struct {
+		Type    string          `json:"type"`
+		Payload requestLogEvent `json:"payload"`
+	}
+	select {
+	case data := <-owner.send:
+		if err := json.Unmarshal(data, &ev); err != nil || ev.Type != wsTopicRequestLog || ev.Payload.Status != 502 {
+			t.Fatalf("owner should only receive the 502, got %s", data)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("timed out waiting for tail event")
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case <-admin.send:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("admin with scope all should receive every event")
+		}
+	}
+	select {
+	case data := <-other.send:
+		t.Fatalf("unsubscribed account must not receive events, got %s", data)
+	case data := <-owner.send:
+		t.Fatalf("owner filter should drop status 200, got %s", data)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	admin.handleCommand([]byte(`{"action":"unsubscribe","topic":"request_log"}`))
+	expectReply(admin, "unsubscribed")
+	if srv.wsHub.tailCount.Load() != 1 {
+		t.Fatalf("expected one remaining subscriber, got %d", srv.wsHub.tailCount.Load())
+	}
+}
+
+func TestStorageLimitTightenFactor(t *testing.T) {
+	usage := store.AccountStorage{AccountID: "acc", Rows: 2000, Bytes: 10 << 20}
+	if f := (StorageLimit{}).tightenFactor(usage); f != 0 {
+		t.Fatalf("no limit should not tighten, got %v", f)
+	}
+	if f := (StorageLimit{MaxRows: 5000, MaxMB: 20}).tightenFactor(usage); f != 0 {
+		t.Fatalf("usage within limit should not tighten, got %v", f)
+	}
+	// 行数超限一倍，按 0.5 收紧并预留余量
+	if f := (StorageLimit{MaxRows: 1000}).tightenFactor(usage); math.Abs(f-0.5*storageTightenHeadroom) > 1e-9 {
+		t.Fatalf("unexpected row factor %v", f)
+	}
+	// 取行数与字节两项中更严格的一项
+	limit := StorageLimit{MaxRows: 1000, MaxMB: 2}
+	if f := limit.tightenFactor(usage); math.Abs(f-0.2*storageTightenHeadroom) > 1e-9 {
+		t.Fatalf("unexpected combined factor %v", f)
+	}
+	if !limit.exceeded(usage) || (StorageLimit{MaxMB: 20}).exceeded(usage) {
+		t.Fatalf("exceeded flag mismatch")
+	}
+}
+
+func TestRetentionPlanAccountOverrides(t *testing.T) {
+	plan := retentionPlan{
+		system:    withRetentionDays(store.DefaultRetentionPolicy(), map[string]int{"request_logs": 14}),
+		overrides: map[string]map[string]int{"acc": {"raw_metrics": 3, "audit_logs": 90}},
+	}
+	day := 24 * time.Hour
+	if got := plan.policyFor("other"); got.RequestLogs != 14*day || got.RawMetrics != 7*day || got.AuditLogs != 0 {
+		t.Fatalf("account without override should use system policy, got %+v", got)
+	}
+	got := plan.policyFor("acc")
+	if got.RawMetrics != 3*day || got.AuditLogs != 90*day || got.RequestLogs != 14*day || got.DailyMetrics != 365*day {
+		t.Fatalf("override should only replace configured fields, got %+v", got)
+	}
+	if days := retentionDays(got); days["raw_metrics"] != 3 || days["health_checks"] != 30 || len(days) != len(retentionFields) {
+		t.Fatalf("unexpected days view %v", days)
+	}
+	if err := validateRetentionDays(map[string]int{"raw_metrics": -1}); err == nil {
+		t.Fatalf("negative retention should be rejected")
+	}
+	if err := validateRetentionDays(map[string]int{"traces": 7}); err == nil {
+		t.Fatalf("unknown data type should be rejected")
+	}
+}
+
+func TestSchedulerStatusReportsCleanupCounts(t *testing.T) {
+	if got := formatTableCounts(map[string]int64{"request_logs": 8, "node_metrics_raw": 120, "audit_logs": 0}); got != "node_metrics_raw=120 request_logs=8" {
+		t.Fatalf("unexpected counts format %q", got)
+	}
+	if got := formatTableCounts(nil); got != "nothing" {
+		t.Fatalf("unexpected empty format %q", got)
+	}
+
+	m := NewMetricsScheduler(nil, nil)
+	if st := m.status(); st["last_cleanup"] != nil {
+		t.Fatalf("expected no cleanup before first run, got %v", st["last_cleanup"])
+	}
+	m.lastCleanup = &cleanupReport{
+		schedulerRun: schedulerRun{StartedAt: time.Now(), Duration: 1500 * time.Millisecond},
+		DryRun:       true,
+		Deleted:      map[string]int64{"node_metrics_raw": 120, "request_logs": 8},
+	}
+	view, ok := m.status()["last_cleanup"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("expected cleanup view")
+	}
+	if view["dry_run"] != true || view["deleted_total"] != int64(128) || view["duration_ms"] != int64(1500) {
+		t.Fatalf("unexpected cleanup view %v", view)
+	}
+}
+
+func TestDBPoolConfigFromSettings(t *testing.T) {
+	srv, err := NewBuilder().WithUpstream("http://127.0.0.1:1").Build()
+	if err != nil {
+		t.Fatalf("build proxy: %v", err)
+	}
+	if got := srv.dbPoolConfig(); got != store.DefaultPoolConfig() {
+		t.Fatalf("expected defaults without settings, got %+v", got)
+	}
+	srv.settingsCache = &SettingsCache{data: map[string]any{
+		"db.max_open_conns":        float64(100),
+		"db.max_idle_conns":        float64(-1),
+		"db.conn_max_lifetime_sec": float64(0),
+	}}
+	got := srv.dbPoolConfig()
+	if got.MaxOpenConns != 100 || got.MaxIdleConns != store.DefaultPoolConfig().MaxIdleConns || got.ConnMaxLifetime != 0 {
+		t.Fatalf("unexpected pool config %+v", got)
+	}
+	srv.settingsCache.UpdateLocal("db.max_idle_conns", float64(40), 2)
+	if got := srv.dbPoolConfig(); got.MaxIdleConns != 40 {
+		t.Fatalf("expected hot-reloaded idle conns, got %+v", got)
+	}
+}
+
+func TestDBTimeoutsFromSettings(t *testing.T) {
+	srv, err := NewBuilder().WithUpstream("http://127.0.0.1:1").Build()
+	if err != nil {
+		t.Fatalf("build proxy: %v", err)
+	}
+	srv.settingsCache = &SettingsCache{data: map[string]any{
+		"db.timeout.read_ms":      float64(800),
+		"db.timeout.aggregate_ms": float64(300000),
+		"db.timeout.cleanup_ms":   float64(0),
+	}}
+	st := &store.Store{}
+	st.SetTimeouts(srv.dbTimeouts())
+	got := st.Timeouts()
+	def := store.DefaultTimeouts()
+	if got.Read != 800*time.Millisecond || got.Aggregate != 5*time.Minute {
+		t.Fatalf("configured timeouts not applied: %+v", got)
+	}
+	if got.Write != def.Write || got.Cleanup != def.Cleanup {
+		t.Fatalf("unset or zero timeouts should fall back to defaults: %+v", got)
+	}
+}
+
+func TestCreateNodeRunsInitialHealthCheck(t *testing.T) {
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer up.Close()
+
+	srv, err := NewBuilder().WithUpstream(up.URL).Build()
+	if err != nil {
+		t.Fatalf("build proxy: %v", err)
+	}
+	sess := srv.sessionMgr.Create(srv.defaultAccount.ID, false)
+
+	body := `{"name":"fresh","base_url":"` + up.URL + `","api_key":"k1","health_check_method":"head"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/nodes", strings.NewReader(body))
+	req.AddCookie(&http.Cookie{Name: "session_token", Value: sess.Token})
+	rec := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create node status %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp struct {
+		Node        map[string]interface{} `json:"node"`
+		HealthCheck map[string]interface{} `json:"health_check"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if resp.Node["name"] != "fresh" || resp.Node["state"] != NodeStateHealthy {
+		t.Fatalf("expected healthy node view, got %v", resp.Node)
+	}
+	if resp.Node["last_health_check_at"] == "" || resp.HealthCheck["success"] != true || resp.HealthCheck["check_method"] != HealthCheckMethodHEAD {
+		t.Fatalf("expected completed initial health check, got node=%v check=%v", resp.Node, resp.HealthCheck)
+	}
+
+	bad := httptest.NewRequest(http.MethodPost, "/api/nodes", strings.NewReader(`{"name":"x"}`))
+	bad.AddCookie(&http.Cookie{Name: "session_token", Value: sess.Token})
+	rec = httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, bad)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 without base_url, got %d", rec.Code)
+	}
+}
+
+func TestCreateNodeSeedsMetricsAndReportsPartialRollback(t *testing.T) {
+	var closeStore atomic.Bool
+	var st *store.Store
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 健康检查进行中存储变得不可用：首条历史写入失败，回滚删除同样失败
+		if closeStore.Load() {
+			st.Close()
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer up.Close()
+
+	srv, err := NewBuilder().WithUpstream(up.URL).WithStoreDSN("sqlite:" + filepath.Join(t.TempDir(), "qcc.db")).Build()
+	if err != nil {
+		t.Fatalf("build proxy: %v", err)
+	}
+	st = srv.store
+	acc, err := srv.createAccount("tenant", "tenant-key", "", false)
+	if err != nil {
+		t.Fatalf("create account: %v", err)
+	}
+	sess := srv.sessionMgr.Create(acc.ID, false)
+	create := func(name string) *httptest.ResponseRecorder {
+		body := `{"name":"` + name + `","base_url":"` + up.URL + `/` + name + `","health_check_method":"head"}`
+		req := httptest.NewRequest(http.MethodPost, "/api/nodes", strings.NewReader(body))
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: sess.Token})
+		rec := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := create("seeded")
+	var created struct {
+		Node map[string]interface{} `json:"node"`
+	}
+	_ = json.Unmarshal(rec.Body.Bytes(), &created)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create node status %d: %s", rec.Code, rec.Body.String())
+	}
+	nodeID, _ := created.Node["id"].(string)
+	rows, err := st.QueryMetrics(context.Background(), store.MetricsQuery{AccountID: acc.ID, NodeID: nodeID,
+		From: time.Now().Add(-time.Hour), To: time.Now().Add(time.Hour), Granularity: store.MetricsGranularityRaw})
+	if err != nil || len(rows) != 1 || rows[0].RequestsTotal != 0 {
+		t.Fatalf("expected one seeded metrics row, got %+v %v", rows, err)
+	}
+
+	closeStore.Store(true)
+	rec = create("broken")
+	var failed map[string]interface{}
+	_ = json.Unmarshal(rec.Body.Bytes(), &failed)
+	if rec.Code != http.StatusInternalServerError || failed["partial"] != true || failed["node_id"] == nil || failed["rollback_error"] == nil {
+		t.Fatalf("failed rollback should be reported as partial: %d %s", rec.Code, rec.Body.String())
+	}
+	if srv.getNode(failed["node_id"].(string)) != nil {
+		t.Fatalf("node should be removed from memory even when the store delete fails")
+	}
+}
+
+func TestNodeCreateDetectsDuplicates(t *testing.T) {
+	srv, err := NewBuilder().WithUpstream("http://dup.local").Build()
+	if err != nil {
+		t.Fatalf("build proxy: %v", err)
+	}
+	sess := srv.sessionMgr.Create(srv.defaultAccount.ID, false)
+	post := func(path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: sess.Token})
+		rec := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := post("/admin/api/nodes", `{"name":"a","base_url":"http://a.local/v1","api_key":"k","weight":2}`); rec.Code != http.StatusCreated {
+		t.Fatalf("create node status %d: %s", rec.Code, rec.Body.String())
+	}
+	rec := post("/admin/api/nodes", `{"name":"b","base_url":"HTTP://A.local/v1/","api_key":"k"}`)
+	if rec.Code != http.StatusConflict || !strings.Contains(rec.Body.String(), `"code":"duplicate_node"`) {
+		t.Fatalf("expected duplicate conflict, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := post("/admin/api/nodes", `{"name":"b","base_url":"http://a.local/v1","api_key":"other"}`); rec.Code != http.StatusCreated {
+		t.Fatalf("different api key should not conflict, got %d", rec.Code)
+	}
+	if rec := post("/admin/api/nodes", `{"name":"b","base_url":"http://a.local/v1","api_key":"k","on_duplicate":"skip"}`); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"status":"skipped"`) {
+		t.Fatalf("expected skipped, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := post("/admin/api/nodes", `{"name":"renamed","base_url":"http://a.local/v1","api_key":"k","on_duplicate":"update"}`); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"status":"updated"`) {
+		t.Fatalf("expected updated, got %d: %s", rec.Code, rec.Body.String())
+	}
+	existing := srv.findDuplicateNode(srv.defaultAccount, "http://a.local/v1", "k")
+	if existing == nil || existing.Name != "renamed" || existing.Weight != 2 {
+		t.Fatalf("update should rename and keep weight, got %+v", existing)
+	}
+
+	rec = post("/api/nodes/import", `{"on_duplicate":"skip","nodes":[
+		{"name":"a","base_url":"http://a.local/v1","api_key":"k"},
+		{"name":"c","base_url":"http://c.local","api_key":"k"},
+		{"name":"c2","base_url":"http://c.local","api_key":"k","on_duplicate":""},
+		{"name":"bad","base_url":""}]}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("import status %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp struct {
+		Summary map[string]int `json:"summary"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode import: %v", err)
+	}
+	if resp.Summary["created"] != 1 || resp.Summary["skipped"] != 2 || resp.Summary["error"] != 1 {
+		t.Fatalf("unexpected import summary: %v", resp.Summary)
+	}
+}
+
+func TestNodeTemplateAppliesToNewNodes(t *testing.T) {
+	var gotTeam atomic.Value
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotTeam.Store(r.Header.Get("X-Team"))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer up.Close()
+
+	srv, err := NewBuilder().WithUpstream("http://tmpl.local").Build()
+	if err != nil {
+		t.Fatalf("build proxy: %v", err)
+	}
+	sess := srv.sessionMgr.Create(srv.defaultAccount.ID, false)
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: sess.Token})
+		rec := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := do(http.MethodPut, "/api/nodes/template", `{"headers":{"Authorization":"x"}}`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("reserved header should be rejected, got %d", rec.Code)
+	}
+	rec := do(http.MethodPut, "/api/nodes/template", `{"weight":4,"health_check_method":"HEAD","health_interval_sec":30,"headers":{"x-team":"infra"}}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("put template status %d: %s", rec.Code, rec.Body.String())
+	}
+	if tmpl := srv.nodeTemplate(srv.defaultAccount); tmpl.HealthCheckMethod != HealthCheckMethodHEAD || tmpl.Headers["X-Team"] != "infra" {
+		t.Fatalf("template not normalized: %+v", tmpl)
+	}
+
+	rec = do(http.MethodPost, "/api/nodes", `{"name":"t1","base_url":"`+up.URL+`"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create node status %d: %s", rec.Code, rec.Body.String())
+	}
+	if v, _ := gotTeam.Load().(string); v != "infra" {
+		t.Fatalf("template header not sent on health check, got %q", v)
+	}
+	node := srv.findDuplicateNode(srv.defaultAccount, up.URL, "")
+	if node == nil || node.Weight != 4 || node.HealthCheckMethod != HealthCheckMethodHEAD || node.HealthInterval != 30*time.Second {
+		t.Fatalf("template not applied: %+v", node)
+	}
+
+	rec = do(http.MethodPost, "/api/nodes/import", `{"nodes":[{"name":"t2","base_url":"http://t2.local","weight":1,"headers":{"X-Team":"ops"}}]}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("import status %d: %s", rec.Code, rec.Body.String())
+	}
+	imported := srv.findDuplicateNode(srv.defaultAccount, "http://t2.local", "")
+	if imported == nil || imported.Weight != 1 || imported.Headers["X-Team"] != "ops" || imported.HealthInterval != 30*time.Second {
+		t.Fatalf("explicit fields should override template: %+v", imported)
+	}
+
+	if rec := do(http.MethodDelete, "/api/nodes/template", ""); rec.Code != http.StatusOK {
+		t.Fatalf("reset template status %d", rec.Code)
+	}
+	if tmpl := srv.nodeTemplate(srv.defaultAccount); tmpl.Weight != 0 || len(tmpl.Headers) != 0 {
+		t.Fatalf("template should be cleared: %+v", tmpl)
+	}
+}
+
+func TestHealthRoundLimitsConcurrency(t *testing.T) {
+	var cur, peak atomic.Int64
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := cur.Add(1)
+		defer cur.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(30 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer up.Close()
+
+	srv, err := NewBuilder().WithUpstream(up.URL).Build()
+	if err != nil {
+		t.Fatalf("build proxy: %v", err)
+	}
+	srv.settingsCache = &SettingsCache{data: map[string]any{"health.max_concurrency": 2, "health.spread_pct": 0}}
+	targets := []healthTarget{{srv.defaultAccount, "default"}}
+	for i := 0; i < 5; i++ {
+		n, err := srv.addNodeWithMethod(srv.defaultAccount, "n"+strconv.Itoa(i), up.URL+"/"+strconv.Itoa(i), "", 1, HealthCheckMethodHEAD)
+		if err != nil {
+			t.Fatalf("add node: %v", err)
+		}
+		targets = append(targets, healthTarget{srv.defaultAccount, n.ID})
+	}
+
+	srv.runHealthRound("full", targets, time.Second, nil)
+	if got := peak.Load(); got > 2 {
+		t.Fatalf("expected at most 2 concurrent checks, got %d", got)
+	}
+	stats := srv.healthStats.view(srv.healthPoolConfig())
+	if stats["completed"] != int64(6) || stats["inflight"] != int64(0) || stats["peak_inflight"].(int64) > 2 {
+		t.Fatalf("unexpected pool stats: %v", stats)
+	}
+	if _, ok := stats["last_rounds"].(map[string]interface{})["full"]; !ok {
+		t.Fatalf("expected full round recorded: %v", stats)
+	}
+
+	for _, id := range []string{"a", "b", "n-123"} {
+		off := healthOffset(id, time.Minute, 0)
+		if off < 0 || off >= time.Minute || off != healthOffset(id, time.Minute, 0) {
+			t.Fatalf("offset for %s should be stable and within window, got %v", id, off)
+		}
+		if j := healthOffset(id, time.Minute, 5*time.Second); j < 0 || j >= time.Minute {
+			t.Fatalf("jittered offset out of window: %v", j)
+		}
+	}
+	if healthOffset("a", 0, time.Second) != 0 {
+		t.Fatalf("zero window should not delay checks")
+	}
+}
+
+func TestHealthCheckBackoff(t *testing.T) {
+	if got := healthBackoff(10*time.Second, 0, time.Minute); got != 10*time.Second {
+		t.Fatalf("no failures should keep base interval, got %v", got)
+	}
+	if got := healthBackoff(10*time.Second, 3, time.Minute); got != 40*time.Second {
+		t.Fatalf("expected 40s after 3 failures, got %v", got)
+	}
+	if got := healthBackoff(10*time.Second, 50, time.Minute); got != time.Minute {
+		t.Fatalf("backoff should be capped, got %v", got)
+	}
+	if got := healthBackoff(10*time.Second, 5, 0); got != 10*time.Second {
+		t.Fatalf("zero cap disables backoff, got %v", got)
+	}
+
+	var healthy atomic.Bool
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if healthy.Load() {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer up.Close()
+
+	srv, err := NewBuilder().WithUpstream("http://backoff.local").Build()
+	if err != nil {
+		t.Fatalf("build proxy: %v", err)
+	}
+	srv.settingsCache = &SettingsCache{data: map[string]any{"health.backoff_max_sec": 3600}}
+	node, err := srv.addNodeWithOptions(srv.defaultAccount, "flaky", up.URL, "", 5, HealthCheckMethodHEAD, nil, 10*time.Second)
+	if err != nil {
+		t.Fatalf("add node: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := srv.runHealthCheck(srv.defaultAccount, node.ID, false); err != nil {
+			t.Fatalf("health check: %v", err)
+		}
+	}
+	srv.mu.RLock()
+	streak := node.HealthFailStreak
+	interval := srv.nodeHealthInterval(srv.defaultAccount, node)
+	due := srv.healthDue(srv.defaultAccount, node, time.Now().Add(30*time.Second), 0)
+	srv.mu.RUnlock()
+	if streak != 3 || interval != 40*time.Second || due {
+		t.Fatalf("expected 3 failures backing off to 40s, got streak=%d interval=%v due=%v", streak, interval, due)
+	}
+
+	healthy.Store(true)
+	if _, err := srv.runHealthCheck(srv.defaultAccount, node.ID, false); err != nil {
+		t.Fatalf("health check: %v", err)
+	}
+	view := srv.nodeView(srv.defaultAccount, node.ID)
+	if view["health_fail_streak"] != 0 || view["health_effective_ms"] != int64(10000) {
+		t.Fatalf("success should reset cadence, got %v", view)
+	}
+}
+
+func TestNodeStatusSharesProbe(t *testing.T) {
+	var hits atomic.Int64
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		time.Sleep(100 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer up.Close()
+
+	srv, err := NewBuilder().WithUpstream("http://status.local").Build()
+	if err != nil {
+		t.Fatalf("build proxy: %v", err)
+	}
+	node, err := srv.addNodeWithMethod(srv.defaultAccount, "probe", up.URL, "", 5, HealthCheckMethodHEAD)
+	if err != nil {
+		t.Fatalf("add node: %v", err)
+	}
+	sess := srv.sessionMgr.Create(srv.defaultAccount.ID, false)
+	get := func(id, query string) (int, string) {
+		req := httptest.NewRequest(http.MethodGet, "/api/nodes/"+id+"/status"+query, nil)
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: sess.Token})
+		rec := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(rec, req)
+		var resp struct {
+			Source string `json:"source"`
+		}
+		_ = json.Unmarshal(rec.Body.Bytes(), &resp)
+		return rec.Code, resp.Source
+	}
+
+	var wg sync.WaitGroup
+	sources := make([]string, 8)
+	for i := range sources {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			code, src := get(node.ID, "")
+			if code != http.StatusOK {
+				t.Errorf("status code %d", code)
+			}
+			sources[i] = src
+		}(i)
+	}
+	wg.Wait()
+	if hits.Load() != 1 {
+		t.Fatalf("concurrent status requests should share one probe, got %d", hits.Load())
+	}
+	probes := 0
+	for _, s := range sources {
+		if s == probeSourceProbe {
+			probes++
+		}
+	}
+	if probes != 1 {
+		t.Fatalf("expected exactly one probing request, got sources %v", sources)
+	}
+
+	if _, src := get(node.ID, ""); src != probeSourceCache || hits.Load() != 1 {
+		t.Fatalf("expected cached result, got source=%s hits=%d", src, hits.Load())
+	}
+	if _, src := get(node.ID, "?refresh=1"); src != probeSourceProbe || hits.Load() != 2 {
+		t.Fatalf("refresh should probe again, got source=%s hits=%d", src, hits.Load())
+	}
+	if code, _ := get("missing", ""); code != http.StatusNotFound {
+		t.Fatalf("unknown node should 404, got %d", code)
+	}
+}
+
+func TestWebSocketConnectionLimits(t *testing.T) {
+	srv, err := NewBuilder().WithUpstream("http://ws.local").Build()
+	if err != nil {
+		t.Fatalf("build proxy: %v", err)
+	}
+	srv.settingsCache = &SettingsCache{data: map[string]any{"ws.max_conns_per_account": 2}}
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	sess := srv.sessionMgr.Create(srv.defaultAccount.ID, false)
+	header := http.Header{}
+	header.Set("Cookie", "session_token="+sess.Token)
+	wsURL := "ws" + strings.TrimPrefix(ts.URL, "http") + "/api/monitor/ws"
+	dial := func() (*websocket.Conn, *http.Response, error) {
+		return websocket.DefaultDialer.Dial(wsURL, header)
+	}
+
+	var conns []*websocket.Conn
+	for i := 0; i < 2; i++ {
+		c, _, err := dial()
+		if err != nil {
+			t.Fatalf("dial %d: %v", i, err)
+		}
+		conns = append(conns, c)
+	}
+	_, resp, err := dial()
+	if err == nil || resp == nil || resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 over limit, got resp=%v err=%v", resp, err)
+	}
+
+	conns[0].Close()
+	deadline := time.Now().Add(2 * time.Second)
+	for srv.wsHub.statsView(srv.wsLimits())["connections"] != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("closed connection should release its slot: %v", srv.wsHub.statsView(srv.wsLimits()))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	c, _, err := dial()
+	if err != nil {
+		t.Fatalf("dial after release: %v", err)
+	}
+	defer c.Close()
+	defer conns[1].Close()
+
+	stats := srv.wsHub.statsView(srv.wsLimits())
+	if stats["rejected"] != int64(1) || stats["connects"] != int64(3) || stats["disconnects"] != int64(1) {
+		t.Fatalf("unexpected websocket stats: %v", stats)
+	}
+}
+
+func TestWSHubCoalescesNodeMetrics(t *testing.T) {
+	hub := NewWSHub()
+	client := &WSClient{hub: hub, accountID: "acc", send: make(chan []byte, wsQueueSize+10)}
+	hub.addClient(client)
+
+	metrics := func(node string, seq int) map[string]interface{} {
+		return map[string]interface{}{"node_id": node, "seq": seq}
+	}
+	// 标记分发协程运行中，使消息停留在队列里
+	d := hub.dispatcher("acc")
+	d.running = true
+	for i := 1; i <= 5; i++ {
+		hub.Broadcast("acc", "node_metrics", metrics("n1", i))
+	}
+	hub.Broadcast("acc", "node_metrics", metrics("n2", 1))
+	hub.Broadcast("acc", "node_metrics", metrics("n1", 6))
+	hub.Broadcast("acc", "node_status", map[string]interface{}{"node_id": "n1"})
+	hub.Broadcast("acc", "node_status", map[string]interface{}{"node_id": "n1"})
+	if got := len(d.queue); got != 5 {
+		t.Fatalf("queue length = %d, want 5", got)
+	}
+	if got := hub.counters.coalesced.Load(); got != 4 {
+		t.Fatalf("coalesced = %d, want 4", got)
+	}
+
+	hub.drain(d)
+	var got []WSMessage
+	for len(client.send) > 0 {
+		var msg WSMessage
+		if err := json.Unmarshal(<-client.send, &msg); err != nil {
+			t.Fatalf("unmarshal: %v", err)
+		}
+		got = append(got, msg)
+	}
+	if len(got) != 5 {
+		t.Fatalf("delivered %d messages, want 5", len(got))
+	}
+	first := got[0].Payload.(map[string]interface{})
+	if first["node_id"] != "n1" || first["seq"] != float64(5) {
+		t.Fatalf("first message should carry latest n1 metrics, got %v", first)
+	}
+	if d.running {
+		t.Fatalf("dispatcher should stop once drained")
+	}
+
+	// 队列有界：超出容量时丢弃最早的消息
+	d.running = true
+	for i := 0; i < wsQueueSize+3; i++ {
+		hub.Broadcast("acc", "node_status", map[string]interface{}{"seq": i})
+	}
+	if len(d.queue) != wsQueueSize || hub.counters.queueDropped.Load() != 3 {
+		t.Fatalf("queue len=%d dropped=%d", len(d.queue), hub.counters.queueDropped.Load())
+	}
+	if first := d.queue[0].Payload.(map[string]interface{}); first["seq"] != 3 {
+		t.Fatalf("oldest messages should be dropped, head=%v", first)
+	}
+
+	// 未被占用的账号队列由独立协程投递，不依赖 Run
+	other := &WSClient{hub: hub, accountID: "other", send: make(chan []byte, 1)}
+	hub.addClient(other)
+	hub.Broadcast("other", "node_status", map[string]interface{}{})
+	select {
+	case <-other.send:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("message for other account not delivered")
+	}
+}
+
+func TestWebSocketClientCommands(t *testing.T) {
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer up.Close()
+
+	srv, err := NewBuilder().WithUpstream("http://commands.local").Build()
+	if err != nil {
+		t.Fatalf("build proxy: %v", err)
+	}
+	node, err := srv.addNodeWithMethod(srv.defaultAccount, "cmd", up.URL, "", 5, HealthCheckMethodHEAD)
+	if err != nil {
+		t.Fatalf("add node: %v", err)
+	}
+	acc := srv.defaultAccount.ID
+	client := &WSClient{hub: srv.wsHub, server: srv, accountID: acc, send: make(chan []byte, 64)}
+	srv.wsHub.addClient(client)
+
+	// 等待指定类型的消息，跳过其间的其他广播
+	await := func(want string) WSMessage {
+		t.Helper()
+		deadline := time.After(2 * time.Second)
+		for {
+			select {
+			case data := <-client.send:
+				var msg WSMessage
+				if err := json.Unmarshal(data, &msg); err != nil {
+					t.Fatalf("decode: %v", err)
+				}
+				if msg.Type == want {
+					return msg
+				}
+				if msg.Type == "error" {
+					t.Fatalf("expected %s, got error %v", want, msg.Payload)
+				}
+			case <-deadline:
+				t.Fatalf("timed out waiting for %s", want)
+			}
+		}
+	}
+
+	client.handleCommand([]byte(`{"action":"unsubscribe","topic":"node_metrics"}`))
+	await("unsubscribed")
+	client.handleCommand([]byte(`{"action":"subscribe","topic":"bogus"}`))
+	await("error")
+
+	srv.wsHub.Broadcast(acc, "node_metrics", map[string]interface{}{"node_id": node.ID})
+	srv.wsHub.Broadcast(acc, "node_status", map[string]interface{}{"node_id": node.ID})
+	status := await("node_status")
+	if status.Seq != 2 {
+		t.Fatalf("expected seq 2 for second broadcast, got %d", status.Seq)
+	}
+	if len(client.send) != 0 {
+		t.Fatalf("muted node_metrics should not be delivered")
+	}
+
+	client.handleCommand([]byte(`{"action":"heartbeat","seq":1}`))
+	hb := await("heartbeat").Payload.(map[string]interface{})
+	if hb["seq"] != float64(2) || hb["missed"] != float64(1) {
+		t.Fatalf("unexpected heartbeat reply: %v", hb)
+	}
+
+	client.handleCommand([]byte(`{"action":"refresh","node_id":"` + node.ID + `"}`))
+	refresh := await("node_refresh").Payload.(map[string]interface{})
+	if refresh["node_id"] != node.ID || refresh["source"] != probeSourceProbe {
+		t.Fatalf("unexpected refresh reply: %v", refresh)
+	}
+	client.handleCommand([]byte(`{"action":"refresh","node_id":"missing"}`))
+	await("error")
+
+	// 无存储时告警确认不可用
+	client.handleCommand([]byte(`{"action":"ack","alert_id":"a1"}`))
+	await("error")
+	client.handleCommand([]byte(`{"action":"nope"}`))
+	await("error")
+}
+
+func TestWebSocketSendsInitialState(t *testing.T) {
+	srv, err := NewBuilder().WithUpstream("http://snapshot.local").Build()
+	if err != nil {
+		t.Fatalf("build proxy: %v", err)
+	}
+	srv.wsHub.Broadcast(srv.defaultAccount.ID, "node_status", map[string]interface{}{})
+	for deadline := time.Now().Add(2 * time.Second); srv.wsHub.dispatcher(srv.defaultAccount.ID).seq.Load() == 0; {
+		if time.Now().After(deadline) {
+			t.Fatalf("broadcast not dispatched")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	sess := srv.sessionMgr.Create(srv.defaultAccount.ID, false)
+	header := http.Header{}
+	header.Set("Cookie", "session_token="+sess.Token)
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http")+"/api/monitor/ws", header)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var msg struct {
+		Type    string `json:"type"`
+		Payload struct {
+			AccountID string        `json:"account_id"`
+			Nodes     []MonitorNode `json:"nodes"`
+			Alerts    []interface{} `json:"alerts"`
+			Seq       uint64        `json:"seq"`
+		} `json:"payload"`
+	}
+	if err := conn.ReadJSON(&msg); err != nil {
+		t.Fatalf("read initial state: %v", err)
+	}
+	if msg.Type != "initial_state" || msg.Payload.AccountID != srv.defaultAccount.ID {
+		t.Fatalf("first message should be initial_state, got %+v", msg)
+	}
+	if len(msg.Payload.Nodes) != len(srv.defaultAccount.Nodes) || msg.Payload.Alerts == nil {
+		t.Fatalf("snapshot should list account nodes and alerts: %+v", msg.Payload)
+	}
+	if msg.Payload.Seq != 1 {
+		t.Fatalf("snapshot should carry current broadcast seq, got %d", msg.Payload.Seq)
+	}
+}
+
+func TestUIPreferencesPerUser(t *testing.T) {
+	srv, err := NewBuilder().WithUpstream("http://prefs.local").Build()
+	if err != nil {
+		t.Fatalf("build proxy: %v", err)
+	}
+	sess := srv.sessionMgr.Create(srv.defaultAccount.ID, false)
+	do := func(method, body string) (int, map[string]interface{}) {
+		req := httptest.NewRequest(method, "/api/ui/preferences", strings.NewReader(body))
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: sess.Token})
+		rec := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(rec, req)
+		var resp map[string]interface{}
+		_ = json.Unmarshal(rec.Body.Bytes(), &resp)
+		return rec.Code, resp
+	}
+
+	code, resp := do(http.MethodGet, "")
+	if code != http.StatusOK || resp["user_id"] != srv.defaultAccount.ID {
+		t.Fatalf("get empty preferences: %d %v", code, resp)
+	}
+	code, _ = do(http.MethodPut, `{"layout":{"cols":3},"time_ranges":{"dashboard":"24h"},"hidden_nodes":["n1","n1"," n2 "]}`)
+	if code != http.StatusOK {
+		t.Fatalf("put preferences: %d", code)
+	}
+	code, resp = do(http.MethodGet, "")
+	prefs := resp["preferences"].(map[string]interface{})
+	if code != http.StatusOK || prefs["layout"].(map[string]interface{})["cols"] != float64(3) {
+		t.Fatalf("layout not persisted: %v", resp)
+	}
+	if hidden := prefs["hidden_nodes"].([]interface{}); len(hidden) != 2 || hidden[1] != "n2" {
+		t.Fatalf("hidden nodes should be trimmed and deduplicated: %v", hidden)
+	}
+	if code, _ = do(http.MethodPut, `{"layout":"grid"}`); code != http.StatusBadRequest {
+		t.Fatalf("scalar layout should be rejected, got %d", code)
+	}
+	if code, _ = do(http.MethodPut, `{"layout":"`+strings.Repeat("x", maxUIPreferencesBytes)+`"}`); code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("oversized preferences should be rejected, got %d", code)
+	}
+	if code, _ = do(http.MethodDelete, ""); code != http.StatusMethodNotAllowed {
+		t.Fatalf("delete should not be allowed, got %d", code)
+	}
+}
+
+func TestLocalizedResponsesAndAccountDisplay(t *testing.T) {
+	srv, err := NewBuilder().WithUpstream("http://i18n.local").Build()
+	if err != nil {
+		t.Fatalf("build proxy: %v", err)
+	}
+	if got := i18n.Negotiate("fr-FR, en-GB;q=0.8, zh;q=0.5"); got != i18n.LocaleEN {
+		t.Fatalf("negotiate = %s, want en-US", got)
+	}
+	if got := i18n.Negotiate(""); got != i18n.DefaultLocale {
+		t.Fatalf("empty Accept-Language should use default locale, got %s", got)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/version", nil)
+	req.Header.Set("Accept-Language", "en-US,en;q=0.9")
+	rec := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, req)
+	var info version.Info
+	_ = json.Unmarshal(rec.Body.Bytes(), &info)
+	if rec.Header().Get("Content-Language") != i18n.LocaleEN || info.Locale != i18n.LocaleEN || info.BuildDateLocal != i18n.T(i18n.LocaleEN, "version.unknown") {
+		t.Fatalf("version should be localized: %s", rec.Body.String())
+	}
+	if info.BuildDateBeijing != version.GetFormattedBuildDate() {
+		t.Fatalf("build_date_beijing must stay unchanged: %+v", info)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/alerts", nil)
+	req.Header.Set("Accept-Language", "en")
+	rec = httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, req)
+	var errResp map[string]string
+	_ = json.Unmarshal(rec.Body.Bytes(), &errResp)
+	if rec.Code != http.StatusUnauthorized || errResp["error"] != "unauthorized" || errResp["message"] != "please log in first" {
+		t.Fatalf("unauthorized response should carry a localized message: %d %v", rec.Code, errResp)
+	}
+
+	sess := srv.sessionMgr.Create(srv.defaultAccount.ID, false)
+	put := func(body string) int {
+		req := httptest.NewRequest(http.MethodPut, "/admin/api/accounts/display", strings.NewReader(body))
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: sess.Token})
+		rec := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(rec, req)
+		return rec.Code
+	}
+	if code := put(`{"timezone":"Mars/Olympus"}`); code != http.StatusBadRequest {
+		t.Fatalf("invalid timezone should be rejected, got %d", code)
+	}
+	if code := put(`{"locale":"fr"}`); code != http.StatusBadRequest {
+		t.Fatalf("unsupported locale should be rejected, got %d", code)
+	}
+	if code := put(`{"timezone":"UTC","locale":"en"}`); code != http.StatusOK {
+		t.Fatalf("update display: %d", code)
+	}
+	if d := srv.accountDisplay(srv.defaultAccount); d.Locale != i18n.LocaleEN || d.Timezone != "UTC" {
+		t.Fatalf("display not applied: %+v", d)
+	}
+
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	req = httptest.NewRequest(http.MethodGet, "/api/request-logs", nil)
+	req.Header.Set("Accept-Language", "zh-CN")
+	rec = httptest.NewRecorder()
+	f := srv.displayFormat(rec, req, srv.defaultAccount)
+	if got := f.time(ts); got != "2024-01-02 03:04:05 UTC" {
+		t.Fatalf("account display should override Accept-Language, got %s", got)
+	}
+	f = srv.displayFormat(rec, req, nil)
+	if got := f.time(ts); got != timeutil.FormatBeijingTime(ts) {
+		t.Fatalf("default format should match Beijing time, got %s", got)
+	}
+}
+
+func TestUpdateCheckNotifiesAdmins(t *testing.T) {
+	var hits atomic.Int64
+	feed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		_, _ = w.Write([]byte(`{"tag_name":"v1.3.0","html_url":"https://example.com/releases/v1.3.0"}`))
+	}))
+	defer feed.Close()
+
+	prev := version.Version
+	version.Version = "1.2.9"
+	defer func() { version.Version = prev }()
+
+	for _, c := range []struct {
+		a, b string
+		want bool
+	}{
+		{"v1.3.0", "1.2.9", true}, {"1.2.9", "1.2.9", false}, {"1.2.10", "1.2.9", true},
+		{"1.3.0", "1.3.0-rc1", true}, {"1.3.0-rc1", "1.3.0", false}, {"1.3.0", "dev", false},
+	} {
+		if got := version.IsNewer(c.a, c.b); got != c.want {
+			t.Fatalf("IsNewer(%s, %s) = %v", c.a, c.b, got)
+		}
+	}
+
+	srv, err := NewBuilder().WithUpstream("http://update.local").Build()
+	if err != nil {
+		t.Fatalf("build proxy: %v", err)
+	}
+	srv.settingsCache = &SettingsCache{data: map[string]any{"update.feed_url": feed.URL}}
+	admin := &WSClient{hub: srv.wsHub, accountID: "ops", isAdmin: true, send: make(chan []byte, 8)}
+	user := &WSClient{hub: srv.wsHub, accountID: srv.defaultAccount.ID, send: make(chan []byte, 8)}
+	srv.wsHub.addClient(admin)
+	srv.wsHub.addClient(user)
+
+	if err := srv.updates.check(); err != nil {
+		t.Fatalf("check: %v", err)
+	}
+	if err := srv.updates.check(); err != nil {
+		t.Fatalf("second check: %v", err)
+	}
+	if len(admin.send) != 1 || len(user.send) != 0 {
+		t.Fatalf("expected exactly one update_available for admin only, admin=%d user=%d", len(admin.send), len(user.send))
+	}
+	var msg WSMessage
+	if err := json.Unmarshal(<-admin.send, &msg); err != nil || msg.Type != "update_available" {
+		t.Fatalf("unexpected admin message: %+v (%v)", msg, err)
+	}
+
+	sess := srv.sessionMgr.Create(srv.defaultAccount.ID, false)
+	get := func(query string) map[string]interface{} {
+		req := httptest.NewRequest(http.MethodGet, "/api/version"+query, nil)
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: sess.Token})
+		rec := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET /api/version%s: %d %s", query, rec.Code, rec.Body.String())
+		}
+		var resp map[string]interface{}
+		_ = json.Unmarshal(rec.Body.Bytes(), &resp)
+		return resp
+	}
+	resp := get("")
+	if resp["current"] != "1.2.9" || resp["latest"] != "v1.3.0" || resp["update_available"] != true ||
+		resp["changelog_url"] != "https://example.com/releases/v1.3.0" || resp["check_enabled"] != true {
+		t.Fatalf("unexpected version status: %v", resp)
+	}
+
+	// 关闭检查后不再访问发布源
+	srv.settingsCache = &SettingsCache{data: map[string]any{"update.feed_url": feed.URL, "update.check_enabled": false}}
+	before := hits.Load()
+	if resp := get("?refresh=1"); resp["check_enabled"] != false || hits.Load() != before {
+		t.Fatalf("opt-out should skip the feed: %v hits=%d", resp, hits.Load()-before)
+	}
+}
+
+func TestAPIVersionReportsFeatureMatrix(t *testing.T) {
+	srv, err := NewBuilder().WithUpstream("http://features.local").Build()
+	if err != nil {
+		t.Fatalf("build proxy: %v", err)
+	}
+	sess := srv.sessionMgr.Create(srv.defaultAccount.ID, false)
+	req := httptest.NewRequest(http.MethodGet, "/api/version", nil)
+	req.AddCookie(&http.Cookie{Name: "session_token", Value: sess.Token})
+	rec := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, req)
+	var resp struct {
+		Build version.Info `json:"build"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || resp.Build.Features == nil {
+		t.Fatalf("expected feature matrix: %d %s", rec.Code, rec.Body.String())
+	}
+	f := resp.Build.Features
+	if f.DBBackend != "none" || f.MetricsStore || f.MetricsScheduler || !f.WSHub || !f.UpdateCheck || f.Tunnel || resp.Build.Platform == "" {
+		t.Fatalf("unexpected feature matrix: %+v %+v", *f, resp.Build)
+	}
+
+	rec = httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/version", nil))
+	if strings.Contains(rec.Body.String(), "features") {
+		t.Fatalf("public /version must not expose the feature matrix: %s", rec.Body.String())
+	}
+}
+
+func TestBootstrapConfigPrecedenceAndMasking(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "qcc.yaml")
+	yaml := "listen_addr: \":9100\"\nmysql_dsn: \"qcc:s3cret@tcp(db:3306)/qcc\"\nupstream:\n  base_url: http://file.local\n  api_key: sk-file\nadmin:\n  api_key: file-admin\n"
+	if err := os.WriteFile(path, []byte(yaml), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	t.Setenv("LISTEN_ADDR", ":9200")
+	t.Setenv("UPSTREAM_BASE_URL", "")
+	t.Setenv("ANTHROPIC_BASE_URL", "")
+	t.Setenv("ADMIN_API_KEY", "")
+	t.Setenv("PROXY_MYSQL_DSN", "")
+	t.Setenv("DEFAULT_ACCOUNT_NAME", "")
+	boot, err := config.Load(path)
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	if boot.ListenAddr != ":9200" || boot.Sources["listen_addr"] != config.SourceEnv {
+		t.Fatalf("env should override file: %s %s", boot.ListenAddr, boot.Sources["listen_addr"])
+	}
+	if boot.Upstream.BaseURL != "http://file.local" || boot.Sources["upstream.base_url"] != config.SourceFile {
+		t.Fatalf("file should override default: %s", boot.Upstream.BaseURL)
+	}
+	if boot.Admin.DefaultAccount != "default" || boot.Sources["admin.default_account"] != config.SourceDefault {
+		t.Fatalf("default expected: %s", boot.Admin.DefaultAccount)
+	}
+	if _, err := config.Load(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Fatalf("explicit missing config should fail")
+	}
+
+	srv, err := NewBuilder().WithUpstream("http://config.local").WithBootstrap(boot).Build()
+	if err != nil {
+		t.Fatalf("build proxy: %v", err)
+	}
+	get := func(admin bool) *httptest.ResponseRecorder {
+		sess := srv.sessionMgr.Create(srv.defaultAccount.ID, admin)
+		req := httptest.NewRequest(http.MethodGet, "/api/admin/config", nil)
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: sess.Token})
+		rec := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+	if rec := get(false); rec.Code != http.StatusForbidden {
+		t.Fatalf("non-admin should be forbidden, got %d", rec.Code)
+	}
+	rec := get(true)
+	body := rec.Body.String()
+	if rec.Code != http.StatusOK || strings.Contains(body, "s3cret") || strings.Contains(body, "sk-file") || strings.Contains(body, "file-admin") {
+		t.Fatalf("secrets must be masked: %d %s", rec.Code, body)
+	}
+	var resp struct {
+		ConfigFile string `json:"config_file"`
+		Settings   map[string]struct {
+			Value  string `json:"value"`
+			Source string `json:"source"`
+		} `json:"settings"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.ConfigFile != path || resp.Settings["listen_addr"].Value != ":9200" || !strings.Contains(resp.Settings["mysql_dsn"].Value, "qcc:******@") {
+		t.Fatalf("unexpected config view: %s", body)
+	}
+}
+
+func TestSeparateAdminAndProxyListeners(t *testing.T) {
+	var upstreamHits atomic.Int64
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamHits.Add(1)
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer upstream.Close()
+
+	srv, err := NewBuilder().WithUpstream(upstream.URL).WithAdminListenAddr("127.0.0.1:0").Build()
+	if err != nil {
+		t.Fatalf("build proxy: %v", err)
+	}
+	proxyH, adminH := srv.handler(listenerProxy), srv.handler(listenerAdmin)
+	sess := srv.sessionMgr.Create(srv.defaultAccount.ID, true)
+	serve := func(h http.Handler, method, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(`{}`))
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: sess.Token})
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := serve(proxyH, http.MethodGet, "/api/version"); rec.Code != http.StatusNotFound {
+		t.Fatalf("proxy listener must not serve admin API, got %d", rec.Code)
+	}
+	if rec := serve(proxyH, http.MethodGet, "/admin"); rec.Code != http.StatusNotFound {
+		t.Fatalf("proxy listener must not serve admin UI, got %d", rec.Code)
+	}
+	if rec := serve(proxyH, http.MethodGet, "/version"); rec.Code != http.StatusOK {
+		t.Fatalf("proxy listener should serve /version, got %d", rec.Code)
+	}
+	if rec := serve(proxyH, http.MethodPost, "/v1/messages"); rec.Code != http.StatusOK || upstreamHits.Load() != 1 {
+		t.Fatalf("proxy listener should forward, got %d hits=%d", rec.Code, upstreamHits.Load())
+	}
+
+	if rec := serve(adminH, http.MethodGet, "/api/version"); rec.Code != http.StatusOK {
+		t.Fatalf("admin listener should serve admin API, got %d", rec.Code)
+	}
+	if rec := serve(adminH, http.MethodPost, "/v1/messages"); rec.Code != http.StatusNotFound || upstreamHits.Load() != 1 {
+		t.Fatalf("admin listener must not forward, got %d hits=%d", rec.Code, upstreamHits.Load())
+	}
+}
+
+func TestUnixSocketListener(t *testing.T) {
+	dir, err := os.MkdirTemp("", "qcc")
+	if err != nil {
+		t.Fatalf("temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	sock := filepath.Join(dir, "qcc.sock")
+	// 遗留的 socket 文件应被清理，普通文件则拒绝覆盖。
+	if err := os.WriteFile(sock, []byte("x"), 0o600); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	srv, err := NewBuilder().WithUpstream("http://unix.local").WithUnixSocketMode(0o600).Build()
+	if err != nil {
+		t.Fatalf("build proxy: %v", err)
+	}
+	if _, err := srv.listen("unix:" + sock); err == nil {
+		t.Fatalf("expected error for non-socket file")
+	}
+	os.Remove(sock)
+
+	ln, err := srv.listen("unix:" + sock)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	info, err := os.Stat(sock)
+	if err != nil || info.Mode().Perm() != 0o600 || info.Mode()&os.ModeSocket == 0 {
+		t.Fatalf("unexpected socket mode: %v %v", info, err)
+	}
+	hs := srv.newHTTPServer("unix:"+sock, listenerAll)
+	go hs.Serve(ln)
+	defer hs.Close()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", sock)
+		},
+	}}
+	resp, err := client.Get("http://qcc/version")
+	if err != nil {
+		t.Fatalf("request over unix socket: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status %d", resp.StatusCode)
+	}
+}
+
+func TestAccessLogCombinedFormatAndRotation(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer upstream.Close()
+	srv, err := NewBuilder().WithUpstream(upstream.URL).Build()
+	if err != nil {
+		t.Fatalf("build proxy: %v", err)
+	}
+	defer srv.accessLog.close()
+	path := filepath.Join(t.TempDir(), "logs", "access.log")
+	srv.settingsCache = &SettingsCache{data: map[string]any{
+		"access_log.enabled":     true,
+		"access_log.output":      path,
+		"access_log.max_size_mb": 0,
+	}}
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages?beta=true", strings.NewReader(`{}`))
+	req.RemoteAddr = "203.0.113.7:5123"
+	req.Header.Set("User-Agent", `cli "quoted"`)
+	req.Header.Set("Referer", "https://example.com/")
+	srv.Handler().ServeHTTP(httptest.NewRecorder(), req)
+	srv.Handler().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/version", nil))
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read access log: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %q", data)
+	}
+	want := `203.0.113.7 - - [`
+	if !strings.HasPrefix(lines[0], want) || !strings.Contains(lines[0], `] "POST /v1/messages?beta=true HTTP/1.1" 200 11 "https://example.com/" "cli \"quoted\""`) {
+		t.Fatalf("unexpected combined line: %s", lines[0])
+	}
+	if !strings.Contains(lines[1], `"GET /api/version HTTP/1.1" 401 `) {
+		t.Fatalf("admin API should be logged too: %s", lines[1])
+	}
+
+	w, err := logfile.Open(filepath.Join(t.TempDir(), "r.log"), logfile.Options{MaxSizeMB: 1, MaxBackups: 1})
+	if err != nil {
+		t.Fatalf("open rotating log: %v", err)
+	}
+	defer w.Close()
+	chunk := bytes.Repeat([]byte("x"), 600<<10)
+	for i := 0; i < 3; i++ {
+		if _, err := w.Write(chunk); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	if _, err := os.Stat(w.Path() + ".1"); err != nil {
+		t.Fatalf("expected rotated backup: %v", err)
+	}
+	if _, err := os.Stat(w.Path() + ".2"); !os.IsNotExist(err) {
+		t.Fatalf("backups beyond max_backups should be removed: %v", err)
+	}
+}
+
+func TestLogFileTimeRotationCompressionAndMaxAge(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	stale := path + ".9.gz"
+	if err := os.WriteFile(stale, []byte("old"), 0o644); err != nil {
+		t.Fatalf("write stale backup: %v", err)
+	}
+	old := time.Now().Add(-48 * time.Hour)
+	os.Chtimes(stale, old, old)
+
+	w, err := logfile.Open(path, logfile.Options{MaxBackups: 3, Interval: 10 * time.Millisecond, MaxAge: 24 * time.Hour, Compress: true})
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Fatalf("expired backup should be removed on open: %v", err)
+	}
+	w.Write([]byte("first\n"))
+	time.Sleep(20 * time.Millisecond)
+	w.Write([]byte("second\n"))
+	if err := w.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	if _, err := os.Stat(path + ".1"); !os.IsNotExist(err) {
+		t.Fatalf("uncompressed backup should be replaced by .gz: %v", err)
+	}
+	f, err := os.Open(path + ".1.gz")
+	if err != nil {
+		t.Fatalf("expected compressed backup: %v", err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("gzip reader: %v", err)
+	}
+	data, _ := io.ReadAll(gz)
+	if string(data) != "first\n" {
+		t.Fatalf("unexpected backup content %q", data)
+	}
+	current, _ := os.ReadFile(path)
+	if string(current) != "second\n" {
+		t.Fatalf("unexpected current content %q", current)
+	}
+}
+
+func TestFirstByteTimeoutOnStalledStream(t *testing.T) {
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		if r.URL.Path == "/v1/stall" {
+			select {
+			case <-release:
+			case <-r.Context().Done():
+			}
+			return
+		}
+		w.Write([]byte("event: message_stop\ndata: {}\n\n"))
+	}))
+	defer upstream.Close()
+	defer close(release)
+
+	srv, err := NewBuilder().WithUpstream(upstream.URL).WithRetry(1).Build()
+	if err != nil {
+		t.Fatalf("build proxy: %v", err)
+	}
+	srv.settingsCache = &SettingsCache{data: map[string]any{
+		"proxy.first_byte_timeout_ms": 50,
+		"proxy.first_byte_recheck":    false,
+	}}
+
+	rec := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/ok", strings.NewReader(`{}`)))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "message_stop") {
+		t.Fatalf("healthy stream should pass through: %d %q", rec.Code, rec.Body.String())
+	}
+
+	start := time.Now()
+	rec = httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/stall", strings.NewReader(`{}`)))
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("stalled stream should be aborted quickly, took %v", elapsed)
+	}
+	var resp struct {
+		Error struct {
+			Type      string `json:"type"`
+			TimeoutMs int64  `json:"timeout_ms"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || rec.Code != http.StatusGatewayTimeout ||
+		resp.Error.Type != ErrorClassFirstByte || resp.Error.TimeoutMs != 50 {
+		t.Fatalf("expected structured first byte timeout: %d %s", rec.Code, rec.Body.String())
+	}
+	if got := classifyRequest(http.StatusGatewayTimeout, &usage{firstByteStall: true, transportErr: errFirstByteTimeout}); got != ErrorClassFirstByte {
+		t.Fatalf("expected distinct error class, got %s", got)
+	}
+}
+
+func TestSSEValidationRepairsAndCountsPerNode(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("event: content_block_delta\ndata: {\"x\":1}\n\n{\"truncated\"\nevent: message_stop\ndata: {}"))
+	}))
+	defer upstream.Close()
+	srv, err := NewBuilder().WithUpstream(upstream.URL).WithRetry(1).Build()
+	if err != nil {
+		t.Fatalf("build proxy: %v", err)
+	}
+	srv.settingsCache = &SettingsCache{data: map[string]any{"stream.validate": true}}
+
+	rec := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(`{}`)))
+	if !strings.HasSuffix(rec.Body.String(), "event: message_stop\ndata: {}\n\n") {
+		t.Fatalf("stream should be repaired with final newlines: %q", rec.Body.String())
+	}
+
+	sess := srv.sessionMgr.Create(srv.defaultAccount.ID, true)
+	req := httptest.NewRequest(http.MethodGet, "/api/metrics/streams", nil)
+	req.AddCookie(&http.Cookie{Name: "session_token", Value: sess.Token})
+	rec = httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, req)
+	var resp struct {
+		Validate bool `json:"validate"`
+		Nodes    []struct {
+			Checked             int64 `json:"checked"`
+			Malformed           int64 `json:"malformed"`
+			MissingFinalNewline int64 `json:"missing_final_newline"`
+			MissingEnd          int64 `json:"missing_end"`
+			Repaired            int64 `json:"repaired"`
+		} `json:"nodes"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || !resp.Validate || len(resp.Nodes) != 1 {
+		t.Fatalf("unexpected stream stats: %d %s", rec.Code, rec.Body.String())
+	}
+	n := resp.Nodes[0]
+	if n.Checked != 1 || n.Malformed != 1 || n.MissingFinalNewline != 1 || n.MissingEnd != 0 || n.Repaired != 1 {
+		t.Fatalf("unexpected per-node counters: %+v", n)
+	}
+}
+
+func TestMidStreamFailureSalvage(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("event: message_start\ndata: {\"type\":\"message_start\"}\n\n" +
+			"event: content_block_start\ndata: {\"type\":\"content_block_start\",\"index\":0,\"content_block\":{\"type\":\"text\",\"text\":\"\"}}\n\n" +
+			"event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"text_delta\",\"text\":\"Hello wor\"}}\n\n" +
+			"event: content_block_delta\ndata: {\"type\":\"content_blo"))
+		w.(http.Flusher).Flush()
+		panic(http.ErrAbortHandler)
+	}))
+	defer primary.Close()
+	var continuation atomic.Value
+	secondary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		continuation.Store(string(body))
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("event: message_start\ndata: {\"type\":\"message_start\"}\n\n" +
+			"event: content_block_start\ndata: {\"type\":\"content_block_start\",\"index\":0,\"content_block\":{\"type\":\"text\",\"text\":\"\"}}\n\n" +
+			"event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"text_delta\",\"text\":\"ld\"}}\n\n" +
+			"event: content_block_stop\ndata: {\"type\":\"content_block_stop\",\"index\":0}\n\n" +
+			"event: message_stop\ndata: {\"type\":\"message_stop\"}\n\n"))
+	}))
+	defer secondary.Close()
+
+	srv, err := NewBuilder().WithUpstream(primary.URL).WithRetry(1).Build()
+	if err != nil {
+		t.Fatalf("build proxy: %v", err)
+	}
+	if _, err := srv.addNodeWithOptions(srv.defaultAccount, "backup", secondary.URL, "", 5, "", nil, 0); err != nil {
+		t.Fatalf("add backup node: %v", err)
+	}
+	send := func() string {
+		req := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(`{"stream":true,"messages":[{"role":"user","content":"hi"}]}`))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(rec, req)
+		return rec.Body.String()
+	}
+
+	// 默认补发结构化 error 事件，而不是直接断开。
+	body := send()
+	if !strings.HasSuffix(body, "\n\n") || !strings.Contains(body, "event: error") || !strings.Contains(body, "upstream_stream_interrupted") ||
+		strings.Contains(body, "content_blo\n") {
+		t.Fatalf("expected structured error event without partial frame: %q", body)
+	}
+
+	if err := srv.setAccountPolicy(srv.defaultAccount.ID, AccountPolicy{StreamFailure: streamFailureContinue}, ""); err != nil {
+		t.Fatalf("set policy: %v", err)
+	}
+	body = send()
+	if strings.Count(body, "event: message_start") != 1 || strings.Count(body, "event: content_block_start") != 1 ||
+		!strings.Contains(body, `"text":"ld"`) || !strings.HasSuffix(body, "event: message_stop\ndata: {\"type\":\"message_stop\"}\n\n") ||
+		strings.Contains(body, "event: error") {
+		t.Fatalf("unexpected continued stream: %q", body)
+	}
+	sent, _ := continuation.Load().(string)
+	if !strings.Contains(sent, `{"content":"Hello wor","role":"assistant"}`) {
+		t.Fatalf("continuation should prefill generated text: %s", sent)
+	}
+	if srv.salvage.continued.Load() != 1 || srv.salvage.errorEvents.Load() != 1 {
+		t.Fatalf("unexpected salvage counters: %v", srv.salvage.view())
+	}
+}
+
+func TestAccountExportRunsAsQueuedJob(t *testing.T) {
+	srv, err := NewBuilder().WithUpstream("http://127.0.0.1:1").Build()
+	if err != nil {
+		t.Fatalf("build proxy: %v", err)
+	}
+	queue := &memJobQueue{}
+	srv.jobs = newJobRunner(queue, srv.logger, 0)
+	for typ, h := range srv.builtinJobHandlers() {
+		srv.jobs.register(typ, h)
+	}
+	owner := srv.sessionMgr.Create(srv.defaultAccount.ID, false)
+	do := func(method, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: owner.Token})
+		rec := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+
+	base := "/api/accounts/" + srv.defaultAccount.ID + "/export"
+	rec := do(http.MethodPost, base)
+	var export struct {
+		ID     string `json:"id"`
+		Status string `json:"status"`
+		JobID  int64  `json:"job_id"`
+	}
+	_ = json.Unmarshal(rec.Body.Bytes(), &export)
+	if rec.Code != http.StatusAccepted || export.JobID == 0 {
+		t.Fatalf("export should be enqueued as a job: %d %s", rec.Code, rec.Body.String())
+	}
+	job, _ := queue.GetJob(context.Background(), export.JobID)
+	if job == nil || job.Type != jobTypeAccountExport || job.Status != store.JobPending || job.AccountID != srv.defaultAccount.ID {
+		t.Fatalf("unexpected queued job: %+v", job)
+	}
+	// 入队后由 worker 执行，接口本身不启动导出
+	time.Sleep(20 * time.Millisecond)
+	rec = do(http.MethodGet, base+"/"+export.ID)
+	_ = json.Unmarshal(rec.Body.Bytes(), &export)
+	if export.Status == exportReady {
+		t.Fatalf("export must not run before the job is claimed")
+	}
+
+	if !srv.jobs.runOnce() {
+		t.Fatalf("expected export job to run")
+	}
+	job, _ = queue.GetJob(context.Background(), export.JobID)
+	if job.Status != store.JobSucceeded {
+		t.Fatalf("export job should succeed: %+v", job)
+	}
+	rec = do(http.MethodGet, base+"/"+export.ID)
+	_ = json.Unmarshal(rec.Body.Bytes(), &export)
+	if export.Status != exportReady {
+		t.Fatalf("export not ready after job: %s", rec.Body.String())
+	}
+	if rec := do(http.MethodGet, base+"/"+export.ID+"/download"); rec.Code != http.StatusOK {
+		t.Fatalf("download failed: %d", rec.Code)
+	}
+}
+
+// collectJobProgress 读取客户端收到的 job_progress 消息，直到任务结束或超时；wait 为 0 时只读已收到的消息。
+func collectJobProgress(c *WSClient, wait time.Duration) []JobProgress {
+	var out []JobProgress
+	deadline := time.After(wait)
+	for {
+		select {
+		case data := <-c.send:
+			var msg struct {
+				Type    string      `json:"type"`
+				Payload JobProgress `json:"payload"`
+			}
+			if json.Unmarshal(data, &msg) == nil && msg.Type == wsTopicJobProgress {
+				out = append(out, msg.Payload)
+				if msg.Payload.Status != store.JobRunning {
+					return out
+				}
+			}
+		case <-deadline:
+			return out
+		default:
+			if wait == 0 {
+				return out
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+}
+
+func TestBackfillAndImportPublishProgress(t *testing.T) {
+	st, err := store.Open("sqlite:" + filepath.Join(t.TempDir(), "qcc.db"))
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	defer st.Close()
+	ctx := context.Background()
+	hour := time.Now().UTC().Truncate(time.Hour)
+	for h := 2; h <= 3; h++ {
+		rec := store.MetricsRecord{AccountID: "acc1", NodeID: "n1", Timestamp: hour.Add(-time.Duration(h)*time.Hour + 5*time.Minute), RequestsTotal: 1}
+		if err := st.InsertMetrics(ctx, rec); err != nil {
+			t.Fatalf("insert metrics: %v", err)
+		}
+	}
+
+	// 补聚合是系统任务，进度只推送给管理员
+	srv := &Server{wsHub: NewWSHub()}
+	admin := &WSClient{hub: srv.wsHub, accountID: "acc1", isAdmin: true, send: make(chan []byte, 32)}
+	member := &WSClient{hub: srv.wsHub, accountID: "acc1", send: make(chan []byte, 32)}
+	srv.wsHub.addClient(admin)
+	srv.wsHub.addClient(member)
+	m := NewMetricsScheduler(st, nil)
+	m.publishProgress = srv.broadcastJobProgress
+	m.runCatchUp()
+	if m.lastCatchUp == nil || m.lastCatchUp.Err != "" || m.lastCatchUp.Backfilled["hour"] != 2 {
+		t.Fatalf("unexpected catch-up report: %+v", m.lastCatchUp)
+	}
+	events := collectJobProgress(admin, 2*time.Second)
+	if len(events) < 2 {
+		t.Fatalf("expected running and final backfill events, got %+v", events)
+	}
+	first, last := events[0], events[len(events)-1]
+	if first.Type != jobTypeAggregationBackfill || first.Status != store.JobRunning || first.Stage != "hour" || first.Total != 2 {
+		t.Fatalf("unexpected first backfill event: %+v", first)
+	}
+	if last.JobID != first.JobID || last.Status != store.JobSucceeded || last.Percent != 100 {
+		t.Fatalf("unexpected final backfill event: %+v", last)
+	}
+	if got := collectJobProgress(member, 0); len(got) != 0 {
+		t.Fatalf("backfill progress must only reach admins: %+v", got)
+	}
+
+	// 没有缺失的桶时不推送
+	m.runCatchUp()
+	if got := collectJobProgress(admin, 0); len(got) != 0 {
+		t.Fatalf("nothing to backfill should not publish progress: %+v", got)
+	}
+
+	// 批量导入按项上报进度，推送给导入所在账号
+	proxy, err := NewBuilder().WithUpstream("http://127.0.0.1:1").Build()
+	if err != nil {
+		t.Fatalf("build proxy: %v", err)
+	}
+	owner := &WSClient{hub: proxy.wsHub, accountID: proxy.defaultAccount.ID, send: make(chan []byte, 32)}
+	proxy.wsHub.addClient(owner)
+	session := proxy.sessionMgr.Create(proxy.defaultAccount.ID, false)
+	req := httptest.NewRequest(http.MethodPost, "/api/nodes/import", strings.NewReader(`{"nodes":[
+		{"name":"i1","base_url":"http://i1.local","weight":1},
+		{"name":"i2","base_url":"http://i2.local","weight":1},
+		{"name":"bad","base_url":"not a url"}]}`))
+	req.AddCookie(&http.Cookie{Name: "session_token", Value: session.Token})
+	rec := httptest.NewRecorder()
+	proxy.Handler().ServeHTTP(rec, req)
+	var res struct {
+		JobID int64 `json:"job_id"`
+	}
+	_ = json.Unmarshal(rec.Body.Bytes(), &res)
+	if rec.Code != http.StatusOK || res.JobID == 0 {
+		t.Fatalf("import failed: %d %s", rec.Code, rec.Body.String())
+	}
+	events = collectJobProgress(owner, 2*time.Second)
+	if len(events) < 2 {
+		t.Fatalf("expected running and final import events, got %+v", events)
+	}
+	first, last = events[0], events[len(events)-1]
+	if first.Type != jobTypeNodeImport || first.JobID != res.JobID || first.Status != store.JobRunning || first.Total != 3 {
+		t.Fatalf("unexpected first import event: %+v", first)
+	}
+	if last.JobID != res.JobID || last.Status != store.JobSucceeded || last.Processed != 3 || last.Total != 3 {
+		t.Fatalf("unexpected final import event: %+v", last)
+	}
+}
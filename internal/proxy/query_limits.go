@@ -0,0 +1,122 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"qcc_plus/internal/store"
+)
+
+// 指标与健康检查历史查询的代价限制：按粒度限制单次查询的时间跨度与返回行数，
+// 避免一次大范围的原始数据查询拖垮数据库。
+const (
+	metricsMaxLimit       = 1000  // 节点/账号指标单次返回的最大行数
+	metricsMaxScanRows    = 20000 // 账号指标跨节点合并前读取的最大行数
+	healthHistoryMaxRange = 31 * 24 * time.Hour
+	healthHistoryMaxLimit = 2000
+)
+
+// metricsMaxRange 各粒度单次查询允许的最大时间跨度。
+var metricsMaxRange = map[store.MetricsGranularity]time.Duration{
+	store.MetricsGranularityRaw:     7 * 24 * time.Hour,
+	store.MetricsGranularityHourly:  92 * 24 * time.Hour,
+	store.MetricsGranularityDaily:   3 * 366 * 24 * time.Hour,
+	store.MetricsGranularityMonthly: 10 * 366 * 24 * time.Hour,
+}
+
+// metricsGranularityOrder 由细到粗。
+var metricsGranularityOrder = []store.MetricsGranularity{
+	store.MetricsGranularityRaw,
+	store.MetricsGranularityHourly,
+	store.MetricsGranularityDaily,
+	store.MetricsGranularityMonthly,
+}
+
+// queryLimitError 查询超出代价限制，响应中附带限制值与建议改用的粒度。
+type queryLimitError struct {
+	msg       string
+	maxRange  time.Duration
+	maxRows   int
+	suggested store.MetricsGranularity // 为空表示只能缩小时间范围
+}
+
+func (e *queryLimitError) Error() string { return e.msg }
+
+func (e *queryLimitError) view() map[string]interface{} {
+	res := map[string]interface{}{"error": e.msg, "code": "query_too_large"}
+	if e.maxRange > 0 {
+		res["max_range_hours"] = int64(e.maxRange / time.Hour)
+	}
+	if e.maxRows > 0 {
+		res["max_rows"] = e.maxRows
+	}
+	if e.suggested != "" {
+		res["suggested_granularity"] = string(e.suggested)
+	}
+	return res
+}
+
+// writeQueryError 超出代价限制时返回带建议的 400，其他参数错误按原样返回。
+func writeQueryError(w http.ResponseWriter, err error) {
+	var qle *queryLimitError
+	if errors.As(err, &qle) {
+		respondJSON(w, http.StatusBadRequest, qle.view())
+		return
+	}
+	respondJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+}
+
+// checkMetricsRange 校验时间跨度不超过该粒度的上限，超出时建议能覆盖该跨度的最细粒度。
+func checkMetricsRange(gran store.MetricsGranularity, from, to time.Time) error {
+	max := metricsMaxRange[gran]
+	span := to.Sub(from)
+	if max <= 0 || span <= max {
+		return nil
+	}
+	e := &queryLimitError{maxRange: max}
+	for _, g := range coarserGranularities(gran) {
+		if span <= metricsMaxRange[g] {
+			e.suggested = g
+			break
+		}
+	}
+	if e.suggested != "" {
+		e.msg = fmt.Sprintf("time range %s exceeds the %s limit for granularity=%s, use granularity=%s or a shorter range",
+			formatRangeDays(span), formatRangeDays(max), gran, e.suggested)
+	} else {
+		e.msg = fmt.Sprintf("time range %s exceeds the %s limit for granularity=%s, use a shorter range",
+			formatRangeDays(span), formatRangeDays(max), gran)
+	}
+	return e
+}
+
+// tooManyRowsError 读取行数超出上限时建议下一级更粗的粒度。
+func tooManyRowsError(gran store.MetricsGranularity, max int) error {
+	e := &queryLimitError{maxRows: max}
+	if coarser := coarserGranularities(gran); len(coarser) > 0 {
+		e.suggested = coarser[0]
+		e.msg = fmt.Sprintf("query matches more than %d rows at granularity=%s, use granularity=%s or a shorter range", max, gran, e.suggested)
+	} else {
+		e.msg = fmt.Sprintf("query matches more than %d rows at granularity=%s, use a shorter range", max, gran)
+	}
+	return e
+}
+
+func coarserGranularities(gran store.MetricsGranularity) []store.MetricsGranularity {
+	for i, g := range metricsGranularityOrder {
+		if g == gran {
+			return metricsGranularityOrder[i+1:]
+		}
+	}
+	return nil
+}
+
+func formatRangeDays(d time.Duration) string {
+	days := d.Hours() / 24
+	if days == float64(int64(days)) {
+		return fmt.Sprintf("%dd", int64(days))
+	}
+	return fmt.Sprintf("%.1fd", days)
+}
@@ -0,0 +1,251 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"qcc_plus/internal/notify"
+	"qcc_plus/internal/timeutil"
+)
+
+// 配额周期，按北京时间切分。
+const (
+	quotaPeriodDay   = "day"
+	quotaPeriodMonth = "month"
+)
+
+// 配额响应头：剩余与总额度（tokens）、周期重置时间，以及已越过的最高预警阈值（百分比）。
+const (
+	quotaRemainingHeader = "X-QCC-Quota-Remaining"
+	quotaLimitHeader     = "X-QCC-Quota-Limit"
+	quotaResetHeader     = "X-QCC-Quota-Reset"
+	quotaWarningHeader   = "X-QCC-Quota-Warning"
+)
+
+const settingQuotaWarnThresholds = "quota.warn_thresholds"
+
+var defaultQuotaWarnThresholds = []int{80, 95}
+
+// accountQuota 账号当前周期的 token 用量与已触发的预警阈值。
+type accountQuota struct {
+	mu     sync.Mutex
+	start  time.Time
+	used   int64
+	seeded bool
+	warned map[int]bool
+}
+
+func quotaPeriodStart(period string, now time.Time) time.Time {
+	t := now.In(timeutil.BeijingLocation)
+	if period == quotaPeriodDay {
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, timeutil.BeijingLocation)
+	}
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, timeutil.BeijingLocation)
+}
+
+func quotaPeriodEnd(period string, start time.Time) time.Time {
+	if period == quotaPeriodDay {
+		return start.AddDate(0, 0, 1)
+	}
+	return start.AddDate(0, 1, 0)
+}
+
+// validQuotaThreshold 预警阈值须在 1-99 之间，100% 即硬限制。
+func validQuotaThreshold(pct int) bool {
+	return pct >= 1 && pct <= 99
+}
+
+// normalizeQuotaThresholds 去重并升序排列。
+func normalizeQuotaThresholds(list []int) []int {
+	seen := make(map[int]bool, len(list))
+	out := make([]int, 0, len(list))
+	for _, pct := range list {
+		if validQuotaThreshold(pct) && !seen[pct] {
+			seen[pct] = true
+			out = append(out, pct)
+		}
+	}
+	sort.Ints(out)
+	return out
+}
+
+// validateQuotaThresholds 校验 quota.warn_thresholds：1-99 的整数数组。
+func validateQuotaThresholds(value any) error {
+	list, ok := value.([]any)
+	if !ok {
+		return fmt.Errorf("must be an array")
+	}
+	for _, v := range list {
+		n, ok := settingNumber(v)
+		if !ok || n != float64(int(n)) || !validQuotaThreshold(int(n)) {
+			return fmt.Errorf("thresholds must be integers between 1 and 99")
+		}
+	}
+	return nil
+}
+
+// quotaThresholds 账号策略中的预警阈值优先，未设置时使用系统配置。
+func (p *Server) quotaThresholds(policy AccountPolicy) []int {
+	if len(policy.QuotaWarnPct) > 0 {
+		return normalizeQuotaThresholds(policy.QuotaWarnPct)
+	}
+	if p.settingsCache != nil {
+		if v, ok := p.settingsCache.Get(settingQuotaWarnThresholds); ok {
+			if list, ok := v.([]any); ok {
+				var out []int
+				for _, item := range list {
+					if n, ok := settingNumber(item); ok {
+						out = append(out, int(n))
+					}
+				}
+				return normalizeQuotaThresholds(out)
+			}
+		}
+	}
+	return defaultQuotaWarnThresholds
+}
+
+// quotaState 返回账号配额记录，进入新周期时清零；每个周期首次访问时从原始指标回填已用量，
+// 避免重启后从零计数（受原始数据保留期限制）。调用方需持有 q.mu。
+func (p *Server) quotaState(accountID, period string, now time.Time) *accountQuota {
+	v, _ := p.quotas.LoadOrStore(accountID, &accountQuota{})
+	q := v.(*accountQuota)
+	q.mu.Lock()
+	start := quotaPeriodStart(period, now)
+	if !q.start.Equal(start) {
+		q.start, q.used, q.seeded, q.warned = start, 0, false, nil
+	}
+	if !q.seeded {
+		q.seeded = true
+		if p.store != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			rows, err := p.store.UsageByLabel(ctx, accountID, start, now)
+			cancel()
+			if err == nil {
+				for _, row := range rows {
+					q.used += row.InputTokensTotal + row.OutputTokensTotal
+				}
+			}
+		}
+	}
+	return q
+}
+
+// highestCrossed 返回已用量越过的最高阈值，未越过任何阈值时为 0。
+func highestCrossed(used, limit int64, thresholds []int) int {
+	crossed := 0
+	for _, pct := range thresholds {
+		if used*100 >= limit*int64(pct) {
+			crossed = pct
+		}
+	}
+	return crossed
+}
+
+// applyTokenQuota 在响应头中标注配额余量，额度用尽时以 429 拒绝；请求被拒绝时已写出响应并返回 true。
+func (p *Server) applyTokenQuota(w http.ResponseWriter, acc *Account) bool {
+	policy := p.accountPolicy(acc)
+	if policy.TokenQuota <= 0 {
+		return false
+	}
+	now := time.Now()
+	q := p.quotaState(acc.ID, policy.QuotaPeriod, now)
+	used, start := q.used, q.start
+	q.mu.Unlock()
+
+	remaining := policy.TokenQuota - used
+	if remaining < 0 {
+		remaining = 0
+	}
+	reset := quotaPeriodEnd(policy.QuotaPeriod, start)
+	h := w.Header()
+	h.Set(quotaLimitHeader, strconv.FormatInt(policy.TokenQuota, 10))
+	h.Set(quotaRemainingHeader, strconv.FormatInt(remaining, 10))
+	h.Set(quotaResetHeader, reset.Format(time.RFC3339))
+	if pct := highestCrossed(used, policy.TokenQuota, p.quotaThresholds(policy)); pct > 0 {
+		h.Set(quotaWarningHeader, strconv.Itoa(pct))
+	}
+	if remaining > 0 {
+		return false
+	}
+	p.logger.Printf("reject request: token quota exhausted (account=%s used=%d limit=%d)", acc.ID, used, policy.TokenQuota)
+	writeProxyError(w, http.StatusTooManyRequests, "quota_exceeded", "token quota exhausted for the current period", map[string]any{
+		"limit":    policy.TokenQuota,
+		"reset_at": timeutil.FormatBeijingTime(reset),
+	})
+	return true
+}
+
+// addQuotaUsage 累计本次请求的 token 用量，越过预警阈值或用尽额度时各通知一次（每周期）。
+func (p *Server) addQuotaUsage(acc *Account, tokens int64) {
+	if acc == nil || tokens <= 0 {
+		return
+	}
+	policy := p.accountPolicy(acc)
+	if policy.TokenQuota <= 0 {
+		return
+	}
+	now := time.Now()
+	q := p.quotaState(acc.ID, policy.QuotaPeriod, now)
+	before := q.used
+	q.used += tokens
+	used, start := q.used, q.start
+	crossed := 0
+	levels := append(append([]int(nil), p.quotaThresholds(policy)...), 100)
+	for _, pct := range levels {
+		if q.warned[pct] || used*100 < policy.TokenQuota*int64(pct) {
+			continue
+		}
+		if q.warned == nil {
+			q.warned = make(map[int]bool)
+		}
+		q.warned[pct] = true
+		// 回填的历史用量已越过的阈值只标记，不补发通知。
+		if before*100 < policy.TokenQuota*int64(pct) {
+			crossed = pct
+		}
+	}
+	q.mu.Unlock()
+	if crossed > 0 {
+		p.publishQuotaWarning(acc, policy, crossed, used, start, now)
+	}
+}
+
+func (p *Server) publishQuotaWarning(acc *Account, policy AccountPolicy, pct int, used int64, start, now time.Time) {
+	remaining := policy.TokenQuota - used
+	if remaining < 0 {
+		remaining = 0
+	}
+	reset := quotaPeriodEnd(policy.QuotaPeriod, start)
+	title := fmt.Sprintf("账号 token 配额已使用 %d%%", pct)
+	if pct >= 100 {
+		title = "账号 token 配额已用尽"
+	}
+	if p.notifyMgr != nil {
+		p.notifyMgr.Publish(notify.Event{
+			AccountID: acc.ID,
+			EventType: notify.EventAccountQuotaWarning,
+			Title:     title,
+			Content: fmt.Sprintf("**账号**: %s\n**已用**: %d / %d tokens\n**周期重置**: %s",
+				acc.Name, used, policy.TokenQuota, timeutil.FormatBeijingTime(reset)),
+			DedupKey:   fmt.Sprintf("%s:%d:%d", acc.ID, start.Unix(), pct),
+			OccurredAt: now,
+		})
+	}
+	if p.wsHub != nil {
+		p.wsHub.Broadcast(acc.ID, "quota_warning", map[string]interface{}{
+			"account_id": acc.ID,
+			"threshold":  pct,
+			"used":       used,
+			"limit":      policy.TokenQuota,
+			"remaining":  remaining,
+			"reset_at":   timeutil.FormatBeijingTime(reset),
+			"timestamp":  timeutil.FormatBeijingTime(now),
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"qcc_plus/internal/config"
+)
+
+// recordingSink 流量录制的对象存储，key 为以 / 分隔的对象路径。
+type recordingSink interface {
+	Put(ctx context.Context, key string, data []byte) error
+	Kind() string
+}
+
+// newRecordingSink 根据启动配置创建录制存储，未配置时返回 nil。
+func newRecordingSink(cfg config.RecordingStore, rt http.RoundTripper) (recordingSink, error) {
+	raw := strings.TrimSpace(cfg.URL)
+	if raw == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid recording.url: %v", err)
+	}
+	switch u.Scheme {
+	case "file":
+		if u.Path == "" {
+			return nil, fmt.Errorf("recording.url %q has no directory", raw)
+		}
+		return &dirSink{root: u.Path}, nil
+	case "s3":
+		if u.Host == "" {
+			return nil, fmt.Errorf("recording.url %q has no bucket", raw)
+		}
+		if cfg.AccessKey == "" || cfg.SecretKey == "" {
+			return nil, fmt.Errorf("recording.access_key and recording.secret_key are required for s3")
+		}
+		region := chooseNonEmpty(cfg.Region, "us-east-1")
+		endpoint := strings.TrimSuffix(chooseNonEmpty(cfg.Endpoint, "https://s3."+region+".amazonaws.com"), "/")
+		if _, err := url.Parse(endpoint); err != nil {
+			return nil, fmt.Errorf("invalid recording.endpoint: %v", err)
+		}
+		return &s3Sink{
+			endpoint:  endpoint,
+			bucket:    u.Host,
+			prefix:    strings.Trim(u.Path, "/"),
+			region:    region,
+			accessKey: cfg.AccessKey,
+			secretKey: cfg.SecretKey,
+			client:    &http.Client{Transport: rt, Timeout: time.Minute},
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported recording.url scheme %q (expected file or s3)", u.Scheme)
+	}
+}
+
+// dirSink 写入本地目录，适合挂载的网络存储或由外部工具同步到对象存储。
+type dirSink struct {
+	root string
+}
+
+func (d *dirSink) Kind() string { return "file" }
+
+func (d *dirSink) Put(_ context.Context, key string, data []byte) error {
+	path := filepath.Join(d.root, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return err
+	}
+	// 先写临时文件再改名，避免同步工具读到写了一半的对象。
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o640); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// s3Sink 以 path-style 与 SigV4 签名 PUT 对象，兼容 AWS S3、MinIO、R2 等 S3 协议存储。
+type s3Sink struct {
+	endpoint  string
+	bucket    string
+	prefix    string
+	region    string
+	accessKey string
+	secretKey string
+	client    *http.Client
+}
+
+func (s *s3Sink) Kind() string { return "s3" }
+
+func (s *s3Sink) Put(ctx context.Context, key string, data []byte) error {
+	if s.prefix != "" {
+		key = s.prefix + "/" + key
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, s.endpoint+"/"+s.bucket+"/"+key, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	s.sign(req, data, time.Now().UTC())
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("put %s: status %d: %s", key, resp.StatusCode, strings.TrimSpace(string(b)))
+	}
+	return nil
+}
+
+// sign 按 AWS Signature Version 4 为请求添加 Authorization 头；对象 key 仅包含无需转义的字符。
+func (s *s3Sink) sign(req *http.Request, payload []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	payloadHash := sha256Hex(payload)
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+
+	signed := "content-type;host;x-amz-content-sha256;x-amz-date"
+	canonical := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		"content-type:" + req.Header.Get("Content-Type"),
+		"host:" + req.URL.Host,
+		"x-amz-content-sha256:" + payloadHash,
+		"x-amz-date:" + amzDate,
+		"",
+		signed,
+		payloadHash,
+	}, "\n")
+	scope := day + "/" + s.region + "/s3/aws4_request"
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonical))
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), day)
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", s.accessKey, scope, signed, signature))
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
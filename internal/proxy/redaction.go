@@ -0,0 +1,118 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// 请求日志最多保存的请求体长度（脱敏后截断）。
+const maxLoggedBodyBytes = 16 * 1024
+
+type redactRule struct {
+	name     string
+	re       *regexp.Regexp
+	validate func(string) bool // 可选的二次校验，如信用卡号 Luhn 校验
+}
+
+// redactor 在持久化前对文本执行脱敏，内置规则先于自定义规则执行。
+type redactor struct {
+	rules []redactRule
+}
+
+var builtinRedactRules = []redactRule{
+	{name: "email", re: regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)},
+	{name: "card", re: regexp.MustCompile(`\b(?:\d[ \-]?){12,18}\d\b`), validate: luhnValid},
+	{name: "phone", re: regexp.MustCompile(`(?:\+\d{1,3}[\s.\-]?)?(?:\(\d{2,4}\)[\s.\-]?|\b\d{2,4}[\s.\-]?|\b)\d{3,4}[\s.\-]?\d{4}\b`)},
+}
+
+// newRedactor 根据账号策略构建脱敏器；禁用内置规则且无自定义规则时返回 nil。
+func newRedactor(policy AccountPolicy) (*redactor, error) {
+	r := &redactor{}
+	if !policy.DisableRedaction {
+		r.rules = append(r.rules, builtinRedactRules...)
+	}
+	for _, expr := range policy.RedactPatterns {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redact pattern %q: %v", expr, err)
+		}
+		r.rules = append(r.rules, redactRule{name: "custom", re: re})
+	}
+	if len(r.rules) == 0 {
+		return nil, nil
+	}
+	return r, nil
+}
+
+// redact 将命中的片段替换为 [REDACTED:<类型>]。
+func (r *redactor) redact(s string) string {
+	if r == nil || s == "" {
+		return s
+	}
+	for _, rule := range r.rules {
+		placeholder := "[REDACTED:" + rule.name + "]"
+		s = rule.re.ReplaceAllStringFunc(s, func(m string) string {
+			if rule.validate != nil && !rule.validate(m) {
+				return m
+			}
+			return placeholder
+		})
+	}
+	return s
+}
+
+// luhnValid 校验数字串是否满足 Luhn 算法，避免把普通长数字误判为卡号。
+func luhnValid(s string) bool {
+	digits := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, s)
+	if len(digits) < 13 || len(digits) > 19 {
+		return false
+	}
+	sum := 0
+	double := false
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+// captureRequestBody 在账号开启请求体记录时读取请求体，返回脱敏并截断后的文本。
+func (p *Server) captureRequestBody(acc *Account, r *http.Request) string {
+	if acc == nil {
+		return ""
+	}
+	p.mu.RLock()
+	enabled := acc.Policy.LogBodies
+	rules := acc.rules
+	p.mu.RUnlock()
+	if !enabled {
+		return ""
+	}
+	body, err := peekBody(r)
+	if err != nil || len(body) == 0 {
+		return ""
+	}
+	// 先脱敏再截断，避免截断点切开敏感片段导致漏匹配。
+	text := string(body)
+	if rules != nil {
+		text = rules.redactor.redact(text)
+	}
+	if len(text) > maxLoggedBodyBytes {
+		text = strings.ToValidUTF8(text[:maxLoggedBodyBytes], "") + "...(truncated)"
+	}
+	return text
+}
@@ -0,0 +1,637 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"qcc_plus/internal/store"
+)
+
+const (
+	replayCorpusSettingKey = "account.replay_corpus"
+	replayRunsSettingKey   = "account.replay_runs"
+	replayCorpusPrefix     = "/api/replay/corpus/"
+	replayRunsPrefix       = "/api/replay/runs/"
+	maxReplayCorpus        = 50
+	maxReplayBodyBytes     = 64 * 1024
+	maxReplayRuns          = 20
+	maxReplayNodes         = 5
+	defaultReplayPath      = "/v1/messages"
+)
+
+// ReplayEntry 回放语料中的一条请求。请求体在保存前按账号脱敏规则处理并去掉 metadata，不保存任何请求头。
+type ReplayEntry struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name"`
+	Path       string    `json:"path"`
+	Body       string    `json:"body"`
+	Model      string    `json:"model,omitempty"`
+	Source     string    `json:"source"` // manual / request_log:<id>
+	CapturedAt time.Time `json:"captured_at"`
+	CapturedBy string    `json:"captured_by,omitempty"`
+}
+
+// ReplayResult 一条语料在一个节点上的回放结果。
+type ReplayResult struct {
+	EntryID      string `json:"entry_id"`
+	NodeID       string `json:"node_id"`
+	Status       int    `json:"status"`
+	LatencyMs    int64  `json:"latency_ms"`
+	InputTokens  int64  `json:"input_tokens"`
+	OutputTokens int64  `json:"output_tokens"`
+	Error        string `json:"error,omitempty"`
+}
+
+// ReplayRun 一次回放；BaselineID 指向用于对比的历史回放。
+type ReplayRun struct {
+	ID         string            `json:"id"`
+	Label      string            `json:"label,omitempty"`
+	Nodes      map[string]string `json:"nodes"` // nodeID -> 回放时的节点名称
+	BaselineID string            `json:"baseline_id,omitempty"`
+	Results    []ReplayResult    `json:"results"`
+	StartedAt  time.Time         `json:"started_at"`
+	StartedBy  string            `json:"started_by,omitempty"`
+	DurationMs int64             `json:"duration_ms"`
+}
+
+// replaySummary 按节点汇总的成功率、耗时与 token。
+type replaySummary struct {
+	NodeID       string `json:"node_id"`
+	NodeName     string `json:"node_name"`
+	Requests     int    `json:"requests"`
+	OK           int    `json:"ok"`
+	LatencyAvgMs int64  `json:"latency_avg_ms"`
+	LatencyP95Ms int64  `json:"latency_p95_ms"`
+	InputTokens  int64  `json:"input_tokens"`
+	OutputTokens int64  `json:"output_tokens"`
+}
+
+func okStatus(status int) bool {
+	return status >= 200 && status < 300
+}
+
+func (run ReplayRun) summaries() []replaySummary {
+	byNode := make(map[string][]ReplayResult)
+	for _, res := range run.Results {
+		byNode[res.NodeID] = append(byNode[res.NodeID], res)
+	}
+	out := make([]replaySummary, 0, len(byNode))
+	for id, results := range byNode {
+		s := replaySummary{NodeID: id, NodeName: run.Nodes[id], Requests: len(results)}
+		var samples []time.Duration
+		for _, res := range results {
+			if !okStatus(res.Status) {
+				continue
+			}
+			s.OK++
+			s.InputTokens += res.InputTokens
+			s.OutputTokens += res.OutputTokens
+			samples = append(samples, time.Duration(res.LatencyMs)*time.Millisecond)
+		}
+		if len(samples) > 0 {
+			sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+			var sum time.Duration
+			for _, d := range samples {
+				sum += d
+			}
+			s.LatencyAvgMs = (sum / time.Duration(len(samples))).Milliseconds()
+			s.LatencyP95Ms = percentile(samples, 95).Milliseconds()
+		}
+		out = append(out, s)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].NodeID < out[j].NodeID })
+	return out
+}
+
+// replayBaselineEntry 基线中一条语料的成功样本均值（基线含多个节点时取平均）。
+type replayBaselineEntry struct {
+	latencyMs, input, output int64
+	ok                       bool
+}
+
+func replayBaselineByEntry(baseline ReplayRun) map[string]replayBaselineEntry {
+	sums := make(map[string][4]int64) // latency, input, output, count
+	seen := make(map[string]bool)
+	for _, res := range baseline.Results {
+		seen[res.EntryID] = true
+		if !okStatus(res.Status) {
+			continue
+		}
+		v := sums[res.EntryID]
+		v[0] += res.LatencyMs
+		v[1] += res.InputTokens
+		v[2] += res.OutputTokens
+		v[3]++
+		sums[res.EntryID] = v
+	}
+	out := make(map[string]replayBaselineEntry, len(seen))
+	for id := range seen {
+		v := sums[id]
+		if v[3] == 0 {
+			out[id] = replayBaselineEntry{}
+			continue
+		}
+		out[id] = replayBaselineEntry{latencyMs: v[0] / v[3], input: v[1] / v[3], output: v[2] / v[3], ok: true}
+	}
+	return out
+}
+
+// compareReplay 逐条对比同一语料在本次与基线的耗时和 token，只统计两边都成功的语料；
+// regressions 为基线成功而本次失败的条数。
+func compareReplay(run, baseline ReplayRun) []map[string]interface{} {
+	base := replayBaselineByEntry(baseline)
+	type acc struct {
+		matched, regressions, recovered int
+		latency, baseLatency            int64
+		input, baseInput                int64
+		output, baseOutput              int64
+	}
+	byNode := make(map[string]*acc)
+	for _, res := range run.Results {
+		b, ok := base[res.EntryID]
+		if !ok {
+			continue
+		}
+		a := byNode[res.NodeID]
+		if a == nil {
+			a = &acc{}
+			byNode[res.NodeID] = a
+		}
+		switch {
+		case b.ok && !okStatus(res.Status):
+			a.regressions++
+		case !b.ok && okStatus(res.Status):
+			a.recovered++
+		case b.ok:
+			a.matched++
+			a.latency += res.LatencyMs
+			a.baseLatency += b.latencyMs
+			a.input += res.InputTokens
+			a.baseInput += b.input
+			a.output += res.OutputTokens
+			a.baseOutput += b.output
+		}
+	}
+	out := make([]map[string]interface{}, 0, len(byNode))
+	for id, a := range byNode {
+		v := map[string]interface{}{
+			"node_id":     id,
+			"node_name":   run.Nodes[id],
+			"matched":     a.matched,
+			"regressions": a.regressions,
+			"recovered":   a.recovered,
+		}
+		if a.matched > 0 {
+			n := int64(a.matched)
+			v["latency_avg_ms"] = a.latency / n
+			v["baseline_latency_avg_ms"] = a.baseLatency / n
+			v["latency_delta_ms"] = (a.latency - a.baseLatency) / n
+			if a.baseLatency > 0 {
+				v["latency_ratio"] = float64(a.latency) / float64(a.baseLatency)
+			}
+			v["input_tokens_delta"] = a.input - a.baseInput
+			v["output_tokens_delta"] = a.output - a.baseOutput
+		}
+		out = append(out, v)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i]["node_id"].(string) < out[j]["node_id"].(string) })
+	return out
+}
+
+// replayUsage 提取响应中的 token；SSE 的 input 在 message_start，output 在最后的 message_delta，
+// 因此逐个 usage 对象取最大值。
+func replayUsage(b []byte) (int64, int64) {
+	var in, out int64
+	key := []byte("\"usage\"")
+	start := 0
+	for {
+		idx := bytes.Index(b[start:], key)
+		if idx < 0 {
+			return in, out
+		}
+		// parseUsage 解析切片中最后一个 usage，截到下一个 usage 之前即可逐个解析（含嵌套对象）。
+		cur := start + idx
+		end := len(b)
+		if next := bytes.Index(b[cur+len(key):], key); next >= 0 {
+			end = cur + len(key) + next
+		}
+		i, o := parseUsage(b[:end])
+		in, out = max(in, i), max(out, o)
+		start = cur + len(key)
+	}
+}
+
+// sanitizeReplayBody 校验请求体为 JSON 对象，去掉 metadata（通常带有终端用户标识）并按账号规则脱敏。
+func (p *Server) sanitizeReplayBody(acc *Account, raw []byte) (string, string, error) {
+	var payload map[string]any
+	if err := json.Unmarshal(raw, &payload); err != nil || payload == nil {
+		return "", "", errors.New("body must be a json object")
+	}
+	delete(payload, "metadata")
+	model, _ := payload["model"].(string)
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return "", "", err
+	}
+	p.mu.RLock()
+	rules := acc.rules
+	p.mu.RUnlock()
+	var red *redactor
+	if rules != nil {
+		red = rules.redactor
+	} else {
+		red, _ = newRedactor(AccountPolicy{})
+	}
+	text := red.redact(string(b))
+	if len(text) > maxReplayBodyBytes {
+		return "", "", fmt.Errorf("body exceeds %d bytes", maxReplayBodyBytes)
+	}
+	return text, model, nil
+}
+
+func (p *Server) loadReplaySetting(accountID, key string, v interface{}) {
+	if p.store == nil {
+		return
+	}
+	setting, err := p.store.GetSetting(key, "account", accountID)
+	if err != nil || setting == nil {
+		return
+	}
+	if b, err := json.Marshal(setting.Value); err == nil {
+		_ = json.Unmarshal(b, v)
+	}
+}
+
+func (p *Server) persistReplaySetting(accountID, key string, value interface{}, updatedBy string) error {
+	if p.store == nil {
+		return nil
+	}
+	id := accountID
+	desc := "请求回放语料（已脱敏）"
+	if key == replayRunsSettingKey {
+		desc = "最近的请求回放结果"
+	}
+	setting := &store.Setting{
+		Key:         key,
+		Scope:       "account",
+		AccountID:   &id,
+		Value:       value,
+		DataType:    "array",
+		Category:    "monitoring",
+		Description: &desc,
+	}
+	if updatedBy != "" {
+		setting.UpdatedBy = &updatedBy
+	}
+	return p.store.UpsertSetting(setting)
+}
+
+// loadReplay 读取账号的回放语料与最近回放结果。
+func (p *Server) loadReplay(acc *Account) {
+	p.loadReplaySetting(acc.ID, replayCorpusSettingKey, &acc.ReplayCorpus)
+	p.loadReplaySetting(acc.ID, replayRunsSettingKey, &acc.ReplayRuns)
+}
+
+// replayAccount 解析 account_id（默认调用方账号）并校验权限，失败时已写出响应。
+func (p *Server) replayAccount(w http.ResponseWriter, r *http.Request) (*Account, bool) {
+	caller := accountFromCtx(r)
+	if caller == nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		return nil, false
+	}
+	accountID := chooseNonEmpty(r.URL.Query().Get("account_id"), caller.ID)
+	if !canManageAccount(r.Context(), accountID) {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+		return nil, false
+	}
+	acc := p.getAccountByID(accountID)
+	if acc == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "account not found"})
+		return nil, false
+	}
+	return acc, true
+}
+
+// GET    /api/replay/corpus?account_id=   列出语料
+// POST   /api/replay/corpus               {"name","path","body":{...}} 或 {"request_log_id": 123} 从请求日志采集
+// DELETE /api/replay/corpus/:id
+func (p *Server) handleReplayCorpus(w http.ResponseWriter, r *http.Request) {
+	acc, ok := p.replayAccount(w, r)
+	if !ok {
+		return
+	}
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, strings.TrimSuffix(replayCorpusPrefix, "/")), "/")
+	actor := auditActor(r)
+	switch {
+	case r.Method == http.MethodGet && id == "":
+		p.mu.RLock()
+		list := append([]ReplayEntry(nil), acc.ReplayCorpus...)
+		p.mu.RUnlock()
+		writeJSON(w, http.StatusOK, map[string]interface{}{"account_id": acc.ID, "corpus": list, "count": len(list)})
+	case r.Method == http.MethodPost && id == "":
+		var req struct {
+			Name         string          `json:"name"`
+			Path         string          `json:"path"`
+			Body         json.RawMessage `json:"body"`
+			RequestLogID int64           `json:"request_log_id"`
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 2*maxReplayBodyBytes)).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
+			return
+		}
+		entry := ReplayEntry{
+			ID:         "rp-" + randomToken(6),
+			Name:       strings.TrimSpace(req.Name),
+			Path:       chooseNonEmpty(strings.TrimSpace(req.Path), defaultReplayPath),
+			Source:     "manual",
+			CapturedAt: time.Now().UTC(),
+			CapturedBy: actor,
+		}
+		raw := []byte(req.Body)
+		if req.RequestLogID > 0 {
+			if p.store == nil {
+				writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "store not enabled"})
+				return
+			}
+			rec, err := p.store.GetRequestLog(r.Context(), acc.ID, req.RequestLogID)
+			if err != nil {
+				writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+				return
+			}
+			if rec == nil {
+				writeJSON(w, http.StatusNotFound, map[string]string{"error": "request log not found"})
+				return
+			}
+			if rec.RequestBody == "" || strings.HasSuffix(rec.RequestBody, "...(truncated)") {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "request log has no complete body"})
+				return
+			}
+			raw = []byte(rec.RequestBody)
+			entry.Path = chooseNonEmpty(strings.TrimSpace(req.Path), rec.Path)
+			entry.Source = "request_log:" + strconv.FormatInt(rec.ID, 10)
+		}
+		if !strings.HasPrefix(entry.Path, "/") {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "path must start with /"})
+			return
+		}
+		body, model, err := p.sanitizeReplayBody(acc, raw)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		entry.Body, entry.Model = body, model
+		entry.Name = chooseNonEmpty(entry.Name, entry.ID)
+		p.mu.Lock()
+		if len(acc.ReplayCorpus) >= maxReplayCorpus {
+			p.mu.Unlock()
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("corpus limited to %d entries", maxReplayCorpus)})
+			return
+		}
+		acc.ReplayCorpus = append(append([]ReplayEntry(nil), acc.ReplayCorpus...), entry)
+		list := acc.ReplayCorpus
+		p.mu.Unlock()
+		if err := p.persistReplaySetting(acc.ID, replayCorpusSettingKey, list, actor); err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		p.audit(acc.ID, actor, "replay.corpus.add", entry.ID, map[string]string{"name": entry.Name, "source": entry.Source})
+		writeJSON(w, http.StatusCreated, entry)
+	case r.Method == http.MethodDelete && id != "":
+		p.mu.Lock()
+		list := make([]ReplayEntry, 0, len(acc.ReplayCorpus))
+		for _, e := range acc.ReplayCorpus {
+			if e.ID != id {
+				list = append(list, e)
+			}
+		}
+		found := len(list) != len(acc.ReplayCorpus)
+		if found {
+			acc.ReplayCorpus = list
+		}
+		p.mu.Unlock()
+		if !found {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "corpus entry not found"})
+			return
+		}
+		if err := p.persistReplaySetting(acc.ID, replayCorpusSettingKey, list, actor); err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		p.audit(acc.ID, actor, "replay.corpus.delete", id, nil)
+		writeJSON(w, http.StatusOK, map[string]string{"deleted": id})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// replayOne 将一条语料直接发往节点（不经过路由、重试与故障注入），读取完整响应以得到端到端耗时和 token。
+func (p *Server) replayOne(ctx context.Context, client *http.Client, node Node, entry ReplayEntry) ReplayResult {
+	res := ReplayResult{EntryID: entry.ID, NodeID: node.ID}
+	apiURL := strings.TrimSuffix(node.URL.String(), "/") + entry.Path
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, apiURL, strings.NewReader(entry.Body))
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("anthropic-version", "2023-06-01")
+	applyNodeHeaders(req.Header, node.Headers)
+	req.Header.Set("x-api-key", node.APIKey)
+	req.Header.Set("Authorization", "Bearer "+node.APIKey)
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		res.LatencyMs = time.Since(start).Milliseconds()
+		res.Error = classifyUpstreamError(0, err)
+		return res
+	}
+	b, readErr := io.ReadAll(io.LimitReader(resp.Body, usageBufLimit))
+	_, _ = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	res.LatencyMs = time.Since(start).Milliseconds()
+	res.Status = resp.StatusCode
+	res.InputTokens, res.OutputTokens = replayUsage(b)
+	if readErr != nil {
+		res.Error = readErr.Error()
+	} else if !okStatus(resp.StatusCode) {
+		res.Error = classifyUpstreamError(resp.StatusCode, nil)
+	}
+	return res
+}
+
+func replayRunView(run ReplayRun, baseline *ReplayRun, withResults bool) map[string]interface{} {
+	v := map[string]interface{}{
+		"id":          run.ID,
+		"label":       run.Label,
+		"nodes":       run.Nodes,
+		"baseline_id": run.BaselineID,
+		"summary":     run.summaries(),
+		"started_at":  run.StartedAt,
+		"started_by":  run.StartedBy,
+		"duration_ms": run.DurationMs,
+	}
+	if withResults {
+		v["results"] = run.Results
+	}
+	if baseline != nil {
+		v["comparison"] = compareReplay(run, *baseline)
+	}
+	return v
+}
+
+func findReplayRun(runs []ReplayRun, id string) *ReplayRun {
+	for i := range runs {
+		if runs[i].ID == id {
+			return &runs[i]
+		}
+	}
+	return nil
+}
+
+// GET  /api/replay/runs?account_id=      最近的回放（不含逐条结果）
+// GET  /api/replay/runs/:id[?baseline=]  回放详情，可指定其他基线对比
+// POST /api/replay/runs                  {"node_ids":["..."],"entries":["rp-.."],"baseline_id":"..","label":".."}
+// 回放按语料顺序依次发往每个节点，同一账号同时只允许一个回放。
+func (p *Server) handleReplayRuns(w http.ResponseWriter, r *http.Request) {
+	acc, ok := p.replayAccount(w, r)
+	if !ok {
+		return
+	}
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, strings.TrimSuffix(replayRunsPrefix, "/")), "/")
+	switch {
+	case r.Method == http.MethodGet:
+		p.mu.RLock()
+		runs := append([]ReplayRun(nil), acc.ReplayRuns...)
+		p.mu.RUnlock()
+		if id == "" {
+			items := make([]map[string]interface{}, 0, len(runs))
+			for i := len(runs) - 1; i >= 0; i-- {
+				items = append(items, replayRunView(runs[i], nil, false))
+			}
+			writeJSON(w, http.StatusOK, map[string]interface{}{"account_id": acc.ID, "runs": items, "count": len(items)})
+			return
+		}
+		run := findReplayRun(runs, id)
+		if run == nil {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "replay run not found"})
+			return
+		}
+		baseline := findReplayRun(runs, chooseNonEmpty(r.URL.Query().Get("baseline"), run.BaselineID))
+		writeJSON(w, http.StatusOK, replayRunView(*run, baseline, true))
+	case r.Method == http.MethodPost && id == "":
+		p.startReplayRun(w, r, acc)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (p *Server) startReplayRun(w http.ResponseWriter, r *http.Request, acc *Account) {
+	var req struct {
+		NodeIDs    []string `json:"node_ids"`
+		Entries    []string `json:"entries"`
+		BaselineID string   `json:"baseline_id"`
+		Label      string   `json:"label"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
+		return
+	}
+	req.NodeIDs = trimNonEmpty(req.NodeIDs)
+	if len(req.NodeIDs) == 0 || len(req.NodeIDs) > maxReplayNodes {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("node_ids must contain 1 to %d nodes", maxReplayNodes)})
+		return
+	}
+	p.mu.RLock()
+	nodes := make([]Node, 0, len(req.NodeIDs))
+	var missing string
+	for _, nid := range req.NodeIDs {
+		n, ok := acc.Nodes[nid]
+		if !ok {
+			missing = nid
+			break
+		}
+		nodes = append(nodes, *n)
+	}
+	var entries []ReplayEntry
+	for _, e := range acc.ReplayCorpus {
+		if len(req.Entries) == 0 || containsString(req.Entries, e.ID) {
+			entries = append(entries, e)
+		}
+	}
+	var baseline *ReplayRun
+	if req.BaselineID != "" {
+		baseline = findReplayRun(acc.ReplayRuns, req.BaselineID)
+	}
+	p.mu.RUnlock()
+	switch {
+	case missing != "":
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "node not found: " + missing})
+		return
+	case len(entries) == 0:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "no corpus entries to replay"})
+		return
+	case req.BaselineID != "" && baseline == nil:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "baseline run not found"})
+		return
+	}
+	for _, n := range nodes {
+		if n.APIKey == "" || n.URL == nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "replay requires node api key: " + n.Name})
+			return
+		}
+	}
+	if _, running := p.replays.LoadOrStore(acc.ID, struct{}{}); running {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "replay already running for this account"})
+		return
+	}
+	defer p.replays.Delete(acc.ID)
+
+	actor := auditActor(r)
+	run := ReplayRun{
+		ID:         "run-" + randomToken(6),
+		Label:      strings.TrimSpace(req.Label),
+		Nodes:      make(map[string]string, len(nodes)),
+		BaselineID: req.BaselineID,
+		StartedAt:  time.Now().UTC(),
+		StartedBy:  actor,
+	}
+	client := &http.Client{Transport: p.healthRT, Timeout: benchmarkRequestTimeout}
+	for _, n := range nodes {
+		run.Nodes[n.ID] = n.Name
+		for _, e := range entries {
+			if r.Context().Err() != nil {
+				return
+			}
+			run.Results = append(run.Results, p.replayOne(r.Context(), client, n, e))
+		}
+	}
+	run.DurationMs = time.Since(run.StartedAt).Milliseconds()
+
+	p.mu.Lock()
+	runs := append(append([]ReplayRun(nil), acc.ReplayRuns...), run)
+	if len(runs) > maxReplayRuns {
+		// 被引用为基线的回放同样会被淘汰，需要长期对比时应定期重新生成基线。
+		runs = runs[len(runs)-maxReplayRuns:]
+	}
+	acc.ReplayRuns = runs
+	p.mu.Unlock()
+	if err := p.persistReplaySetting(acc.ID, replayRunsSettingKey, runs, actor); err != nil {
+		p.logger.Printf("persist replay runs for account %s failed: %v", acc.ID, err)
+	}
+	p.audit(acc.ID, actor, "replay.run", run.ID, map[string]interface{}{
+		"nodes":    req.NodeIDs,
+		"entries":  len(entries),
+		"baseline": req.BaselineID,
+	})
+	writeJSON(w, http.StatusOK, replayRunView(run, baseline, true))
+}
@@ -0,0 +1,102 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const defaultMaxRequestBytes = 32 << 20 // 与 Anthropic Messages API 的请求体上限一致
+
+// maxRequestBytes 返回账号的请求体字节上限：账号策略优先，否则取系统配置 proxy.max_request_bytes，0 表示不限制。
+func (p *Server) maxRequestBytes(acc *Account) int64 {
+	if limit := p.accountPolicy(acc).MaxRequestBytes; limit > 0 {
+		return limit
+	}
+	if p.settingsCache == nil {
+		return defaultMaxRequestBytes
+	}
+	if n := p.settingsCache.GetInt("proxy.max_request_bytes", defaultMaxRequestBytes); n > 0 {
+		return int64(n)
+	}
+	return 0
+}
+
+func (p *Server) validateRequestJSON() bool {
+	return p.settingsCache == nil || p.settingsCache.GetBool("proxy.validate_json", true)
+}
+
+// applyRequestLimits 在转发前检查请求体大小与 JSON 格式，避免明显无效的请求占用上游尝试；
+// 请求被拒绝时已写出响应并返回 true。需在其他读取请求体的预检之前调用。
+func (p *Server) applyRequestLimits(w http.ResponseWriter, r *http.Request, acc *Account) bool {
+	limit := p.maxRequestBytes(acc)
+	if limit > 0 && r.ContentLength > limit {
+		p.rejectLargeRequest(w, r, acc, r.ContentLength, limit)
+		return true
+	}
+	if r.Body == nil || r.Body == http.NoBody {
+		return false
+	}
+	var body []byte
+	var err error
+	if limit > 0 {
+		// 未声明长度（分块传输）时最多多读 1 字节判断是否超限。
+		body, err = io.ReadAll(io.LimitReader(r.Body, limit+1))
+		if err == nil && int64(len(body)) > limit {
+			_ = r.Body.Close()
+			p.rejectLargeRequest(w, r, acc, -1, limit)
+			return true
+		}
+		_ = r.Body.Close()
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	} else {
+		body, err = peekBody(r)
+	}
+	if err != nil {
+		writeProxyError(w, http.StatusBadRequest, "invalid_request_body", "failed to read request body", nil)
+		return true
+	}
+
+	if r.Method != http.MethodPost || !p.validateRequestJSON() ||
+		!strings.Contains(strings.ToLower(r.Header.Get("Content-Type")), "json") {
+		return false
+	}
+	if msg := checkRequestJSON(body); msg != "" {
+		p.logger.Printf("reject malformed json %s %s (account=%s): %s", r.Method, r.URL.Path, acc.ID, msg)
+		writeProxyError(w, http.StatusBadRequest, "invalid_request_error", msg, nil)
+		return true
+	}
+	return false
+}
+
+func (p *Server) rejectLargeRequest(w http.ResponseWriter, r *http.Request, acc *Account, size, limit int64) {
+	p.logger.Printf("reject oversized request %s %s (account=%s, limit=%d)", r.Method, r.URL.Path, acc.ID, limit)
+	extra := map[string]any{"limit_bytes": limit}
+	if size >= 0 {
+		extra["size_bytes"] = size
+	}
+	writeProxyError(w, http.StatusRequestEntityTooLarge, "request_too_large",
+		fmt.Sprintf("request body exceeds the limit of %d bytes for this key", limit), extra)
+}
+
+// checkRequestJSON 返回请求体的格式问题描述，合法的 JSON 对象返回空字符串。
+func checkRequestJSON(body []byte) string {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) == 0 {
+		return "request body is empty"
+	}
+	if !json.Valid(trimmed) {
+		var v any
+		if err := json.Unmarshal(trimmed, &v); err != nil {
+			return "request body is not valid JSON: " + err.Error()
+		}
+		return "request body is not valid JSON"
+	}
+	if trimmed[0] != '{' {
+		return "request body must be a JSON object"
+	}
+	return ""
+}
@@ -0,0 +1,327 @@
+package proxy
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"qcc_plus/internal/store"
+)
+
+// logSampleRand 用于请求日志按比例采样，测试中可替换。
+var logSampleRand = rand.Float64
+
+// requestLogQueueSize 待写入请求日志的队列容量，数据库变慢时超出部分直接丢弃。
+const requestLogQueueSize = 4096
+
+// requestLogSampling 请求日志采样设置，均为百分比；SlowMs 为 0 表示不按耗时强制记录。
+type requestLogSampling struct {
+	ErrorPct   int
+	SuccessPct int
+	SlowMs     int64
+}
+
+// requestLogSamplingSettings 从 SettingsCache 读取采样设置，每次请求读取以支持热更新。
+func (p *Server) requestLogSamplingSettings() requestLogSampling {
+	cfg := requestLogSampling{ErrorPct: 100, SuccessPct: 100}
+	if p.settingsCache == nil {
+		return cfg
+	}
+	cfg.ErrorPct = clampPct(p.settingsCache.GetInt("request_log.sample.error_pct", cfg.ErrorPct))
+	cfg.SuccessPct = clampPct(p.settingsCache.GetInt("request_log.sample.success_pct", cfg.SuccessPct))
+	cfg.SlowMs = int64(p.settingsCache.GetInt("request_log.sample.slow_ms", 0))
+	return cfg
+}
+
+// shouldLogRequest 慢请求总是记录；错误与成功请求分别按比例采样。
+func (cfg requestLogSampling) shouldLogRequest(rec store.RequestLogRecord) bool {
+	if cfg.SlowMs > 0 && rec.DurationMs >= cfg.SlowMs {
+		return true
+	}
+	pct := cfg.SuccessPct
+	if rec.Status >= http.StatusBadRequest || rec.ErrorClass != "" {
+		pct = cfg.ErrorPct
+	}
+	switch {
+	case pct >= 100:
+		return true
+	case pct <= 0:
+		return false
+	default:
+		return logSampleRand()*100 < float64(pct)
+	}
+}
+
+func clampPct(v int) int {
+	if v < 0 {
+		return 0
+	}
+	if v > 100 {
+		return 100
+	}
+	return v
+}
+
+// requestLogSink 由单个后台协程顺序写入请求日志：队列有界，已满时丢弃并计数，
+// 避免数据库变慢时每个请求堆积一个写库协程。
+type requestLogSink struct {
+	mu    sync.Mutex
+	queue chan store.RequestLogRecord
+	stop  chan struct{}
+	wg    sync.WaitGroup
+
+	written atomic.Int64
+	dropped atomic.Int64
+	failed  atomic.Int64
+}
+
+// logRequest 按采样设置异步写入请求日志。
+func (p *Server) logRequest(rec store.RequestLogRecord) {
+	if p == nil || p.store == nil {
+		return
+	}
+	if !p.requestLogSamplingSettings().shouldLogRequest(rec) {
+		return
+	}
+	p.requestLogs.enqueue(p, rec)
+}
+
+func (s *requestLogSink) enqueue(p *Server, rec store.RequestLogRecord) {
+	s.mu.Lock()
+	if s.queue == nil {
+		s.queue = make(chan store.RequestLogRecord, requestLogQueueSize)
+		s.stop = make(chan struct{})
+		s.wg.Add(1)
+		go s.run(p, s.stop)
+	}
+	s.mu.Unlock()
+	select {
+	case s.queue <- rec:
+	default:
+		if s.dropped.Add(1)%1000 == 1 && p.logger != nil {
+			p.logger.Printf("request log queue full, dropped %d records so far", s.dropped.Load())
+		}
+	}
+}
+
+func (s *requestLogSink) run(p *Server, stop <-chan struct{}) {
+	defer s.wg.Done()
+	for {
+		select {
+		case <-stop:
+			s.drain(p)
+			return
+		case rec := <-s.queue:
+			ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+			s.write(ctx, p, rec)
+			cancel()
+		}
+	}
+}
+
+// drain 关闭前尽量写完已入队的记录，整体限时避免数据库不可用时阻塞关闭。
+func (s *requestLogSink) drain(p *Server) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	for {
+		select {
+		case rec := <-s.queue:
+			s.write(ctx, p, rec)
+		default:
+			return
+		}
+	}
+}
+
+func (s *requestLogSink) write(ctx context.Context, p *Server, rec store.RequestLogRecord) {
+	if err := p.store.InsertRequestLog(ctx, rec); err != nil {
+		s.failed.Add(1)
+		if p.logger != nil {
+			p.logger.Printf("insert request log failed: %v", err)
+		}
+		return
+	}
+	s.written.Add(1)
+}
+
+func (s *requestLogSink) close() {
+	s.mu.Lock()
+	stop := s.stop
+	s.stop = nil
+	s.mu.Unlock()
+	if stop != nil {
+		close(stop)
+		s.wg.Wait()
+	}
+}
+
+// requestTimings 拆分请求耗时：排队（收到请求到转发上游）、首字节与流式输出时长（毫秒）。
+func requestTimings(received, start time.Time, mw *metricsWriter) (queue, ttft, stream int64) {
+	queue = start.Sub(received).Milliseconds()
+	if mw == nil || !mw.firstWrite {
+		return queue, 0, 0
+	}
+	return queue, mw.firstAt.Sub(start).Milliseconds(), mw.lastAt.Sub(mw.firstAt).Milliseconds()
+}
+
+// GET /api/request-logs?account_id=&node_id=&label=&error_class=&from=&to=&limit=&offset=
+func (p *Server) handleRequestLogs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if p.store == nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "store not enabled"})
+		return
+	}
+	caller := accountFromCtx(r)
+	if caller == nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		return
+	}
+	q := r.URL.Query()
+	query := store.RequestLogQuery{
+		AccountID:  q.Get("account_id"),
+		NodeID:     q.Get("node_id"),
+		Label:      q.Get("label"),
+		ErrorClass: q.Get("error_class"),
+	}
+	if !isAdmin(r.Context()) {
+		if query.AccountID != "" && query.AccountID != caller.ID {
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+			return
+		}
+		query.AccountID = caller.ID
+	}
+	if v := q.Get("from"); v != "" {
+		t, err := parseTime(v)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid from"})
+			return
+		}
+		query.From = t
+	}
+	if v := q.Get("to"); v != "" {
+		t, err := parseTime(v)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid to"})
+			return
+		}
+		query.To = t
+	}
+	if v := q.Get("limit"); v != "" {
+		query.Limit, _ = strconv.Atoi(v)
+	}
+	if v := q.Get("offset"); v != "" {
+		query.Offset, _ = strconv.Atoi(v)
+	}
+
+	records, err := p.store.ListRequestLogs(r.Context(), query)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	f := p.displayFormat(w, r, caller)
+	items := make([]map[string]interface{}, 0, len(records))
+	for _, rec := range records {
+		item := requestLogView(rec, f)
+		item["request_body"] = rec.RequestBody
+		items = append(items, item)
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"logs": items, "count": len(items)})
+}
+
+func requestLogView(rec store.RequestLogRecord, f displayFormat) map[string]interface{} {
+	return map[string]interface{}{
+		"id":            rec.ID,
+		"account_id":    rec.AccountID,
+		"node_id":       rec.NodeID,
+		"node_name":     rec.NodeName,
+		"model":         rec.Model,
+		"method":        rec.Method,
+		"path":          rec.Path,
+		"status":        rec.Status,
+		"duration_ms":   rec.DurationMs,
+		"queue_ms":      rec.QueueMs,
+		"ttft_ms":       rec.TTFTMs,
+		"stream_ms":     rec.StreamMs,
+		"input_tokens":  rec.InputTokens,
+		"output_tokens": rec.OutputTokens,
+		"node_override": rec.NodeOverride,
+		"label":         rec.Label,
+		"error_class":   rec.ErrorClass,
+		"created_at":    f.time(rec.CreatedAt),
+	}
+}
+
+// GET /api/requests/slowest?account_id=&node_id=&from=&to=&limit=
+// 默认统计最近 24 小时，返回耗时最长的请求及其耗时拆分。
+func (p *Server) handleSlowestRequests(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if p.store == nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "store not enabled"})
+		return
+	}
+	caller := accountFromCtx(r)
+	if caller == nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		return
+	}
+	q := r.URL.Query()
+	query := store.RequestLogQuery{AccountID: q.Get("account_id"), NodeID: q.Get("node_id"), Limit: 20}
+	if !isAdmin(r.Context()) {
+		if query.AccountID != "" && query.AccountID != caller.ID {
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+			return
+		}
+		query.AccountID = caller.ID
+	}
+	query.To = time.Now()
+	if v := q.Get("to"); v != "" {
+		t, err := parseTime(v)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid to"})
+			return
+		}
+		query.To = t
+	}
+	query.From = query.To.Add(-24 * time.Hour)
+	if v := q.Get("from"); v != "" {
+		t, err := parseTime(v)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid from"})
+			return
+		}
+		query.From = t
+	}
+	if !query.From.Before(query.To) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "from must be before to"})
+		return
+	}
+	if n, err := strconv.Atoi(q.Get("limit")); err == nil && n > 0 && n <= 500 {
+		query.Limit = n
+	}
+
+	records, err := p.store.ListSlowestRequestLogs(r.Context(), query)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	f := p.displayFormat(w, r, caller)
+	items := make([]map[string]interface{}, 0, len(records))
+	for _, rec := range records {
+		items = append(items, requestLogView(rec, f))
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"requests": items,
+		"from":     f.time(query.From),
+		"to":       f.time(query.To),
+	})
+}
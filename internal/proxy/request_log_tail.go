@@ -0,0 +1,217 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"qcc_plus/internal/store"
+	"qcc_plus/internal/timeutil"
+)
+
+// wsTopicRequestLog 请求日志实时流，客户端需显式订阅。
+const wsTopicRequestLog = "request_log"
+
+const maxTailConditions = 8
+
+// tailOps 按匹配优先级排列，双字符运算符在前。
+var tailOps = []string{">=", "<=", "!=", "=", ">", "<", "~"}
+
+// tailFields 可用于过滤的字段；数值字段支持比较运算符。
+var tailFields = map[string]bool{
+	"node": false, "account": false, "path": false, "model": false, "label": false,
+	"error_class": false, "method": false, "status": true, "duration_ms": true,
+}
+
+// requestLogEvent 推送给订阅者的请求摘要（不含请求体）。
+type requestLogEvent struct {
+	AccountID    string `json:"account_id"`
+	NodeID       string `json:"node_id"`
+	NodeName     string `json:"node_name"`
+	Model        string `json:"model"`
+	Method       string `json:"method"`
+	Path         string `json:"path"`
+	Status       int    `json:"status"`
+	DurationMs   int64  `json:"duration_ms"`
+	TTFTMs       int64  `json:"ttft_ms"`
+	InputTokens  int64  `json:"input_tokens"`
+	OutputTokens int64  `json:"output_tokens"`
+	Label        string `json:"label,omitempty"`
+	ErrorClass   string `json:"error_class,omitempty"`
+	CreatedAt    string `json:"created_at"`
+}
+
+type tailCond struct {
+	field string
+	op    string
+	value string
+	num   float64
+}
+
+// tailFilter 由空格或逗号分隔的条件组成，全部满足才推送，例如 "node=primary status>=500"。
+type tailFilter struct {
+	expr  string
+	conds []tailCond
+}
+
+// tailSubscription 客户端的请求日志订阅；allAccounts 仅管理员可用。
+type tailSubscription struct {
+	filter      *tailFilter
+	allAccounts bool
+}
+
+func parseTailFilter(expr string) (*tailFilter, error) {
+	f := &tailFilter{expr: strings.TrimSpace(expr)}
+	terms := strings.FieldsFunc(f.expr, func(r rune) bool { return r == ' ' || r == ',' })
+	for _, term := range terms {
+		if term == "&&" || strings.EqualFold(term, "and") {
+			continue
+		}
+		var cond tailCond
+		for _, op := range tailOps {
+			if i := strings.Index(term, op); i > 0 {
+				cond = tailCond{field: strings.ToLower(term[:i]), op: op, value: term[i+len(op):]}
+				break
+			}
+		}
+		numeric, ok := tailFields[cond.field]
+		if cond.op == "" || !ok {
+			return nil, fmt.Errorf("invalid filter term %q", term)
+		}
+		if numeric {
+			n, err := strconv.ParseFloat(cond.value, 64)
+			if err != nil || cond.op == "~" {
+				return nil, fmt.Errorf("invalid numeric filter %q", term)
+			}
+			cond.num = n
+		} else if cond.op != "=" && cond.op != "!=" && cond.op != "~" {
+			return nil, fmt.Errorf("operator %s not supported for %s", cond.op, cond.field)
+		}
+		f.conds = append(f.conds, cond)
+		if len(f.conds) > maxTailConditions {
+			return nil, errors.New("too many filter conditions")
+		}
+	}
+	return f, nil
+}
+
+func (f *tailFilter) match(ev requestLogEvent) bool {
+	if f == nil {
+		return true
+	}
+	for _, c := range f.conds {
+		if !c.match(ev) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c tailCond) match(ev requestLogEvent) bool {
+	switch c.field {
+	case "status":
+		return compareNum(float64(ev.Status), c.op, c.num)
+	case "duration_ms":
+		return compareNum(float64(ev.DurationMs), c.op, c.num)
+	case "node":
+		// 节点可按名称或 ID 匹配
+		if c.op == "!=" {
+			return ev.NodeName != c.value && ev.NodeID != c.value
+		}
+		return compareStr(ev.NodeName, c.op, c.value) || compareStr(ev.NodeID, c.op, c.value)
+	}
+	var v string
+	switch c.field {
+	case "account":
+		v = ev.AccountID
+	case "path":
+		v = ev.Path
+	case "model":
+		v = ev.Model
+	case "label":
+		v = ev.Label
+	case "error_class":
+		v = ev.ErrorClass
+	case "method":
+		v = ev.Method
+	}
+	return compareStr(v, c.op, c.value)
+}
+
+func compareNum(v float64, op string, want float64) bool {
+	switch op {
+	case ">=":
+		return v >= want
+	case "<=":
+		return v <= want
+	case ">":
+		return v > want
+	case "<":
+		return v < want
+	case "!=":
+		return v != want
+	default:
+		return v == want
+	}
+}
+
+func compareStr(v, op, want string) bool {
+	switch op {
+	case "~":
+		return strings.Contains(strings.ToLower(v), strings.ToLower(want))
+	case "!=":
+		return !strings.EqualFold(v, want)
+	default:
+		return strings.EqualFold(v, want)
+	}
+}
+
+// handleTailCommand 处理请求日志的订阅与退订。
+func (c *WSClient) handleTailCommand(cmd wsCommand) {
+	switch cmd.Action {
+	case "subscribe":
+		if c.isShare {
+			c.reply("error", map[string]string{"error": "request_log not available via share link"})
+			return
+		}
+		all := cmd.Scope == "all"
+		if all && !c.isAdmin {
+			c.reply("error", map[string]string{"error": "scope all requires admin"})
+			return
+		}
+		filter, err := parseTailFilter(cmd.Filter)
+		if err != nil {
+			c.reply("error", map[string]string{"error": err.Error()})
+			return
+		}
+		c.hub.setTail(c, &tailSubscription{filter: filter, allAccounts: all})
+		c.reply("subscribed", map[string]interface{}{"topic": wsTopicRequestLog, "filter": filter.expr, "all_accounts": all})
+	case "unsubscribe":
+		c.hub.setTail(c, nil)
+		c.reply("unsubscribed", map[string]string{"topic": wsTopicRequestLog})
+	}
+}
+
+// publishRequestLog 向订阅者推送请求摘要；无订阅者时不做任何处理。
+func (p *Server) publishRequestLog(rec store.RequestLogRecord) {
+	if p.wsHub == nil || !p.wsHub.hasTailSubscribers() {
+		return
+	}
+	p.wsHub.Broadcast(rec.AccountID, wsTopicRequestLog, requestLogEvent{
+		AccountID:    rec.AccountID,
+		NodeID:       rec.NodeID,
+		NodeName:     rec.NodeName,
+		Model:        rec.Model,
+		Method:       rec.Method,
+		Path:         rec.Path,
+		Status:       rec.Status,
+		DurationMs:   rec.DurationMs,
+		TTFTMs:       rec.TTFTMs,
+		InputTokens:  rec.InputTokens,
+		OutputTokens: rec.OutputTokens,
+		Label:        rec.Label,
+		ErrorClass:   rec.ErrorClass,
+		CreatedAt:    timeutil.FormatBeijingTime(rec.CreatedAt),
+	})
+}
@@ -0,0 +1,286 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"qcc_plus/internal/store"
+)
+
+const (
+	retentionSettingKey = "retention.policy"
+	maxRetentionDays    = 3650
+)
+
+// retentionFields 保留策略中可配置的数据类型，配置值以天为单位，0 表示不自动清理。
+var retentionFields = []struct {
+	key   string
+	field func(*store.RetentionPolicy) *time.Duration
+}{
+	{"raw_metrics", func(p *store.RetentionPolicy) *time.Duration { return &p.RawMetrics }},
+	{"hourly_metrics", func(p *store.RetentionPolicy) *time.Duration { return &p.HourlyMetrics }},
+	{"daily_metrics", func(p *store.RetentionPolicy) *time.Duration { return &p.DailyMetrics }},
+	{"health_checks", func(p *store.RetentionPolicy) *time.Duration { return &p.HealthChecks }},
+	{"request_logs", func(p *store.RetentionPolicy) *time.Duration { return &p.RequestLogs }},
+	{"audit_logs", func(p *store.RetentionPolicy) *time.Duration { return &p.AuditLogs }},
+}
+
+// retentionDays 将保留策略转换为按天表示的配置值。
+func retentionDays(policy store.RetentionPolicy) map[string]int {
+	days := make(map[string]int, len(retentionFields))
+	for _, f := range retentionFields {
+		days[f.key] = int(*f.field(&policy) / (24 * time.Hour))
+	}
+	return days
+}
+
+// withRetentionDays 返回覆盖了 days 中各项的策略副本。
+func withRetentionDays(policy store.RetentionPolicy, days map[string]int) store.RetentionPolicy {
+	for _, f := range retentionFields {
+		if d, ok := days[f.key]; ok {
+			*f.field(&policy) = time.Duration(d) * 24 * time.Hour
+		}
+	}
+	return policy
+}
+
+func validateRetentionDays(days map[string]int) error {
+	for key, d := range days {
+		known := false
+		for _, f := range retentionFields {
+			if f.key == key {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return fmt.Errorf("unknown data type: %s", key)
+		}
+		if d < 0 || d > maxRetentionDays {
+			return fmt.Errorf("%s must be between 0 and %d days", key, maxRetentionDays)
+		}
+	}
+	return nil
+}
+
+func settingRetentionDays(setting *store.Setting) map[string]int {
+	days := map[string]int{}
+	if setting == nil {
+		return days
+	}
+	if b, err := json.Marshal(setting.Value); err == nil {
+		_ = json.Unmarshal(b, &days)
+	}
+	return days
+}
+
+// retentionPlan 系统保留策略及有账号级覆盖的账号策略（覆盖项按天保存）。
+type retentionPlan struct {
+	system    store.RetentionPolicy
+	overrides map[string]map[string]int
+}
+
+// loadRetentionPlan 读取系统与账号级保留策略，未配置的项使用默认值。
+func loadRetentionPlan(st *store.Store) (retentionPlan, error) {
+	plan := retentionPlan{system: store.DefaultRetentionPolicy(), overrides: map[string]map[string]int{}}
+	if st == nil {
+		return plan, nil
+	}
+	setting, err := st.GetSetting(retentionSettingKey, "system", "")
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		return plan, err
+	}
+	if err == nil {
+		plan.system = withRetentionDays(plan.system, settingRetentionDays(setting))
+	}
+	settings, err := st.ListSettings("account", "performance", "")
+	if err != nil {
+		return plan, err
+	}
+	for i := range settings {
+		s := &settings[i]
+		if s.Key == retentionSettingKey && s.AccountID != nil {
+			plan.overrides[*s.AccountID] = settingRetentionDays(s)
+		}
+	}
+	return plan, nil
+}
+
+// policyFor 返回账号的生效策略：账号级覆盖项优先，其余沿用系统策略。
+func (plan retentionPlan) policyFor(accountID string) store.RetentionPolicy {
+	return withRetentionDays(plan.system, plan.overrides[accountID])
+}
+
+// runRetentionCleanup 按保留策略清理各类数据，返回各表删除（dryRun 时为将删除）的行数；
+// accountID 为空时先清理无覆盖的账号，再逐个清理有覆盖的账号。
+func runRetentionCleanup(ctx context.Context, st *store.Store, plan retentionPlan, accountID string, dryRun bool, now time.Time) (map[string]int64, error) {
+	type target struct {
+		scope  store.CleanupScope
+		policy store.RetentionPolicy
+	}
+	var targets []target
+	if accountID != "" {
+		targets = append(targets, target{store.CleanupScope{AccountID: accountID, DryRun: dryRun}, plan.policyFor(accountID)})
+	} else {
+		exclude := make([]string, 0, len(plan.overrides))
+		for id := range plan.overrides {
+			exclude = append(exclude, id)
+		}
+		sort.Strings(exclude)
+		targets = append(targets, target{store.CleanupScope{Exclude: exclude, DryRun: dryRun}, plan.system})
+		for _, id := range exclude {
+			targets = append(targets, target{store.CleanupScope{AccountID: id, DryRun: dryRun}, plan.policyFor(id)})
+		}
+	}
+	deleted := make(map[string]int64)
+	for _, t := range targets {
+		counts, err := st.CleanupMetrics(ctx, t.scope, t.policy, now)
+		for table, n := range counts {
+			deleted[table] += n
+		}
+		if err != nil {
+			return deleted, fmt.Errorf("metrics: %w", err)
+		}
+		n, err := st.CleanupHealthChecks(ctx, t.scope, t.policy.HealthChecks, now)
+		deleted["health_check_history"] += n
+		if err != nil {
+			return deleted, fmt.Errorf("health checks: %w", err)
+		}
+		n, err = st.CleanupRequestLogs(ctx, t.scope, t.policy.RequestLogs, now)
+		deleted["request_logs"] += n
+		if err != nil {
+			return deleted, fmt.Errorf("request logs: %w", err)
+		}
+		n, err = st.CleanupAuditLogs(ctx, t.scope, t.policy.AuditLogs, now)
+		deleted["audit_logs"] += n
+		if err != nil {
+			return deleted, fmt.Errorf("audit logs: %w", err)
+		}
+	}
+	return deleted, nil
+}
+
+// GET/PUT/DELETE /api/admin/retention?account_id=
+// 不传 account_id 时读取或修改系统策略；PUT 只修改请求体中出现的数据类型。
+func (p *Server) handleAdminRetention(w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(r.Context()) {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+		return
+	}
+	if p.store == nil {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "store not enabled"})
+		return
+	}
+	accountID := r.URL.Query().Get("account_id")
+	if accountID != "" && p.getAccountByID(accountID) == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "account not found"})
+		return
+	}
+	plan, err := loadRetentionPlan(p.store)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		if accountID != "" {
+			writeJSON(w, http.StatusOK, p.retentionAccountView(plan, accountID))
+			return
+		}
+		accounts := make([]map[string]interface{}, 0, len(plan.overrides))
+		for id := range plan.overrides {
+			accounts = append(accounts, p.retentionAccountView(plan, id))
+		}
+		sort.Slice(accounts, func(i, j int) bool {
+			return accounts[i]["account_id"].(string) < accounts[j]["account_id"].(string)
+		})
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"system":   retentionDays(plan.system),
+			"defaults": retentionDays(store.DefaultRetentionPolicy()),
+			"accounts": accounts,
+		})
+	case http.MethodPut:
+		var days map[string]int
+		if err := json.NewDecoder(r.Body).Decode(&days); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
+			return
+		}
+		if err := validateRetentionDays(days); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		value := retentionDays(withRetentionDays(plan.system, days))
+		if accountID != "" {
+			value = plan.overrides[accountID]
+			if value == nil {
+				value = map[string]int{}
+			}
+			for k, d := range days {
+				value[k] = d
+			}
+		}
+		if err := p.saveRetention(accountID, value, auditActor(r)); err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		p.audit(chooseNonEmpty(accountID, store.DefaultAccountID), auditActor(r), "retention.update", chooseNonEmpty(accountID, "system"), days)
+		if accountID != "" {
+			plan.overrides[accountID] = value
+			writeJSON(w, http.StatusOK, p.retentionAccountView(plan, accountID))
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"system": value})
+	case http.MethodDelete:
+		if accountID == "" {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "account_id required"})
+			return
+		}
+		if err := p.store.DeleteSetting(retentionSettingKey, "account", accountID); err != nil && !errors.Is(err, store.ErrNotFound) {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		p.audit(accountID, auditActor(r), "retention.reset", accountID, nil)
+		delete(plan.overrides, accountID)
+		writeJSON(w, http.StatusOK, p.retentionAccountView(plan, accountID))
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (p *Server) retentionAccountView(plan retentionPlan, accountID string) map[string]interface{} {
+	overrides := plan.overrides[accountID]
+	if overrides == nil {
+		overrides = map[string]int{}
+	}
+	return map[string]interface{}{
+		"account_id": accountID,
+		"overrides":  overrides,
+		"effective":  retentionDays(plan.policyFor(accountID)),
+	}
+}
+
+// saveRetention 保存系统或账号级保留策略（按天）。
+func (p *Server) saveRetention(accountID string, days map[string]int, updatedBy string) error {
+	desc := "数据保留天数（0 为不自动清理）"
+	setting := &store.Setting{
+		Key:         retentionSettingKey,
+		Scope:       "system",
+		Value:       days,
+		DataType:    "object",
+		Category:    "performance",
+		Description: &desc,
+	}
+	if accountID != "" {
+		setting.Scope = "account"
+		setting.AccountID = &accountID
+	}
+	if updatedBy != "" {
+		setting.UpdatedBy = &updatedBy
+	}
+	return p.store.UpsertSetting(setting)
+}
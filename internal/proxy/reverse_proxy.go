@@ -2,6 +2,7 @@ package proxy
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/json"
 	"errors"
@@ -10,6 +11,7 @@ import (
 	"log"
 	"net/http"
 	"net/http/httputil"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
@@ -22,6 +24,7 @@ type retryTransport struct {
 	attempts  int
 	logger    *log.Logger
 	notifyMgr *notify.Manager
+	annotate  func(notify.Event, *url.URL) notify.Event // 标注节点所属服务商的上游事件，可为空
 }
 
 func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
@@ -79,17 +82,23 @@ func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
 	if t.notifyMgr != nil && lastErr != nil {
 		if acc := accountFromCtx(req); acc != nil {
 			nodeName := ""
+			var nodeURL *url.URL
 			if n := nodeFromCtx(req); n != nil {
-				nodeName = n.Name
+				nodeName, nodeURL = n.Name, n.URL
 			}
 			errText := lastErr.Error()
-			t.notifyMgr.Publish(notify.Event{
+			evt := notify.Event{
 				AccountID:  acc.ID,
 				EventType:  notify.EventRequestFailed,
 				Title:      "请求失败告警",
 				Content:    fmt.Sprintf("**请求**: %s %s\n**节点**: %s\n**重试次数**: %d\n**错误信息**: %s", req.Method, req.URL.String(), chooseNonEmpty(nodeName, "-"), attempts, errText),
+				Node:       nodeName,
 				OccurredAt: time.Now(),
-			})
+			}
+			if t.annotate != nil {
+				evt = t.annotate(evt, nodeURL)
+			}
+			t.notifyMgr.Publish(evt)
 		}
 	}
 	if lastResp != nil {
@@ -127,11 +136,45 @@ func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
 // usageReader 在转发时截取部分响应体，用于提取 usage。
 type usageReader struct {
 	io.ReadCloser
-	buf     *bytes.Buffer
-	tracker *usage
+	buf      *bytes.Buffer
+	tracker  *usage
+	encoding string // 上游 Content-Encoding，透传时需解压后再解析
+
+	sse      bool   // text/event-stream 响应，需检查流完整性
+	tail     []byte // 上次读取的末尾片段，避免标记跨块被截断
+	sawEnd   bool   // 出现 message_stop 或 [DONE]
+	sawError bool   // 出现 event: error
+	readErr  bool   // 读取上游时出现非 EOF 错误
 }
 
-const usageBufLimit = 256 * 1024 // 256KB 足够找到 usage 字段
+const (
+	usageBufLimit = 256 * 1024 // 256KB 足够找到 usage 字段
+	sseTailLen    = 32         // 跨块匹配流结束/错误标记需保留的字节数
+)
+
+// scanSSE 检查流中的结束与错误事件，并保留末尾片段处理跨块的标记。
+func (u *usageReader) scanSSE(chunk []byte) {
+	boundary := append(u.tail, chunk[:min(len(chunk), sseTailLen)]...)
+	u.markSSE(boundary)
+	u.markSSE(chunk)
+	if len(chunk) >= sseTailLen {
+		u.tail = append(u.tail[:0], chunk[len(chunk)-sseTailLen:]...)
+		return
+	}
+	if len(boundary) > sseTailLen {
+		boundary = boundary[len(boundary)-sseTailLen:]
+	}
+	u.tail = append([]byte(nil), boundary...)
+}
+
+func (u *usageReader) markSSE(b []byte) {
+	if bytes.Contains(b, []byte("message_stop")) || bytes.Contains(b, []byte("[DONE]")) {
+		u.sawEnd = true
+	}
+	if bytes.Contains(b, []byte("event: error")) {
+		u.sawError = true
+	}
+}
 
 func (u *usageReader) Read(p []byte) (int, error) {
 	n, err := u.ReadCloser.Read(p)
@@ -146,13 +189,29 @@ func (u *usageReader) Read(p []byte) (int, error) {
 			u.buf.Write(slice)
 		}
 	}
+	if u.sse {
+		if n > 0 && encodingIdentity(u.encoding) {
+			u.scanSSE(p[:n])
+		}
+		if err != nil && err != io.EOF {
+			u.readErr = true
+		}
+	}
 	return n, err
 }
 
+func encodingIdentity(encoding string) bool {
+	e := strings.TrimSpace(encoding)
+	return e == "" || strings.EqualFold(e, "identity")
+}
+
 func (u *usageReader) Close() error {
 	err := u.ReadCloser.Close()
+	if u.tracker != nil && u.sse && (u.readErr || u.sawError || (!u.sawEnd && encodingIdentity(u.encoding))) {
+		u.tracker.streamBroken = true
+	}
 	if u.tracker != nil && u.buf != nil {
-		if in, out := parseUsage(u.buf.Bytes()); in > 0 || out > 0 {
+		if in, out := parseUsage(decodeForUsage(u.buf.Bytes(), u.encoding)); in > 0 || out > 0 {
 			u.tracker.input = in
 			u.tracker.output = out
 		}
@@ -160,6 +219,21 @@ func (u *usageReader) Close() error {
 	return err
 }
 
+// decodeForUsage 解压透传的 gzip 响应片段，仅用于 usage 解析，不影响转发内容。
+func decodeForUsage(b []byte, encoding string) []byte {
+	if !strings.EqualFold(strings.TrimSpace(encoding), "gzip") || len(b) == 0 {
+		return b
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return b
+	}
+	defer zr.Close()
+	// 截断的片段会返回 ErrUnexpectedEOF，已解出的部分仍可用于解析。
+	decoded, _ := io.ReadAll(io.LimitReader(zr, usageBufLimit*4))
+	return decoded
+}
+
 // 构建指向指定节点的反向代理。
 func (p *Server) newReverseProxy(node *Node, u *usage) *httputil.ReverseProxy {
 	proxy := httputil.NewSingleHostReverseProxy(node.URL)
@@ -229,10 +303,55 @@ func (p *Server) newReverseProxy(node *Node, u *usage) *httputil.ReverseProxy {
 		if outputTokens > 0 {
 			resp.Header.Set("X-Usage-Output-Tokens", fmt.Sprintf("%d", outputTokens))
 		}
-		resp.Header.Set("X-Proxy-Node", node.Name)
+		servedBy := node.Name
+		if v := resp.Header.Get(hedgeNodeHeader); v != "" {
+			servedBy = v
+			resp.Header.Del(hedgeNodeHeader)
+			resp.Header.Set("X-QCC-Hedged", "true")
+		}
+		resp.Header.Set("X-Proxy-Node", servedBy)
+		if u != nil {
+			u.upstreamStatus = resp.StatusCode
+			if v := headerInt(resp.Header.Get("X-Upstream-Status")); v > 0 {
+				u.upstreamStatus = int(v)
+			}
+		}
+
+		// 上游已压缩的响应原样透传（客户端自行协商了编码），不再二次压缩。
+		encoding := resp.Header.Get("Content-Encoding")
+		if encoding != "" {
+			p.compression.passthroughResponses.Add(1)
+		}
 
 		// 包装 body，捕获 SSE/JSON 中的 usage。
-		resp.Body = &usageReader{ReadCloser: resp.Body, tracker: u, buf: &bytes.Buffer{}}
+		sse := strings.HasPrefix(strings.ToLower(resp.Header.Get("Content-Type")), "text/event-stream")
+		if timeout := p.firstByteTimeout(); sse && timeout > 0 && resp.StatusCode == http.StatusOK {
+			body, err := awaitFirstByte(resp.Body, timeout)
+			if err != nil {
+				return err
+			}
+			resp.Body = body
+		}
+		if acc := accountFromCtx(resp.Request); sse && acc != nil && resp.StatusCode == http.StatusOK && encodingIdentity(encoding) &&
+			p.streamFailureMode(acc) != streamFailureClose {
+			served := node
+			if u != nil && u.hedgeNode != nil {
+				served = u.hedgeNode
+			}
+			resp.Body = p.newSalvageReader(resp, acc, served, u)
+		}
+		if validate, repair := p.streamValidation(); sse && validate && encodingIdentity(encoding) {
+			if repair {
+				// 修复可能追加换行，原 Content-Length 不再准确。
+				resp.Header.Del("Content-Length")
+				resp.ContentLength = -1
+			}
+			nodeID := node.ID
+			resp.Body = &sseValidator{ReadCloser: resp.Body, repair: repair, onDone: func(v *sseValidator) {
+				p.streamStats.record(nodeID, v)
+			}}
+		}
+		resp.Body = &usageReader{ReadCloser: resp.Body, tracker: u, buf: &bytes.Buffer{}, encoding: encoding, sse: sse}
 		return nil
 	}
 
@@ -240,6 +359,10 @@ func (p *Server) newReverseProxy(node *Node, u *usage) *httputil.ReverseProxy {
 	proxy.Director = func(req *http.Request) {
 		originalDirector(req)
 		req.Host = node.URL.Host
+		req.Header.Del(nodeOverrideHeader)
+		req.Header.Del(labelHeader)
+		req.Header.Del(conversationHeader)
+		applyNodeHeaders(req.Header, node.Headers)
 		if node.APIKey != "" {
 			req.Header.Set("x-api-key", node.APIKey)
 			req.Header.Set("Authorization", "Bearer "+node.APIKey)
@@ -270,19 +393,31 @@ func (p *Server) newReverseProxy(node *Node, u *usage) *httputil.ReverseProxy {
 	}
 
 	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		if u != nil {
+			u.transportErr = err
+		}
+		if errors.Is(err, errFirstByteTimeout) {
+			if u != nil {
+				u.firstByteStall = true
+			}
+			p.handleFirstByteTimeout(w, r, node, p.firstByteTimeout())
+			return
+		}
 		if p.notifyMgr != nil {
 			if acc := accountFromCtx(r); acc != nil {
 				nodeName := ""
+				var nodeURL *url.URL
 				if n := nodeFromCtx(r); n != nil {
-					nodeName = n.Name
+					nodeName, nodeURL = n.Name, n.URL
 				}
-				p.notifyMgr.Publish(notify.Event{
+				p.notifyMgr.Publish(p.withUpstreamIncident(notify.Event{
 					AccountID:  acc.ID,
 					EventType:  notify.EventRequestProxyError,
 					Title:      "代理错误告警",
 					Content:    fmt.Sprintf("**请求**: %s %s\n**节点**: %s\n**错误信息**: %v", r.Method, r.URL.String(), chooseNonEmpty(nodeName, "-"), err),
+					Node:       nodeName,
 					OccurredAt: time.Now(),
-				})
+				}, nodeURL))
 			}
 		}
 		p.logger.Printf("proxy error %s %s: %v", r.Method, r.URL.String(), err)
@@ -0,0 +1,275 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// routingCandidate 描述一个节点在路由决策中的情况。
+type routingCandidate struct {
+	ID              string  `json:"id"`
+	Name            string  `json:"name"`
+	State           string  `json:"state"`
+	Weight          int     `json:"weight"`
+	AdaptiveWeight  int     `json:"adaptive_weight,omitempty"`
+	EffectiveWeight int     `json:"effective_weight"`
+	Routable        bool    `json:"routable"`
+	Active          bool    `json:"active"`
+	Inflight        int64   `json:"inflight"`
+	Samples         int     `json:"samples"`
+	P95Ms           int64   `json:"p95_ms"`
+	ErrorRate       float64 `json:"error_rate"`
+	WarmupShare     float64 `json:"warmup_share,omitempty"`
+	Note            string  `json:"note,omitempty"`
+}
+
+// routingExplanation 为一次假设请求给出的路由解释。
+type routingExplanation struct {
+	AccountID    string             `json:"account_id"`
+	AccountName  string             `json:"account_name"`
+	Model        string             `json:"model,omitempty"`
+	NodeOverride string             `json:"node_override,omitempty"`
+	Chosen       *routingCandidate  `json:"chosen"`
+	Reason       string             `json:"reason"`
+	Steps        []string           `json:"steps"`
+	Candidates   []routingCandidate `json:"candidates"`
+}
+
+// explainRouting 按真实路由逻辑推演节点选择，不修改活跃节点、不转发请求，也不影响会话亲和缓存。
+// 依次覆盖节点指定、会话亲和、活跃节点/故障切换、预热分流与对冲；预热分流与对冲取决于随机抽样与
+// 响应耗时，只在 Steps 中说明分流比例与备用节点，Chosen 始终为首选节点。
+// 不推演与节点选择无关的准入检查（维护模式、路径白名单、请求限制、内容过滤、配额），也不包含重试时的节点切换。
+func (p *Server) explainRouting(acc *Account, allowOverride bool, model string, headers http.Header) routingExplanation {
+	exp := routingExplanation{AccountID: acc.ID, AccountName: acc.Name, Model: model}
+	if model != "" {
+		exp.Steps = append(exp.Steps, "model does not affect node selection; all account nodes are candidates")
+	}
+	override := strings.TrimSpace(headers.Get(nodeOverrideHeader))
+	exp.NodeOverride = override
+
+	now := time.Now()
+	p.mu.RLock()
+	activeID := acc.ActiveID
+	cands := make([]routingCandidate, 0, len(acc.Nodes))
+	for id, n := range acc.Nodes {
+		c := routingCandidate{
+			ID:              id,
+			Name:            n.Name,
+			State:           nodeState(n),
+			Weight:          n.Weight,
+			AdaptiveWeight:  n.AdaptiveWeight,
+			EffectiveWeight: effectiveWeight(n),
+			Routable:        nodeRoutable(n),
+			Active:          id == activeID,
+		}
+		if share := p.nodeWarmupShare(n, now); share < 1 {
+			c.WarmupShare = share
+		}
+		if !c.Routable {
+			c.Note = "state " + c.State + " is not routable"
+		} else if c.AdaptiveWeight > 0 && c.EffectiveWeight == c.AdaptiveWeight {
+			c.Note = "weight adjusted by adaptive routing"
+		} else if base := routingWeight(n); c.EffectiveWeight != base && base > 0 {
+			c.Note = "weight penalised by state " + c.State
+		} else if c.WarmupShare > 0 {
+			c.Note = "warming up after recovery"
+		}
+		cands = append(cands, c)
+	}
+	bestID, _ := bestRoutableNode(acc.Nodes)
+	created := make(map[string]int64, len(acc.Nodes))
+	for id, n := range acc.Nodes {
+		created[id] = n.CreatedAt.UnixNano()
+	}
+	p.mu.RUnlock()
+
+	for i := range cands {
+		cands[i].Inflight = p.nodeInflight(cands[i].ID)
+		samples, p95, errRate := p.nodeLatencyStats(cands[i].ID)
+		cands[i].Samples = samples
+		cands[i].P95Ms = p95.Milliseconds()
+		cands[i].ErrorRate = errRate
+	}
+	sort.Slice(cands, func(i, j int) bool {
+		if cands[i].Routable != cands[j].Routable {
+			return cands[i].Routable
+		}
+		if cands[i].EffectiveWeight != cands[j].EffectiveWeight {
+			return cands[i].EffectiveWeight < cands[j].EffectiveWeight
+		}
+		return created[cands[i].ID] < created[cands[j].ID]
+	})
+	exp.Candidates = cands
+
+	find := func(id string) *routingCandidate {
+		for i := range cands {
+			if cands[i].ID == id {
+				c := cands[i]
+				return &c
+			}
+		}
+		return nil
+	}
+
+	if override != "" {
+		exp.Steps = append(exp.Steps, "request carries "+nodeOverrideHeader+": "+override)
+		if !allowOverride {
+			exp.Reason = "node override not permitted for this key; request would be rejected with 403"
+			return exp
+		}
+		var target *routingCandidate
+		for i := range cands {
+			if cands[i].ID == override {
+				target = &cands[i]
+				break
+			}
+		}
+		if target == nil {
+			for i := range cands {
+				if strings.EqualFold(cands[i].Name, override) {
+					target = &cands[i]
+					break
+				}
+			}
+		}
+		switch {
+		case target == nil:
+			exp.Reason = "override node not found; request would be rejected with 404"
+		case target.State == NodeStateDisabled:
+			exp.Reason = "override node is disabled; request would be rejected with 409"
+		default:
+			c := *target
+			exp.Chosen = &c
+			exp.Reason = "forced by " + nodeOverrideHeader + ", routing rules skipped"
+			exp.Steps = append(exp.Steps, "conversation affinity, warm-up and hedging do not apply to overridden requests")
+		}
+		return exp
+	}
+
+	var chosen *routingCandidate
+	if convID := conversationID(&http.Request{Header: headers}); convID != "" {
+		enabled, _, _ := p.affinitySettings()
+		nodeID, pinned := "", false
+		if enabled && p.affinity != nil {
+			nodeID, pinned = p.affinity.peek(acc.ID, convID, now)
+		}
+		switch {
+		case !enabled || p.affinity == nil:
+			exp.Steps = append(exp.Steps, "conversation affinity is disabled; "+conversationHeader+" is ignored")
+		case !pinned:
+			exp.Steps = append(exp.Steps, "conversation "+convID+" is not pinned; the node that serves it successfully will be pinned")
+		default:
+			if c := find(nodeID); c != nil && c.Routable {
+				exp.Steps = append(exp.Steps, "conversation "+convID+" is pinned to node "+c.Name+"; warm-up does not apply to pinned nodes")
+				chosen = c
+				exp.Reason = "conversation affinity keeps the pinned node"
+			} else {
+				exp.Steps = append(exp.Steps, "conversation "+convID+" is pinned to node "+nodeID+", which is no longer routable; the binding would be dropped")
+			}
+		}
+	}
+
+	if chosen == nil {
+		if active := find(activeID); active != nil && active.Routable {
+			exp.Steps = append(exp.Steps, "active node "+active.Name+" is routable (state "+active.State+")")
+			chosen = active
+			exp.Reason = "active node is kept while routable"
+		} else {
+			if activeID == "" {
+				exp.Steps = append(exp.Steps, "account has no active node")
+			} else {
+				exp.Steps = append(exp.Steps, "active node "+activeID+" is not routable")
+			}
+			if bestID == "" {
+				exp.Reason = "no routable node; request would fail with 503"
+				return exp
+			}
+			chosen = find(bestID)
+			exp.Steps = append(exp.Steps, "selected routable node with the lowest effective weight (weight x state factor), ties broken by creation time")
+			exp.Reason = "active node unavailable, failover to lowest effective weight"
+		}
+		if chosen.WarmupShare > 0 {
+			step := fmt.Sprintf("%s is warming up; only %.0f%% of requests go to it", chosen.Name, chosen.WarmupShare*100)
+			if alt := p.explainAlternate(acc, chosen.ID); alt != "" {
+				step += ", the rest go to " + alt
+			} else {
+				step += ", but no other node is routable so it takes all requests"
+			}
+			exp.Steps = append(exp.Steps, step)
+		}
+	}
+
+	// 对冲与代理入口一致：以实际服务的节点为主节点，备用节点为其余节点中有效权重最低的可路由节点。
+	if enabled, threshold, pct := p.hedgeSettings(); enabled && pct > 0 {
+		if alt := p.explainAlternate(acc, chosen.ID); alt != "" {
+			exp.Steps = append(exp.Steps, fmt.Sprintf("hedging: if %s sends no response headers within %dms, a duplicate request goes to %s (budget %d%% of requests) and the first response wins",
+				chosen.Name, threshold.Milliseconds(), alt, pct))
+		} else {
+			exp.Steps = append(exp.Steps, "hedging is enabled but no other node is routable")
+		}
+	}
+	exp.Chosen = chosen
+	return exp
+}
+
+// explainAlternate 返回预热分流或对冲时承接请求的备用节点名称，没有时返回空字符串。
+func (p *Server) explainAlternate(acc *Account, excludeID string) string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if n := bestRoutableNodeExcept(acc.Nodes, excludeID); n != nil {
+		return n.Name
+	}
+	return ""
+}
+
+// POST /api/routing/explain
+// 请求体: {"account_id": "", "model": "", "headers": {"x-api-key": "...", "X-QCC-Node": "...", "X-QCC-Conversation": "..."}}
+// 账号不存在与无权管理统一返回 404，避免借此探测其他账号或密钥是否存在。
+func (p *Server) handleRoutingExplain(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	caller := accountFromCtx(r)
+	if caller == nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		return
+	}
+	var req struct {
+		AccountID string            `json:"account_id"`
+		Model     string            `json:"model"`
+		Headers   map[string]string `json:"headers"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
+		return
+	}
+	headers := make(http.Header, len(req.Headers))
+	for k, v := range req.Headers {
+		headers.Set(k, v)
+	}
+
+	// 与代理入口一致：优先按请求头中的代理密钥（账号密钥或服务账号密钥）识别账号；
+	// 未携带密钥时按账号密钥推演。
+	var (
+		acc     *Account
+		service *ServiceAccount
+	)
+	if key := extractAPIKey(&http.Request{Header: headers}); key != "" {
+		acc = p.getAccountByProxyKey(key)
+		if acc == nil {
+			acc, service = p.peekServiceAccount(key)
+		}
+	} else {
+		acc = p.getAccountByID(chooseNonEmpty(req.AccountID, caller.ID))
+	}
+	if acc == nil || !canManageAccount(r.Context(), acc.ID) {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "account not found"})
+		return
+	}
+	writeJSON(w, http.StatusOK, p.explainRouting(acc, p.nodeOverrideAllowed(acc, service, true), req.Model, headers))
+}
@@ -2,11 +2,15 @@ package proxy
 
 import (
 	"context"
+	"fmt"
 	"log"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
 	"qcc_plus/internal/store"
+	"qcc_plus/internal/timeutil"
 )
 
 const (
@@ -22,22 +26,52 @@ type MetricsScheduler struct {
 	stopCh chan struct{}
 	wg     sync.WaitGroup
 
-	aggregateInterval time.Duration
-	cleanupInterval   time.Duration
-	stopOnce          sync.Once
+	aggregateInterval   time.Duration
+	cleanupInterval     time.Duration
+	consistencyInterval time.Duration // 聚合一致性检查间隔，0 表示关闭
+	stopOnce            sync.Once
+	paused              func() bool       // 返回 true 时跳过本轮聚合与清理（维护模式）
+	publishProgress     func(JobProgress) // 推送补聚合进度（WS job_progress，仅管理员），为 nil 时不推送
+
+	aggMu     sync.Mutex // 聚合运行锁，见 tryLockAggregation
+	cleanupMu sync.Mutex // 清理运行锁
+
+	statusMu        sync.RWMutex
+	lastAggregation *schedulerRun
+	lastCleanup     *cleanupReport
+	lastCatchUp     *catchUpReport
+	lastConsistency *consistencyReport
+	aggSkipped      int64 // 因上一次聚合仍在运行而跳过的次数
+	cleanupSkipped  int64
 }
 
-// NewMetricsScheduler 创建调度器，默认每小时聚合、每天清理一次。
+// schedulerRun 一次定时任务的执行情况。
+type schedulerRun struct {
+	StartedAt time.Time
+	Duration  time.Duration
+	Err       string
+}
+
+// cleanupReport 一次清理的结果：各表删除（DryRun 时为将删除）的行数，及因存储超限额外清理的行数。
+type cleanupReport struct {
+	schedulerRun
+	DryRun    bool
+	Deleted   map[string]int64
+	Tightened map[string]map[string]int64 // account -> table -> rows
+}
+
+// NewMetricsScheduler 创建调度器，默认每小时聚合、每天清理一次；启动时先回填停机期间漏掉的聚合窗口。
 func NewMetricsScheduler(s *store.Store, logger *log.Logger) *MetricsScheduler {
 	if logger == nil {
 		logger = log.Default()
 	}
 	return &MetricsScheduler{
-		store:             s,
-		logger:            logger,
-		stopCh:            make(chan struct{}),
-		aggregateInterval: defaultAggregateInterval,
-		cleanupInterval:   defaultCleanupInterval,
+		store:               s,
+		logger:              logger,
+		stopCh:              make(chan struct{}),
+		aggregateInterval:   defaultAggregateInterval,
+		cleanupInterval:     defaultCleanupInterval,
+		consistencyInterval: defaultConsistencyInterval,
 	}
 }
 
@@ -56,6 +90,10 @@ func (m *MetricsScheduler) Start() error {
 	m.wg.Add(2)
 	go m.aggregateLoop()
 	go m.cleanupLoop()
+	if m.consistencyInterval > 0 {
+		m.wg.Add(1)
+		go m.consistencyLoop()
+	}
 	return nil
 }
 
@@ -85,6 +123,10 @@ func (m *MetricsScheduler) aggregateLoop() {
 	defer m.wg.Done()
 	defer m.recoverPanic("aggregation loop")
 
+	if !m.isPaused() {
+		m.runCatchUp()
+	}
+
 	initialDelay := m.nextAggregateDelay(time.Now().UTC())
 	timer := time.NewTimer(initialDelay)
 	select {
@@ -92,7 +134,9 @@ func (m *MetricsScheduler) aggregateLoop() {
 		timer.Stop()
 		return
 	case <-timer.C:
-		m.runAggregation()
+		if !m.isPaused() {
+			m.runAggregation()
+		}
 	}
 
 	ticker := time.NewTicker(m.aggregateInterval)
@@ -103,7 +147,9 @@ func (m *MetricsScheduler) aggregateLoop() {
 		case <-m.stopCh:
 			return
 		case <-ticker.C:
-			m.runAggregation()
+			if !m.isPaused() {
+				m.runAggregation()
+			}
 		}
 	}
 }
@@ -119,7 +165,9 @@ func (m *MetricsScheduler) cleanupLoop() {
 		timer.Stop()
 		return
 	case <-timer.C:
-		m.runCleanup()
+		if !m.isPaused() {
+			m.runCleanup()
+		}
 	}
 
 	ticker := time.NewTicker(m.cleanupInterval)
@@ -130,16 +178,29 @@ func (m *MetricsScheduler) cleanupLoop() {
 		case <-m.stopCh:
 			return
 		case <-ticker.C:
-			m.runCleanup()
+			if !m.isPaused() {
+				m.runCleanup()
+			}
 		}
 	}
 }
 
+func (m *MetricsScheduler) isPaused() bool {
+	return m.paused != nil && m.paused()
+}
+
 func (m *MetricsScheduler) runAggregation() {
+	unlock, ok := m.tryLockAggregation()
+	if !ok {
+		m.logger.Printf("[MetricsScheduler] Previous aggregation still running, skipping this run")
+		return
+	}
+	defer unlock()
 	start := time.Now()
 	m.logger.Printf("[MetricsScheduler] Starting hourly aggregation...")
+	var errs []string
 
-	ctx, cancel := m.taskContext(30 * time.Second)
+	ctx, cancel := m.taskContext(m.store.Timeouts().Aggregate)
 	defer cancel()
 
 	now := time.Now().UTC()
@@ -147,6 +208,12 @@ func (m *MetricsScheduler) runAggregation() {
 	// 原始 -> 小时，过去 2 小时的数据。
 	if err := m.store.AggregateMetrics(ctx, "", store.MetricsGranularityHourly, now.Add(-2*time.Hour), now); err != nil {
 		m.logger.Printf("[MetricsScheduler] Aggregation failed (raw->hour): %v", err)
+		errs = append(errs, "raw->hour: "+err.Error())
+	}
+
+	if err := m.store.AggregateUsageRollups(ctx, store.MetricsGranularityHourly, now.Add(-2*time.Hour), now); err != nil {
+		m.logger.Printf("[MetricsScheduler] Rollup failed (raw->hour): %v", err)
+		errs = append(errs, "rollup raw->hour: "+err.Error())
 	}
 
 	// 小时 -> 天，昨天的数据。
@@ -154,6 +221,11 @@ func (m *MetricsScheduler) runAggregation() {
 	todayStart := startOfDay(now)
 	if err := m.store.AggregateMetrics(ctx, "", store.MetricsGranularityDaily, yesterdayStart, todayStart); err != nil {
 		m.logger.Printf("[MetricsScheduler] Aggregation failed (hour->day): %v", err)
+		errs = append(errs, "hour->day: "+err.Error())
+	}
+	if err := m.store.AggregateUsageRollups(ctx, store.MetricsGranularityDaily, yesterdayStart, todayStart); err != nil {
+		m.logger.Printf("[MetricsScheduler] Rollup failed (hour->day): %v", err)
+		errs = append(errs, "rollup hour->day: "+err.Error())
 	}
 
 	// 天 -> 月，上个月的数据。
@@ -161,26 +233,144 @@ func (m *MetricsScheduler) runAggregation() {
 	lastMonthStart := currentMonthStart.AddDate(0, -1, 0)
 	if err := m.store.AggregateMetrics(ctx, "", store.MetricsGranularityMonthly, lastMonthStart, currentMonthStart); err != nil {
 		m.logger.Printf("[MetricsScheduler] Aggregation failed (day->month): %v", err)
+		errs = append(errs, "day->month: "+err.Error())
 	}
 
 	m.logger.Printf("[MetricsScheduler] Aggregation completed in %v", time.Since(start))
+	m.statusMu.Lock()
+	m.lastAggregation = &schedulerRun{StartedAt: start, Duration: time.Since(start), Err: strings.Join(errs, "; ")}
+	m.statusMu.Unlock()
 }
 
 func (m *MetricsScheduler) runCleanup() {
+	unlock, ok := m.tryLockCleanup()
+	if !ok {
+		m.logger.Printf("[MetricsScheduler] Previous cleanup still running, skipping this run")
+		return
+	}
+	defer unlock()
 	start := time.Now()
-	m.logger.Printf("[MetricsScheduler] Starting daily cleanup...")
+	dryRun := m.cleanupDryRun()
+	m.logger.Printf("[MetricsScheduler] Starting daily cleanup (dry_run=%v)...", dryRun)
 
-	ctx, cancel := m.taskContext(30 * time.Second)
+	ctx, cancel := m.taskContext(m.store.Timeouts().Cleanup)
 	defer cancel()
 
-	if err := m.store.CleanupMetrics(ctx, "", time.Now().UTC()); err != nil {
+	report := &cleanupReport{schedulerRun: schedulerRun{StartedAt: start}, DryRun: dryRun}
+	plan, err := loadRetentionPlan(m.store)
+	if err != nil {
+		m.logger.Printf("[MetricsScheduler] Load retention policy failed, using defaults: %v", err)
+	}
+	now := time.Now().UTC()
+	report.Deleted, err = runRetentionCleanup(ctx, m.store, plan, "", dryRun, now)
+	if err != nil {
+		report.Err = err.Error()
 		m.logger.Printf("[MetricsScheduler] Cleanup failed: %v", err)
 	} else {
-		m.logger.Printf("[MetricsScheduler] Cleanup completed in %v", time.Since(start))
+		m.logger.Printf("[MetricsScheduler] Cleanup completed in %v, %s: %s", time.Since(start), cleanupVerb(dryRun), formatTableCounts(report.Deleted))
 	}
 
-	if err := m.store.CleanupHealthChecks(ctx, time.Time{}); err != nil {
-		m.logger.Printf("[MetricsScheduler] Health history cleanup failed: %v", err)
+	if !dryRun {
+		report.Tightened = m.enforceStorageLimits(ctx, plan, now)
+	}
+	report.Duration = time.Since(start)
+	m.statusMu.Lock()
+	m.lastCleanup = report
+	m.statusMu.Unlock()
+}
+
+// cleanupDryRun 读取 retention.dry_run 配置，开启后定时清理只统计不删除。
+func (m *MetricsScheduler) cleanupDryRun() bool {
+	setting, err := m.store.GetSetting("retention.dry_run", "system", "")
+	if err != nil || setting == nil {
+		return false
+	}
+	b, _ := setting.Value.(bool)
+	return b
+}
+
+func cleanupVerb(dryRun bool) string {
+	if dryRun {
+		return "would delete"
+	}
+	return "deleted"
+}
+
+// formatTableCounts 按表名排序输出非零行数，如 "node_metrics_raw=120 request_logs=8"。
+func formatTableCounts(counts map[string]int64) string {
+	tables := make([]string, 0, len(counts))
+	for table, n := range counts {
+		if n > 0 {
+			tables = append(tables, table)
+		}
+	}
+	if len(tables) == 0 {
+		return "nothing"
+	}
+	sort.Strings(tables)
+	parts := make([]string, len(tables))
+	for i, table := range tables {
+		parts[i] = fmt.Sprintf("%s=%d", table, counts[table])
+	}
+	return strings.Join(parts, " ")
+}
+
+// status 返回调度器配置与最近一次聚合、补聚合、一致性检查、清理的结果。
+func (m *MetricsScheduler) status() map[string]interface{} {
+	m.statusMu.RLock()
+	defer m.statusMu.RUnlock()
+	res := map[string]interface{}{
+		"aggregate_interval": m.aggregateInterval.String(),
+		"cleanup_interval":   m.cleanupInterval.String(),
+		"last_aggregation":   nil,
+		"last_cleanup":       nil,
+		"last_catch_up":      nil,
+		"consistency_check":  nil,
+		"skipped_runs":       map[string]int64{"aggregation": m.aggSkipped, "cleanup": m.cleanupSkipped},
+	}
+	if m.consistencyInterval > 0 {
+		check := map[string]interface{}{"interval": m.consistencyInterval.String(), "last_run": nil}
+		if rep := m.lastConsistency; rep != nil {
+			view := rep.view()
+			view["self_heal"] = rep.SelfHeal
+			view["mismatches"] = rep.Mismatches
+			view["healed"] = rep.Healed
+			check["last_run"] = view
+		}
+		res["consistency_check"] = check
+	}
+	if rep := m.lastCatchUp; rep != nil {
+		view := rep.view()
+		view["backfilled"] = rep.Backfilled
+		res["last_catch_up"] = view
+	}
+	if run := m.lastAggregation; run != nil {
+		res["last_aggregation"] = run.view()
+	}
+	if rep := m.lastCleanup; rep != nil {
+		view := rep.view()
+		view["dry_run"] = rep.DryRun
+		view["deleted"] = rep.Deleted
+		var total int64
+		for _, n := range rep.Deleted {
+			total += n
+		}
+		view["deleted_total"] = total
+		tightened := rep.Tightened
+		if tightened == nil {
+			tightened = map[string]map[string]int64{}
+		}
+		view["storage_tightened"] = tightened
+		res["last_cleanup"] = view
+	}
+	return res
+}
+
+func (r schedulerRun) view() map[string]interface{} {
+	return map[string]interface{}{
+		"started_at":  timeutil.FormatBeijingTime(r.StartedAt),
+		"duration_ms": r.Duration.Milliseconds(),
+		"error":       r.Err,
 	}
 }
 
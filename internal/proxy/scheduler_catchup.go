@@ -0,0 +1,209 @@
+package proxy
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"qcc_plus/internal/store"
+)
+
+// 启动补聚合的最大回看范围；源数据的保留期更短时以保留期为准。
+const (
+	catchUpHourlyMaxLookback  = 31 * 24 * time.Hour
+	catchUpDailyMaxLookback   = 92 * 24 * time.Hour
+	catchUpMonthlyMaxLookback = 2 * 365 * 24 * time.Hour
+)
+
+// catchUpReport 一次补聚合的结果：各粒度回填的桶数。
+type catchUpReport struct {
+	schedulerRun
+	Backfilled map[string]int
+}
+
+// bucketRange 连续的聚合桶区间 [From, To)。
+type bucketRange struct {
+	From, To time.Time
+}
+
+// tryLockAggregation 获取聚合运行锁，定时聚合、补聚合与手动聚合互斥；已有运行中的聚合时返回 false。
+// 调度器未启用时不加锁。
+func (m *MetricsScheduler) tryLockAggregation() (unlock func(), ok bool) {
+	if m == nil {
+		return func() {}, true
+	}
+	if !m.aggMu.TryLock() {
+		m.statusMu.Lock()
+		m.aggSkipped++
+		m.statusMu.Unlock()
+		return nil, false
+	}
+	return m.aggMu.Unlock, true
+}
+
+// tryLockCleanup 获取清理运行锁，语义同 tryLockAggregation。
+func (m *MetricsScheduler) tryLockCleanup() (unlock func(), ok bool) {
+	if m == nil {
+		return func() {}, true
+	}
+	if !m.cleanupMu.TryLock() {
+		m.statusMu.Lock()
+		m.cleanupSkipped++
+		m.statusMu.Unlock()
+		return nil, false
+	}
+	return m.cleanupMu.Unlock, true
+}
+
+// runCatchUp 检测停机或失败期间漏掉的小时/天/月聚合桶并回填，在调度器启动时执行。
+func (m *MetricsScheduler) runCatchUp() {
+	unlock, ok := m.tryLockAggregation()
+	if !ok {
+		m.logger.Printf("[MetricsScheduler] Aggregation in progress, skipping catch-up")
+		return
+	}
+	defer unlock()
+
+	start := time.Now()
+	ctx, cancel := m.taskContext(10 * m.store.Timeouts().Aggregate)
+	defer cancel()
+	report := &catchUpReport{schedulerRun: schedulerRun{StartedAt: start}}
+	progress := newJobReporter(newLocalJob(jobTypeAggregationBackfill, "", auditActorSystem), m.publishProgress)
+	var err error
+	report.Backfilled, err = m.backfillGaps(ctx, start.UTC(), progress)
+	report.Duration = time.Since(start)
+	total := report.Backfilled["hour"] + report.Backfilled["day"] + report.Backfilled["month"]
+	if err != nil {
+		report.Err = err.Error()
+		m.logger.Printf("[MetricsScheduler] Catch-up failed: %v", err)
+		progress.finish(store.JobFailed, report.Err)
+	} else if total > 0 {
+		m.logger.Printf("[MetricsScheduler] Catch-up backfilled %d hourly, %d daily, %d monthly buckets in %v",
+			report.Backfilled["hour"], report.Backfilled["day"], report.Backfilled["month"], report.Duration)
+		progress.finish(store.JobSucceeded, "")
+	}
+	m.statusMu.Lock()
+	m.lastCatchUp = report
+	m.statusMu.Unlock()
+}
+
+// backfillGaps 按小时→天→月的顺序回填缺失的桶。回填的小时所在的天、回填的天所在的月即使已有数据也会重算，
+// 避免上层聚合基于不完整的下层数据。当前未结束的小时/天/月由定时聚合负责。
+// 进度按粒度分阶段上报，processed/total 为该粒度已回填与待回填的桶数；没有缺失的桶时不上报。
+func (m *MetricsScheduler) backfillGaps(ctx context.Context, now time.Time, progress *jobReporter) (map[string]int, error) {
+	plan, err := loadRetentionPlan(m.store)
+	if err != nil {
+		m.logger.Printf("[MetricsScheduler] Load retention policy failed, using defaults: %v", err)
+	}
+	policy := plan.system
+	counts := map[string]int{}
+
+	hourEnd := now.Truncate(time.Hour)
+	hourFrom := hourEnd.Add(-catchUpLookback(policy.RawMetrics, catchUpHourlyMaxLookback)).Truncate(time.Hour).Add(time.Hour)
+	hours, err := m.store.MissingAggregateBuckets(ctx, store.MetricsGranularityHourly, hourFrom, hourEnd)
+	if err != nil {
+		return counts, err
+	}
+	if err := m.backfill(ctx, store.MetricsGranularityHourly, "hour", progress, hours, func(t time.Time) time.Time { return t.Add(time.Hour) }); err != nil {
+		return counts, err
+	}
+	counts["hour"] = len(hours)
+
+	dayEnd := startOfDay(now)
+	dayFrom := startOfDay(dayEnd.Add(-catchUpLookback(policy.HourlyMetrics, catchUpDailyMaxLookback))).AddDate(0, 0, 1)
+	days, err := m.store.MissingAggregateBuckets(ctx, store.MetricsGranularityDaily, dayFrom, dayEnd)
+	if err != nil {
+		return counts, err
+	}
+	days = mergeBuckets(days, parentBuckets(hours, startOfDay, dayEnd))
+	if err := m.backfill(ctx, store.MetricsGranularityDaily, "day", progress, days, func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }); err != nil {
+		return counts, err
+	}
+	counts["day"] = len(days)
+
+	monthEnd := startOfMonth(now)
+	monthFrom := startOfMonth(monthEnd.Add(-catchUpLookback(policy.DailyMetrics, catchUpMonthlyMaxLookback))).AddDate(0, 1, 0)
+	months, err := m.store.MissingAggregateBuckets(ctx, store.MetricsGranularityMonthly, monthFrom, monthEnd)
+	if err != nil {
+		return counts, err
+	}
+	months = mergeBuckets(months, parentBuckets(days, startOfMonth, monthEnd))
+	if err := m.backfill(ctx, store.MetricsGranularityMonthly, "month", progress, months, func(t time.Time) time.Time { return t.AddDate(0, 1, 0) }); err != nil {
+		return counts, err
+	}
+	counts["month"] = len(months)
+	return counts, nil
+}
+
+// backfill 将缺失的桶合并为连续区间后逐段聚合；小时与天粒度同时回填多维汇总。每段完成后上报已回填的桶数。
+func (m *MetricsScheduler) backfill(ctx context.Context, target store.MetricsGranularity, stage string, progress *jobReporter, buckets []time.Time, next func(time.Time) time.Time) error {
+	if len(buckets) == 0 {
+		return nil
+	}
+	progress.Stage(stage)
+	progress.Update(0, int64(len(buckets)))
+	done := 0
+	for _, r := range bucketRanges(buckets, next) {
+		if err := m.store.AggregateMetrics(ctx, "", target, r.From, r.To); err != nil {
+			return err
+		}
+		if target == store.MetricsGranularityHourly || target == store.MetricsGranularityDaily {
+			if err := m.store.AggregateUsageRollups(ctx, target, r.From, r.To); err != nil {
+				return err
+			}
+		}
+		for done < len(buckets) && buckets[done].Before(r.To) {
+			done++
+		}
+		progress.Update(int64(done), int64(len(buckets)))
+	}
+	return nil
+}
+
+// catchUpLookback 回看范围取源数据保留期，未配置或超过上限时取上限。
+func catchUpLookback(retention, max time.Duration) time.Duration {
+	if retention <= 0 || retention > max {
+		return max
+	}
+	return retention
+}
+
+// bucketRanges 将升序的桶起点合并为连续区间，next 返回下一个桶的起点。
+func bucketRanges(buckets []time.Time, next func(time.Time) time.Time) []bucketRange {
+	var out []bucketRange
+	for _, b := range buckets {
+		if n := len(out); n > 0 && out[n-1].To.Equal(b) {
+			out[n-1].To = next(b)
+			continue
+		}
+		out = append(out, bucketRange{From: b, To: next(b)})
+	}
+	return out
+}
+
+// parentBuckets 返回子桶所在的上层桶起点（去重、升序），不含 end 及之后未结束的桶。
+func parentBuckets(children []time.Time, parent func(time.Time) time.Time, end time.Time) []time.Time {
+	var out []time.Time
+	for _, c := range children {
+		if p := parent(c); p.Before(end) {
+			out = append(out, p)
+		}
+	}
+	return mergeBuckets(out, nil)
+}
+
+// mergeBuckets 合并两组桶起点，去重并升序。
+func mergeBuckets(a, b []time.Time) []time.Time {
+	seen := make(map[int64]bool, len(a)+len(b))
+	var out []time.Time
+	for _, list := range [][]time.Time{a, b} {
+		for _, t := range list {
+			if key := t.Unix(); !seen[key] {
+				seen[key] = true
+				out = append(out, t)
+			}
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Before(out[j]) })
+	return out
+}
@@ -0,0 +1,69 @@
+package proxy
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strings"
+)
+
+const secretBoxPrefix = "enc:v1:"
+
+var errSecretBoxUnavailable = errors.New("encryption_key not configured")
+
+// secretBox 以 AES-256-GCM 加密落库的敏感数据，密钥由启动配置 encryption_key 派生。
+type secretBox struct {
+	aead cipher.AEAD
+}
+
+// newSecretBox 根据主密钥创建加密器，主密钥为空时返回 nil。
+func newSecretBox(master string) (*secretBox, error) {
+	if master == "" {
+		return nil, nil
+	}
+	key := sha256.Sum256([]byte(master))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &secretBox{aead: aead}, nil
+}
+
+// seal 加密明文，输出 enc:v1:<base64(nonce|密文)>。
+func (b *secretBox) seal(plain []byte) (string, error) {
+	if b == nil {
+		return "", errSecretBoxUnavailable
+	}
+	nonce := make([]byte, b.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	out := b.aead.Seal(nonce, nonce, plain, nil)
+	return secretBoxPrefix + base64.StdEncoding.EncodeToString(out), nil
+}
+
+// open 解密 seal 的输出；密钥不匹配或数据被篡改时返回错误。
+func (b *secretBox) open(sealed string) ([]byte, error) {
+	if b == nil {
+		return nil, errSecretBoxUnavailable
+	}
+	if !strings.HasPrefix(sealed, secretBoxPrefix) {
+		return nil, errors.New("unsupported ciphertext format")
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(sealed, secretBoxPrefix))
+	if err != nil {
+		return nil, err
+	}
+	n := b.aead.NonceSize()
+	if len(raw) < n {
+		return nil, errors.New("ciphertext too short")
+	}
+	return b.aead.Open(nil, raw[:n], raw[n:], nil)
+}
@@ -7,10 +7,13 @@ import (
 	"log"
 	"net/http"
 	"net/url"
+	"os"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"qcc_plus/internal/config"
 	"qcc_plus/internal/notify"
 	"qcc_plus/internal/store"
 	"qcc_plus/internal/tunnel"
@@ -18,11 +21,29 @@ import (
 
 // Server 负责在多个上游节点间切换并提供管理页面。
 type Server struct {
-	mu          sync.RWMutex
-	accounts    map[string]*Account // proxyAPIKey -> Account
-	accountByID map[string]*Account // accountID -> Account
-	nodeIndex   map[string]*Node    // nodeID -> Node
-	nodeAccount map[string]*Account // nodeID -> Account
+	mu            sync.RWMutex
+	accounts      map[string]*Account // proxyAPIKey -> Account
+	accountByID   map[string]*Account // accountID -> Account
+	serviceKeys   map[string]*Account // 服务账号密钥哈希 -> 所属 Account
+	nodeIndex     map[string]*Node    // nodeID -> Node
+	nodeAccount   map[string]*Account // nodeID -> Account
+	nodeChanges   *nodeChangeLog      // 节点状态变更版本（长轮询）
+	apiPatterns   map[string]bool     // 管理 API 已注册的路由模式，OpenAPI 文档据此输出
+	inflight      sync.Map            // nodeID -> *atomic.Int64 在途请求数
+	latency       sync.Map            // nodeID -> *latencyWindow 近期耗时窗口
+	hedges        hedgeBudget         // 对冲请求预算
+	benchmarks    sync.Map            // nodeID -> 正在运行的压测，防止同一节点并发压测
+	replays       sync.Map            // accountID -> 正在运行的请求回放
+	abComparisons abComparisonManager // A/B 响应对比任务
+
+	contentFilterStats sync.Map          // accountID -> *contentFilterCounters
+	dimLimiter         *dimensionLimiter // 多维汇总的维度基数限制
+	affinity           *affinityCache    // 会话 → 节点亲和缓存
+	statusPages        *statusPageCache  // 公开状态页渲染缓存
+	badges             badgeCache        // 分享徽章数据缓存
+	throughput         sync.Map          // accountID -> *throughputCounters 实时流量
+	quotas             sync.Map          // accountID -> *accountQuota 当前周期配额用量
+	uiPrefs            sync.Map          // userID -> UIPreferences，仅在未启用存储时使用
 
 	defaultAccount *Account
 	defaultAccName string
@@ -30,9 +51,16 @@ type Server struct {
 	nodes    map[string]*Node
 	activeID string
 
-	sessionMgr *SessionManager
+	sessionMgr  *SessionManager
+	idempotency *IdempotencyStore
 
 	listenAddr       string
+	adminListenAddr  string // 非空时管理面单独监听，listenAddr 仅转发代理请求
+	unixSocketMode   os.FileMode
+	accessLog        accessLog
+	authEvents       authEventSink
+	requestLogs      requestLogSink
+	bootstrap        *config.Bootstrap
 	transport        http.RoundTripper
 	logger           *log.Logger
 	retries          int
@@ -45,14 +73,40 @@ type Server struct {
 	notifyMgr        *notify.Manager
 	metricsScheduler *MetricsScheduler
 	healthScheduler  *HealthScheduler
+	healthStats      healthPoolStats
+	healthProbes     healthProbeGroup
+	adaptiveWeight   *AdaptiveWeightScheduler
+	throughputTicker *ThroughputBroadcaster
+	updates          *UpdateNotifier
+	upstreamWatch    *UpstreamStatusWatcher
+	metricsFlusher   *MetricsFlusher
+	benchmarkSched   *BenchmarkScheduler
 	settingsCache    *SettingsCache
 	settingsStopCh   chan struct{}
+	settingsSched    *settingsScheduler
 	settingsWg       sync.WaitGroup
 
 	tunnelMgr *tunnel.Manager
 	tunnelMu  sync.Mutex
 
 	wsHub *WSHub
+
+	maintenanceOn atomic.Bool // 上次检测到的维护状态，用于识别切换
+
+	compression compressionStats
+	streamStats streamStats
+	salvage     salvageStats
+	adminRoutes adminRouteMetrics
+	exports     accountExportManager
+
+	upstreamStatus upstreamStatusTracker
+	nodeHookReplay nodeHookReplay
+	chaos          *chaosState        // 混沌测试的故障注入规则，仅在内存中生效
+	recorder       *TrafficRecorder   // 采样录制请求/响应到对象存储，未配置存储时为 nil
+	nodeTLS        *nodeTLSTransport  // 节点级 TLS 配置（客户端证书、自定义 CA）的传输层
+	secrets        *secretBox         // 加密落库的敏感数据，未配置 encryption_key 时为 nil
+	certWatch      *ClientCertWatcher // 客户端证书到期提醒
+	jobs           *jobRunner         // 持久化后台任务队列，未配置存储时为 nil
 }
 
 // Start 运行反向代理并阻塞直到关闭。
@@ -69,17 +123,81 @@ func (p *Server) Start() error {
 		}
 		defer p.metricsScheduler.Stop()
 	}
+	if p.jobs != nil {
+		if err := p.jobs.Start(); err != nil {
+			return err
+		}
+		defer p.jobs.Stop()
+		if err := p.resumeAccountPurges(context.Background()); err != nil {
+			p.logger.Printf("resume account purge jobs failed: %v", err)
+		}
+	}
+	if p.adaptiveWeight != nil {
+		if err := p.adaptiveWeight.Start(); err != nil {
+			return err
+		}
+		defer p.adaptiveWeight.Stop()
+	}
+	if p.throughputTicker != nil {
+		if err := p.throughputTicker.Start(); err != nil {
+			return err
+		}
+		defer p.throughputTicker.Stop()
+	}
+	if p.updates != nil {
+		if err := p.updates.Start(); err != nil {
+			return err
+		}
+		defer p.updates.Stop()
+	}
+	if p.upstreamWatch != nil {
+		if err := p.upstreamWatch.Start(); err != nil {
+			return err
+		}
+		defer p.upstreamWatch.Stop()
+	}
+	if p.metricsFlusher != nil {
+		if err := p.metricsFlusher.Start(); err != nil {
+			return err
+		}
+		defer p.metricsFlusher.Stop()
+	}
+	if p.benchmarkSched != nil {
+		if err := p.benchmarkSched.Start(); err != nil {
+			return err
+		}
+		defer p.benchmarkSched.Stop()
+	}
+	if p.recorder != nil {
+		if err := p.recorder.Start(); err != nil {
+			return err
+		}
+		defer p.recorder.Stop()
+	}
+	if p.certWatch != nil {
+		if err := p.certWatch.Start(); err != nil {
+			return err
+		}
+		defer p.certWatch.Stop()
+	}
 
 	go p.healthLoop()
-	server := &http.Server{
-		Addr:         p.listenAddr,
-		Handler:      p.handler(),
-		ReadTimeout:  30 * time.Second,
-		WriteTimeout: 0, // 支持流式响应
+	role, adminAddr := listenerAll, p.listenAddr
+	if p.adminListenAddr != "" {
+		role, adminAddr = listenerProxy, p.adminListenAddr
 	}
+	server := p.newHTTPServer(p.listenAddr, role)
 
+	scheme := "http"
+	if p.tlsEnabled() {
+		scheme = "https"
+	}
 	p.logger.Printf("Claude Code proxy listening on %s", p.listenAddr)
-	p.logger.Printf("Admin panel: http://%s/admin", p.listenAddr)
+	if path, ok := unixSocketPath(adminAddr); ok {
+		p.logger.Printf("Admin panel: %s (unix socket %s)", "/admin", path)
+	} else {
+		p.logger.Printf("Admin panel: %s://%s/admin", scheme, adminAddr)
+	}
 	p.logger.Printf("默认登录凭证:")
 	p.logger.Printf("  - 管理员: username=admin, password=admin123")
 	p.logger.Printf("  - 默认账号: username=%s, password=default123", chooseNonEmpty(p.defaultAccName, "default"))
@@ -93,7 +211,43 @@ func (p *Server) Start() error {
 	}
 	p.mu.RUnlock()
 
-	return server.ListenAndServe()
+	if p.adminListenAddr == "" {
+		return p.serve(server)
+	}
+	// 管理面单独监听：任一监听器退出时关闭另一个并返回其错误。
+	admin := p.newHTTPServer(p.adminListenAddr, listenerAdmin)
+	errCh := make(chan error, 2)
+	go func() { errCh <- p.serve(admin) }()
+	go func() { errCh <- p.serve(server) }()
+	err := <-errCh
+	_ = admin.Close()
+	_ = server.Close()
+	return err
+}
+
+func (p *Server) newHTTPServer(addr string, role int) *http.Server {
+	return &http.Server{
+		Addr:         addr,
+		Handler:      p.handler(role),
+		ReadTimeout:  30 * time.Second,
+		WriteTimeout: 0, // 支持流式响应
+	}
+}
+
+func (p *Server) tlsEnabled() bool {
+	return p.bootstrap != nil && p.bootstrap.TLSEnabled()
+}
+
+// serve 按监听地址创建 TCP 或 unix socket 监听，并按是否配置证书以 HTTP 或 HTTPS 提供服务。
+func (p *Server) serve(server *http.Server) error {
+	ln, err := p.listen(server.Addr)
+	if err != nil {
+		return err
+	}
+	if p.tlsEnabled() {
+		return server.ServeTLS(ln, p.bootstrap.TLS.CertFile, p.bootstrap.TLS.KeyFile)
+	}
+	return server.Serve(ln)
 }
 
 // Stop 用于优雅关闭后台任务。
@@ -104,18 +258,48 @@ func (p *Server) Stop() {
 	if p.metricsScheduler != nil {
 		p.metricsScheduler.Stop()
 	}
+	if p.jobs != nil {
+		p.jobs.Stop()
+	}
+	if p.adaptiveWeight != nil {
+		p.adaptiveWeight.Stop()
+	}
+	if p.throughputTicker != nil {
+		p.throughputTicker.Stop()
+	}
+	if p.updates != nil {
+		p.updates.Stop()
+	}
+	if p.upstreamWatch != nil {
+		p.upstreamWatch.Stop()
+	}
+	if p.metricsFlusher != nil {
+		p.metricsFlusher.Stop()
+	}
+	if p.benchmarkSched != nil {
+		p.benchmarkSched.Stop()
+	}
+	if p.recorder != nil {
+		p.recorder.Stop()
+	}
+	if p.certWatch != nil {
+		p.certWatch.Stop()
+	}
 	if p.settingsStopCh != nil {
 		close(p.settingsStopCh)
 		p.settingsWg.Wait()
 	}
+	p.accessLog.close()
+	p.authEvents.close()
+	p.requestLogs.close()
 }
 
-// Handler 暴露 HTTP 处理器，便于测试或自定义服务器。
+// Handler 暴露同时提供管理面与代理转发的 HTTP 处理器，便于测试或自定义服务器。
 func (p *Server) Handler() http.Handler {
-	return p.handler()
+	return p.handler(listenerAll)
 }
 
-// startSettingsWatcher 周期刷新设置缓存，用于跨实例热更新。
+// startSettingsWatcher 周期刷新设置缓存，用于跨实例热更新；同时执行到期的定时配置变更并检测维护模式切换。
 func (p *Server) startSettingsWatcher(interval time.Duration) {
 	if p == nil || p.settingsCache == nil || interval <= 0 {
 		return
@@ -129,10 +313,17 @@ func (p *Server) startSettingsWatcher(interval time.Duration) {
 		defer p.settingsWg.Done()
 		ticker := time.NewTicker(interval)
 		defer ticker.Stop()
+		scheduled := time.NewTicker(scheduledSettingsInterval)
+		defer scheduled.Stop()
 		for {
 			select {
 			case <-ticker.C:
-				p.settingsCache.Refresh()
+				p.settingsCache.RefreshIfChanged()
+			case now := <-scheduled.C:
+				if p.settingsSched != nil {
+					p.settingsSched.applyDue(now)
+				}
+				p.checkMaintenance(now)
 			case <-p.settingsStopCh:
 				return
 			}
@@ -253,15 +444,30 @@ func (p *Server) loadAccountsFromStore(defaultUpstream *url.URL, defaultCfg stor
 		}
 
 		acc := &Account{
-			ID:          a.ID,
-			Name:        chooseNonEmpty(a.Name, a.ID),
-			Password:    password,
-			ProxyAPIKey: a.ProxyAPIKey,
-			IsAdmin:     a.IsAdmin,
-			Config:      cfg,
-			Nodes:       make(map[string]*Node),
-			FailedSet:   make(map[string]struct{}),
-			ActiveID:    active,
+			ID:           a.ID,
+			Name:         chooseNonEmpty(a.Name, a.ID),
+			Password:     password,
+			ProxyAPIKey:  a.ProxyAPIKey,
+			IsAdmin:      a.IsAdmin,
+			Config:       cfg,
+			Nodes:        make(map[string]*Node),
+			FailedSet:    make(map[string]struct{}),
+			ActiveID:     active,
+			Policy:       p.loadAccountPolicy(a.ID),
+			NodeTemplate: p.loadNodeTemplate(a.ID),
+			Key:          p.loadAccountKey(a.ID),
+		}
+		acc.ServiceAccounts = p.loadServiceAccounts(a.ID)
+		acc.Users = p.loadAccountUsers(a.ID)
+		acc.Invitations = p.loadAccountInvitations(a.ID)
+		acc.NodeHooks = p.loadNodeHooks(a.ID)
+		p.loadReplay(acc)
+		acc.PasswordMeta = p.loadPasswordMeta(a.ID)
+		acc.Display, acc.displayLoc = p.loadAccountDisplay(a.ID)
+		if rules, err := compileAccountPolicy(acc.Policy); err != nil {
+			p.logger.Printf("account %s policy rules ignored: %v", acc.ID, err)
+		} else {
+			acc.rules = rules
 		}
 
 		// 如果账号没有节点且是默认账号，创建一个默认节点以保证可用。
@@ -305,6 +511,10 @@ func (p *Server) loadAccountsFromStore(defaultUpstream *url.URL, defaultCfg stor
 					Failed:            r.Failed,
 					Disabled:          r.Disabled,
 					LastError:         r.LastError,
+					State:             r.State,
+					StateChangedAt:    r.StateChangedAt,
+					Headers:           r.Headers,
+					HealthInterval:    time.Duration(r.HealthIntervalSec) * time.Second,
 					Metrics: metrics{
 						Requests:          r.Requests,
 						FailCount:         r.FailCount,
@@ -325,6 +535,9 @@ func (p *Server) loadAccountsFromStore(defaultUpstream *url.URL, defaultCfg stor
 					acc.FailedSet[n.ID] = struct{}{}
 				}
 			}
+			p.loadNodeClientCerts(acc)
+			p.loadNodeCABundles(acc)
+			p.loadNodeDNS(acc)
 		}
 		p.registerAccount(acc)
 	}
@@ -342,6 +555,7 @@ func (p *Server) registerAccount(acc *Account) {
 	if acc.ProxyAPIKey != "" {
 		p.accounts[acc.ProxyAPIKey] = acc
 	}
+	p.indexServiceAccounts(acc)
 	if acc.ID == store.DefaultAccountID {
 		if p.defaultAccName != "" && acc.Name != p.defaultAccName {
 			acc.Name = p.defaultAccName
@@ -0,0 +1,347 @@
+package proxy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"qcc_plus/internal/store"
+)
+
+const (
+	serviceAccountsSettingKey = "account.service_accounts"
+	serviceKeyPrefix          = "qcc-sa-"
+)
+
+// ServiceAccount 账号下的非交互服务账号：没有密码、不能登录，仅通过独立的代理密钥调用，
+// 请求用量固定归因到 Label，与人工登录使用的账号密钥区分开。密钥只保存哈希，创建时返回一次明文。
+type ServiceAccount struct {
+	ID                string     `json:"id"`
+	Name              string     `json:"name"`
+	Label             string     `json:"label"`
+	KeyHash           string     `json:"key_hash"`
+	KeyHint           string     `json:"key_hint"` // 密钥前缀，便于识别
+	Disabled          bool       `json:"disabled"`
+	AllowNodeOverride bool       `json:"allow_node_override,omitempty"` // 允许该服务账号的请求通过 X-QCC-Node 强制指定节点
+	AllowedPaths      []string   `json:"allowed_paths,omitempty"`       // 该服务账号允许调用的上游路径，规则同账号策略，空为不限制
+	CreatedAt         time.Time  `json:"created_at"`
+	CreatedBy         string     `json:"created_by,omitempty"`
+	LastUsedAt        *time.Time `json:"last_used_at,omitempty"`
+}
+
+func hashServiceKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// loadServiceAccounts 从配置表读取账号下的服务账号。
+func (p *Server) loadServiceAccounts(accountID string) []ServiceAccount {
+	var list []ServiceAccount
+	if p.store == nil {
+		return list
+	}
+	setting, err := p.store.GetSetting(serviceAccountsSettingKey, "account", accountID)
+	if err != nil || setting == nil {
+		return list
+	}
+	if b, err := json.Marshal(setting.Value); err == nil {
+		_ = json.Unmarshal(b, &list)
+	}
+	return list
+}
+
+func (p *Server) persistServiceAccounts(accountID string, list []ServiceAccount, updatedBy string) error {
+	if p.store == nil {
+		return nil
+	}
+	id := accountID
+	desc := "账号下的服务账号（仅保存密钥哈希）"
+	setting := &store.Setting{
+		Key:         serviceAccountsSettingKey,
+		Scope:       "account",
+		AccountID:   &id,
+		Value:       list,
+		DataType:    "array",
+		Category:    "security",
+		Description: &desc,
+	}
+	if updatedBy != "" {
+		setting.UpdatedBy = &updatedBy
+	}
+	return p.store.UpsertSetting(setting)
+}
+
+// serviceAccountByKey 按代理密钥查找服务账号及其所属账号，并记录最近使用时间；已停用的服务账号返回 disabled=true。
+func (p *Server) serviceAccountByKey(key string) (acc *Account, sa ServiceAccount, disabled bool) {
+	if key == "" {
+		return nil, ServiceAccount{}, false
+	}
+	hash := hashServiceKey(key)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	acc = p.serviceKeys[hash]
+	if acc == nil {
+		return nil, ServiceAccount{}, false
+	}
+	for i := range acc.ServiceAccounts {
+		if s := &acc.ServiceAccounts[i]; s.KeyHash == hash {
+			if !s.Disabled {
+				now := time.Now().UTC()
+				s.LastUsedAt = &now
+				// 使用时间按最短间隔异步落库，与账号密钥的使用记录一致。
+				if now.Sub(acc.servicePersistedAt) >= keyUsagePersistEach {
+					acc.servicePersistedAt = now
+					list := append([]ServiceAccount(nil), acc.ServiceAccounts...)
+					go func(id string) {
+						if err := p.persistServiceAccounts(id, list, ""); err != nil {
+							p.logger.Printf("persist service account usage for account %s failed: %v", id, err)
+						}
+					}(acc.ID)
+				}
+			}
+			return acc, *s, s.Disabled
+		}
+	}
+	return nil, ServiceAccount{}, false
+}
+
+// peekServiceAccount 按代理密钥只读查找服务账号，不记录使用时间，供路由推演等无副作用场景使用。
+func (p *Server) peekServiceAccount(key string) (*Account, *ServiceAccount) {
+	if key == "" {
+		return nil, nil
+	}
+	hash := hashServiceKey(key)
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	acc := p.serviceKeys[hash]
+	if acc == nil {
+		return nil, nil
+	}
+	for _, sa := range acc.ServiceAccounts {
+		if sa.KeyHash == hash {
+			return acc, &sa
+		}
+	}
+	return nil, nil
+}
+
+// indexServiceAccounts 重建账号服务账号的密钥索引，调用方需持有 p.mu 写锁。
+func (p *Server) indexServiceAccounts(acc *Account) {
+	for hash, owner := range p.serviceKeys {
+		if owner == acc {
+			delete(p.serviceKeys, hash)
+		}
+	}
+	for _, sa := range acc.ServiceAccounts {
+		p.serviceKeys[sa.KeyHash] = acc
+	}
+}
+
+// updateServiceAccounts 在写锁内修改账号的服务账号列表并持久化。
+func (p *Server) updateServiceAccounts(acc *Account, updatedBy string, fn func(list []ServiceAccount) ([]ServiceAccount, error)) ([]ServiceAccount, error) {
+	p.mu.Lock()
+	list, err := fn(append([]ServiceAccount(nil), acc.ServiceAccounts...))
+	if err != nil {
+		p.mu.Unlock()
+		return nil, err
+	}
+	acc.ServiceAccounts = list
+	p.indexServiceAccounts(acc)
+	p.mu.Unlock()
+	return list, p.persistServiceAccounts(acc.ID, list, updatedBy)
+}
+
+var errServiceAccountNotFound = errors.New("service account not found")
+
+func serviceAccountView(sa ServiceAccount) map[string]interface{} {
+	return map[string]interface{}{
+		"id":                  sa.ID,
+		"name":                sa.Name,
+		"label":               sa.Label,
+		"key_hint":            sa.KeyHint,
+		"disabled":            sa.Disabled,
+		"allow_node_override": sa.AllowNodeOverride,
+		"allowed_paths":       sa.AllowedPaths,
+		"created_at":          sa.CreatedAt,
+		"created_by":          sa.CreatedBy,
+		"last_used_at":        sa.LastUsedAt,
+	}
+}
+
+func validateServiceLabel(label string) error {
+	if label == "" {
+		return errors.New("label required")
+	}
+	if len(label) > maxLabelLength {
+		return fmt.Errorf("label exceeds %d characters", maxLabelLength)
+	}
+	return nil
+}
+
+// GET/POST/PUT/DELETE /admin/api/accounts/service-accounts?account_id=&id=
+// POST 创建服务账号并返回一次性明文密钥；PUT 修改名称、标签、节点指定权限、允许路径或启停；DELETE 删除。
+func (p *Server) handleServiceAccounts(w http.ResponseWriter, r *http.Request) {
+	caller := accountFromCtx(r)
+	if caller == nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		return
+	}
+	q := r.URL.Query()
+	accountID := chooseNonEmpty(q.Get("account_id"), caller.ID)
+	if !canManageAccount(r.Context(), accountID) {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+		return
+	}
+	acc := p.getAccountByID(accountID)
+	if acc == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "account not found"})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		p.mu.RLock()
+		list := make([]map[string]interface{}, 0, len(acc.ServiceAccounts))
+		for _, sa := range acc.ServiceAccounts {
+			list = append(list, serviceAccountView(sa))
+		}
+		p.mu.RUnlock()
+		writeJSON(w, http.StatusOK, map[string]interface{}{"account_id": acc.ID, "service_accounts": list})
+	case http.MethodPost:
+		var req struct {
+			Name              string   `json:"name"`
+			Label             string   `json:"label"`
+			AllowNodeOverride bool     `json:"allow_node_override"`
+			AllowedPaths      []string `json:"allowed_paths"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
+			return
+		}
+		req.Name = strings.TrimSpace(req.Name)
+		if req.Name == "" {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "name required"})
+			return
+		}
+		req.Label = chooseNonEmpty(strings.TrimSpace(req.Label), req.Name)
+		if err := validateServiceLabel(req.Label); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		if err := validateAllowedPaths(req.AllowedPaths); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		key := serviceKeyPrefix + randomToken(24)
+		sa := ServiceAccount{
+			ID:                fmt.Sprintf("sa-%d", time.Now().UnixNano()),
+			Name:              req.Name,
+			Label:             req.Label,
+			KeyHash:           hashServiceKey(key),
+			KeyHint:           key[:len(serviceKeyPrefix)+6],
+			CreatedAt:         time.Now().UTC(),
+			CreatedBy:         caller.ID,
+			AllowNodeOverride: req.AllowNodeOverride,
+			AllowedPaths:      req.AllowedPaths,
+		}
+		if _, err := p.updateServiceAccounts(acc, caller.ID, func(list []ServiceAccount) ([]ServiceAccount, error) {
+			return append(list, sa), nil
+		}); err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		p.audit(acc.ID, auditActor(r), "account.service_account.create", sa.ID, map[string]string{"name": sa.Name, "label": sa.Label})
+		writeJSON(w, http.StatusCreated, map[string]interface{}{
+			"service_account": serviceAccountView(sa),
+			"api_key":         key,
+		})
+	case http.MethodPut:
+		id := q.Get("id")
+		var req struct {
+			Name              *string   `json:"name"`
+			Label             *string   `json:"label"`
+			Disabled          *bool     `json:"disabled"`
+			AllowNodeOverride *bool     `json:"allow_node_override"`
+			AllowedPaths      *[]string `json:"allowed_paths"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
+			return
+		}
+		if req.Label != nil {
+			if err := validateServiceLabel(strings.TrimSpace(*req.Label)); err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+				return
+			}
+		}
+		if req.AllowedPaths != nil {
+			if err := validateAllowedPaths(*req.AllowedPaths); err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+				return
+			}
+		}
+		var updated ServiceAccount
+		_, err := p.updateServiceAccounts(acc, caller.ID, func(list []ServiceAccount) ([]ServiceAccount, error) {
+			for i := range list {
+				if list[i].ID != id {
+					continue
+				}
+				if req.Name != nil && strings.TrimSpace(*req.Name) != "" {
+					list[i].Name = strings.TrimSpace(*req.Name)
+				}
+				if req.Label != nil {
+					list[i].Label = strings.TrimSpace(*req.Label)
+				}
+				if req.Disabled != nil {
+					list[i].Disabled = *req.Disabled
+				}
+				if req.AllowNodeOverride != nil {
+					list[i].AllowNodeOverride = *req.AllowNodeOverride
+				}
+				if req.AllowedPaths != nil {
+					list[i].AllowedPaths = *req.AllowedPaths
+				}
+				updated = list[i]
+				return list, nil
+			}
+			return nil, errServiceAccountNotFound
+		})
+		if errors.Is(err, errServiceAccountNotFound) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		p.audit(acc.ID, auditActor(r), "account.service_account.update", id, req)
+		writeJSON(w, http.StatusOK, map[string]interface{}{"service_account": serviceAccountView(updated)})
+	case http.MethodDelete:
+		id := q.Get("id")
+		_, err := p.updateServiceAccounts(acc, caller.ID, func(list []ServiceAccount) ([]ServiceAccount, error) {
+			for i := range list {
+				if list[i].ID == id {
+					return append(list[:i], list[i+1:]...), nil
+				}
+			}
+			return nil, errServiceAccountNotFound
+		})
+		if errors.Is(err, errServiceAccountNotFound) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		p.audit(acc.ID, auditActor(r), "account.service_account.delete", id, nil)
+		writeJSON(w, http.StatusOK, map[string]string{"deleted": id})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
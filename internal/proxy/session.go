@@ -1,10 +1,17 @@
 package proxy
 
 import (
+	"context"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
+	"errors"
+	"log"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"qcc_plus/internal/store"
 )
 
 // Session 表示一次登录会话。
@@ -14,15 +21,61 @@ type Session struct {
 	IsAdmin   bool
 	CreatedAt time.Time
 	ExpiresAt time.Time
+
+	// 账号成员登录时记录成员信息，账号本身登录时为空。
+	UserID   string
+	UserName string
+	Role     string
+
+	impersonating      atomic.Pointer[impersonation] // 管理员代入的租户视图，不持久化
+	mustChangePassword atomic.Bool                   // 口令已过期，修改前只能访问改密接口
+	checkedAt          atomic.Int64                  // 上次与存储核对的时间（UnixNano）
+}
+
+// impersonation 返回会话当前的代入信息。
+func (s *Session) impersonation() *impersonation {
+	if s == nil {
+		return nil
+	}
+	return s.impersonating.Load()
+}
+
+func (s *Session) startImpersonation(imp *impersonation) {
+	s.impersonating.Store(imp)
+}
+
+// endImpersonation 结束代入并返回原代入信息（未代入时为 nil）。
+func (s *Session) endImpersonation() *impersonation {
+	return s.impersonating.Swap(nil)
+}
+
+// sessionStore 会话的持久化存储，由 *store.Store 实现。
+type sessionStore interface {
+	SaveSession(ctx context.Context, rec store.SessionRecord) error
+	GetSession(ctx context.Context, tokenHash string) (*store.SessionRecord, error)
+	DeleteSession(ctx context.Context, tokenHash string) error
+	DeleteUserSessions(ctx context.Context, userID string) error
+	DeleteAccountSessions(ctx context.Context, accountID string) error
+	DeleteExpiredSessions(ctx context.Context, before time.Time) (int64, error)
 }
 
-// SessionManager 管理用户会话，使用内存同步 Map 存储。
+// SessionManager 管理用户会话，使用内存同步 Map 存储。配置了存储时会话同时写入 sessions 表，
+// 重启或请求落到其他实例时按 token 从存储加载；缓存的会话每隔 sessionRecheckInterval 与存储核对一次，
+// 其他实例注销或删除的会话最迟在这段时间后失效。存储读写失败时退回仅内存。
 type SessionManager struct {
 	sessions sync.Map
 	ttl      time.Duration
+	persist  sessionStore
+	logger   *log.Logger
+
+	lastPrune atomic.Int64 // 上次清理存储中过期会话的时间（UnixNano）
 }
 
-const defaultSessionTTL = 24 * time.Hour
+const (
+	defaultSessionTTL      = 24 * time.Hour
+	sessionRecheckInterval = time.Minute
+	sessionPruneInterval   = time.Hour
+)
 
 // NewSessionManager 创建会话管理器，ttl<=0 时使用默认 24h。
 func NewSessionManager(ttl time.Duration) *SessionManager {
@@ -47,9 +100,33 @@ func (m *SessionManager) Create(accountID string, isAdmin bool) *Session {
 		ExpiresAt: now.Add(m.ttl),
 	}
 	m.sessions.Store(token, sess)
+	m.Save(sess)
+	m.pruneExpired(now)
 	return sess
 }
 
+// Save 将会话的当前状态（成员信息、是否需要改密）写入存储，未配置存储时不做任何事。
+func (m *SessionManager) Save(sess *Session) {
+	if m == nil || m.persist == nil || sess == nil {
+		return
+	}
+	sess.checkedAt.Store(time.Now().UnixNano())
+	err := m.persist.SaveSession(context.Background(), store.SessionRecord{
+		TokenHash:          hashSessionToken(sess.Token),
+		AccountID:          sess.AccountID,
+		IsAdmin:            sess.IsAdmin,
+		UserID:             sess.UserID,
+		UserName:           sess.UserName,
+		Role:               sess.Role,
+		MustChangePassword: sess.mustChangePassword.Load(),
+		CreatedAt:          sess.CreatedAt,
+		ExpiresAt:          sess.ExpiresAt,
+	})
+	if err != nil {
+		m.logf("save session failed: %v", err)
+	}
+}
+
 // Get 根据 token 读取会话，过期会自动删除。
 func (m *SessionManager) Get(token string) *Session {
 	if m == nil || token == "" {
@@ -58,13 +135,58 @@ func (m *SessionManager) Get(token string) *Session {
 	if v, ok := m.sessions.Load(token); ok {
 		if sess, ok2 := v.(*Session); ok2 {
 			if time.Now().After(sess.ExpiresAt) {
-				m.sessions.Delete(token)
+				m.Delete(token)
 				return nil
 			}
+			if m.persist != nil && time.Since(time.Unix(0, sess.checkedAt.Load())) > sessionRecheckInterval {
+				return m.recheck(token, sess)
+			}
 			return sess
 		}
 	}
-	return nil
+	return m.load(token)
+}
+
+// recheck 核对缓存的会话在存储中是否仍然存在；存储不可用时继续使用缓存。
+func (m *SessionManager) recheck(token string, sess *Session) *Session {
+	_, err := m.persist.GetSession(context.Background(), hashSessionToken(token))
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		m.sessions.Delete(token)
+		return nil
+	case err != nil:
+		m.logf("check session failed: %v", err)
+	}
+	sess.checkedAt.Store(time.Now().UnixNano())
+	return sess
+}
+
+// load 从存储加载本实例内存中没有的会话（重启后或由其他实例创建）。
+func (m *SessionManager) load(token string) *Session {
+	if m.persist == nil {
+		return nil
+	}
+	rec, err := m.persist.GetSession(context.Background(), hashSessionToken(token))
+	if err != nil {
+		if !errors.Is(err, store.ErrNotFound) {
+			m.logf("load session failed: %v", err)
+		}
+		return nil
+	}
+	sess := &Session{
+		Token:     token,
+		AccountID: rec.AccountID,
+		IsAdmin:   rec.IsAdmin,
+		CreatedAt: rec.CreatedAt,
+		ExpiresAt: rec.ExpiresAt,
+		UserID:    rec.UserID,
+		UserName:  rec.UserName,
+		Role:      rec.Role,
+	}
+	sess.mustChangePassword.Store(rec.MustChangePassword)
+	sess.checkedAt.Store(time.Now().UnixNano())
+	actual, _ := m.sessions.LoadOrStore(token, sess)
+	return actual.(*Session)
 }
 
 // Delete 删除指定 token 的会话。
@@ -73,6 +195,70 @@ func (m *SessionManager) Delete(token string) {
 		return
 	}
 	m.sessions.Delete(token)
+	if m.persist != nil {
+		if err := m.persist.DeleteSession(context.Background(), hashSessionToken(token)); err != nil {
+			m.logf("delete session failed: %v", err)
+		}
+	}
+}
+
+// DeleteUser 删除账号成员的全部会话。
+func (m *SessionManager) DeleteUser(userID string) {
+	if m == nil || userID == "" {
+		return
+	}
+	m.sessions.Range(func(k, v any) bool {
+		if sess, ok := v.(*Session); ok && sess.UserID == userID {
+			m.sessions.Delete(k)
+		}
+		return true
+	})
+	if m.persist != nil {
+		if err := m.persist.DeleteUserSessions(context.Background(), userID); err != nil {
+			m.logf("delete user sessions failed: %v", err)
+		}
+	}
+}
+
+// DeleteAccount 删除属于该账号的全部会话（含成员会话）。
+func (m *SessionManager) DeleteAccount(accountID string) {
+	if m == nil || accountID == "" {
+		return
+	}
+	m.sessions.Range(func(k, v any) bool {
+		if sess, ok := v.(*Session); ok && sess.AccountID == accountID {
+			m.sessions.Delete(k)
+		}
+		return true
+	})
+	if m.persist != nil {
+		if err := m.persist.DeleteAccountSessions(context.Background(), accountID); err != nil {
+			m.logf("delete account sessions failed: %v", err)
+		}
+	}
+}
+
+// pruneExpired 每隔 sessionPruneInterval 清理一次存储中已过期的会话。
+func (m *SessionManager) pruneExpired(now time.Time) {
+	last := m.lastPrune.Load()
+	if m.persist == nil || now.Sub(time.Unix(0, last)) < sessionPruneInterval || !m.lastPrune.CompareAndSwap(last, now.UnixNano()) {
+		return
+	}
+	if _, err := m.persist.DeleteExpiredSessions(context.Background(), now); err != nil {
+		m.logf("prune expired sessions failed: %v", err)
+	}
+}
+
+func (m *SessionManager) logf(format string, args ...any) {
+	if m.logger != nil {
+		m.logger.Printf(format, args...)
+	}
+}
+
+// hashSessionToken 存储中只保存 token 的 SHA-256，数据库泄露时无法直接冒用会话。
+func hashSessionToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
 
 // Validate 判断 token 是否仍然有效。
@@ -13,6 +13,7 @@ type SettingsCache struct {
 	mu       sync.RWMutex
 	data     map[string]any // key -> value
 	version  int64          // 全局版本号（最大设置版本）
+	seen     int64          // 上次全量加载时的变更日志版本号
 	store    store.SettingsStore
 	onChange []func(key string, value any) // 变更回调
 }
@@ -123,10 +124,31 @@ func (c *SettingsCache) Refresh() {
 	c.reload(true)
 }
 
+// RefreshIfChanged 仅在变更日志版本号前进时全量刷新，供多实例定时同步使用，
+// 其他实例的写入也会推进该版本号。
+func (c *SettingsCache) RefreshIfChanged() {
+	if c.store == nil {
+		return
+	}
+	version, err := c.store.GetGlobalVersion()
+	if err != nil {
+		c.Refresh()
+		return
+	}
+	c.mu.RLock()
+	seen := c.seen
+	c.mu.RUnlock()
+	if version > 0 && version == seen {
+		return
+	}
+	c.Refresh()
+}
+
 func (c *SettingsCache) reload(notify bool) {
 	if c.store == nil {
 		return
 	}
+	seen, _ := c.store.GetGlobalVersion()
 	settings, err := c.store.ListSettings("system", "", "")
 	if err != nil {
 		return
@@ -164,6 +186,7 @@ func (c *SettingsCache) reload(notify bool) {
 		}
 	}
 	c.data = newData
+	c.seen = seen
 	if maxVer > 0 {
 		c.version = maxVer
 	}
@@ -0,0 +1,198 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"qcc_plus/internal/store"
+)
+
+const (
+	settingsSecretMask     = "******"
+	maxSettingsExportBytes = 10 << 20
+)
+
+// settingsDiffEntry 一个存在差异的配置项，密钥类配置的值以掩码返回。
+type settingsDiffEntry struct {
+	Key   string `json:"key"`
+	Value any    `json:"value,omitempty"`
+	Left  any    `json:"left,omitempty"`
+	Right any    `json:"right,omitempty"`
+}
+
+// settingsDiffResult 以 left 为基准：added 仅 right 有，removed 仅 left 有，changed 两侧值不同；
+// unverified 为导出文件中已脱敏、无法比较的密钥类配置。
+type settingsDiffResult struct {
+	Left       string              `json:"left"`
+	Right      string              `json:"right"`
+	Added      []settingsDiffEntry `json:"added"`
+	Removed    []settingsDiffEntry `json:"removed"`
+	Changed    []settingsDiffEntry `json:"changed"`
+	Unverified []string            `json:"unverified"`
+	Unchanged  int                 `json:"unchanged"`
+	Identical  bool                `json:"identical"`
+}
+
+// DiffSettings GET /api/settings/diff?left=accountA&right=accountB
+// POST /api/settings/diff?left=accountA 请求体为 GET /api/settings 的响应或配置数组（另一环境的导出），作为 right。
+// left/right 为账号 ID，取 "system" 或留空表示系统级配置。
+func (h *SettingsHandler) DiffSettings(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if !isAdmin(r.Context()) {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+		return
+	}
+	if h.store == nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "settings store not enabled"})
+		return
+	}
+
+	leftName := settingsSideName(r.URL.Query().Get("left"))
+	left, err := h.loadSettingsSide(leftName)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	var (
+		right     []store.Setting
+		rightName string
+		uploaded  = r.Method == http.MethodPost
+	)
+	if uploaded {
+		rightName = "upload"
+		right, err = decodeSettingsExport(http.MaxBytesReader(w, r.Body, maxSettingsExportBytes))
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid export: " + err.Error()})
+			return
+		}
+	} else {
+		if r.URL.Query().Get("right") == "" {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "right required"})
+			return
+		}
+		rightName = settingsSideName(r.URL.Query().Get("right"))
+		if right, err = h.loadSettingsSide(rightName); err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+	}
+
+	result := diffSettings(left, right, uploaded)
+	result.Left, result.Right = leftName, rightName
+	writeJSON(w, http.StatusOK, result)
+}
+
+func settingsSideName(v string) string {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return "system"
+	}
+	return v
+}
+
+// loadSettingsSide 读取一侧的配置：system 为系统级，其余按账号 ID 读取账号级配置。
+func (h *SettingsHandler) loadSettingsSide(name string) ([]store.Setting, error) {
+	if name == "system" {
+		return h.store.ListSettings("system", "", "")
+	}
+	return h.store.ListSettings("account", "", name)
+}
+
+// decodeSettingsExport 解析导出文件，兼容 {"data": [...]} 与裸数组两种格式。
+func decodeSettingsExport(r io.Reader) ([]store.Setting, error) {
+	var raw json.RawMessage
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return nil, err
+	}
+	var list []store.Setting
+	if trimmed := bytes.TrimSpace(raw); len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(trimmed, &list); err != nil {
+			return nil, err
+		}
+		return list, nil
+	}
+	var wrapped struct {
+		Data []store.Setting `json:"data"`
+	}
+	if err := json.Unmarshal(raw, &wrapped); err != nil {
+		return nil, err
+	}
+	return wrapped.Data, nil
+}
+
+// diffSettings 按 key 比较两侧配置；rightMasked 为 true 时 right 来自导出文件，其中的密钥值可能已脱敏。
+func diffSettings(left, right []store.Setting, rightMasked bool) settingsDiffResult {
+	res := settingsDiffResult{
+		Added:      []settingsDiffEntry{},
+		Removed:    []settingsDiffEntry{},
+		Changed:    []settingsDiffEntry{},
+		Unverified: []string{},
+	}
+	index := func(list []store.Setting) map[string]store.Setting {
+		m := make(map[string]store.Setting, len(list))
+		for _, s := range list {
+			m[s.Key] = s
+		}
+		return m
+	}
+	lm, rm := index(left), index(right)
+	keys := make([]string, 0, len(lm)+len(rm))
+	for k := range lm {
+		keys = append(keys, k)
+	}
+	for k := range rm {
+		if _, ok := lm[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		l, inLeft := lm[k]
+		rs, inRight := rm[k]
+		switch {
+		case !inRight:
+			res.Removed = append(res.Removed, settingsDiffEntry{Key: k, Value: maskedSettingValue(l, false)})
+		case !inLeft:
+			res.Added = append(res.Added, settingsDiffEntry{Key: k, Value: maskedSettingValue(rs, false)})
+		case rightMasked && (l.IsSecret || rs.IsSecret) && rs.Value == settingsSecretMask:
+			res.Unverified = append(res.Unverified, k)
+		case settingValuesEqual(l.Value, rs.Value):
+			res.Unchanged++
+		default:
+			secret := l.IsSecret || rs.IsSecret
+			res.Changed = append(res.Changed, settingsDiffEntry{
+				Key:   k,
+				Left:  maskedSettingValue(l, secret),
+				Right: maskedSettingValue(rs, secret),
+			})
+		}
+	}
+	res.Identical = len(res.Added) == 0 && len(res.Removed) == 0 && len(res.Changed) == 0 && len(res.Unverified) == 0
+	return res
+}
+
+func maskedSettingValue(s store.Setting, secret bool) any {
+	if secret || s.IsSecret {
+		return settingsSecretMask
+	}
+	return s.Value
+}
+
+// settingValuesEqual 以 JSON 编码结果比较配置值，避免数字类型与 map 顺序带来的误判。
+func settingValuesEqual(a, b any) bool {
+	ab, err1 := json.Marshal(a)
+	bb, err2 := json.Marshal(b)
+	if err1 != nil || err2 != nil {
+		return false
+	}
+	return bytes.Equal(ab, bb)
+}
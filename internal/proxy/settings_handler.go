@@ -3,6 +3,7 @@ package proxy
 import (
 	"encoding/json"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"qcc_plus/internal/store"
@@ -10,8 +11,9 @@ import (
 
 // SettingsHandler 配置管理 API
 type SettingsHandler struct {
-	store store.SettingsStore
-	cache *SettingsCache
+	store     store.SettingsStore
+	cache     *SettingsCache
+	scheduler *settingsScheduler
 }
 
 // ListSettings GET /api/settings?scope=system&category=monitor&account_id=xxx
@@ -29,6 +31,17 @@ func (h *SettingsHandler) ListSettings(w http.ResponseWriter, r *http.Request) {
 	category := r.URL.Query().Get("category")
 	accountID := r.URL.Query().Get("account_id")
 
+	// 先用轻量的版本戳判断缓存是否有效，命中时无需读取完整列表。
+	etag := ""
+	if stamp, err := h.store.GetSettingsStamp(); err == nil {
+		etag = computeETag(stamp, scope, category, accountID)
+		if etagMatches(r, etag) {
+			w.Header().Set("ETag", etag)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
 	settings, err := h.store.ListSettings(scope, category, accountID)
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
@@ -37,14 +50,19 @@ func (h *SettingsHandler) ListSettings(w http.ResponseWriter, r *http.Request) {
 
 	for i := range settings {
 		if settings[i].IsSecret {
-			settings[i].Value = "******"
+			settings[i].Value = settingsSecretMask
 		}
 	}
 
-	writeJSON(w, http.StatusOK, map[string]any{
+	resp := map[string]any{
 		"data":    settings,
 		"version": h.getGlobalVersion(),
-	})
+	}
+	if etag == "" {
+		writeJSON(w, http.StatusOK, resp)
+		return
+	}
+	writeJSONWithETag(w, r, etag, resp)
 }
 
 // HandleSetting dispatches GET/PUT/DELETE for /api/settings/:key
@@ -82,6 +100,61 @@ func (h *SettingsHandler) GetVersion(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, map[string]any{"version": version})
 }
 
+// ListChanges GET /api/settings/changes?since_version=&limit=
+// 返回全局版本号大于 since_version 的配置变更（按版本升序），供外部配置消费方增量同步；
+// has_more 为 true 时以最后一条的 version 继续拉取。
+func (h *SettingsHandler) ListChanges(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if !isAdmin(r.Context()) {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+		return
+	}
+	if h.store == nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "settings store not enabled"})
+		return
+	}
+	q := r.URL.Query()
+	var since int64
+	if v := q.Get("since_version"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid since_version"})
+			return
+		}
+		since = n
+	}
+	limit := 500
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > 5000 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "limit must be between 1 and 5000"})
+			return
+		}
+		limit = n
+	}
+	// 多取一条用于判断是否还有后续
+	changes, err := h.store.ListSettingChanges(since, limit+1)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	hasMore := len(changes) > limit
+	if hasMore {
+		changes = changes[:limit]
+	}
+	if changes == nil {
+		changes = []store.SettingChange{}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"changes":  changes,
+		"version":  h.getGlobalVersion(),
+		"has_more": hasMore,
+	})
+}
+
 // GetSetting GET /api/settings/:key
 func (h *SettingsHandler) GetSetting(w http.ResponseWriter, r *http.Request, key string) {
 	if !isAdmin(r.Context()) {
@@ -105,7 +178,7 @@ func (h *SettingsHandler) GetSetting(w http.ResponseWriter, r *http.Request, key
 		return
 	}
 	if setting.IsSecret {
-		setting.Value = "******"
+		setting.Value = settingsSecretMask
 	}
 	writeJSON(w, http.StatusOK, map[string]any{
 		"data":    setting,
@@ -135,7 +208,6 @@ func (h *SettingsHandler) UpdateSetting(w http.ResponseWriter, r *http.Request,
 		Description *string `json:"description"`
 		IsSecret    *bool   `json:"is_secret"`
 		Version     int     `json:"version"`
-		UpdatedBy   *string `json:"updated_by"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
@@ -149,6 +221,8 @@ func (h *SettingsHandler) UpdateSetting(w http.ResponseWriter, r *http.Request,
 	if req.AccountID != nil {
 		accountID = *req.AccountID
 	}
+	// 操作人取自会话，不信任请求体
+	actor := auditActor(r)
 
 	existing, err := h.store.GetSetting(key, scope, accountID)
 	if err != nil && err != store.ErrNotFound {
@@ -167,7 +241,7 @@ func (h *SettingsHandler) UpdateSetting(w http.ResponseWriter, r *http.Request,
 			Category:    req.Category,
 			Description: req.Description,
 			IsSecret:    false,
-			UpdatedBy:   req.UpdatedBy,
+			UpdatedBy:   &actor,
 		}
 		if req.IsSecret != nil {
 			setting.IsSecret = *req.IsSecret
@@ -201,7 +275,7 @@ func (h *SettingsHandler) UpdateSetting(w http.ResponseWriter, r *http.Request,
 		Category:  existing.Category,
 		IsSecret:  existing.IsSecret,
 		Version:   req.Version,
-		UpdatedBy: req.UpdatedBy,
+		UpdatedBy: &actor,
 	}
 	if req.DataType != "" {
 		setting.DataType = req.DataType
@@ -254,7 +328,10 @@ func (h *SettingsHandler) BatchUpdate(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
 		return
 	}
+	actor := auditActor(r)
 	for i := range req.Settings {
+		// 操作人取自会话，忽略请求体中的 updated_by
+		req.Settings[i].UpdatedBy = &actor
 		req.Settings[i].Key = strings.TrimSpace(req.Settings[i].Key)
 		if req.Settings[i].Key == "" {
 			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "key required"})
@@ -296,7 +373,7 @@ func (h *SettingsHandler) DeleteSetting(w http.ResponseWriter, r *http.Request,
 	scope := r.URL.Query().Get("scope")
 	accountID := r.URL.Query().Get("account_id")
 
-	if err := h.store.DeleteSetting(key, scope, accountID); err != nil {
+	if err := h.store.DeleteSettingBy(key, scope, accountID, auditActor(r)); err != nil {
 		if err == store.ErrNotFound {
 			writeJSON(w, http.StatusNotFound, map[string]string{"error": "not found"})
 			return
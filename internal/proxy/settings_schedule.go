@@ -0,0 +1,339 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"qcc_plus/internal/store"
+)
+
+const (
+	scheduledSettingsKey      = "settings.scheduled_changes"
+	scheduledSettingsPrefix   = "/api/settings/scheduled/"
+	scheduledSettingsInterval = 5 * time.Second
+	scheduledSettingsKeep     = 100 // 已执行/已取消记录最多保留条数
+)
+
+// 定时配置变更状态。
+const (
+	scheduledPending   = "pending"
+	scheduledApplied   = "applied"
+	scheduledCancelled = "cancelled"
+	scheduledFailed    = "failed"
+)
+
+// scheduledSettingChange 一条在指定时间生效的配置变更。
+type scheduledSettingChange struct {
+	ID          string     `json:"id"`
+	Key         string     `json:"key"`
+	Scope       string     `json:"scope"`
+	AccountID   *string    `json:"account_id,omitempty"`
+	Value       any        `json:"value"`
+	DataType    string     `json:"data_type,omitempty"` // 仅在配置不存在时用于创建
+	ApplyAt     time.Time  `json:"apply_at"`
+	Status      string     `json:"status"`
+	CreatedBy   string     `json:"created_by,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CancelledBy string     `json:"cancelled_by,omitempty"`
+	DoneAt      *time.Time `json:"done_at,omitempty"` // 执行或取消时间
+	Version     int        `json:"version,omitempty"` // 执行后配置的新版本号
+	Error       string     `json:"error,omitempty"`
+}
+
+var errScheduledChangeNotPending = errors.New("scheduled change is not pending")
+
+// settingsScheduler 保存待生效的配置变更（以系统配置 settings.scheduled_changes 持久化，多实例共享），
+// 到期后按普通更新写入配置：版本号递增、刷新缓存并通过 WebSocket 通知管理员。
+type settingsScheduler struct {
+	store  store.SettingsStore
+	cache  *SettingsCache
+	hub    *WSHub
+	logger *log.Logger
+	mu     sync.Mutex
+}
+
+func newSettingsScheduler(s store.SettingsStore, cache *SettingsCache, hub *WSHub, logger *log.Logger) *settingsScheduler {
+	if logger == nil {
+		logger = log.Default()
+	}
+	return &settingsScheduler{store: s, cache: cache, hub: hub, logger: logger}
+}
+
+// load 读取全部定时变更，调用方需持有 s.mu。
+func (s *settingsScheduler) load() ([]scheduledSettingChange, error) {
+	var list []scheduledSettingChange
+	setting, err := s.store.GetSetting(scheduledSettingsKey, "system", "")
+	if errors.Is(err, store.ErrNotFound) || (err == nil && setting == nil) {
+		return list, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	b, err := json.Marshal(setting.Value)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// save 持久化定时变更，只保留最近的已完成记录，调用方需持有 s.mu。
+func (s *settingsScheduler) save(list []scheduledSettingChange) error {
+	sort.SliceStable(list, func(i, j int) bool { return list[i].ApplyAt.Before(list[j].ApplyAt) })
+	done := 0
+	for i := len(list) - 1; i >= 0; i-- {
+		if list[i].Status == scheduledPending {
+			continue
+		}
+		if done++; done > scheduledSettingsKeep {
+			list = append(list[:i], list[i+1:]...)
+		}
+	}
+	desc := "定时生效的配置变更"
+	return s.store.UpsertSetting(&store.Setting{
+		Key:         scheduledSettingsKey,
+		Scope:       "system",
+		Value:       list,
+		DataType:    "array",
+		Category:    "performance",
+		Description: &desc,
+	})
+}
+
+// schedule 新增一条定时变更。
+func (s *settingsScheduler) schedule(change scheduledSettingChange) (scheduledSettingChange, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list, err := s.load()
+	if err != nil {
+		return change, err
+	}
+	change.ID = randomToken(8)
+	change.Status = scheduledPending
+	change.CreatedAt = time.Now().UTC()
+	list = append(list, change)
+	if err := s.save(list); err != nil {
+		return change, err
+	}
+	return change, nil
+}
+
+// cancel 取消尚未执行的定时变更。
+func (s *settingsScheduler) cancel(id, actor string) (scheduledSettingChange, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list, err := s.load()
+	if err != nil {
+		return scheduledSettingChange{}, err
+	}
+	for i := range list {
+		if list[i].ID != id {
+			continue
+		}
+		if list[i].Status != scheduledPending {
+			return list[i], errScheduledChangeNotPending
+		}
+		now := time.Now().UTC()
+		list[i].Status, list[i].DoneAt, list[i].CancelledBy = scheduledCancelled, &now, actor
+		if err := s.save(list); err != nil {
+			return list[i], err
+		}
+		return list[i], nil
+	}
+	return scheduledSettingChange{}, store.ErrNotFound
+}
+
+// applyDue 执行所有已到期的变更，返回本次执行的条数。
+func (s *settingsScheduler) applyDue(now time.Time) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list, err := s.load()
+	if err != nil {
+		s.logger.Printf("load scheduled settings failed: %v", err)
+		return 0
+	}
+	applied, changed := 0, false
+	for i := range list {
+		c := &list[i]
+		if c.Status != scheduledPending || c.ApplyAt.After(now) {
+			continue
+		}
+		done := now.UTC()
+		c.DoneAt, changed = &done, true
+		version, err := s.apply(c)
+		if err != nil {
+			c.Status, c.Error = scheduledFailed, err.Error()
+			s.logger.Printf("apply scheduled setting %s (%s) failed: %v", c.Key, c.ID, err)
+			continue
+		}
+		c.Status, c.Version = scheduledApplied, version
+		applied++
+	}
+	if !changed {
+		return 0
+	}
+	if err := s.save(list); err != nil {
+		s.logger.Printf("save scheduled settings failed: %v", err)
+	}
+	return applied
+}
+
+// apply 按普通更新写入配置：沿用已有配置的类型、分类与描述，版本号由存储递增。
+func (s *settingsScheduler) apply(c *scheduledSettingChange) (int, error) {
+	accountID := ""
+	if c.AccountID != nil {
+		accountID = *c.AccountID
+	}
+	setting := &store.Setting{
+		Key:       c.Key,
+		Scope:     c.Scope,
+		AccountID: c.AccountID,
+		Value:     c.Value,
+		DataType:  c.DataType,
+	}
+	if c.CreatedBy != "" {
+		by := c.CreatedBy
+		setting.UpdatedBy = &by
+	}
+	existing, err := s.store.GetSetting(c.Key, c.Scope, accountID)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		return 0, err
+	}
+	if existing != nil {
+		setting.DataType = existing.DataType
+		setting.Category = existing.Category
+		setting.Description = existing.Description
+		setting.IsSecret = existing.IsSecret
+	}
+	if err := s.store.UpsertSetting(setting); err != nil {
+		return 0, err
+	}
+	if c.Scope == "system" && s.cache != nil {
+		s.cache.UpdateLocal(c.Key, c.Value, int64(setting.Version))
+	}
+	payload := map[string]interface{}{
+		"key":          c.Key,
+		"scope":        c.Scope,
+		"version":      setting.Version,
+		"scheduled_id": c.ID,
+	}
+	if c.AccountID != nil {
+		payload["account_id"] = *c.AccountID
+	}
+	s.hub.BroadcastAdmins("settings_changed", payload)
+	return setting.Version, nil
+}
+
+// list 返回定时变更，all 为 false 时仅返回待执行的。
+func (s *settingsScheduler) list(all bool) ([]scheduledSettingChange, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]scheduledSettingChange, 0, len(list))
+	for _, c := range list {
+		if all || c.Status == scheduledPending {
+			out = append(out, c)
+		}
+	}
+	return out, nil
+}
+
+// ScheduledChanges GET/POST /api/settings/scheduled、DELETE /api/settings/scheduled/:id
+// POST 请求体: {"key": "...", "value": any, "scope": "system", "account_id": null, "apply_at": "RFC3339"}
+func (h *SettingsHandler) ScheduledChanges(w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(r.Context()) {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+		return
+	}
+	if h.scheduler == nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "settings store not enabled"})
+		return
+	}
+	id := ""
+	if strings.HasPrefix(r.URL.Path, scheduledSettingsPrefix) {
+		id = strings.Trim(strings.TrimPrefix(r.URL.Path, scheduledSettingsPrefix), "/")
+	}
+
+	switch {
+	case r.Method == http.MethodGet && id == "":
+		list, err := h.scheduler.list(r.URL.Query().Get("all") == "true")
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"data": list})
+	case r.Method == http.MethodPost && id == "":
+		var req struct {
+			Key       string    `json:"key"`
+			Value     any       `json:"value"`
+			Scope     string    `json:"scope"`
+			AccountID *string   `json:"account_id"`
+			DataType  string    `json:"data_type"`
+			ApplyAt   time.Time `json:"apply_at"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
+			return
+		}
+		req.Key = strings.TrimSpace(req.Key)
+		if req.Scope == "" {
+			req.Scope = "system"
+		}
+		switch {
+		case req.Key == "" || req.Key == scheduledSettingsKey:
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid key"})
+			return
+		case req.Scope != "system" && req.Scope != "account":
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "scope must be system or account"})
+			return
+		case req.Scope == "account" && (req.AccountID == nil || *req.AccountID == ""):
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "account_id required"})
+			return
+		case !req.ApplyAt.After(time.Now()):
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "apply_at must be in the future"})
+			return
+		}
+		if req.Scope == "system" {
+			req.AccountID = nil
+		}
+		change, err := h.scheduler.schedule(scheduledSettingChange{
+			Key:       req.Key,
+			Scope:     req.Scope,
+			AccountID: req.AccountID,
+			Value:     req.Value,
+			DataType:  req.DataType,
+			ApplyAt:   req.ApplyAt.UTC(),
+			CreatedBy: auditActor(r),
+		})
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusCreated, map[string]any{"data": change})
+	case r.Method == http.MethodDelete && id != "":
+		change, err := h.scheduler.cancel(id, auditActor(r))
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "not found"})
+		case errors.Is(err, errScheduledChangeNotPending):
+			writeJSON(w, http.StatusConflict, map[string]any{"error": err.Error(), "status": change.Status})
+		case err != nil:
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		default:
+			writeJSON(w, http.StatusOK, map[string]any{"data": change})
+		}
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,486 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"qcc_plus/internal/store"
+)
+
+// settingViolation 一条配置校验失败信息；跨配置检查时 Keys 列出相关的全部配置项。
+type settingViolation struct {
+	Key   string   `json:"key"`
+	Keys  []string `json:"keys,omitempty"`
+	Error string   `json:"error"`
+}
+
+type settingValidator func(value any) error
+
+// settingValidators 按配置项注册的取值校验，未注册的配置项只检查数据类型。
+var settingValidators = map[string]settingValidator{
+	"monitor.refresh_interval_ms":          intRange(1000, 3600000),
+	"monitor.error_display":                oneOf("icon", "inline"),
+	"monitor.throughput_interval_sec":      intRange(1, 5),
+	"health.check_interval_sec":            intRange(1, 86400),
+	"health.fail_threshold":                intRange(1, 100),
+	"health.max_concurrency":               intRange(1, 1024),
+	"health.spread_pct":                    intRange(0, 100),
+	"health.jitter_ms":                     intRange(0, 600000),
+	"health.cache_ttl_ms":                  intRange(0, 3600000),
+	"health.backoff_max_sec":               intRange(0, 86400),
+	"proxy.retry_max":                      intRange(0, 20),
+	"proxy.first_byte_timeout_ms":          intRange(0, 600000),
+	"proxy.max_request_bytes":              intRange(0, math.MaxInt32),
+	"password.min_length":                  intRange(1, 128),
+	"password.history":                     intRange(0, 24),
+	"password.max_age_days":                intRange(0, 3650),
+	"siem.target":                          oneOf(authEventTargetWebhook, authEventTargetSyslog),
+	"siem.webhook_url":                     optionalURL("http", "https"),
+	"siem.syslog_addr":                     optionalURL("udp", "tcp"),
+	"siem.rate_limit_per_min":              intRange(0, 1000000),
+	"siem.max_retries":                     intRange(0, 20),
+	"metrics.aggregate_interval":           positiveDuration,
+	"metrics.cleanup_interval":             positiveDuration,
+	"metrics.flush_interval_sec":           intRange(1, 3600),
+	"benchmark.regression_threshold_pct":   intRange(1, 1000),
+	"routing.affinity.ttl_sec":             intRange(0, 604800),
+	"routing.affinity.max_entries":         intRange(0, 10000000),
+	"routing.hedge.threshold_ms":           intRange(1, 600000),
+	"routing.hedge.budget_pct":             intRange(0, 100),
+	"routing.warmup.window_sec":            intRange(0, 86400),
+	"routing.warmup.initial_pct":           intRange(0, 100),
+	"routing.adaptive_weight.interval_sec": intRange(1, 86400),
+	"routing.adaptive_weight.min":          intRange(1, 1000),
+	"routing.adaptive_weight.max":          intRange(1, 1000),
+	"request_log.sample.error_pct":         intRange(0, 100),
+	"request_log.sample.success_pct":       intRange(0, 100),
+	"request_log.sample.slow_ms":           intRange(0, 3600000),
+	"retention.policy":                     validateRetentionSetting,
+	"ws.max_conns_per_account":             intRange(0, 100000),
+	"ws.max_conns_per_share":               intRange(0, 100000),
+	"access_log.format":                    oneOf("common", "combined"),
+	"update.check_interval_hours":          intRange(1, 8760),
+	"upstream_status.poll_interval_sec":    intRange(30, 86400),
+	"upstream_status.providers":            validateUpstreamProviders,
+	"db.max_open_conns":                    intRange(0, 10000),
+	"db.max_idle_conns":                    intRange(0, 10000),
+	"db.conn_max_lifetime_sec":             intRange(0, 86400),
+	"db.timeout.read_ms":                   intRange(1, 600000),
+	"db.timeout.write_ms":                  intRange(1, 600000),
+	"db.timeout.aggregate_ms":              intRange(1, 3600000),
+	"maintenance.start_at":                 optionalTime,
+	"maintenance.end_at":                   optionalTime,
+	settingDisabledModules:                 validateDisabledModules,
+	settingQuotaWarnThresholds:             validateQuotaThresholds,
+}
+
+func settingNumber(value any) (float64, bool) {
+	switch n := value.(type) {
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func intRange(lo, hi int) settingValidator {
+	return func(value any) error {
+		n, ok := settingNumber(value)
+		if !ok || n != math.Trunc(n) {
+			return fmt.Errorf("must be an integer")
+		}
+		if n < float64(lo) || n > float64(hi) {
+			return fmt.Errorf("must be between %d and %d", lo, hi)
+		}
+		return nil
+	}
+}
+
+func oneOf(options ...string) settingValidator {
+	return func(value any) error {
+		s, _ := value.(string)
+		for _, o := range options {
+			if s == o {
+				return nil
+			}
+		}
+		return fmt.Errorf("must be one of %s", strings.Join(options, ", "))
+	}
+}
+
+// optionalURL 允许空字符串，否则须为指定协议的地址。
+func optionalURL(schemes ...string) settingValidator {
+	return func(value any) error {
+		s, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("must be a string")
+		}
+		if s == "" {
+			return nil
+		}
+		u, err := url.Parse(s)
+		if err != nil || u.Host == "" {
+			return fmt.Errorf("must be a URL like %s://host", schemes[0])
+		}
+		for _, sc := range schemes {
+			if u.Scheme == sc {
+				return nil
+			}
+		}
+		return fmt.Errorf("scheme must be one of %s", strings.Join(schemes, ", "))
+	}
+}
+
+// optionalTime 允许空字符串，否则须为 RFC3339 时间。
+func optionalTime(value any) error {
+	s, ok := value.(string)
+	if !ok {
+		return fmt.Errorf("must be a string")
+	}
+	if s == "" {
+		return nil
+	}
+	if _, err := time.Parse(time.RFC3339, s); err != nil {
+		return fmt.Errorf("must be an RFC3339 time")
+	}
+	return nil
+}
+
+func positiveDuration(value any) error {
+	d, err := settingDuration(value)
+	if err != nil {
+		return err
+	}
+	if d <= 0 {
+		return fmt.Errorf("must be positive")
+	}
+	return nil
+}
+
+// settingDuration 解析 duration 类型的配置值，支持 "1h" 形式的字符串与秒数。
+func settingDuration(value any) (time.Duration, error) {
+	if s, ok := value.(string); ok {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		return d, nil
+	}
+	if n, ok := settingNumber(value); ok {
+		return time.Duration(n * float64(time.Second)), nil
+	}
+	return 0, fmt.Errorf("must be a duration")
+}
+
+func validateRetentionSetting(value any) error {
+	days := settingRetentionDays(&store.Setting{Value: value})
+	if len(days) == 0 {
+		return fmt.Errorf("must be an object of days per data type")
+	}
+	return validateRetentionDays(days)
+}
+
+// validateSettingType 检查配置值与声明的数据类型是否一致。
+func validateSettingType(dataType string, value any) error {
+	switch dataType {
+	case "string":
+		if _, ok := value.(string); !ok {
+			return fmt.Errorf("must be a string")
+		}
+	case "number":
+		if _, ok := settingNumber(value); !ok {
+			return fmt.Errorf("must be a number")
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("must be a boolean")
+		}
+	case "object":
+		if _, ok := value.(map[string]any); !ok {
+			return fmt.Errorf("must be an object")
+		}
+	case "array":
+		if _, ok := value.([]any); !ok {
+			return fmt.Errorf("must be an array")
+		}
+	case "duration":
+		if _, err := settingDuration(value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// settingCrossCheck 多个配置项之间的一致性检查，get 返回提议值（未提议时为当前值）。
+type settingCrossCheck struct {
+	keys  []string
+	check func(get func(key string) (any, bool)) error
+}
+
+var settingCrossChecks = []settingCrossCheck{
+	{
+		keys: []string{"metrics.aggregate_interval", "retention.policy"},
+		check: func(get func(string) (any, bool)) error {
+			interval, ok := durationSetting(get, "metrics.aggregate_interval")
+			if !ok {
+				return nil
+			}
+			raw := store.DefaultRetentionPolicy().RawMetrics
+			if v, ok := get("retention.policy"); ok {
+				raw = withRetentionDays(store.DefaultRetentionPolicy(), settingRetentionDays(&store.Setting{Value: v})).RawMetrics
+			}
+			if raw > 0 && interval >= raw {
+				return fmt.Errorf("aggregate interval (%s) must be shorter than raw metrics retention (%s)", interval, raw)
+			}
+			return nil
+		},
+	},
+	{
+		keys: []string{"metrics.aggregate_interval", "metrics.cleanup_interval"},
+		check: func(get func(string) (any, bool)) error {
+			agg, ok1 := durationSetting(get, "metrics.aggregate_interval")
+			cleanup, ok2 := durationSetting(get, "metrics.cleanup_interval")
+			if ok1 && ok2 && agg > cleanup {
+				return fmt.Errorf("aggregate interval (%s) must not exceed cleanup interval (%s)", agg, cleanup)
+			}
+			return nil
+		},
+	},
+	{
+		keys: []string{"routing.adaptive_weight.min", "routing.adaptive_weight.max"},
+		check: func(get func(string) (any, bool)) error {
+			lo, ok1 := numberSetting(get, "routing.adaptive_weight.min")
+			hi, ok2 := numberSetting(get, "routing.adaptive_weight.max")
+			if ok1 && ok2 && lo > hi {
+				return fmt.Errorf("adaptive weight min (%v) must not exceed max (%v)", lo, hi)
+			}
+			return nil
+		},
+	},
+	{
+		keys: []string{"db.max_idle_conns", "db.max_open_conns"},
+		check: func(get func(string) (any, bool)) error {
+			idle, ok1 := numberSetting(get, "db.max_idle_conns")
+			open, ok2 := numberSetting(get, "db.max_open_conns")
+			if ok1 && ok2 && open > 0 && idle > open {
+				return fmt.Errorf("max idle connections (%v) must not exceed max open connections (%v)", idle, open)
+			}
+			return nil
+		},
+	},
+	{
+		keys: []string{"health.cache_ttl_ms", "health.check_interval_sec"},
+		check: func(get func(string) (any, bool)) error {
+			ttl, ok1 := numberSetting(get, "health.cache_ttl_ms")
+			interval, ok2 := numberSetting(get, "health.check_interval_sec")
+			if ok1 && ok2 && interval > 0 && ttl >= interval*1000 {
+				return fmt.Errorf("health cache ttl (%vms) must be shorter than check interval (%vs)", ttl, interval)
+			}
+			return nil
+		},
+	},
+	{
+		keys: []string{"maintenance.start_at", "maintenance.end_at"},
+		check: func(get func(string) (any, bool)) error {
+			start, _ := get("maintenance.start_at")
+			end, _ := get("maintenance.end_at")
+			s, _ := start.(string)
+			e, _ := end.(string)
+			st, err1 := time.Parse(time.RFC3339, s)
+			et, err2 := time.Parse(time.RFC3339, e)
+			if err1 == nil && err2 == nil && !et.After(st) {
+				return fmt.Errorf("maintenance end_at must be after start_at")
+			}
+			return nil
+		},
+	},
+	{
+		keys: []string{"siem.enabled", "siem.target", "siem.webhook_url", "siem.syslog_addr"},
+		check: func(get func(string) (any, bool)) error {
+			if enabled, _ := get("siem.enabled"); enabled != true {
+				return nil
+			}
+			target, _ := get("siem.target")
+			if target == authEventTargetSyslog {
+				if addr, _ := get("siem.syslog_addr"); addr == nil || addr == "" {
+					return fmt.Errorf("siem.syslog_addr is required when syslog delivery is enabled")
+				}
+				return nil
+			}
+			if u, _ := get("siem.webhook_url"); u == nil || u == "" {
+				return fmt.Errorf("siem.webhook_url is required when webhook delivery is enabled")
+			}
+			return nil
+		},
+	},
+}
+
+func durationSetting(get func(string) (any, bool), key string) (time.Duration, bool) {
+	v, ok := get(key)
+	if !ok {
+		return 0, false
+	}
+	d, err := settingDuration(v)
+	return d, err == nil
+}
+
+func numberSetting(get func(string) (any, bool), key string) (float64, bool) {
+	v, ok := get(key)
+	if !ok {
+		return 0, false
+	}
+	return settingNumber(v)
+}
+
+// validateProposedSettings 对一批提议的配置运行类型检查、已注册的取值校验，以及与当前配置合并后的跨项检查。
+// current 为各 scope/账号下的现有配置，用于确定数据类型并补全跨项检查缺少的值。
+func validateProposedSettings(proposed, current []store.Setting) []settingViolation {
+	violations := []settingViolation{}
+	type scopeKey struct{ scope, account string }
+	scopeOf := func(s store.Setting) scopeKey {
+		k := scopeKey{scope: s.Scope}
+		if k.scope == "" {
+			k.scope = "system"
+		}
+		if s.AccountID != nil {
+			k.account = *s.AccountID
+		}
+		return k
+	}
+
+	existing := map[scopeKey]map[string]store.Setting{}
+	for _, s := range current {
+		k := scopeOf(s)
+		if existing[k] == nil {
+			existing[k] = map[string]store.Setting{}
+		}
+		existing[k][s.Key] = s
+	}
+
+	merged := map[scopeKey]map[string]any{}
+	for _, s := range proposed {
+		key := strings.TrimSpace(s.Key)
+		if key == "" {
+			violations = append(violations, settingViolation{Error: "key required"})
+			continue
+		}
+		k := scopeOf(s)
+		if k.scope == "account" && k.account == "" {
+			violations = append(violations, settingViolation{Key: key, Error: "account_id required for account scope"})
+			continue
+		}
+		dataType := s.DataType
+		if old, ok := existing[k][key]; ok && old.DataType != "" {
+			dataType = old.DataType
+		}
+		if err := validateSettingType(dataType, s.Value); err != nil {
+			violations = append(violations, settingViolation{Key: key, Error: err.Error()})
+			continue
+		}
+		if v, ok := settingValidators[key]; ok {
+			if err := v(s.Value); err != nil {
+				violations = append(violations, settingViolation{Key: key, Error: err.Error()})
+				continue
+			}
+		}
+		if merged[k] == nil {
+			merged[k] = map[string]any{}
+		}
+		merged[k][key] = s.Value
+	}
+
+	scopes := make([]scopeKey, 0, len(merged))
+	for k := range merged {
+		scopes = append(scopes, k)
+	}
+	sort.Slice(scopes, func(i, j int) bool {
+		if scopes[i].scope != scopes[j].scope {
+			return scopes[i].scope > scopes[j].scope
+		}
+		return scopes[i].account < scopes[j].account
+	})
+	system := scopeKey{scope: "system"}
+	for _, k := range scopes {
+		// 账号级配置覆盖系统级配置，跨项检查按覆盖后的生效值进行。
+		get := func(key string) (any, bool) {
+			if v, ok := merged[k][key]; ok {
+				return v, true
+			}
+			if s, ok := existing[k][key]; ok {
+				return s.Value, true
+			}
+			if k != system {
+				if v, ok := merged[system][key]; ok {
+					return v, true
+				}
+				if s, ok := existing[system][key]; ok {
+					return s.Value, true
+				}
+			}
+			return nil, false
+		}
+		for _, c := range settingCrossChecks {
+			touched := ""
+			for _, key := range c.keys {
+				if _, ok := merged[k][key]; ok {
+					touched = key
+					break
+				}
+			}
+			if touched == "" {
+				continue
+			}
+			if err := c.check(get); err != nil {
+				violations = append(violations, settingViolation{Key: touched, Keys: c.keys, Error: err.Error()})
+			}
+		}
+	}
+	return violations
+}
+
+// ValidateSettings POST /api/settings/validate
+// 请求体与批量更新相同: {"settings": [{"key": "...", "value": any, "scope": "system", "account_id": null}]}
+// 只做校验不写入，响应: {"valid": bool, "violations": [{"key": "...", "keys": [...], "error": "..."}]}
+func (h *SettingsHandler) ValidateSettings(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if !isAdmin(r.Context()) {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+		return
+	}
+	if h.store == nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "settings store not enabled"})
+		return
+	}
+	var req struct {
+		Settings []store.Setting `json:"settings"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
+		return
+	}
+	current, err := h.store.ListSettings("", "", "")
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	violations := validateProposedSettings(req.Settings, current)
+	writeJSON(w, http.StatusOK, map[string]any{
+		"valid":      len(violations) == 0,
+		"violations": violations,
+	})
+}
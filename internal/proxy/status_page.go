@@ -0,0 +1,487 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"qcc_plus/internal/store"
+	"qcc_plus/internal/timeutil"
+)
+
+const (
+	statusPagePrefix     = "/status/"
+	statusPageDays       = 90
+	statusPageCacheTTL   = time.Minute
+	statusPageCacheLimit = 1024
+	statusPageCacheCtl   = "public, max-age=60, stale-while-revalidate=300"
+)
+
+// 状态页对外展示的节点状态。
+const (
+	statusOperational = "operational"
+	statusDegraded    = "degraded"
+	statusOutage      = "outage"
+	statusMaintenance = "maintenance"
+)
+
+var statusPageSlugRe = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{2,62}$`)
+
+// statusPageView 公开状态页内容；不包含节点地址等内部信息。
+type statusPageView struct {
+	Title     string           `json:"title"`
+	Status    string           `json:"status"`
+	Nodes     []statusNode     `json:"nodes"`
+	Incidents []statusIncident `json:"incidents"`
+	UpdatedAt string           `json:"updated_at"`
+}
+
+type statusNode struct {
+	Name     string      `json:"name"`
+	Status   string      `json:"status"`
+	Uptime90 *float64    `json:"uptime_90d"`
+	Days     []statusDay `json:"days"`
+}
+
+type statusDay struct {
+	Date   string   `json:"date"`
+	Uptime *float64 `json:"uptime"` // 无检查数据时为 null
+}
+
+type statusIncident struct {
+	Title      string                 `json:"title"`
+	Status     string                 `json:"status"`
+	Impact     string                 `json:"impact,omitempty"`
+	Nodes      []string               `json:"nodes"`
+	StartedAt  string                 `json:"started_at"`
+	ResolvedAt string                 `json:"resolved_at,omitempty"`
+	Automatic  bool                   `json:"automatic"`
+	Postmortem string                 `json:"postmortem,omitempty"` // Markdown 原文
+	Updates    []statusIncidentUpdate `json:"updates,omitempty"`
+}
+
+type statusIncidentUpdate struct {
+	Status    string `json:"status"`
+	Body      string `json:"body"` // Markdown 原文
+	CreatedAt string `json:"created_at"`
+}
+
+// publicNodeStatus 将节点状态机映射为状态页状态；禁用节点不展示。
+func publicNodeStatus(state string) (string, bool) {
+	switch state {
+	case NodeStateHealthy:
+		return statusOperational, true
+	case NodeStateDegraded, NodeStateFailing:
+		return statusDegraded, true
+	case NodeStateDown:
+		return statusOutage, true
+	case NodeStateDraining:
+		return statusMaintenance, true
+	default:
+		return "", false
+	}
+}
+
+// buildStatusPage 汇总账号节点的当前状态、90 天可用率与故障事件；
+// 已被人工事件覆盖的节点不再生成自动事件。
+func (p *Server) buildStatusPage(acc *Account, title string, uptime map[string][]store.UptimeDay, incidents []store.IncidentRecord, now time.Time) statusPageView {
+	type nodeInfo struct {
+		id, name, state string
+		changedAt       time.Time
+		weight          int
+	}
+	var infos []nodeInfo
+	nodeNames := make(map[string]string)
+	p.mu.RLock()
+	for _, n := range acc.Nodes {
+		infos = append(infos, nodeInfo{id: n.ID, name: n.Name, state: nodeState(n), changedAt: n.StateChangedAt, weight: n.Weight})
+		nodeNames[n.ID] = n.Name
+	}
+	if title == "" {
+		title = acc.Name
+	}
+	p.mu.RUnlock()
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].weight != infos[j].weight {
+			return infos[i].weight < infos[j].weight
+		}
+		return infos[i].name < infos[j].name
+	})
+
+	covered := make(map[string]bool)
+	for _, inc := range incidents {
+		if inc.Status != store.IncidentResolved {
+			for _, id := range inc.AffectedNodes {
+				covered[id] = true
+			}
+		}
+	}
+
+	today := now.UTC().Truncate(24 * time.Hour)
+	view := statusPageView{
+		Title:     title,
+		Status:    statusOperational,
+		Nodes:     make([]statusNode, 0, len(infos)),
+		Incidents: statusIncidentsFromRecords(incidents, nodeNames),
+		UpdatedAt: timeutil.FormatBeijingTime(now),
+	}
+	for _, info := range infos {
+		status, visible := publicNodeStatus(info.state)
+		if !visible {
+			continue
+		}
+		node := statusNode{Name: info.name, Status: status, Days: make([]statusDay, statusPageDays)}
+		byDay := make(map[string]store.UptimeDay, len(uptime[info.id]))
+		for _, d := range uptime[info.id] {
+			byDay[d.Day.UTC().Format("2006-01-02")] = d
+		}
+		var total, ok int64
+		for i := 0; i < statusPageDays; i++ {
+			date := today.AddDate(0, 0, i-statusPageDays+1).Format("2006-01-02")
+			node.Days[i] = statusDay{Date: date}
+			if d, found := byDay[date]; found && d.ChecksTotal > 0 {
+				pct := float64(d.ChecksOK) / float64(d.ChecksTotal) * 100
+				node.Days[i].Uptime = &pct
+				total += d.ChecksTotal
+				ok += d.ChecksOK
+			}
+		}
+		if total > 0 {
+			pct := float64(ok) / float64(total) * 100
+			node.Uptime90 = &pct
+		}
+		view.Nodes = append(view.Nodes, node)
+
+		if (status == statusDegraded || status == statusOutage) && !covered[info.id] {
+			view.Incidents = append(view.Incidents, statusIncident{
+				Title:     info.name + " " + status,
+				Status:    "investigating",
+				Nodes:     []string{info.name},
+				StartedAt: timeutil.FormatBeijingTime(info.changedAt),
+				Automatic: true,
+			})
+		}
+		view.Status = worseStatus(view.Status, status)
+	}
+	return view
+}
+
+// worseStatus 返回两者中更严重的状态。
+func worseStatus(a, b string) string {
+	rank := map[string]int{statusOperational: 0, statusMaintenance: 1, statusDegraded: 2, statusOutage: 3}
+	if rank[b] > rank[a] {
+		return b
+	}
+	return a
+}
+
+// statusPageEntry 渲染结果缓存；notFound 条目同样缓存，避免随机 key 穿透到数据库。
+type statusPageEntry struct {
+	notFound  bool
+	json      []byte
+	html      []byte
+	etag      string
+	expiresAt time.Time
+}
+
+type statusPageCache struct {
+	mu      sync.Mutex
+	entries map[string]*statusPageEntry
+}
+
+func newStatusPageCache() *statusPageCache {
+	return &statusPageCache{entries: make(map[string]*statusPageEntry)}
+}
+
+func (c *statusPageCache) get(key string, now time.Time) *statusPageEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e := c.entries[key]
+	if e == nil || now.After(e.expiresAt) {
+		return nil
+	}
+	return e
+}
+
+func (c *statusPageCache) set(key string, e *statusPageEntry, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.entries) >= statusPageCacheLimit {
+		for k, old := range c.entries {
+			if now.After(old.expiresAt) {
+				delete(c.entries, k)
+			}
+		}
+		if len(c.entries) >= statusPageCacheLimit {
+			c.entries = make(map[string]*statusPageEntry)
+		}
+	}
+	c.entries[key] = e
+}
+
+func (c *statusPageCache) flush() {
+	c.mu.Lock()
+	c.entries = make(map[string]*statusPageEntry)
+	c.mu.Unlock()
+}
+
+// GET /status/:key[?format=json] 公开状态页（无需登录）。
+func (p *Server) handlePublicStatusPage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	key := strings.Trim(strings.TrimPrefix(r.URL.Path, statusPagePrefix), "/")
+	if key == "" || p.store == nil || p.statusPages == nil {
+		http.NotFound(w, r)
+		return
+	}
+	now := time.Now()
+	entry := p.statusPages.get(key, now)
+	if entry == nil {
+		var err error
+		entry, err = p.renderStatusPage(r.Context(), key, now)
+		if err != nil {
+			if p.logger != nil {
+				p.logger.Printf("render status page %s failed: %v", key, err)
+			}
+			http.Error(w, "status page unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		p.statusPages.set(key, entry, now)
+	}
+	if entry.notFound {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Cache-Control", statusPageCacheCtl)
+	w.Header().Set("ETag", entry.etag)
+	w.Header().Set("Vary", "Accept")
+	if etagMatches(r, entry.etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	if r.URL.Query().Get("format") == "json" || strings.Contains(r.Header.Get("Accept"), "application/json") {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(entry.json)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = w.Write(entry.html)
+}
+
+func (p *Server) renderStatusPage(ctx context.Context, key string, now time.Time) (*statusPageEntry, error) {
+	expiresAt := now.Add(statusPageCacheTTL)
+	cfg, err := p.store.GetStatusPageByKey(ctx, key)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return &statusPageEntry{notFound: true, expiresAt: expiresAt}, nil
+		}
+		return nil, err
+	}
+	acc := p.getAccountByID(cfg.AccountID)
+	if acc == nil {
+		return &statusPageEntry{notFound: true, expiresAt: expiresAt}, nil
+	}
+	uptime, err := p.store.UptimeDaily(ctx, acc.ID, now.AddDate(0, 0, -statusPageDays))
+	if err != nil {
+		return nil, err
+	}
+	incidents, err := p.store.ListIncidents(ctx, store.IncidentQuery{
+		AccountID:     acc.ID,
+		ActiveOnly:    true,
+		ResolvedSince: now.Add(-statusPageResolvedIn),
+		Limit:         20,
+	})
+	if err != nil {
+		return nil, err
+	}
+	view := p.buildStatusPage(acc, cfg.Title, uptime, incidents, now)
+	body, err := json.Marshal(view)
+	if err != nil {
+		return nil, err
+	}
+	var html bytes.Buffer
+	if err := statusPageTemplate.Execute(&html, view); err != nil {
+		return nil, err
+	}
+	return &statusPageEntry{
+		json:      body,
+		html:      html.Bytes(),
+		etag:      computeETag(view),
+		expiresAt: expiresAt,
+	}, nil
+}
+
+var statusPageTemplate = template.Must(template.New("status").Funcs(template.FuncMap{
+	"pct": func(v *float64) string {
+		if v == nil {
+			return "无数据"
+		}
+		return fmt.Sprintf("%.2f%%", *v)
+	},
+	"dayClass": func(v *float64) string {
+		switch {
+		case v == nil:
+			return "none"
+		case *v >= 99.5:
+			return "ok"
+		case *v >= 95:
+			return "warn"
+		default:
+			return "bad"
+		}
+	},
+}).Parse(`<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}} 服务状态</title>
+<style>
+body{font-family:-apple-system,BlinkMacSystemFont,"Segoe UI",sans-serif;max-width:860px;margin:32px auto;padding:0 16px;color:#1f2933}
+.banner{padding:16px;border-radius:8px;color:#fff;font-weight:600}
+.operational{background:#2f9e44}.degraded{background:#f08c00}.outage{background:#e03131}.maintenance{background:#1c7ed6}
+.node{margin:24px 0}.node h3{display:flex;justify-content:space-between;font-size:16px;margin:0 0 8px}
+.bars{display:flex;gap:2px}.bars span{flex:1;height:28px;border-radius:2px}
+.ok{background:#40c057}.warn{background:#fab005}.bad{background:#fa5252}.none{background:#dee2e6}
+.incident{border-left:4px solid #f08c00;padding:8px 12px;margin:12px 0;background:#fff9db}
+.incident.resolved{border-color:#2f9e44;background:#ebfbee}
+.md{white-space:pre-wrap;font-family:inherit;margin:6px 0}.meta{color:#868e96;font-size:12px}
+footer{margin-top:32px;color:#868e96;font-size:12px}
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<div class="banner {{.Status}}">{{if eq .Status "operational"}}所有系统运行正常{{else if eq .Status "maintenance"}}部分节点维护中{{else if eq .Status "degraded"}}部分节点性能下降{{else}}部分节点不可用{{end}}</div>
+{{if .Incidents}}<h2>事件</h2>{{range .Incidents}}
+<div class="incident {{.Status}}"><strong>{{.Title}}</strong> · {{.Status}}{{if .Nodes}} · 影响节点：{{range $i, $n := .Nodes}}{{if $i}}、{{end}}{{$n}}{{end}}{{end}}
+<div class="meta">开始于 {{.StartedAt}}{{if .ResolvedAt}} · 已于 {{.ResolvedAt}} 解决{{end}}</div>
+{{range .Updates}}<div><span class="meta">{{.CreatedAt}} · {{.Status}}</span><pre class="md">{{.Body}}</pre></div>{{end}}
+{{if .Postmortem}}<details><summary>事后复盘</summary><pre class="md">{{.Postmortem}}</pre></details>{{end}}
+</div>{{end}}{{end}}
+{{range .Nodes}}<div class="node">
+<h3><span>{{.Name}}</span><span>{{pct .Uptime90}}</span></h3>
+<div class="bars">{{range .Days}}<span class="{{dayClass .Uptime}}" title="{{.Date}} {{pct .Uptime}}"></span>{{end}}</div>
+</div>{{end}}
+<footer>更新时间 {{.UpdatedAt}} · 可用率统计近 90 天</footer>
+</body>
+</html>
+`))
+
+// GET/PUT /api/status-page?account_id= 管理账号的公开状态页配置。
+func (p *Server) handleStatusPageConfig(w http.ResponseWriter, r *http.Request) {
+	if p.store == nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "store not enabled"})
+		return
+	}
+	acc := accountFromCtx(r)
+	if acc == nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		return
+	}
+	if aid := r.URL.Query().Get("account_id"); aid != "" && aid != acc.ID {
+		if !isAdminCtx(r) {
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+			return
+		}
+		if acc = p.getAccountByID(aid); acc == nil {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "account not found"})
+			return
+		}
+	}
+
+	cfg, err := p.store.GetStatusPage(r.Context(), acc.ID)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	if cfg == nil {
+		cfg = &store.StatusPageRecord{AccountID: acc.ID}
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, statusPageConfigView(r, cfg))
+	case http.MethodPut:
+		var req struct {
+			Enabled         *bool   `json:"enabled"`
+			Slug            *string `json:"slug"`
+			Title           *string `json:"title"`
+			RegenerateToken bool    `json:"regenerate_token"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid body"})
+			return
+		}
+		if req.Enabled != nil {
+			cfg.Enabled = *req.Enabled
+		}
+		if req.Title != nil {
+			cfg.Title = strings.TrimSpace(*req.Title)
+		}
+		if req.Slug != nil {
+			slug := strings.ToLower(strings.TrimSpace(*req.Slug))
+			if slug != "" && !statusPageSlugRe.MatchString(slug) {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "slug must be 3-63 chars of a-z, 0-9 or -"})
+				return
+			}
+			cfg.Slug = slug
+		}
+		if cfg.Token == "" || req.RegenerateToken {
+			token, err := generateShareToken()
+			if err != nil {
+				writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "token generation failed"})
+				return
+			}
+			cfg.Token = token
+		}
+		if err := p.store.UpsertStatusPage(r.Context(), *cfg); err != nil {
+			if strings.Contains(err.Error(), "Duplicate") {
+				writeJSON(w, http.StatusConflict, map[string]string{"error": "slug already in use"})
+				return
+			}
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		if p.statusPages != nil {
+			p.statusPages.flush()
+		}
+		p.audit(acc.ID, auditActor(r), "status_page.update", acc.ID, map[string]interface{}{
+			"enabled":          cfg.Enabled,
+			"slug":             cfg.Slug,
+			"regenerate_token": req.RegenerateToken,
+		})
+		writeJSON(w, http.StatusOK, statusPageConfigView(r, cfg))
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func statusPageConfigView(r *http.Request, cfg *store.StatusPageRecord) map[string]interface{} {
+	view := map[string]interface{}{
+		"account_id": cfg.AccountID,
+		"enabled":    cfg.Enabled,
+		"slug":       cfg.Slug,
+		"title":      cfg.Title,
+		"token":      cfg.Token,
+	}
+	if cfg.Token != "" {
+		base := requestBaseURL(r)
+		view["token_url"] = base + statusPagePrefix + cfg.Token
+		if cfg.Slug != "" {
+			view["slug_url"] = base + statusPagePrefix + cfg.Slug
+		}
+	}
+	return view
+}
@@ -0,0 +1,183 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"qcc_plus/internal/store"
+)
+
+const (
+	storageLimitSettingKey = "storage.account_limit"
+	// storageTightenHeadroom 收紧后预留的余量，避免清理后很快再次超限。
+	storageTightenHeadroom = 0.9
+)
+
+// StorageLimit 账号存储上限，0 表示不限制；账号级配置覆盖系统默认值。
+type StorageLimit struct {
+	MaxRows int64 `json:"max_rows"`
+	MaxMB   int64 `json:"max_mb"`
+}
+
+// tightenFactor 返回超限时保留时长的收缩比例，未超限返回 0。
+func (l StorageLimit) tightenFactor(usage store.AccountStorage) float64 {
+	factor := 1.0
+	if l.MaxRows > 0 && usage.Rows > l.MaxRows {
+		factor = float64(l.MaxRows) / float64(usage.Rows)
+	}
+	if maxBytes := l.MaxMB << 20; maxBytes > 0 && usage.Bytes > maxBytes {
+		if f := float64(maxBytes) / float64(usage.Bytes); f < factor {
+			factor = f
+		}
+	}
+	if factor >= 1 {
+		return 0
+	}
+	return factor * storageTightenHeadroom
+}
+
+func (l StorageLimit) exceeded(usage store.AccountStorage) bool {
+	return (l.MaxRows > 0 && usage.Rows > l.MaxRows) || (l.MaxMB > 0 && usage.Bytes > l.MaxMB<<20)
+}
+
+// loadStorageLimit 读取存储上限配置；scope 为 account 且未单独配置时回落到系统默认值。
+func loadStorageLimit(st *store.Store, accountID string) StorageLimit {
+	var limit StorageLimit
+	if st == nil {
+		return limit
+	}
+	setting, err := st.GetSetting(storageLimitSettingKey, "account", accountID)
+	if err != nil || setting == nil {
+		setting, err = st.GetSetting(storageLimitSettingKey, "system", "")
+	}
+	if err != nil || setting == nil {
+		return limit
+	}
+	if b, err := json.Marshal(setting.Value); err == nil {
+		_ = json.Unmarshal(b, &limit)
+	}
+	return limit
+}
+
+// enforceStorageLimits 对超出存储上限的账号按比例收紧保留时长并清理，返回各账号各表删除的行数。
+func (m *MetricsScheduler) enforceStorageLimits(ctx context.Context, plan retentionPlan, now time.Time) map[string]map[string]int64 {
+	tightened := make(map[string]map[string]int64)
+	usages, err := m.store.StorageUsage(ctx)
+	if err != nil {
+		m.logger.Printf("[MetricsScheduler] Storage usage failed: %v", err)
+		return tightened
+	}
+	for _, usage := range usages {
+		factor := loadStorageLimit(m.store, usage.AccountID).tightenFactor(usage)
+		if factor == 0 {
+			continue
+		}
+		deleted, err := m.store.TightenAccountRetention(ctx, usage.AccountID, plan.policyFor(usage.AccountID), factor, now)
+		if err != nil {
+			m.logger.Printf("[MetricsScheduler] Tighten retention for %s failed: %v", usage.AccountID, err)
+			continue
+		}
+		tightened[usage.AccountID] = deleted
+		m.logger.Printf("[MetricsScheduler] Account %s over storage limit (rows=%d bytes=%d), retention x%.2f, deleted %s",
+			usage.AccountID, usage.Rows, usage.Bytes, factor, formatTableCounts(deleted))
+	}
+	return tightened
+}
+
+func storageUsageView(usage store.AccountStorage, limit StorageLimit) map[string]interface{} {
+	tables := make([]map[string]interface{}, 0, len(usage.Tables))
+	for _, t := range usage.Tables {
+		tables = append(tables, map[string]interface{}{"table": t.Table, "rows": t.Rows, "bytes": t.Bytes})
+	}
+	return map[string]interface{}{
+		"account_id": usage.AccountID,
+		"rows":       usage.Rows,
+		"bytes":      usage.Bytes,
+		"tables":     tables,
+		"limit":      limit,
+		"exceeded":   limit.exceeded(usage),
+	}
+}
+
+// GET /api/admin/storage，PUT /api/admin/storage?account_id=（不传 account_id 时修改系统默认上限）
+func (p *Server) handleAdminStorage(w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(r.Context()) {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+		return
+	}
+	if p.store == nil {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "store not enabled"})
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		usages, err := p.store.StorageUsage(r.Context())
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		items := make([]map[string]interface{}, 0, len(usages))
+		var rows, bytes int64
+		for _, usage := range usages {
+			items = append(items, storageUsageView(usage, loadStorageLimit(p.store, usage.AccountID)))
+			rows += usage.Rows
+			bytes += usage.Bytes
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"accounts":      items,
+			"total_rows":    rows,
+			"total_bytes":   bytes,
+			"default_limit": loadStorageLimit(p.store, ""),
+		})
+	case http.MethodPut:
+		var limit StorageLimit
+		if err := json.NewDecoder(r.Body).Decode(&limit); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
+			return
+		}
+		if limit.MaxRows < 0 || limit.MaxMB < 0 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "limits must be non-negative"})
+			return
+		}
+		accountID := r.URL.Query().Get("account_id")
+		if err := p.saveStorageLimit(accountID, limit, auditActor(r)); err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, store.ErrNotFound) {
+				status = http.StatusNotFound
+			}
+			writeJSON(w, status, map[string]string{"error": err.Error()})
+			return
+		}
+		p.audit(chooseNonEmpty(accountID, store.DefaultAccountID), auditActor(r), "storage.limit.update", chooseNonEmpty(accountID, "system"), limit)
+		writeJSON(w, http.StatusOK, map[string]interface{}{"account_id": accountID, "limit": limit})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// saveStorageLimit 保存账号级或系统默认存储上限。
+func (p *Server) saveStorageLimit(accountID string, limit StorageLimit, updatedBy string) error {
+	desc := "账号存储上限（行数/MB，0 为不限制），超限时自动收紧保留时长"
+	setting := &store.Setting{
+		Key:         storageLimitSettingKey,
+		Scope:       "system",
+		Value:       limit,
+		DataType:    "object",
+		Category:    "performance",
+		Description: &desc,
+	}
+	if accountID != "" {
+		if p.getAccountByID(accountID) == nil {
+			return store.ErrNotFound
+		}
+		setting.Scope = "account"
+		setting.AccountID = &accountID
+	}
+	if updatedBy != "" {
+		setting.UpdatedBy = &updatedBy
+	}
+	return p.store.UpsertSetting(setting)
+}
@@ -0,0 +1,239 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+const sseLinePrefixLen = 32 // 判断字段名与结束事件所需保留的行首字节数
+
+// streamStats 各节点 SSE 流完整性计数。
+type streamStats struct {
+	mu    sync.Mutex
+	nodes map[string]*streamCounters
+}
+
+type streamCounters struct {
+	Checked             int64 // 校验过的流
+	Malformed           int64 // 含无法识别字段行的流
+	MissingFinalNewline int64 // 最后一行或最后一个事件未正确结束
+	MissingEnd          int64 // 缺少 message_stop/[DONE] 结束事件
+	Repaired            int64 // 已补齐结尾换行的流
+}
+
+func (s *streamStats) record(nodeID string, v *sseValidator) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.nodes == nil {
+		s.nodes = make(map[string]*streamCounters)
+	}
+	c := s.nodes[nodeID]
+	if c == nil {
+		c = &streamCounters{}
+		s.nodes[nodeID] = c
+	}
+	c.Checked++
+	if v.malformed > 0 {
+		c.Malformed++
+	}
+	if v.unterminated {
+		c.MissingFinalNewline++
+	}
+	if !v.sawEnd {
+		c.MissingEnd++
+	}
+	if v.repaired {
+		c.Repaired++
+	}
+}
+
+func (s *streamStats) get(nodeID string) streamCounters {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c := s.nodes[nodeID]; c != nil {
+		return *c
+	}
+	return streamCounters{}
+}
+
+// streamValidation 返回是否校验 SSE 分帧以及是否修复缺失的结尾换行，默认关闭。
+func (p *Server) streamValidation() (validate, repair bool) {
+	if p.settingsCache == nil {
+		return false, false
+	}
+	return p.settingsCache.GetBool("stream.validate", false), p.settingsCache.GetBool("stream.repair", true)
+}
+
+// sseValidator 逐行检查上游 SSE 分帧：每行须为空行、注释或 event/data/id/retry 字段；
+// 读到 EOF 时若最后一行或最后一个事件未以换行结束，按配置补齐，避免客户端丢弃最后一个事件。
+type sseValidator struct {
+	io.ReadCloser
+	repair bool
+	onDone func(*sseValidator)
+
+	line    []byte // 当前行的行首片段
+	lineLen int
+	inEvent bool // 当前事件尚未遇到空行
+
+	malformed    int
+	sawEnd       bool
+	unterminated bool
+	repaired     bool
+	pending      []byte // EOF 时待补齐的换行
+	finished     bool
+	readErr      bool
+	closed       bool
+}
+
+func (v *sseValidator) Read(p []byte) (int, error) {
+	if v.finished {
+		if len(v.pending) > 0 {
+			n := copy(p, v.pending)
+			v.pending = v.pending[n:]
+			return n, nil
+		}
+		return 0, io.EOF
+	}
+	n, err := v.ReadCloser.Read(p)
+	for _, c := range p[:n] {
+		v.scan(c)
+	}
+	switch {
+	case err == io.EOF:
+		v.finish()
+		if len(v.pending) > 0 {
+			m := copy(p[n:], v.pending)
+			v.pending = v.pending[m:]
+			return n + m, nil
+		}
+	case err != nil:
+		v.readErr = true
+	}
+	return n, err
+}
+
+func (v *sseValidator) scan(c byte) {
+	if c != '\n' {
+		if len(v.line) < sseLinePrefixLen {
+			v.line = append(v.line, c)
+		}
+		v.lineLen++
+		return
+	}
+	v.endLine()
+}
+
+func (v *sseValidator) endLine() {
+	line := bytes.TrimSuffix(v.line, []byte("\r"))
+	if v.lineLen == 0 || len(line) == 0 {
+		v.inEvent = false
+	} else {
+		v.inEvent = true
+		if !validSSEField(line) {
+			v.malformed++
+		}
+		if bytes.HasPrefix(line, []byte("event: message_stop")) || bytes.HasPrefix(line, []byte("data: [DONE]")) {
+			v.sawEnd = true
+		}
+	}
+	v.line = v.line[:0]
+	v.lineLen = 0
+}
+
+// finish 在上游 EOF 时检查结尾，需要时生成补齐的换行。
+func (v *sseValidator) finish() {
+	v.finished = true
+	var fix []byte
+	if v.lineLen > 0 {
+		v.endLine()
+		fix = append(fix, '\n')
+		v.unterminated = true
+	}
+	if v.inEvent {
+		fix = append(fix, '\n')
+		v.unterminated = true
+	}
+	if v.repair && len(fix) > 0 {
+		v.pending = fix
+		v.repaired = true
+	}
+}
+
+// validSSEField 判断行是否为注释或已知字段（允许不带冒号的字段名）。
+func validSSEField(line []byte) bool {
+	if line[0] == ':' {
+		return true
+	}
+	name := line
+	if i := bytes.IndexByte(line, ':'); i >= 0 {
+		name = line[:i]
+	}
+	switch string(name) {
+	case "event", "data", "id", "retry":
+		return true
+	}
+	return false
+}
+
+func (v *sseValidator) Close() error {
+	err := v.ReadCloser.Close()
+	// 未读到 EOF 且上游未出错说明客户端提前断开，此时无法判断流是否完整，不计数。
+	if !v.closed && (v.finished || v.readErr) && v.onDone != nil {
+		v.onDone(v)
+	}
+	v.closed = true
+	return err
+}
+
+// GET /api/metrics/streams
+// 按节点返回 SSE 流完整性计数；非管理员仅可查看本账号节点。
+func (p *Server) handleStreamStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	caller := accountFromCtx(r)
+	if caller == nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		return
+	}
+	admin := isAdmin(r.Context())
+	type nodeRef struct{ id, name, accountID string }
+	var refs []nodeRef
+	p.mu.RLock()
+	for _, acc := range p.accounts {
+		if !admin && acc.ID != caller.ID {
+			continue
+		}
+		for id, n := range acc.Nodes {
+			refs = append(refs, nodeRef{id, n.Name, acc.ID})
+		}
+	}
+	p.mu.RUnlock()
+	sort.Slice(refs, func(i, j int) bool { return refs[i].name < refs[j].name })
+
+	nodes := make([]map[string]interface{}, 0, len(refs))
+	for _, ref := range refs {
+		c := p.streamStats.get(ref.id)
+		nodes = append(nodes, map[string]interface{}{
+			"node_id":               ref.id,
+			"node_name":             ref.name,
+			"account_id":            ref.accountID,
+			"checked":               c.Checked,
+			"malformed":             c.Malformed,
+			"missing_final_newline": c.MissingFinalNewline,
+			"missing_end":           c.MissingEnd,
+			"repaired":              c.Repaired,
+		})
+	}
+	validate, repair := p.streamValidation()
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"validate": validate,
+		"repair":   repair,
+		"nodes":    nodes,
+		"salvage":  p.salvage.view(),
+	})
+}
@@ -0,0 +1,395 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// 流式响应中途失败时的处理方式（账号策略 stream_failure）。
+const (
+	streamFailureErrorEvent = "error_event" // 向客户端补发结构化 error 事件后结束（默认）
+	streamFailureContinue   = "continue"    // 携带已生成的文本切换到其他节点续写，失败时退回 error 事件
+	streamFailureClose      = "close"       // 直接断开连接，不做处理
+)
+
+const (
+	maxSalvagePrefix   = 1 << 20 // 续写时携带的已生成文本上限
+	salvageReadBufSize = 32 * 1024
+)
+
+// salvageRequest 续写所需的原始请求，仅在账号开启 continue 时采集。
+type salvageRequest struct {
+	body   []byte
+	header http.Header
+	path   string
+}
+
+// salvageStats 中途失败处理计数。
+type salvageStats struct {
+	failures    atomic.Int64 // 检测到的中途失败
+	continued   atomic.Int64 // 成功切换到其他节点续写
+	errorEvents atomic.Int64 // 补发 error 事件
+}
+
+func (s *salvageStats) view() map[string]interface{} {
+	return map[string]interface{}{
+		"failures":     s.failures.Load(),
+		"continued":    s.continued.Load(),
+		"error_events": s.errorEvents.Load(),
+	}
+}
+
+func validStreamFailureMode(mode string) bool {
+	switch mode {
+	case "", streamFailureErrorEvent, streamFailureContinue, streamFailureClose:
+		return true
+	}
+	return false
+}
+
+// streamFailureMode 返回账号的中途失败处理方式，未配置时为 error_event。
+func (p *Server) streamFailureMode(acc *Account) string {
+	if mode := strings.ToLower(p.accountPolicy(acc).StreamFailure); mode != "" {
+		return mode
+	}
+	return streamFailureErrorEvent
+}
+
+// prepareSalvage 在账号开启续写时保存原始请求体与请求头，需在转发前调用。
+func (p *Server) prepareSalvage(r *http.Request, acc *Account, u *usage) {
+	if u == nil || r.Method != http.MethodPost || p.streamFailureMode(acc) != streamFailureContinue ||
+		!strings.Contains(strings.ToLower(r.Header.Get("Content-Type")), "application/json") {
+		return
+	}
+	body, err := peekBody(r)
+	if err != nil || len(body) == 0 {
+		return
+	}
+	u.salvage = &salvageRequest{body: body, header: r.Header.Clone(), path: r.URL.Path}
+}
+
+// salvageReader 按完整事件转发上游 SSE，并记录已生成的文本；上游中途失败时按账号配置
+// 切换到其他节点续写或补发 error 事件，避免 ReverseProxy 因读取错误直接中断连接。
+type salvageReader struct {
+	src    io.ReadCloser
+	server *Server
+	ctx    context.Context
+	acc    *Account
+	node   *Node
+	mode   string
+	req    *salvageRequest
+
+	chunk []byte
+	buf   []byte // 尚未构成完整事件的数据
+	out   []byte // 待输出的数据
+	eof   bool
+	done  bool // 已收到 message_stop、[DONE] 或上游自身的 error 事件
+
+	prefix      strings.Builder
+	continuable bool
+	openIndex   int // 当前未结束的文本块序号，-1 表示无
+	nextIndex   int
+	remap       *continuationMap // 续写中，对新响应的事件做序号映射
+}
+
+func (p *Server) newSalvageReader(resp *http.Response, acc *Account, node *Node, u *usage) *salvageReader {
+	r := &salvageReader{
+		src:         resp.Body,
+		server:      p,
+		ctx:         resp.Request.Context(),
+		acc:         acc,
+		node:        node,
+		mode:        p.streamFailureMode(acc),
+		continuable: true,
+		openIndex:   -1,
+	}
+	if u != nil {
+		r.req = u.salvage
+	}
+	return r
+}
+
+func (r *salvageReader) Read(p []byte) (int, error) {
+	for len(r.out) == 0 {
+		if r.eof {
+			return 0, io.EOF
+		}
+		if r.chunk == nil {
+			r.chunk = make([]byte, salvageReadBufSize)
+		}
+		n, err := r.src.Read(r.chunk)
+		if n > 0 {
+			r.buf = append(r.buf, r.chunk[:n]...)
+			r.drainEvents()
+		}
+		var tail []byte
+		if err == io.EOF && len(r.buf) > 0 {
+			// 缺少结尾空行的最后一个事件也可能是正常的结束事件。
+			tail = r.observe(r.buf)
+		}
+		switch {
+		case err == io.EOF && r.done:
+			r.out = append(r.out, tail...)
+			r.buf = nil
+			r.eof = true
+		case err == io.EOF:
+			if !r.fail(io.ErrUnexpectedEOF) {
+				r.out = append(r.out, r.buf...)
+				r.buf = nil
+				r.eof = true
+			}
+		case err != nil:
+			if !r.fail(err) {
+				return 0, err
+			}
+		}
+	}
+	n := copy(p, r.out)
+	r.out = r.out[n:]
+	return n, nil
+}
+
+func (r *salvageReader) Close() error {
+	return r.src.Close()
+}
+
+// drainEvents 取出缓冲中的完整事件，半个事件留待后续数据。
+func (r *salvageReader) drainEvents() {
+	for {
+		end := sseEventEnd(r.buf)
+		if end < 0 {
+			return
+		}
+		r.out = append(r.out, r.observe(r.buf[:end])...)
+		r.buf = r.buf[end:]
+	}
+}
+
+// sseEventEnd 返回首个完整事件（含结尾空行）的长度，不存在时返回 -1。
+func sseEventEnd(b []byte) int {
+	end := -1
+	if i := bytes.Index(b, []byte("\n\n")); i >= 0 {
+		end = i + 2
+	}
+	if i := bytes.Index(b, []byte("\r\n\r\n")); i >= 0 && (end < 0 || i+4 < end) {
+		end = i + 4
+	}
+	return end
+}
+
+// observe 记录事件对续写状态的影响，返回需要转发的内容。
+func (r *salvageReader) observe(raw []byte) []byte {
+	name, data := parseSSEEvent(raw)
+	if name == "message_stop" || name == "error" || bytes.Equal(data, []byte("[DONE]")) {
+		r.done = true
+	}
+	if r.remap != nil {
+		return r.remap.apply(name, data, raw)
+	}
+	var ev struct {
+		Index        int `json:"index"`
+		ContentBlock struct {
+			Type string `json:"type"`
+		} `json:"content_block"`
+		Delta struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		} `json:"delta"`
+	}
+	switch name {
+	case "content_block_start":
+		_ = json.Unmarshal(data, &ev)
+		r.openIndex, r.nextIndex = ev.Index, ev.Index+1
+		if ev.ContentBlock.Type != "text" {
+			// 工具调用或思考块无法以预填充方式续写。
+			r.continuable = false
+		}
+	case "content_block_delta":
+		_ = json.Unmarshal(data, &ev)
+		if ev.Delta.Type != "text_delta" || r.prefix.Len()+len(ev.Delta.Text) > maxSalvagePrefix {
+			r.continuable = false
+		} else {
+			r.prefix.WriteString(ev.Delta.Text)
+		}
+	case "content_block_stop":
+		r.openIndex = -1
+	}
+	return raw
+}
+
+// fail 处理上游中途失败，返回 false 表示按 close 方式把错误交给 ReverseProxy。
+func (r *salvageReader) fail(cause error) bool {
+	if r.mode == streamFailureClose || errors.Is(cause, context.Canceled) || r.ctx.Err() != nil {
+		return false
+	}
+	r.buf = nil // 丢弃未完整的事件，避免客户端解析出错
+	stats := &r.server.salvage
+	stats.failures.Add(1)
+	if r.mode == streamFailureContinue && r.remap == nil && r.continuable && r.req != nil {
+		resp, next, err := r.server.continueStream(r.ctx, r.acc, r.node, r.req, r.prefix.String())
+		if err == nil {
+			r.server.logger.Printf("stream from %s failed (%v), continuing on %s", r.node.Name, cause, next.Name)
+			_ = r.src.Close()
+			r.src = resp.Body
+			r.remap = &continuationMap{base: r.nextIndex}
+			if r.openIndex >= 0 {
+				r.remap = &continuationMap{base: r.openIndex, skipFirstStart: true}
+			}
+			stats.continued.Add(1)
+			return true
+		}
+		r.server.logger.Printf("stream continuation after %s failed: %v", r.node.Name, err)
+	}
+	msg, _ := json.Marshal(map[string]any{
+		"type": "error",
+		"error": map[string]any{
+			"type":    "upstream_stream_interrupted",
+			"message": fmt.Sprintf("upstream stream interrupted: %v", cause),
+			"node":    r.node.Name,
+		},
+	})
+	r.out = append(r.out, fmt.Sprintf("event: error\ndata: %s\n\n", msg)...)
+	r.eof = true
+	stats.errorEvents.Add(1)
+	return true
+}
+
+// continuationMap 将续写响应的事件拼接到原响应：去掉重复的 message_start，内容块序号顺延；
+// 失败时文本块未结束则续写内容直接并入该块。
+type continuationMap struct {
+	base           int
+	skipFirstStart bool
+}
+
+func (m *continuationMap) apply(name string, data, raw []byte) []byte {
+	switch name {
+	case "message_start", "ping":
+		return nil
+	case "content_block_start", "content_block_delta", "content_block_stop":
+		var obj map[string]any
+		if err := json.Unmarshal(data, &obj); err != nil {
+			return raw
+		}
+		idx, _ := obj["index"].(float64)
+		if name == "content_block_start" && idx == 0 && m.skipFirstStart {
+			return nil
+		}
+		obj["index"] = m.base + int(idx)
+		b, err := json.Marshal(obj)
+		if err != nil {
+			return raw
+		}
+		return []byte(fmt.Sprintf("event: %s\ndata: %s\n\n", name, b))
+	}
+	return raw
+}
+
+// parseSSEEvent 解析单个事件的事件名与 data 内容（多行 data 以换行拼接）。
+func parseSSEEvent(raw []byte) (string, []byte) {
+	var name string
+	var data [][]byte
+	for _, line := range bytes.Split(raw, []byte("\n")) {
+		line = bytes.TrimSuffix(line, []byte("\r"))
+		switch {
+		case bytes.HasPrefix(line, []byte("event:")):
+			name = strings.TrimSpace(string(line[len("event:"):]))
+		case bytes.HasPrefix(line, []byte("data:")):
+			data = append(data, bytes.TrimPrefix(line[len("data:"):], []byte(" ")))
+		}
+	}
+	return name, bytes.Join(data, []byte("\n"))
+}
+
+// continuationBody 在原请求的 messages 末尾追加已生成的文本作为 assistant 预填充。
+func continuationBody(body []byte, prefix string) ([]byte, error) {
+	var payload map[string]any
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, err
+	}
+	messages, ok := payload["messages"].([]any)
+	if !ok || len(messages) == 0 {
+		return nil, errors.New("request has no messages")
+	}
+	// 预填充内容不能以空白结尾。
+	prefix = strings.TrimRight(prefix, " \t\r\n")
+	if prefix != "" {
+		last, _ := messages[len(messages)-1].(map[string]any)
+		if last != nil && last["role"] == "assistant" {
+			existing, ok := last["content"].(string)
+			if !ok {
+				return nil, errors.New("cannot extend structured assistant prefill")
+			}
+			last["content"] = existing + prefix
+		} else {
+			messages = append(messages, map[string]any{"role": "assistant", "content": prefix})
+		}
+	}
+	payload["messages"] = messages
+	payload["stream"] = true
+	return json.Marshal(payload)
+}
+
+// continueStream 选择失败节点之外的最佳节点，携带已生成的文本重新发起流式请求。
+func (p *Server) continueStream(ctx context.Context, acc *Account, failed *Node, req *salvageRequest, prefix string) (*http.Response, *Node, error) {
+	if acc == nil {
+		return nil, nil, errors.New("account missing")
+	}
+	body, err := continuationBody(req.body, prefix)
+	if err != nil {
+		return nil, nil, err
+	}
+	p.mu.RLock()
+	others := make(map[string]*Node, len(acc.Nodes))
+	for id, n := range acc.Nodes {
+		if failed == nil || id != failed.ID {
+			others[id] = n
+		}
+	}
+	_, next := bestRoutableNode(others)
+	var snapshot Node
+	if next != nil {
+		snapshot = *next
+	}
+	p.mu.RUnlock()
+	if next == nil {
+		return nil, nil, errors.New("no other routable node")
+	}
+
+	target := *snapshot.URL
+	target.Path = strings.TrimSuffix(target.Path, "/") + "/" + strings.TrimPrefix(req.path, "/")
+	out, err := http.NewRequestWithContext(ctx, http.MethodPost, target.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+	out.Header = req.header.Clone()
+	for _, k := range []string{nodeOverrideHeader, labelHeader, conversationHeader, "Content-Length", "Accept-Encoding"} {
+		out.Header.Del(k)
+	}
+	out.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	applyNodeHeaders(out.Header, snapshot.Headers)
+	if snapshot.APIKey != "" {
+		out.Header.Set("x-api-key", snapshot.APIKey)
+		out.Header.Set("Authorization", "Bearer "+snapshot.APIKey)
+	}
+	transport := p.transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	resp, err := transport.RoundTrip(out)
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(strings.ToLower(resp.Header.Get("Content-Type")), "text/event-stream") {
+		resp.Body.Close()
+		return nil, nil, fmt.Errorf("node %s returned status %d", snapshot.Name, resp.StatusCode)
+	}
+	return resp, &snapshot, nil
+}
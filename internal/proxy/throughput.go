@@ -0,0 +1,157 @@
+package proxy
+
+import (
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultThroughputInterval = 2 * time.Second
+	minThroughputInterval     = time.Second
+	maxThroughputInterval     = 5 * time.Second
+)
+
+// throughputCounters 账号级实时流量计数，由代理请求路径累加。
+type throughputCounters struct {
+	requests atomic.Int64 // 已完成请求数（累计）
+	tokens   atomic.Int64 // 输入+输出 token（累计）
+	active   atomic.Int64 // 进行中的请求/流
+}
+
+type throughputSample struct {
+	requests int64
+	tokens   int64
+}
+
+func (p *Server) throughputFor(accountID string) *throughputCounters {
+	v, _ := p.throughput.LoadOrStore(accountID, &throughputCounters{})
+	return v.(*throughputCounters)
+}
+
+// ThroughputBroadcaster 周期性计算各账号的瞬时 RPS、活跃流与 tokens/s，并通过 WS 推送 throughput 消息。
+type ThroughputBroadcaster struct {
+	server   *Server
+	logger   *log.Logger
+	stopCh   chan struct{}
+	wg       sync.WaitGroup
+	stopOnce sync.Once
+
+	last   map[string]throughputSample
+	idle   map[string]bool // 已推送过空闲状态的账号，避免重复推送全零数据
+	lastAt time.Time
+}
+
+// NewThroughputBroadcaster 创建实时流量推送器。
+func NewThroughputBroadcaster(server *Server, logger *log.Logger) *ThroughputBroadcaster {
+	if logger == nil {
+		logger = log.Default()
+	}
+	return &ThroughputBroadcaster{
+		server: server,
+		logger: logger,
+		stopCh: make(chan struct{}),
+		last:   make(map[string]throughputSample),
+		idle:   make(map[string]bool),
+	}
+}
+
+// Start 启动推送循环。
+func (t *ThroughputBroadcaster) Start() error {
+	if t == nil || t.server == nil {
+		return nil
+	}
+	t.wg.Add(1)
+	go t.loop()
+	return nil
+}
+
+// Stop 停止推送循环。
+func (t *ThroughputBroadcaster) Stop() {
+	if t == nil {
+		return
+	}
+	t.stopOnce.Do(func() {
+		close(t.stopCh)
+	})
+	t.wg.Wait()
+}
+
+func (t *ThroughputBroadcaster) interval() time.Duration {
+	interval := defaultThroughputInterval
+	if cache := t.server.settingsCache; cache != nil {
+		if sec := cache.GetInt("monitor.throughput_interval_sec", 0); sec > 0 {
+			interval = time.Duration(sec) * time.Second
+		}
+	}
+	if interval < minThroughputInterval {
+		interval = minThroughputInterval
+	}
+	if interval > maxThroughputInterval {
+		interval = maxThroughputInterval
+	}
+	return interval
+}
+
+func (t *ThroughputBroadcaster) loop() {
+	defer t.wg.Done()
+	defer func() {
+		if r := recover(); r != nil {
+			t.logger.Printf("[Throughput] panic recovered: %v", r)
+		}
+	}()
+
+	t.lastAt = time.Now()
+	timer := time.NewTimer(t.interval())
+	defer timer.Stop()
+	for {
+		select {
+		case <-t.stopCh:
+			return
+		case now := <-timer.C:
+			t.tick(now)
+			timer.Reset(t.interval())
+		}
+	}
+}
+
+// tick 计算自上次采样以来的增量速率并推送。
+func (t *ThroughputBroadcaster) tick(now time.Time) {
+	elapsed := now.Sub(t.lastAt).Seconds()
+	t.lastAt = now
+	if elapsed <= 0 {
+		return
+	}
+	t.server.throughput.Range(func(k, v any) bool {
+		accountID := k.(string)
+		c := v.(*throughputCounters)
+		cur := throughputSample{requests: c.requests.Load(), tokens: c.tokens.Load()}
+		prev, seen := t.last[accountID]
+		t.last[accountID] = cur
+		if !seen {
+			prev = cur
+		}
+		active := c.active.Load()
+		reqDelta := cur.requests - prev.requests
+		tokenDelta := cur.tokens - prev.tokens
+		if reqDelta == 0 && tokenDelta == 0 && active == 0 {
+			if t.idle[accountID] {
+				return true
+			}
+			t.idle[accountID] = true
+		} else {
+			t.idle[accountID] = false
+		}
+		if t.server.wsHub != nil {
+			t.server.wsHub.Broadcast(accountID, "throughput", map[string]interface{}{
+				"rps":            float64(reqDelta) / elapsed,
+				"tokens_per_sec": float64(tokenDelta) / elapsed,
+				"active_streams": active,
+				"window_ms":      int64(elapsed * 1000),
+				"timestamp":      now.UnixMilli(),
+			})
+		}
+		return true
+	})
+}
@@ -0,0 +1,400 @@
+package proxy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"qcc_plus/internal/store"
+)
+
+const (
+	defaultRecordBodyBytes        = 256 * 1024
+	maxRecordBodyBytes            = 4 << 20
+	recordingObjectBytes          = 8 << 20  // 单个账号缓冲达到该大小时提前上传
+	maxRecordingPendingBytes      = 64 << 20 // 待上传数据上限，超出后丢弃新样本
+	defaultRecordingFlushInterval = time.Minute
+)
+
+// recordedExchange 录制对象中的一行（JSONL）：一次完整的请求/响应。
+// 请求/响应体为合法 JSON 且未截断时以原始结构保存，否则保存为文本（如 SSE 流）。
+type recordedExchange struct {
+	ID                string          `json:"id"`
+	Time              time.Time       `json:"time"`
+	AccountID         string          `json:"account_id"`
+	NodeID            string          `json:"node_id"`
+	NodeName          string          `json:"node_name"`
+	Method            string          `json:"method"`
+	Path              string          `json:"path"`
+	Model             string          `json:"model,omitempty"`
+	Label             string          `json:"label,omitempty"`
+	Status            int             `json:"status"`
+	DurationMs        int64           `json:"duration_ms"`
+	InputTokens       int64           `json:"input_tokens"`
+	OutputTokens      int64           `json:"output_tokens"`
+	Request           json.RawMessage `json:"request,omitempty"`
+	RequestText       string          `json:"request_text,omitempty"`
+	RequestTruncated  bool            `json:"request_truncated,omitempty"`
+	ResponseType      string          `json:"response_content_type,omitempty"`
+	Response          json.RawMessage `json:"response,omitempty"`
+	ResponseText      string          `json:"response_text,omitempty"`
+	ResponseTruncated bool            `json:"response_truncated,omitempty"`
+}
+
+// recordingStats 账号的录制统计，仅保存在内存中。
+type recordingStats struct {
+	Captured     int64      `json:"captured"`
+	Dropped      int64      `json:"dropped"`
+	Objects      int64      `json:"objects"`
+	Bytes        int64      `json:"bytes"`
+	LastObject   string     `json:"last_object,omitempty"`
+	LastUploadAt *time.Time `json:"last_upload_at,omitempty"`
+	LastError    string     `json:"last_error,omitempty"`
+}
+
+// TrafficRecorder 按账号缓冲采样到的请求/响应，定时以 JSONL 对象写入录制存储，用于构建离线评测数据集。
+type TrafficRecorder struct {
+	server   *Server
+	sink     recordingSink
+	logger   *log.Logger
+	stopCh   chan struct{}
+	kick     chan struct{}
+	wg       sync.WaitGroup
+	stopOnce sync.Once
+
+	mu           sync.Mutex
+	pending      map[string]*bytes.Buffer
+	pendingBytes int64
+	stats        map[string]*recordingStats
+}
+
+// NewTrafficRecorder 创建流量录制器，sink 为 nil 时返回 nil（录制关闭）。
+func NewTrafficRecorder(server *Server, sink recordingSink, logger *log.Logger) *TrafficRecorder {
+	if sink == nil {
+		return nil
+	}
+	if logger == nil {
+		logger = log.Default()
+	}
+	return &TrafficRecorder{
+		server:  server,
+		sink:    sink,
+		logger:  logger,
+		stopCh:  make(chan struct{}),
+		kick:    make(chan struct{}, 1),
+		pending: make(map[string]*bytes.Buffer),
+		stats:   make(map[string]*recordingStats),
+	}
+}
+
+func (t *TrafficRecorder) interval() time.Duration {
+	if cache := t.server.settingsCache; cache != nil {
+		if sec := cache.GetInt("recording.flush_interval_sec", int(defaultRecordingFlushInterval/time.Second)); sec > 0 {
+			return time.Duration(sec) * time.Second
+		}
+	}
+	return defaultRecordingFlushInterval
+}
+
+func (t *TrafficRecorder) statsLocked(accountID string) *recordingStats {
+	s := t.stats[accountID]
+	if s == nil {
+		s = &recordingStats{}
+		t.stats[accountID] = s
+	}
+	return s
+}
+
+// add 追加一行录制数据；待上传数据超限时丢弃。
+func (t *TrafficRecorder) add(accountID string, line []byte) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	stats := t.statsLocked(accountID)
+	if t.pendingBytes+int64(len(line))+1 > maxRecordingPendingBytes {
+		stats.Dropped++
+		return
+	}
+	buf := t.pending[accountID]
+	if buf == nil {
+		buf = &bytes.Buffer{}
+		t.pending[accountID] = buf
+	}
+	buf.Write(line)
+	buf.WriteByte('\n')
+	t.pendingBytes += int64(len(line)) + 1
+	stats.Captured++
+	if buf.Len() >= recordingObjectBytes {
+		select {
+		case t.kick <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// snapshot 返回账号录制统计的副本。
+func (t *TrafficRecorder) snapshot(accountID string) recordingStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return *t.statsLocked(accountID)
+}
+
+// recordingKey 对象路径：<账号>/<年>/<月>/<日>/<时分秒>-<随机>.jsonl。
+func recordingKey(accountID string, now time.Time) string {
+	safe := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' {
+			return r
+		}
+		return '_'
+	}, accountID)
+	return safe + "/" + now.Format("2006/01/02/150405") + "-" + randomToken(4) + ".jsonl"
+}
+
+// flush 上传所有缓冲数据，返回写入的对象数；失败的数据在容量允许时放回缓冲等待下次重试。
+func (t *TrafficRecorder) flush() int {
+	t.mu.Lock()
+	batch := t.pending
+	t.pending = make(map[string]*bytes.Buffer)
+	t.pendingBytes = 0
+	t.mu.Unlock()
+
+	written := 0
+	for accountID, buf := range batch {
+		now := time.Now().UTC()
+		key := recordingKey(accountID, now)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		err := t.sink.Put(ctx, key, buf.Bytes())
+		cancel()
+
+		t.mu.Lock()
+		stats := t.statsLocked(accountID)
+		if err != nil {
+			t.logger.Printf("[TrafficRecorder] upload %s failed: %v", key, err)
+			stats.LastError = err.Error()
+			if t.pendingBytes+int64(buf.Len()) <= maxRecordingPendingBytes {
+				if cur := t.pending[accountID]; cur != nil {
+					buf.Write(cur.Bytes())
+				}
+				t.pending[accountID] = buf
+				t.pendingBytes += int64(buf.Len())
+			} else {
+				stats.Dropped += int64(bytes.Count(buf.Bytes(), []byte{'\n'}))
+			}
+			t.mu.Unlock()
+			continue
+		}
+		stats.Objects++
+		stats.Bytes += int64(buf.Len())
+		stats.LastObject = key
+		stats.LastUploadAt = &now
+		stats.LastError = ""
+		t.mu.Unlock()
+		written++
+	}
+	return written
+}
+
+// Start 启动定时上传循环。
+func (t *TrafficRecorder) Start() error {
+	if t == nil {
+		return nil
+	}
+	t.wg.Add(1)
+	go t.loop()
+	return nil
+}
+
+// Stop 停止循环并上传剩余数据。
+func (t *TrafficRecorder) Stop() {
+	if t == nil {
+		return
+	}
+	t.stopOnce.Do(func() {
+		close(t.stopCh)
+		t.wg.Wait()
+		if n := t.flush(); n > 0 {
+			t.logger.Printf("[TrafficRecorder] uploaded %d objects on shutdown", n)
+		}
+	})
+}
+
+func (t *TrafficRecorder) loop() {
+	defer t.wg.Done()
+	defer func() {
+		if r := recover(); r != nil {
+			t.logger.Printf("[TrafficRecorder] panic recovered: %v", r)
+		}
+	}()
+	timer := time.NewTimer(t.interval())
+	defer timer.Stop()
+	for {
+		select {
+		case <-t.stopCh:
+			return
+		case <-t.kick:
+			t.flush()
+		case <-timer.C:
+			t.flush()
+			timer.Reset(t.interval())
+		}
+	}
+}
+
+// trafficCapture 单个被采样请求的录制状态。
+type trafficCapture struct {
+	limit     int64
+	request   []byte
+	redactor  *redactor
+	responder *recordingWriter
+}
+
+// sampleTraffic 按账号策略的采样率决定是否录制本次请求，命中时读取请求体。
+func (p *Server) sampleTraffic(acc *Account, r *http.Request) *trafficCapture {
+	if p.recorder == nil || acc == nil {
+		return nil
+	}
+	p.mu.RLock()
+	rate, limit, rules := acc.Policy.RecordSampleRate, acc.Policy.RecordMaxBytes, acc.rules
+	p.mu.RUnlock()
+	if rate <= 0 || rand.Float64() >= rate {
+		return nil
+	}
+	body, err := peekBody(r)
+	if err != nil {
+		return nil
+	}
+	if limit <= 0 {
+		limit = defaultRecordBodyBytes
+	}
+	// 录制数据会离开本服务，账号关闭了内置脱敏且没有自定义规则时仍使用内置规则。
+	red := &redactor{rules: builtinRedactRules}
+	if rules != nil && rules.redactor != nil {
+		red = rules.redactor
+	}
+	return &trafficCapture{limit: limit, request: body, redactor: red}
+}
+
+// wrap 包装 ResponseWriter，在透传的同时保留响应体前 limit 字节。
+func (c *trafficCapture) wrap(w http.ResponseWriter) http.ResponseWriter {
+	c.responder = &recordingWriter{ResponseWriter: w, limit: c.limit}
+	return c.responder
+}
+
+// body 先脱敏再截断；未截断且为合法 JSON 时按原始结构保存。
+func (c *trafficCapture) body(b []byte, truncated bool) (json.RawMessage, string, bool) {
+	text := c.redactor.redact(string(b))
+	if int64(len(text)) > c.limit {
+		text = strings.ToValidUTF8(text[:c.limit], "")
+		truncated = true
+	}
+	if !truncated && json.Valid([]byte(text)) {
+		return json.RawMessage(text), "", false
+	}
+	return nil, text, truncated
+}
+
+// recordTraffic 将一次被采样的请求写入录制缓冲。
+func (p *Server) recordTraffic(c *trafficCapture, rec store.RequestLogRecord) {
+	if c == nil || p.recorder == nil {
+		return
+	}
+	ex := recordedExchange{
+		ID:           randomToken(8),
+		Time:         rec.CreatedAt,
+		AccountID:    rec.AccountID,
+		NodeID:       rec.NodeID,
+		NodeName:     rec.NodeName,
+		Method:       rec.Method,
+		Path:         rec.Path,
+		Model:        rec.Model,
+		Label:        rec.Label,
+		Status:       rec.Status,
+		DurationMs:   rec.DurationMs,
+		InputTokens:  rec.InputTokens,
+		OutputTokens: rec.OutputTokens,
+	}
+	ex.Request, ex.RequestText, ex.RequestTruncated = c.body(c.request, false)
+	if w := c.responder; w != nil {
+		resp, truncated := w.buf.Bytes(), w.truncated
+		if strings.EqualFold(w.Header().Get("Content-Encoding"), "gzip") {
+			// 上游压缩透传时解压后再录制；截断的压缩流无法解压，只保留可解出的部分。
+			if zr, err := gzip.NewReader(bytes.NewReader(resp)); err == nil {
+				plain, err := io.ReadAll(io.LimitReader(zr, c.limit+1))
+				resp, truncated = plain, truncated || err != nil || int64(len(plain)) > c.limit
+			}
+		}
+		ex.ResponseType = w.Header().Get("Content-Type")
+		ex.Response, ex.ResponseText, ex.ResponseTruncated = c.body(resp, truncated)
+	}
+	line, err := json.Marshal(ex)
+	if err != nil {
+		return
+	}
+	p.recorder.add(rec.AccountID, line)
+}
+
+// recordingWriter 透传响应并保留前 limit 字节供录制。
+type recordingWriter struct {
+	http.ResponseWriter
+	limit     int64
+	buf       bytes.Buffer
+	truncated bool
+}
+
+func (w *recordingWriter) Write(b []byte) (int, error) {
+	if room := w.limit - int64(w.buf.Len()); room > 0 {
+		if int64(len(b)) > room {
+			w.buf.Write(b[:room])
+			w.truncated = true
+		} else {
+			w.buf.Write(b)
+		}
+	} else if len(b) > 0 {
+		w.truncated = true
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *recordingWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *recordingWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+// GET /api/accounts/:id/recording 查看账号的流量录制配置与上传统计
+func (p *Server) handleAccountRecording(w http.ResponseWriter, r *http.Request, acc *Account) {
+	if !canManageAccount(r.Context(), acc.ID) {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	policy := p.accountPolicy(acc)
+	maxBytes := policy.RecordMaxBytes
+	if maxBytes <= 0 {
+		maxBytes = defaultRecordBodyBytes
+	}
+	view := map[string]interface{}{
+		"account_id":       acc.ID,
+		"sink_configured":  p.recorder != nil,
+		"sample_rate":      policy.RecordSampleRate,
+		"max_body_bytes":   maxBytes,
+		"recording_active": p.recorder != nil && policy.RecordSampleRate > 0,
+	}
+	if p.recorder != nil {
+		view["sink"] = p.recorder.sink.Kind()
+		view["stats"] = p.recorder.snapshot(acc.ID)
+	}
+	writeJSON(w, http.StatusOK, view)
+}
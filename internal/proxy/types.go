@@ -16,9 +16,20 @@ type Node struct {
 	CreatedAt         time.Time
 	Metrics           metrics
 	Weight            int
+	AdaptiveWeight    int // 自适应调度得出的运行时权重，0 表示沿用 Weight；仅保存在内存中
 	Failed            bool
 	Disabled          bool // 用户手动禁用
 	LastError         string
+	State             string            // 状态机状态，见 NodeState* 常量
+	StateChangedAt    time.Time         // 最近一次状态迁移时间
+	DrainAutoDisable  bool              // 排空完成后自动禁用
+	WarmupSince       time.Time         // 从 down 恢复的时间，预热期内逐步放量
+	Headers           map[string]string // 转发与探活时附加的请求头，只整体替换不原地修改
+	HealthInterval    time.Duration     // 节点级健康检查间隔，0 表示沿用账号配置
+	HealthFailStreak  int               // 连续健康检查失败次数，用于退避，首次成功清零
+	ClientCert        *nodeClientCert   // mTLS 客户端证书信息，未配置时为 nil
+	CABundle          *nodeCABundle     // 自定义 CA 信息，未配置时使用系统根证书
+	DNS               *nodeDNS          // 解析设置（固定 IP 或指定 DNS 服务器），未配置时使用系统解析
 }
 
 // metrics 记录节点请求与健康状况统计。
@@ -31,15 +42,24 @@ type metrics struct {
 	TotalBytes        int64
 	LastPingMS        int64
 	LastPingErr       string
+	LastDNSMS         int64 // 最近一次发生解析的健康检查中的解析耗时
 	LastHealthCheckAt time.Time
 	FailCount         int64 // 总失败次数（非200）
 	FailStreak        int64 // 连续失败次数
 }
 
-// usage 描述一次请求的 token 统计。
+// usage 描述一次请求的 token 统计及上游异常，由反向代理回调填充。
 type usage struct {
-	input  int64
-	output int64
+	input          int64
+	output         int64
+	upstreamStatus int             // 上游真实状态码（重试耗尽时为最后一次的状态）
+	transportErr   error           // 连接、超时等传输层错误
+	streamBroken   bool            // SSE 流读取失败、缺少结束事件或包含 error 事件
+	firstByteStall bool            // 流式响应头已返回但首字节超时
+	hedged         bool            // 已向备用节点发起对冲请求
+	hedgeWon       bool            // 响应来自备用节点
+	hedgeNode      *Node           // 对冲胜出时实际服务的备用节点
+	salvage        *salvageRequest // 中途失败续写所需的原始请求
 }
 
 // Config 描述可运行时调整的系统配置。
@@ -51,15 +71,31 @@ type Config struct {
 
 // Account 表示一个租户，持有独立的节点与配置。
 type Account struct {
-	ID          string
-	Name        string
-	Password    string
-	ProxyAPIKey string
-	IsAdmin     bool
-	Nodes       map[string]*Node
-	ActiveID    string
-	Config      Config
-	FailedSet   map[string]struct{}
+	ID              string
+	Name            string
+	Password        string
+	ProxyAPIKey     string
+	IsAdmin         bool
+	Nodes           map[string]*Node
+	ActiveID        string
+	Config          Config
+	FailedSet       map[string]struct{}
+	Policy          AccountPolicy
+	NodeTemplate    NodeTemplate     // 新建/导入节点的默认配置
+	Display         AccountDisplay   // 报表时间的展示时区与语言
+	Key             KeyLifecycle     // 代理密钥的过期配置与使用记录
+	ServiceAccounts []ServiceAccount // 仅持有代理密钥的服务账号
+	Users           []AccountUser    // 通过邀请加入的登录成员
+	Invitations     []Invitation     // 加入账号的邀请
+	NodeHooks       []NodeHook       // 外部自动化切换节点状态的入站 Webhook
+	ReplayCorpus    []ReplayEntry    // 请求回放语料
+	ReplayRuns      []ReplayRun      // 最近的回放结果
+	PasswordMeta    passwordMeta     // 账号口令修改时间与历史
+	rules           *compiledPolicy  // 由 Policy 编译的过滤/脱敏规则
+	displayLoc      *time.Location   // 由 Display.Timezone 解析的时区
+
+	keyPersistedAt     time.Time // Key 使用记录最近一次持久化时间
+	servicePersistedAt time.Time // ServiceAccounts 使用时间最近一次持久化时间
 }
 
 // TunnelStatus 返回给前端的隧道状态视图。
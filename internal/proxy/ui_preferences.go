@@ -0,0 +1,161 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"qcc_plus/internal/store"
+	"qcc_plus/internal/timeutil"
+)
+
+const (
+	uiPreferencesSettingKey = "ui.preferences"
+	maxUIPreferencesBytes   = 64 << 10
+	maxUIHiddenNodes        = 500
+	maxUITimeRanges         = 50
+)
+
+// UIPreferences 监控界面的个人偏好，按登录用户保存为 user 作用域配置 ui.preferences。
+// Layout 的结构由前端定义，服务端只校验为合法的 JSON 对象或数组。
+type UIPreferences struct {
+	Layout      json.RawMessage   `json:"layout,omitempty"`
+	TimeRanges  map[string]string `json:"time_ranges,omitempty"` // 视图 → 选择的时间范围，如 {"dashboard":"24h"}
+	HiddenNodes []string          `json:"hidden_nodes,omitempty"`
+}
+
+// normalize 校验偏好并去除重复的隐藏节点。
+func (prefs UIPreferences) normalize() (UIPreferences, error) {
+	if len(prefs.Layout) > 0 {
+		if s := strings.TrimSpace(string(prefs.Layout)); s == "null" {
+			prefs.Layout = nil
+		} else if !strings.HasPrefix(s, "{") && !strings.HasPrefix(s, "[") {
+			return prefs, errors.New("layout must be an object or array")
+		}
+	}
+	if len(prefs.TimeRanges) > maxUITimeRanges {
+		return prefs, fmt.Errorf("too many time_ranges (max %d)", maxUITimeRanges)
+	}
+	for view, rng := range prefs.TimeRanges {
+		if strings.TrimSpace(view) == "" || len(view) > 64 || len(rng) > 64 {
+			return prefs, fmt.Errorf("invalid time range for view %q", view)
+		}
+	}
+	if len(prefs.HiddenNodes) > maxUIHiddenNodes {
+		return prefs, fmt.Errorf("too many hidden_nodes (max %d)", maxUIHiddenNodes)
+	}
+	seen := make(map[string]bool, len(prefs.HiddenNodes))
+	hidden := make([]string, 0, len(prefs.HiddenNodes))
+	for _, id := range prefs.HiddenNodes {
+		if id = strings.TrimSpace(id); id != "" && !seen[id] {
+			seen[id] = true
+			hidden = append(hidden, id)
+		}
+	}
+	prefs.HiddenNodes = hidden
+	return prefs, nil
+}
+
+// uiPreferences 读取用户偏好，未保存时返回零值；无存储时使用内存中的偏好。
+func (p *Server) uiPreferences(userID string) (UIPreferences, *store.Setting, error) {
+	var prefs UIPreferences
+	if p.store == nil {
+		if v, ok := p.uiPrefs.Load(userID); ok {
+			prefs = v.(UIPreferences)
+		}
+		return prefs, nil, nil
+	}
+	setting, err := p.store.GetSetting(uiPreferencesSettingKey, "user", userID)
+	if errors.Is(err, store.ErrNotFound) || (err == nil && setting == nil) {
+		return prefs, nil, nil
+	}
+	if err != nil {
+		return prefs, nil, err
+	}
+	if b, err := json.Marshal(setting.Value); err == nil {
+		_ = json.Unmarshal(b, &prefs)
+	}
+	return prefs, setting, nil
+}
+
+// setUIPreferences 整体替换用户偏好。
+func (p *Server) setUIPreferences(userID string, prefs UIPreferences) (*store.Setting, error) {
+	if p.store == nil {
+		p.uiPrefs.Store(userID, prefs)
+		return nil, nil
+	}
+	id := userID
+	desc := "监控界面个人偏好"
+	setting := &store.Setting{
+		Key:         uiPreferencesSettingKey,
+		Scope:       "user",
+		AccountID:   &id,
+		Value:       prefs,
+		DataType:    "object",
+		Category:    "monitor",
+		Description: &desc,
+		UpdatedBy:   &id,
+	}
+	if err := p.store.UpsertSetting(setting); err != nil {
+		return nil, err
+	}
+	return setting, nil
+}
+
+func uiPreferencesView(userID string, prefs UIPreferences, setting *store.Setting) map[string]interface{} {
+	resp := map[string]interface{}{"user_id": userID, "preferences": prefs}
+	if setting != nil && !setting.UpdatedAt.IsZero() {
+		resp["updated_at"] = timeutil.FormatBeijingTime(setting.UpdatedAt)
+	}
+	return resp
+}
+
+// GET/PUT /api/ui/preferences
+// 偏好跟随登录用户：管理员代入租户时仍读写自己的偏好。PUT 整体替换。
+func (p *Server) handleUIPreferences(w http.ResponseWriter, r *http.Request) {
+	if accountFromCtx(r) == nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		return
+	}
+	userID := auditActor(r)
+	switch r.Method {
+	case http.MethodGet:
+		prefs, setting, err := p.uiPreferences(userID)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, uiPreferencesView(userID, prefs, setting))
+	case http.MethodPut:
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxUIPreferencesBytes+1))
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "read body failed"})
+			return
+		}
+		if len(body) > maxUIPreferencesBytes {
+			writeJSON(w, http.StatusRequestEntityTooLarge, map[string]string{"error": fmt.Sprintf("preferences too large (max %d bytes)", maxUIPreferencesBytes)})
+			return
+		}
+		var prefs UIPreferences
+		if err := json.Unmarshal(body, &prefs); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
+			return
+		}
+		prefs, err = prefs.normalize()
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		setting, err := p.setUIPreferences(userID, prefs)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, uiPreferencesView(userID, prefs, setting))
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
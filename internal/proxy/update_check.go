@@ -0,0 +1,218 @@
+package proxy
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"qcc_plus/internal/i18n"
+	"qcc_plus/internal/timeutil"
+	"qcc_plus/internal/version"
+)
+
+const (
+	defaultUpdateCheckHours = 24
+	updateCheckTimeout      = 15 * time.Second
+	updateCheckStartDelay   = time.Minute
+)
+
+// UpdateNotifier 周期性查询发布源，发现新版本时向管理员的 WebSocket 连接推送 update_available。
+// 通过配置 update.check_enabled=false 关闭，关闭后不再访问外部网络。
+type UpdateNotifier struct {
+	server   *Server
+	checker  *version.UpdateChecker
+	logger   *log.Logger
+	stopCh   chan struct{}
+	wg       sync.WaitGroup
+	stopOnce sync.Once
+
+	mu       sync.Mutex
+	notified string // 已推送过的最新版本，避免重复提醒
+}
+
+// NewUpdateNotifier 创建版本更新检查器。
+func NewUpdateNotifier(server *Server, logger *log.Logger) *UpdateNotifier {
+	if logger == nil {
+		logger = log.Default()
+	}
+	return &UpdateNotifier{
+		server:  server,
+		checker: version.NewUpdateChecker(nil),
+		logger:  logger,
+		stopCh:  make(chan struct{}),
+	}
+}
+
+// Start 启动检查循环，首次检查延迟一分钟，避免拖慢启动。
+func (u *UpdateNotifier) Start() error {
+	if u == nil || u.server == nil {
+		return nil
+	}
+	u.wg.Add(1)
+	go u.loop()
+	return nil
+}
+
+// Stop 停止检查循环。
+func (u *UpdateNotifier) Stop() {
+	if u == nil {
+		return
+	}
+	u.stopOnce.Do(func() {
+		close(u.stopCh)
+	})
+	u.wg.Wait()
+}
+
+func (u *UpdateNotifier) enabled() bool {
+	cache := u.server.settingsCache
+	return cache == nil || cache.GetBool("update.check_enabled", true)
+}
+
+func (u *UpdateNotifier) feedURL() string {
+	if cache := u.server.settingsCache; cache != nil {
+		return cache.GetString("update.feed_url", "")
+	}
+	return ""
+}
+
+func (u *UpdateNotifier) interval() time.Duration {
+	hours := defaultUpdateCheckHours
+	if cache := u.server.settingsCache; cache != nil {
+		if n := cache.GetInt("update.check_interval_hours", hours); n > 0 {
+			hours = n
+		}
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+func (u *UpdateNotifier) loop() {
+	defer u.wg.Done()
+	defer func() {
+		if r := recover(); r != nil {
+			u.logger.Printf("[UpdateCheck] panic recovered: %v", r)
+		}
+	}()
+
+	timer := time.NewTimer(updateCheckStartDelay)
+	defer timer.Stop()
+	for {
+		select {
+		case <-u.stopCh:
+			return
+		case <-timer.C:
+			if u.enabled() && !u.server.maintenanceActive() {
+				if err := u.check(); err != nil {
+					u.logger.Printf("[UpdateCheck] check failed: %v", err)
+				}
+			}
+			timer.Reset(u.interval())
+		}
+	}
+}
+
+// check 查询一次发布源，有新版本且尚未提醒过时推送给管理员。
+func (u *UpdateNotifier) check() error {
+	ctx, cancel := context.WithTimeout(context.Background(), updateCheckTimeout)
+	defer cancel()
+	if _, err := u.checker.Check(ctx, u.feedURL()); err != nil {
+		return err
+	}
+	st := u.checker.Status()
+	if !st.UpdateAvailable {
+		return nil
+	}
+	u.mu.Lock()
+	if u.notified == st.Latest.Version {
+		u.mu.Unlock()
+		return nil
+	}
+	u.notified = st.Latest.Version
+	u.mu.Unlock()
+	u.server.wsHub.BroadcastAdmins("update_available", updateStatusView(st))
+	return nil
+}
+
+// featureMatrix 汇总当前部署启用的子系统，便于排查问题时快速了解部署形态。
+func (p *Server) featureMatrix() version.Features {
+	f := version.Features{
+		DBBackend:          "none",
+		MetricsStore:       p.store != nil,
+		SettingsStore:      p.settingsCache != nil,
+		WSHub:              p.wsHub != nil,
+		HealthScheduler:    p.healthScheduler != nil,
+		MetricsScheduler:   p.metricsScheduler != nil,
+		BenchmarkScheduler: p.benchmarkSched != nil,
+		AdaptiveWeight:     p.adaptiveWeight != nil,
+		Notifications:      p.notifyMgr != nil,
+		UpdateCheck:        p.updates != nil && p.updates.enabled(),
+	}
+	if p.store != nil {
+		f.DBBackend = p.store.Backend()
+	}
+	p.tunnelMu.Lock()
+	f.Tunnel = p.tunnelMgr != nil
+	p.tunnelMu.Unlock()
+	return f
+}
+
+func updateStatusView(st version.UpdateStatus) map[string]interface{} {
+	view := map[string]interface{}{
+		"current":          st.Current,
+		"latest":           nil,
+		"update_available": st.UpdateAvailable,
+		"changelog_url":    nil,
+		"checked_at":       nil,
+	}
+	if st.Latest != nil {
+		view["latest"] = st.Latest.Version
+		if st.Latest.ChangelogURL != "" {
+			view["changelog_url"] = st.Latest.ChangelogURL
+		}
+		if !st.Latest.PublishedAt.IsZero() {
+			view["published_at"] = timeutil.FormatBeijingTime(st.Latest.PublishedAt)
+		}
+	}
+	if !st.CheckedAt.IsZero() {
+		view["checked_at"] = timeutil.FormatBeijingTime(st.CheckedAt)
+	}
+	if st.Error != "" {
+		view["error"] = st.Error
+	}
+	return view
+}
+
+// GET /api/version?refresh=1
+// 返回当前版本与最近一次检查到的最新版本；refresh=1 立即检查（仅管理员，关闭检查时不生效）。
+func (p *Server) handleAPIVersion(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if p.updates == nil {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "update check not available"})
+		return
+	}
+	enabled := p.updates.enabled()
+	refresh := r.URL.Query().Get("refresh")
+	if (refresh == "1" || refresh == "true") && enabled {
+		if !isAdmin(r.Context()) {
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+			return
+		}
+		if err := p.updates.check(); err != nil && p.logger != nil {
+			p.logger.Printf("[UpdateCheck] manual check failed: %v", err)
+		}
+	}
+	locale := i18n.Negotiate(r.Header.Get("Accept-Language"))
+	w.Header().Set("Content-Language", locale)
+	resp := updateStatusView(p.updates.checker.Status())
+	info := version.GetLocalizedVersionInfo(locale, timeutil.BeijingLocation)
+	features := p.featureMatrix()
+	info.Features = &features
+	resp["build"] = info
+	resp["check_enabled"] = enabled
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,636 @@
+package proxy
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"qcc_plus/internal/notify"
+	"qcc_plus/internal/timeutil"
+)
+
+const (
+	upstreamStatusAPIPrefix     = "/api/upstream-status"
+	upstreamWebhookPrefix       = "/api/upstream-status/webhook/"
+	upstreamWebhookTokenHeader  = "X-QCC-Webhook-Token"
+	maxUpstreamWebhookBytes     = 1 << 20
+	maxUpstreamFeedBytes        = 4 << 20
+	defaultUpstreamPollInterval = 120
+	upstreamPollTimeout         = 15 * time.Second
+	upstreamRSSMaxAge           = 24 * time.Hour // RSS 没有状态字段，只把近 24 小时内未标记为已解决的条目视为进行中
+)
+
+// upstreamProviderConfig 一个上游服务商：Hosts 用于匹配节点地址（精确或子域名），FeedURL 为可选的状态拉取地址。
+type upstreamProviderConfig struct {
+	Hosts   []string `json:"hosts"`
+	FeedURL string   `json:"feed_url"`
+}
+
+// defaultUpstreamProviders 未配置 upstream_status.providers 时使用的官方状态页。
+var defaultUpstreamProviders = map[string]upstreamProviderConfig{
+	"anthropic": {Hosts: []string{"api.anthropic.com"}, FeedURL: "https://status.anthropic.com/api/v2/incidents/unresolved.json"},
+	"openai":    {Hosts: []string{"api.openai.com"}, FeedURL: "https://status.openai.com/api/v2/incidents/unresolved.json"},
+}
+
+// upstreamIncident 上游服务商公布的一条进行中事件。
+type upstreamIncident struct {
+	Provider  string    `json:"provider"`
+	ID        string    `json:"id"`
+	Title     string    `json:"title"`
+	Status    string    `json:"status"`
+	Impact    string    `json:"impact,omitempty"`
+	URL       string    `json:"url,omitempty"`
+	Source    string    `json:"source"` // webhook/feed
+	StartedAt time.Time `json:"started_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (inc *upstreamIncident) label() string {
+	return inc.Provider + ": " + inc.Title
+}
+
+func (inc *upstreamIncident) view() map[string]interface{} {
+	return map[string]interface{}{
+		"provider":   inc.Provider,
+		"id":         inc.ID,
+		"title":      inc.Title,
+		"status":     inc.Status,
+		"impact":     inc.Impact,
+		"url":        inc.URL,
+		"source":     inc.Source,
+		"started_at": timeutil.FormatBeijingTime(inc.StartedAt),
+		"updated_at": timeutil.FormatBeijingTime(inc.UpdatedAt),
+	}
+}
+
+// upstreamStatusTracker 按服务商记录进行中的上游事件，只保存在内存中，重启后由拉取或下一次推送恢复。
+type upstreamStatusTracker struct {
+	mu        sync.RWMutex
+	incidents map[string]map[string]*upstreamIncident // provider -> incident id -> incident
+}
+
+// update 新增/更新或（resolved 为 true 时）移除一条事件，返回服务商的事件集合是否有变化。
+func (t *upstreamStatusTracker) update(inc upstreamIncident, resolved bool) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	byID := t.incidents[inc.Provider]
+	if resolved {
+		if byID[inc.ID] == nil {
+			return false
+		}
+		delete(byID, inc.ID)
+		return true
+	}
+	if t.incidents == nil {
+		t.incidents = make(map[string]map[string]*upstreamIncident)
+	}
+	if byID == nil {
+		byID = make(map[string]*upstreamIncident)
+		t.incidents[inc.Provider] = byID
+	}
+	old := byID[inc.ID]
+	if old != nil && !old.StartedAt.IsZero() {
+		inc.StartedAt = old.StartedAt
+	}
+	byID[inc.ID] = &inc
+	return old == nil || old.Title != inc.Title || old.Status != inc.Status || old.Impact != inc.Impact
+}
+
+// replace 用拉取到的完整未解决列表替换服务商的事件集合，返回是否有变化。
+func (t *upstreamStatusTracker) replace(provider string, list []upstreamIncident) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	old := t.incidents[provider]
+	next := make(map[string]*upstreamIncident, len(list))
+	changed := len(old) != len(list)
+	for i := range list {
+		inc := list[i]
+		if prev := old[inc.ID]; prev != nil {
+			if !prev.StartedAt.IsZero() {
+				inc.StartedAt = prev.StartedAt
+			}
+			changed = changed || prev.Status != inc.Status || prev.Title != inc.Title
+		} else {
+			changed = true
+		}
+		next[inc.ID] = &inc
+	}
+	if t.incidents == nil {
+		t.incidents = make(map[string]map[string]*upstreamIncident)
+	}
+	t.incidents[provider] = next
+	return changed
+}
+
+// active 返回服务商最近更新的进行中事件，没有时返回 nil。
+func (t *upstreamStatusTracker) active(provider string) *upstreamIncident {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	var latest *upstreamIncident
+	for _, inc := range t.incidents[provider] {
+		if latest == nil || inc.UpdatedAt.After(latest.UpdatedAt) {
+			latest = inc
+		}
+	}
+	if latest == nil {
+		return nil
+	}
+	cp := *latest
+	return &cp
+}
+
+func (t *upstreamStatusTracker) list() []upstreamIncident {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	out := []upstreamIncident{}
+	for _, byID := range t.incidents {
+		for _, inc := range byID {
+			out = append(out, *inc)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].UpdatedAt.After(out[j].UpdatedAt) })
+	return out
+}
+
+// upstreamProviders 读取 upstream_status.providers，未配置或格式错误时使用默认服务商。
+func (p *Server) upstreamProviders() map[string]upstreamProviderConfig {
+	if p.settingsCache == nil {
+		return defaultUpstreamProviders
+	}
+	v, ok := p.settingsCache.Get("upstream_status.providers")
+	if !ok || v == nil {
+		return defaultUpstreamProviders
+	}
+	providers, err := parseUpstreamProviders(v)
+	if err != nil {
+		return defaultUpstreamProviders
+	}
+	return providers
+}
+
+func parseUpstreamProviders(value any) (map[string]upstreamProviderConfig, error) {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	providers := map[string]upstreamProviderConfig{}
+	if err := json.Unmarshal(raw, &providers); err != nil {
+		return nil, fmt.Errorf("must be an object of {hosts, feed_url}")
+	}
+	return providers, nil
+}
+
+// validateUpstreamProviders 校验服务商配置：名称非空、至少一个主机名、拉取地址为 http(s)。
+func validateUpstreamProviders(value any) error {
+	providers, err := parseUpstreamProviders(value)
+	if err != nil {
+		return err
+	}
+	for name, cfg := range providers {
+		if strings.TrimSpace(name) == "" || strings.Contains(name, "/") {
+			return fmt.Errorf("invalid provider name %q", name)
+		}
+		if len(cfg.Hosts) == 0 {
+			return fmt.Errorf("provider %s: hosts required", name)
+		}
+		if err := optionalURL("http", "https")(cfg.FeedURL); err != nil {
+			return fmt.Errorf("provider %s: feed_url %v", name, err)
+		}
+	}
+	return nil
+}
+
+// upstreamProviderFor 按节点地址的主机名匹配服务商（精确匹配或子域名），未匹配返回空串。
+func upstreamProviderFor(providers map[string]upstreamProviderConfig, u *url.URL) string {
+	if u == nil {
+		return ""
+	}
+	host := strings.ToLower(u.Hostname())
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, h := range providers[name].Hosts {
+			h = strings.ToLower(strings.TrimSpace(h))
+			if h != "" && (host == h || strings.HasSuffix(host, "."+h)) {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+// nodeUpstreamIncident 返回节点所属服务商当前的上游事件，没有时返回 nil。
+func (p *Server) nodeUpstreamIncident(u *url.URL) *upstreamIncident {
+	provider := upstreamProviderFor(p.upstreamProviders(), u)
+	if provider == "" {
+		return nil
+	}
+	return p.upstreamStatus.active(provider)
+}
+
+// withUpstreamIncident 节点处于上游事件期间时在告警上标注事件，通知管理器据此降级、不呼叫值班。
+func (p *Server) withUpstreamIncident(evt notify.Event, u *url.URL) notify.Event {
+	if inc := p.nodeUpstreamIncident(u); inc != nil {
+		evt.UpstreamIncident = inc.label()
+		evt.Content += fmt.Sprintf("\n**上游事件**: %s（%s）", inc.label(), inc.Status)
+	}
+	return evt
+}
+
+// onUpstreamChange 服务商事件变化后标记受影响节点已变更，并向相关账号推送 upstream_incident 事件。
+func (p *Server) onUpstreamChange(provider string) {
+	providers := p.upstreamProviders()
+	inc := p.upstreamStatus.active(provider)
+	var payloadIncident interface{}
+	if inc != nil {
+		payloadIncident = inc.view()
+	}
+	affected := map[string][]string{}
+	p.mu.RLock()
+	for id, n := range p.nodeIndex {
+		if upstreamProviderFor(providers, n.URL) != provider {
+			continue
+		}
+		if acc := p.nodeAccount[id]; acc != nil {
+			affected[acc.ID] = append(affected[acc.ID], id)
+		}
+	}
+	p.mu.RUnlock()
+	for accID, ids := range affected {
+		for _, id := range ids {
+			p.markNodeChanged(id)
+		}
+		sort.Strings(ids)
+		p.wsHub.Broadcast(accID, "upstream_incident", map[string]interface{}{
+			"provider": provider,
+			"incident": payloadIncident,
+			"node_ids": ids,
+		})
+	}
+	if inc != nil {
+		p.logger.Printf("upstream incident for %s: %s (%s), %d account(s) affected", provider, inc.Title, inc.Status, len(affected))
+	} else {
+		p.logger.Printf("upstream incidents for %s cleared", provider)
+	}
+}
+
+// statuspageWebhook Atlassian Statuspage 的 Webhook 推送（Anthropic、OpenAI 状态页均使用），
+// 事件更新携带 incident，组件状态变化携带 component。
+type statuspageWebhook struct {
+	Incident  *statuspageIncident `json:"incident"`
+	Component *struct {
+		ID        string    `json:"id"`
+		Name      string    `json:"name"`
+		Status    string    `json:"status"`
+		UpdatedAt time.Time `json:"updated_at"`
+	} `json:"component"`
+}
+
+type statuspageIncident struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Status    string    `json:"status"`
+	Impact    string    `json:"impact"`
+	Shortlink string    `json:"shortlink"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// statuspageResolved 事件已解决、已完成维护或仅为事后复盘。
+func statuspageResolved(status string) bool {
+	switch strings.ToLower(status) {
+	case "resolved", "completed", "postmortem", "operational":
+		return true
+	}
+	return false
+}
+
+func (si statuspageIncident) toIncident(provider, source string) upstreamIncident {
+	inc := upstreamIncident{
+		Provider:  provider,
+		ID:        si.ID,
+		Title:     si.Name,
+		Status:    si.Status,
+		Impact:    si.Impact,
+		URL:       si.Shortlink,
+		Source:    source,
+		StartedAt: si.CreatedAt,
+		UpdatedAt: si.UpdatedAt,
+	}
+	if inc.UpdatedAt.IsZero() {
+		inc.UpdatedAt = time.Now()
+	}
+	return inc
+}
+
+// POST /api/upstream-status/webhook/{provider}?token=xxx
+// 接收服务商状态页推送；令牌取自 upstream_status.webhook_token，未配置时关闭该入口。
+// Statuspage 的订阅地址无法附加请求头，因此也接受查询参数中的令牌。
+func (p *Server) handleUpstreamWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	expected := ""
+	if p.settingsCache != nil {
+		expected = p.settingsCache.GetString("upstream_status.webhook_token", "")
+	}
+	if expected == "" {
+		http.NotFound(w, r)
+		return
+	}
+	token := chooseNonEmpty(r.Header.Get(upstreamWebhookTokenHeader), r.URL.Query().Get("token"))
+	if subtle.ConstantTimeCompare([]byte(token), []byte(expected)) != 1 {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid token"})
+		return
+	}
+	provider := strings.TrimPrefix(r.URL.Path, upstreamWebhookPrefix)
+	if _, ok := p.upstreamProviders()[provider]; !ok {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "unknown provider"})
+		return
+	}
+	var payload statuspageWebhook
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxUpstreamWebhookBytes)).Decode(&payload); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
+		return
+	}
+	var (
+		inc      upstreamIncident
+		resolved bool
+	)
+	switch {
+	case payload.Incident != nil && payload.Incident.ID != "":
+		inc = payload.Incident.toIncident(provider, "webhook")
+		resolved = statuspageResolved(inc.Status)
+	case payload.Component != nil && payload.Component.ID != "":
+		c := payload.Component
+		inc = upstreamIncident{
+			Provider:  provider,
+			ID:        "component:" + c.ID,
+			Title:     c.Name + " " + strings.ReplaceAll(c.Status, "_", " "),
+			Status:    c.Status,
+			Source:    "webhook",
+			StartedAt: c.UpdatedAt,
+			UpdatedAt: c.UpdatedAt,
+		}
+		if inc.UpdatedAt.IsZero() {
+			inc.StartedAt, inc.UpdatedAt = time.Now(), time.Now()
+		}
+		resolved = statuspageResolved(c.Status)
+	default:
+		// 订阅确认等其他推送直接忽略。
+		writeJSON(w, http.StatusOK, map[string]interface{}{"ignored": true})
+		return
+	}
+	if p.upstreamStatus.update(inc, resolved) {
+		p.onUpstreamChange(provider)
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"provider": provider, "id": inc.ID, "resolved": resolved})
+}
+
+// GET /api/upstream-status 列出进行中的上游事件与服务商配置。
+// DELETE /api/upstream-status?provider=&id= 手动清除一条事件（仅管理员），用于服务商未推送恢复的情况。
+func (p *Server) handleUpstreamStatus(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		providers := p.upstreamProviders()
+		names := make([]string, 0, len(providers))
+		for name := range providers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		incidents := p.upstreamStatus.list()
+		views := make([]map[string]interface{}, 0, len(incidents))
+		for i := range incidents {
+			views = append(views, incidents[i].view())
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"providers": names,
+			"incidents": views,
+		})
+	case http.MethodDelete:
+		if !isAdmin(r.Context()) {
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+			return
+		}
+		q := r.URL.Query()
+		provider, id := q.Get("provider"), q.Get("id")
+		if !p.upstreamStatus.update(upstreamIncident{Provider: provider, ID: id}, true) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "incident not found"})
+			return
+		}
+		p.onUpstreamChange(provider)
+		p.audit("", auditActor(r), "upstream_incident.clear", provider+"/"+id, nil)
+		writeJSON(w, http.StatusOK, map[string]interface{}{"provider": provider, "id": id, "cleared": true})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// UpstreamStatusWatcher 按 upstream_status.poll_interval_sec 拉取各服务商的状态地址，
+// 支持 Statuspage 的 incidents JSON 与 RSS；upstream_status.enabled=false 时不访问外部网络。
+type UpstreamStatusWatcher struct {
+	server   *Server
+	client   *http.Client
+	logger   *log.Logger
+	stopCh   chan struct{}
+	wg       sync.WaitGroup
+	stopOnce sync.Once
+}
+
+// NewUpstreamStatusWatcher 创建上游状态拉取器。
+func NewUpstreamStatusWatcher(server *Server, logger *log.Logger) *UpstreamStatusWatcher {
+	if logger == nil {
+		logger = log.Default()
+	}
+	return &UpstreamStatusWatcher{
+		server: server,
+		client: &http.Client{Timeout: upstreamPollTimeout},
+		logger: logger,
+		stopCh: make(chan struct{}),
+	}
+}
+
+// Start 启动拉取循环。
+func (u *UpstreamStatusWatcher) Start() error {
+	if u == nil || u.server == nil {
+		return nil
+	}
+	u.wg.Add(1)
+	go u.loop()
+	return nil
+}
+
+// Stop 停止拉取循环。
+func (u *UpstreamStatusWatcher) Stop() {
+	if u == nil {
+		return
+	}
+	u.stopOnce.Do(func() {
+		close(u.stopCh)
+	})
+	u.wg.Wait()
+}
+
+func (u *UpstreamStatusWatcher) enabled() bool {
+	cache := u.server.settingsCache
+	return cache != nil && cache.GetBool("upstream_status.enabled", false)
+}
+
+func (u *UpstreamStatusWatcher) interval() time.Duration {
+	sec := defaultUpstreamPollInterval
+	if cache := u.server.settingsCache; cache != nil {
+		if n := cache.GetInt("upstream_status.poll_interval_sec", sec); n > 0 {
+			sec = n
+		}
+	}
+	return time.Duration(sec) * time.Second
+}
+
+func (u *UpstreamStatusWatcher) loop() {
+	defer u.wg.Done()
+	defer func() {
+		if r := recover(); r != nil {
+			u.logger.Printf("[UpstreamStatus] panic recovered: %v", r)
+		}
+	}()
+
+	timer := time.NewTimer(u.interval())
+	defer timer.Stop()
+	for {
+		select {
+		case <-u.stopCh:
+			return
+		case <-timer.C:
+			if u.enabled() {
+				u.pollAll()
+			}
+			timer.Reset(u.interval())
+		}
+	}
+}
+
+// pollAll 依次拉取配置了 feed_url 的服务商，单个失败不影响其他服务商，也不清除已有事件。
+func (u *UpstreamStatusWatcher) pollAll() {
+	for name, cfg := range u.server.upstreamProviders() {
+		if cfg.FeedURL == "" {
+			continue
+		}
+		list, err := u.fetch(name, cfg.FeedURL)
+		if err != nil {
+			u.logger.Printf("[UpstreamStatus] poll %s failed: %v", name, err)
+			continue
+		}
+		if u.server.upstreamStatus.replace(name, list) {
+			u.server.onUpstreamChange(name)
+		}
+	}
+}
+
+func (u *UpstreamStatusWatcher) fetch(provider, feedURL string) ([]upstreamIncident, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), upstreamPollTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, feedURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxUpstreamFeedBytes))
+	if err != nil {
+		return nil, err
+	}
+	return parseUpstreamFeed(provider, body, time.Now())
+}
+
+// parseUpstreamFeed 解析状态地址的内容：JSON 按 Statuspage incidents 接口处理，否则按 RSS 处理。
+func parseUpstreamFeed(provider string, body []byte, now time.Time) ([]upstreamIncident, error) {
+	trimmed := strings.TrimSpace(string(body))
+	if strings.HasPrefix(trimmed, "{") {
+		var doc struct {
+			Incidents []statuspageIncident `json:"incidents"`
+		}
+		if err := json.Unmarshal(body, &doc); err != nil {
+			return nil, err
+		}
+		list := []upstreamIncident{}
+		for _, si := range doc.Incidents {
+			if si.ID == "" || statuspageResolved(si.Status) {
+				continue
+			}
+			list = append(list, si.toIncident(provider, "feed"))
+		}
+		return list, nil
+	}
+
+	var rss struct {
+		Items []struct {
+			Title       string `xml:"title"`
+			Link        string `xml:"link"`
+			GUID        string `xml:"guid"`
+			PubDate     string `xml:"pubDate"`
+			Description string `xml:"description"`
+		} `xml:"channel>item"`
+	}
+	if err := xml.Unmarshal(body, &rss); err != nil {
+		return nil, fmt.Errorf("unsupported feed format: %w", err)
+	}
+	list := []upstreamIncident{}
+	for _, item := range rss.Items {
+		published, err := time.Parse(time.RFC1123Z, item.PubDate)
+		if err != nil {
+			published, err = time.Parse(time.RFC1123, item.PubDate)
+		}
+		if err != nil || now.Sub(published) > upstreamRSSMaxAge {
+			continue
+		}
+		status := rssLatestStatus(item.Description)
+		if statuspageResolved(status) {
+			continue
+		}
+		list = append(list, upstreamIncident{
+			Provider:  provider,
+			ID:        chooseNonEmpty(item.GUID, item.Link, item.Title),
+			Title:     strings.TrimSpace(item.Title),
+			Status:    chooseNonEmpty(strings.ToLower(status), "investigating"),
+			URL:       item.Link,
+			Source:    "feed",
+			StartedAt: published,
+			UpdatedAt: published,
+		})
+	}
+	return list, nil
+}
+
+// rssLatestStatus 取 Statuspage RSS 条目描述中第一段（最新一次）进展的状态，如 <strong>Resolved</strong>。
+func rssLatestStatus(desc string) string {
+	start := strings.Index(desc, "<strong>")
+	if start < 0 {
+		return ""
+	}
+	rest := desc[start+len("<strong>"):]
+	end := strings.Index(rest, "</strong>")
+	if end < 0 {
+		return ""
+	}
+	return strings.TrimSpace(rest[:end])
+}
@@ -0,0 +1,185 @@
+package proxy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"qcc_plus/internal/store"
+)
+
+// 超出基数上限的维度值统一归入该桶。
+const rollupOtherValue = "__other__"
+
+// 各维度的默认基数上限（每账号），可通过 metrics.rollup.max_* 配置覆盖。
+var defaultRollupCardinality = map[string]int{
+	"model":  50,
+	"label":  100,
+	"key_id": 100,
+}
+
+// dimensionLimiter 记录每个账号已出现的维度取值，超过上限的新值归入 __other__，防止汇总表膨胀。
+type dimensionLimiter struct {
+	mu   sync.Mutex
+	seen map[string]map[string]struct{} // accountID|dimension -> values
+}
+
+func newDimensionLimiter() *dimensionLimiter {
+	return &dimensionLimiter{seen: make(map[string]map[string]struct{})}
+}
+
+func (l *dimensionLimiter) admit(accountID, dim, value string, limit int) string {
+	if value == "" || limit <= 0 {
+		return value
+	}
+	key := accountID + "|" + dim
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	set := l.seen[key]
+	if set == nil {
+		set = make(map[string]struct{})
+		l.seen[key] = set
+	}
+	if _, ok := set[value]; ok {
+		return value
+	}
+	if len(set) >= limit {
+		return rollupOtherValue
+	}
+	set[value] = struct{}{}
+	return value
+}
+
+func (p *Server) rollupCardinality(dim string) int {
+	limit := defaultRollupCardinality[dim]
+	if p.settingsCache != nil {
+		limit = p.settingsCache.GetInt("metrics.rollup.max_"+strings.TrimSuffix(dim, "_id")+"s", limit)
+	}
+	return limit
+}
+
+// limitDims 对请求维度应用基数上限。
+func (p *Server) limitDims(accountID string, dims requestDims) requestDims {
+	if p.dimLimiter == nil {
+		return dims
+	}
+	dims.model = p.dimLimiter.admit(accountID, "model", dims.model, p.rollupCardinality("model"))
+	dims.label = p.dimLimiter.admit(accountID, "label", dims.label, p.rollupCardinality("label"))
+	dims.keyID = p.dimLimiter.admit(accountID, "key_id", dims.keyID, p.rollupCardinality("key_id"))
+	return dims
+}
+
+// extractModel 读取 JSON 请求体中的 model 字段。
+func extractModel(r *http.Request) string {
+	if r.Method != http.MethodPost ||
+		!strings.Contains(strings.ToLower(r.Header.Get("Content-Type")), "application/json") {
+		return ""
+	}
+	body, err := peekBody(r)
+	if err != nil || len(body) == 0 {
+		return ""
+	}
+	var payload struct {
+		Model string `json:"model"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return ""
+	}
+	model := strings.TrimSpace(payload.Model)
+	if len(model) > 128 {
+		model = model[:128]
+	}
+	return model
+}
+
+// keyFingerprint 返回代理密钥的短指纹，用于按密钥归因而不保存明文。
+func keyFingerprint(key string) string {
+	if key == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:6])
+}
+
+// GET /api/usage/rollups?group_by=model,label&granularity=hour|day&from=&to=&node_id=&model=&label=&key_id=&account_id=
+func (p *Server) handleUsageRollups(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if p.store == nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "store not enabled"})
+		return
+	}
+	caller := accountFromCtx(r)
+	if caller == nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		return
+	}
+	q := r.URL.Query()
+	accountID := chooseNonEmpty(q.Get("account_id"), caller.ID)
+	if !canManageAccount(r.Context(), accountID) {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+		return
+	}
+	from, to, err := parseTimeRange(q.Get("from"), q.Get("to"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	query := store.UsageRollupQuery{
+		AccountID:   accountID,
+		Granularity: store.MetricsGranularity(chooseNonEmpty(q.Get("granularity"), string(store.MetricsGranularityHourly))),
+		From:        from,
+		To:          to,
+		Filters:     make(map[string]string),
+	}
+	for _, g := range strings.Split(q.Get("group_by"), ",") {
+		if g = strings.TrimSpace(g); g != "" {
+			query.GroupBy = append(query.GroupBy, g)
+		}
+	}
+	for _, d := range store.UsageRollupDimensions {
+		if v := q.Get(d); v != "" {
+			query.Filters[d] = v
+		}
+	}
+	if v := q.Get("limit"); v != "" {
+		query.Limit, _ = strconv.Atoi(v)
+	}
+
+	rows, err := p.store.QueryUsageRollups(r.Context(), query)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	f := p.displayFormat(w, r, caller)
+	items := make([]map[string]interface{}, 0, len(rows))
+	for _, row := range rows {
+		item := map[string]interface{}{
+			"requests_total":       row.RequestsTotal,
+			"requests_failed":      row.RequestsFailed,
+			"input_tokens":         row.InputTokensTotal,
+			"output_tokens":        row.OutputTokensTotal,
+			"bytes_total":          row.BytesTotal,
+			"response_time_sum_ms": row.ResponseTimeSumMs,
+		}
+		for k, v := range row.Dims {
+			item[k] = v
+		}
+		if !row.BucketStart.IsZero() {
+			item["bucket_start"] = f.time(row.BucketStart)
+		}
+		items = append(items, item)
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"account_id":  accountID,
+		"granularity": query.Granularity,
+		"group_by":    query.GroupBy,
+		"rows":        items,
+	})
+}
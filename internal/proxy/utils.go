@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"strconv"
+	"time"
 
 	"qcc_plus/internal/store"
 )
@@ -14,6 +15,15 @@ func writeJSON(w http.ResponseWriter, status int, v interface{}) {
 	_ = json.NewEncoder(w).Encode(v)
 }
 
+// writeProxyError 以与上游一致的 {"error": {"type", "message"}} 结构返回代理侧错误。
+func writeProxyError(w http.ResponseWriter, status int, errType, msg string, extra map[string]any) {
+	body := map[string]any{"type": errType, "message": msg}
+	for k, v := range extra {
+		body[k] = v
+	}
+	writeJSON(w, status, map[string]any{"error": body})
+}
+
 func extractUsageFromHeader(h http.Header) *usage {
 	if h == nil {
 		return nil
@@ -65,5 +75,9 @@ func toRecord(n *Node) store.NodeRecord {
 		LastPingMs:        n.Metrics.LastPingMS,
 		LastPingErr:       n.Metrics.LastPingErr,
 		LastHealthCheckAt: n.Metrics.LastHealthCheckAt,
+		State:             nodeState(n),
+		StateChangedAt:    n.StateChangedAt,
+		Headers:           n.Headers,
+		HealthIntervalSec: int(n.HealthInterval / time.Second),
 	}
 }
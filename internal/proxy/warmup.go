@@ -0,0 +1,68 @@
+package proxy
+
+import (
+	"math/rand"
+	"time"
+)
+
+const defaultWarmupInitialPct = 10
+
+// warmupRand 用于按比例分流，测试中可替换。
+var warmupRand = rand.Float64
+
+// warmupSettings 返回预热窗口与初始流量比例；窗口为 0 表示关闭预热。
+func (p *Server) warmupSettings() (time.Duration, float64) {
+	if p.settingsCache == nil {
+		return 0, 1
+	}
+	sec := p.settingsCache.GetInt("routing.warmup.window_sec", 0)
+	if sec <= 0 {
+		return 0, 1
+	}
+	pct := p.settingsCache.GetInt("routing.warmup.initial_pct", defaultWarmupInitialPct)
+	if pct < 1 {
+		pct = 1
+	}
+	if pct > 100 {
+		pct = 100
+	}
+	return time.Duration(sec) * time.Second, float64(pct) / 100
+}
+
+// warmupShare 计算预热中节点应承接的流量比例，从 initial 线性爬升到 1。
+func warmupShare(since, now time.Time, window time.Duration, initial float64) float64 {
+	if since.IsZero() || window <= 0 {
+		return 1
+	}
+	elapsed := now.Sub(since)
+	if elapsed >= window {
+		return 1
+	}
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	return initial + (1-initial)*float64(elapsed)/float64(window)
+}
+
+// nodeWarmupShare 返回节点当前的预热流量比例（调用方需持有 p.mu 读锁）。
+func (p *Server) nodeWarmupShare(n *Node, now time.Time) float64 {
+	window, initial := p.warmupSettings()
+	return warmupShare(n.WarmupSince, now, window, initial)
+}
+
+// applyWarmup 若选中节点刚从 down 恢复且仍在预热期，按比例将部分请求分流到其他可路由节点。
+func (p *Server) applyWarmup(acc *Account, n *Node) *Node {
+	if acc == nil || n == nil {
+		return n
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	share := p.nodeWarmupShare(n, time.Now())
+	if share >= 1 || warmupRand() < share {
+		return n
+	}
+	if alt := bestRoutableNodeExcept(acc.Nodes, n.ID); alt != nil {
+		return alt
+	}
+	return n
+}
@@ -0,0 +1,86 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"qcc_plus/internal/notify"
+	"qcc_plus/internal/timeutil"
+)
+
+const maxWebhookRotationGrace = 30 * 24 * time.Hour
+
+// webhookSecretView 签名密钥状态；secret 仅在轮换或显式 reveal 时返回。
+func webhookSecretView(keys notify.SigningKeys, now time.Time, reveal bool) map[string]interface{} {
+	v := map[string]interface{}{
+		"algorithm":        "HMAC-SHA256",
+		"signature_header": notify.HeaderWebhookSignature,
+		"timestamp_header": notify.HeaderWebhookTimestamp,
+		"id_header":        notify.HeaderWebhookID,
+		"replay_window":    int(notify.DefaultReplayWindow / time.Second),
+		"rotated_at":       timeutil.FormatBeijingTime(keys.RotatedAt),
+		"dual_signing":     keys.GraceActive(now),
+	}
+	if keys.GraceActive(now) {
+		v["previous_expires_at"] = timeutil.FormatBeijingTime(keys.PreviousUntil)
+	}
+	if reveal {
+		v["secret"] = keys.Current
+	}
+	return v
+}
+
+// GET  /api/accounts/:id/webhook-secret[?reveal=true] 查看签名密钥状态，reveal 时返回当前密钥。
+// POST /api/accounts/:id/webhook-secret 轮换密钥，请求体 {"grace_sec": 86400}；宽限期内旧密钥继续参与签名，0 表示立即停用。
+func (p *Server) handleAccountWebhookSecret(w http.ResponseWriter, r *http.Request, acc *Account) {
+	if !canAdministerAccount(r.Context(), acc.ID) {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+		return
+	}
+	if p.store == nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "store not enabled"})
+		return
+	}
+	adapter := notify.NewStoreAdapter(p.store)
+	switch r.Method {
+	case http.MethodGet:
+		keys, err := adapter.WebhookSigningKeys(r.Context(), acc.ID)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		reveal := r.URL.Query().Get("reveal") == "true"
+		if reveal {
+			p.audit(acc.ID, auditActor(r), "webhook_secret.reveal", acc.ID, nil)
+		}
+		writeJSON(w, http.StatusOK, webhookSecretView(keys, time.Now(), reveal))
+	case http.MethodPost:
+		req := struct {
+			GraceSec *int `json:"grace_sec"`
+		}{}
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
+				return
+			}
+		}
+		grace := notify.DefaultRotationGrace
+		if req.GraceSec != nil {
+			grace = time.Duration(*req.GraceSec) * time.Second
+		}
+		if grace < 0 || grace > maxWebhookRotationGrace {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "grace_sec must be between 0 and 2592000"})
+			return
+		}
+		keys, err := adapter.RotateWebhookSigningKeys(r.Context(), acc.ID, grace, auditActor(r))
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		p.audit(acc.ID, auditActor(r), "webhook_secret.rotate", acc.ID, map[string]interface{}{"grace_sec": int(grace / time.Second)})
+		writeJSON(w, http.StatusOK, webhookSecretView(keys, time.Now(), true))
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
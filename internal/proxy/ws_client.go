@@ -14,7 +14,7 @@ const (
 	maxMessageSize = 512
 )
 
-// readPump 负责读取客户端消息，仅用于保持连接，不处理业务消息。
+// readPump 负责读取客户端消息：保持连接并处理订阅指令。
 func (c *WSClient) readPump() {
 	defer func() {
 		c.hub.unregister <- c
@@ -29,13 +29,14 @@ func (c *WSClient) readPump() {
 	})
 
 	for {
-		if _, _, err := c.conn.ReadMessage(); err != nil {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				log.Printf("websocket error: %v", err)
 			}
 			break
 		}
-		// 忽略客户端消息（目前仅推送，不处理输入）
+		c.handleCommand(data)
 	}
 }
 
@@ -0,0 +1,177 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"qcc_plus/internal/store"
+	"qcc_plus/internal/timeutil"
+)
+
+const wsCommandTimeout = 30 * time.Second
+
+// wsTopics 可按连接退订的账号广播类型，默认全部推送；request_log 需显式订阅。
+var wsTopics = map[string]bool{
+	"node_status":   true,
+	"node_metrics":  true,
+	"node_state":    true,
+	"health_check":  true,
+	"throughput":    true,
+	"alert":         true,
+	"quota_warning": true,
+	"job_progress":  true,
+	// 仅推送给管理员
+	"update_available": true,
+}
+
+// wsCommand 客户端发送的指令。
+type wsCommand struct {
+	Action  string `json:"action"` // subscribe/unsubscribe/refresh/ack/heartbeat
+	Topic   string `json:"topic"`
+	Filter  string `json:"filter"`
+	Scope   string `json:"scope"`    // account（默认）/all
+	NodeID  string `json:"node_id"`  // refresh
+	AlertID string `json:"alert_id"` // ack
+	Seq     uint64 `json:"seq"`      // heartbeat：客户端已收到的最大序号
+}
+
+// handleCommand 处理客户端指令，结果以对应类型或 error 消息回复。
+func (c *WSClient) handleCommand(data []byte) {
+	var cmd wsCommand
+	if err := json.Unmarshal(data, &cmd); err != nil {
+		c.reply("error", map[string]string{"error": "invalid command"})
+		return
+	}
+	switch cmd.Action {
+	case "subscribe", "unsubscribe":
+		c.handleTopicCommand(cmd)
+	case "refresh":
+		c.handleRefresh(cmd)
+	case "ack":
+		c.handleAck(cmd)
+	case "heartbeat":
+		c.handleHeartbeat(cmd)
+	default:
+		c.reply("error", map[string]string{"error": "unknown action"})
+	}
+}
+
+// handleTopicCommand 订阅或退订广播类型；request_log 交由请求日志订阅处理。
+func (c *WSClient) handleTopicCommand(cmd wsCommand) {
+	if cmd.Topic == wsTopicRequestLog {
+		c.handleTailCommand(cmd)
+		return
+	}
+	if !wsTopics[cmd.Topic] {
+		c.reply("error", map[string]string{"error": "unknown topic"})
+		return
+	}
+	subscribe := cmd.Action == "subscribe"
+	c.hub.setMuted(c, cmd.Topic, !subscribe)
+	if subscribe {
+		c.reply("subscribed", map[string]string{"topic": cmd.Topic})
+		return
+	}
+	c.reply("unsubscribed", map[string]string{"topic": cmd.Topic})
+}
+
+// handleRefresh 立即检查节点健康并回复 node_refresh。分享连接只能复用缓存或进行中的探活，
+// 不会强制发起新的检查。探活在独立协程中执行，不阻塞读取。
+func (c *WSClient) handleRefresh(cmd wsCommand) {
+	p := c.server
+	if p == nil {
+		c.reply("error", map[string]string{"error": "refresh not available"})
+		return
+	}
+	if cmd.NodeID == "" {
+		c.reply("error", map[string]string{"error": "node_id required"})
+		return
+	}
+	p.mu.RLock()
+	owner := p.nodeAccount[cmd.NodeID]
+	p.mu.RUnlock()
+	if owner == nil || owner.ID != c.accountID {
+		c.reply("error", map[string]string{"error": "node not found"})
+		return
+	}
+	go func() {
+		result, source, err := p.probeNodeHealth(owner, cmd.NodeID, !c.isShare)
+		if err != nil || result == nil {
+			msg := "node not found"
+			if err != nil {
+				msg = err.Error()
+			}
+			c.reply("error", map[string]string{"error": msg})
+			return
+		}
+		c.reply("node_refresh", map[string]interface{}{
+			"node_id":      cmd.NodeID,
+			"node":         p.nodeView(owner, cmd.NodeID),
+			"health_check": result.view(),
+			"source":       source,
+		})
+	}()
+}
+
+// handleAck 确认账号下的告警，分享连接不可操作。
+func (c *WSClient) handleAck(cmd wsCommand) {
+	p := c.server
+	if c.isShare {
+		c.reply("error", map[string]string{"error": "ack not available via share link"})
+		return
+	}
+	if p == nil || p.store == nil {
+		c.reply("error", map[string]string{"error": "alerts not available"})
+		return
+	}
+	if cmd.AlertID == "" {
+		c.reply("error", map[string]string{"error": "alert_id required"})
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), wsCommandTimeout)
+	defer cancel()
+	rec, err := p.store.GetAlert(ctx, cmd.AlertID)
+	if err != nil || rec.AccountID != c.accountID {
+		if err == nil || errors.Is(err, store.ErrNotFound) {
+			c.reply("error", map[string]string{"error": "alert not found"})
+			return
+		}
+		c.reply("error", map[string]string{"error": err.Error()})
+		return
+	}
+	rec, err = p.acknowledgeAlert(ctx, c.accountID, cmd.AlertID, c.accountID)
+	if err != nil {
+		c.reply("error", map[string]string{"error": err.Error()})
+		return
+	}
+	c.reply("alert_acked", alertView(*rec))
+}
+
+// handleHeartbeat 回复账号当前广播序号，客户端据此判断是否漏收消息并决定是否刷新；
+// 序号包含已退订类型的消息。
+func (c *WSClient) handleHeartbeat(cmd wsCommand) {
+	if c.conn != nil {
+		_ = c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	}
+	seq := c.hub.dispatcher(c.accountID).seq.Load()
+	var missed uint64
+	if seq > cmd.Seq {
+		missed = seq - cmd.Seq
+	}
+	c.reply("heartbeat", map[string]interface{}{
+		"seq":         seq,
+		"last_seen":   cmd.Seq,
+		"missed":      missed,
+		"server_time": timeutil.FormatBeijingTime(time.Now()),
+	})
+}
+
+func (c *WSClient) reply(msgType string, payload interface{}) {
+	data, err := json.Marshal(&WSMessage{AccountID: c.accountID, Type: msgType, Payload: payload})
+	if err != nil {
+		return
+	}
+	c.hub.sendTo(c, data)
+}
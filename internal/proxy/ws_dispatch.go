@@ -0,0 +1,115 @@
+package proxy
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// wsQueueSize 单账号待分发消息队列上限，超出时丢弃最早的消息。
+const wsQueueSize = 256
+
+// wsDispatcher 单账号的广播队列。队列非空时由一个分发协程按序投递，
+// 清空后协程退出；不同账号互不阻塞。
+type wsDispatcher struct {
+	mu      sync.Mutex
+	queue   []*WSMessage
+	running bool
+	seq     atomic.Uint64 // 已分发的账号广播序号
+}
+
+// dispatcher 返回账号对应的分发队列，不存在时创建。
+func (h *WSHub) dispatcher(accountID string) *wsDispatcher {
+	h.dispatchMu.Lock()
+	defer h.dispatchMu.Unlock()
+	d := h.dispatchers[accountID]
+	if d == nil {
+		d = &wsDispatcher{}
+		h.dispatchers[accountID] = d
+	}
+	return d
+}
+
+// enqueue 将消息加入账号队列：与队尾同一节点的 node_metrics 合并为最新一条，
+// 队列已满时丢弃最早的消息；队列此前为空时启动分发协程。
+func (h *WSHub) enqueue(message *WSMessage) {
+	d := h.dispatcher(message.AccountID)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if n := len(d.queue); n > 0 && coalescible(d.queue[n-1], message) {
+		d.queue[n-1] = message
+		h.counters.coalesced.Add(1)
+		return
+	}
+	if len(d.queue) >= wsQueueSize {
+		copy(d.queue, d.queue[1:])
+		d.queue = d.queue[:len(d.queue)-1]
+		h.counters.queueDropped.Add(1)
+	}
+	d.queue = append(d.queue, message)
+	if !d.running {
+		d.running = true
+		go h.drain(d)
+	}
+}
+
+// drain 逐批取出队列中的消息投递，队列为空时退出。
+func (h *WSHub) drain(d *wsDispatcher) {
+	for {
+		d.mu.Lock()
+		batch := d.queue
+		d.queue = nil
+		if len(batch) == 0 {
+			d.running = false
+			d.mu.Unlock()
+			return
+		}
+		d.mu.Unlock()
+		for _, message := range batch {
+			h.dispatch(d, message)
+		}
+	}
+}
+
+func (h *WSHub) dispatch(d *wsDispatcher, message *WSMessage) {
+	if message.Type == wsTopicRequestLog {
+		h.broadcastRequestLog(message)
+		return
+	}
+	message.Seq = d.seq.Add(1)
+	h.broadcastToAccount(message)
+}
+
+// queueDepth 返回各账号队列中待分发的消息数，仅包含非空队列。
+func (h *WSHub) queueDepth() map[string]int {
+	h.dispatchMu.Lock()
+	defer h.dispatchMu.Unlock()
+	out := make(map[string]int)
+	for id, d := range h.dispatchers {
+		d.mu.Lock()
+		if n := len(d.queue); n > 0 {
+			out[id] = n
+		}
+		d.mu.Unlock()
+	}
+	return out
+}
+
+// coalescible 判断 next 能否替换队尾消息 last：二者均为同一节点的 node_metrics。
+func coalescible(last, next *WSMessage) bool {
+	if last.Type != "node_metrics" || next.Type != "node_metrics" {
+		return false
+	}
+	id := metricsNodeID(next)
+	return id != "" && metricsNodeID(last) == id
+}
+
+func metricsNodeID(message *WSMessage) string {
+	switch payload := message.Payload.(type) {
+	case NodeMetrics:
+		return payload.NodeID
+	case map[string]interface{}:
+		id, _ := payload["node_id"].(string)
+		return id
+	}
+	return ""
+}
@@ -3,6 +3,7 @@ package proxy
 import (
 	"encoding/json"
 	"sync"
+	"sync/atomic"
 
 	"github.com/gorilla/websocket"
 )
@@ -14,18 +15,31 @@ type WSHub struct {
 
 	register   chan *WSClient
 	unregister chan *WSClient
-	broadcast  chan *WSMessage
 
-	mu sync.RWMutex
+	mu        sync.RWMutex
+	tailCount atomic.Int32 // 请求日志订阅者数量
+
+	limitMu      sync.Mutex
+	accountConns map[string]int // 已占用名额的连接数（含升级中的连接），受 limitMu 保护
+	shareConns   map[string]int // 按分享 token 统计
+	counters     wsCounters
+
+	dispatchMu  sync.Mutex
+	dispatchers map[string]*wsDispatcher // 按账号分片的广播队列
 }
 
 // WSClient 表示一个 WebSocket 客户端连接。
 type WSClient struct {
-	hub       *WSHub
-	conn      *websocket.Conn
-	accountID string
-	send      chan []byte
-	isShare   bool // 是否通过分享链接连接
+	hub        *WSHub
+	conn       *websocket.Conn
+	accountID  string
+	send       chan []byte
+	isShare    bool   // 是否通过分享链接连接
+	shareToken string // 分享连接使用的 token，用于连接数限制
+	isAdmin    bool
+	server     *Server           // 处理 refresh/ack 指令
+	tail       *tailSubscription // 请求日志订阅，受 hub.mu 保护
+	muted      map[string]bool   // 已退订的广播类型，受 hub.mu 保护
 }
 
 // WSMessage 为 hub 内部广播结构。
@@ -33,6 +47,7 @@ type WSMessage struct {
 	AccountID string      `json:"account_id"`
 	Type      string      `json:"type"` // "node_status", "node_metrics" 等
 	Payload   interface{} `json:"payload"`
+	Seq       uint64      `json:"seq,omitempty"` // 账号内广播序号，请求日志与指令回复不带序号
 }
 
 // NewWSHub 创建 hub 实例。
@@ -41,11 +56,14 @@ func NewWSHub() *WSHub {
 		clients:    make(map[string]map[*WSClient]bool),
 		register:   make(chan *WSClient, 10),
 		unregister: make(chan *WSClient, 10),
-		broadcast:  make(chan *WSMessage, 256),
+
+		accountConns: make(map[string]int),
+		shareConns:   make(map[string]int),
+		dispatchers:  make(map[string]*wsDispatcher),
 	}
 }
 
-// Run 主循环，串行化注册、注销和广播事件。
+// Run 主循环，串行化注册与注销；广播由各账号的分发队列独立投递。
 func (h *WSHub) Run() {
 	for {
 		select {
@@ -53,8 +71,6 @@ func (h *WSHub) Run() {
 			h.addClient(client)
 		case client := <-h.unregister:
 			h.removeClient(client)
-		case message := <-h.broadcast:
-			h.broadcastToAccount(message)
 		}
 	}
 }
@@ -69,6 +85,7 @@ func (h *WSHub) addClient(client *WSClient) {
 		h.clients[client.accountID] = make(map[*WSClient]bool)
 	}
 	h.clients[client.accountID][client] = true
+	h.counters.connects.Add(1)
 }
 
 func (h *WSHub) removeClient(client *WSClient) {
@@ -79,8 +96,14 @@ func (h *WSHub) removeClient(client *WSClient) {
 	defer h.mu.Unlock()
 	if clients, ok := h.clients[client.accountID]; ok {
 		if _, ok := clients[client]; ok {
+			if client.tail != nil {
+				client.tail = nil
+				h.tailCount.Add(-1)
+			}
 			delete(clients, client)
 			close(client.send)
+			h.counters.disconnects.Add(1)
+			h.release(client.accountID, client.shareToken)
 			if len(clients) == 0 {
 				delete(h.clients, client.accountID)
 			}
@@ -93,10 +116,10 @@ func (h *WSHub) broadcastToAccount(message *WSMessage) {
 		return
 	}
 	h.mu.RLock()
-	clients := h.clients[message.AccountID]
+	n := len(h.clients[message.AccountID])
 	h.mu.RUnlock()
 
-	if len(clients) == 0 {
+	if n == 0 {
 		return
 	}
 
@@ -105,24 +128,143 @@ func (h *WSHub) broadcastToAccount(message *WSMessage) {
 		return
 	}
 
-	for client := range clients {
+	// 持有读锁发送，保证 send 通道不会在发送期间被关闭
+	var evicted []*WSClient
+	h.mu.RLock()
+	for client := range h.clients[message.AccountID] {
+		if client.muted[message.Type] {
+			continue
+		}
 		select {
 		case client.send <- data:
 		default:
 			// 发送缓冲区已满，主动注销释放资源
-			h.unregister <- client
+			h.counters.dropped.Add(1)
+			h.counters.evicted.Add(1)
+			evicted = append(evicted, client)
 		}
 	}
+	h.mu.RUnlock()
+	for _, client := range evicted {
+		h.unregister <- client
+	}
 }
 
-// Broadcast 发送消息到指定账号的所有连接。
+// Broadcast 发送消息到指定账号的所有连接，消息进入账号队列后立即返回。
 func (h *WSHub) Broadcast(accountID, msgType string, payload interface{}) {
 	if h == nil {
 		return
 	}
-	h.broadcast <- &WSMessage{
+	h.enqueue(&WSMessage{
 		AccountID: accountID,
 		Type:      msgType,
 		Payload:   payload,
+	})
+}
+
+// BroadcastAdmins 向所有账号中管理员的非分享连接推送消息，缓冲区满时丢弃。
+func (h *WSHub) BroadcastAdmins(msgType string, payload interface{}) {
+	if h == nil {
+		return
+	}
+	data, err := json.Marshal(&WSMessage{Type: msgType, Payload: payload})
+	if err != nil {
+		return
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for _, clients := range h.clients {
+		for client := range clients {
+			if !client.isAdmin || client.isShare || client.muted[msgType] {
+				continue
+			}
+			select {
+			case client.send <- data:
+			default:
+				h.counters.dropped.Add(1)
+			}
+		}
+	}
+}
+
+// setTail 设置或清除客户端的请求日志订阅。
+func (h *WSHub) setTail(client *WSClient, sub *tailSubscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.clients[client.accountID][client]; !ok {
+		return
+	}
+	switch {
+	case client.tail == nil && sub != nil:
+		h.tailCount.Add(1)
+	case client.tail != nil && sub == nil:
+		h.tailCount.Add(-1)
+	}
+	client.tail = sub
+}
+
+// setMuted 退订或恢复客户端的某类广播。
+func (h *WSHub) setMuted(client *WSClient, topic string, muted bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.clients[client.accountID][client]; !ok {
+		return
+	}
+	if !muted {
+		delete(client.muted, topic)
+		return
+	}
+	if client.muted == nil {
+		client.muted = make(map[string]bool)
+	}
+	client.muted[topic] = true
+}
+
+func (h *WSHub) hasTailSubscribers() bool {
+	return h != nil && h.tailCount.Load() > 0
+}
+
+// sendTo 向仍在线的客户端发送消息；持有读锁保证 send 通道未被关闭，缓冲区满时丢弃。
+func (h *WSHub) sendTo(client *WSClient, data []byte) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if _, ok := h.clients[client.accountID][client]; !ok {
+		return
+	}
+	select {
+	case client.send <- data:
+	default:
+		h.counters.dropped.Add(1)
+	}
+}
+
+// broadcastRequestLog 按订阅范围与过滤条件推送请求摘要。
+// 实时日志允许丢失，缓冲区满时直接丢弃而不断开连接。
+func (h *WSHub) broadcastRequestLog(message *WSMessage) {
+	ev, ok := message.Payload.(requestLogEvent)
+	if !ok {
+		return
+	}
+	var data []byte
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for accountID, clients := range h.clients {
+		for client := range clients {
+			sub := client.tail
+			if sub == nil || (accountID != message.AccountID && !sub.allAccounts) || !sub.filter.match(ev) {
+				continue
+			}
+			if data == nil {
+				var err error
+				if data, err = json.Marshal(message); err != nil {
+					return
+				}
+			}
+			select {
+			case client.send <- data:
+			default:
+				h.counters.dropped.Add(1)
+			}
+		}
 	}
 }
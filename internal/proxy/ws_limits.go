@@ -0,0 +1,111 @@
+package proxy
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+const (
+	defaultWSMaxConnsPerAccount = 50
+	defaultWSMaxConnsPerShare   = 20
+)
+
+var (
+	errWSAccountLimit = errors.New("too many websocket connections for account")
+	errWSShareLimit   = errors.New("too many websocket connections for share token")
+)
+
+// wsLimits 单账号与单分享 token 的最大连接数，0 表示不限制。
+type wsLimits struct {
+	PerAccount int
+	PerShare   int
+}
+
+// wsCounters hub 连接与消息计数。
+type wsCounters struct {
+	connects     atomic.Int64
+	disconnects  atomic.Int64
+	rejected     atomic.Int64
+	dropped      atomic.Int64 // 发送缓冲区满被丢弃的消息
+	evicted      atomic.Int64 // 因缓冲区满被断开的慢客户端
+	coalesced    atomic.Int64 // 被同节点后续 node_metrics 合并的消息
+	queueDropped atomic.Int64 // 账号广播队列满被丢弃的消息
+}
+
+// wsLimits 从 SettingsCache 读取连接数上限，负数按默认值处理。
+func (p *Server) wsLimits() wsLimits {
+	limits := wsLimits{PerAccount: defaultWSMaxConnsPerAccount, PerShare: defaultWSMaxConnsPerShare}
+	if p.settingsCache == nil {
+		return limits
+	}
+	if n := p.settingsCache.GetInt("ws.max_conns_per_account", limits.PerAccount); n >= 0 {
+		limits.PerAccount = n
+	}
+	if n := p.settingsCache.GetInt("ws.max_conns_per_share", limits.PerShare); n >= 0 {
+		limits.PerShare = n
+	}
+	return limits
+}
+
+// reserve 在升级连接前占用连接名额，超出上限时返回错误；成功后须在连接注销或升级失败时调用 release。
+func (h *WSHub) reserve(accountID, shareToken string, limits wsLimits) error {
+	h.limitMu.Lock()
+	defer h.limitMu.Unlock()
+	if limits.PerAccount > 0 && h.accountConns[accountID] >= limits.PerAccount {
+		h.counters.rejected.Add(1)
+		return errWSAccountLimit
+	}
+	if shareToken != "" && limits.PerShare > 0 && h.shareConns[shareToken] >= limits.PerShare {
+		h.counters.rejected.Add(1)
+		return errWSShareLimit
+	}
+	h.accountConns[accountID]++
+	if shareToken != "" {
+		h.shareConns[shareToken]++
+	}
+	return nil
+}
+
+// release 归还 reserve 占用的连接名额。
+func (h *WSHub) release(accountID, shareToken string) {
+	h.limitMu.Lock()
+	defer h.limitMu.Unlock()
+	if h.accountConns[accountID]--; h.accountConns[accountID] <= 0 {
+		delete(h.accountConns, accountID)
+	}
+	if shareToken != "" {
+		if h.shareConns[shareToken]--; h.shareConns[shareToken] <= 0 {
+			delete(h.shareConns, shareToken)
+		}
+	}
+}
+
+// statsView 返回连接数与计数器，分享 token 只统计数量不暴露取值。
+func (h *WSHub) statsView(limits wsLimits) map[string]interface{} {
+	h.limitMu.Lock()
+	accounts := make(map[string]int, len(h.accountConns))
+	total := 0
+	for id, n := range h.accountConns {
+		accounts[id] = n
+		total += n
+	}
+	shares := len(h.shareConns)
+	h.limitMu.Unlock()
+	return map[string]interface{}{
+		"connections":           total,
+		"accounts":              accounts,
+		"share_tokens":          shares,
+		"max_conns_per_account": limits.PerAccount,
+		"max_conns_per_share":   limits.PerShare,
+		"connects":              h.counters.connects.Load(),
+		"disconnects":           h.counters.disconnects.Load(),
+		"rejected":              h.counters.rejected.Load(),
+		"dropped_messages":      h.counters.dropped.Load(),
+		"evicted_clients":       h.counters.evicted.Load(),
+		"tail_subscribers":      h.tailCount.Load(),
+		"coalesced_messages":    h.counters.coalesced.Load(),
+		"queue_dropped":         h.counters.queueDropped.Load(),
+		"queue_capacity":        wsQueueSize,
+		"queued":                h.queueDepth(),
+	}
+}
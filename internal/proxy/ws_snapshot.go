@@ -0,0 +1,68 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"qcc_plus/internal/store"
+	"qcc_plus/internal/timeutil"
+)
+
+const (
+	wsSnapshotTimeout   = 5 * time.Second
+	wsSnapshotMaxAlerts = 100
+)
+
+// initialStateMessage 构建连接建立时推送的 initial_state 快照：节点状态、各节点最近一个指标点与未确认告警。
+// seq 为构建快照时的账号广播序号，客户端可据此判断快照之后是否漏收消息。
+func (p *Server) initialStateMessage(client *WSClient) []byte {
+	acc := p.getAccountByID(client.accountID)
+	if acc == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), wsSnapshotTimeout)
+	defer cancel()
+
+	seq := client.hub.dispatcher(client.accountID).seq.Load()
+	dashboard := p.buildMonitorDashboardResponse(ctx, acc)
+	if dashboard == nil {
+		return nil
+	}
+	// 仅保留趋势中最近一个点，完整趋势仍通过看板接口获取
+	for i := range dashboard.Nodes {
+		if trend := dashboard.Nodes[i].Trend24h; len(trend) > 1 {
+			dashboard.Nodes[i].Trend24h = trend[len(trend)-1:]
+		}
+	}
+
+	alerts := make([]map[string]interface{}, 0)
+	// 分享链接只展示节点状态，不下发告警
+	if p.store != nil && !client.isShare {
+		list, err := p.store.ListAlerts(ctx, store.AlertQuery{AccountID: acc.ID, Status: store.AlertOpen, Limit: wsSnapshotMaxAlerts})
+		if err != nil && p.logger != nil {
+			p.logger.Printf("initial state alerts failed account=%s: %v", acc.ID, err)
+		}
+		for _, rec := range list {
+			alerts = append(alerts, alertView(rec))
+		}
+	}
+
+	data, err := json.Marshal(&WSMessage{
+		AccountID: acc.ID,
+		Type:      "initial_state",
+		Payload: map[string]interface{}{
+			"account_id":   dashboard.AccountID,
+			"account_name": dashboard.AccountName,
+			"nodes":        dashboard.Nodes,
+			"alerts":       alerts,
+			"seq":          seq,
+			"maintenance":  p.maintenanceWindow().view(time.Now()),
+			"updated_at":   timeutil.FormatBeijingTime(time.Now()),
+		},
+	})
+	if err != nil {
+		return nil
+	}
+	return data
+}
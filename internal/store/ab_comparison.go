@@ -0,0 +1,138 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// ABComparisonRecord 两个节点的 A/B 对比任务；Results 为逐条提示词的双方响应（JSON），Summary 为汇总（JSON）。
+type ABComparisonRecord struct {
+	ID         string
+	AccountID  string
+	NodeAID    string
+	NodeAName  string
+	NodeBID    string
+	NodeBName  string
+	Label      string
+	Status     string
+	Prompts    int
+	Results    string
+	Summary    string
+	Error      string
+	StartedBy  string
+	CreatedAt  time.Time
+	FinishedAt *time.Time
+}
+
+func (s *Store) ensureABComparisonTable(ctx context.Context) error {
+	ctx, cancel := s.withTimeout(ctx, opWrite)
+	defer cancel()
+	stmt := `CREATE TABLE IF NOT EXISTS ab_comparisons (
+		id VARCHAR(64) PRIMARY KEY,
+		account_id VARCHAR(64) NOT NULL,
+		node_a_id VARCHAR(64) NOT NULL,
+		node_a_name VARCHAR(255) NOT NULL DEFAULT '',
+		node_b_id VARCHAR(64) NOT NULL,
+		node_b_name VARCHAR(255) NOT NULL DEFAULT '',
+		label VARCHAR(255) NOT NULL DEFAULT '',
+		status VARCHAR(16) NOT NULL,
+		prompts INT NOT NULL DEFAULT 0,
+		results MEDIUMTEXT,
+		summary TEXT,
+		error TEXT,
+		started_by VARCHAR(128) NOT NULL DEFAULT '',
+		created_at DATETIME(3) NOT NULL,
+		finished_at DATETIME(3) NULL,
+		INDEX idx_ab_account_time (account_id, created_at)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`
+	_, err := s.db.ExecContext(ctx, stmt)
+	return err
+}
+
+// SaveABComparison 新建或更新对比任务（任务开始与结束时各写一次）。
+func (s *Store) SaveABComparison(ctx context.Context, rec ABComparisonRecord) error {
+	if rec.ID == "" {
+		return errors.New("id required")
+	}
+	rec.AccountID = normalizeAccount(rec.AccountID)
+	if rec.CreatedAt.IsZero() {
+		rec.CreatedAt = time.Now().UTC()
+	}
+	var finished interface{}
+	if rec.FinishedAt != nil {
+		finished = rec.FinishedAt.UTC()
+	}
+	ctx, cancel := s.withTimeout(ctx, opWrite)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, `INSERT INTO ab_comparisons
+		(id,account_id,node_a_id,node_a_name,node_b_id,node_b_name,label,status,prompts,results,summary,error,started_by,created_at,finished_at)
+		VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)
+		ON DUPLICATE KEY UPDATE status=VALUES(status), results=VALUES(results), summary=VALUES(summary), error=VALUES(error), finished_at=VALUES(finished_at)`,
+		rec.ID, rec.AccountID, rec.NodeAID, rec.NodeAName, rec.NodeBID, rec.NodeBName, rec.Label, rec.Status, rec.Prompts,
+		nullOrString(rec.Results), nullOrString(rec.Summary), nullOrString(rec.Error), rec.StartedBy, rec.CreatedAt.UTC(), finished)
+	return err
+}
+
+// GetABComparison 读取账号下的对比任务（含逐条结果），不存在时返回 nil。
+func (s *Store) GetABComparison(ctx context.Context, accountID, id string) (*ABComparisonRecord, error) {
+	recs, err := s.queryABComparisons(ctx, true, ` WHERE account_id=? AND id=?`, normalizeAccount(accountID), id)
+	if err != nil || len(recs) == 0 {
+		return nil, err
+	}
+	return &recs[0], nil
+}
+
+// ListABComparisons 返回账号最近的对比任务（不含逐条结果），按创建时间倒序。
+func (s *Store) ListABComparisons(ctx context.Context, accountID string, limit int) ([]ABComparisonRecord, error) {
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	return s.queryABComparisons(ctx, false, ` WHERE account_id=? ORDER BY created_at DESC LIMIT ?`, normalizeAccount(accountID), limit)
+}
+
+// DeleteABComparison 删除对比任务，返回是否存在。
+func (s *Store) DeleteABComparison(ctx context.Context, accountID, id string) (bool, error) {
+	ctx, cancel := s.withTimeout(ctx, opWrite)
+	defer cancel()
+	res, err := s.db.ExecContext(ctx, `DELETE FROM ab_comparisons WHERE account_id=? AND id=?`, normalizeAccount(accountID), id)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+func (s *Store) queryABComparisons(ctx context.Context, withResults bool, where string, args ...interface{}) ([]ABComparisonRecord, error) {
+	results := "NULL"
+	if withResults {
+		results = "results"
+	}
+	ctx, cancel := s.withTimeout(ctx, opRead)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, `SELECT id,account_id,node_a_id,node_a_name,node_b_id,node_b_name,label,status,prompts,`+results+`,summary,error,started_by,created_at,finished_at FROM ab_comparisons`+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []ABComparisonRecord
+	for rows.Next() {
+		var (
+			rec                 ABComparisonRecord
+			res, summary, errSt sql.NullString
+			finished            sql.NullTime
+		)
+		if err := rows.Scan(&rec.ID, &rec.AccountID, &rec.NodeAID, &rec.NodeAName, &rec.NodeBID, &rec.NodeBName, &rec.Label, &rec.Status, &rec.Prompts,
+			&res, &summary, &errSt, &rec.StartedBy, &rec.CreatedAt, &finished); err != nil {
+			return nil, err
+		}
+		rec.Results, rec.Summary, rec.Error = res.String, summary.String, errSt.String
+		if finished.Valid {
+			t := finished.Time
+			rec.FinishedAt = &t
+		}
+		out = append(out, rec)
+	}
+	return out, rows.Err()
+}
@@ -20,7 +20,7 @@ func (s *Store) CreateAccount(ctx context.Context, a AccountRecord) error {
 	if a.UpdatedAt.IsZero() {
 		a.UpdatedAt = now
 	}
-	ctx, cancel := withTimeout(ctx)
+	ctx, cancel := s.withTimeout(ctx, opWrite)
 	defer cancel()
 	_, err := s.db.ExecContext(ctx, `INSERT INTO accounts (id,name,password,proxy_api_key,is_admin,created_at,updated_at) VALUES (?,?,?,?,?,?,?)`,
 		a.ID, a.Name, nullOrString(a.Password), nullOrString(a.ProxyAPIKey), a.IsAdmin, a.CreatedAt, a.UpdatedAt)
@@ -29,7 +29,7 @@ func (s *Store) CreateAccount(ctx context.Context, a AccountRecord) error {
 
 // GetAccountByProxyKey 根据代理 API Key 获取账号。
 func (s *Store) GetAccountByProxyKey(ctx context.Context, proxyKey string) (*AccountRecord, error) {
-	ctx, cancel := withTimeout(ctx)
+	ctx, cancel := s.withTimeout(ctx, opRead)
 	defer cancel()
 	var (
 		rec       AccountRecord
@@ -52,7 +52,7 @@ func (s *Store) GetAccountByProxyKey(ctx context.Context, proxyKey string) (*Acc
 // GetAccountByID 按账号 ID 获取账号。
 func (s *Store) GetAccountByID(ctx context.Context, id string) (*AccountRecord, error) {
 	id = normalizeAccount(id)
-	ctx, cancel := withTimeout(ctx)
+	ctx, cancel := s.withTimeout(ctx, opRead)
 	defer cancel()
 	var (
 		rec       AccountRecord
@@ -74,7 +74,7 @@ func (s *Store) GetAccountByID(ctx context.Context, id string) (*AccountRecord,
 
 // ListAccounts 返回所有账号。
 func (s *Store) ListAccounts(ctx context.Context) ([]AccountRecord, error) {
-	ctx, cancel := withTimeout(ctx)
+	ctx, cancel := s.withTimeout(ctx, opRead)
 	defer cancel()
 	rows, err := s.db.QueryContext(ctx, `SELECT id,name,password,proxy_api_key,is_admin,created_at,updated_at FROM accounts ORDER BY created_at ASC`)
 	if err != nil {
@@ -105,7 +105,7 @@ func (s *Store) UpdateAccount(ctx context.Context, a AccountRecord) error {
 	}
 	a.ID = normalizeAccount(a.ID)
 	a.UpdatedAt = time.Now()
-	ctx, cancel := withTimeout(ctx)
+	ctx, cancel := s.withTimeout(ctx, opWrite)
 	defer cancel()
 	res, err := s.db.ExecContext(ctx, `UPDATE accounts SET name=?, password=?, proxy_api_key=?, is_admin=?, updated_at=? WHERE id=?`,
 		a.Name, nullOrString(a.Password), nullOrString(a.ProxyAPIKey), a.IsAdmin, a.UpdatedAt, a.ID)
@@ -119,39 +119,53 @@ func (s *Store) UpdateAccount(ctx context.Context, a AccountRecord) error {
 	return err
 }
 
-// DeleteAccount 删除账号（同时清理其节点与配置）。
-func (s *Store) DeleteAccount(ctx context.Context, id string) error {
+// DeleteAccount 删除账号记录并登记异步清理任务，节点、监控数据、配置等由调度器分批删除（见 PurgeAccountChunk）。
+func (s *Store) DeleteAccount(ctx context.Context, id string) (*AccountPurgeJob, error) {
 	if id == "" {
-		return errors.New("id required")
+		return nil, errors.New("id required")
 	}
 	id = normalizeAccount(id)
 	if id == DefaultAccountID {
-		return errors.New("cannot delete default account")
+		return nil, errors.New("cannot delete default account")
 	}
-	ctx, cancel := withTimeout(ctx)
+	ctx, cancel := s.withTimeout(ctx, opWrite)
 	defer cancel()
 	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if _, err := tx.ExecContext(ctx, `DELETE FROM nodes WHERE account_id=?`, id); err != nil {
+	res, err := tx.ExecContext(ctx, `DELETE FROM accounts WHERE id=?`, id)
+	if err != nil {
 		tx.Rollback()
-		return err
+		return nil, err
 	}
-	if _, err := tx.ExecContext(ctx, `DELETE FROM config WHERE account_id=?`, id); err != nil {
+	if rows, _ := res.RowsAffected(); rows == 0 {
 		tx.Rollback()
-		return err
+		return nil, ErrNotFound
 	}
-	res, err := tx.ExecContext(ctx, `DELETE FROM accounts WHERE id=?`, id)
+	now := time.Now().UTC()
+	res, err = tx.ExecContext(ctx, `INSERT INTO account_purge_jobs (account_id,status,table_index,deleted,created_at,updated_at) VALUES (?,?,0,'{}',?,?)`,
+		id, AccountPurgePending, now, now)
 	if err != nil {
 		tx.Rollback()
-		return err
+		return nil, err
 	}
-	if err := tx.Commit(); err != nil {
-		return err
+	jobID, err := res.LastInsertId()
+	if err != nil {
+		tx.Rollback()
+		return nil, err
 	}
-	if rows, _ := res.RowsAffected(); rows == 0 {
-		return ErrNotFound
+	if err := tx.Commit(); err != nil {
+		return nil, err
 	}
-	return nil
+	return &AccountPurgeJob{
+		ID:           jobID,
+		AccountID:    id,
+		Status:       AccountPurgePending,
+		CurrentTable: accountPurgeTables[0].Name,
+		TablesTotal:  len(accountPurgeTables),
+		Deleted:      map[string]int64{},
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}, nil
 }
@@ -0,0 +1,264 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// 账号数据清理任务状态。
+const (
+	AccountPurgePending = "pending"
+	AccountPurgeRunning = "running"
+	AccountPurgeDone    = "done"
+	AccountPurgeFailed  = "failed"
+)
+
+// accountPurgeTable 删除账号后需要清理的表及其按账号过滤的条件，按顺序逐表分批删除。
+// 审计日志保留，用于事后追溯。
+type accountPurgeTable struct {
+	Name  string
+	Where string
+}
+
+var accountPurgeTables = []accountPurgeTable{
+	{"status_incident_updates", `incident_id IN (SELECT id FROM (SELECT id FROM status_incidents WHERE account_id=?) t)`},
+	{"status_incidents", `account_id=?`},
+	{"status_pages", `account_id=?`},
+	{"node_uptime_daily", `account_id=?`},
+	{"health_check_history", `account_id=?`},
+	{"node_metrics_raw", `account_id=?`},
+	{"node_metrics_hourly", `account_id=?`},
+	{"node_metrics_daily", `account_id=?`},
+	{"node_metrics_monthly", `account_id=?`},
+	{"usage_rollups_hourly", `account_id=?`},
+	{"usage_rollups_daily", `account_id=?`},
+	{"request_logs", `account_id=?`},
+	{"node_benchmarks", `account_id=?`},
+	{"node_benchmark_schedules", `account_id=?`},
+	{"ab_comparisons", `account_id=?`},
+	{"node_client_certs", `account_id=?`},
+	{"node_ca_bundles", `account_id=?`},
+	{"node_dns_settings", `account_id=?`},
+	{"settings_changes", `account_id=?`},
+	{"jobs", `account_id=?`},
+	{"alerts", `account_id=?`},
+	{"escalation_policies", `account_id=?`},
+	{"notification_history", `account_id=?`},
+	{"notification_subscriptions", `account_id=?`},
+	{"notification_channels", `account_id=?`},
+	{"monitor_shares", `account_id=?`},
+	{"settings", `scope='account' AND account_id=?`},
+	{"config", `account_id=?`},
+	{"nodes", `account_id=?`},
+}
+
+// AccountPurgeJob 账号删除后的异步数据清理任务，Deleted 记录各表已删除的行数。
+type AccountPurgeJob struct {
+	ID           int64            `json:"id"`
+	AccountID    string           `json:"account_id"`
+	Status       string           `json:"status"`
+	CurrentTable string           `json:"current_table,omitempty"`
+	TablesDone   int              `json:"tables_done"`
+	TablesTotal  int              `json:"tables_total"`
+	Deleted      map[string]int64 `json:"deleted"`
+	Error        string           `json:"error,omitempty"`
+	CreatedAt    time.Time        `json:"created_at"`
+	UpdatedAt    time.Time        `json:"updated_at"`
+	FinishedAt   *time.Time       `json:"finished_at,omitempty"`
+}
+
+func (s *Store) ensureAccountPurgeTable(ctx context.Context) error {
+	ctx, cancel := s.withTimeout(ctx, opWrite)
+	defer cancel()
+	stmt := `CREATE TABLE IF NOT EXISTS account_purge_jobs (
+		id BIGINT AUTO_INCREMENT PRIMARY KEY,
+		account_id VARCHAR(64) NOT NULL,
+		status VARCHAR(16) NOT NULL,
+		table_index INT NOT NULL DEFAULT 0,
+		deleted JSON,
+		error TEXT,
+		created_at DATETIME NOT NULL,
+		updated_at DATETIME NOT NULL,
+		finished_at DATETIME NULL,
+		KEY idx_account_purge_status (status, id)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`
+	_, err := s.db.ExecContext(ctx, stmt)
+	return err
+}
+
+const accountPurgeColumns = `id,account_id,status,table_index,deleted,error,created_at,updated_at,finished_at`
+
+func scanAccountPurgeJob(scanner interface{ Scan(dest ...any) error }) (AccountPurgeJob, error) {
+	var (
+		job      AccountPurgeJob
+		idx      int
+		deleted  sql.NullString
+		errText  sql.NullString
+		finished sql.NullTime
+	)
+	if err := scanner.Scan(&job.ID, &job.AccountID, &job.Status, &idx, &deleted, &errText, &job.CreatedAt, &job.UpdatedAt, &finished); err != nil {
+		return job, err
+	}
+	job.Deleted = map[string]int64{}
+	if deleted.Valid && deleted.String != "" {
+		_ = json.Unmarshal([]byte(deleted.String), &job.Deleted)
+	}
+	job.Error = errText.String
+	if finished.Valid {
+		t := finished.Time
+		job.FinishedAt = &t
+	}
+	job.TablesDone = idx
+	job.TablesTotal = len(accountPurgeTables)
+	if idx < len(accountPurgeTables) && job.Status != AccountPurgeDone {
+		job.CurrentTable = accountPurgeTables[idx].Name
+	}
+	return job, nil
+}
+
+// ListAccountPurgeJobs 按创建时间倒序返回最近的清理任务。
+func (s *Store) ListAccountPurgeJobs(ctx context.Context, limit int) ([]AccountPurgeJob, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	ctx, cancel := s.withTimeout(ctx, opRead)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, `SELECT `+accountPurgeColumns+` FROM account_purge_jobs ORDER BY id DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	jobs := []AccountPurgeJob{}
+	for rows.Next() {
+		job, err := scanAccountPurgeJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+// GetAccountPurgeJob 按 ID 读取清理任务，不存在时返回 ErrNotFound。
+func (s *Store) GetAccountPurgeJob(ctx context.Context, id int64) (*AccountPurgeJob, error) {
+	ctx, cancel := s.withTimeout(ctx, opRead)
+	defer cancel()
+	row := s.db.QueryRowContext(ctx, `SELECT `+accountPurgeColumns+` FROM account_purge_jobs WHERE id=?`, id)
+	job, err := scanAccountPurgeJob(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// ListUnfinishedAccountPurgeJobs 按创建顺序返回待执行与执行中的任务。
+func (s *Store) ListUnfinishedAccountPurgeJobs(ctx context.Context) ([]AccountPurgeJob, error) {
+	ctx, cancel := s.withTimeout(ctx, opRead)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, `SELECT `+accountPurgeColumns+` FROM account_purge_jobs
+		WHERE status IN (?,?) ORDER BY id ASC`, AccountPurgePending, AccountPurgeRunning)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	jobs := []AccountPurgeJob{}
+	for rows.Next() {
+		job, err := scanAccountPurgeJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+// PurgeAccountChunk 为任务删除当前表中至多 limit 行并保存进度；当前表删完后推进到下一张表，
+// 全部表处理完毕时任务标记为 done。返回本次删除的行数。
+func (s *Store) PurgeAccountChunk(ctx context.Context, job *AccountPurgeJob, limit int) (int64, error) {
+	if job == nil {
+		return 0, errors.New("job is nil")
+	}
+	if limit <= 0 {
+		limit = 1000
+	}
+	idx := job.TablesDone
+	if idx >= len(accountPurgeTables) {
+		return 0, s.saveAccountPurgeJob(ctx, job, idx, nil)
+	}
+	table := accountPurgeTables[idx]
+	wctx, cancel := s.withTimeout(ctx, opCleanup)
+	res, err := s.db.ExecContext(wctx, `DELETE FROM `+table.Name+` WHERE `+table.Where+` LIMIT ?`, job.AccountID, limit)
+	cancel()
+	if err != nil {
+		if isMissingTable(err) {
+			// 旧版本库中可能没有该表，跳过即可。
+			return 0, s.saveAccountPurgeJob(ctx, job, idx+1, nil)
+		}
+		return 0, s.saveAccountPurgeJob(ctx, job, idx, err)
+	}
+	n, _ := res.RowsAffected()
+	if job.Deleted == nil {
+		job.Deleted = map[string]int64{}
+	}
+	if n > 0 {
+		job.Deleted[table.Name] += n
+	}
+	if n < int64(limit) {
+		idx++
+	}
+	return n, s.saveAccountPurgeJob(ctx, job, idx, nil)
+}
+
+// saveAccountPurgeJob 持久化任务进度并同步更新 job 的状态字段。
+func (s *Store) saveAccountPurgeJob(ctx context.Context, job *AccountPurgeJob, idx int, runErr error) error {
+	now := time.Now().UTC()
+	job.TablesDone, job.TablesTotal, job.UpdatedAt = idx, len(accountPurgeTables), now
+	job.Status, job.CurrentTable = AccountPurgeRunning, ""
+	if idx < len(accountPurgeTables) {
+		job.CurrentTable = accountPurgeTables[idx].Name
+	}
+	switch {
+	case runErr != nil:
+		job.Status, job.Error = AccountPurgeFailed, runErr.Error()
+		job.FinishedAt = &now
+	case idx >= len(accountPurgeTables):
+		job.Status = AccountPurgeDone
+		job.FinishedAt = &now
+	}
+	deleted, err := json.Marshal(job.Deleted)
+	if err != nil {
+		return err
+	}
+	var finished interface{}
+	if job.FinishedAt != nil {
+		finished = *job.FinishedAt
+	}
+	ctx, cancel := s.withTimeout(ctx, opWrite)
+	defer cancel()
+	if _, err := s.db.ExecContext(ctx, `UPDATE account_purge_jobs SET status=?, table_index=?, deleted=?, error=?, updated_at=?, finished_at=? WHERE id=?`,
+		job.Status, idx, string(deleted), nullOrString(job.Error), now, finished, job.ID); err != nil {
+		return err
+	}
+	return runErr
+}
+
+// RetryAccountPurgeJob 将失败的任务重置为待执行，从失败的表继续清理。
+func (s *Store) RetryAccountPurgeJob(ctx context.Context, id int64) error {
+	ctx, cancel := s.withTimeout(ctx, opWrite)
+	defer cancel()
+	res, err := s.db.ExecContext(ctx, `UPDATE account_purge_jobs SET status=?, error=NULL, finished_at=NULL, updated_at=? WHERE id=? AND status=?`,
+		AccountPurgePending, time.Now().UTC(), id, AccountPurgeFailed)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,371 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// 告警状态：open 表示尚未确认，仍会按升级策略继续通知。
+const (
+	AlertOpen         = "open"
+	AlertAcknowledged = "acknowledged"
+)
+
+// EscalationStep 升级链中的一步：通知指定渠道，未确认则等待 AfterMinutes 后升级到下一步。
+type EscalationStep struct {
+	ChannelID    string `json:"channel_id"`
+	AfterMinutes int    `json:"after_minutes"` // 第一步忽略，其余为距上一步通知的等待时间
+}
+
+// EscalationPolicyRecord 告警升级策略，匹配 EventTypes 中的事件。
+type EscalationPolicyRecord struct {
+	ID         string
+	AccountID  string
+	Name       string
+	EventTypes []string
+	Steps      []EscalationStep
+	Enabled    bool
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// AlertRecord 升级策略触发的告警及其确认状态。
+type AlertRecord struct {
+	ID               string
+	AccountID        string
+	PolicyID         string
+	EventType        string
+	DedupKey         string
+	Node             string
+	Severity         string
+	Title            string
+	Content          string
+	Step             int // 已通知到的步骤下标
+	Status           string
+	AcknowledgedBy   string
+	AcknowledgedAt   time.Time
+	NextEscalationAt time.Time // 零值表示升级链已走完
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+}
+
+// AlertQuery 告警查询条件。
+type AlertQuery struct {
+	AccountID string
+	Status    string
+	Limit     int
+}
+
+func (s *Store) ensureAlertTables(ctx context.Context) error {
+	ctx, cancel := s.withTimeout(ctx, opWrite)
+	defer cancel()
+	stmts := []string{
+		`CREATE TABLE IF NOT EXISTS escalation_policies (
+			id VARCHAR(64) PRIMARY KEY,
+			account_id VARCHAR(64) NOT NULL,
+			name VARCHAR(255) NOT NULL DEFAULT '',
+			event_types TEXT,
+			steps TEXT,
+			enabled BOOLEAN DEFAULT TRUE,
+			created_at DATETIME NOT NULL,
+			updated_at DATETIME NOT NULL,
+			KEY idx_escalation_account (account_id)
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+		`CREATE TABLE IF NOT EXISTS alerts (
+			id VARCHAR(64) PRIMARY KEY,
+			account_id VARCHAR(64) NOT NULL,
+			policy_id VARCHAR(64) NOT NULL,
+			event_type VARCHAR(128) NOT NULL,
+			dedup_key VARCHAR(255) NOT NULL DEFAULT '',
+			node VARCHAR(255) NOT NULL DEFAULT '',
+			severity VARCHAR(16) NOT NULL DEFAULT '',
+			title VARCHAR(255),
+			content TEXT,
+			step INT NOT NULL DEFAULT 0,
+			status VARCHAR(16) NOT NULL,
+			acknowledged_by VARCHAR(128) NOT NULL DEFAULT '',
+			acknowledged_at DATETIME NULL,
+			next_escalation_at DATETIME NULL,
+			created_at DATETIME NOT NULL,
+			updated_at DATETIME NOT NULL,
+			KEY idx_alert_account_time (account_id, created_at),
+			KEY idx_alert_open (status, next_escalation_at),
+			KEY idx_alert_dedup (account_id, policy_id, dedup_key)
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+	}
+	for _, stmt := range stmts {
+		if _, err := s.db.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const escalationColumns = `id,account_id,name,event_types,steps,enabled,created_at,updated_at`
+
+func scanEscalationPolicy(scanner interface{ Scan(...interface{}) error }) (EscalationPolicyRecord, error) {
+	var (
+		rec    EscalationPolicyRecord
+		events sql.NullString
+		steps  sql.NullString
+	)
+	if err := scanner.Scan(&rec.ID, &rec.AccountID, &rec.Name, &events, &steps, &rec.Enabled, &rec.CreatedAt, &rec.UpdatedAt); err != nil {
+		return rec, err
+	}
+	if events.String != "" {
+		_ = json.Unmarshal([]byte(events.String), &rec.EventTypes)
+	}
+	if steps.String != "" {
+		_ = json.Unmarshal([]byte(steps.String), &rec.Steps)
+	}
+	return rec, nil
+}
+
+func encodeEscalation(rec EscalationPolicyRecord) (string, string) {
+	events, _ := json.Marshal(rec.EventTypes)
+	steps, _ := json.Marshal(rec.Steps)
+	return string(events), string(steps)
+}
+
+// CreateEscalationPolicy 新建升级策略。
+func (s *Store) CreateEscalationPolicy(ctx context.Context, rec EscalationPolicyRecord) error {
+	if rec.ID == "" || rec.AccountID == "" {
+		return errors.New("id and account_id are required")
+	}
+	now := time.Now().UTC()
+	events, steps := encodeEscalation(rec)
+	ctx, cancel := s.withTimeout(ctx, opWrite)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, `INSERT INTO escalation_policies (`+escalationColumns+`) VALUES (?,?,?,?,?,?,?,?)`,
+		rec.ID, normalizeAccount(rec.AccountID), rec.Name, events, steps, rec.Enabled, now, now)
+	return err
+}
+
+// UpdateEscalationPolicy 覆盖升级策略的可编辑字段。
+func (s *Store) UpdateEscalationPolicy(ctx context.Context, rec EscalationPolicyRecord) error {
+	events, steps := encodeEscalation(rec)
+	ctx, cancel := s.withTimeout(ctx, opWrite)
+	defer cancel()
+	res, err := s.db.ExecContext(ctx, `UPDATE escalation_policies SET name=?, event_types=?, steps=?, enabled=?, updated_at=? WHERE id=?`,
+		rec.Name, events, steps, rec.Enabled, time.Now().UTC(), rec.ID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		if _, err := s.GetEscalationPolicy(ctx, rec.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetEscalationPolicy 根据 ID 获取升级策略。
+func (s *Store) GetEscalationPolicy(ctx context.Context, id string) (*EscalationPolicyRecord, error) {
+	ctx, cancel := s.withTimeout(ctx, opRead)
+	defer cancel()
+	rec, err := scanEscalationPolicy(s.db.QueryRowContext(ctx, `SELECT `+escalationColumns+` FROM escalation_policies WHERE id=?`, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &rec, nil
+}
+
+// ListEscalationPolicies 返回账号的全部升级策略。
+func (s *Store) ListEscalationPolicies(ctx context.Context, accountID string) ([]EscalationPolicyRecord, error) {
+	ctx, cancel := s.withTimeout(ctx, opRead)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, `SELECT `+escalationColumns+` FROM escalation_policies WHERE account_id=? ORDER BY created_at ASC`, normalizeAccount(accountID))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []EscalationPolicyRecord
+	for rows.Next() {
+		rec, err := scanEscalationPolicy(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, rec)
+	}
+	return out, rows.Err()
+}
+
+// ListEnabledEscalationPoliciesForEvent 返回账号下匹配指定事件且已启用的升级策略。
+func (s *Store) ListEnabledEscalationPoliciesForEvent(ctx context.Context, accountID, eventType string) ([]EscalationPolicyRecord, error) {
+	all, err := s.ListEscalationPolicies(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+	var out []EscalationPolicyRecord
+	for _, rec := range all {
+		if !rec.Enabled || len(rec.Steps) == 0 {
+			continue
+		}
+		for _, evt := range rec.EventTypes {
+			if evt == eventType {
+				out = append(out, rec)
+				break
+			}
+		}
+	}
+	return out, nil
+}
+
+// DeleteEscalationPolicy 删除升级策略，已触发告警保留以便追溯。
+func (s *Store) DeleteEscalationPolicy(ctx context.Context, id string) error {
+	ctx, cancel := s.withTimeout(ctx, opWrite)
+	defer cancel()
+	res, err := s.db.ExecContext(ctx, `DELETE FROM escalation_policies WHERE id=?`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+const alertColumns = `id,account_id,policy_id,event_type,dedup_key,node,severity,title,content,step,status,acknowledged_by,acknowledged_at,next_escalation_at,created_at,updated_at`
+
+func scanAlert(scanner interface{ Scan(...interface{}) error }) (AlertRecord, error) {
+	var (
+		rec     AlertRecord
+		content sql.NullString
+		ackAt   sql.NullTime
+		nextAt  sql.NullTime
+	)
+	if err := scanner.Scan(&rec.ID, &rec.AccountID, &rec.PolicyID, &rec.EventType, &rec.DedupKey, &rec.Node, &rec.Severity,
+		&rec.Title, &content, &rec.Step, &rec.Status, &rec.AcknowledgedBy, &ackAt, &nextAt, &rec.CreatedAt, &rec.UpdatedAt); err != nil {
+		return rec, err
+	}
+	rec.Content = content.String
+	if ackAt.Valid {
+		rec.AcknowledgedAt = ackAt.Time
+	}
+	if nextAt.Valid {
+		rec.NextEscalationAt = nextAt.Time
+	}
+	return rec, nil
+}
+
+func (s *Store) queryAlerts(ctx context.Context, query string, args ...interface{}) ([]AlertRecord, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []AlertRecord
+	for rows.Next() {
+		rec, err := scanAlert(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, rec)
+	}
+	return out, rows.Err()
+}
+
+// InsertAlert 写入新触发的告警。
+func (s *Store) InsertAlert(ctx context.Context, rec AlertRecord) error {
+	if rec.ID == "" || rec.AccountID == "" || rec.PolicyID == "" {
+		return errors.New("id, account_id, policy_id are required")
+	}
+	now := time.Now().UTC()
+	if rec.CreatedAt.IsZero() {
+		rec.CreatedAt = now
+	}
+	ctx, cancel := s.withTimeout(ctx, opWrite)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, `INSERT INTO alerts (`+alertColumns+`) VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)`,
+		rec.ID, normalizeAccount(rec.AccountID), rec.PolicyID, rec.EventType, rec.DedupKey, rec.Node, rec.Severity,
+		rec.Title, rec.Content, rec.Step, rec.Status, rec.AcknowledgedBy, nullTime(rec.AcknowledgedAt),
+		nullTime(rec.NextEscalationAt), rec.CreatedAt.UTC(), now)
+	return err
+}
+
+// GetAlert 根据 ID 获取告警。
+func (s *Store) GetAlert(ctx context.Context, id string) (*AlertRecord, error) {
+	ctx, cancel := s.withTimeout(ctx, opRead)
+	defer cancel()
+	rec, err := scanAlert(s.db.QueryRowContext(ctx, `SELECT `+alertColumns+` FROM alerts WHERE id=?`, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &rec, nil
+}
+
+// FindOpenAlert 查找同一策略、同一去重键下尚未确认的告警。
+func (s *Store) FindOpenAlert(ctx context.Context, accountID, policyID, dedupKey string) (*AlertRecord, error) {
+	ctx, cancel := s.withTimeout(ctx, opRead)
+	defer cancel()
+	rec, err := scanAlert(s.db.QueryRowContext(ctx, `SELECT `+alertColumns+` FROM alerts
+		WHERE account_id=? AND policy_id=? AND dedup_key=? AND status=? ORDER BY created_at DESC LIMIT 1`,
+		normalizeAccount(accountID), policyID, dedupKey, AlertOpen))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &rec, nil
+}
+
+// ListAlerts 按触发时间倒序列出账号告警，可按状态过滤。
+func (s *Store) ListAlerts(ctx context.Context, q AlertQuery) ([]AlertRecord, error) {
+	ctx, cancel := s.withTimeout(ctx, opRead)
+	defer cancel()
+	query := `SELECT ` + alertColumns + ` FROM alerts WHERE account_id=?`
+	args := []interface{}{normalizeAccount(q.AccountID)}
+	if q.Status != "" {
+		query += ` AND status=?`
+		args = append(args, q.Status)
+	}
+	query += ` ORDER BY created_at DESC`
+	if q.Limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, q.Limit)
+	}
+	return s.queryAlerts(ctx, query, args...)
+}
+
+// ListDueAlerts 返回所有账号中未确认且已到升级时间的告警。
+func (s *Store) ListDueAlerts(ctx context.Context, now time.Time) ([]AlertRecord, error) {
+	ctx, cancel := s.withTimeout(ctx, opRead)
+	defer cancel()
+	return s.queryAlerts(ctx, `SELECT `+alertColumns+` FROM alerts
+		WHERE status=? AND next_escalation_at IS NOT NULL AND next_escalation_at<=? ORDER BY next_escalation_at ASC`,
+		AlertOpen, now.UTC())
+}
+
+// AdvanceAlertEscalation 记录告警升级到的步骤与下一次升级时间（仅对未确认告警生效）。
+func (s *Store) AdvanceAlertEscalation(ctx context.Context, id string, step int, next time.Time) error {
+	ctx, cancel := s.withTimeout(ctx, opWrite)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, `UPDATE alerts SET step=?, next_escalation_at=?, updated_at=? WHERE id=? AND status=?`,
+		step, nullTime(next), time.Now().UTC(), id, AlertOpen)
+	return err
+}
+
+// AcknowledgeAlert 确认告警并停止后续升级，已确认的告警返回 ErrNotFound。
+func (s *Store) AcknowledgeAlert(ctx context.Context, id, by string, at time.Time) error {
+	ctx, cancel := s.withTimeout(ctx, opWrite)
+	defer cancel()
+	res, err := s.db.ExecContext(ctx, `UPDATE alerts SET status=?, acknowledged_by=?, acknowledged_at=?, next_escalation_at=NULL, updated_at=?
+		WHERE id=? AND status=?`, AlertAcknowledged, by, at.UTC(), time.Now().UTC(), id, AlertOpen)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// AuditLogRecord 审计日志记录。
+type AuditLogRecord struct {
+	ID        int64
+	AccountID string
+	Actor     string // 操作者：账号 ID、system 或调度器名称
+	Action    string // 动作，如 node.weight.adjust
+	Target    string // 目标对象，如节点 ID
+	Detail    string // 详情（通常为 JSON）
+	CreatedAt time.Time
+}
+
+// AuditLogQuery 审计日志查询条件。
+type AuditLogQuery struct {
+	AccountID string
+	Action    string // 支持前缀匹配，如 "node."
+	From      time.Time
+	To        time.Time
+	Limit     int
+	Offset    int
+}
+
+func (s *Store) ensureAuditLogTable(ctx context.Context) error {
+	ctx, cancel := s.withTimeout(ctx, opWrite)
+	defer cancel()
+	stmt := `CREATE TABLE IF NOT EXISTS audit_logs (
+		id BIGINT AUTO_INCREMENT PRIMARY KEY,
+		account_id VARCHAR(64) NOT NULL,
+		actor VARCHAR(128) NOT NULL,
+		action VARCHAR(64) NOT NULL,
+		target VARCHAR(128) NOT NULL DEFAULT '',
+		detail TEXT,
+		created_at DATETIME(3) NOT NULL,
+		INDEX idx_audit_account_time (account_id, created_at),
+		INDEX idx_audit_action_time (action, created_at)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`
+	_, err := s.db.ExecContext(ctx, stmt)
+	return err
+}
+
+// InsertAuditLog 写入一条审计日志。
+func (s *Store) InsertAuditLog(ctx context.Context, rec AuditLogRecord) error {
+	rec.AccountID = normalizeAccount(rec.AccountID)
+	if rec.CreatedAt.IsZero() {
+		rec.CreatedAt = time.Now().UTC()
+	}
+	ctx, cancel := s.withTimeout(ctx, opWrite)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, `INSERT INTO audit_logs (account_id,actor,action,target,detail,created_at) VALUES (?,?,?,?,?,?)`,
+		rec.AccountID, rec.Actor, rec.Action, rec.Target, rec.Detail, rec.CreatedAt.UTC())
+	return err
+}
+
+// ListAuditLogs 按条件查询审计日志，按时间倒序。
+func (s *Store) ListAuditLogs(ctx context.Context, q AuditLogQuery) ([]AuditLogRecord, error) {
+	var (
+		conds []string
+		args  []interface{}
+	)
+	if q.AccountID != "" {
+		conds = append(conds, "account_id=?")
+		args = append(args, q.AccountID)
+	}
+	if q.Action != "" {
+		conds = append(conds, "action LIKE ?")
+		args = append(args, q.Action+"%")
+	}
+	if !q.From.IsZero() {
+		conds = append(conds, "created_at>=?")
+		args = append(args, q.From.UTC())
+	}
+	if !q.To.IsZero() {
+		conds = append(conds, "created_at<=?")
+		args = append(args, q.To.UTC())
+	}
+	query := `SELECT id,account_id,actor,action,target,detail,created_at FROM audit_logs`
+	if len(conds) > 0 {
+		query += " WHERE " + strings.Join(conds, " AND ")
+	}
+	limit := q.Limit
+	if limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+	query += " ORDER BY created_at DESC, id DESC LIMIT ? OFFSET ?"
+	args = append(args, limit, q.Offset)
+
+	ctx, cancel := s.withTimeout(ctx, opRead)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []AuditLogRecord
+	for rows.Next() {
+		var rec AuditLogRecord
+		var detail sql.NullString
+		if err := rows.Scan(&rec.ID, &rec.AccountID, &rec.Actor, &rec.Action, &rec.Target, &detail, &rec.CreatedAt); err != nil {
+			return nil, err
+		}
+		rec.Detail = detail.String
+		out = append(out, rec)
+	}
+	return out, rows.Err()
+}
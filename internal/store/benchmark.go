@@ -0,0 +1,343 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// BenchmarkRecord 节点压测结果。
+type BenchmarkRecord struct {
+	ID            int64
+	AccountID     string
+	NodeID        string
+	NodeName      string
+	Model         string
+	Concurrency   int
+	DurationMs    int64
+	PromptChars   int
+	MaxTokens     int
+	RequestsTotal int64
+	RequestsOK    int64
+	RequestsFail  int64
+	ErrorRate     float64
+	RPS           float64
+	LatencyMinMs  int64
+	LatencyAvgMs  int64
+	LatencyP50Ms  int64
+	LatencyP90Ms  int64
+	LatencyP95Ms  int64
+	LatencyP99Ms  int64
+	LatencyMaxMs  int64
+	Errors        string // 错误分类计数（JSON）
+	StartedBy     string
+	StartedAt     time.Time
+	CreatedAt     time.Time
+}
+
+// BenchmarkQuery 压测结果查询条件。
+type BenchmarkQuery struct {
+	AccountID string
+	NodeID    string
+	From      time.Time
+	To        time.Time
+	Limit     int
+}
+
+func (s *Store) ensureBenchmarkTable(ctx context.Context) error {
+	ctx, cancel := s.withTimeout(ctx, opWrite)
+	defer cancel()
+	stmt := `CREATE TABLE IF NOT EXISTS node_benchmarks (
+		id BIGINT AUTO_INCREMENT PRIMARY KEY,
+		account_id VARCHAR(64) NOT NULL,
+		node_id VARCHAR(64) NOT NULL,
+		node_name VARCHAR(255) NOT NULL DEFAULT '',
+		model VARCHAR(128) NOT NULL DEFAULT '',
+		concurrency INT NOT NULL,
+		duration_ms BIGINT NOT NULL,
+		prompt_chars INT NOT NULL,
+		max_tokens INT NOT NULL,
+		requests_total BIGINT NOT NULL DEFAULT 0,
+		requests_ok BIGINT NOT NULL DEFAULT 0,
+		requests_fail BIGINT NOT NULL DEFAULT 0,
+		error_rate DOUBLE NOT NULL DEFAULT 0,
+		rps DOUBLE NOT NULL DEFAULT 0,
+		latency_min_ms BIGINT NOT NULL DEFAULT 0,
+		latency_avg_ms BIGINT NOT NULL DEFAULT 0,
+		latency_p50_ms BIGINT NOT NULL DEFAULT 0,
+		latency_p90_ms BIGINT NOT NULL DEFAULT 0,
+		latency_p95_ms BIGINT NOT NULL DEFAULT 0,
+		latency_p99_ms BIGINT NOT NULL DEFAULT 0,
+		latency_max_ms BIGINT NOT NULL DEFAULT 0,
+		errors TEXT,
+		started_by VARCHAR(128) NOT NULL DEFAULT '',
+		started_at DATETIME(3) NOT NULL,
+		created_at DATETIME(3) NOT NULL,
+		INDEX idx_benchmark_node_time (node_id, started_at),
+		INDEX idx_benchmark_account_time (account_id, started_at)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`
+	_, err := s.db.ExecContext(ctx, stmt)
+	return err
+}
+
+// InsertBenchmark 保存一次压测结果，返回自增 ID。
+func (s *Store) InsertBenchmark(ctx context.Context, rec BenchmarkRecord) (int64, error) {
+	rec.AccountID = normalizeAccount(rec.AccountID)
+	if rec.CreatedAt.IsZero() {
+		rec.CreatedAt = time.Now().UTC()
+	}
+	ctx, cancel := s.withTimeout(ctx, opWrite)
+	defer cancel()
+	res, err := s.db.ExecContext(ctx, `INSERT INTO node_benchmarks (
+		account_id,node_id,node_name,model,concurrency,duration_ms,prompt_chars,max_tokens,
+		requests_total,requests_ok,requests_fail,error_rate,rps,
+		latency_min_ms,latency_avg_ms,latency_p50_ms,latency_p90_ms,latency_p95_ms,latency_p99_ms,latency_max_ms,
+		errors,started_by,started_at,created_at
+	) VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)`,
+		rec.AccountID, rec.NodeID, rec.NodeName, rec.Model, rec.Concurrency, rec.DurationMs, rec.PromptChars, rec.MaxTokens,
+		rec.RequestsTotal, rec.RequestsOK, rec.RequestsFail, rec.ErrorRate, rec.RPS,
+		rec.LatencyMinMs, rec.LatencyAvgMs, rec.LatencyP50Ms, rec.LatencyP90Ms, rec.LatencyP95Ms, rec.LatencyP99Ms, rec.LatencyMaxMs,
+		rec.Errors, rec.StartedBy, rec.StartedAt.UTC(), rec.CreatedAt.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// ListBenchmarks 按条件查询压测结果，按开始时间倒序。
+func (s *Store) ListBenchmarks(ctx context.Context, q BenchmarkQuery) ([]BenchmarkRecord, error) {
+	var (
+		conds []string
+		args  []interface{}
+	)
+	if q.AccountID != "" {
+		conds = append(conds, "account_id=?")
+		args = append(args, q.AccountID)
+	}
+	if q.NodeID != "" {
+		conds = append(conds, "node_id=?")
+		args = append(args, q.NodeID)
+	}
+	if !q.From.IsZero() {
+		conds = append(conds, "started_at>=?")
+		args = append(args, q.From.UTC())
+	}
+	if !q.To.IsZero() {
+		conds = append(conds, "started_at<=?")
+		args = append(args, q.To.UTC())
+	}
+	query := `SELECT id,account_id,node_id,node_name,model,concurrency,duration_ms,prompt_chars,max_tokens,
+		requests_total,requests_ok,requests_fail,error_rate,rps,
+		latency_min_ms,latency_avg_ms,latency_p50_ms,latency_p90_ms,latency_p95_ms,latency_p99_ms,latency_max_ms,
+		errors,started_by,started_at,created_at FROM node_benchmarks`
+	if len(conds) > 0 {
+		query += " WHERE " + strings.Join(conds, " AND ")
+	}
+	limit := q.Limit
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+	query += " ORDER BY started_at DESC, id DESC LIMIT ?"
+	args = append(args, limit)
+
+	ctx, cancel := s.withTimeout(ctx, opRead)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []BenchmarkRecord
+	for rows.Next() {
+		var rec BenchmarkRecord
+		var errs sql.NullString
+		if err := rows.Scan(&rec.ID, &rec.AccountID, &rec.NodeID, &rec.NodeName, &rec.Model, &rec.Concurrency, &rec.DurationMs, &rec.PromptChars, &rec.MaxTokens,
+			&rec.RequestsTotal, &rec.RequestsOK, &rec.RequestsFail, &rec.ErrorRate, &rec.RPS,
+			&rec.LatencyMinMs, &rec.LatencyAvgMs, &rec.LatencyP50Ms, &rec.LatencyP90Ms, &rec.LatencyP95Ms, &rec.LatencyP99Ms, &rec.LatencyMaxMs,
+			&errs, &rec.StartedBy, &rec.StartedAt, &rec.CreatedAt); err != nil {
+			return nil, err
+		}
+		rec.Errors = errs.String
+		out = append(out, rec)
+	}
+	return out, rows.Err()
+}
+
+// BenchmarkSchedule 节点定时压测配置。
+type BenchmarkSchedule struct {
+	NodeID          string
+	AccountID       string
+	Enabled         bool
+	IntervalMinutes int
+	Concurrency     int
+	DurationSec     int
+	PromptChars     int
+	MaxTokens       int
+	Model           string
+	LastRunAt       time.Time
+	NextRunAt       time.Time
+	UpdatedAt       time.Time
+}
+
+// BenchmarkTrendPoint 按天汇总的压测趋势。
+type BenchmarkTrendPoint struct {
+	Day          time.Time
+	Runs         int64
+	AvgP50Ms     float64
+	AvgP95Ms     float64
+	AvgP99Ms     float64
+	AvgErrorRate float64
+	AvgRPS       float64
+}
+
+func (s *Store) ensureBenchmarkScheduleTable(ctx context.Context) error {
+	ctx, cancel := s.withTimeout(ctx, opWrite)
+	defer cancel()
+	stmt := `CREATE TABLE IF NOT EXISTS node_benchmark_schedules (
+		node_id VARCHAR(64) PRIMARY KEY,
+		account_id VARCHAR(64) NOT NULL,
+		enabled BOOLEAN NOT NULL DEFAULT FALSE,
+		interval_minutes INT NOT NULL,
+		concurrency INT NOT NULL,
+		duration_sec INT NOT NULL,
+		prompt_chars INT NOT NULL,
+		max_tokens INT NOT NULL,
+		model VARCHAR(128) NOT NULL DEFAULT '',
+		last_run_at DATETIME(3) NULL,
+		next_run_at DATETIME(3) NULL,
+		updated_at DATETIME(3) NOT NULL,
+		INDEX idx_benchmark_schedule_due (enabled, next_run_at)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`
+	_, err := s.db.ExecContext(ctx, stmt)
+	return err
+}
+
+const benchmarkScheduleColumns = `node_id,account_id,enabled,interval_minutes,concurrency,duration_sec,prompt_chars,max_tokens,model,last_run_at,next_run_at,updated_at`
+
+func scanBenchmarkSchedule(scanner interface{ Scan(...interface{}) error }) (BenchmarkSchedule, error) {
+	var (
+		sc        BenchmarkSchedule
+		lastRun   sql.NullTime
+		nextRun   sql.NullTime
+		updatedAt time.Time
+	)
+	if err := scanner.Scan(&sc.NodeID, &sc.AccountID, &sc.Enabled, &sc.IntervalMinutes, &sc.Concurrency, &sc.DurationSec,
+		&sc.PromptChars, &sc.MaxTokens, &sc.Model, &lastRun, &nextRun, &updatedAt); err != nil {
+		return sc, err
+	}
+	if lastRun.Valid {
+		sc.LastRunAt = lastRun.Time
+	}
+	if nextRun.Valid {
+		sc.NextRunAt = nextRun.Time
+	}
+	sc.UpdatedAt = updatedAt
+	return sc, nil
+}
+
+func nullTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t.UTC()
+}
+
+// UpsertBenchmarkSchedule 保存节点定时压测配置。
+func (s *Store) UpsertBenchmarkSchedule(ctx context.Context, sc BenchmarkSchedule) error {
+	sc.AccountID = normalizeAccount(sc.AccountID)
+	sc.UpdatedAt = time.Now().UTC()
+	ctx, cancel := s.withTimeout(ctx, opWrite)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, `INSERT INTO node_benchmark_schedules (`+benchmarkScheduleColumns+`)
+		VALUES (?,?,?,?,?,?,?,?,?,?,?,?)
+		ON DUPLICATE KEY UPDATE account_id=VALUES(account_id),enabled=VALUES(enabled),interval_minutes=VALUES(interval_minutes),
+		concurrency=VALUES(concurrency),duration_sec=VALUES(duration_sec),prompt_chars=VALUES(prompt_chars),max_tokens=VALUES(max_tokens),
+		model=VALUES(model),last_run_at=VALUES(last_run_at),next_run_at=VALUES(next_run_at),updated_at=VALUES(updated_at)`,
+		sc.NodeID, sc.AccountID, sc.Enabled, sc.IntervalMinutes, sc.Concurrency, sc.DurationSec, sc.PromptChars, sc.MaxTokens,
+		sc.Model, nullTime(sc.LastRunAt), nullTime(sc.NextRunAt), sc.UpdatedAt)
+	return err
+}
+
+// GetBenchmarkSchedule 获取节点定时压测配置，不存在时返回 nil。
+func (s *Store) GetBenchmarkSchedule(ctx context.Context, nodeID string) (*BenchmarkSchedule, error) {
+	ctx, cancel := s.withTimeout(ctx, opRead)
+	defer cancel()
+	row := s.db.QueryRowContext(ctx, `SELECT `+benchmarkScheduleColumns+` FROM node_benchmark_schedules WHERE node_id=?`, nodeID)
+	sc, err := scanBenchmarkSchedule(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &sc, nil
+}
+
+// ListDueBenchmarkSchedules 返回已到期的启用配置。
+func (s *Store) ListDueBenchmarkSchedules(ctx context.Context, now time.Time) ([]BenchmarkSchedule, error) {
+	ctx, cancel := s.withTimeout(ctx, opRead)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, `SELECT `+benchmarkScheduleColumns+` FROM node_benchmark_schedules
+		WHERE enabled=TRUE AND (next_run_at IS NULL OR next_run_at<=?) ORDER BY next_run_at`, now.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []BenchmarkSchedule
+	for rows.Next() {
+		sc, err := scanBenchmarkSchedule(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, sc)
+	}
+	return out, rows.Err()
+}
+
+// DeleteBenchmarkSchedule 删除节点定时压测配置。
+func (s *Store) DeleteBenchmarkSchedule(ctx context.Context, nodeID string) error {
+	ctx, cancel := s.withTimeout(ctx, opWrite)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, `DELETE FROM node_benchmark_schedules WHERE node_id=?`, nodeID)
+	return err
+}
+
+// BenchmarkTrend 按天汇总节点压测结果。
+func (s *Store) BenchmarkTrend(ctx context.Context, nodeID string, from, to time.Time) ([]BenchmarkTrendPoint, error) {
+	ctx, cancel := s.withTimeout(ctx, opRead)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, `SELECT DATE(started_at) AS day, COUNT(*),
+		AVG(latency_p50_ms), AVG(latency_p95_ms), AVG(latency_p99_ms), AVG(error_rate), AVG(rps)
+		FROM node_benchmarks WHERE node_id=? AND started_at>=? AND started_at<?
+		GROUP BY day ORDER BY day`, nodeID, from.UTC(), to.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []BenchmarkTrendPoint
+	for rows.Next() {
+		var pt BenchmarkTrendPoint
+		if err := rows.Scan(&pt.Day, &pt.Runs, &pt.AvgP50Ms, &pt.AvgP95Ms, &pt.AvgP99Ms, &pt.AvgErrorRate, &pt.AvgRPS); err != nil {
+			return nil, err
+		}
+		out = append(out, pt)
+	}
+	return out, rows.Err()
+}
+
+// BenchmarkP95Average 返回时间窗口内成功压测的平均 p95 与样本数。
+func (s *Store) BenchmarkP95Average(ctx context.Context, nodeID string, from, to time.Time) (float64, int64, error) {
+	ctx, cancel := s.withTimeout(ctx, opRead)
+	defer cancel()
+	var (
+		avg   sql.NullFloat64
+		count int64
+	)
+	err := s.db.QueryRowContext(ctx, `SELECT AVG(latency_p95_ms), COUNT(*) FROM node_benchmarks
+		WHERE node_id=? AND started_at>=? AND started_at<? AND requests_ok>0`, nodeID, from.UTC(), to.UTC()).Scan(&avg, &count)
+	if err != nil {
+		return 0, 0, err
+	}
+	return avg.Float64, count, nil
+}
@@ -2,7 +2,6 @@ package store
 
 import (
 	"context"
-	"database/sql"
 	"time"
 )
 
@@ -14,7 +13,7 @@ func (s *Store) LoadAllByAccount(ctx context.Context, accountID string) (records
 		return
 	}
 
-	cctx, cancel := withTimeout(ctx)
+	cctx, cancel := s.withTimeout(ctx, opRead)
 	defer cancel()
 	row := s.db.QueryRowContext(cctx, `SELECT retries, fail_limit, health_every_ms, active_node FROM config WHERE account_id=?`, accountID)
 	var healthMs int64
@@ -23,26 +22,19 @@ func (s *Store) LoadAllByAccount(ctx context.Context, accountID string) (records
 	}
 	cfg.HealthEvery = time.Duration(healthMs) * time.Millisecond
 
-	nctx, ncancel := withTimeout(ctx)
+	nctx, ncancel := s.withTimeout(ctx, opRead)
 	defer ncancel()
-	rows, err := s.db.QueryContext(nctx, `SELECT id,name,base_url,api_key,health_check_method,account_id,weight,failed,disabled,last_error,created_at,requests,fail_count,fail_streak,total_bytes,total_input,total_output,stream_dur_ms,first_byte_ms,last_ping_ms,last_ping_err,last_health_check_at FROM nodes WHERE account_id=? ORDER BY weight ASC, created_at ASC`, accountID)
+	rows, err := s.db.QueryContext(nctx, `SELECT `+nodeColumns+` FROM nodes WHERE account_id=? ORDER BY weight ASC, created_at ASC`, accountID)
 	if err != nil {
 		return
 	}
 	defer rows.Close()
 	for rows.Next() {
 		var r NodeRecord
-		var lastHealthAt sql.NullTime
-		err = rows.Scan(&r.ID, &r.Name, &r.BaseURL, &r.APIKey, &r.HealthCheckMethod, &r.AccountID, &r.Weight, &r.Failed, &r.Disabled, &r.LastError, &r.CreatedAt, &r.Requests, &r.FailCount, &r.FailStreak, &r.TotalBytes, &r.TotalInput, &r.TotalOutput, &r.StreamDurMs, &r.FirstByteMs, &r.LastPingMs, &r.LastPingErr, &lastHealthAt)
+		r, err = scanNodeRecord(rows)
 		if err != nil {
 			return
 		}
-		if r.HealthCheckMethod == "" {
-			r.HealthCheckMethod = "api"
-		}
-		if lastHealthAt.Valid {
-			r.LastHealthCheckAt = lastHealthAt.Time
-		}
 		records = append(records, r)
 	}
 	return
@@ -55,7 +47,7 @@ func (s *Store) LoadConfigByAccount(ctx context.Context, accountID string) (Conf
 	if err := s.ensureConfigRow(ctx, accountID); err != nil {
 		return cfg, "", err
 	}
-	cctx, cancel := withTimeout(ctx)
+	cctx, cancel := s.withTimeout(ctx, opRead)
 	defer cancel()
 	row := s.db.QueryRowContext(cctx, `SELECT retries, fail_limit, health_every_ms, active_node FROM config WHERE account_id=?`, accountID)
 	var healthMs int64
@@ -72,7 +64,7 @@ func (s *Store) SetActive(ctx context.Context, accountID, id string) error {
 	if err := s.ensureConfigRow(ctx, accountID); err != nil {
 		return err
 	}
-	ctx, cancel := withTimeout(ctx)
+	ctx, cancel := s.withTimeout(ctx, opWrite)
 	defer cancel()
 	_, err := s.db.ExecContext(ctx, `UPDATE config SET active_node=? WHERE account_id=?`, id, accountID)
 	return err
@@ -83,7 +75,7 @@ func (s *Store) UpdateConfig(ctx context.Context, accountID string, cfg Config,
 	if err := s.ensureConfigRow(ctx, accountID); err != nil {
 		return err
 	}
-	ctx, cancel := withTimeout(ctx)
+	ctx, cancel := s.withTimeout(ctx, opWrite)
 	defer cancel()
 	_, err := s.db.ExecContext(ctx, `UPDATE config SET retries=?, fail_limit=?, health_every_ms=?, active_node=? WHERE account_id=?`,
 		cfg.Retries, cfg.FailLimit, cfg.HealthEvery.Milliseconds(), active, accountID)
@@ -92,7 +84,7 @@ func (s *Store) UpdateConfig(ctx context.Context, accountID string, cfg Config,
 
 func (s *Store) ensureConfigRow(ctx context.Context, accountID string) error {
 	accountID = normalizeAccount(accountID)
-	ctx, cancel := withTimeout(ctx)
+	ctx, cancel := s.withTimeout(ctx, opWrite)
 	defer cancel()
 	_, err := s.db.ExecContext(ctx, `INSERT IGNORE INTO config (account_id,retries,fail_limit,health_every_ms,active_node) VALUES (?,?,?,?,?)`,
 		accountID, 3, 3, 30000, "")
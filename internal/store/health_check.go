@@ -32,7 +32,7 @@ func (s *Store) InsertHealthCheck(ctx context.Context, record *HealthCheckRecord
 		record.CreatedAt = record.CreatedAt.UTC()
 	}
 
-	ctx, cancel := withTimeout(ctx)
+	ctx, cancel := s.withTimeout(ctx, opWrite)
 	defer cancel()
 
 	resp := sql.NullInt64{}
@@ -41,11 +41,15 @@ func (s *Store) InsertHealthCheck(ctx context.Context, record *HealthCheckRecord
 		resp.Int64 = int64(record.ResponseTimeMs)
 	}
 
-	_, err := s.db.ExecContext(ctx, `INSERT INTO health_check_history (
-		account_id, node_id, check_time, success, response_time_ms, error_message, check_method, created_at)
-		VALUES (?,?,?,?,?,?,?,?)`,
-		record.AccountID, record.NodeID, record.CheckTime, record.Success, resp, record.ErrorMessage, record.CheckMethod, record.CreatedAt)
-	return err
+	_, err := s.execCached(ctx, `INSERT INTO health_check_history (
+		account_id, node_id, check_time, success, response_time_ms, error_message, check_method, interval_ms, dns_ms, created_at)
+		VALUES (?,?,?,?,?,?,?,?,?,?)`,
+		record.AccountID, record.NodeID, record.CheckTime, record.Success, resp, record.ErrorMessage, record.CheckMethod, record.IntervalMs, record.DNSMs, record.CreatedAt)
+	if err != nil {
+		return err
+	}
+	// 明细仅保留 30 天，按日累计可用率供状态页展示更长周期。
+	return s.recordUptime(ctx, record.AccountID, record.NodeID, record.CheckTime, record.Success)
 }
 
 // QueryHealthChecks 查询健康检查历史，按时间升序返回。
@@ -81,9 +85,9 @@ func (s *Store) QueryHealthChecks(ctx context.Context, params QueryHealthCheckPa
 		offset = 0
 	}
 
-	ctx, cancel := withTimeout(ctx)
+	ctx, cancel := s.withTimeout(ctx, opRead)
 	defer cancel()
-	rows, err := s.db.QueryContext(ctx, `SELECT id, account_id, node_id, check_time, success, response_time_ms, error_message, check_method, created_at
+	rows, err := s.db.QueryContext(ctx, `SELECT id, account_id, node_id, check_time, success, response_time_ms, error_message, check_method, interval_ms, dns_ms, created_at
 		FROM health_check_history
 		WHERE account_id=? AND node_id=? AND check_time >= ? AND check_time <= ?
 		ORDER BY check_time ASC
@@ -98,7 +102,7 @@ func (s *Store) QueryHealthChecks(ctx context.Context, params QueryHealthCheckPa
 	for rows.Next() {
 		var rec HealthCheckRecord
 		var resp sql.NullInt64
-		if err := rows.Scan(&rec.ID, &rec.AccountID, &rec.NodeID, &rec.CheckTime, &rec.Success, &resp, &rec.ErrorMessage, &rec.CheckMethod, &rec.CreatedAt); err != nil {
+		if err := rows.Scan(&rec.ID, &rec.AccountID, &rec.NodeID, &rec.CheckTime, &rec.Success, &resp, &rec.ErrorMessage, &rec.CheckMethod, &rec.IntervalMs, &rec.DNSMs, &rec.CreatedAt); err != nil {
 			return nil, err
 		}
 		if resp.Valid {
@@ -130,7 +134,7 @@ func (s *Store) CountHealthChecks(ctx context.Context, params QueryHealthCheckPa
 		params.From = params.From.UTC()
 	}
 
-	ctx, cancel := withTimeout(ctx)
+	ctx, cancel := s.withTimeout(ctx, opRead)
 	defer cancel()
 	row := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM health_check_history WHERE account_id=? AND node_id=? AND check_time >= ? AND check_time <= ?`,
 		params.AccountID, params.NodeID, params.From, params.To)
@@ -141,19 +145,10 @@ func (s *Store) CountHealthChecks(ctx context.Context, params QueryHealthCheckPa
 	return total, nil
 }
 
-// CleanupHealthChecks 清理早于 before 的记录；未传入时保留 30 天。
-func (s *Store) CleanupHealthChecks(ctx context.Context, before time.Time) error {
+// CleanupHealthChecks 按保留时长清理健康检查历史并返回行数，keep 为 0 时不清理。
+func (s *Store) CleanupHealthChecks(ctx context.Context, scope CleanupScope, keep time.Duration, now time.Time) (int64, error) {
 	if s == nil || s.db == nil {
-		return errors.New("store not initialized")
-	}
-	cutoff := before
-	if cutoff.IsZero() {
-		cutoff = time.Now().UTC().Add(-healthHistoryRetention)
-	} else {
-		cutoff = cutoff.UTC()
+		return 0, errors.New("store not initialized")
 	}
-	ctx, cancel := withTimeout(ctx)
-	defer cancel()
-	_, err := s.db.ExecContext(ctx, `DELETE FROM health_check_history WHERE check_time < ?`, cutoff)
-	return err
+	return s.cleanupTable(ctx, "health_check_history", "check_time", keep, scope, now)
 }
@@ -0,0 +1,305 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// 事件状态，resolved 之外均视为进行中。
+const (
+	IncidentInvestigating = "investigating"
+	IncidentIdentified    = "identified"
+	IncidentMonitoring    = "monitoring"
+	IncidentResolved      = "resolved"
+)
+
+// IncidentRecord 人工维护的故障事件，可附带复盘（Markdown）。
+type IncidentRecord struct {
+	ID            int64
+	AccountID     string
+	Title         string
+	Status        string
+	Impact        string // minor/major/critical
+	AffectedNodes []string
+	Postmortem    string
+	StartedAt     time.Time
+	ResolvedAt    time.Time
+	CreatedBy     string
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	Updates       []IncidentUpdateRecord
+}
+
+// IncidentUpdateRecord 事件进展更新（Markdown）。
+type IncidentUpdateRecord struct {
+	ID         int64
+	IncidentID int64
+	Status     string
+	Body       string
+	CreatedBy  string
+	CreatedAt  time.Time
+}
+
+// IncidentQuery 事件查询条件。
+type IncidentQuery struct {
+	AccountID     string
+	ActiveOnly    bool
+	ResolvedSince time.Time // 非零时额外包含该时间之后解决的事件
+	Limit         int
+	Offset        int
+}
+
+func (s *Store) ensureIncidentTables(ctx context.Context) error {
+	ctx, cancel := s.withTimeout(ctx, opWrite)
+	defer cancel()
+	stmts := []string{
+		`CREATE TABLE IF NOT EXISTS status_incidents (
+			id BIGINT AUTO_INCREMENT PRIMARY KEY,
+			account_id VARCHAR(64) NOT NULL,
+			title VARCHAR(255) NOT NULL,
+			status VARCHAR(32) NOT NULL,
+			impact VARCHAR(16) NOT NULL DEFAULT '',
+			affected_nodes TEXT,
+			postmortem MEDIUMTEXT,
+			started_at DATETIME NOT NULL,
+			resolved_at DATETIME NULL,
+			created_by VARCHAR(128) NOT NULL DEFAULT '',
+			created_at DATETIME NOT NULL,
+			updated_at DATETIME NOT NULL,
+			INDEX idx_incident_account_time (account_id, started_at)
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+		`CREATE TABLE IF NOT EXISTS status_incident_updates (
+			id BIGINT AUTO_INCREMENT PRIMARY KEY,
+			incident_id BIGINT NOT NULL,
+			status VARCHAR(32) NOT NULL,
+			body MEDIUMTEXT,
+			created_by VARCHAR(128) NOT NULL DEFAULT '',
+			created_at DATETIME NOT NULL,
+			INDEX idx_incident_update (incident_id, created_at)
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+	}
+	for _, stmt := range stmts {
+		if _, err := s.db.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const incidentColumns = `id,account_id,title,status,impact,affected_nodes,postmortem,started_at,resolved_at,created_by,created_at,updated_at`
+
+func scanIncident(scanner interface{ Scan(...interface{}) error }) (IncidentRecord, error) {
+	var (
+		rec        IncidentRecord
+		nodes      sql.NullString
+		postmortem sql.NullString
+		resolvedAt sql.NullTime
+	)
+	if err := scanner.Scan(&rec.ID, &rec.AccountID, &rec.Title, &rec.Status, &rec.Impact, &nodes, &postmortem,
+		&rec.StartedAt, &resolvedAt, &rec.CreatedBy, &rec.CreatedAt, &rec.UpdatedAt); err != nil {
+		return rec, err
+	}
+	if nodes.String != "" {
+		_ = json.Unmarshal([]byte(nodes.String), &rec.AffectedNodes)
+	}
+	rec.Postmortem = postmortem.String
+	if resolvedAt.Valid {
+		rec.ResolvedAt = resolvedAt.Time
+	}
+	return rec, nil
+}
+
+func encodeNodeList(nodes []string) string {
+	if len(nodes) == 0 {
+		return "[]"
+	}
+	b, _ := json.Marshal(nodes)
+	return string(b)
+}
+
+// CreateIncident 新建事件，返回自增 ID。
+func (s *Store) CreateIncident(ctx context.Context, rec IncidentRecord) (int64, error) {
+	if rec.AccountID == "" || rec.Title == "" {
+		return 0, errors.New("account_id and title are required")
+	}
+	now := time.Now().UTC()
+	if rec.StartedAt.IsZero() {
+		rec.StartedAt = now
+	}
+	ctx, cancel := s.withTimeout(ctx, opWrite)
+	defer cancel()
+	res, err := s.db.ExecContext(ctx, `INSERT INTO status_incidents
+		(account_id,title,status,impact,affected_nodes,postmortem,started_at,resolved_at,created_by,created_at,updated_at)
+		VALUES (?,?,?,?,?,?,?,?,?,?,?)`,
+		normalizeAccount(rec.AccountID), rec.Title, rec.Status, rec.Impact, encodeNodeList(rec.AffectedNodes), rec.Postmortem,
+		rec.StartedAt.UTC(), nullTime(rec.ResolvedAt), rec.CreatedBy, now, now)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// UpdateIncident 覆盖事件的可编辑字段。
+func (s *Store) UpdateIncident(ctx context.Context, rec IncidentRecord) error {
+	ctx, cancel := s.withTimeout(ctx, opWrite)
+	defer cancel()
+	res, err := s.db.ExecContext(ctx, `UPDATE status_incidents SET title=?, status=?, impact=?, affected_nodes=?, postmortem=?,
+		started_at=?, resolved_at=?, updated_at=? WHERE id=? AND account_id=?`,
+		rec.Title, rec.Status, rec.Impact, encodeNodeList(rec.AffectedNodes), rec.Postmortem,
+		rec.StartedAt.UTC(), nullTime(rec.ResolvedAt), time.Now().UTC(), rec.ID, normalizeAccount(rec.AccountID))
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		if _, err := s.GetIncident(ctx, rec.AccountID, rec.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteIncident 删除事件及其进展记录。
+func (s *Store) DeleteIncident(ctx context.Context, accountID string, id int64) error {
+	ctx, cancel := s.withTimeout(ctx, opWrite)
+	defer cancel()
+	res, err := s.db.ExecContext(ctx, `DELETE FROM status_incidents WHERE id=? AND account_id=?`, id, normalizeAccount(accountID))
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	_, err = s.db.ExecContext(ctx, `DELETE FROM status_incident_updates WHERE incident_id=?`, id)
+	return err
+}
+
+// GetIncident 读取单个事件（含进展记录）。
+func (s *Store) GetIncident(ctx context.Context, accountID string, id int64) (*IncidentRecord, error) {
+	ctx, cancel := s.withTimeout(ctx, opRead)
+	defer cancel()
+	row := s.db.QueryRowContext(ctx, `SELECT `+incidentColumns+` FROM status_incidents WHERE id=? AND account_id=?`, id, normalizeAccount(accountID))
+	rec, err := scanIncident(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	list := []IncidentRecord{rec}
+	if err := s.attachIncidentUpdates(ctx, list); err != nil {
+		return nil, err
+	}
+	return &list[0], nil
+}
+
+// ListIncidents 按开始时间倒序列出事件（含进展记录）。
+func (s *Store) ListIncidents(ctx context.Context, q IncidentQuery) ([]IncidentRecord, error) {
+	ctx, cancel := s.withTimeout(ctx, opRead)
+	defer cancel()
+	query := `SELECT ` + incidentColumns + ` FROM status_incidents WHERE account_id=?`
+	args := []interface{}{normalizeAccount(q.AccountID)}
+	switch {
+	case q.ActiveOnly && !q.ResolvedSince.IsZero():
+		query += ` AND (status<>? OR resolved_at>=?)`
+		args = append(args, IncidentResolved, q.ResolvedSince.UTC())
+	case q.ActiveOnly:
+		query += ` AND status<>?`
+		args = append(args, IncidentResolved)
+	}
+	query += ` ORDER BY started_at DESC`
+	if q.Limit > 0 {
+		query += ` LIMIT ? OFFSET ?`
+		args = append(args, q.Limit, q.Offset)
+	}
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	var out []IncidentRecord
+	for rows.Next() {
+		rec, err := scanIncident(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		out = append(out, rec)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if err := s.attachIncidentUpdates(ctx, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (s *Store) attachIncidentUpdates(ctx context.Context, incidents []IncidentRecord) error {
+	if len(incidents) == 0 {
+		return nil
+	}
+	index := make(map[int64]int, len(incidents))
+	placeholders := make([]string, 0, len(incidents))
+	args := make([]interface{}, 0, len(incidents))
+	for i, inc := range incidents {
+		index[inc.ID] = i
+		placeholders = append(placeholders, "?")
+		args = append(args, inc.ID)
+	}
+	rows, err := s.db.QueryContext(ctx, `SELECT id,incident_id,status,body,created_by,created_at FROM status_incident_updates
+		WHERE incident_id IN (`+strings.Join(placeholders, ",")+`) ORDER BY created_at DESC, id DESC`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			u    IncidentUpdateRecord
+			body sql.NullString
+		)
+		if err := rows.Scan(&u.ID, &u.IncidentID, &u.Status, &body, &u.CreatedBy, &u.CreatedAt); err != nil {
+			return err
+		}
+		u.Body = body.String
+		if i, ok := index[u.IncidentID]; ok {
+			incidents[i].Updates = append(incidents[i].Updates, u)
+		}
+	}
+	return rows.Err()
+}
+
+// AddIncidentUpdate 追加事件进展，并同步事件状态（resolved 时记录解决时间）。
+func (s *Store) AddIncidentUpdate(ctx context.Context, accountID string, u IncidentUpdateRecord) (int64, error) {
+	inc, err := s.GetIncident(ctx, accountID, u.IncidentID)
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now().UTC()
+	if u.CreatedAt.IsZero() {
+		u.CreatedAt = now
+	}
+	ctx, cancel := s.withTimeout(ctx, opWrite)
+	defer cancel()
+	res, err := s.db.ExecContext(ctx, `INSERT INTO status_incident_updates (incident_id,status,body,created_by,created_at) VALUES (?,?,?,?,?)`,
+		u.IncidentID, u.Status, u.Body, u.CreatedBy, u.CreatedAt.UTC())
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	resolvedAt := inc.ResolvedAt
+	if u.Status == IncidentResolved && resolvedAt.IsZero() {
+		resolvedAt = u.CreatedAt
+	} else if u.Status != IncidentResolved {
+		resolvedAt = time.Time{}
+	}
+	_, err = s.db.ExecContext(ctx, `UPDATE status_incidents SET status=?, resolved_at=?, updated_at=? WHERE id=?`,
+		u.Status, nullTime(resolvedAt), now, u.IncidentID)
+	return id, err
+}
@@ -0,0 +1,369 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// 后台任务状态。
+const (
+	JobPending   = "pending"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+	JobCancelled = "cancelled"
+)
+
+// Job 持久化的后台任务。Payload/Result 为各任务类型自定义的 JSON；
+// CancelRequested 表示运行中的任务已被请求取消，由执行它的 worker 在心跳时发现并中止。
+type Job struct {
+	ID              int64           `json:"id"`
+	Type            string          `json:"type"`
+	AccountID       string          `json:"account_id,omitempty"`
+	Status          string          `json:"status"`
+	Payload         json.RawMessage `json:"payload,omitempty"`
+	Result          json.RawMessage `json:"result,omitempty"`
+	Progress        json.RawMessage `json:"progress,omitempty"` // 最近一次心跳时保存的执行进度
+	Error           string          `json:"error,omitempty"`
+	Attempts        int             `json:"attempts"`
+	MaxAttempts     int             `json:"max_attempts"`
+	CancelRequested bool            `json:"cancel_requested"`
+	CreatedBy       string          `json:"created_by,omitempty"`
+	LockedBy        string          `json:"locked_by,omitempty"`
+	RunAfter        time.Time       `json:"run_after"`
+	CreatedAt       time.Time       `json:"created_at"`
+	UpdatedAt       time.Time       `json:"updated_at"`
+	StartedAt       *time.Time      `json:"started_at,omitempty"`
+	FinishedAt      *time.Time      `json:"finished_at,omitempty"`
+}
+
+// JobFilter ListJobs 的筛选条件，空字段不过滤。
+type JobFilter struct {
+	AccountID string
+	Type      string
+	Status    string
+	Limit     int
+}
+
+func (s *Store) ensureJobsTable(ctx context.Context) error {
+	ctx, cancel := s.withTimeout(ctx, opWrite)
+	defer cancel()
+	stmt := `CREATE TABLE IF NOT EXISTS jobs (
+		id BIGINT AUTO_INCREMENT PRIMARY KEY,
+		type VARCHAR(64) NOT NULL,
+		account_id VARCHAR(64) NULL,
+		status VARCHAR(16) NOT NULL,
+		payload JSON,
+		result JSON,
+		progress JSON,
+		error TEXT,
+		attempts INT NOT NULL DEFAULT 0,
+		max_attempts INT NOT NULL DEFAULT 1,
+		cancel_requested TINYINT(1) NOT NULL DEFAULT 0,
+		created_by VARCHAR(64) NULL,
+		locked_by VARCHAR(64) NULL,
+		locked_at DATETIME NULL,
+		run_after DATETIME NOT NULL,
+		created_at DATETIME NOT NULL,
+		updated_at DATETIME NOT NULL,
+		started_at DATETIME NULL,
+		finished_at DATETIME NULL,
+		KEY idx_jobs_status_run (status, run_after, id),
+		KEY idx_jobs_account (account_id, id)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`
+	if _, err := s.db.ExecContext(ctx, stmt); err != nil {
+		return err
+	}
+	hasProgress, err := s.columnExists(ctx, "jobs", "progress")
+	if err != nil {
+		return err
+	}
+	if !hasProgress {
+		if _, err := s.db.ExecContext(ctx, `ALTER TABLE jobs ADD COLUMN progress JSON AFTER result`); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const jobColumns = `id,type,account_id,status,payload,result,progress,error,attempts,max_attempts,cancel_requested,created_by,locked_by,run_after,created_at,updated_at,started_at,finished_at`
+
+func scanJob(scanner interface{ Scan(dest ...any) error }) (Job, error) {
+	var (
+		job       Job
+		accountID sql.NullString
+		payload   sql.NullString
+		result    sql.NullString
+		progress  sql.NullString
+		errText   sql.NullString
+		createdBy sql.NullString
+		lockedBy  sql.NullString
+		started   sql.NullTime
+		finished  sql.NullTime
+	)
+	if err := scanner.Scan(&job.ID, &job.Type, &accountID, &job.Status, &payload, &result, &progress, &errText, &job.Attempts, &job.MaxAttempts,
+		&job.CancelRequested, &createdBy, &lockedBy, &job.RunAfter, &job.CreatedAt, &job.UpdatedAt, &started, &finished); err != nil {
+		return job, err
+	}
+	job.AccountID, job.Error, job.CreatedBy, job.LockedBy = accountID.String, errText.String, createdBy.String, lockedBy.String
+	if payload.Valid && payload.String != "" {
+		job.Payload = json.RawMessage(payload.String)
+	}
+	if result.Valid && result.String != "" {
+		job.Result = json.RawMessage(result.String)
+	}
+	if progress.Valid && progress.String != "" {
+		job.Progress = json.RawMessage(progress.String)
+	}
+	if started.Valid {
+		t := started.Time
+		job.StartedAt = &t
+	}
+	if finished.Valid {
+		t := finished.Time
+		job.FinishedAt = &t
+	}
+	return job, nil
+}
+
+func jsonArg(raw json.RawMessage) any {
+	if len(raw) == 0 {
+		return nil
+	}
+	return string(raw)
+}
+
+// EnqueueJob 写入待执行任务并回填 ID 与时间字段；MaxAttempts<=0 时按 1 次处理（不重试）。
+func (s *Store) EnqueueJob(ctx context.Context, job *Job) error {
+	if job == nil || job.Type == "" {
+		return errors.New("job type required")
+	}
+	now := time.Now().UTC()
+	if job.MaxAttempts <= 0 {
+		job.MaxAttempts = 1
+	}
+	if job.RunAfter.IsZero() {
+		job.RunAfter = now
+	}
+	job.Status, job.Attempts, job.CreatedAt, job.UpdatedAt = JobPending, 0, now, now
+	ctx, cancel := s.withTimeout(ctx, opWrite)
+	defer cancel()
+	res, err := s.db.ExecContext(ctx, `INSERT INTO jobs (type,account_id,status,payload,max_attempts,created_by,run_after,created_at,updated_at)
+		VALUES (?,?,?,?,?,?,?,?,?)`,
+		job.Type, nullOrString(job.AccountID), job.Status, jsonArg(job.Payload), job.MaxAttempts, nullOrString(job.CreatedBy),
+		job.RunAfter.UTC(), now, now)
+	if err != nil {
+		return err
+	}
+	job.ID, err = res.LastInsertId()
+	return err
+}
+
+// GetJob 按 ID 读取任务，不存在时返回 ErrNotFound。
+func (s *Store) GetJob(ctx context.Context, id int64) (*Job, error) {
+	ctx, cancel := s.withTimeout(ctx, opRead)
+	defer cancel()
+	job, err := scanJob(s.db.QueryRowContext(ctx, `SELECT `+jobColumns+` FROM jobs WHERE id=?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// ListJobs 按 ID 倒序返回任务，limit<=0 时默认 50。
+func (s *Store) ListJobs(ctx context.Context, f JobFilter) ([]Job, error) {
+	if f.Limit <= 0 {
+		f.Limit = 50
+	}
+	var (
+		where []string
+		args  []any
+	)
+	if f.AccountID != "" {
+		where, args = append(where, "account_id=?"), append(args, f.AccountID)
+	}
+	if f.Type != "" {
+		where, args = append(where, "type=?"), append(args, f.Type)
+	}
+	if f.Status != "" {
+		where, args = append(where, "status=?"), append(args, f.Status)
+	}
+	query := `SELECT ` + jobColumns + ` FROM jobs`
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, " AND ")
+	}
+	query += ` ORDER BY id DESC LIMIT ?`
+	args = append(args, f.Limit)
+	ctx, cancel := s.withTimeout(ctx, opRead)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	jobs := []Job{}
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+// ClaimJob 领取一个已到执行时间、类型在 types 中的待执行任务并标记为 running，
+// 以条件更新防止多个 worker 领取同一任务。没有可领取的任务时返回 ErrNotFound。
+func (s *Store) ClaimJob(ctx context.Context, worker string, types []string) (*Job, error) {
+	if len(types) == 0 {
+		return nil, ErrNotFound
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(types)), ",")
+	for i := 0; i < 3; i++ {
+		now := time.Now().UTC()
+		args := []any{JobPending, now}
+		for _, t := range types {
+			args = append(args, t)
+		}
+		rctx, cancel := s.withTimeout(ctx, opRead)
+		var id int64
+		err := s.db.QueryRowContext(rctx, `SELECT id FROM jobs WHERE status=? AND run_after<=? AND type IN (`+placeholders+`) ORDER BY id ASC LIMIT 1`, args...).Scan(&id)
+		cancel()
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+		wctx, cancel := s.withTimeout(ctx, opWrite)
+		res, err := s.db.ExecContext(wctx, `UPDATE jobs SET status=?, attempts=attempts+1, locked_by=?, locked_at=?, updated_at=?, started_at=COALESCE(started_at, ?)
+			WHERE id=? AND status=?`, JobRunning, worker, now, now, now, id, JobPending)
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+		if n, _ := res.RowsAffected(); n == 1 {
+			return s.GetJob(ctx, id)
+		}
+		// 被其他 worker 抢先领取，重新挑选。
+	}
+	return nil, ErrNotFound
+}
+
+// HeartbeatJob 刷新运行中任务的锁定时间并保存进度（progress 为空时保留原值），返回任务是否已被请求取消。
+// 任务已不归该 worker 所有（被回收或已结束）时返回 ErrNotFound。
+func (s *Store) HeartbeatJob(ctx context.Context, id int64, worker string, progress json.RawMessage) (bool, error) {
+	now := time.Now().UTC()
+	wctx, cancel := s.withTimeout(ctx, opWrite)
+	res, err := s.db.ExecContext(wctx, `UPDATE jobs SET locked_at=?, progress=COALESCE(?, progress) WHERE id=? AND status=? AND locked_by=?`,
+		now, jsonArg(progress), id, JobRunning, worker)
+	cancel()
+	if err != nil {
+		return false, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return false, ErrNotFound
+	}
+	rctx, cancel := s.withTimeout(ctx, opRead)
+	defer cancel()
+	var requested bool
+	err = s.db.QueryRowContext(rctx, `SELECT cancel_requested FROM jobs WHERE id=?`, id).Scan(&requested)
+	return requested, err
+}
+
+// FinishJob 记录 worker 的执行结果与最终进度：status 为 succeeded、failed 或 cancelled；
+// status 为 pending 时表示稍后重试，任务在 retryAt 之后重新可被领取。
+func (s *Store) FinishJob(ctx context.Context, id int64, worker, status string, result, progress json.RawMessage, errText string, retryAt time.Time) error {
+	now := time.Now().UTC()
+	var finished any
+	if status != JobPending {
+		finished = now
+	}
+	if retryAt.IsZero() {
+		retryAt = now
+	}
+	ctx, cancel := s.withTimeout(ctx, opWrite)
+	defer cancel()
+	res, err := s.db.ExecContext(ctx, `UPDATE jobs SET status=?, result=?, progress=COALESCE(?, progress), error=?, locked_by=NULL, locked_at=NULL, run_after=?, updated_at=?, finished_at=?
+		WHERE id=? AND status=? AND locked_by=?`,
+		status, jsonArg(result), jsonArg(progress), nullOrString(errText), retryAt.UTC(), now, finished, id, JobRunning, worker)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ReleaseJob 在 worker 退出时交还运行中的任务，不计入尝试次数。
+func (s *Store) ReleaseJob(ctx context.Context, id int64, worker string) error {
+	ctx, cancel := s.withTimeout(ctx, opWrite)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, `UPDATE jobs SET status=?, attempts=GREATEST(attempts-1,0), locked_by=NULL, locked_at=NULL, updated_at=?
+		WHERE id=? AND status=? AND locked_by=?`, JobPending, time.Now().UTC(), id, JobRunning, worker)
+	return err
+}
+
+// CancelJob 取消任务：待执行的任务直接标记为 cancelled，运行中的任务设置取消标记，
+// 由 worker 中止后标记。已结束的任务返回 ErrNotFound。
+func (s *Store) CancelJob(ctx context.Context, id int64) (*Job, error) {
+	now := time.Now().UTC()
+	wctx, cancel := s.withTimeout(ctx, opWrite)
+	res, err := s.db.ExecContext(wctx, `UPDATE jobs SET status=?, updated_at=?, finished_at=? WHERE id=? AND status=?`, JobCancelled, now, now, id, JobPending)
+	if err == nil {
+		if n, _ := res.RowsAffected(); n == 0 {
+			res, err = s.db.ExecContext(wctx, `UPDATE jobs SET cancel_requested=1, updated_at=? WHERE id=? AND status=?`, now, id, JobRunning)
+		}
+	}
+	cancel()
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, ErrNotFound
+	}
+	return s.GetJob(ctx, id)
+}
+
+// RetryJob 将失败或已取消的任务重置为待执行并清零尝试次数。
+func (s *Store) RetryJob(ctx context.Context, id int64) (*Job, error) {
+	now := time.Now().UTC()
+	wctx, cancel := s.withTimeout(ctx, opWrite)
+	res, err := s.db.ExecContext(wctx, `UPDATE jobs SET status=?, attempts=0, cancel_requested=0, error=NULL, result=NULL, progress=NULL, run_after=?, updated_at=?, finished_at=NULL
+		WHERE id=? AND status IN (?,?)`, JobPending, now, now, id, JobFailed, JobCancelled)
+	cancel()
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, ErrNotFound
+	}
+	return s.GetJob(ctx, id)
+}
+
+// RequeueStaleJobs 回收心跳超时（worker 崩溃或失联）的运行中任务：已请求取消的标记为 cancelled，
+// 尝试次数用尽的标记为 failed，其余重新可被领取。
+func (s *Store) RequeueStaleJobs(ctx context.Context, lockedBefore time.Time) (int64, error) {
+	now := time.Now().UTC()
+	ctx, cancel := s.withTimeout(ctx, opWrite)
+	defer cancel()
+	res, err := s.db.ExecContext(ctx, `UPDATE jobs SET
+		status=CASE WHEN cancel_requested=1 THEN ? WHEN attempts>=max_attempts THEN ? ELSE ? END,
+		error=CASE WHEN cancel_requested=0 AND attempts>=max_attempts THEN 'worker lost' ELSE error END,
+		finished_at=CASE WHEN cancel_requested=1 OR attempts>=max_attempts THEN ? ELSE NULL END,
+		locked_by=NULL, locked_at=NULL, updated_at=?
+		WHERE status=? AND locked_at<?`,
+		JobCancelled, JobFailed, JobPending, now, now, JobRunning, lockedBefore.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
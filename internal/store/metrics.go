@@ -29,16 +29,18 @@ func (s *Store) InsertMetrics(ctx context.Context, rec MetricsRecord) error {
 	if rec.ResponseTimeCount == 0 && rec.RequestsTotal > 0 {
 		rec.ResponseTimeCount = rec.RequestsTotal
 	}
-	ctx, cancel := withTimeout(ctx)
+	ctx, cancel := s.withTimeout(ctx, opWrite)
 	defer cancel()
-	_, err := s.db.ExecContext(ctx, `INSERT INTO node_metrics_raw (
-		account_id, node_id, ts, requests_total, requests_success, requests_failed,
+	_, err := s.execCached(ctx, `INSERT INTO node_metrics_raw (
+		account_id, node_id, label, model, key_id, error_class, ts, requests_total, requests_success, requests_failed,
 		response_time_sum_ms, response_time_count, bytes_total,
-		input_tokens_total, output_tokens_total, first_byte_time_sum_ms, stream_duration_sum_ms)
-		VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?)`,
-		rec.AccountID, rec.NodeID, rec.Timestamp, rec.RequestsTotal, rec.RequestsSuccess, rec.RequestsFailed,
+		input_tokens_total, output_tokens_total, first_byte_time_sum_ms, stream_duration_sum_ms,
+		hedged_total, hedge_wins_total, hedge_wasted_tokens)
+		VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)`,
+		rec.AccountID, rec.NodeID, rec.Label, rec.Model, rec.KeyID, rec.ErrorClass, rec.Timestamp, rec.RequestsTotal, rec.RequestsSuccess, rec.RequestsFailed,
 		rec.ResponseTimeSumMs, rec.ResponseTimeCount, rec.BytesTotal,
-		rec.InputTokensTotal, rec.OutputTokensTotal, rec.FirstByteTimeSumMs, rec.StreamDurationSumMs)
+		rec.InputTokensTotal, rec.OutputTokensTotal, rec.FirstByteTimeSumMs, rec.StreamDurationSumMs,
+		rec.HedgedTotal, rec.HedgeWinsTotal, rec.HedgeWastedTokens)
 	return err
 }
 
@@ -104,7 +106,7 @@ func (s *Store) QueryMetrics(ctx context.Context, q MetricsQuery) ([]MetricsReco
 		args = append(args, q.Offset)
 	}
 
-	ctx, cancel := withTimeout(ctx)
+	ctx, cancel := s.withTimeout(ctx, opRead)
 	defer cancel()
 	rows, err := s.db.QueryContext(ctx, b.String(), args...)
 	if err != nil {
@@ -142,7 +144,7 @@ func (s *Store) GetNode24hTrend(ctx context.Context, accountID, nodeID string) (
         ORDER BY bucket_start ASC
     `
 
-	ctx, cancel := withTimeout(ctx)
+	ctx, cancel := s.withTimeout(ctx, opRead)
 	defer cancel()
 	rows, err := s.db.QueryContext(ctx, hourlyQuery, accountID, nodeID, from, currentHourStart)
 	if err != nil {
@@ -218,7 +220,7 @@ func (s *Store) GetNodes24hTrend(ctx context.Context, accountID string, nodeIDs
 	}
 	hourlyArgs = append(hourlyArgs, from, currentHourStart)
 
-	ctx, cancel := withTimeout(ctx)
+	ctx, cancel := s.withTimeout(ctx, opRead)
 	defer cancel()
 	rows, err := s.db.QueryContext(ctx, hourlyQuery, hourlyArgs...)
 	if err != nil {
@@ -290,10 +292,6 @@ func (s *Store) GetNodes24hTrend(ctx context.Context, accountID string, nodeIDs
 // AggregateMetrics 将低粒度数据聚合到更高粒度。
 // target 取值：hour(原始->小时)、day(小时->天)、month(天->月)。
 func (s *Store) AggregateMetrics(ctx context.Context, accountID string, target MetricsGranularity, from, to time.Time) error {
-	srcTable, srcTimeCol, dstTable, bucketExpr, err := aggregationPlan(target)
-	if err != nil {
-		return err
-	}
 	if to.IsZero() {
 		to = time.Now().UTC()
 	}
@@ -307,6 +305,21 @@ func (s *Store) AggregateMetrics(ctx context.Context, accountID string, target M
 			from = to.AddDate(0, -1, 0)
 		}
 	}
+	query, args, err := aggregateMetricsSQL(accountID, target, from, to)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := s.withTimeout(ctx, opAggregate)
+	defer cancel()
+	_, err = s.db.ExecContext(ctx, query, args...)
+	return err
+}
+
+func aggregateMetricsSQL(accountID string, target MetricsGranularity, from, to time.Time) (string, []interface{}, error) {
+	srcTable, srcTimeCol, dstTable, bucketExpr, err := aggregationPlan(target)
+	if err != nil {
+		return "", nil, err
+	}
 	var args []interface{}
 	b := &strings.Builder{}
 	fmt.Fprintf(b, `INSERT INTO %s (
@@ -324,54 +337,155 @@ func (s *Store) AggregateMetrics(ctx context.Context, accountID string, target M
 		b.WriteString(" AND account_id=?")
 		args = append(args, accountID)
 	}
-	b.WriteString(" GROUP BY account_id, node_id, bucket_start ON DUPLICATE KEY UPDATE ")
+	// 按桶表达式分组：天/月聚合的源表自身有 bucket_start 列，按别名分组会解析为源列，
+	// 每个源桶各成一组，ON DUPLICATE KEY UPDATE 只留下最后一个。
+	fmt.Fprintf(b, " GROUP BY account_id, node_id, %s ON DUPLICATE KEY UPDATE ", bucketExpr)
 	b.WriteString("requests_total=VALUES(requests_total), requests_success=VALUES(requests_success), requests_failed=VALUES(requests_failed), ")
 	b.WriteString("response_time_sum_ms=VALUES(response_time_sum_ms), response_time_count=VALUES(response_time_count), ")
 	b.WriteString("bytes_total=VALUES(bytes_total), input_tokens_total=VALUES(input_tokens_total), output_tokens_total=VALUES(output_tokens_total), ")
 	b.WriteString("first_byte_time_sum_ms=VALUES(first_byte_time_sum_ms), stream_duration_sum_ms=VALUES(stream_duration_sum_ms)")
+	return b.String(), args, nil
+}
 
-	ctx, cancel := withTimeout(ctx)
+// RebuildAggregateBuckets 在同一事务中删除目标表 [from, to) 的聚合行并从源表重新聚合，
+// 同时清除源数据中已不存在的账号/节点留下的多余行。
+func (s *Store) RebuildAggregateBuckets(ctx context.Context, target MetricsGranularity, from, to time.Time) error {
+	_, _, dstTable, _, err := aggregationPlan(target)
+	if err != nil {
+		return err
+	}
+	query, args, err := aggregateMetricsSQL("", target, from, to)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := s.withTimeout(ctx, opAggregate)
 	defer cancel()
-	_, err = s.db.ExecContext(ctx, b.String(), args...)
-	return err
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM `+dstTable+` WHERE bucket_start >= ? AND bucket_start < ?`, from.UTC(), to.UTC()); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// AggregateMismatch 源表与聚合表在同一个桶上的汇总差异。
+type AggregateMismatch struct {
+	Granularity    MetricsGranularity `json:"granularity"`
+	BucketStart    time.Time          `json:"bucket_start"`
+	SourceRequests int64              `json:"source_requests"`
+	TargetRequests int64              `json:"target_requests"`
+	SourceTokens   int64              `json:"source_tokens"`
+	TargetTokens   int64              `json:"target_tokens"`
+	SourceBytes    int64              `json:"source_bytes"`
+	TargetBytes    int64              `json:"target_bytes"`
 }
 
-// CleanupMetrics 按保留策略清理数据；accountID 为空时清理全部租户。
-func (s *Store) CleanupMetrics(ctx context.Context, accountID string, now time.Time) error {
-	if now.IsZero() {
-		now = time.Now().UTC()
+// CompareAggregateBuckets 按桶比较 [from, to) 内源表与目标表的请求数、token 数与字节数，返回不一致的桶（升序）。
+// 目标表缺失的桶按 0 计；源数据已被清理的桶不参与比较。
+func (s *Store) CompareAggregateBuckets(ctx context.Context, target MetricsGranularity, from, to time.Time) ([]AggregateMismatch, error) {
+	srcTable, srcTimeCol, dstTable, bucketExpr, err := aggregationPlan(target)
+	if err != nil {
+		return nil, err
+	}
+	if !from.Before(to) {
+		return nil, nil
+	}
+	query := fmt.Sprintf(`SELECT src.bucket, src.requests, COALESCE(dst.requests, 0), src.tokens, COALESCE(dst.tokens, 0), src.bytes, COALESCE(dst.bytes, 0)
+		FROM (
+			SELECT CAST(%s AS DATETIME) AS bucket, SUM(requests_total) AS requests,
+				SUM(input_tokens_total) + SUM(output_tokens_total) AS tokens, SUM(bytes_total) AS bytes
+			FROM %s WHERE %s >= ? AND %s < ? GROUP BY bucket
+		) src
+		LEFT JOIN (
+			SELECT bucket_start AS bucket, SUM(requests_total) AS requests,
+				SUM(input_tokens_total) + SUM(output_tokens_total) AS tokens, SUM(bytes_total) AS bytes
+			FROM %s WHERE bucket_start >= ? AND bucket_start < ? GROUP BY bucket_start
+		) dst ON dst.bucket = src.bucket
+		WHERE dst.bucket IS NULL OR src.requests <> dst.requests OR src.tokens <> dst.tokens OR src.bytes <> dst.bytes
+		ORDER BY src.bucket`, bucketExpr, srcTable, srcTimeCol, srcTimeCol, dstTable)
+	ctx, cancel := s.withTimeout(ctx, opAggregate)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, query, from.UTC(), to.UTC(), from.UTC(), to.UTC())
+	if err != nil {
+		return nil, err
 	}
-	account := accountID
-	if account != "" {
-		account = normalizeAccount(account)
+	defer rows.Close()
+	var out []AggregateMismatch
+	for rows.Next() {
+		m := AggregateMismatch{Granularity: target}
+		if err := rows.Scan(&m.BucketStart, &m.SourceRequests, &m.TargetRequests, &m.SourceTokens, &m.TargetTokens, &m.SourceBytes, &m.TargetBytes); err != nil {
+			return nil, err
+		}
+		m.BucketStart = m.BucketStart.UTC()
+		out = append(out, m)
 	}
+	return out, rows.Err()
+}
 
+// MissingAggregateBuckets 返回 [from, to) 内源表有数据、目标表却没有任何行的聚合桶起点（UTC，升序），
+// 用于发现调度器停机或失败期间漏掉的聚合窗口。
+func (s *Store) MissingAggregateBuckets(ctx context.Context, target MetricsGranularity, from, to time.Time) ([]time.Time, error) {
+	srcTable, srcTimeCol, dstTable, bucketExpr, err := aggregationPlan(target)
+	if err != nil {
+		return nil, err
+	}
+	if !from.Before(to) {
+		return nil, nil
+	}
+	query := fmt.Sprintf(`SELECT src.bucket FROM (
+			SELECT DISTINCT CAST(%s AS DATETIME) AS bucket FROM %s WHERE %s >= ? AND %s < ?
+		) src
+		LEFT JOIN (
+			SELECT DISTINCT bucket_start FROM %s WHERE bucket_start >= ? AND bucket_start < ?
+		) dst ON dst.bucket_start = src.bucket
+		WHERE dst.bucket_start IS NULL ORDER BY src.bucket`, bucketExpr, srcTable, srcTimeCol, srcTimeCol, dstTable)
+	ctx, cancel := s.withTimeout(ctx, opAggregate)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, query, from.UTC(), to.UTC(), from.UTC(), to.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []time.Time
+	for rows.Next() {
+		var t time.Time
+		if err := rows.Scan(&t); err != nil {
+			return nil, err
+		}
+		out = append(out, t.UTC())
+	}
+	return out, rows.Err()
+}
+
+// CleanupMetrics 按保留策略清理监控数据与多维汇总，返回各表删除（或 DryRun 时将删除）的行数。
+func (s *Store) CleanupMetrics(ctx context.Context, scope CleanupScope, policy RetentionPolicy, now time.Time) (map[string]int64, error) {
 	cuts := []struct {
 		table string
 		col   string
 		keep  time.Duration
 	}{
-		{"node_metrics_raw", "ts", retentionRaw},
-		{"node_metrics_hourly", "bucket_start", retentionHourly},
-		{"node_metrics_daily", "bucket_start", retentionDaily},
+		{"node_metrics_raw", "ts", policy.RawMetrics},
+		{"node_metrics_hourly", "bucket_start", policy.HourlyMetrics},
+		{"node_metrics_daily", "bucket_start", policy.DailyMetrics},
+		{"usage_rollups_hourly", "bucket_start", policy.HourlyMetrics},
+		{"usage_rollups_daily", "bucket_start", policy.DailyMetrics},
 	}
+	deleted := make(map[string]int64, len(cuts))
 	for _, c := range cuts {
-		cutoff := now.Add(-c.keep)
-		b := &strings.Builder{}
-		fmt.Fprintf(b, "DELETE FROM %s WHERE %s < ?", c.table, c.col)
-		args := []interface{}{cutoff}
-		if account != "" {
-			b.WriteString(" AND account_id=?")
-			args = append(args, account)
-		}
-		ctx, cancel := withTimeout(ctx)
-		if _, err := s.db.ExecContext(ctx, b.String(), args...); err != nil {
-			cancel()
-			return err
+		n, err := s.cleanupTable(ctx, c.table, c.col, c.keep, scope, now)
+		if err != nil {
+			return deleted, err
 		}
-		cancel()
+		deleted[c.table] = n
 	}
-	return nil
+	return deleted, nil
 }
 
 // metricsTableInfo 返回查询用的表、时间列名与 created_at 列（原始表为实际列，其余为 NULL）。
@@ -403,3 +517,122 @@ func aggregationPlan(target MetricsGranularity) (srcTable, srcTimeCol, dstTable,
 		return "", "", "", "", fmt.Errorf("unsupported target granularity: %s", target)
 	}
 }
+
+// LabelUsage 按客户端标签汇总的用量。
+type LabelUsage struct {
+	Label             string
+	RequestsTotal     int64
+	RequestsFailed    int64
+	InputTokensTotal  int64
+	OutputTokensTotal int64
+	BytesTotal        int64
+}
+
+// UsageByLabel 基于原始指标按标签汇总用量（受原始数据保留期限制）。
+func (s *Store) UsageByLabel(ctx context.Context, accountID string, from, to time.Time) ([]LabelUsage, error) {
+	accountID = normalizeAccount(accountID)
+	if to.IsZero() {
+		to = time.Now().UTC()
+	}
+	if from.IsZero() {
+		from = to.Add(-24 * time.Hour)
+	}
+	ctx, cancel := s.withTimeout(ctx, opRead)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, `SELECT label, SUM(requests_total), SUM(requests_failed),
+		SUM(input_tokens_total), SUM(output_tokens_total), SUM(bytes_total)
+		FROM node_metrics_raw WHERE account_id=? AND ts >= ? AND ts < ?
+		GROUP BY label ORDER BY SUM(input_tokens_total)+SUM(output_tokens_total) DESC`,
+		accountID, from.UTC(), to.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var res []LabelUsage
+	for rows.Next() {
+		var u LabelUsage
+		if err := rows.Scan(&u.Label, &u.RequestsTotal, &u.RequestsFailed, &u.InputTokensTotal, &u.OutputTokensTotal, &u.BytesTotal); err != nil {
+			return nil, err
+		}
+		res = append(res, u)
+	}
+	return res, rows.Err()
+}
+
+// ErrorClassCount 按节点与失败分类统计的请求数。
+type ErrorClassCount struct {
+	NodeID     string
+	ErrorClass string
+	Count      int64
+}
+
+// ErrorsByClass 基于原始指标按节点与失败分类汇总失败请求（受原始数据保留期限制）。
+func (s *Store) ErrorsByClass(ctx context.Context, accountID, nodeID string, from, to time.Time) ([]ErrorClassCount, error) {
+	accountID = normalizeAccount(accountID)
+	query := `SELECT node_id, error_class, SUM(requests_failed) FROM node_metrics_raw
+		WHERE account_id=? AND ts >= ? AND ts < ? AND error_class <> ''`
+	args := []interface{}{accountID, from.UTC(), to.UTC()}
+	if nodeID != "" {
+		query += " AND node_id=?"
+		args = append(args, nodeID)
+	}
+	query += " GROUP BY node_id, error_class"
+	ctx, cancel := s.withTimeout(ctx, opRead)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var res []ErrorClassCount
+	for rows.Next() {
+		var c ErrorClassCount
+		if err := rows.Scan(&c.NodeID, &c.ErrorClass, &c.Count); err != nil {
+			return nil, err
+		}
+		res = append(res, c)
+	}
+	return res, rows.Err()
+}
+
+// HedgeNodeStats 按节点统计的对冲情况。
+type HedgeNodeStats struct {
+	NodeID            string
+	RequestsTotal     int64
+	HedgedTotal       int64
+	HedgeWinsTotal    int64
+	HedgeWastedTokens int64
+	InputTokensTotal  int64
+	OutputTokensTotal int64
+}
+
+// HedgingByNode 基于原始指标按节点汇总对冲次数、胜出次数与估算浪费的 token（受原始数据保留期限制）。
+// 对冲胜出的请求记在备用节点名下。
+func (s *Store) HedgingByNode(ctx context.Context, accountID, nodeID string, from, to time.Time) ([]HedgeNodeStats, error) {
+	accountID = normalizeAccount(accountID)
+	query := `SELECT node_id, SUM(requests_total), COALESCE(SUM(hedged_total),0), COALESCE(SUM(hedge_wins_total),0),
+		COALESCE(SUM(hedge_wasted_tokens),0), SUM(input_tokens_total), SUM(output_tokens_total)
+		FROM node_metrics_raw WHERE account_id=? AND ts >= ? AND ts < ?`
+	args := []interface{}{accountID, from.UTC(), to.UTC()}
+	if nodeID != "" {
+		query += " AND node_id=?"
+		args = append(args, nodeID)
+	}
+	query += " GROUP BY node_id"
+	ctx, cancel := s.withTimeout(ctx, opRead)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var res []HedgeNodeStats
+	for rows.Next() {
+		var h HedgeNodeStats
+		if err := rows.Scan(&h.NodeID, &h.RequestsTotal, &h.HedgedTotal, &h.HedgeWinsTotal, &h.HedgeWastedTokens, &h.InputTokensTotal, &h.OutputTokensTotal); err != nil {
+			return nil, err
+		}
+		res = append(res, h)
+	}
+	return res, rows.Err()
+}
@@ -8,7 +8,7 @@ import (
 )
 
 func (s *Store) ensureAccountsTable(ctx context.Context) error {
-	ctx, cancel := withTimeout(ctx)
+	ctx, cancel := s.withTimeout(ctx, opWrite)
 	defer cancel()
 	stmt := `CREATE TABLE IF NOT EXISTS accounts (
 		id VARCHAR(64) PRIMARY KEY,
@@ -33,7 +33,7 @@ func (s *Store) ensureAccountPassword(ctx context.Context) error {
 		return err
 	}
 	if !hasPwd {
-		alterCtx, cancel := withTimeout(context.Background())
+		alterCtx, cancel := s.withTimeout(context.Background(), opWrite)
 		defer cancel()
 		if _, err := s.db.ExecContext(alterCtx, `ALTER TABLE accounts ADD COLUMN password VARCHAR(500) DEFAULT '' AFTER name`); err != nil {
 			return err
@@ -41,7 +41,7 @@ func (s *Store) ensureAccountPassword(ctx context.Context) error {
 	}
 
 	// 补齐默认账号与管理员账号的初始密码（仅空密码时写入）。
-	updCtx, cancel := withTimeout(ctx)
+	updCtx, cancel := s.withTimeout(ctx, opWrite)
 	defer cancel()
 	if _, err := s.db.ExecContext(updCtx, `UPDATE accounts SET password=? WHERE (password IS NULL OR password='') AND id=?`, "default123", DefaultAccountID); err != nil {
 		return err
@@ -53,7 +53,7 @@ func (s *Store) ensureAccountPassword(ctx context.Context) error {
 }
 
 func (s *Store) ensureNodesTable(ctx context.Context) error {
-	ctx, cancel := withTimeout(ctx)
+	ctx, cancel := s.withTimeout(ctx, opWrite)
 	defer cancel()
 	stmt := `CREATE TABLE IF NOT EXISTS nodes (
             id VARCHAR(64) PRIMARY KEY,
@@ -78,6 +78,10 @@ func (s *Store) ensureNodesTable(ctx context.Context) error {
             last_ping_ms BIGINT DEFAULT -1,
             last_ping_err TEXT,
 			last_health_check_at DATETIME DEFAULT NULL,
+			state VARCHAR(16) NOT NULL DEFAULT '',
+			state_changed_at DATETIME DEFAULT NULL,
+			headers TEXT NULL,
+			health_interval_sec INT NOT NULL DEFAULT 0,
 			KEY idx_nodes_account (account_id)
         )`
 	if _, err := s.db.ExecContext(ctx, stmt); err != nil {
@@ -90,7 +94,7 @@ func (s *Store) ensureNodesTable(ctx context.Context) error {
 		return err
 	}
 	if !hasDisabled {
-		alterCtx, cancel := withTimeout(context.Background())
+		alterCtx, cancel := s.withTimeout(context.Background(), opWrite)
 		defer cancel()
 		if _, err := s.db.ExecContext(alterCtx, `ALTER TABLE nodes ADD COLUMN disabled BOOLEAN DEFAULT FALSE AFTER failed`); err != nil {
 			return err
@@ -102,7 +106,7 @@ func (s *Store) ensureNodesTable(ctx context.Context) error {
 		return err
 	}
 	if !hasAccount {
-		alterCtx, cancel := withTimeout(context.Background())
+		alterCtx, cancel := s.withTimeout(context.Background(), opWrite)
 		defer cancel()
 		if _, err := s.db.ExecContext(alterCtx, `ALTER TABLE nodes ADD COLUMN account_id VARCHAR(64) NOT NULL DEFAULT '`+DefaultAccountID+`' AFTER api_key`); err != nil {
 			return err
@@ -120,7 +124,7 @@ func (s *Store) ensureNodesTable(ctx context.Context) error {
 		return err
 	}
 	if !hasLastHealthCheckAt {
-		alterCtx, cancel := withTimeout(context.Background())
+		alterCtx, cancel := s.withTimeout(context.Background(), opWrite)
 		defer cancel()
 		if _, err := s.db.ExecContext(alterCtx, `ALTER TABLE nodes ADD COLUMN last_health_check_at DATETIME DEFAULT NULL AFTER last_ping_err`); err != nil {
 			return err
@@ -132,17 +136,41 @@ func (s *Store) ensureNodesTable(ctx context.Context) error {
 		return err
 	}
 	if !hasHealthMethod {
-		alterCtx, cancel := withTimeout(context.Background())
+		alterCtx, cancel := s.withTimeout(context.Background(), opWrite)
 		defer cancel()
 		if _, err := s.db.ExecContext(alterCtx, `ALTER TABLE nodes ADD COLUMN health_check_method VARCHAR(10) DEFAULT 'api' AFTER api_key`); err != nil {
 			return err
 		}
 	}
+
+	hasState, err := s.columnExists(context.Background(), "nodes", "state")
+	if err != nil {
+		return err
+	}
+	if !hasState {
+		alterCtx, cancel := s.withTimeout(context.Background(), opWrite)
+		defer cancel()
+		if _, err := s.db.ExecContext(alterCtx, `ALTER TABLE nodes ADD COLUMN state VARCHAR(16) NOT NULL DEFAULT '' AFTER last_health_check_at, ADD COLUMN state_changed_at DATETIME DEFAULT NULL AFTER state`); err != nil {
+			return err
+		}
+	}
+
+	hasHeaders, err := s.columnExists(context.Background(), "nodes", "headers")
+	if err != nil {
+		return err
+	}
+	if !hasHeaders {
+		alterCtx, cancel := s.withTimeout(context.Background(), opWrite)
+		defer cancel()
+		if _, err := s.db.ExecContext(alterCtx, `ALTER TABLE nodes ADD COLUMN headers TEXT NULL AFTER state_changed_at, ADD COLUMN health_interval_sec INT NOT NULL DEFAULT 0 AFTER headers`); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
 func (s *Store) ensureMonitorShareTable(ctx context.Context) error {
-	ctx, cancel := withTimeout(ctx)
+	ctx, cancel := s.withTimeout(ctx, opWrite)
 	defer cancel()
 	stmt := `CREATE TABLE IF NOT EXISTS monitor_shares (
 		id VARCHAR(64) PRIMARY KEY,
@@ -153,17 +181,27 @@ func (s *Store) ensureMonitorShareTable(ctx context.Context) error {
 		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 		revoked BOOLEAN DEFAULT FALSE,
 		revoked_at DATETIME NULL,
+		label VARCHAR(128) NOT NULL DEFAULT '',
 		UNIQUE KEY uniq_monitor_share_token (token),
 		KEY idx_monitor_share_account (account_id)
 	)`
 	if _, err := s.db.ExecContext(ctx, stmt); err != nil {
 		return err
 	}
+	hasLabel, err := s.columnExists(context.Background(), "monitor_shares", "label")
+	if err != nil {
+		return err
+	}
+	if !hasLabel {
+		if _, err := s.db.ExecContext(ctx, `ALTER TABLE monitor_shares ADD COLUMN label VARCHAR(128) NOT NULL DEFAULT '' AFTER revoked_at`); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
 func (s *Store) ensureHealthHistoryTable(ctx context.Context) error {
-	ctx, cancel := withTimeout(ctx)
+	ctx, cancel := s.withTimeout(ctx, opWrite)
 	defer cancel()
 	stmt := `CREATE TABLE IF NOT EXISTS health_check_history (
 	  id BIGINT AUTO_INCREMENT PRIMARY KEY,
@@ -174,12 +212,34 @@ func (s *Store) ensureHealthHistoryTable(ctx context.Context) error {
 	  response_time_ms INT,
 	  error_message TEXT,
 	  check_method VARCHAR(20) NOT NULL,
+	  interval_ms BIGINT NOT NULL DEFAULT 0,
+	  dns_ms BIGINT NOT NULL DEFAULT 0,
 	  created_at DATETIME(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
 	  INDEX idx_node_time (node_id, check_time),
 	  INDEX idx_account_node_time (account_id, node_id, check_time)
 	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`
-	_, err := s.db.ExecContext(ctx, stmt)
-	return err
+	if _, err := s.db.ExecContext(ctx, stmt); err != nil {
+		return err
+	}
+	hasInterval, err := s.columnExists(ctx, "health_check_history", "interval_ms")
+	if err != nil {
+		return err
+	}
+	if !hasInterval {
+		if _, err := s.db.ExecContext(ctx, `ALTER TABLE health_check_history ADD COLUMN interval_ms BIGINT NOT NULL DEFAULT 0 AFTER check_method`); err != nil {
+			return err
+		}
+	}
+	hasDNS, err := s.columnExists(ctx, "health_check_history", "dns_ms")
+	if err != nil {
+		return err
+	}
+	if !hasDNS {
+		if _, err := s.db.ExecContext(ctx, `ALTER TABLE health_check_history ADD COLUMN dns_ms BIGINT NOT NULL DEFAULT 0 AFTER interval_ms`); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (s *Store) ensureConfigTable(ctx context.Context) error {
@@ -199,7 +259,7 @@ func (s *Store) ensureConfigTable(ctx context.Context) error {
 }
 
 func (s *Store) ensureTunnelConfigTable(ctx context.Context) error {
-	ctx, cancel := withTimeout(ctx)
+	ctx, cancel := s.withTimeout(ctx, opWrite)
 	defer cancel()
 	stmt := `CREATE TABLE IF NOT EXISTS tunnel_config (
 		id VARCHAR(64) PRIMARY KEY,
@@ -217,7 +277,7 @@ func (s *Store) ensureTunnelConfigTable(ctx context.Context) error {
 }
 
 func (s *Store) ensureMetricsTables(ctx context.Context) error {
-	ctx, cancel := withTimeout(ctx)
+	ctx, cancel := s.withTimeout(ctx, opWrite)
 	defer cancel()
 
 	createRaw := `CREATE TABLE IF NOT EXISTS node_metrics_raw (
@@ -300,11 +360,55 @@ func (s *Store) ensureMetricsTables(ctx context.Context) error {
 			return err
 		}
 	}
-	return nil
+
+	// 原始指标按客户端标签（X-QCC-Label）归因。
+	hasLabel, err := s.columnExists(context.Background(), "node_metrics_raw", "label")
+	if err != nil {
+		return err
+	}
+	if !hasLabel {
+		if _, err := s.db.ExecContext(ctx, `ALTER TABLE node_metrics_raw ADD COLUMN label VARCHAR(64) NOT NULL DEFAULT '' AFTER node_id, ADD KEY idx_metrics_raw_account_label_time (account_id, label, ts)`); err != nil {
+			return err
+		}
+	}
+
+	// 多维汇总所需的模型与密钥维度。
+	hasModel, err := s.columnExists(context.Background(), "node_metrics_raw", "model")
+	if err != nil {
+		return err
+	}
+	if !hasModel {
+		if _, err := s.db.ExecContext(ctx, `ALTER TABLE node_metrics_raw ADD COLUMN model VARCHAR(128) NOT NULL DEFAULT '' AFTER label, ADD COLUMN key_id VARCHAR(64) NOT NULL DEFAULT '' AFTER model`); err != nil {
+			return err
+		}
+	}
+
+	// 失败分类维度。
+	hasErrorClass, err := s.columnExists(context.Background(), "node_metrics_raw", "error_class")
+	if err != nil {
+		return err
+	}
+	if !hasErrorClass {
+		if _, err := s.db.ExecContext(ctx, `ALTER TABLE node_metrics_raw ADD COLUMN error_class VARCHAR(32) NOT NULL DEFAULT '' AFTER key_id`); err != nil {
+			return err
+		}
+	}
+
+	// 对冲请求统计。
+	hasHedge, err := s.columnExists(context.Background(), "node_metrics_raw", "hedged_total")
+	if err != nil {
+		return err
+	}
+	if !hasHedge {
+		if _, err := s.db.ExecContext(ctx, `ALTER TABLE node_metrics_raw ADD COLUMN hedged_total BIGINT DEFAULT 0, ADD COLUMN hedge_wins_total BIGINT DEFAULT 0, ADD COLUMN hedge_wasted_tokens BIGINT DEFAULT 0`); err != nil {
+			return err
+		}
+	}
+	return s.ensureUsageRollupTables(ctx)
 }
 
 func (s *Store) recreateConfigTable() error {
-	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	ctx, cancel := s.withTimeout(context.Background(), opWrite)
 	defer cancel()
 
 	if _, err := s.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS config_new (
@@ -331,7 +435,7 @@ func (s *Store) recreateConfigTable() error {
 }
 
 func (s *Store) ensureNotificationTables(ctx context.Context) error {
-	ctx, cancel := withTimeout(ctx)
+	ctx, cancel := s.withTimeout(ctx, opWrite)
 	defer cancel()
 	if _, err := s.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS notification_channels (
 		id VARCHAR(64) PRIMARY KEY,
@@ -346,6 +450,15 @@ func (s *Store) ensureNotificationTables(ctx context.Context) error {
 	)`); err != nil {
 		return err
 	}
+	hasDigest, err := s.columnExists(context.Background(), "notification_channels", "digest_mode")
+	if err != nil {
+		return err
+	}
+	if !hasDigest {
+		if _, err := s.db.ExecContext(ctx, `ALTER TABLE notification_channels ADD COLUMN digest_mode VARCHAR(16) NOT NULL DEFAULT 'immediate' AFTER enabled`); err != nil {
+			return err
+		}
+	}
 
 	if _, err := s.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS notification_subscriptions (
 		id VARCHAR(64) PRIMARY KEY,
@@ -382,7 +495,7 @@ func (s *Store) ensureNotificationTables(ctx context.Context) error {
 }
 
 func (s *Store) ensureMonitorSharesTable(ctx context.Context) error {
-	ctx, cancel := withTimeout(ctx)
+	ctx, cancel := s.withTimeout(ctx, opWrite)
 	defer cancel()
 	stmt := `CREATE TABLE IF NOT EXISTS monitor_shares (
 		id VARCHAR(64) PRIMARY KEY,
@@ -393,6 +506,7 @@ func (s *Store) ensureMonitorSharesTable(ctx context.Context) error {
 		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
 		revoked BOOLEAN NOT NULL DEFAULT FALSE,
 		revoked_at TIMESTAMP NULL,
+		label VARCHAR(128) NOT NULL DEFAULT '',
 		INDEX idx_account_id (account_id),
 		INDEX idx_token (token),
 		INDEX idx_created_at (created_at)
@@ -429,7 +543,7 @@ func (s *Store) migrateConfigToSettings(ctx context.Context) error {
 	}
 
 	// 2) 读取所有 config 记录。
-	qctx, cancel := withTimeout(ctx)
+	qctx, cancel := s.withTimeout(ctx, opRead)
 	defer cancel()
 	rows, err := s.db.QueryContext(qctx, `SELECT account_id, retries, fail_limit, health_every_ms, active_node FROM config ORDER BY account_id ASC`)
 	if err != nil {
@@ -507,7 +621,7 @@ func (s *Store) insertSettingIfMissing(ctx context.Context, key, scope string, a
 	if err != nil {
 		return err
 	}
-	ictx, cancel := withTimeout(ctx)
+	ictx, cancel := s.withTimeout(ctx, opWrite)
 	defer cancel()
 	_, err = s.db.ExecContext(ictx, "INSERT IGNORE INTO settings (`key`, scope, account_id, value, data_type, category, is_secret, version) VALUES (?,?,?,?,?,?,FALSE,1)",
 		key, scope, account, body, dataType, category)
@@ -515,15 +629,19 @@ func (s *Store) insertSettingIfMissing(ctx context.Context, key, scope string, a
 }
 
 func (s *Store) columnExists(ctx context.Context, table, column string) (bool, error) {
-	ctx, cancel := withTimeout(ctx)
+	ctx, cancel := s.withTimeout(ctx, opRead)
 	defer cancel()
-	row := s.db.QueryRowContext(ctx, `
+	query := `
 		SELECT COUNT(*) > 0
 		FROM information_schema.COLUMNS
 		WHERE TABLE_SCHEMA = DATABASE()
 		  AND TABLE_NAME = ?
 		  AND COLUMN_NAME = ?
-	`, table, column)
+	`
+	if s.backend == BackendSQLite {
+		query = `SELECT COUNT(*) > 0 FROM pragma_table_info(?) WHERE name = ?`
+	}
+	row := s.db.QueryRowContext(ctx, query, table, column)
 	var exists bool
 	if err := row.Scan(&exists); err != nil {
 		return false, err
@@ -532,14 +650,18 @@ func (s *Store) columnExists(ctx context.Context, table, column string) (bool, e
 }
 
 func (s *Store) tableExists(ctx context.Context, table string) (bool, error) {
-	ctx, cancel := withTimeout(ctx)
+	ctx, cancel := s.withTimeout(ctx, opRead)
 	defer cancel()
-	row := s.db.QueryRowContext(ctx, `
+	query := `
 		SELECT COUNT(*) > 0
 		FROM information_schema.TABLES
 		WHERE TABLE_SCHEMA = DATABASE()
 		  AND TABLE_NAME = ?
-	`, table)
+	`
+	if s.backend == BackendSQLite {
+		query = `SELECT COUNT(*) > 0 FROM sqlite_master WHERE type = 'table' AND name = ?`
+	}
+	row := s.db.QueryRowContext(ctx, query, table)
 	var exists bool
 	if err := row.Scan(&exists); err != nil {
 		return false, err
@@ -37,11 +37,11 @@ func (s *Store) CreateMonitorShare(ctx context.Context, rec MonitorShareRecord)
 		rec.RevokedAt = &t
 		revokedAt = t
 	}
-	ctx, cancel := withTimeout(ctx)
+	ctx, cancel := s.withTimeout(ctx, opWrite)
 	defer cancel()
-	_, err := s.db.ExecContext(ctx, `INSERT INTO monitor_shares (id,account_id,token,expire_at,created_by,created_at,revoked,revoked_at)
-		VALUES (?,?,?,?,?,?,?,?)`,
-		rec.ID, rec.AccountID, rec.Token, expire, rec.CreatedBy, rec.CreatedAt, rec.Revoked, revokedAt)
+	_, err := s.db.ExecContext(ctx, `INSERT INTO monitor_shares (id,account_id,token,expire_at,created_by,created_at,revoked,revoked_at,label)
+		VALUES (?,?,?,?,?,?,?,?,?)`,
+		rec.ID, rec.AccountID, rec.Token, expire, rec.CreatedBy, rec.CreatedAt, rec.Revoked, revokedAt, rec.Label)
 	return err
 }
 
@@ -50,17 +50,17 @@ func (s *Store) GetMonitorShareByToken(ctx context.Context, token string) (*Moni
 	if token == "" {
 		return nil, errors.New("token required")
 	}
-	ctx, cancel := withTimeout(ctx)
+	ctx, cancel := s.withTimeout(ctx, opRead)
 	defer cancel()
 	var (
 		rec       MonitorShareRecord
 		expire    sql.NullTime
 		revokedAt sql.NullTime
 	)
-	err := s.db.QueryRowContext(ctx, `SELECT id,account_id,token,expire_at,created_by,created_at,revoked,revoked_at
+	err := s.db.QueryRowContext(ctx, `SELECT id,account_id,token,expire_at,created_by,created_at,revoked,revoked_at,label
 		FROM monitor_shares
 		WHERE token=? AND revoked=FALSE AND (expire_at IS NULL OR expire_at>UTC_TIMESTAMP())`,
-		token).Scan(&rec.ID, &rec.AccountID, &rec.Token, &expire, &rec.CreatedBy, &rec.CreatedAt, &rec.Revoked, &revokedAt)
+		token).Scan(&rec.ID, &rec.AccountID, &rec.Token, &expire, &rec.CreatedBy, &rec.CreatedAt, &rec.Revoked, &revokedAt, &rec.Label)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, nil
@@ -86,16 +86,16 @@ func (s *Store) GetMonitorShareByID(ctx context.Context, id string) (*MonitorSha
 	if id == "" {
 		return nil, errors.New("id required")
 	}
-	ctx, cancel := withTimeout(ctx)
+	ctx, cancel := s.withTimeout(ctx, opRead)
 	defer cancel()
 	var (
 		rec       MonitorShareRecord
 		expire    sql.NullTime
 		revokedAt sql.NullTime
 	)
-	err := s.db.QueryRowContext(ctx, `SELECT id,account_id,token,expire_at,created_by,created_at,revoked,revoked_at
+	err := s.db.QueryRowContext(ctx, `SELECT id,account_id,token,expire_at,created_by,created_at,revoked,revoked_at,label
 		FROM monitor_shares WHERE id=?`, id).
-		Scan(&rec.ID, &rec.AccountID, &rec.Token, &expire, &rec.CreatedBy, &rec.CreatedAt, &rec.Revoked, &revokedAt)
+		Scan(&rec.ID, &rec.AccountID, &rec.Token, &expire, &rec.CreatedBy, &rec.CreatedAt, &rec.Revoked, &revokedAt, &rec.Label)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrNotFound
@@ -116,17 +116,38 @@ func (s *Store) GetMonitorShareByID(ctx context.Context, id string) (*MonitorSha
 
 // ListMonitorShares 列出分享链接
 func (s *Store) ListMonitorShares(ctx context.Context, params QueryMonitorSharesParams) ([]MonitorShareRecord, error) {
-	ctx, cancel := withTimeout(ctx)
+	ctx, cancel := s.withTimeout(ctx, opRead)
 	defer cancel()
-	query := `SELECT id,account_id,token,expire_at,created_by,created_at,revoked,revoked_at FROM monitor_shares`
-	conds := make([]string, 0, 2)
-	args := make([]interface{}, 0, 4)
+	query := `SELECT id,account_id,token,expire_at,created_by,created_at,revoked,revoked_at,label FROM monitor_shares`
+	conds := make([]string, 0, 5)
+	args := make([]interface{}, 0, 8)
 	if params.AccountID != "" {
 		conds = append(conds, "account_id=?")
 		args = append(args, normalizeAccount(params.AccountID))
 	}
-	if !params.IncludeRevoked {
-		conds = append(conds, "revoked=FALSE")
+	switch params.Status {
+	case MonitorShareActive:
+		conds = append(conds, "revoked=FALSE AND (expire_at IS NULL OR expire_at>UTC_TIMESTAMP())")
+	case MonitorShareExpired:
+		conds = append(conds, "revoked=FALSE AND expire_at IS NOT NULL AND expire_at<=UTC_TIMESTAMP()")
+	case MonitorShareRevoked:
+		conds = append(conds, "revoked=TRUE")
+	default:
+		if !params.IncludeRevoked {
+			conds = append(conds, "revoked=FALSE")
+		}
+	}
+	if params.CreatedBy != "" {
+		conds = append(conds, "created_by=?")
+		args = append(args, params.CreatedBy)
+	}
+	if !params.CreatedFrom.IsZero() {
+		conds = append(conds, "created_at>=?")
+		args = append(args, params.CreatedFrom.UTC())
+	}
+	if !params.CreatedTo.IsZero() {
+		conds = append(conds, "created_at<?")
+		args = append(args, params.CreatedTo.UTC())
 	}
 	if len(conds) > 0 {
 		query += " WHERE " + strings.Join(conds, " AND ")
@@ -158,7 +179,7 @@ func (s *Store) ListMonitorShares(ctx context.Context, params QueryMonitorShares
 			expire    sql.NullTime
 			revokedAt sql.NullTime
 		)
-		if err := rows.Scan(&rec.ID, &rec.AccountID, &rec.Token, &expire, &rec.CreatedBy, &rec.CreatedAt, &rec.Revoked, &revokedAt); err != nil {
+		if err := rows.Scan(&rec.ID, &rec.AccountID, &rec.Token, &expire, &rec.CreatedBy, &rec.CreatedAt, &rec.Revoked, &revokedAt, &rec.Label); err != nil {
 			return nil, err
 		}
 		if expire.Valid {
@@ -180,7 +201,7 @@ func (s *Store) RevokeMonitorShare(ctx context.Context, id string) error {
 	if id == "" {
 		return errors.New("id required")
 	}
-	ctx, cancel := withTimeout(ctx)
+	ctx, cancel := s.withTimeout(ctx, opWrite)
 	defer cancel()
 	res, err := s.db.ExecContext(ctx, `UPDATE monitor_shares SET revoked=TRUE, revoked_at=IFNULL(revoked_at, ?) WHERE id=?`, time.Now().UTC(), id)
 	if err != nil {
@@ -195,12 +216,57 @@ func (s *Store) RevokeMonitorShare(ctx context.Context, id string) error {
 	return nil
 }
 
+// UpdateMonitorShare 更新分享链接的过期时间与备注；expireAt 为零值表示永久有效。
+func (s *Store) UpdateMonitorShare(ctx context.Context, id string, expireAt time.Time, label string) error {
+	if id == "" {
+		return errors.New("id required")
+	}
+	var expire interface{}
+	if !expireAt.IsZero() {
+		expire = expireAt.UTC()
+	}
+	ctx, cancel := s.withTimeout(ctx, opWrite)
+	defer cancel()
+	res, err := s.db.ExecContext(ctx, `UPDATE monitor_shares SET expire_at=?, label=? WHERE id=?`, expire, label, id)
+	if err != nil {
+		return err
+	}
+	if rows, _ := res.RowsAffected(); rows == 0 {
+		_, err := s.GetMonitorShareByID(ctx, id)
+		return err
+	}
+	return nil
+}
+
+// RegenerateMonitorShareToken 替换分享链接的 token，旧链接立即失效。
+func (s *Store) RegenerateMonitorShareToken(ctx context.Context, id, token string) error {
+	if id == "" || token == "" {
+		return errors.New("id and token are required")
+	}
+	ctx, cancel := s.withTimeout(ctx, opWrite)
+	defer cancel()
+	res, err := s.db.ExecContext(ctx, `UPDATE monitor_shares SET token=? WHERE id=? AND revoked=FALSE`, token, id)
+	if err != nil {
+		return err
+	}
+	if rows, _ := res.RowsAffected(); rows == 0 {
+		rec, err := s.GetMonitorShareByID(ctx, id)
+		if err != nil {
+			return err
+		}
+		if rec.Revoked {
+			return errors.New("share revoked")
+		}
+	}
+	return nil
+}
+
 // DeleteMonitorShare 删除分享链接（物理删除）
 func (s *Store) DeleteMonitorShare(ctx context.Context, id string) error {
 	if id == "" {
 		return errors.New("id required")
 	}
-	ctx, cancel := withTimeout(ctx)
+	ctx, cancel := s.withTimeout(ctx, opWrite)
 	defer cancel()
 	res, err := s.db.ExecContext(ctx, `DELETE FROM monitor_shares WHERE id=?`, id)
 	if err != nil {
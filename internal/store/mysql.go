@@ -11,7 +11,7 @@ import (
 
 // ensureSettingsTable 创建统一配置表。
 func (s *Store) ensureSettingsTable(ctx context.Context) error {
-	ctx, cancel := withTimeout(ctx)
+	ctx, cancel := s.withTimeout(ctx, opWrite)
 	defer cancel()
 	stmt := "CREATE TABLE IF NOT EXISTS settings (" +
 		"  id BIGINT AUTO_INCREMENT PRIMARY KEY," +
@@ -37,18 +37,99 @@ func (s *Store) ensureSettingsTable(ctx context.Context) error {
 
 // SeedDefaultSettings 插入默认配置（若不存在）。
 func (s *Store) SeedDefaultSettings() error {
-	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	ctx, cancel := s.withTimeout(context.Background(), opWrite)
 	defer cancel()
 
 	defaults := []Setting{
 		{Key: "monitor.refresh_interval_ms", Scope: "system", Value: 30000, DataType: "number", Category: "monitor", Description: strPtr("监控大屏刷新间隔（毫秒）")},
 		{Key: "monitor.error_display", Scope: "system", Value: "icon", DataType: "string", Category: "monitor", Description: strPtr("错误显示方式：icon/inline")},
 		{Key: "monitor.show_node_stats", Scope: "system", Value: map[string]bool{"showProxy": true, "showHealth": true}, DataType: "object", Category: "monitor", Description: strPtr("节点统计栏显示配置")},
+		{Key: "monitor.throughput_interval_sec", Scope: "system", Value: 2, DataType: "number", Category: "monitor", Description: strPtr("实时流量推送间隔（秒，1-5）")},
 		{Key: "health.check_interval_sec", Scope: "system", Value: 30, DataType: "number", Category: "health", Description: strPtr("健康检查间隔（秒）")},
 		{Key: "health.fail_threshold", Scope: "system", Value: 3, DataType: "number", Category: "health", Description: strPtr("失败阈值")},
+		{Key: "health.max_concurrency", Scope: "system", Value: 16, DataType: "number", Category: "health", Description: strPtr("健康检查最大并发数")},
+		{Key: "health.spread_pct", Scope: "system", Value: 50, DataType: "number", Category: "health", Description: strPtr("每轮健康检查错峰窗口占检查间隔的百分比（0 为不错峰）")},
+		{Key: "health.jitter_ms", Scope: "system", Value: 1000, DataType: "number", Category: "health", Description: strPtr("单节点健康检查随机抖动上限（毫秒）")},
+		{Key: "health.cache_ttl_ms", Scope: "system", Value: 5000, DataType: "number", Category: "health", Description: strPtr("按需健康检查结果缓存时长（毫秒，0 为仅合并并发请求）")},
+		{Key: "health.backoff_max_sec", Scope: "system", Value: 600, DataType: "number", Category: "health", Description: strPtr("连续失败节点健康检查退避间隔上限（秒，0 为不退避）")},
 		{Key: "proxy.retry_max", Scope: "system", Value: 3, DataType: "number", Category: "performance", Description: strPtr("最大重试次数")},
+		{Key: "proxy.first_byte_timeout_ms", Scope: "system", Value: 30000, DataType: "number", Category: "performance", Description: strPtr("流式响应头返回后等待首字节的超时（毫秒，0 为不检测）")},
+		{Key: "password.min_length", Scope: "system", Value: 6, DataType: "number", Category: "security", Description: strPtr("账号与成员密码最小长度")},
+		{Key: "password.require_upper", Scope: "system", Value: false, DataType: "boolean", Category: "security", Description: strPtr("密码须包含大写字母")},
+		{Key: "password.require_lower", Scope: "system", Value: false, DataType: "boolean", Category: "security", Description: strPtr("密码须包含小写字母")},
+		{Key: "password.require_digit", Scope: "system", Value: false, DataType: "boolean", Category: "security", Description: strPtr("密码须包含数字")},
+		{Key: "password.require_symbol", Scope: "system", Value: false, DataType: "boolean", Category: "security", Description: strPtr("密码须包含特殊字符")},
+		{Key: "password.history", Scope: "system", Value: 0, DataType: "number", Category: "security", Description: strPtr("禁止重复使用最近 N 次的密码（0 为不检查）")},
+		{Key: "password.max_age_days", Scope: "system", Value: 0, DataType: "number", Category: "security", Description: strPtr("密码最长使用天数，超过后下次登录须修改（0 为不限制）")},
+		{Key: "siem.enabled", Scope: "system", Value: false, DataType: "boolean", Category: "security", Description: strPtr("是否向 SIEM 投递认证事件（登录、会话注销、修改密码）")},
+		{Key: "siem.target", Scope: "system", Value: "webhook", DataType: "string", Category: "security", Description: strPtr("认证事件投递方式：webhook 或 syslog")},
+		{Key: "siem.webhook_url", Scope: "system", Value: "", DataType: "string", Category: "security", Description: strPtr("认证事件 Webhook 地址")},
+		{Key: "siem.webhook_secret", Scope: "system", Value: "", DataType: "string", Category: "security", Description: strPtr("Webhook 签名密钥（HMAC-SHA256，留空不签名）"), IsSecret: true},
+		{Key: "siem.syslog_addr", Scope: "system", Value: "", DataType: "string", Category: "security", Description: strPtr("syslog 地址，如 udp://host:514 或 tcp://host:601")},
+		{Key: "siem.rate_limit_per_min", Scope: "system", Value: 600, DataType: "number", Category: "security", Description: strPtr("每分钟最多投递的认证事件数，超出丢弃（0 为不限制）")},
+		{Key: "siem.max_retries", Scope: "system", Value: 3, DataType: "number", Category: "security", Description: strPtr("认证事件投递失败后的最大重试次数")},
+		{Key: "maintenance.enabled", Scope: "system", Value: false, DataType: "boolean", Category: "performance", Description: strPtr("维护模式：代理请求返回 503，定时任务暂停，管理 API 不受影响")},
+		{Key: "maintenance.message", Scope: "system", Value: "", DataType: "string", Category: "performance", Description: strPtr("维护期间返回给调用方的提示信息")},
+		{Key: "maintenance.start_at", Scope: "system", Value: "", DataType: "string", Category: "performance", Description: strPtr("计划维护开始时间（RFC3339，留空为开启后立即生效）")},
+		{Key: "maintenance.end_at", Scope: "system", Value: "", DataType: "string", Category: "performance", Description: strPtr("计划维护结束时间（RFC3339，留空为手动关闭）")},
+		{Key: "proxy.max_request_bytes", Scope: "system", Value: 33554432, DataType: "number", Category: "performance", Description: strPtr("代理请求体字节上限，超出返回 413（0 为不限制，账号策略可单独设置）")},
+		{Key: "proxy.validate_json", Scope: "system", Value: true, DataType: "boolean", Category: "performance", Description: strPtr("转发前校验 JSON 请求体格式，格式错误直接返回 400")},
+		{Key: "stream.validate", Scope: "system", Value: false, DataType: "boolean", Category: "monitor", Description: strPtr("校验上游 SSE 分帧与结束事件，并按节点统计异常流")},
+		{Key: "stream.repair", Scope: "system", Value: true, DataType: "boolean", Category: "monitor", Description: strPtr("校验开启时补齐流末尾缺失的换行")},
+		{Key: "proxy.first_byte_recheck", Scope: "system", Value: true, DataType: "boolean", Category: "health", Description: strPtr("首字节超时后立即对节点发起健康复检")},
 		{Key: "metrics.aggregate_interval", Scope: "system", Value: "1h", DataType: "duration", Category: "performance", Description: strPtr("指标聚合间隔")},
 		{Key: "metrics.cleanup_interval", Scope: "system", Value: "24h", DataType: "duration", Category: "performance", Description: strPtr("数据清理间隔")},
+		{Key: "benchmark.scheduler.enabled", Scope: "system", Value: true, DataType: "boolean", Category: "monitor", Description: strPtr("是否执行节点定时压测")},
+		{Key: "benchmark.regression_threshold_pct", Scope: "system", Value: 30, DataType: "number", Category: "monitor", Description: strPtr("压测 p95 周环比退化告警阈值（百分比）")},
+		{Key: "routing.affinity.enabled", Scope: "system", Value: true, DataType: "boolean", Category: "performance", Description: strPtr("按 X-QCC-Conversation 将同一会话路由到同一节点")},
+		{Key: "routing.affinity.ttl_sec", Scope: "system", Value: 1800, DataType: "number", Category: "performance", Description: strPtr("会话亲和绑定的空闲过期时间（秒）")},
+		{Key: "routing.affinity.max_entries", Scope: "system", Value: 10000, DataType: "number", Category: "performance", Description: strPtr("会话亲和缓存的最大条目数")},
+		{Key: "routing.hedge.enabled", Scope: "system", Value: false, DataType: "boolean", Category: "performance", Description: strPtr("首字节超时后向备用节点发起对冲请求")},
+		{Key: "routing.hedge.threshold_ms", Scope: "system", Value: 2000, DataType: "number", Category: "performance", Description: strPtr("发起对冲前等待主节点响应的时间（毫秒）")},
+		{Key: "routing.hedge.budget_pct", Scope: "system", Value: 10, DataType: "number", Category: "performance", Description: strPtr("对冲请求占总请求的最大比例（百分比）")},
+		{Key: "routing.warmup.window_sec", Scope: "system", Value: 300, DataType: "number", Category: "performance", Description: strPtr("节点从故障恢复后的预热放量窗口（秒，0 为关闭）")},
+		{Key: "routing.warmup.initial_pct", Scope: "system", Value: 10, DataType: "number", Category: "performance", Description: strPtr("预热开始时承接的流量比例（百分比）")},
+		{Key: "metrics.flush_interval_sec", Scope: "system", Value: 10, DataType: "number", Category: "performance", Description: strPtr("请求指标批量写入间隔（秒，0 为逐请求写入）")},
+		{Key: "metrics.rollup.max_models", Scope: "system", Value: 50, DataType: "number", Category: "performance", Description: strPtr("多维汇总中每账号模型数上限")},
+		{Key: "metrics.rollup.max_labels", Scope: "system", Value: 100, DataType: "number", Category: "performance", Description: strPtr("多维汇总中每账号标签数上限")},
+		{Key: "metrics.rollup.max_keys", Scope: "system", Value: 100, DataType: "number", Category: "performance", Description: strPtr("多维汇总中每账号密钥数上限")},
+		{Key: "routing.adaptive_weight.enabled", Scope: "system", Value: false, DataType: "boolean", Category: "performance", Description: strPtr("按延迟与错误率自动调整节点权重")},
+		{Key: "routing.adaptive_weight.interval_sec", Scope: "system", Value: 60, DataType: "number", Category: "performance", Description: strPtr("自适应权重调整间隔（秒）")},
+		{Key: "routing.adaptive_weight.min", Scope: "system", Value: 1, DataType: "number", Category: "performance", Description: strPtr("自适应权重下限")},
+		{Key: "routing.adaptive_weight.max", Scope: "system", Value: 10, DataType: "number", Category: "performance", Description: strPtr("自适应权重上限")},
+		{Key: "request_log.sample.error_pct", Scope: "system", Value: 100, DataType: "number", Category: "monitor", Description: strPtr("失败请求写入请求日志的比例（百分比）")},
+		{Key: "request_log.sample.success_pct", Scope: "system", Value: 100, DataType: "number", Category: "monitor", Description: strPtr("成功请求写入请求日志的比例（百分比）")},
+		{Key: "request_log.sample.slow_ms", Scope: "system", Value: 0, DataType: "number", Category: "monitor", Description: strPtr("耗时超过该值的请求总是记录（毫秒，0 为关闭）")},
+		{Key: "storage.account_limit", Scope: "system", Value: map[string]int64{"max_rows": 0, "max_mb": 0}, DataType: "object", Category: "performance", Description: strPtr("账号存储上限默认值（行数/MB，0 为不限制），超限时自动收紧保留时长")},
+		{Key: "retention.policy", Scope: "system", Value: map[string]int{"raw_metrics": 7, "hourly_metrics": 30, "daily_metrics": 365, "health_checks": 30, "request_logs": 0, "audit_logs": 0}, DataType: "object", Category: "performance", Description: strPtr("数据保留天数（0 为不自动清理），可按账号覆盖")},
+		{Key: "retention.dry_run", Scope: "system", Value: false, DataType: "boolean", Category: "performance", Description: strPtr("定时清理只统计将删除的行数，不实际删除")},
+		{Key: "metrics.consistency_self_heal", Scope: "system", Value: false, DataType: "boolean", Category: "performance", Description: strPtr("聚合一致性检查发现不一致的桶时自动重新聚合，关闭时只记录日志")},
+		{Key: "ws.max_conns_per_account", Scope: "system", Value: 50, DataType: "number", Category: "performance", Description: strPtr("单账号 WebSocket 最大连接数（0 为不限制）")},
+		{Key: "ws.max_conns_per_share", Scope: "system", Value: 20, DataType: "number", Category: "performance", Description: strPtr("单个分享链接 WebSocket 最大连接数（0 为不限制）")},
+		{Key: "access_log.enabled", Scope: "system", Value: false, DataType: "boolean", Category: "monitor", Description: strPtr("记录 HTTP 访问日志（覆盖管理 API 与代理请求）")},
+		{Key: "access_log.format", Scope: "system", Value: "combined", DataType: "string", Category: "monitor", Description: strPtr("访问日志格式：common 或 combined")},
+		{Key: "access_log.output", Scope: "system", Value: "stdout", DataType: "string", Category: "monitor", Description: strPtr("访问日志输出：stdout 或文件路径")},
+		{Key: "access_log.max_size_mb", Scope: "system", Value: 100, DataType: "number", Category: "monitor", Description: strPtr("访问日志文件滚动大小（MB，0 为不滚动）")},
+		{Key: "access_log.max_backups", Scope: "system", Value: 5, DataType: "number", Category: "monitor", Description: strPtr("访问日志保留的历史文件数")},
+		{Key: "access_log.max_age_days", Scope: "system", Value: 30, DataType: "number", Category: "monitor", Description: strPtr("访问日志历史文件保留天数（0 为不按时间清理）")},
+		{Key: "access_log.rotate_hours", Scope: "system", Value: 24, DataType: "number", Category: "monitor", Description: strPtr("访问日志按时间滚动的间隔（小时，0 为仅按大小滚动）")},
+		{Key: "access_log.compress", Scope: "system", Value: true, DataType: "boolean", Category: "monitor", Description: strPtr("滚动后的访问日志以 gzip 压缩保存")},
+		{Key: "update.check_enabled", Scope: "system", Value: true, DataType: "boolean", Category: "monitor", Description: strPtr("定期检查新版本并提醒管理员（关闭后不访问发布源）")},
+		{Key: "update.check_interval_hours", Scope: "system", Value: 24, DataType: "number", Category: "monitor", Description: strPtr("新版本检查间隔（小时）")},
+		{Key: "update.feed_url", Scope: "system", Value: "", DataType: "string", Category: "monitor", Description: strPtr("发布源地址，留空使用 GitHub Releases")},
+		{Key: "upstream_status.enabled", Scope: "system", Value: false, DataType: "boolean", Category: "monitor", Description: strPtr("定期拉取上游服务商状态页，标注受服务商故障影响的节点")},
+		{Key: "upstream_status.poll_interval_sec", Scope: "system", Value: 120, DataType: "number", Category: "monitor", Description: strPtr("上游状态页拉取间隔（秒）")},
+		{Key: "upstream_status.providers", Scope: "system", Value: map[string]map[string]interface{}{"anthropic": {"hosts": []string{"api.anthropic.com"}, "feed_url": "https://status.anthropic.com/api/v2/incidents/unresolved.json"}, "openai": {"hosts": []string{"api.openai.com"}, "feed_url": "https://status.openai.com/api/v2/incidents/unresolved.json"}}, DataType: "object", Category: "monitor", Description: strPtr("上游服务商：按节点地址主机名匹配，feed_url 支持 Statuspage incidents JSON 或 RSS")},
+		{Key: "upstream_status.webhook_token", Scope: "system", Value: "", DataType: "string", Category: "monitor", Description: strPtr("状态页 Webhook 接收令牌（/api/upstream-status/webhook/{provider}?token=，留空关闭）"), IsSecret: true},
+		{Key: "db.max_open_conns", Scope: "system", Value: 50, DataType: "number", Category: "performance", Description: strPtr("数据库最大连接数（0 为不限制）")},
+		{Key: "db.max_idle_conns", Scope: "system", Value: 25, DataType: "number", Category: "performance", Description: strPtr("数据库最大空闲连接数")},
+		{Key: "db.conn_max_lifetime_sec", Scope: "system", Value: 1800, DataType: "number", Category: "performance", Description: strPtr("数据库连接最长存活时间（秒，0 为不过期）")},
+		{Key: "db.timeout.read_ms", Scope: "system", Value: 5000, DataType: "number", Category: "performance", Description: strPtr("存储层查询超时（毫秒）")},
+		{Key: "db.timeout.write_ms", Scope: "system", Value: 5000, DataType: "number", Category: "performance", Description: strPtr("存储层写入超时（毫秒）")},
+		{Key: "db.timeout.aggregate_ms", Scope: "system", Value: 60000, DataType: "number", Category: "performance", Description: strPtr("指标聚合与用量统计超时（毫秒）")},
+		{Key: "db.timeout.cleanup_ms", Scope: "system", Value: 120000, DataType: "number", Category: "performance", Description: strPtr("数据清理超时（毫秒）")},
+		{Key: "quota.warn_thresholds", Scope: "system", Value: []int{80, 95}, DataType: "array", Category: "performance", Description: strPtr("账号 token 配额预警阈值（百分比），越过时发送通知与 WS quota_warning 事件，可按账号策略覆盖")},
+		{Key: "api.disabled_modules", Scope: "system", Value: []string{}, DataType: "array", Category: "security", Description: strPtr("停用的 API 模块（shares、status_page、ws、request_logs、benchmarks 等），停用后相关路由返回 404/503")},
 	}
 
 	for _, d := range defaults {
@@ -64,17 +145,23 @@ func (s *Store) SeedDefaultSettings() error {
 		if category == "" {
 			category = "general"
 		}
-		if _, err := s.db.ExecContext(ctx, "INSERT IGNORE INTO settings (`key`, scope, account_id, value, data_type, category, description, is_secret, version) VALUES (?,?,?,?,?,?,?,?,1)",
-			d.Key, d.Scope, nil, body, dataType, category, nullOrStringPtr(d.Description), d.IsSecret); err != nil {
+		res, err := s.db.ExecContext(ctx, "INSERT IGNORE INTO settings (`key`, scope, account_id, value, data_type, category, description, is_secret, version) VALUES (?,?,?,?,?,?,?,?,1)",
+			d.Key, d.Scope, nil, body, dataType, category, nullOrStringPtr(d.Description), d.IsSecret)
+		if err != nil {
 			return err
 		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			if err := recordSettingUpsert(ctx, s.db, d.Key, d.Scope, nil); err != nil {
+				return err
+			}
+		}
 	}
 	return nil
 }
 
 // ListSettings 获取配置列表，支持 scope/category/account_id 过滤。
 func (s *Store) ListSettings(scope, category, accountID string) ([]Setting, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	ctx, cancel := s.withTimeout(context.Background(), opRead)
 	defer cancel()
 
 	var (
@@ -120,7 +207,7 @@ func (s *Store) GetSetting(key, scope, accountID string) (*Setting, error) {
 		return nil, errors.New("key required")
 	}
 	scope = normalizeScope(scope)
-	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	ctx, cancel := s.withTimeout(context.Background(), opRead)
 	defer cancel()
 
 	row := s.db.QueryRowContext(ctx, "SELECT id,`key`,scope,account_id,value,data_type,category,description,is_secret,version,updated_by,updated_at,created_at FROM settings WHERE `key`=? AND scope=? AND account_id <=> ? LIMIT 1",
@@ -142,7 +229,7 @@ func (s *Store) UpsertSetting(setting *Setting) error {
 		return fmt.Errorf("marshal setting value: %w", err)
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	ctx, cancel := s.withTimeout(context.Background(), opWrite)
 	defer cancel()
 	_, err = s.db.ExecContext(ctx, "INSERT INTO settings (`key`, scope, account_id, value, data_type, category, description, is_secret, version, updated_by) "+
 		"VALUES (?,?,?,?,?,?,?,?,1,?) "+
@@ -151,6 +238,9 @@ func (s *Store) UpsertSetting(setting *Setting) error {
 	if err != nil {
 		return err
 	}
+	if err := recordSettingUpsert(ctx, s.db, setting.Key, setting.Scope, accountArgPtr(setting.AccountID)); err != nil {
+		return err
+	}
 	updated, err := s.GetSetting(setting.Key, setting.Scope, deref(setting.AccountID))
 	if err == nil && updated != nil {
 		setting.Version = updated.Version
@@ -177,7 +267,7 @@ func (s *Store) UpdateSetting(setting *Setting) error {
 		return fmt.Errorf("marshal setting value: %w", err)
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	ctx, cancel := s.withTimeout(context.Background(), opWrite)
 	defer cancel()
 	res, err := s.db.ExecContext(ctx, "UPDATE settings SET value=?, data_type=?, category=?, description=?, is_secret=?, updated_by=?, version=version+1 "+
 		"WHERE `key`=? AND scope=? AND account_id <=> ? AND version=?",
@@ -197,6 +287,9 @@ func (s *Store) UpdateSetting(setting *Setting) error {
 		}
 		return ErrVersionConflict
 	}
+	if err := recordSettingUpsert(ctx, s.db, setting.Key, setting.Scope, accountArgPtr(setting.AccountID)); err != nil {
+		return err
+	}
 	updated, err := s.GetSetting(setting.Key, setting.Scope, deref(setting.AccountID))
 	if err == nil && updated != nil {
 		setting.Version = updated.Version
@@ -208,11 +301,16 @@ func (s *Store) UpdateSetting(setting *Setting) error {
 
 // DeleteSetting 删除配置。
 func (s *Store) DeleteSetting(key, scope, accountID string) error {
+	return s.DeleteSettingBy(key, scope, accountID, "")
+}
+
+// DeleteSettingBy 删除配置并在变更日志中记录操作人。
+func (s *Store) DeleteSettingBy(key, scope, accountID, actor string) error {
 	if key == "" {
 		return errors.New("key required")
 	}
 	scope = normalizeScope(scope)
-	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	ctx, cancel := s.withTimeout(context.Background(), opWrite)
 	defer cancel()
 	res, err := s.db.ExecContext(ctx, "DELETE FROM settings WHERE `key`=? AND scope=? AND account_id <=> ?", key, scope, accountArg(accountID))
 	if err != nil {
@@ -221,7 +319,7 @@ func (s *Store) DeleteSetting(key, scope, accountID string) error {
 	if rows, _ := res.RowsAffected(); rows == 0 {
 		return ErrNotFound
 	}
-	return nil
+	return recordSettingDelete(ctx, s.db, key, scope, accountArg(accountID), actor)
 }
 
 // BatchUpdateSettings 批量更新（事务）。
@@ -229,7 +327,7 @@ func (s *Store) BatchUpdateSettings(settings []Setting) error {
 	if len(settings) == 0 {
 		return nil
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	ctx, cancel := s.withTimeout(context.Background(), opWrite)
 	defer cancel()
 	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
@@ -273,6 +371,10 @@ func (s *Store) BatchUpdateSettings(settings []Setting) error {
 				return err
 			}
 		}
+		if err := recordSettingUpsert(ctx, tx, settings[i].Key, settings[i].Scope, accountArgPtr(settings[i].AccountID)); err != nil {
+			tx.Rollback()
+			return err
+		}
 	}
 	if err := tx.Commit(); err != nil {
 		return err
@@ -280,12 +382,12 @@ func (s *Store) BatchUpdateSettings(settings []Setting) error {
 	return nil
 }
 
-// GetGlobalVersion 返回全局最大版本号。
+// GetGlobalVersion 返回全局版本号：配置变更日志的最新序号，任何增删改都会使其递增。
 func (s *Store) GetGlobalVersion() (int64, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	ctx, cancel := s.withTimeout(context.Background(), opRead)
 	defer cancel()
 	var version sql.NullInt64
-	err := s.db.QueryRowContext(ctx, `SELECT MAX(version) FROM settings`).Scan(&version)
+	err := s.db.QueryRowContext(ctx, `SELECT MAX(seq) FROM settings_changes`).Scan(&version)
 	if err != nil {
 		return 0, err
 	}
@@ -295,6 +397,26 @@ func (s *Store) GetGlobalVersion() (int64, error) {
 	return version.Int64, nil
 }
 
+// GetSettingsStamp 返回由版本号总和、行数与最后更新时间组成的版本戳，任何增删改都会改变该值。
+func (s *Store) GetSettingsStamp() (string, error) {
+	ctx, cancel := s.withTimeout(context.Background(), opRead)
+	defer cancel()
+	var (
+		version int64
+		count   int64
+		updated sql.NullTime
+	)
+	err := s.db.QueryRowContext(ctx, `SELECT COALESCE(SUM(version), 0), COUNT(*), MAX(updated_at) FROM settings`).Scan(&version, &count, &updated)
+	if err != nil {
+		return "", err
+	}
+	stamp := fmt.Sprintf("%d-%d", version, count)
+	if updated.Valid {
+		stamp = fmt.Sprintf("%s-%d", stamp, updated.Time.UnixNano())
+	}
+	return stamp, nil
+}
+
 // ---- helpers ----
 
 type rowScanner interface {
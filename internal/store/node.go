@@ -3,6 +3,8 @@ package store
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"strings"
 	"time"
 )
 
@@ -14,15 +16,29 @@ func (s *Store) UpsertNode(ctx context.Context, r NodeRecord) error {
 	if r.CreatedAt.IsZero() {
 		r.CreatedAt = time.Now()
 	}
-	ctx, cancel := withTimeout(ctx)
+	ctx, cancel := s.withTimeout(ctx, opWrite)
 	defer cancel()
 	healthAt := sql.NullTime{}
 	if !r.LastHealthCheckAt.IsZero() {
 		healthAt.Valid = true
 		healthAt.Time = r.LastHealthCheckAt
 	}
-	_, err := s.db.ExecContext(ctx, `INSERT INTO nodes (id,name,base_url,api_key,health_check_method,account_id,weight,failed,disabled,last_error,created_at,requests,fail_count,fail_streak,total_bytes,total_input,total_output,stream_dur_ms,first_byte_ms,last_ping_ms,last_ping_err,last_health_check_at)
-		VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)
+	stateAt := sql.NullTime{}
+	if !r.StateChangedAt.IsZero() {
+		stateAt.Valid = true
+		stateAt.Time = r.StateChangedAt
+	}
+	headers := sql.NullString{}
+	if len(r.Headers) > 0 {
+		b, err := json.Marshal(r.Headers)
+		if err != nil {
+			return err
+		}
+		headers.Valid = true
+		headers.String = string(b)
+	}
+	_, err := s.db.ExecContext(ctx, `INSERT INTO nodes (id,name,base_url,api_key,health_check_method,account_id,weight,failed,disabled,last_error,created_at,requests,fail_count,fail_streak,total_bytes,total_input,total_output,stream_dur_ms,first_byte_ms,last_ping_ms,last_ping_err,last_health_check_at,state,state_changed_at,headers,health_interval_sec)
+		VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)
 		ON DUPLICATE KEY UPDATE
 			name=VALUES(name),
 			base_url=VALUES(base_url),
@@ -43,40 +59,86 @@ func (s *Store) UpsertNode(ctx context.Context, r NodeRecord) error {
 			first_byte_ms=VALUES(first_byte_ms),
 			last_ping_ms=VALUES(last_ping_ms),
 			last_ping_err=VALUES(last_ping_err),
-			last_health_check_at=VALUES(last_health_check_at)`,
-		r.ID, r.Name, r.BaseURL, r.APIKey, r.HealthCheckMethod, r.AccountID, r.Weight, r.Failed, r.Disabled, r.LastError, r.CreatedAt, r.Requests, r.FailCount, r.FailStreak, r.TotalBytes, r.TotalInput, r.TotalOutput, r.StreamDurMs, r.FirstByteMs, r.LastPingMs, r.LastPingErr, healthAt)
+			last_health_check_at=VALUES(last_health_check_at),
+			state=VALUES(state),
+			state_changed_at=VALUES(state_changed_at),
+			headers=VALUES(headers),
+			health_interval_sec=VALUES(health_interval_sec)`,
+		r.ID, r.Name, r.BaseURL, r.APIKey, r.HealthCheckMethod, r.AccountID, r.Weight, r.Failed, r.Disabled, r.LastError, r.CreatedAt, r.Requests, r.FailCount, r.FailStreak, r.TotalBytes, r.TotalInput, r.TotalOutput, r.StreamDurMs, r.FirstByteMs, r.LastPingMs, r.LastPingErr, healthAt, r.State, stateAt, headers, r.HealthIntervalSec)
 	return err
 }
 
+// nodeColumns 为节点查询的统一列顺序，需与 scanNodeRecord 保持一致。
+const nodeColumns = `id,name,base_url,api_key,health_check_method,account_id,weight,failed,disabled,last_error,created_at,requests,fail_count,fail_streak,total_bytes,total_input,total_output,stream_dur_ms,first_byte_ms,last_ping_ms,last_ping_err,last_health_check_at,state,state_changed_at,headers,health_interval_sec`
+
+func scanNodeRecord(scanner rowScanner) (NodeRecord, error) {
+	var r NodeRecord
+	var lastHealthAt, stateAt sql.NullTime
+	var headers sql.NullString
+	if err := scanner.Scan(&r.ID, &r.Name, &r.BaseURL, &r.APIKey, &r.HealthCheckMethod, &r.AccountID, &r.Weight, &r.Failed, &r.Disabled, &r.LastError, &r.CreatedAt, &r.Requests, &r.FailCount, &r.FailStreak, &r.TotalBytes, &r.TotalInput, &r.TotalOutput, &r.StreamDurMs, &r.FirstByteMs, &r.LastPingMs, &r.LastPingErr, &lastHealthAt, &r.State, &stateAt, &headers, &r.HealthIntervalSec); err != nil {
+		return r, err
+	}
+	if headers.Valid && headers.String != "" {
+		_ = json.Unmarshal([]byte(headers.String), &r.Headers)
+	}
+	if r.HealthCheckMethod == "" {
+		r.HealthCheckMethod = "api"
+	}
+	if lastHealthAt.Valid {
+		r.LastHealthCheckAt = lastHealthAt.Time
+	}
+	if stateAt.Valid {
+		r.StateChangedAt = stateAt.Time
+	}
+	return r, nil
+}
+
 func (s *Store) GetNodesByAccount(ctx context.Context, accountID string) ([]NodeRecord, error) {
 	accountID = normalizeAccount(accountID)
-	ctx, cancel := withTimeout(ctx)
+	ctx, cancel := s.withTimeout(ctx, opRead)
 	defer cancel()
-	rows, err := s.db.QueryContext(ctx, `SELECT id,name,base_url,api_key,health_check_method,account_id,weight,failed,disabled,last_error,created_at,requests,fail_count,fail_streak,total_bytes,total_input,total_output,stream_dur_ms,first_byte_ms,last_ping_ms,last_ping_err,last_health_check_at FROM nodes WHERE account_id=? ORDER BY weight ASC, created_at ASC`, accountID)
+	rows, err := s.queryCached(ctx, `SELECT `+nodeColumns+` FROM nodes WHERE account_id=? ORDER BY weight ASC, created_at ASC`, accountID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 	var records []NodeRecord
 	for rows.Next() {
-		var r NodeRecord
-		var lastHealthAt sql.NullTime
-		if err := rows.Scan(&r.ID, &r.Name, &r.BaseURL, &r.APIKey, &r.HealthCheckMethod, &r.AccountID, &r.Weight, &r.Failed, &r.Disabled, &r.LastError, &r.CreatedAt, &r.Requests, &r.FailCount, &r.FailStreak, &r.TotalBytes, &r.TotalInput, &r.TotalOutput, &r.StreamDurMs, &r.FirstByteMs, &r.LastPingMs, &r.LastPingErr, &lastHealthAt); err != nil {
+		r, err := scanNodeRecord(rows)
+		if err != nil {
 			return nil, err
 		}
-		if r.HealthCheckMethod == "" {
-			r.HealthCheckMethod = "api"
-		}
-		if lastHealthAt.Valid {
-			r.LastHealthCheckAt = lastHealthAt.Time
-		}
 		records = append(records, r)
 	}
 	return records, nil
 }
 
+// UpdateNodeOrders 按 ids 顺序将节点权重依次设为 1..n，以单条 CASE 语句完成，仅更新属于该账号的节点。
+func (s *Store) UpdateNodeOrders(ctx context.Context, accountID string, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	accountID = normalizeAccount(accountID)
+	var b strings.Builder
+	args := make([]interface{}, 0, len(ids)*3+1)
+	b.WriteString(`UPDATE nodes SET weight = CASE id`)
+	for i, id := range ids {
+		b.WriteString(` WHEN ? THEN ?`)
+		args = append(args, id, i+1)
+	}
+	b.WriteString(` ELSE weight END WHERE account_id=? AND id IN (?` + strings.Repeat(`,?`, len(ids)-1) + `)`)
+	args = append(args, accountID)
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	ctx, cancel := s.withTimeout(ctx, opWrite)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, b.String(), args...)
+	return err
+}
+
 func (s *Store) DeleteNode(ctx context.Context, id string) error {
-	ctx, cancel := withTimeout(ctx)
+	ctx, cancel := s.withTimeout(ctx, opWrite)
 	defer cancel()
 	_, err := s.db.ExecContext(ctx, `DELETE FROM nodes WHERE id=?`, id)
 	return err
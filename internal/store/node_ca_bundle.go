@@ -0,0 +1,85 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// NodeCABundleRecord 节点信任的自定义 CA 证书（PEM），替代系统根证书校验上游证书。
+type NodeCABundleRecord struct {
+	NodeID      string
+	AccountID   string
+	PEM         string
+	Subjects    string // 证书主题，以换行分隔
+	Fingerprint string
+	NotAfter    time.Time // 最早到期的证书
+	UpdatedBy   string
+	UpdatedAt   time.Time
+}
+
+func (s *Store) ensureNodeCABundleTable(ctx context.Context) error {
+	ctx, cancel := s.withTimeout(ctx, opWrite)
+	defer cancel()
+	stmt := `CREATE TABLE IF NOT EXISTS node_ca_bundles (
+		node_id VARCHAR(64) PRIMARY KEY,
+		account_id VARCHAR(64) NOT NULL,
+		pem MEDIUMTEXT NOT NULL,
+		subjects TEXT,
+		fingerprint VARCHAR(64) NOT NULL DEFAULT '',
+		not_after DATETIME NOT NULL,
+		updated_by VARCHAR(128) NOT NULL DEFAULT '',
+		updated_at DATETIME(3) NOT NULL,
+		INDEX idx_node_ca_bundles_account (account_id)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`
+	_, err := s.db.ExecContext(ctx, stmt)
+	return err
+}
+
+// SaveNodeCABundle 新建或替换节点的 CA 证书。
+func (s *Store) SaveNodeCABundle(ctx context.Context, rec NodeCABundleRecord) error {
+	if rec.NodeID == "" || rec.PEM == "" {
+		return errors.New("node_id and pem required")
+	}
+	rec.AccountID = normalizeAccount(rec.AccountID)
+	if rec.UpdatedAt.IsZero() {
+		rec.UpdatedAt = time.Now().UTC()
+	}
+	ctx, cancel := s.withTimeout(ctx, opWrite)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, `INSERT INTO node_ca_bundles (node_id,account_id,pem,subjects,fingerprint,not_after,updated_by,updated_at)
+		VALUES (?,?,?,?,?,?,?,?)
+		ON DUPLICATE KEY UPDATE account_id=VALUES(account_id), pem=VALUES(pem), subjects=VALUES(subjects), fingerprint=VALUES(fingerprint),
+			not_after=VALUES(not_after), updated_by=VALUES(updated_by), updated_at=VALUES(updated_at)`,
+		rec.NodeID, rec.AccountID, rec.PEM, rec.Subjects, rec.Fingerprint, rec.NotAfter.UTC(), rec.UpdatedBy, rec.UpdatedAt.UTC())
+	return err
+}
+
+// ListNodeCABundles 返回账号下所有节点的 CA 证书。
+func (s *Store) ListNodeCABundles(ctx context.Context, accountID string) ([]NodeCABundleRecord, error) {
+	ctx, cancel := s.withTimeout(ctx, opRead)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, `SELECT node_id,account_id,pem,COALESCE(subjects,''),fingerprint,not_after,updated_by,updated_at
+		FROM node_ca_bundles WHERE account_id=?`, normalizeAccount(accountID))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []NodeCABundleRecord
+	for rows.Next() {
+		var rec NodeCABundleRecord
+		if err := rows.Scan(&rec.NodeID, &rec.AccountID, &rec.PEM, &rec.Subjects, &rec.Fingerprint, &rec.NotAfter, &rec.UpdatedBy, &rec.UpdatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, rec)
+	}
+	return out, rows.Err()
+}
+
+// DeleteNodeCABundle 删除节点的 CA 证书，不存在时不报错。
+func (s *Store) DeleteNodeCABundle(ctx context.Context, nodeID string) error {
+	ctx, cancel := s.withTimeout(ctx, opWrite)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, `DELETE FROM node_ca_bundles WHERE node_id=?`, nodeID)
+	return err
+}
@@ -0,0 +1,87 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// NodeClientCertRecord 节点的 mTLS 客户端证书；Bundle 为加密后的证书与私钥 PEM，其余字段用于展示与到期检查。
+type NodeClientCertRecord struct {
+	NodeID      string
+	AccountID   string
+	Bundle      string
+	Subject     string
+	Issuer      string
+	Fingerprint string
+	NotAfter    time.Time
+	UpdatedBy   string
+	UpdatedAt   time.Time
+}
+
+func (s *Store) ensureNodeClientCertTable(ctx context.Context) error {
+	ctx, cancel := s.withTimeout(ctx, opWrite)
+	defer cancel()
+	stmt := `CREATE TABLE IF NOT EXISTS node_client_certs (
+		node_id VARCHAR(64) PRIMARY KEY,
+		account_id VARCHAR(64) NOT NULL,
+		bundle MEDIUMTEXT NOT NULL,
+		subject VARCHAR(512) NOT NULL DEFAULT '',
+		issuer VARCHAR(512) NOT NULL DEFAULT '',
+		fingerprint VARCHAR(64) NOT NULL DEFAULT '',
+		not_after DATETIME NOT NULL,
+		updated_by VARCHAR(128) NOT NULL DEFAULT '',
+		updated_at DATETIME(3) NOT NULL,
+		INDEX idx_node_client_certs_account (account_id)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`
+	_, err := s.db.ExecContext(ctx, stmt)
+	return err
+}
+
+// SaveNodeClientCert 新建或替换节点的客户端证书。
+func (s *Store) SaveNodeClientCert(ctx context.Context, rec NodeClientCertRecord) error {
+	if rec.NodeID == "" || rec.Bundle == "" {
+		return errors.New("node_id and bundle required")
+	}
+	rec.AccountID = normalizeAccount(rec.AccountID)
+	if rec.UpdatedAt.IsZero() {
+		rec.UpdatedAt = time.Now().UTC()
+	}
+	ctx, cancel := s.withTimeout(ctx, opWrite)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, `INSERT INTO node_client_certs (node_id,account_id,bundle,subject,issuer,fingerprint,not_after,updated_by,updated_at)
+		VALUES (?,?,?,?,?,?,?,?,?)
+		ON DUPLICATE KEY UPDATE account_id=VALUES(account_id), bundle=VALUES(bundle), subject=VALUES(subject), issuer=VALUES(issuer),
+			fingerprint=VALUES(fingerprint), not_after=VALUES(not_after), updated_by=VALUES(updated_by), updated_at=VALUES(updated_at)`,
+		rec.NodeID, rec.AccountID, rec.Bundle, rec.Subject, rec.Issuer, rec.Fingerprint, rec.NotAfter.UTC(), rec.UpdatedBy, rec.UpdatedAt.UTC())
+	return err
+}
+
+// ListNodeClientCerts 返回账号下所有节点的客户端证书。
+func (s *Store) ListNodeClientCerts(ctx context.Context, accountID string) ([]NodeClientCertRecord, error) {
+	ctx, cancel := s.withTimeout(ctx, opRead)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, `SELECT node_id,account_id,bundle,subject,issuer,fingerprint,not_after,updated_by,updated_at
+		FROM node_client_certs WHERE account_id=?`, normalizeAccount(accountID))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []NodeClientCertRecord
+	for rows.Next() {
+		var rec NodeClientCertRecord
+		if err := rows.Scan(&rec.NodeID, &rec.AccountID, &rec.Bundle, &rec.Subject, &rec.Issuer, &rec.Fingerprint, &rec.NotAfter, &rec.UpdatedBy, &rec.UpdatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, rec)
+	}
+	return out, rows.Err()
+}
+
+// DeleteNodeClientCert 删除节点的客户端证书，不存在时不报错。
+func (s *Store) DeleteNodeClientCert(ctx context.Context, nodeID string) error {
+	ctx, cancel := s.withTimeout(ctx, opWrite)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, `DELETE FROM node_client_certs WHERE node_id=?`, nodeID)
+	return err
+}
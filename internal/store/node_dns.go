@@ -0,0 +1,105 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// NodeDNSRecord 节点的域名解析与拨号配置：固定 IP 优先，其次使用指定的 DNS 服务器；拨号字段为空或 0 时沿用部署配置。
+type NodeDNSRecord struct {
+	NodeID          string
+	AccountID       string
+	StaticIPs       string // 固定 IP，以逗号分隔
+	Resolver        string // DNS 服务器地址（ip:port）
+	IPFamily        string
+	FallbackDelayMs int
+	DialTimeoutMs   int
+	UpdatedBy       string
+	UpdatedAt       time.Time
+}
+
+func (s *Store) ensureNodeDNSTable(ctx context.Context) error {
+	ctx, cancel := s.withTimeout(ctx, opWrite)
+	defer cancel()
+	stmt := `CREATE TABLE IF NOT EXISTS node_dns_settings (
+		node_id VARCHAR(64) PRIMARY KEY,
+		account_id VARCHAR(64) NOT NULL,
+		static_ips VARCHAR(1024) NOT NULL DEFAULT '',
+		resolver VARCHAR(255) NOT NULL DEFAULT '',
+		ip_family VARCHAR(16) NOT NULL DEFAULT '',
+		fallback_delay_ms INT NOT NULL DEFAULT 0,
+		dial_timeout_ms INT NOT NULL DEFAULT 0,
+		updated_by VARCHAR(128) NOT NULL DEFAULT '',
+		updated_at DATETIME(3) NOT NULL,
+		INDEX idx_node_dns_settings_account (account_id)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`
+	if _, err := s.db.ExecContext(ctx, stmt); err != nil {
+		return err
+	}
+	for _, col := range []struct{ name, ddl string }{
+		{"ip_family", `ALTER TABLE node_dns_settings ADD COLUMN ip_family VARCHAR(16) NOT NULL DEFAULT '' AFTER resolver`},
+		{"fallback_delay_ms", `ALTER TABLE node_dns_settings ADD COLUMN fallback_delay_ms INT NOT NULL DEFAULT 0 AFTER ip_family`},
+		{"dial_timeout_ms", `ALTER TABLE node_dns_settings ADD COLUMN dial_timeout_ms INT NOT NULL DEFAULT 0 AFTER fallback_delay_ms`},
+	} {
+		exists, err := s.columnExists(ctx, "node_dns_settings", col.name)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			if _, err := s.db.ExecContext(ctx, col.ddl); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// SaveNodeDNS 新建或替换节点的解析配置。
+func (s *Store) SaveNodeDNS(ctx context.Context, rec NodeDNSRecord) error {
+	if rec.NodeID == "" {
+		return errors.New("node_id required")
+	}
+	rec.AccountID = normalizeAccount(rec.AccountID)
+	if rec.UpdatedAt.IsZero() {
+		rec.UpdatedAt = time.Now().UTC()
+	}
+	ctx, cancel := s.withTimeout(ctx, opWrite)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, `INSERT INTO node_dns_settings (node_id,account_id,static_ips,resolver,ip_family,fallback_delay_ms,dial_timeout_ms,updated_by,updated_at)
+		VALUES (?,?,?,?,?,?,?,?,?)
+		ON DUPLICATE KEY UPDATE account_id=VALUES(account_id), static_ips=VALUES(static_ips), resolver=VALUES(resolver),
+			ip_family=VALUES(ip_family), fallback_delay_ms=VALUES(fallback_delay_ms), dial_timeout_ms=VALUES(dial_timeout_ms),
+			updated_by=VALUES(updated_by), updated_at=VALUES(updated_at)`,
+		rec.NodeID, rec.AccountID, rec.StaticIPs, rec.Resolver, rec.IPFamily, rec.FallbackDelayMs, rec.DialTimeoutMs, rec.UpdatedBy, rec.UpdatedAt.UTC())
+	return err
+}
+
+// ListNodeDNS 返回账号下所有节点的解析配置。
+func (s *Store) ListNodeDNS(ctx context.Context, accountID string) ([]NodeDNSRecord, error) {
+	ctx, cancel := s.withTimeout(ctx, opRead)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, `SELECT node_id,account_id,static_ips,resolver,ip_family,fallback_delay_ms,dial_timeout_ms,updated_by,updated_at
+		FROM node_dns_settings WHERE account_id=?`, normalizeAccount(accountID))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []NodeDNSRecord
+	for rows.Next() {
+		var rec NodeDNSRecord
+		if err := rows.Scan(&rec.NodeID, &rec.AccountID, &rec.StaticIPs, &rec.Resolver, &rec.IPFamily, &rec.FallbackDelayMs, &rec.DialTimeoutMs, &rec.UpdatedBy, &rec.UpdatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, rec)
+	}
+	return out, rows.Err()
+}
+
+// DeleteNodeDNS 删除节点的解析配置，不存在时不报错。
+func (s *Store) DeleteNodeDNS(ctx context.Context, nodeID string) error {
+	ctx, cancel := s.withTimeout(ctx, opWrite)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, `DELETE FROM node_dns_settings WHERE node_id=?`, nodeID)
+	return err
+}
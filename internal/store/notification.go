@@ -19,11 +19,11 @@ func (s *Store) CreateNotificationChannel(ctx context.Context, rec NotificationC
 	if rec.UpdatedAt.IsZero() {
 		rec.UpdatedAt = now
 	}
-	ctx, cancel := withTimeout(ctx)
+	ctx, cancel := s.withTimeout(ctx, opWrite)
 	defer cancel()
-	_, err := s.db.ExecContext(ctx, `INSERT INTO notification_channels (id,account_id,channel_type,name,config,enabled,created_at,updated_at)
-		VALUES (?,?,?,?,?,?,?,?)`,
-		rec.ID, rec.AccountID, rec.ChannelType, rec.Name, rec.Config, rec.Enabled, rec.CreatedAt, rec.UpdatedAt)
+	_, err := s.db.ExecContext(ctx, `INSERT INTO notification_channels (id,account_id,channel_type,name,config,enabled,digest_mode,created_at,updated_at)
+		VALUES (?,?,?,?,?,?,?,?,?)`,
+		rec.ID, rec.AccountID, rec.ChannelType, rec.Name, rec.Config, rec.Enabled, chooseDigestMode(rec.DigestMode), rec.CreatedAt, rec.UpdatedAt)
 	return err
 }
 
@@ -33,10 +33,10 @@ func (s *Store) UpdateNotificationChannel(ctx context.Context, rec NotificationC
 		return errors.New("id required")
 	}
 	rec.UpdatedAt = time.Now()
-	ctx, cancel := withTimeout(ctx)
+	ctx, cancel := s.withTimeout(ctx, opWrite)
 	defer cancel()
-	res, err := s.db.ExecContext(ctx, `UPDATE notification_channels SET name=?, config=?, enabled=?, updated_at=?, channel_type=?, account_id=? WHERE id=?`,
-		rec.Name, rec.Config, rec.Enabled, rec.UpdatedAt, rec.ChannelType, rec.AccountID, rec.ID)
+	res, err := s.db.ExecContext(ctx, `UPDATE notification_channels SET name=?, config=?, enabled=?, digest_mode=?, updated_at=?, channel_type=?, account_id=? WHERE id=?`,
+		rec.Name, rec.Config, rec.Enabled, chooseDigestMode(rec.DigestMode), rec.UpdatedAt, rec.ChannelType, rec.AccountID, rec.ID)
 	if err != nil {
 		return err
 	}
@@ -51,11 +51,11 @@ func (s *Store) GetNotificationChannel(ctx context.Context, id string) (*Notific
 	if id == "" {
 		return nil, errors.New("id required")
 	}
-	ctx, cancel := withTimeout(ctx)
+	ctx, cancel := s.withTimeout(ctx, opRead)
 	defer cancel()
 	var rec NotificationChannelRecord
-	err := s.db.QueryRowContext(ctx, `SELECT id,account_id,channel_type,name,config,enabled,created_at,updated_at FROM notification_channels WHERE id=?`, id).
-		Scan(&rec.ID, &rec.AccountID, &rec.ChannelType, &rec.Name, &rec.Config, &rec.Enabled, &rec.CreatedAt, &rec.UpdatedAt)
+	err := s.db.QueryRowContext(ctx, `SELECT id,account_id,channel_type,name,config,enabled,digest_mode,created_at,updated_at FROM notification_channels WHERE id=?`, id).
+		Scan(&rec.ID, &rec.AccountID, &rec.ChannelType, &rec.Name, &rec.Config, &rec.Enabled, &rec.DigestMode, &rec.CreatedAt, &rec.UpdatedAt)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrNotFound
@@ -68,9 +68,9 @@ func (s *Store) GetNotificationChannel(ctx context.Context, id string) (*Notific
 // ListNotificationChannels 返回账号的所有渠道。
 func (s *Store) ListNotificationChannels(ctx context.Context, accountID string) ([]NotificationChannelRecord, error) {
 	accountID = normalizeAccount(accountID)
-	ctx, cancel := withTimeout(ctx)
+	ctx, cancel := s.withTimeout(ctx, opRead)
 	defer cancel()
-	rows, err := s.db.QueryContext(ctx, `SELECT id,account_id,channel_type,name,config,enabled,created_at,updated_at FROM notification_channels WHERE account_id=? ORDER BY created_at ASC`, accountID)
+	rows, err := s.db.QueryContext(ctx, `SELECT id,account_id,channel_type,name,config,enabled,digest_mode,created_at,updated_at FROM notification_channels WHERE account_id=? ORDER BY created_at ASC`, accountID)
 	if err != nil {
 		return nil, err
 	}
@@ -78,7 +78,7 @@ func (s *Store) ListNotificationChannels(ctx context.Context, accountID string)
 	var res []NotificationChannelRecord
 	for rows.Next() {
 		var rec NotificationChannelRecord
-		if err := rows.Scan(&rec.ID, &rec.AccountID, &rec.ChannelType, &rec.Name, &rec.Config, &rec.Enabled, &rec.CreatedAt, &rec.UpdatedAt); err != nil {
+		if err := rows.Scan(&rec.ID, &rec.AccountID, &rec.ChannelType, &rec.Name, &rec.Config, &rec.Enabled, &rec.DigestMode, &rec.CreatedAt, &rec.UpdatedAt); err != nil {
 			return nil, err
 		}
 		res = append(res, rec)
@@ -91,7 +91,7 @@ func (s *Store) GetNotificationSubscription(ctx context.Context, id string) (*No
 	if id == "" {
 		return nil, errors.New("id required")
 	}
-	ctx, cancel := withTimeout(ctx)
+	ctx, cancel := s.withTimeout(ctx, opRead)
 	defer cancel()
 	var rec NotificationSubscriptionRecord
 	err := s.db.QueryRowContext(ctx, `SELECT id,account_id,channel_id,event_type,enabled,created_at,updated_at FROM notification_subscriptions WHERE id=?`, id).
@@ -108,7 +108,7 @@ func (s *Store) GetNotificationSubscription(ctx context.Context, id string) (*No
 // ListNotificationSubscriptions 返回账号下的订阅列表，可选按 channel 过滤。
 func (s *Store) ListNotificationSubscriptions(ctx context.Context, accountID, channelID string) ([]NotificationSubscriptionRecord, error) {
 	accountID = normalizeAccount(accountID)
-	ctx, cancel := withTimeout(ctx)
+	ctx, cancel := s.withTimeout(ctx, opRead)
 	defer cancel()
 	query := `SELECT id,account_id,channel_id,event_type,enabled,created_at,updated_at FROM notification_subscriptions WHERE account_id=?`
 	args := []interface{}{accountID}
@@ -138,7 +138,7 @@ func (s *Store) DeleteNotificationSubscription(ctx context.Context, id string) e
 	if id == "" {
 		return errors.New("id required")
 	}
-	ctx, cancel := withTimeout(ctx)
+	ctx, cancel := s.withTimeout(ctx, opWrite)
 	defer cancel()
 	res, err := s.db.ExecContext(ctx, `DELETE FROM notification_subscriptions WHERE id=?`, id)
 	if err != nil {
@@ -155,7 +155,7 @@ func (s *Store) DeleteNotificationChannel(ctx context.Context, id string) error
 	if id == "" {
 		return errors.New("id required")
 	}
-	ctx, cancel := withTimeout(ctx)
+	ctx, cancel := s.withTimeout(ctx, opWrite)
 	defer cancel()
 	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
@@ -192,7 +192,7 @@ func (s *Store) UpsertNotificationSubscription(ctx context.Context, rec Notifica
 		rec.CreatedAt = now
 	}
 	rec.UpdatedAt = now
-	ctx, cancel := withTimeout(ctx)
+	ctx, cancel := s.withTimeout(ctx, opWrite)
 	defer cancel()
 	_, err := s.db.ExecContext(ctx, `INSERT INTO notification_subscriptions (id,account_id,channel_id,event_type,enabled,created_at,updated_at)
 		VALUES (?,?,?,?,?,?,?)
@@ -204,11 +204,11 @@ func (s *Store) UpsertNotificationSubscription(ctx context.Context, rec Notifica
 // ListEnabledSubscriptionsForEvent 返回账号对指定事件启用的订阅与渠道。
 func (s *Store) ListEnabledSubscriptionsForEvent(ctx context.Context, accountID, eventType string) ([]SubscriptionWithChannel, error) {
 	accountID = normalizeAccount(accountID)
-	ctx, cancel := withTimeout(ctx)
+	ctx, cancel := s.withTimeout(ctx, opRead)
 	defer cancel()
 	rows, err := s.db.QueryContext(ctx, `
 SELECT ns.id, ns.account_id, ns.channel_id, ns.event_type, ns.enabled, ns.created_at, ns.updated_at,
-       nc.id, nc.account_id, nc.channel_type, nc.name, nc.config, nc.enabled, nc.created_at, nc.updated_at
+       nc.id, nc.account_id, nc.channel_type, nc.name, nc.config, nc.enabled, nc.digest_mode, nc.created_at, nc.updated_at
 FROM notification_subscriptions ns
 JOIN notification_channels nc ON ns.channel_id = nc.id
 WHERE ns.account_id=? AND ns.event_type=? AND ns.enabled=TRUE AND nc.enabled=TRUE`, accountID, eventType)
@@ -222,7 +222,7 @@ WHERE ns.account_id=? AND ns.event_type=? AND ns.enabled=TRUE AND nc.enabled=TRU
 		var ch NotificationChannelRecord
 		if err := rows.Scan(
 			&sub.ID, &sub.AccountID, &sub.ChannelID, &sub.EventType, &sub.Enabled, &sub.CreatedAt, &sub.UpdatedAt,
-			&ch.ID, &ch.AccountID, &ch.ChannelType, &ch.Name, &ch.Config, &ch.Enabled, &ch.CreatedAt, &ch.UpdatedAt,
+			&ch.ID, &ch.AccountID, &ch.ChannelType, &ch.Name, &ch.Config, &ch.Enabled, &ch.DigestMode, &ch.CreatedAt, &ch.UpdatedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -243,7 +243,7 @@ func (s *Store) InsertNotificationHistory(ctx context.Context, rec NotificationH
 	if rec.CreatedAt.IsZero() {
 		rec.CreatedAt = now
 	}
-	ctx, cancel := withTimeout(ctx)
+	ctx, cancel := s.withTimeout(ctx, opWrite)
 	defer cancel()
 	_, err := s.db.ExecContext(ctx, `INSERT INTO notification_history
 		(id, account_id, channel_id, event_type, title, content, status, error, sent_at, created_at)
@@ -251,3 +251,11 @@ func (s *Store) InsertNotificationHistory(ctx context.Context, rec NotificationH
 		rec.ID, rec.AccountID, rec.ChannelID, rec.EventType, rec.Title, rec.Content, rec.Status, nullOrString(rec.Error), rec.SentAt, rec.CreatedAt)
 	return err
 }
+
+// chooseDigestMode 未设置摘要模式时按即时发送处理。
+func chooseDigestMode(mode string) string {
+	if mode == "" {
+		return DigestImmediate
+	}
+	return mode
+}
@@ -0,0 +1,41 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+)
+
+// PoolConfig 数据库连接池参数，0 表示不限制（ConnMaxLifetime 为 0 表示连接不过期）。
+type PoolConfig struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+}
+
+// DefaultPoolConfig 未配置时使用的连接池参数；database/sql 默认仅保留 2 个空闲连接，突发流量下会频繁建连。
+func DefaultPoolConfig() PoolConfig {
+	return PoolConfig{MaxOpenConns: 50, MaxIdleConns: 25, ConnMaxLifetime: 30 * time.Minute}
+}
+
+// ApplyPoolConfig 运行时调整连接池参数，空闲连接数不超过最大连接数；同时清空预编译语句缓存，
+// 使语句在新参数下的连接上重新预编译，避免缩容后旧连接上的服务端语句长期占用。
+func (s *Store) ApplyPoolConfig(cfg PoolConfig) {
+	if s == nil || s.db == nil {
+		return
+	}
+	if cfg.MaxOpenConns > 0 && cfg.MaxIdleConns > cfg.MaxOpenConns {
+		cfg.MaxIdleConns = cfg.MaxOpenConns
+	}
+	s.db.SetMaxOpenConns(cfg.MaxOpenConns)
+	s.db.SetMaxIdleConns(cfg.MaxIdleConns)
+	s.db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	s.resetStmtCache()
+}
+
+// PoolStats 返回连接池统计（使用中、空闲、等待次数与累计等待时长等）。
+func (s *Store) PoolStats() sql.DBStats {
+	if s == nil || s.db == nil {
+		return sql.DBStats{}
+	}
+	return s.db.Stats()
+}
@@ -0,0 +1,202 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// RequestLogRecord 单次代理请求的日志。
+type RequestLogRecord struct {
+	ID           int64
+	AccountID    string
+	NodeID       string
+	NodeName     string
+	Method       string
+	Path         string
+	Status       int
+	DurationMs   int64
+	InputTokens  int64
+	OutputTokens int64
+	NodeOverride string // 通过请求头强制指定的节点（为空表示正常路由）
+	RequestBody  string // 已脱敏的请求体（仅在账号开启记录时保存）
+	Label        string // 客户端标签（X-QCC-Label）
+	ErrorClass   string // 上游失败分类（成功为空）
+	Model        string
+	QueueMs      int64 // 收到请求到转发上游的等待时间
+	TTFTMs       int64 // 转发上游到首字节写回客户端
+	StreamMs     int64 // 首字节到最后一次写回（流式输出时长）
+	CreatedAt    time.Time
+}
+
+// RequestLogQuery 请求日志查询条件。
+type RequestLogQuery struct {
+	AccountID  string
+	NodeID     string
+	Label      string
+	ErrorClass string
+	From       time.Time
+	To         time.Time
+	Limit      int
+	Offset     int
+}
+
+func (s *Store) ensureRequestLogTable(ctx context.Context) error {
+	ctx, cancel := s.withTimeout(ctx, opWrite)
+	defer cancel()
+	stmt := `CREATE TABLE IF NOT EXISTS request_logs (
+		id BIGINT AUTO_INCREMENT PRIMARY KEY,
+		account_id VARCHAR(64) NOT NULL,
+		node_id VARCHAR(64) NOT NULL,
+		node_name VARCHAR(255) NOT NULL DEFAULT '',
+		method VARCHAR(16) NOT NULL,
+		path VARCHAR(512) NOT NULL,
+		status INT NOT NULL,
+		duration_ms BIGINT NOT NULL DEFAULT 0,
+		input_tokens BIGINT NOT NULL DEFAULT 0,
+		output_tokens BIGINT NOT NULL DEFAULT 0,
+		node_override VARCHAR(255) NOT NULL DEFAULT '',
+		created_at DATETIME(3) NOT NULL,
+		INDEX idx_request_account_time (account_id, created_at),
+		INDEX idx_request_node_time (node_id, created_at)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`
+	if _, err := s.db.ExecContext(ctx, stmt); err != nil {
+		return err
+	}
+	return s.ensureRequestLogColumns(ctx)
+}
+
+// requestLogColumns 为后续新增的列，旧表启动时自动补齐。
+var requestLogColumns = []struct{ name, ddl string }{
+	{"request_body", "ALTER TABLE request_logs ADD COLUMN request_body MEDIUMTEXT NULL"},
+	{"label", "ALTER TABLE request_logs ADD COLUMN label VARCHAR(64) NOT NULL DEFAULT '', ADD KEY idx_request_account_label_time (account_id, label, created_at)"},
+	{"error_class", "ALTER TABLE request_logs ADD COLUMN error_class VARCHAR(32) NOT NULL DEFAULT ''"},
+	{"model", "ALTER TABLE request_logs ADD COLUMN model VARCHAR(128) NOT NULL DEFAULT ''"},
+	// 耗时拆分列与按耗时排序的索引（最慢请求查询）
+	{"queue_ms", "ALTER TABLE request_logs ADD COLUMN queue_ms BIGINT NOT NULL DEFAULT 0, ADD COLUMN ttft_ms BIGINT NOT NULL DEFAULT 0, ADD COLUMN stream_ms BIGINT NOT NULL DEFAULT 0, " +
+		"ADD KEY idx_request_account_duration (account_id, duration_ms), ADD KEY idx_request_duration (duration_ms)"},
+}
+
+func (s *Store) ensureRequestLogColumns(ctx context.Context) error {
+	for _, col := range requestLogColumns {
+		exists, err := s.columnExists(ctx, "request_logs", col.name)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		if _, err := s.db.ExecContext(ctx, col.ddl); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// InsertRequestLog 写入一条请求日志。
+func (s *Store) InsertRequestLog(ctx context.Context, rec RequestLogRecord) error {
+	rec.AccountID = normalizeAccount(rec.AccountID)
+	if rec.CreatedAt.IsZero() {
+		rec.CreatedAt = time.Now().UTC()
+	}
+	ctx, cancel := s.withTimeout(ctx, opWrite)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, `INSERT INTO request_logs (account_id,node_id,node_name,method,path,status,duration_ms,input_tokens,output_tokens,node_override,request_body,label,error_class,model,queue_ms,ttft_ms,stream_ms,created_at) VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)`,
+		rec.AccountID, rec.NodeID, rec.NodeName, rec.Method, rec.Path, rec.Status, rec.DurationMs, rec.InputTokens, rec.OutputTokens, rec.NodeOverride, nullOrString(rec.RequestBody), rec.Label, rec.ErrorClass, rec.Model, rec.QueueMs, rec.TTFTMs, rec.StreamMs, rec.CreatedAt.UTC())
+	return err
+}
+
+const requestLogSelect = `SELECT id,account_id,node_id,node_name,method,path,status,duration_ms,input_tokens,output_tokens,node_override,request_body,label,error_class,model,queue_ms,ttft_ms,stream_ms,created_at FROM request_logs`
+
+// requestLogWhere 根据查询条件生成 WHERE 子句。
+func requestLogWhere(q RequestLogQuery) (string, []interface{}) {
+	var (
+		conds []string
+		args  []interface{}
+	)
+	if q.AccountID != "" {
+		conds = append(conds, "account_id=?")
+		args = append(args, q.AccountID)
+	}
+	if q.NodeID != "" {
+		conds = append(conds, "node_id=?")
+		args = append(args, q.NodeID)
+	}
+	if q.Label != "" {
+		conds = append(conds, "label=?")
+		args = append(args, q.Label)
+	}
+	if q.ErrorClass != "" {
+		conds = append(conds, "error_class=?")
+		args = append(args, q.ErrorClass)
+	}
+	if !q.From.IsZero() {
+		conds = append(conds, "created_at>=?")
+		args = append(args, q.From.UTC())
+	}
+	if !q.To.IsZero() {
+		conds = append(conds, "created_at<=?")
+		args = append(args, q.To.UTC())
+	}
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
+
+// ListRequestLogs 按条件查询请求日志，按时间倒序。
+func (s *Store) ListRequestLogs(ctx context.Context, q RequestLogQuery) ([]RequestLogRecord, error) {
+	where, args := requestLogWhere(q)
+	limit := q.Limit
+	if limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+	args = append(args, limit, q.Offset)
+	return s.queryRequestLogs(ctx, requestLogSelect+where+" ORDER BY created_at DESC, id DESC LIMIT ? OFFSET ?", args...)
+}
+
+// GetRequestLog 按 ID 读取账号下的一条请求日志，不存在时返回 nil。
+func (s *Store) GetRequestLog(ctx context.Context, accountID string, id int64) (*RequestLogRecord, error) {
+	recs, err := s.queryRequestLogs(ctx, requestLogSelect+" WHERE id=? AND account_id=?", id, normalizeAccount(accountID))
+	if err != nil || len(recs) == 0 {
+		return nil, err
+	}
+	return &recs[0], nil
+}
+
+// ListSlowestRequestLogs 返回时间范围内耗时最长的请求，按耗时倒序。
+func (s *Store) ListSlowestRequestLogs(ctx context.Context, q RequestLogQuery) ([]RequestLogRecord, error) {
+	where, args := requestLogWhere(q)
+	limit := q.Limit
+	if limit <= 0 || limit > 500 {
+		limit = 20
+	}
+	args = append(args, limit)
+	return s.queryRequestLogs(ctx, requestLogSelect+where+" ORDER BY duration_ms DESC, id DESC LIMIT ?", args...)
+}
+
+func (s *Store) queryRequestLogs(ctx context.Context, query string, args ...interface{}) ([]RequestLogRecord, error) {
+	ctx, cancel := s.withTimeout(ctx, opRead)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []RequestLogRecord
+	for rows.Next() {
+		var (
+			rec  RequestLogRecord
+			body sql.NullString
+		)
+		if err := rows.Scan(&rec.ID, &rec.AccountID, &rec.NodeID, &rec.NodeName, &rec.Method, &rec.Path, &rec.Status,
+			&rec.DurationMs, &rec.InputTokens, &rec.OutputTokens, &rec.NodeOverride, &body, &rec.Label, &rec.ErrorClass,
+			&rec.Model, &rec.QueueMs, &rec.TTFTMs, &rec.StreamMs, &rec.CreatedAt); err != nil {
+			return nil, err
+		}
+		rec.RequestBody = body.String
+		out = append(out, rec)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,89 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// RetentionPolicy 各类数据的保留时长，0 表示不自动清理。
+type RetentionPolicy struct {
+	RawMetrics    time.Duration
+	HourlyMetrics time.Duration // 同时用于小时级多维汇总
+	DailyMetrics  time.Duration // 同时用于天级多维汇总
+	HealthChecks  time.Duration
+	RequestLogs   time.Duration
+	AuditLogs     time.Duration
+}
+
+// DefaultRetentionPolicy 返回未配置时的默认保留策略；请求日志与审计日志默认不清理。
+func DefaultRetentionPolicy() RetentionPolicy {
+	return RetentionPolicy{
+		RawMetrics:    retentionRaw,
+		HourlyMetrics: retentionHourly,
+		DailyMetrics:  retentionDaily,
+		HealthChecks:  healthHistoryRetention,
+	}
+}
+
+// CleanupScope 清理范围：AccountID 为空时覆盖全部账号，Exclude 中的账号除外（通常为有账号级策略的账号）。
+// DryRun 时只统计将被删除的行数，不实际删除。
+type CleanupScope struct {
+	AccountID string
+	Exclude   []string
+	DryRun    bool
+}
+
+func (sc CleanupScope) appendWhere(b *strings.Builder, args []interface{}) []interface{} {
+	if sc.AccountID != "" {
+		b.WriteString(" AND account_id=?")
+		return append(args, normalizeAccount(sc.AccountID))
+	}
+	if len(sc.Exclude) > 0 {
+		b.WriteString(" AND account_id NOT IN (?" + strings.Repeat(",?", len(sc.Exclude)-1) + ")")
+		for _, id := range sc.Exclude {
+			args = append(args, id)
+		}
+	}
+	return args
+}
+
+// cleanupTable 删除 col 早于 now-keep 的记录并返回行数；keep 为 0 时跳过。
+func (s *Store) cleanupTable(ctx context.Context, table, col string, keep time.Duration, scope CleanupScope, now time.Time) (int64, error) {
+	if keep <= 0 {
+		return 0, nil
+	}
+	if now.IsZero() {
+		now = time.Now().UTC()
+	}
+	b := &strings.Builder{}
+	if scope.DryRun {
+		fmt.Fprintf(b, "SELECT COUNT(*) FROM %s WHERE %s < ?", table, col)
+	} else {
+		fmt.Fprintf(b, "DELETE FROM %s WHERE %s < ?", table, col)
+	}
+	args := scope.appendWhere(b, []interface{}{now.UTC().Add(-keep)})
+	ctx, cancel := s.withTimeout(ctx, opCleanup)
+	defer cancel()
+	if scope.DryRun {
+		var n int64
+		err := s.db.QueryRowContext(ctx, b.String(), args...).Scan(&n)
+		return n, err
+	}
+	res, err := s.db.ExecContext(ctx, b.String(), args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// CleanupRequestLogs 按保留时长清理请求日志并返回行数，keep 为 0 时不清理。
+func (s *Store) CleanupRequestLogs(ctx context.Context, scope CleanupScope, keep time.Duration, now time.Time) (int64, error) {
+	return s.cleanupTable(ctx, "request_logs", "created_at", keep, scope, now)
+}
+
+// CleanupAuditLogs 按保留时长清理审计日志并返回行数，keep 为 0 时不清理。
+func (s *Store) CleanupAuditLogs(ctx context.Context, scope CleanupScope, keep time.Duration, now time.Time) (int64, error) {
+	return s.cleanupTable(ctx, "audit_logs", "created_at", keep, scope, now)
+}
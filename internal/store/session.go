@@ -0,0 +1,110 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// SessionRecord 持久化的登录会话，重启或切换实例后仍可使用。只保存 token 的哈希，
+// 管理员代入状态不持久化。
+type SessionRecord struct {
+	TokenHash          string
+	AccountID          string
+	IsAdmin            bool
+	UserID             string
+	UserName           string
+	Role               string
+	MustChangePassword bool
+	CreatedAt          time.Time
+	ExpiresAt          time.Time
+}
+
+func (s *Store) ensureSessionsTable(ctx context.Context) error {
+	ctx, cancel := s.withTimeout(ctx, opWrite)
+	defer cancel()
+	stmt := `CREATE TABLE IF NOT EXISTS sessions (
+		token_hash VARCHAR(64) PRIMARY KEY,
+		account_id VARCHAR(64) NOT NULL,
+		is_admin BOOLEAN NOT NULL DEFAULT FALSE,
+		user_id VARCHAR(64) NOT NULL DEFAULT '',
+		user_name VARCHAR(255) NOT NULL DEFAULT '',
+		role VARCHAR(32) NOT NULL DEFAULT '',
+		must_change_password BOOLEAN NOT NULL DEFAULT FALSE,
+		created_at DATETIME(3) NOT NULL,
+		expires_at DATETIME(3) NOT NULL,
+		INDEX idx_sessions_account (account_id),
+		INDEX idx_sessions_user (user_id),
+		INDEX idx_sessions_expires (expires_at)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`
+	_, err := s.db.ExecContext(ctx, stmt)
+	return err
+}
+
+// SaveSession 新建或更新会话。
+func (s *Store) SaveSession(ctx context.Context, rec SessionRecord) error {
+	if rec.TokenHash == "" {
+		return errors.New("token_hash required")
+	}
+	ctx, cancel := s.withTimeout(ctx, opWrite)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, `INSERT INTO sessions (token_hash,account_id,is_admin,user_id,user_name,role,must_change_password,created_at,expires_at)
+		VALUES (?,?,?,?,?,?,?,?,?)
+		ON DUPLICATE KEY UPDATE account_id=VALUES(account_id), is_admin=VALUES(is_admin), user_id=VALUES(user_id),
+			user_name=VALUES(user_name), role=VALUES(role), must_change_password=VALUES(must_change_password), expires_at=VALUES(expires_at)`,
+		rec.TokenHash, rec.AccountID, rec.IsAdmin, rec.UserID, rec.UserName, rec.Role, rec.MustChangePassword, rec.CreatedAt.UTC(), rec.ExpiresAt.UTC())
+	return err
+}
+
+// GetSession 按 token 哈希读取未过期的会话，不存在或已过期时返回 ErrNotFound。
+func (s *Store) GetSession(ctx context.Context, tokenHash string) (*SessionRecord, error) {
+	ctx, cancel := s.withTimeout(ctx, opRead)
+	defer cancel()
+	var rec SessionRecord
+	err := s.db.QueryRowContext(ctx, `SELECT token_hash,account_id,is_admin,user_id,user_name,role,must_change_password,created_at,expires_at
+		FROM sessions WHERE token_hash=? AND expires_at > ?`, tokenHash, time.Now().UTC()).
+		Scan(&rec.TokenHash, &rec.AccountID, &rec.IsAdmin, &rec.UserID, &rec.UserName, &rec.Role, &rec.MustChangePassword, &rec.CreatedAt, &rec.ExpiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &rec, nil
+}
+
+// DeleteSession 删除会话，不存在时不报错。
+func (s *Store) DeleteSession(ctx context.Context, tokenHash string) error {
+	ctx, cancel := s.withTimeout(ctx, opWrite)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, `DELETE FROM sessions WHERE token_hash=?`, tokenHash)
+	return err
+}
+
+// DeleteUserSessions 删除账号成员的全部会话。
+func (s *Store) DeleteUserSessions(ctx context.Context, userID string) error {
+	ctx, cancel := s.withTimeout(ctx, opWrite)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, `DELETE FROM sessions WHERE user_id=?`, userID)
+	return err
+}
+
+// DeleteAccountSessions 删除账号（含成员）的全部会话。
+func (s *Store) DeleteAccountSessions(ctx context.Context, accountID string) error {
+	ctx, cancel := s.withTimeout(ctx, opWrite)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, `DELETE FROM sessions WHERE account_id=?`, accountID)
+	return err
+}
+
+// DeleteExpiredSessions 删除 before 之前过期的会话，返回删除的行数。
+func (s *Store) DeleteExpiredSessions(ctx context.Context, before time.Time) (int64, error) {
+	ctx, cancel := s.withTimeout(ctx, opWrite)
+	defer cancel()
+	res, err := s.db.ExecContext(ctx, `DELETE FROM sessions WHERE expires_at <= ?`, before.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -36,9 +36,18 @@ type SettingsStore interface {
 	// 删除配置
 	DeleteSetting(key, scope, accountID string) error
 
+	// 删除配置并记录操作人
+	DeleteSettingBy(key, scope, accountID, actor string) error
+
 	// 批量更新
 	BatchUpdateSettings(settings []Setting) error
 
 	// 获取全局版本号（用于热更新检测）
 	GetGlobalVersion() (int64, error)
+
+	// 获取全局版本号大于 sinceVersion 的变更记录（增量同步）
+	ListSettingChanges(sinceVersion int64, limit int) ([]SettingChange, error)
+
+	// 获取配置表版本戳（版本号+行数+最后更新时间），用于 ETag
+	GetSettingsStamp() (string, error)
 }
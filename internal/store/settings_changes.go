@@ -0,0 +1,106 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// 配置变更动作。
+const (
+	SettingChangeUpsert = "upsert"
+	SettingChangeDelete = "delete"
+)
+
+// SettingChange 配置变更日志中的一条记录。Version 为全局递增的变更序号（即全局版本号），
+// SettingVersion 为该配置项变更后的行版本，删除时为 0。
+type SettingChange struct {
+	Version        int64     `json:"version"`
+	Key            string    `json:"key"`
+	Scope          string    `json:"scope"`
+	AccountID      *string   `json:"account_id,omitempty"`
+	SettingVersion int       `json:"setting_version"`
+	Action         string    `json:"action"`
+	Actor          *string   `json:"actor,omitempty"`
+	ChangedAt      time.Time `json:"changed_at"`
+}
+
+// execer 由 *sql.DB 与 *sql.Tx 实现，使变更记录可与配置写入处于同一事务。
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// ensureSettingsChangesTable 创建配置变更日志表；首次创建时为现有配置写入基线记录，
+// 使从版本 0 开始的增量同步也能得到完整配置。
+func (s *Store) ensureSettingsChangesTable(ctx context.Context) error {
+	ctx, cancel := s.withTimeout(ctx, opWrite)
+	defer cancel()
+	stmt := "CREATE TABLE IF NOT EXISTS settings_changes (" +
+		"  seq BIGINT AUTO_INCREMENT PRIMARY KEY COMMENT '全局版本号'," +
+		"  `key` VARCHAR(128) NOT NULL," +
+		"  scope VARCHAR(16) NOT NULL," +
+		"  account_id VARCHAR(64) NULL," +
+		"  setting_version INT NOT NULL DEFAULT 0," +
+		"  action VARCHAR(16) NOT NULL," +
+		"  actor VARCHAR(64) NULL," +
+		"  changed_at DATETIME(3) NOT NULL," +
+		"  INDEX idx_settings_changes_account (account_id)" +
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='配置变更日志';"
+	if _, err := s.db.ExecContext(ctx, stmt); err != nil {
+		return err
+	}
+	_, err := s.db.ExecContext(ctx, "INSERT INTO settings_changes (`key`, scope, account_id, setting_version, action, actor, changed_at) "+
+		"SELECT `key`, scope, account_id, version, ?, updated_by, updated_at FROM settings "+
+		"WHERE NOT EXISTS (SELECT 1 FROM settings_changes) ORDER BY updated_at, id", SettingChangeUpsert)
+	return err
+}
+
+// recordSettingUpsert 按配置当前的行版本与修改人写入一条变更记录。
+func recordSettingUpsert(ctx context.Context, db execer, key, scope string, accountID any) error {
+	_, err := db.ExecContext(ctx, "INSERT INTO settings_changes (`key`, scope, account_id, setting_version, action, actor, changed_at) "+
+		"SELECT `key`, scope, account_id, version, ?, updated_by, ? FROM settings WHERE `key`=? AND scope=? AND account_id <=> ?",
+		SettingChangeUpsert, time.Now().UTC(), key, scope, accountID)
+	return err
+}
+
+func recordSettingDelete(ctx context.Context, db execer, key, scope string, accountID any, actor string) error {
+	_, err := db.ExecContext(ctx, "INSERT INTO settings_changes (`key`, scope, account_id, setting_version, action, actor, changed_at) VALUES (?,?,?,0,?,?,?)",
+		key, scope, accountID, SettingChangeDelete, nullOrStringPtr(&actor), time.Now().UTC())
+	return err
+}
+
+// ListSettingChanges 返回全局版本号大于 sinceVersion 的变更，按版本升序，limit<=0 时默认 500。
+func (s *Store) ListSettingChanges(sinceVersion int64, limit int) ([]SettingChange, error) {
+	if limit <= 0 {
+		limit = 500
+	}
+	ctx, cancel := s.withTimeout(context.Background(), opRead)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, "SELECT seq, `key`, scope, account_id, setting_version, action, actor, changed_at "+
+		"FROM settings_changes WHERE seq > ? ORDER BY seq LIMIT ?", sinceVersion, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []SettingChange
+	for rows.Next() {
+		var (
+			c         SettingChange
+			accountID sql.NullString
+			actor     sql.NullString
+		)
+		if err := rows.Scan(&c.Version, &c.Key, &c.Scope, &accountID, &c.SettingVersion, &c.Action, &actor, &c.ChangedAt); err != nil {
+			return nil, err
+		}
+		if accountID.Valid {
+			v := accountID.String
+			c.AccountID = &v
+		}
+		if actor.Valid {
+			v := actor.String
+			c.Actor = &v
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,350 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// SQLite 后端：未配置 MySQL 时使用的嵌入式单文件数据库（纯 Go 实现，无需 CGO）。
+// 存储层的 SQL 保持 MySQL 方言，由包装驱动在执行前改写为 SQLite 方言（见 sqlite_dialect.go），
+// 并统一时间参数与结果的格式。
+
+const (
+	BackendMySQL  = "mysql"
+	BackendSQLite = "sqlite"
+
+	sqliteDriverName = "qcc-sqlite"
+	// sqliteTimeLayout 时间参数写入格式：UTC、无时区后缀，与 strftime/CURRENT_TIMESTAMP 的输出可直接按字符串比较。
+	sqliteTimeLayout = "2006-01-02 15:04:05.999999999"
+)
+
+var (
+	registerSQLiteOnce sync.Once
+	registerSQLiteErr  error
+
+	// sqliteTimeValue 无声明类型的结果列（MIN/MAX、表达式）中形如时间的字符串按时间返回。
+	sqliteTimeValue = regexp.MustCompile(`^\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}(\.\d+)?$`)
+)
+
+// registerSQLiteDriver 以 modernc.org/sqlite 驱动为底层注册改写驱动。
+func registerSQLiteDriver() error {
+	registerSQLiteOnce.Do(func() {
+		db, err := sql.Open("sqlite", "")
+		if err != nil {
+			registerSQLiteErr = err
+			return
+		}
+		base := db.Driver()
+		_ = db.Close()
+		sql.Register(sqliteDriverName, &sqliteDriver{base: base})
+	})
+	return registerSQLiteErr
+}
+
+// openSQLite 打开（必要时创建）SQLite 数据库文件并执行迁移。
+func openSQLite(path string) (*Store, error) {
+	path = strings.TrimSpace(path)
+	if path == "" {
+		return nil, fmt.Errorf("sqlite: empty database path")
+	}
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, fmt.Errorf("sqlite: create data dir: %w", err)
+		}
+	}
+	if err := registerSQLiteDriver(); err != nil {
+		return nil, err
+	}
+	dsn := "file:" + path + "?_pragma=busy_timeout(10000)&_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)&_txlock=immediate"
+	db, err := sql.Open(sqliteDriverName, dsn)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	s := &Store{db: db, backend: BackendSQLite}
+	if err := s.migrate(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// sqliteTranslations 缓存改写结果，存储层的语句集合是固定的。
+var sqliteTranslations sync.Map // string -> []string
+
+func translateSQLiteCached(query string) ([]string, error) {
+	if v, ok := sqliteTranslations.Load(query); ok {
+		return v.([]string), nil
+	}
+	stmts, err := translateSQLite(query)
+	if err != nil {
+		return nil, err
+	}
+	sqliteTranslations.Store(query, stmts)
+	return stmts, nil
+}
+
+func translateSQLiteSingle(query string) (string, error) {
+	stmts, err := translateSQLiteCached(query)
+	if err != nil {
+		return "", err
+	}
+	if len(stmts) != 1 {
+		return "", fmt.Errorf("sqlite: statement expands to %d statements and can only be executed: %s", len(stmts), query)
+	}
+	return stmts[0], nil
+}
+
+func convertSQLiteArgs(args []driver.NamedValue) []driver.NamedValue {
+	out := make([]driver.NamedValue, len(args))
+	for i, a := range args {
+		if t, ok := a.Value.(time.Time); ok {
+			a.Value = t.UTC().Format(sqliteTimeLayout)
+		}
+		out[i] = a
+	}
+	return out
+}
+
+type sqliteDriver struct {
+	base driver.Driver
+}
+
+func (d *sqliteDriver) Open(name string) (driver.Conn, error) {
+	c, err := d.base.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &sqliteConn{base: c}, nil
+}
+
+type sqliteConn struct {
+	base driver.Conn
+}
+
+func (c *sqliteConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *sqliteConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	q, err := translateSQLiteSingle(query)
+	if err != nil {
+		return nil, err
+	}
+	var st driver.Stmt
+	if p, ok := c.base.(driver.ConnPrepareContext); ok {
+		st, err = p.PrepareContext(ctx, q)
+	} else {
+		st, err = c.base.Prepare(q)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &sqliteStmt{base: st}, nil
+}
+
+func (c *sqliteConn) Close() error { return c.base.Close() }
+
+func (c *sqliteConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *sqliteConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if b, ok := c.base.(driver.ConnBeginTx); ok {
+		return b.BeginTx(ctx, opts)
+	}
+	return c.base.Begin() //nolint:staticcheck // 底层驱动未实现 BeginTx 时的回退
+}
+
+func (c *sqliteConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	ex, ok := c.base.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	stmts, err := translateSQLiteCached(query)
+	if err != nil {
+		return nil, err
+	}
+	args = convertSQLiteArgs(args)
+	var res driver.Result
+	for i, q := range stmts {
+		// 建表时拆出的索引语句不带参数。
+		a := args
+		if i > 0 {
+			a = nil
+		}
+		if res, err = ex.ExecContext(ctx, q, a); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+func (c *sqliteConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	qc, ok := c.base.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	q, err := translateSQLiteSingle(query)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := qc.QueryContext(ctx, q, convertSQLiteArgs(args))
+	if err != nil {
+		return nil, err
+	}
+	return newSQLiteRows(rows), nil
+}
+
+func (c *sqliteConn) Ping(ctx context.Context) error {
+	if p, ok := c.base.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *sqliteConn) ResetSession(ctx context.Context) error {
+	if r, ok := c.base.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *sqliteConn) IsValid() bool {
+	if v, ok := c.base.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
+
+type sqliteStmt struct {
+	base driver.Stmt
+}
+
+func (s *sqliteStmt) Close() error  { return s.base.Close() }
+func (s *sqliteStmt) NumInput() int { return s.base.NumInput() }
+
+func (s *sqliteStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.ExecContext(context.Background(), valuesToNamed(args))
+}
+
+func (s *sqliteStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.QueryContext(context.Background(), valuesToNamed(args))
+}
+
+func (s *sqliteStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	ex, ok := s.base.(driver.StmtExecContext)
+	if !ok {
+		return nil, fmt.Errorf("sqlite: driver statement does not support ExecContext")
+	}
+	return ex.ExecContext(ctx, convertSQLiteArgs(args))
+}
+
+func (s *sqliteStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	qc, ok := s.base.(driver.StmtQueryContext)
+	if !ok {
+		return nil, fmt.Errorf("sqlite: driver statement does not support QueryContext")
+	}
+	rows, err := qc.QueryContext(ctx, convertSQLiteArgs(args))
+	if err != nil {
+		return nil, err
+	}
+	return newSQLiteRows(rows), nil
+}
+
+func valuesToNamed(args []driver.Value) []driver.NamedValue {
+	out := make([]driver.NamedValue, len(args))
+	for i, v := range args {
+		out[i] = driver.NamedValue{Ordinal: i + 1, Value: v}
+	}
+	return out
+}
+
+// sqliteRows 将无声明类型列中的时间字符串转为 time.Time，带 DATETIME 声明类型的列由底层驱动解析。
+type sqliteRows struct {
+	driver.Rows
+	untyped []bool
+}
+
+func newSQLiteRows(rows driver.Rows) *sqliteRows {
+	r := &sqliteRows{Rows: rows}
+	if tn, ok := rows.(driver.RowsColumnTypeDatabaseTypeName); ok {
+		cols := rows.Columns()
+		r.untyped = make([]bool, len(cols))
+		for i := range cols {
+			r.untyped[i] = tn.ColumnTypeDatabaseTypeName(i) == ""
+		}
+	}
+	return r
+}
+
+func (r *sqliteRows) Next(dest []driver.Value) error {
+	if err := r.Rows.Next(dest); err != nil {
+		return err
+	}
+	for i, v := range dest {
+		s, ok := v.(string)
+		if !ok || i >= len(r.untyped) || !r.untyped[i] || !sqliteTimeValue.MatchString(s) {
+			continue
+		}
+		if t, err := time.ParseInLocation(sqliteTimeLayout, s, time.UTC); err == nil {
+			dest[i] = t
+		}
+	}
+	return nil
+}
+
+// sqliteAvgRowLength 按 dbstat 统计各表的平均行字节数。
+func (s *Store) sqliteAvgRowLength(ctx context.Context) (map[string]int64, error) {
+	res := make(map[string]int64)
+	rows, err := s.db.QueryContext(ctx, `SELECT name, SUM(pgsize) FROM dbstat GROUP BY name`)
+	if err != nil {
+		// 未编译 dbstat 虚表时不估算字节数。
+		return res, nil
+	}
+	sizes := make(map[string]int64)
+	for rows.Next() {
+		var (
+			name string
+			size int64
+		)
+		if err := rows.Scan(&name, &size); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		sizes[name] = size
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for _, t := range storageTables {
+		size, ok := sizes[t.name]
+		if !ok {
+			continue
+		}
+		var n int64
+		if err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+t.name).Scan(&n); err != nil {
+			return nil, err
+		}
+		if n > 0 {
+			res[t.name] = size / n
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,570 @@
+package store
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SQLite 方言改写：存储层的 SQL 按 MySQL 方言编写，SQLite 模式下由驱动在执行前逐条改写。
+// 只覆盖存储层实际用到的语法：建表/加列/建索引、INSERT IGNORE、ON DUPLICATE KEY UPDATE、<=>、
+// DATE_FORMAT/DATE/CAST AS DATETIME 等时间函数、GREATEST/LEAST、NOW()/UTC_TIMESTAMP() 与 DELETE ... LIMIT。
+
+// sqlTok 词法单元：w 单词（关键字、标识符、数字）、s 字符串字面量、q 反引号/双引号标识符、
+// _ 空白、p 符号。字符串与引号标识符整体作为一个单元，改写不会触及其内容。
+type sqlTok struct {
+	kind byte
+	text string
+}
+
+func lexSQL(q string) []sqlTok {
+	var toks []sqlTok
+	for i := 0; i < len(q); {
+		c := q[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			j := i
+			for j < len(q) && (q[j] == ' ' || q[j] == '\t' || q[j] == '\n' || q[j] == '\r') {
+				j++
+			}
+			toks = append(toks, sqlTok{'_', q[i:j]})
+			i = j
+		case c == '\'' || c == '"' || c == '`':
+			j := i + 1
+			for j < len(q) {
+				if q[j] == '\\' && c != '`' {
+					j += 2
+					continue
+				}
+				if q[j] == c {
+					if j+1 < len(q) && q[j+1] == c {
+						j += 2
+						continue
+					}
+					break
+				}
+				j++
+			}
+			if j >= len(q) {
+				j = len(q) - 1
+			}
+			kind := byte('s')
+			if c != '\'' {
+				kind = 'q'
+			}
+			toks = append(toks, sqlTok{kind, q[i : j+1]})
+			i = j + 1
+		case isWordByte(c):
+			j := i
+			for j < len(q) && isWordByte(q[j]) {
+				j++
+			}
+			toks = append(toks, sqlTok{'w', q[i:j]})
+			i = j
+		default:
+			n := 1
+			for _, op := range []string{"<=>", "<=", ">=", "<>", "!=", "||"} {
+				if strings.HasPrefix(q[i:], op) {
+					n = len(op)
+					break
+				}
+			}
+			toks = append(toks, sqlTok{'p', q[i : i+n]})
+			i += n
+		}
+	}
+	return toks
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c == '$' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
+
+func renderSQL(toks []sqlTok) string {
+	b := &strings.Builder{}
+	for _, t := range toks {
+		b.WriteString(t.text)
+	}
+	return b.String()
+}
+
+// isWord 判断 t 是否为给定关键字（不区分大小写）。
+func (t sqlTok) isWord(kw string) bool {
+	return t.kind == 'w' && strings.EqualFold(t.text, kw)
+}
+
+func (t sqlTok) isPunct(p string) bool {
+	return t.kind == 'p' && t.text == p
+}
+
+// nextSolid 返回 i 之后（含 i）第一个非空白单元的下标，不存在时返回 len(toks)。
+func nextSolid(toks []sqlTok, i int) int {
+	for i < len(toks) && toks[i].kind == '_' {
+		i++
+	}
+	return i
+}
+
+// matchKeywords 判断从 i 开始（跳过空白）是否依次为给定关键字，返回最后一个关键字之后的下标。
+func matchKeywords(toks []sqlTok, i int, kws ...string) (int, bool) {
+	for _, kw := range kws {
+		i = nextSolid(toks, i)
+		if i >= len(toks) || !toks[i].isWord(kw) {
+			return 0, false
+		}
+		i++
+	}
+	return i, true
+}
+
+// closeParen 返回与 toks[open] 处左括号匹配的右括号下标，未闭合时返回 -1。
+func closeParen(toks []sqlTok, open int) int {
+	depth := 0
+	for i := open; i < len(toks); i++ {
+		switch {
+		case toks[i].isPunct("("):
+			depth++
+		case toks[i].isPunct(")"):
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// splitTopLevel 按括号外的逗号切分，各段去掉首尾空白。
+func splitTopLevel(toks []sqlTok) [][]sqlTok {
+	var (
+		out   [][]sqlTok
+		depth int
+		start int
+	)
+	for i, t := range toks {
+		switch {
+		case t.isPunct("("):
+			depth++
+		case t.isPunct(")"):
+			depth--
+		case t.isPunct(",") && depth == 0:
+			out = append(out, trimSpace(toks[start:i]))
+			start = i + 1
+		}
+	}
+	return append(out, trimSpace(toks[start:]))
+}
+
+func trimSpace(toks []sqlTok) []sqlTok {
+	for len(toks) > 0 && toks[0].kind == '_' {
+		toks = toks[1:]
+	}
+	for len(toks) > 0 && toks[len(toks)-1].kind == '_' {
+		toks = toks[:len(toks)-1]
+	}
+	return toks
+}
+
+func word(s string) sqlTok { return sqlTok{'w', s} }
+
+var (
+	tokSpace = sqlTok{'_', " "}
+	tokLP    = sqlTok{'p', "("}
+	tokRP    = sqlTok{'p', ")"}
+	tokComma = sqlTok{'p', ","}
+)
+
+// translateSQLite 将一条 MySQL 方言语句改写为一条或多条 SQLite 语句（建表时内联索引拆为独立的 CREATE INDEX）。
+func translateSQLite(query string) ([]string, error) {
+	toks := trimSpace(lexSQL(query))
+	for len(toks) > 0 && toks[len(toks)-1].isPunct(";") {
+		toks = trimSpace(toks[:len(toks)-1])
+	}
+	if len(toks) == 0 {
+		return []string{query}, nil
+	}
+	if i, ok := matchKeywords(toks, 0, "CREATE", "TABLE"); ok {
+		return translateCreateTable(toks, i)
+	}
+	if i, ok := matchKeywords(toks, 0, "ALTER", "TABLE"); ok {
+		return translateAlterTable(toks, i)
+	}
+	if i, ok := matchKeywords(toks, 0, "CREATE", "INDEX"); ok {
+		return []string{translateCreateIndex(toks, i, false)}, nil
+	}
+	if i, ok := matchKeywords(toks, 0, "CREATE", "UNIQUE", "INDEX"); ok {
+		return []string{translateCreateIndex(toks, i, true)}, nil
+	}
+	if _, ok := matchKeywords(toks, 0, "DELETE", "FROM"); ok {
+		toks = rewriteDeleteLimit(toks)
+	}
+	return []string{renderSQL(rewriteExpr(toks))}, nil
+}
+
+// rewriteExpr 改写语句中的 MySQL 专有运算符与函数。
+func rewriteExpr(toks []sqlTok) []sqlTok {
+	return rewriteExprIn(toks, false)
+}
+
+// rewriteExprIn upsert 表示已位于 ON DUPLICATE KEY UPDATE 子句内（函数参数中的 VALUES(col) 同样需要改写）。
+func rewriteExprIn(toks []sqlTok, upsert bool) []sqlTok {
+	out := make([]sqlTok, 0, len(toks))
+	for i := 0; i < len(toks); i++ {
+		t := toks[i]
+		if t.isPunct("<=>") {
+			out = append(out, word("IS"))
+			continue
+		}
+		if t.kind != 'w' {
+			out = append(out, t)
+			continue
+		}
+		if t.isWord("INSERT") {
+			if j, ok := matchKeywords(toks, i+1, "IGNORE"); ok {
+				out = append(out, t, tokSpace, word("OR"), tokSpace, word("IGNORE"))
+				i = j - 1
+				continue
+			}
+		}
+		if t.isWord("ON") {
+			if j, ok := matchKeywords(toks, i+1, "DUPLICATE", "KEY", "UPDATE"); ok {
+				out = append(out, word("ON CONFLICT DO UPDATE SET"))
+				i = j - 1
+				upsert = true
+				continue
+			}
+		}
+		open := nextSolid(toks, i+1)
+		if open >= len(toks) || !toks[open].isPunct("(") {
+			out = append(out, t)
+			continue
+		}
+		end := closeParen(toks, open)
+		if end < 0 {
+			out = append(out, t)
+			continue
+		}
+		args := splitTopLevel(toks[open+1 : end])
+		if repl, ok := rewriteCall(strings.ToUpper(t.text), args, upsert); ok {
+			out = append(out, repl...)
+			i = end
+			continue
+		}
+		out = append(out, t)
+	}
+	return out
+}
+
+// rewriteCall 改写函数调用，未识别的函数返回 false（参数由外层继续逐个单元处理）。
+func rewriteCall(name string, args [][]sqlTok, upsert bool) ([]sqlTok, bool) {
+	call := func(fn string, args ...[]sqlTok) []sqlTok {
+		out := []sqlTok{word(fn), tokLP}
+		for i, a := range args {
+			if i > 0 {
+				out = append(out, tokComma, tokSpace)
+			}
+			out = append(out, rewriteExprIn(a, upsert)...)
+		}
+		return append(out, tokRP)
+	}
+	switch name {
+	case "VALUES":
+		// ON DUPLICATE KEY UPDATE 中的 VALUES(col) 对应 SQLite upsert 的 excluded.col。
+		if upsert && len(args) == 1 && len(args[0]) == 1 {
+			return []sqlTok{word("excluded"), {'p', "."}, args[0][0]}, true
+		}
+	case "DATE_FORMAT":
+		if len(args) == 2 && len(args[1]) == 1 && args[1][0].kind == 's' {
+			format := strings.NewReplacer("%i", "%M", "%s", "%S").Replace(args[1][0].text)
+			return call("strftime", []sqlTok{{'s', format}}, args[0]), true
+		}
+	case "DATE":
+		// MySQL 写入 DATETIME 列时补零点，SQLite 按字符串比较，需保持同样的格式。
+		if len(args) == 1 {
+			return call("strftime", []sqlTok{{'s', "'%Y-%m-%d 00:00:00'"}}, args[0]), true
+		}
+	case "CAST":
+		if len(args) == 1 {
+			a := args[0]
+			if n := len(a); n >= 3 && a[n-2].kind == '_' && a[n-3].isWord("AS") {
+				switch typ := strings.ToUpper(a[n-1].text); typ {
+				case "DATETIME":
+					return call("datetime", trimSpace(a[:n-3])), true
+				case "SIGNED", "UNSIGNED":
+					return call("CAST", append(append([]sqlTok{}, a[:n-1]...), word("INTEGER"))), true
+				}
+			}
+		}
+	case "GREATEST":
+		return call("max", args...), true
+	case "LEAST":
+		return call("min", args...), true
+	case "NOW", "UTC_TIMESTAMP", "CURRENT_TIMESTAMP":
+		return []sqlTok{word("CURRENT_TIMESTAMP")}, true
+	}
+	return nil, false
+}
+
+// rewriteDeleteLimit 将 DELETE FROM t WHERE ... LIMIT n 改写为按 rowid 子查询删除（SQLite 默认不支持 DELETE LIMIT）。
+func rewriteDeleteLimit(toks []sqlTok) []sqlTok {
+	from, _ := matchKeywords(toks, 0, "DELETE", "FROM")
+	tableIdx := nextSolid(toks, from)
+	whereIdx, limitIdx, depth := -1, -1, 0
+	for i := tableIdx + 1; i < len(toks); i++ {
+		switch {
+		case toks[i].isPunct("("):
+			depth++
+		case toks[i].isPunct(")"):
+			depth--
+		case depth == 0 && toks[i].isWord("WHERE") && whereIdx < 0:
+			whereIdx = i
+		case depth == 0 && toks[i].isWord("LIMIT"):
+			limitIdx = i
+		}
+	}
+	if limitIdx < 0 || tableIdx >= len(toks) {
+		return toks
+	}
+	table := toks[tableIdx]
+	out := []sqlTok{word("DELETE FROM"), tokSpace, table, tokSpace, word("WHERE rowid IN"), tokSpace, tokLP,
+		word("SELECT rowid FROM"), tokSpace, table, tokSpace}
+	if whereIdx >= 0 {
+		out = append(out, trimSpace(toks[whereIdx:limitIdx])...)
+		out = append(out, tokSpace)
+	}
+	out = append(out, toks[limitIdx:]...)
+	return append(out, tokRP)
+}
+
+// translateCreateTable 改写建表语句：去掉表选项与列注释，自增主键改为 INTEGER PRIMARY KEY AUTOINCREMENT，
+// 普通索引拆为 CREATE INDEX（SQLite 的索引名全库唯一，统一加表名前缀），唯一索引保留为表约束。
+func translateCreateTable(toks []sqlTok, i int) ([]string, error) {
+	if j, ok := matchKeywords(toks, i, "IF", "NOT", "EXISTS"); ok {
+		i = j
+	}
+	nameIdx := nextSolid(toks, i)
+	open := nextSolid(toks, nameIdx+1)
+	if nameIdx >= len(toks) || open >= len(toks) || !toks[open].isPunct("(") {
+		return nil, fmt.Errorf("sqlite: unsupported CREATE TABLE: %s", renderSQL(toks))
+	}
+	end := closeParen(toks, open)
+	if end < 0 {
+		return nil, fmt.Errorf("sqlite: unbalanced CREATE TABLE: %s", renderSQL(toks))
+	}
+	table := unquoteIdent(toks[nameIdx].text)
+	var (
+		items []string
+		post  []string // 建表后执行的索引与触发器
+	)
+	for _, item := range splitTopLevel(toks[open+1 : end]) {
+		if len(item) == 0 {
+			continue
+		}
+		if idx, unique, ok := parseIndexDef(item, 0); ok {
+			if unique {
+				items = append(items, "UNIQUE ("+idx.cols+")")
+			} else {
+				post = append(post, idx.create(table, false))
+			}
+			continue
+		}
+		switch strings.ToUpper(item[0].text) {
+		case "PRIMARY", "FOREIGN", "UNIQUE", "CONSTRAINT", "CHECK":
+			items = append(items, renderSQL(rewriteExpr(item)))
+		default:
+			col, onUpdate := rewriteColumnDef(item)
+			items = append(items, col)
+			if onUpdate {
+				post = append(post, onUpdateTrigger(table, unquoteIdent(item[0].text)))
+			}
+		}
+	}
+	stmts := []string{"CREATE TABLE IF NOT EXISTS " + table + " (\n\t" + strings.Join(items, ",\n\t") + "\n)"}
+	return append(stmts, post...), nil
+}
+
+// translateAlterTable 将一条 ALTER TABLE 的多个子句拆为多条语句：ADD COLUMN 去掉 AFTER/FIRST，
+// ADD KEY/INDEX 改为 CREATE INDEX。
+func translateAlterTable(toks []sqlTok, i int) ([]string, error) {
+	nameIdx := nextSolid(toks, i)
+	if nameIdx >= len(toks) {
+		return nil, fmt.Errorf("sqlite: unsupported ALTER TABLE: %s", renderSQL(toks))
+	}
+	table := unquoteIdent(toks[nameIdx].text)
+	var stmts []string
+	for _, clause := range splitTopLevel(toks[nameIdx+1:]) {
+		if len(clause) == 0 {
+			continue
+		}
+		if j, ok := matchKeywords(clause, 0, "ADD", "COLUMN"); ok {
+			def := trimSpace(clause[j:])
+			for k := range def {
+				if def[k].isWord("AFTER") || def[k].isWord("FIRST") {
+					def = trimSpace(def[:k])
+					break
+				}
+			}
+			col, onUpdate := rewriteColumnDef(def)
+			stmts = append(stmts, "ALTER TABLE "+table+" ADD COLUMN "+col)
+			if onUpdate && len(def) > 0 {
+				stmts = append(stmts, onUpdateTrigger(table, unquoteIdent(def[0].text)))
+			}
+			continue
+		}
+		if j, ok := matchKeywords(clause, 0, "ADD"); ok {
+			if idx, unique, ok := parseIndexDef(clause, j); ok {
+				stmts = append(stmts, idx.create(table, unique))
+				continue
+			}
+		}
+		stmts = append(stmts, "ALTER TABLE "+table+" "+renderSQL(rewriteExpr(clause)))
+	}
+	return stmts, nil
+}
+
+// translateCreateIndex 为索引名加表名前缀并补 IF NOT EXISTS。
+func translateCreateIndex(toks []sqlTok, i int, unique bool) string {
+	nameIdx := nextSolid(toks, i)
+	on, ok := matchKeywords(toks, nameIdx+1, "ON")
+	if nameIdx >= len(toks) || !ok {
+		return renderSQL(toks)
+	}
+	tableIdx := nextSolid(toks, on)
+	open := nextSolid(toks, tableIdx+1)
+	if tableIdx >= len(toks) || open >= len(toks) || !toks[open].isPunct("(") {
+		return renderSQL(toks)
+	}
+	end := closeParen(toks, open)
+	if end < 0 {
+		return renderSQL(toks)
+	}
+	idx := sqliteIndex{name: unquoteIdent(toks[nameIdx].text), cols: renderSQL(trimSpace(toks[open+1 : end]))}
+	return idx.create(unquoteIdent(toks[tableIdx].text), unique)
+}
+
+type sqliteIndex struct {
+	name string
+	cols string
+}
+
+func (idx sqliteIndex) create(table string, unique bool) string {
+	kw := "CREATE INDEX"
+	if unique {
+		kw = "CREATE UNIQUE INDEX"
+	}
+	return fmt.Sprintf("%s IF NOT EXISTS %s_%s ON %s (%s)", kw, table, idx.name, table, idx.cols)
+}
+
+// parseIndexDef 解析从 i 开始的 [UNIQUE] KEY|INDEX name (cols)。
+func parseIndexDef(toks []sqlTok, i int) (sqliteIndex, bool, bool) {
+	unique := false
+	if j, ok := matchKeywords(toks, i, "UNIQUE"); ok {
+		unique, i = true, j
+	}
+	j, ok := matchKeywords(toks, i, "KEY")
+	if !ok {
+		if j, ok = matchKeywords(toks, i, "INDEX"); !ok {
+			return sqliteIndex{}, false, false
+		}
+	}
+	nameIdx := nextSolid(toks, j)
+	open := nextSolid(toks, nameIdx+1)
+	if nameIdx >= len(toks) || toks[nameIdx].kind == 'p' || open >= len(toks) || !toks[open].isPunct("(") {
+		return sqliteIndex{}, false, false
+	}
+	end := closeParen(toks, open)
+	if end < 0 {
+		return sqliteIndex{}, false, false
+	}
+	return sqliteIndex{name: unquoteIdent(toks[nameIdx].text), cols: renderSQL(trimSpace(toks[open+1 : end]))}, unique, true
+}
+
+// onUpdateTrigger 用触发器模拟 ON UPDATE CURRENT_TIMESTAMP：更新语句未显式修改该列时刷新为当前时间。
+func onUpdateTrigger(table, col string) string {
+	return fmt.Sprintf("CREATE TRIGGER IF NOT EXISTS %s_%s_on_update AFTER UPDATE ON %s FOR EACH ROW WHEN NEW.%s IS OLD.%s "+
+		"BEGIN UPDATE %s SET %s = CURRENT_TIMESTAMP WHERE rowid = NEW.rowid; END", table, col, table, col, col, table, col)
+}
+
+// rewriteColumnDef 改写列定义：自增主键、去掉 UNSIGNED/COMMENT/ON UPDATE/字符集，ENUM 改为 TEXT，
+// DATETIME(3) 等带精度的时间类型去掉精度（驱动按声明类型 DATETIME/TIMESTAMP 解析时间）。
+// onUpdate 表示原定义带 ON UPDATE CURRENT_TIMESTAMP，需要配合触发器。
+func rewriteColumnDef(def []sqlTok) (col string, onUpdate bool) {
+	if len(def) == 0 {
+		return "", false
+	}
+	autoInc, primary := false, false
+	for _, t := range def {
+		autoInc = autoInc || t.isWord("AUTO_INCREMENT")
+		primary = primary || t.isWord("PRIMARY")
+	}
+	if autoInc && primary {
+		return def[0].text + " INTEGER PRIMARY KEY AUTOINCREMENT", false
+	}
+	var out []sqlTok
+	for i := 0; i < len(def); i++ {
+		t := def[i]
+		switch {
+		case t.isWord("AUTO_INCREMENT"), t.isWord("UNSIGNED"):
+			continue
+		case t.isWord("COMMENT"):
+			if j := nextSolid(def, i+1); j < len(def) && def[j].kind == 's' {
+				i = j
+			}
+			continue
+		case t.isWord("COLLATE"):
+			i = nextSolid(def, i+1)
+			continue
+		case t.isWord("CHARACTER"):
+			if j, ok := matchKeywords(def, i+1, "SET"); ok {
+				i = nextSolid(def, j)
+			}
+			continue
+		case t.isWord("ON"):
+			if j, ok := matchKeywords(def, i+1, "UPDATE", "CURRENT_TIMESTAMP"); ok {
+				i, onUpdate = j-1, true
+				if k := nextSolid(def, j); k < len(def) && def[k].isPunct("(") {
+					if end := closeParen(def, k); end > 0 {
+						i = end
+					}
+				}
+				continue
+			}
+		case t.isWord("ENUM"):
+			if open := nextSolid(def, i+1); open < len(def) && def[open].isPunct("(") {
+				if end := closeParen(def, open); end > 0 {
+					out = append(out, word("TEXT"))
+					i = end
+					continue
+				}
+			}
+		case t.isWord("DATETIME"), t.isWord("TIMESTAMP"):
+			out = append(out, word(strings.ToUpper(t.text)))
+			if open := nextSolid(def, i+1); open < len(def) && def[open].isPunct("(") {
+				if end := closeParen(def, open); end > 0 {
+					i = end
+				}
+			}
+			continue
+		}
+		out = append(out, t)
+	}
+	return renderSQL(collapseSpaces(rewriteExpr(trimSpace(out)))), onUpdate
+}
+
+// collapseSpaces 合并删除子句后留下的连续空白。
+func collapseSpaces(toks []sqlTok) []sqlTok {
+	out := toks[:0:0]
+	for _, t := range toks {
+		if t.kind == '_' {
+			if len(out) > 0 && out[len(out)-1].kind == '_' {
+				continue
+			}
+			t.text = " "
+		}
+		out = append(out, t)
+	}
+	return out
+}
+
+func unquoteIdent(s string) string {
+	return strings.Trim(s, "`\"")
+}
@@ -0,0 +1,335 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func openTestSQLite(t *testing.T) (*Store, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "data", "qcc_plus.db")
+	s, err := Open("sqlite:" + path)
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s, path
+}
+
+func TestTranslateSQLite(t *testing.T) {
+	cases := []struct {
+		in   string
+		want []string
+	}{
+		{
+			"INSERT IGNORE INTO t (a) VALUES (?)",
+			[]string{"INSERT OR IGNORE INTO t (a) VALUES (?)"},
+		},
+		{
+			"INSERT INTO t (a,b) VALUES (?,?) ON DUPLICATE KEY UPDATE b=VALUES(b), n=GREATEST(n, VALUES(n))",
+			[]string{"INSERT INTO t (a,b) VALUES (?,?) ON CONFLICT DO UPDATE SET b=excluded.b, n=max(n, excluded.n)"},
+		},
+		{
+			"SELECT DATE_FORMAT(ts, '%Y-%m-%d %H:%i:00'), DATE(bucket_start) FROM t WHERE a <=> ? AND b = 'NOW()'",
+			[]string{"SELECT strftime('%Y-%m-%d %H:%M:00', ts), strftime('%Y-%m-%d 00:00:00', bucket_start) FROM t WHERE a IS ? AND b = 'NOW()'"},
+		},
+		{
+			"DELETE FROM t WHERE ts < ? LIMIT ?",
+			[]string{"DELETE FROM t WHERE rowid IN (SELECT rowid FROM t WHERE ts < ? LIMIT ?)"},
+		},
+		{
+			"CREATE TABLE IF NOT EXISTS t (\n id BIGINT AUTO_INCREMENT PRIMARY KEY,\n name VARCHAR(64) NOT NULL COMMENT 'x, y',\n updated_at DATETIME(3) DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,\n UNIQUE KEY uk_name (name),\n INDEX idx_updated (updated_at)\n) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4",
+			[]string{
+				"CREATE TABLE IF NOT EXISTS t (\n\tid INTEGER PRIMARY KEY AUTOINCREMENT,\n\tname VARCHAR(64) NOT NULL,\n\tupdated_at DATETIME DEFAULT CURRENT_TIMESTAMP,\n\tUNIQUE (name)\n)",
+				"CREATE TRIGGER IF NOT EXISTS t_updated_at_on_update AFTER UPDATE ON t FOR EACH ROW WHEN NEW.updated_at IS OLD.updated_at BEGIN UPDATE t SET updated_at = CURRENT_TIMESTAMP WHERE rowid = NEW.rowid; END",
+				"CREATE INDEX IF NOT EXISTS t_idx_updated ON t (updated_at)",
+			},
+		},
+		{
+			"ALTER TABLE t ADD COLUMN label VARCHAR(64) NOT NULL DEFAULT '' AFTER node_id, ADD INDEX idx_label (label)",
+			[]string{
+				"ALTER TABLE t ADD COLUMN label VARCHAR(64) NOT NULL DEFAULT ''",
+				"CREATE INDEX IF NOT EXISTS t_idx_label ON t (label)",
+			},
+		},
+	}
+	for _, c := range cases {
+		got, err := translateSQLite(c.in)
+		if err != nil {
+			t.Fatalf("translate %q: %v", c.in, err)
+		}
+		if strings.Join(got, "\n--\n") != strings.Join(c.want, "\n--\n") {
+			t.Errorf("translate %q\n got: %q\nwant: %q", c.in, got, c.want)
+		}
+	}
+}
+
+func TestSQLiteStore(t *testing.T) {
+	s, path := openTestSQLite(t)
+	ctx := context.Background()
+	if s.Backend() != BackendSQLite {
+		t.Fatalf("backend = %q", s.Backend())
+	}
+
+	if err := s.CreateAccount(ctx, AccountRecord{ID: "acc1", Name: "team", ProxyAPIKey: "key-1"}); err != nil {
+		t.Fatalf("create account: %v", err)
+	}
+	acc, err := s.GetAccountByProxyKey(ctx, "key-1")
+	if err != nil || acc == nil || acc.ID != "acc1" {
+		t.Fatalf("get account by key: %+v %v", acc, err)
+	}
+
+	if err := s.UpsertNode(ctx, NodeRecord{ID: "n1", Name: "primary", BaseURL: "https://a.example", AccountID: "acc1", Weight: 2}); err != nil {
+		t.Fatalf("upsert node: %v", err)
+	}
+	if err := s.UpsertNode(ctx, NodeRecord{ID: "n1", Name: "primary", BaseURL: "https://b.example", AccountID: "acc1", Weight: 3}); err != nil {
+		t.Fatalf("upsert node again: %v", err)
+	}
+	nodes, err := s.GetNodesByAccount(ctx, "acc1")
+	if err != nil || len(nodes) != 1 || nodes[0].BaseURL != "https://b.example" || nodes[0].Weight != 3 {
+		t.Fatalf("nodes = %+v, %v", nodes, err)
+	}
+
+	setting := &Setting{Key: "test.flag", Scope: "system", Value: true, DataType: "boolean", Category: "performance"}
+	if err := s.UpsertSetting(setting); err != nil {
+		t.Fatalf("upsert setting: %v", err)
+	}
+	setting.Value = false
+	if err := s.UpdateSetting(setting); err != nil {
+		t.Fatalf("update setting: %v", err)
+	}
+	got, err := s.GetSetting("test.flag", "system", "")
+	if err != nil || got == nil || got.Value != false || got.Version != 2 {
+		t.Fatalf("setting = %+v, %v", got, err)
+	}
+	if err := s.UpdateSetting(&Setting{Key: "test.flag", Scope: "system", Value: true, Version: 1}); err != ErrVersionConflict {
+		t.Fatalf("stale update err = %v, want ErrVersionConflict", err)
+	}
+
+	hour := time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		rec := MetricsRecord{AccountID: "acc1", NodeID: "n1", Timestamp: hour.Add(time.Duration(i)*time.Hour + 90*time.Second),
+			RequestsTotal: 2, RequestsSuccess: 1, RequestsFailed: 1, InputTokensTotal: 10, BytesTotal: 100}
+		if err := s.InsertMetrics(ctx, rec); err != nil {
+			t.Fatalf("insert metrics: %v", err)
+		}
+	}
+	if err := s.AggregateMetrics(ctx, "", MetricsGranularityHourly, hour, hour.Add(3*time.Hour)); err != nil {
+		t.Fatalf("aggregate hourly: %v", err)
+	}
+	rows, err := s.db.QueryContext(ctx, "SELECT bucket_start, requests_total, input_tokens_total FROM node_metrics_hourly WHERE node_id=? ORDER BY bucket_start", "n1")
+	if err != nil {
+		t.Fatalf("query hourly: %v", err)
+	}
+	var buckets []time.Time
+	for rows.Next() {
+		var (
+			bucket          time.Time
+			requests, input int64
+		)
+		if err := rows.Scan(&bucket, &requests, &input); err != nil {
+			t.Fatalf("scan hourly: %v", err)
+		}
+		if requests != 2 || input != 10 {
+			t.Fatalf("hourly bucket %s: requests=%d input=%d", bucket, requests, input)
+		}
+		buckets = append(buckets, bucket)
+	}
+	rows.Close()
+	if len(buckets) != 3 || !buckets[1].Equal(hour.Add(time.Hour)) {
+		t.Fatalf("hourly buckets = %v", buckets)
+	}
+	mismatches, err := s.CompareAggregateBuckets(ctx, MetricsGranularityHourly, hour, hour.Add(3*time.Hour))
+	if err != nil || len(mismatches) != 0 {
+		t.Fatalf("hourly mismatches = %+v, %v", mismatches, err)
+	}
+
+	// 重新打开时迁移可重复执行，数据保留在文件中。
+	s.Close()
+	reopened, err := Open("sqlite:" + path)
+	if err != nil {
+		t.Fatalf("reopen sqlite: %v", err)
+	}
+	defer reopened.Close()
+	nodes, err = reopened.GetNodesByAccount(ctx, "acc1")
+	if err != nil || len(nodes) != 1 {
+		t.Fatalf("nodes after reopen = %+v, %v", nodes, err)
+	}
+}
+
+func TestUsageRollupsDailySumsHours(t *testing.T) {
+	s, _ := openTestSQLite(t)
+	ctx := context.Background()
+	day := time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)
+	for h := 0; h < 5; h++ {
+		rec := MetricsRecord{AccountID: "acc1", NodeID: "n1", Model: "m", Timestamp: day.Add(time.Duration(h)*time.Hour + time.Minute),
+			RequestsTotal: 2, InputTokensTotal: 10, OutputTokensTotal: 5}
+		if err := s.InsertMetrics(ctx, rec); err != nil {
+			t.Fatalf("insert metrics: %v", err)
+		}
+	}
+	if err := s.AggregateUsageRollups(ctx, MetricsGranularityHourly, day, day.AddDate(0, 0, 1)); err != nil {
+		t.Fatalf("hourly rollup: %v", err)
+	}
+	if err := s.AggregateUsageRollups(ctx, MetricsGranularityDaily, day, day.AddDate(0, 0, 1)); err != nil {
+		t.Fatalf("daily rollup: %v", err)
+	}
+	rows, err := s.QueryUsageRollups(ctx, UsageRollupQuery{AccountID: "acc1", Granularity: MetricsGranularityDaily,
+		From: day, To: day.AddDate(0, 0, 1), GroupBy: []string{"model", "bucket"}})
+	if err != nil {
+		t.Fatalf("query rollups: %v", err)
+	}
+	if len(rows) != 1 || !rows[0].BucketStart.Equal(day) || rows[0].RequestsTotal != 10 || rows[0].InputTokensTotal != 50 || rows[0].OutputTokensTotal != 25 {
+		t.Fatalf("daily rollup = %+v", rows)
+	}
+
+	// 没有数据时不按维度分组的汇总返回零值而不是扫描错误。
+	empty, err := s.QueryUsageRollups(ctx, UsageRollupQuery{AccountID: "other", Granularity: MetricsGranularityDaily, From: day, To: day.AddDate(0, 0, 1)})
+	if err != nil || len(empty) != 1 || empty[0].RequestsTotal != 0 {
+		t.Fatalf("empty rollup = %+v, %v", empty, err)
+	}
+}
+
+func TestStmtCacheConcurrentPrepare(t *testing.T) {
+	s, _ := openTestSQLite(t)
+	ctx := context.Background()
+	const query = "SELECT COUNT(*) FROM accounts WHERE id = ?"
+	var wg sync.WaitGroup
+	stmts := make([]*sql.Stmt, 8)
+	for i := range stmts {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			stmts[i] = s.prepared(ctx, query)
+		}(i)
+	}
+	wg.Wait()
+	for _, stmt := range stmts {
+		if stmt == nil || stmt != stmts[0] {
+			t.Fatalf("expected every caller to share one cached statement, got %v", stmts)
+		}
+	}
+	if st := s.StmtCacheStats(); st.Statements != 1 {
+		t.Fatalf("stats = %+v", st)
+	}
+	// 清空后重新预编译，旧语句不再返回。
+	s.resetStmtCache()
+	if stmt := s.prepared(ctx, query); stmt == nil || stmt == stmts[0] {
+		t.Fatalf("expected a fresh statement after reset")
+	}
+}
+
+func TestAccountPurgeChunksAndRetry(t *testing.T) {
+	s, _ := openTestSQLite(t)
+	ctx := context.Background()
+	for _, id := range []string{"gone", "kept"} {
+		if err := s.CreateAccount(ctx, AccountRecord{ID: id, Name: id, ProxyAPIKey: "key-" + id}); err != nil {
+			t.Fatalf("create account %s: %v", id, err)
+		}
+	}
+	seed := func(accountID string, nodes, metrics int) {
+		for i := 0; i < nodes; i++ {
+			id := fmt.Sprintf("%s-n%d", accountID, i)
+			if err := s.UpsertNode(ctx, NodeRecord{ID: id, Name: id, BaseURL: "https://a.example", AccountID: accountID, Weight: 1}); err != nil {
+				t.Fatalf("upsert node: %v", err)
+			}
+		}
+		ts := time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+		for i := 0; i < metrics; i++ {
+			rec := MetricsRecord{AccountID: accountID, NodeID: accountID + "-n0", Timestamp: ts.Add(time.Duration(i) * time.Minute), RequestsTotal: 1}
+			if err := s.InsertMetrics(ctx, rec); err != nil {
+				t.Fatalf("insert metrics: %v", err)
+			}
+		}
+	}
+	seed("gone", 5, 3)
+	seed("kept", 2, 1)
+	count := func(table, accountID string) int {
+		var n int
+		if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM `+table+` WHERE account_id=?`, accountID).Scan(&n); err != nil {
+			t.Fatalf("count %s: %v", table, err)
+		}
+		return n
+	}
+
+	// 缺失的表应被跳过；改名的列让该表的删除失败，用于验证失败后重试。
+	if _, err := s.db.ExecContext(ctx, `DROP TABLE node_ca_bundles`); err != nil {
+		t.Fatalf("drop table: %v", err)
+	}
+	if _, err := s.db.ExecContext(ctx, `ALTER TABLE node_metrics_hourly RENAME COLUMN account_id TO owner_id`); err != nil {
+		t.Fatalf("rename column: %v", err)
+	}
+
+	job, err := s.DeleteAccount(ctx, "gone")
+	if err != nil {
+		t.Fatalf("delete account: %v", err)
+	}
+	purge := func() error {
+		for i := 0; job.Status != AccountPurgeDone; i++ {
+			if i > 200 {
+				t.Fatalf("purge did not finish: %+v", job)
+			}
+			if _, err := s.PurgeAccountChunk(ctx, job, 2); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := purge(); err == nil {
+		t.Fatalf("expected purge to fail on the broken table")
+	}
+	failed, err := s.GetAccountPurgeJob(ctx, job.ID)
+	if err != nil {
+		t.Fatalf("get purge job: %v", err)
+	}
+	if failed.Status != AccountPurgeFailed || failed.CurrentTable != "node_metrics_hourly" || failed.Error == "" {
+		t.Fatalf("failed job = %+v", failed)
+	}
+	// 3 行按每批 2 行分两次删除，进度跨批次累计。
+	if failed.Deleted["node_metrics_raw"] != 3 || count("node_metrics_raw", "gone") != 0 {
+		t.Fatalf("raw metrics not purged across chunks: %+v", failed.Deleted)
+	}
+
+	if _, err := s.db.ExecContext(ctx, `ALTER TABLE node_metrics_hourly RENAME COLUMN owner_id TO account_id`); err != nil {
+		t.Fatalf("restore column: %v", err)
+	}
+	if err := s.RetryAccountPurgeJob(ctx, job.ID); err != nil {
+		t.Fatalf("retry purge: %v", err)
+	}
+	if err := s.RetryAccountPurgeJob(ctx, job.ID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("retrying a job that is not failed: err = %v, want ErrNotFound", err)
+	}
+	if job, err = s.GetAccountPurgeJob(ctx, job.ID); err != nil || job.Status != AccountPurgePending || job.TablesDone != failed.TablesDone || job.Error != "" {
+		t.Fatalf("retried job = %+v, %v", job, err)
+	}
+	if err := purge(); err != nil {
+		t.Fatalf("purge after retry: %v", err)
+	}
+
+	done, err := s.GetAccountPurgeJob(ctx, job.ID)
+	if err != nil || done.Status != AccountPurgeDone || done.FinishedAt == nil || done.TablesDone != done.TablesTotal {
+		t.Fatalf("done job = %+v, %v", done, err)
+	}
+	if done.Deleted["nodes"] != 5 || done.Deleted["node_metrics_raw"] != 3 {
+		t.Fatalf("deleted counts = %+v", done.Deleted)
+	}
+	if _, ok := done.Deleted["node_ca_bundles"]; ok {
+		t.Fatalf("missing table should be skipped: %+v", done.Deleted)
+	}
+	if count("nodes", "gone") != 0 {
+		t.Fatalf("nodes of the deleted account remain")
+	}
+	if count("nodes", "kept") != 2 || count("node_metrics_raw", "kept") != 1 {
+		t.Fatalf("other account's data must be untouched")
+	}
+	if unfinished, err := s.ListUnfinishedAccountPurgeJobs(ctx); err != nil || len(unfinished) != 0 {
+		t.Fatalf("unfinished jobs = %+v, %v", unfinished, err)
+	}
+}
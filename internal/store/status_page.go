@@ -0,0 +1,143 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// StatusPageRecord 账号的公开状态页配置。
+type StatusPageRecord struct {
+	AccountID string
+	Slug      string // 可选的自定义路径，为空时仅能通过 token 访问
+	Token     string
+	Title     string
+	Enabled   bool
+	UpdatedAt time.Time
+}
+
+// UptimeDay 节点单日的健康检查可用率统计。
+type UptimeDay struct {
+	NodeID      string
+	Day         time.Time
+	ChecksTotal int64
+	ChecksOK    int64
+}
+
+func (s *Store) ensureStatusPageTables(ctx context.Context) error {
+	ctx, cancel := s.withTimeout(ctx, opWrite)
+	defer cancel()
+	stmts := []string{
+		`CREATE TABLE IF NOT EXISTS status_pages (
+			account_id VARCHAR(64) PRIMARY KEY,
+			slug VARCHAR(64) NULL,
+			token VARCHAR(64) NOT NULL,
+			title VARCHAR(255) NOT NULL DEFAULT '',
+			enabled BOOLEAN NOT NULL DEFAULT FALSE,
+			updated_at DATETIME NOT NULL,
+			UNIQUE KEY uniq_status_page_slug (slug),
+			UNIQUE KEY uniq_status_page_token (token)
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+		`CREATE TABLE IF NOT EXISTS node_uptime_daily (
+			account_id VARCHAR(64) NOT NULL,
+			node_id VARCHAR(64) NOT NULL,
+			day DATE NOT NULL,
+			checks_total BIGINT NOT NULL DEFAULT 0,
+			checks_ok BIGINT NOT NULL DEFAULT 0,
+			PRIMARY KEY (account_id, node_id, day),
+			KEY idx_uptime_day (day)
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+	}
+	for _, stmt := range stmts {
+		if _, err := s.db.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UpsertStatusPage 保存状态页配置；slug 为空时写入 NULL 以避免唯一键冲突。
+func (s *Store) UpsertStatusPage(ctx context.Context, rec StatusPageRecord) error {
+	if rec.AccountID == "" || rec.Token == "" {
+		return errors.New("account_id and token are required")
+	}
+	rec.AccountID = normalizeAccount(rec.AccountID)
+	var slug interface{}
+	if rec.Slug != "" {
+		slug = rec.Slug
+	}
+	ctx, cancel := s.withTimeout(ctx, opWrite)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, `INSERT INTO status_pages (account_id,slug,token,title,enabled,updated_at)
+		VALUES (?,?,?,?,?,?)
+		ON DUPLICATE KEY UPDATE slug=VALUES(slug), token=VALUES(token), title=VALUES(title), enabled=VALUES(enabled), updated_at=VALUES(updated_at)`,
+		rec.AccountID, slug, rec.Token, rec.Title, rec.Enabled, time.Now().UTC())
+	return err
+}
+
+// GetStatusPage 读取账号的状态页配置，不存在时返回 ErrNotFound。
+func (s *Store) GetStatusPage(ctx context.Context, accountID string) (*StatusPageRecord, error) {
+	return s.getStatusPage(ctx, `account_id=?`, normalizeAccount(accountID))
+}
+
+// GetStatusPageByKey 按 slug 或 token 查找已启用的状态页。
+func (s *Store) GetStatusPageByKey(ctx context.Context, key string) (*StatusPageRecord, error) {
+	if key == "" {
+		return nil, ErrNotFound
+	}
+	return s.getStatusPage(ctx, `enabled=TRUE AND (slug=? OR token=?)`, key, key)
+}
+
+func (s *Store) getStatusPage(ctx context.Context, cond string, args ...interface{}) (*StatusPageRecord, error) {
+	ctx, cancel := s.withTimeout(ctx, opRead)
+	defer cancel()
+	var (
+		rec  StatusPageRecord
+		slug sql.NullString
+	)
+	err := s.db.QueryRowContext(ctx, `SELECT account_id,slug,token,title,enabled,updated_at FROM status_pages WHERE `+cond+` LIMIT 1`, args...).
+		Scan(&rec.AccountID, &slug, &rec.Token, &rec.Title, &rec.Enabled, &rec.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	rec.Slug = slug.String
+	return &rec, nil
+}
+
+// recordUptime 将一次健康检查计入节点当日可用率。
+func (s *Store) recordUptime(ctx context.Context, accountID, nodeID string, at time.Time, ok bool) error {
+	okCount := 0
+	if ok {
+		okCount = 1
+	}
+	_, err := s.execCached(ctx, `INSERT INTO node_uptime_daily (account_id,node_id,day,checks_total,checks_ok)
+		VALUES (?,?,?,1,?)
+		ON DUPLICATE KEY UPDATE checks_total=checks_total+1, checks_ok=checks_ok+VALUES(checks_ok)`,
+		accountID, nodeID, at.UTC().Format("2006-01-02"), okCount)
+	return err
+}
+
+// UptimeDaily 返回账号下各节点自 from 起的每日可用率统计，按日期升序。
+func (s *Store) UptimeDaily(ctx context.Context, accountID string, from time.Time) (map[string][]UptimeDay, error) {
+	ctx, cancel := s.withTimeout(ctx, opRead)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, `SELECT node_id, day, checks_total, checks_ok FROM node_uptime_daily
+		WHERE account_id=? AND day>=? ORDER BY day ASC`, normalizeAccount(accountID), from.UTC().Format("2006-01-02"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	res := make(map[string][]UptimeDay)
+	for rows.Next() {
+		var d UptimeDay
+		if err := rows.Scan(&d.NodeID, &d.Day, &d.ChecksTotal, &d.ChecksOK); err != nil {
+			return nil, err
+		}
+		res[d.NodeID] = append(res[d.NodeID], d)
+	}
+	return res, rows.Err()
+}
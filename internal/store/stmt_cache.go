@@ -0,0 +1,133 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"sync/atomic"
+)
+
+// maxCachedStmts 预编译语句缓存上限；MySQL 按连接限制 max_prepared_stmt_count，只缓存固定的热点 SQL。
+const maxCachedStmts = 64
+
+// StmtCacheStats 预编译语句缓存统计。
+type StmtCacheStats struct {
+	Statements int   `json:"statements"`
+	Hits       int64 `json:"hits"`
+	Misses     int64 `json:"misses"`
+	Resets     int64 `json:"resets"`
+}
+
+// stmtCache 按 SQL 文本缓存 *sql.Stmt。database/sql 会在各连接上按需重新预编译，
+// 连接因 ConnMaxLifetime 等原因关闭时对应的服务端语句随之释放；连接池重新配置或 Store 关闭时整体清空。
+type stmtCache struct {
+	mu       sync.RWMutex
+	stmts    map[string]*sql.Stmt
+	gen      uint64 // 每次清空缓存递增，用于丢弃清空前开始预编译的语句
+	disabled bool   // 仅用于基准测试对比
+	hits     atomic.Int64
+	misses   atomic.Int64
+	resets   atomic.Int64
+}
+
+// errStmtClosed 与 database/sql 内部错误文本一致：语句在取出后被 resetStmtCache 关闭。
+const errStmtClosed = "sql: statement is closed"
+
+// execCached 使用缓存的预编译语句执行写操作，预编译失败或语句已被清理时回落为普通执行。
+func (s *Store) execCached(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	if stmt := s.prepared(ctx, query); stmt != nil {
+		res, err := stmt.ExecContext(ctx, args...)
+		if err == nil || err.Error() != errStmtClosed {
+			return res, err
+		}
+	}
+	return s.db.ExecContext(ctx, query, args...)
+}
+
+// queryCached 使用缓存的预编译语句执行查询，预编译失败或语句已被清理时回落为普通查询。
+func (s *Store) queryCached(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	if stmt := s.prepared(ctx, query); stmt != nil {
+		rows, err := stmt.QueryContext(ctx, args...)
+		if err == nil || err.Error() != errStmtClosed {
+			return rows, err
+		}
+	}
+	return s.db.QueryContext(ctx, query, args...)
+}
+
+// prepared 返回 query 对应的预编译语句，缓存已满或预编译失败时返回 nil。
+// 预编译需要与数据库往返，在锁外进行，避免阻塞其他语句的缓存命中；
+// 写入前再次检查，并发预编译同一语句时保留先写入的一条。
+func (s *Store) prepared(ctx context.Context, query string) *sql.Stmt {
+	c := &s.stmts
+	c.mu.RLock()
+	stmt, disabled, full, gen := c.stmts[query], c.disabled, len(c.stmts) >= maxCachedStmts, c.gen
+	c.mu.RUnlock()
+	if disabled {
+		return nil
+	}
+	if stmt != nil {
+		c.hits.Add(1)
+		return stmt
+	}
+	c.misses.Add(1)
+	if full {
+		return nil
+	}
+
+	stmt, err := s.db.PrepareContext(ctx, query)
+	if err != nil {
+		return nil
+	}
+	c.mu.Lock()
+	if existing := c.stmts[query]; existing != nil {
+		c.mu.Unlock()
+		_ = stmt.Close()
+		return existing
+	}
+	if c.gen != gen || len(c.stmts) >= maxCachedStmts {
+		c.mu.Unlock()
+		_ = stmt.Close()
+		return nil
+	}
+	if c.stmts == nil {
+		c.stmts = make(map[string]*sql.Stmt)
+	}
+	c.stmts[query] = stmt
+	c.mu.Unlock()
+	return stmt
+}
+
+// resetStmtCache 关闭并清空全部缓存语句，之后的调用会重新预编译。
+// 已在执行中的语句由 database/sql 在执行结束后再释放。
+func (s *Store) resetStmtCache() {
+	c := &s.stmts
+	c.mu.Lock()
+	stmts := c.stmts
+	c.stmts = nil
+	c.gen++
+	c.mu.Unlock()
+	for _, stmt := range stmts {
+		_ = stmt.Close()
+	}
+	if len(stmts) > 0 {
+		c.resets.Add(1)
+	}
+}
+
+// StmtCacheStats 返回预编译语句缓存的命中统计。
+func (s *Store) StmtCacheStats() StmtCacheStats {
+	if s == nil {
+		return StmtCacheStats{}
+	}
+	c := &s.stmts
+	c.mu.RLock()
+	n := len(c.stmts)
+	c.mu.RUnlock()
+	return StmtCacheStats{
+		Statements: n,
+		Hits:       c.hits.Load(),
+		Misses:     c.misses.Load(),
+		Resets:     c.resets.Load(),
+	}
+}
@@ -0,0 +1,59 @@
+//go:build integration
+// +build integration
+
+package store
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+)
+
+// 基准测试需要真实 MySQL：QCC_TEST_MYSQL_DSN=user:pass@tcp(127.0.0.1:3306)/qcc_test?parseTime=true
+// go test -tags integration -bench StmtCache -run '^$' ./internal/store/
+func openBenchStore(b *testing.B) *Store {
+	dsn := os.Getenv("QCC_TEST_MYSQL_DSN")
+	if dsn == "" {
+		b.Skip("QCC_TEST_MYSQL_DSN not set; skipping")
+	}
+	s, err := Open(dsn)
+	if err != nil {
+		b.Fatalf("open store: %v", err)
+	}
+	b.Cleanup(func() { _ = s.Close() })
+	return s
+}
+
+func benchInsertMetrics(b *testing.B, cached bool) {
+	s := openBenchStore(b)
+	s.stmts.disabled = !cached
+	ctx := context.Background()
+	rec := MetricsRecord{AccountID: "bench", NodeID: "bench-node", RequestsTotal: 1, ResponseTimeSumMs: 120}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rec.Timestamp = time.Now().UTC()
+		if err := s.InsertMetrics(ctx, rec); err != nil {
+			b.Fatalf("insert metrics: %v", err)
+		}
+	}
+	b.StopTimer()
+	_, _ = s.db.Exec(`DELETE FROM node_metrics_raw WHERE account_id='bench'`)
+}
+
+func benchGetNodes(b *testing.B, cached bool) {
+	s := openBenchStore(b)
+	s.stmts.disabled = !cached
+	ctx := context.Background()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := s.GetNodesByAccount(ctx, "bench"); err != nil {
+			b.Fatalf("get nodes: %v", err)
+		}
+	}
+}
+
+func BenchmarkStmtCacheInsertMetrics(b *testing.B)         { benchInsertMetrics(b, true) }
+func BenchmarkStmtCacheInsertMetricsUncached(b *testing.B) { benchInsertMetrics(b, false) }
+func BenchmarkStmtCacheGetNodes(b *testing.B)              { benchGetNodes(b, true) }
+func BenchmarkStmtCacheGetNodesUncached(b *testing.B)      { benchGetNodes(b, false) }
@@ -0,0 +1,167 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// minTightenedRetention 超限收紧保留时长时的下限，避免把当天数据也清空。
+const minTightenedRetention = 24 * time.Hour
+
+// storageTable 参与用量统计的表；keep 从保留策略中取该表的保留时长。
+type storageTable struct {
+	name string
+	col  string
+	keep func(RetentionPolicy) time.Duration
+}
+
+var storageTables = []storageTable{
+	{"node_metrics_raw", "ts", func(p RetentionPolicy) time.Duration { return p.RawMetrics }},
+	{"node_metrics_hourly", "bucket_start", func(p RetentionPolicy) time.Duration { return p.HourlyMetrics }},
+	{"node_metrics_daily", "bucket_start", func(p RetentionPolicy) time.Duration { return p.DailyMetrics }},
+	{"health_check_history", "check_time", func(p RetentionPolicy) time.Duration { return p.HealthChecks }},
+	{"request_logs", "created_at", func(p RetentionPolicy) time.Duration { return p.RequestLogs }},
+	{"audit_logs", "created_at", func(p RetentionPolicy) time.Duration { return p.AuditLogs }},
+}
+
+// TableUsage 单表的行数与估算字节数。
+type TableUsage struct {
+	Table string
+	Rows  int64
+	Bytes int64
+}
+
+// AccountStorage 账号在各表中的存储占用。
+type AccountStorage struct {
+	AccountID string
+	Rows      int64
+	Bytes     int64
+	Tables    []TableUsage
+}
+
+// tableAvgRowLength 读取 information_schema 中的平均行长度，用于估算字节数。
+// SQLite 按 dbstat 虚表中各表占用的页字节数除以行数估算，未编译 dbstat 时返回空表（字节数计为 0）。
+func (s *Store) tableAvgRowLength(ctx context.Context) (map[string]int64, error) {
+	ctx, cancel := s.withTimeout(ctx, opAggregate)
+	defer cancel()
+	if s.backend == BackendSQLite {
+		return s.sqliteAvgRowLength(ctx)
+	}
+	rows, err := s.db.QueryContext(ctx, `SELECT TABLE_NAME, COALESCE(AVG_ROW_LENGTH,0) FROM information_schema.TABLES WHERE TABLE_SCHEMA = DATABASE()`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	res := make(map[string]int64)
+	for rows.Next() {
+		var (
+			name string
+			avg  int64
+		)
+		if err := rows.Scan(&name, &avg); err != nil {
+			return nil, err
+		}
+		res[name] = avg
+	}
+	return res, rows.Err()
+}
+
+// StorageUsage 统计每个账号在监控、健康历史、请求日志与审计表中的行数和估算字节数，按字节数降序。
+func (s *Store) StorageUsage(ctx context.Context) ([]AccountStorage, error) {
+	avg, err := s.tableAvgRowLength(ctx)
+	if err != nil {
+		return nil, err
+	}
+	byAccount := make(map[string]*AccountStorage)
+	for _, t := range storageTables {
+		qctx, cancel := s.withTimeout(ctx, opAggregate)
+		rows, err := s.db.QueryContext(qctx, fmt.Sprintf("SELECT account_id, COUNT(*) FROM %s GROUP BY account_id", t.name))
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		for rows.Next() {
+			var (
+				account string
+				n       int64
+			)
+			if err := rows.Scan(&account, &n); err != nil {
+				rows.Close()
+				cancel()
+				return nil, err
+			}
+			usage := byAccount[account]
+			if usage == nil {
+				usage = &AccountStorage{AccountID: account}
+				byAccount[account] = usage
+			}
+			tu := TableUsage{Table: t.name, Rows: n, Bytes: n * avg[t.name]}
+			usage.Tables = append(usage.Tables, tu)
+			usage.Rows += tu.Rows
+			usage.Bytes += tu.Bytes
+		}
+		err = rows.Err()
+		rows.Close()
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+	}
+	res := make([]AccountStorage, 0, len(byAccount))
+	for _, usage := range byAccount {
+		res = append(res, *usage)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Bytes != res[j].Bytes {
+			return res[i].Bytes > res[j].Bytes
+		}
+		return res[i].AccountID < res[j].AccountID
+	})
+	return res, nil
+}
+
+// TightenAccountRetention 将账号在各表的保留时长按 factor (0,1) 收紧并删除过期数据，返回各表删除行数。
+// 策略中不清理的表以当前最旧数据的跨度为基准。
+func (s *Store) TightenAccountRetention(ctx context.Context, accountID string, policy RetentionPolicy, factor float64, now time.Time) (map[string]int64, error) {
+	if factor <= 0 || factor >= 1 {
+		return nil, fmt.Errorf("invalid retention factor: %v", factor)
+	}
+	if now.IsZero() {
+		now = time.Now().UTC()
+	}
+	accountID = normalizeAccount(accountID)
+	deleted := make(map[string]int64)
+	for _, t := range storageTables {
+		keep := t.keep(policy)
+		if keep == 0 {
+			var oldest sql.NullTime
+			qctx, cancel := s.withTimeout(ctx, opCleanup)
+			err := s.db.QueryRowContext(qctx, fmt.Sprintf("SELECT MIN(%s) FROM %s WHERE account_id=?", t.col, t.name), accountID).Scan(&oldest)
+			cancel()
+			if err != nil {
+				return deleted, err
+			}
+			if !oldest.Valid {
+				continue
+			}
+			keep = now.Sub(oldest.Time)
+		}
+		window := time.Duration(float64(keep) * factor)
+		if window < minTightenedRetention {
+			window = minTightenedRetention
+		}
+		qctx, cancel := s.withTimeout(ctx, opCleanup)
+		res, err := s.db.ExecContext(qctx, fmt.Sprintf("DELETE FROM %s WHERE account_id=? AND %s < ?", t.name, t.col), accountID, now.Add(-window))
+		cancel()
+		if err != nil {
+			return deleted, err
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			deleted[t.name] = n
+		}
+	}
+	return deleted, nil
+}
@@ -3,14 +3,25 @@ package store
 import (
 	"context"
 	"database/sql"
+	"strings"
+	"sync/atomic"
 
 	_ "github.com/go-sql-driver/mysql"
 )
 
-type Store struct{ db *sql.DB }
+type Store struct {
+	db       *sql.DB
+	backend  string
+	timeouts atomic.Pointer[Timeouts]
+	stmts    stmtCache
+}
 
-// Open initializes a MySQL-backed store (dsn example: user:pass@tcp(host:3306)/dbname?parseTime=true).
+// Open initializes the store. MySQL DSN example: user:pass@tcp(host:3306)/dbname?parseTime=true;
+// "sqlite:<path>" opens an embedded SQLite database file instead.
 func Open(dsn string) (*Store, error) {
+	if strings.HasPrefix(strings.ToLower(dsn), "sqlite:") {
+		return openSQLite(dsn[len("sqlite:"):])
+	}
 	db, err := sql.Open("mysql", dsn)
 	if err != nil {
 		return nil, err
@@ -20,13 +31,18 @@ func Open(dsn string) (*Store, error) {
 	if err := db.PingContext(ctx); err != nil {
 		return nil, err
 	}
-	s := &Store{db: db}
+	s := &Store{db: db, backend: BackendMySQL}
 	if err := s.migrate(ctx); err != nil {
 		return nil, err
 	}
 	return s, nil
 }
 
+// Backend 返回存储使用的数据库类型。
+func (s *Store) Backend() string {
+	return s.backend
+}
+
 func (s *Store) migrate(ctx context.Context) error {
 	if err := s.ensureAccountsTable(ctx); err != nil {
 		return err
@@ -58,6 +74,51 @@ func (s *Store) migrate(ctx context.Context) error {
 	if err := s.ensureSettingsTable(ctx); err != nil {
 		return err
 	}
+	if err := s.ensureSettingsChangesTable(ctx); err != nil {
+		return err
+	}
+	if err := s.ensureJobsTable(ctx); err != nil {
+		return err
+	}
+	if err := s.ensureAuditLogTable(ctx); err != nil {
+		return err
+	}
+	if err := s.ensureRequestLogTable(ctx); err != nil {
+		return err
+	}
+	if err := s.ensureBenchmarkTable(ctx); err != nil {
+		return err
+	}
+	if err := s.ensureBenchmarkScheduleTable(ctx); err != nil {
+		return err
+	}
+	if err := s.ensureABComparisonTable(ctx); err != nil {
+		return err
+	}
+	if err := s.ensureNodeClientCertTable(ctx); err != nil {
+		return err
+	}
+	if err := s.ensureNodeCABundleTable(ctx); err != nil {
+		return err
+	}
+	if err := s.ensureNodeDNSTable(ctx); err != nil {
+		return err
+	}
+	if err := s.ensureStatusPageTables(ctx); err != nil {
+		return err
+	}
+	if err := s.ensureIncidentTables(ctx); err != nil {
+		return err
+	}
+	if err := s.ensureAlertTables(ctx); err != nil {
+		return err
+	}
+	if err := s.ensureAccountPurgeTable(ctx); err != nil {
+		return err
+	}
+	if err := s.ensureSessionsTable(ctx); err != nil {
+		return err
+	}
 	if err := s.SeedDefaultSettings(); err != nil {
 		return err
 	}
@@ -71,5 +132,6 @@ func (s *Store) Close() error {
 	if s == nil || s.db == nil {
 		return nil
 	}
+	s.resetStmtCache()
 	return s.db.Close()
 }
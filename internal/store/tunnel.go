@@ -29,7 +29,7 @@ const (
 
 // GetTunnelConfig 读取隧道配置；未配置时返回 ErrNotFound。
 func (s *Store) GetTunnelConfig(ctx context.Context) (*TunnelConfig, error) {
-	ctx, cancel := withTimeout(ctx)
+	ctx, cancel := s.withTimeout(ctx, opRead)
 	defer cancel()
 
 	row := s.db.QueryRowContext(ctx, `SELECT id, api_token, subdomain, zone, enabled, public_url, status, last_error, updated_at FROM tunnel_config LIMIT 1`)
@@ -58,7 +58,7 @@ func (s *Store) GetTunnelConfig(ctx context.Context) (*TunnelConfig, error) {
 
 // SaveTunnelConfig 保存隧道配置；若未提供 APIToken 则沿用已存储的值。
 func (s *Store) SaveTunnelConfig(ctx context.Context, cfg TunnelConfig) error {
-	ctx, cancel := withTimeout(ctx)
+	ctx, cancel := s.withTimeout(ctx, opWrite)
 	defer cancel()
 
 	if cfg.ID == "" {
@@ -36,6 +36,10 @@ type NodeRecord struct {
 	LastPingMs        int64
 	LastPingErr       string
 	LastHealthCheckAt time.Time
+	State             string // healthy/degraded/failing/down/disabled/draining
+	StateChangedAt    time.Time
+	Headers           map[string]string // 转发与探活时附加的请求头
+	HealthIntervalSec int               // 节点级健康检查间隔，0 表示沿用账号配置
 }
 
 // HealthCheckRecord 健康检查历史记录
@@ -48,6 +52,8 @@ type HealthCheckRecord struct {
 	ResponseTimeMs int
 	ErrorMessage   string
 	CheckMethod    string
+	IntervalMs     int64 // 本次检查后生效的检查间隔（含失败退避）
+	DNSMs          int64 // 域名解析耗时，复用连接或 CLI 检查时为 0
 	CreatedAt      time.Time
 }
 
@@ -77,6 +83,10 @@ type MetricsRecord struct {
 	ID                  int64
 	AccountID           string
 	NodeID              string
+	Label               string // 客户端标签（X-QCC-Label），仅原始数据保存
+	Model               string // 请求模型，仅原始数据保存
+	KeyID               string // 代理密钥指纹，仅原始数据保存
+	ErrorClass          string // 失败分类（成功为空），仅原始数据保存
 	Timestamp           time.Time
 	RequestsTotal       int64
 	RequestsSuccess     int64
@@ -88,6 +98,9 @@ type MetricsRecord struct {
 	OutputTokensTotal   int64
 	FirstByteTimeSumMs  int64 // 首字节时间总和（毫秒）
 	StreamDurationSumMs int64 // 流式持续时间总和（毫秒）
+	HedgedTotal         int64 // 发起对冲的请求数，仅原始数据保存
+	HedgeWinsTotal      int64 // 由备用节点胜出的对冲请求数
+	HedgeWastedTokens   int64 // 落败请求估算浪费的 token
 	CreatedAt           time.Time
 }
 
@@ -184,10 +197,18 @@ type NotificationChannelRecord struct {
 	Name        string
 	Config      json.RawMessage
 	Enabled     bool
+	DigestMode  string // immediate/15m/hourly
 	CreatedAt   time.Time
 	UpdatedAt   time.Time
 }
 
+// 通知渠道摘要模式：即时发送，或按 15 分钟/小时合并发送。
+const (
+	DigestImmediate = "immediate"
+	Digest15Min     = "15m"
+	DigestHourly    = "hourly"
+)
+
 // NotificationSubscriptionRecord 描述通知订阅。
 type NotificationSubscriptionRecord struct {
 	ID        string
@@ -228,12 +249,36 @@ type MonitorShareRecord struct {
 	CreatedAt time.Time  `json:"created_at"`
 	Revoked   bool       `json:"revoked"`
 	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	Label     string     `json:"label"`
+}
+
+// 分享链接状态。
+const (
+	MonitorShareActive  = "active"
+	MonitorShareExpired = "expired"
+	MonitorShareRevoked = "revoked"
+)
+
+// Status 返回分享链接在 now 时刻的状态。
+func (r MonitorShareRecord) Status(now time.Time) string {
+	switch {
+	case r.Revoked:
+		return MonitorShareRevoked
+	case !r.ExpireAt.IsZero() && !r.ExpireAt.After(now):
+		return MonitorShareExpired
+	default:
+		return MonitorShareActive
+	}
 }
 
 // QueryMonitorSharesParams 查询参数
 type QueryMonitorSharesParams struct {
 	AccountID      string
 	IncludeRevoked bool
+	Status         string // active/expired/revoked，非空时忽略 IncludeRevoked
+	CreatedBy      string
+	CreatedFrom    time.Time
+	CreatedTo      time.Time
 	Limit          int
 	Offset         int
 }
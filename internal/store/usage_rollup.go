@@ -0,0 +1,210 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// UsageRollupDimensions 为汇总表支持的切分维度（同时也是列名）。
+var UsageRollupDimensions = []string{"node_id", "model", "label", "key_id"}
+
+// UsageRollupQuery 多维汇总查询条件；Filters 的键须为 UsageRollupDimensions 之一。
+type UsageRollupQuery struct {
+	AccountID   string
+	Granularity MetricsGranularity // hour/day
+	From        time.Time
+	To          time.Time
+	GroupBy     []string // 维度列表，可额外包含 "bucket" 按时间桶展开
+	Filters     map[string]string
+	Limit       int
+}
+
+// UsageRollupRow 汇总查询结果，Dims 仅包含 GroupBy 中的维度。
+type UsageRollupRow struct {
+	Dims              map[string]string
+	BucketStart       time.Time
+	RequestsTotal     int64
+	RequestsFailed    int64
+	InputTokensTotal  int64
+	OutputTokensTotal int64
+	BytesTotal        int64
+	ResponseTimeSumMs int64
+}
+
+func usageRollupTable(gr MetricsGranularity) (string, error) {
+	switch gr {
+	case MetricsGranularityHourly, "":
+		return "usage_rollups_hourly", nil
+	case MetricsGranularityDaily:
+		return "usage_rollups_daily", nil
+	default:
+		return "", fmt.Errorf("unsupported rollup granularity: %s", gr)
+	}
+}
+
+func isUsageRollupDimension(dim string) bool {
+	for _, d := range UsageRollupDimensions {
+		if d == dim {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Store) ensureUsageRollupTables(ctx context.Context) error {
+	ctx, cancel := s.withTimeout(ctx, opWrite)
+	defer cancel()
+	for _, table := range []string{"usage_rollups_hourly", "usage_rollups_daily"} {
+		stmt := `CREATE TABLE IF NOT EXISTS ` + table + ` (
+			account_id VARCHAR(64) NOT NULL,
+			bucket_start DATETIME NOT NULL,
+			node_id VARCHAR(64) NOT NULL,
+			model VARCHAR(128) NOT NULL DEFAULT '',
+			label VARCHAR(64) NOT NULL DEFAULT '',
+			key_id VARCHAR(64) NOT NULL DEFAULT '',
+			requests_total BIGINT DEFAULT 0,
+			requests_failed BIGINT DEFAULT 0,
+			input_tokens_total BIGINT DEFAULT 0,
+			output_tokens_total BIGINT DEFAULT 0,
+			bytes_total BIGINT DEFAULT 0,
+			response_time_sum_ms BIGINT DEFAULT 0,
+			PRIMARY KEY (account_id, bucket_start, node_id, model, label, key_id),
+			KEY idx_` + table + `_time (bucket_start)
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`
+		if _, err := s.db.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AggregateUsageRollups 维护多维汇总表：hour 由原始指标生成，day 由小时汇总生成。
+func (s *Store) AggregateUsageRollups(ctx context.Context, target MetricsGranularity, from, to time.Time) error {
+	var srcTable, timeCol, dstTable, bucketExpr string
+	switch target {
+	case MetricsGranularityHourly:
+		srcTable, timeCol, dstTable, bucketExpr = "node_metrics_raw", "ts", "usage_rollups_hourly", "DATE_FORMAT(ts, '%Y-%m-%d %H:00:00')"
+	case MetricsGranularityDaily:
+		srcTable, timeCol, dstTable, bucketExpr = "usage_rollups_hourly", "bucket_start", "usage_rollups_daily", "DATE(bucket_start)"
+	default:
+		return fmt.Errorf("unsupported rollup granularity: %s", target)
+	}
+	if to.IsZero() {
+		to = time.Now().UTC()
+	}
+	if from.IsZero() {
+		from = to.Add(-24 * time.Hour)
+	}
+	// GROUP BY 必须使用桶表达式：源表（小时汇总）自身也有 bucket_start 列，按别名分组会解析为源列，
+	// 一天内的多个小时各成一组，ON DUPLICATE KEY UPDATE 只留下最后一个小时。
+	stmt := fmt.Sprintf(`INSERT INTO %s (
+		account_id, bucket_start, node_id, model, label, key_id,
+		requests_total, requests_failed, input_tokens_total, output_tokens_total, bytes_total, response_time_sum_ms)
+		SELECT account_id, %s AS bucket_start, node_id, model, label, key_id,
+			SUM(requests_total), SUM(requests_failed), SUM(input_tokens_total), SUM(output_tokens_total), SUM(bytes_total), SUM(response_time_sum_ms)
+		FROM %s WHERE %s >= ? AND %s < ?
+		GROUP BY account_id, %s, node_id, model, label, key_id
+		ON DUPLICATE KEY UPDATE requests_total=VALUES(requests_total), requests_failed=VALUES(requests_failed),
+			input_tokens_total=VALUES(input_tokens_total), output_tokens_total=VALUES(output_tokens_total),
+			bytes_total=VALUES(bytes_total), response_time_sum_ms=VALUES(response_time_sum_ms)`,
+		dstTable, bucketExpr, srcTable, timeCol, timeCol, bucketExpr)
+
+	ctx, cancel := s.withTimeout(ctx, opAggregate)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, stmt, from.UTC(), to.UTC())
+	return err
+}
+
+// QueryUsageRollups 按任意维度组合汇总用量，不扫描原始数据。
+func (s *Store) QueryUsageRollups(ctx context.Context, q UsageRollupQuery) ([]UsageRollupRow, error) {
+	table, err := usageRollupTable(q.Granularity)
+	if err != nil {
+		return nil, err
+	}
+	if q.To.IsZero() {
+		q.To = time.Now().UTC()
+	}
+	if q.From.IsZero() {
+		q.From = q.To.Add(-7 * 24 * time.Hour)
+	}
+
+	var (
+		dims      []string
+		byBucket  bool
+		selectCol []string
+	)
+	for _, g := range q.GroupBy {
+		switch {
+		case g == "bucket":
+			byBucket = true
+		case isUsageRollupDimension(g):
+			dims = append(dims, g)
+		default:
+			return nil, fmt.Errorf("unsupported group_by dimension: %s", g)
+		}
+	}
+	groupCols := append([]string{}, dims...)
+	if byBucket {
+		groupCols = append(groupCols, "bucket_start")
+	}
+	selectCol = append(selectCol, groupCols...)
+	// 不分组且没有匹配行时 SUM 为 NULL。
+	selectCol = append(selectCol, "COALESCE(SUM(requests_total),0)", "COALESCE(SUM(requests_failed),0)", "COALESCE(SUM(input_tokens_total),0)",
+		"COALESCE(SUM(output_tokens_total),0)", "COALESCE(SUM(bytes_total),0)", "COALESCE(SUM(response_time_sum_ms),0)")
+
+	b := &strings.Builder{}
+	args := []interface{}{normalizeAccount(q.AccountID), q.From.UTC(), q.To.UTC()}
+	fmt.Fprintf(b, "SELECT %s FROM %s WHERE account_id=? AND bucket_start >= ? AND bucket_start < ?", strings.Join(selectCol, ", "), table)
+	for _, d := range UsageRollupDimensions {
+		if v, ok := q.Filters[d]; ok && v != "" {
+			fmt.Fprintf(b, " AND %s=?", d)
+			args = append(args, v)
+		}
+	}
+	if len(groupCols) > 0 {
+		b.WriteString(" GROUP BY " + strings.Join(groupCols, ", "))
+	}
+	if byBucket {
+		b.WriteString(" ORDER BY bucket_start ASC")
+	} else {
+		b.WriteString(" ORDER BY SUM(input_tokens_total)+SUM(output_tokens_total) DESC")
+	}
+	limit := q.Limit
+	if limit <= 0 || limit > 5000 {
+		limit = 1000
+	}
+	b.WriteString(" LIMIT ?")
+	args = append(args, limit)
+
+	ctx, cancel := s.withTimeout(ctx, opRead)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, b.String(), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var res []UsageRollupRow
+	for rows.Next() {
+		row := UsageRollupRow{Dims: make(map[string]string, len(dims))}
+		dimVals := make([]string, len(dims))
+		dest := make([]interface{}, 0, len(groupCols)+6)
+		for i := range dimVals {
+			dest = append(dest, &dimVals[i])
+		}
+		if byBucket {
+			dest = append(dest, &row.BucketStart)
+		}
+		dest = append(dest, &row.RequestsTotal, &row.RequestsFailed, &row.InputTokensTotal,
+			&row.OutputTokensTotal, &row.BytesTotal, &row.ResponseTimeSumMs)
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		for i, d := range dims {
+			row.Dims[d] = dimVals[i]
+		}
+		res = append(res, row)
+	}
+	return res, rows.Err()
+}
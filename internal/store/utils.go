@@ -1,12 +1,81 @@
 package store
 
-import "context"
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
 
-func withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	"github.com/go-sql-driver/mysql"
+)
+
+// opClass 存储操作类别，各类别使用独立的超时时间。
+type opClass int
+
+const (
+	opRead opClass = iota
+	opWrite
+	opAggregate
+	opCleanup
+)
+
+// Timeouts 各类存储操作的超时时间，调用方 ctx 已带截止时间时以调用方为准。
+type Timeouts struct {
+	Read      time.Duration
+	Write     time.Duration
+	Aggregate time.Duration
+	Cleanup   time.Duration
+}
+
+// DefaultTimeouts 返回默认超时：点查与写入沿用 5 秒，聚合与清理放宽。
+func DefaultTimeouts() Timeouts {
+	return Timeouts{Read: defaultTimeout, Write: defaultTimeout, Aggregate: time.Minute, Cleanup: 2 * time.Minute}
+}
+
+// SetTimeouts 运行时调整各类操作的超时，非正数的项使用默认值。
+func (s *Store) SetTimeouts(t Timeouts) {
+	def := DefaultTimeouts()
+	if t.Read <= 0 {
+		t.Read = def.Read
+	}
+	if t.Write <= 0 {
+		t.Write = def.Write
+	}
+	if t.Aggregate <= 0 {
+		t.Aggregate = def.Aggregate
+	}
+	if t.Cleanup <= 0 {
+		t.Cleanup = def.Cleanup
+	}
+	s.timeouts.Store(&t)
+}
+
+// Timeouts 返回当前生效的超时配置。
+func (s *Store) Timeouts() Timeouts {
+	if s == nil {
+		return DefaultTimeouts()
+	}
+	if t := s.timeouts.Load(); t != nil {
+		return *t
+	}
+	return DefaultTimeouts()
+}
+
+func (s *Store) withTimeout(ctx context.Context, op opClass) (context.Context, context.CancelFunc) {
 	if _, ok := ctx.Deadline(); ok {
 		return ctx, func() {}
 	}
-	return context.WithTimeout(ctx, defaultTimeout)
+	t := s.Timeouts()
+	d := t.Read
+	switch op {
+	case opWrite:
+		d = t.Write
+	case opAggregate:
+		d = t.Aggregate
+	case opCleanup:
+		d = t.Cleanup
+	}
+	return context.WithTimeout(ctx, d)
 }
 
 func normalizeAccount(accountID string) string {
@@ -22,3 +91,12 @@ func nullOrString(v string) interface{} {
 	}
 	return v
 }
+
+// isMissingTable 判断错误是否为表不存在（MySQL 1146 或 SQLite 的 no such table）。
+func isMissingTable(err error) bool {
+	var me *mysql.MySQLError
+	if errors.As(err, &me) {
+		return me.Number == 1146
+	}
+	return err != nil && strings.Contains(err.Error(), "no such table")
+}
@@ -0,0 +1,180 @@
+package version
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultReleaseFeed is the release feed queried when no feed URL is configured.
+const DefaultReleaseFeed = "https://api.github.com/repos/Heartcoolman/qcc_plus/releases/latest"
+
+const maxFeedBytes = 1 << 20
+
+// Release describes the latest release published by the feed.
+type Release struct {
+	Version      string    `json:"version"`
+	ChangelogURL string    `json:"changelog_url,omitempty"`
+	PublishedAt  time.Time `json:"published_at,omitempty"`
+}
+
+// UpdateStatus is the result of the most recent update check.
+type UpdateStatus struct {
+	Current         string    `json:"current"`
+	Latest          *Release  `json:"latest,omitempty"`
+	UpdateAvailable bool      `json:"update_available"`
+	CheckedAt       time.Time `json:"checked_at,omitempty"`
+	Error           string    `json:"error,omitempty"`
+}
+
+// UpdateChecker queries a release feed and remembers the latest release.
+// The feed may be a GitHub "releases/latest" response or a plain
+// {"version": "...", "changelog_url": "..."} document.
+type UpdateChecker struct {
+	client *http.Client
+
+	mu        sync.RWMutex
+	latest    *Release
+	checkedAt time.Time
+	lastErr   string
+}
+
+// NewUpdateChecker creates a checker using the given HTTP client (nil uses a client with a 10s timeout).
+func NewUpdateChecker(client *http.Client) *UpdateChecker {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &UpdateChecker{client: client}
+}
+
+// Check fetches the feed and records the latest release.
+func (c *UpdateChecker) Check(ctx context.Context, feedURL string) (*Release, error) {
+	if feedURL == "" {
+		feedURL = DefaultReleaseFeed
+	}
+	rel, err := c.fetch(ctx, feedURL)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checkedAt = time.Now()
+	if err != nil {
+		c.lastErr = err.Error()
+		return nil, err
+	}
+	c.latest, c.lastErr = rel, ""
+	return rel, nil
+}
+
+func (c *UpdateChecker) fetch(ctx context.Context, feedURL string) (*Release, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, feedURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", "qcc_plus/"+Version)
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("release feed returned %s", resp.Status)
+	}
+	var feed struct {
+		TagName      string    `json:"tag_name"`
+		Version      string    `json:"version"`
+		HTMLURL      string    `json:"html_url"`
+		ChangelogURL string    `json:"changelog_url"`
+		PublishedAt  time.Time `json:"published_at"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxFeedBytes)).Decode(&feed); err != nil {
+		return nil, fmt.Errorf("decode release feed: %w", err)
+	}
+	rel := &Release{
+		Version:      strings.TrimSpace(feed.Version),
+		ChangelogURL: feed.ChangelogURL,
+		PublishedAt:  feed.PublishedAt,
+	}
+	if rel.Version == "" {
+		rel.Version = strings.TrimSpace(feed.TagName)
+	}
+	if rel.ChangelogURL == "" {
+		rel.ChangelogURL = feed.HTMLURL
+	}
+	if rel.Version == "" {
+		return nil, errors.New("release feed has no version")
+	}
+	return rel, nil
+}
+
+// Status returns the current version compared with the latest known release.
+func (c *UpdateChecker) Status() UpdateStatus {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	st := UpdateStatus{Current: Version, CheckedAt: c.checkedAt, Error: c.lastErr}
+	if c.latest != nil {
+		rel := *c.latest
+		st.Latest = &rel
+		st.UpdateAvailable = IsNewer(rel.Version, Version)
+	}
+	return st
+}
+
+// IsNewer reports whether version a is newer than b. Versions are compared as
+// dotted numbers with an optional "v" prefix; a pre-release ("1.2.0-rc1") is
+// older than the release itself. Unparseable versions (e.g. "dev") never compare as newer.
+func IsNewer(a, b string) bool {
+	va, okA := parseVersion(a)
+	vb, okB := parseVersion(b)
+	if !okA || !okB {
+		return false
+	}
+	for i := 0; i < len(va.nums) || i < len(vb.nums); i++ {
+		var x, y int
+		if i < len(va.nums) {
+			x = va.nums[i]
+		}
+		if i < len(vb.nums) {
+			y = vb.nums[i]
+		}
+		if x != y {
+			return x > y
+		}
+	}
+	switch {
+	case va.pre == vb.pre:
+		return false
+	case va.pre == "":
+		return true
+	case vb.pre == "":
+		return false
+	}
+	return va.pre > vb.pre
+}
+
+type parsedVersion struct {
+	nums []int
+	pre  string
+}
+
+func parseVersion(s string) (parsedVersion, bool) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "v")
+	s, _, _ = strings.Cut(s, "+")
+	core, pre, _ := strings.Cut(s, "-")
+	var v parsedVersion
+	for _, part := range strings.Split(core, ".") {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return v, false
+		}
+		v.nums = append(v.nums, n)
+	}
+	v.pre = pre
+	return v, true
+}
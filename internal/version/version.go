@@ -4,6 +4,7 @@ import (
 	"runtime"
 	"time"
 
+	"qcc_plus/internal/i18n"
 	"qcc_plus/internal/timeutil"
 )
 
@@ -21,25 +22,60 @@ type Info struct {
 	GitCommit        string `json:"git_commit"`
 	BuildDate        string `json:"build_date"`
 	BuildDateBeijing string `json:"build_date_beijing"`
+	BuildDateLocal   string `json:"build_date_local,omitempty"` // 按请求语言与时区格式化的构建时间
+	Locale           string `json:"locale,omitempty"`
 	GoVersion        string `json:"go_version"`
+	Platform         string `json:"platform"`
+	// Features is only filled in for authenticated callers; the public
+	// /version endpoint does not reveal how a deployment is configured.
+	Features *Features `json:"features,omitempty"`
+}
+
+// Features describes which optional subsystems are enabled in a running deployment.
+type Features struct {
+	DBBackend          string `json:"db_backend"` // "mysql", or "none" when running without persistence
+	MetricsStore       bool   `json:"metrics_store"`
+	SettingsStore      bool   `json:"settings_store"`
+	WSHub              bool   `json:"ws_hub"`
+	HealthScheduler    bool   `json:"health_scheduler"`
+	MetricsScheduler   bool   `json:"metrics_scheduler"`
+	BenchmarkScheduler bool   `json:"benchmark_scheduler"`
+	AdaptiveWeight     bool   `json:"adaptive_weight"`
+	Notifications      bool   `json:"notifications"`
+	Tunnel             bool   `json:"tunnel"` // whether the tunnel is currently running
+	UpdateCheck        bool   `json:"update_check"`
 }
 
 // GetFormattedBuildDate returns the build time formatted in Beijing time.
 // BuildDate is expected to be an RFC3339 string in UTC set at build time.
 func GetFormattedBuildDate() string {
+	return FormatBuildDate(i18n.DefaultLocale, timeutil.BeijingLocation)
+}
+
+// FormatBuildDate returns the build time formatted for the given locale and time zone.
+func FormatBuildDate(locale string, loc *time.Location) string {
 	switch BuildDate {
 	case "":
-		return "未知"
+		return i18n.T(locale, "version.unknown")
 	case "dev":
-		return "开发版本"
+		return i18n.T(locale, "version.dev")
 	}
 
 	t, err := time.Parse(time.RFC3339, BuildDate)
 	if err != nil {
-		return BuildDate + " (格式错误)"
+		return i18n.T(locale, "version.bad_format", BuildDate)
 	}
 
-	return timeutil.FormatBeijingTime(t)
+	return i18n.FormatTime(t, loc, locale)
+}
+
+// GetLocalizedVersionInfo returns the version metadata with the build date
+// additionally formatted for the given locale and time zone.
+func GetLocalizedVersionInfo(locale string, loc *time.Location) Info {
+	info := GetVersionInfo()
+	info.BuildDateLocal = FormatBuildDate(locale, loc)
+	info.Locale = locale
+	return info
 }
 
 // GetVersionInfo returns the current version metadata.
@@ -50,5 +86,6 @@ func GetVersionInfo() Info {
 		BuildDate:        BuildDate,
 		BuildDateBeijing: GetFormattedBuildDate(),
 		GoVersion:        GoVersion,
+		Platform:         runtime.GOOS + "/" + runtime.GOARCH,
 	}
 }